@@ -0,0 +1,222 @@
+// Package archive imports the room histories that Element exports as JSON, so
+// that people moving away from Element can still browse them. Imported
+// histories are kept locally as archives and never touch the homeserver.
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/sys"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// Archive is a room history exported by Element.
+type Archive struct {
+	RoomName    string            `json:"room_name"`
+	RoomCreator matrix.UserID     `json:"room_creator"`
+	Topic       string            `json:"topic"`
+	ExportDate  string            `json:"export_date"`
+	ExportedBy  matrix.UserID     `json:"exported_by"`
+	Messages    []json.RawMessage `json:"messages"`
+}
+
+// Parse parses the JSON file that Element exports a room's history into.
+func Parse(b []byte) (*Archive, error) {
+	var a Archive
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON")
+	}
+
+	if a.Messages == nil {
+		return nil, errors.New("not an Element room export")
+	}
+
+	return &a, nil
+}
+
+// RoomID returns the ID of the exported room. It's taken from the messages,
+// since the export doesn't have it otherwise.
+func (a *Archive) RoomID() matrix.RoomID {
+	for _, raw := range a.Messages {
+		var ev struct {
+			RoomID matrix.RoomID `json:"room_id"`
+		}
+		if json.Unmarshal(raw, &ev) == nil && ev.RoomID != "" {
+			return ev.RoomID
+		}
+	}
+	return ""
+}
+
+// Events parses the messages into events in the order that they were sent.
+func (a *Archive) Events() []event.RoomEvent {
+	roomID := a.RoomID()
+
+	events := make([]event.RoomEvent, 0, len(a.Messages))
+	for _, raw := range a.Messages {
+		events = append(events, sys.ParseTimeline(raw, roomID))
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].RoomInfo().OriginServerTime < events[j].RoomInfo().OriginServerTime
+	})
+
+	return events
+}
+
+// Names returns the display names of the members as of the latest member event
+// of each member in the export.
+func (a *Archive) Names(events []event.RoomEvent) map[matrix.UserID]string {
+	names := make(map[matrix.UserID]string)
+
+	for _, ev := range events {
+		member, ok := ev.(*event.RoomMemberEvent)
+		if !ok {
+			continue
+		}
+
+		if member.DisplayName != nil && *member.DisplayName != "" {
+			names[member.UserID] = *member.DisplayName
+		} else {
+			delete(names, member.UserID)
+		}
+	}
+
+	return names
+}
+
+// Title returns the room name, or the room ID if the room has no name.
+func (a *Archive) Title() string {
+	if a.RoomName != "" {
+		return a.RoomName
+	}
+	if id := a.RoomID(); id != "" {
+		return string(id)
+	}
+	return "Unnamed Room"
+}
+
+// Saved is an archive that's been imported.
+type Saved struct {
+	Path     string
+	Title    string
+	Messages int
+	Imported time.Time
+}
+
+func dir(ctx context.Context) string {
+	return app.FromContext(ctx).ConfigPath("archives")
+}
+
+// List lists the imported archives, newest first.
+func List(ctx context.Context) ([]Saved, error) {
+	files, err := ioutil.ReadDir(dir(ctx))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "cannot list archives")
+	}
+
+	saved := make([]Saved, 0, len(files))
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		path := filepath.Join(dir(ctx), file.Name())
+
+		a, err := Load(path)
+		if err != nil {
+			continue
+		}
+
+		saved = append(saved, Saved{
+			Path:     path,
+			Title:    a.Title(),
+			Messages: len(a.Messages),
+			Imported: file.ModTime(),
+		})
+	}
+
+	sort.Slice(saved, func(i, j int) bool {
+		return saved[i].Imported.After(saved[j].Imported)
+	})
+
+	return saved, nil
+}
+
+// Load loads the archive at the given path.
+func Load(path string) (*Archive, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read archive")
+	}
+	return Parse(b)
+}
+
+// Import parses the Element export at the given path and copies it into the
+// archives. The imported archive is returned.
+func Import(ctx context.Context, path string) (*Archive, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read export")
+	}
+
+	a, err := Parse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir(ctx), 0700); err != nil {
+		return nil, errors.Wrap(err, "cannot make archives directory")
+	}
+
+	name := fmt.Sprintf("%d-%s.json", time.Now().Unix(), fileName(a.Title()))
+
+	if err := ioutil.WriteFile(filepath.Join(dir(ctx), name), b, 0600); err != nil {
+		return nil, errors.Wrap(err, "cannot save archive")
+	}
+
+	return a, nil
+}
+
+// Delete deletes the imported archive at the given path.
+func Delete(path string) error {
+	if err := os.Remove(path); err != nil {
+		return errors.Wrap(err, "cannot delete archive")
+	}
+	return nil
+}
+
+// fileName turns the title into something safe to put in a file name.
+func fileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r == '-' || r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, title)
+
+	if len(name) > 40 {
+		name = name[:40]
+	}
+
+	return name
+}
@@ -0,0 +1,166 @@
+package archive
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/components/filepick"
+)
+
+var dialogCSS = cssutil.Applier("archive-dialog", `
+	.archive-dialog {
+		padding: 15px;
+	}
+	.archive-dialog > label {
+		margin-bottom: 8px;
+	}
+	.archive-row {
+		padding: 4px 0;
+	}
+	.archive-row-info {
+		color: alpha(@theme_fg_color, 0.75);
+		font-size: 0.9em;
+	}
+`)
+
+// Show shows the dialog that lists the imported archives and imports new ones.
+func Show(ctx context.Context) {
+	desc := gtk.NewLabel(locale.S(ctx,
+		"Browse room histories exported from Element as JSON. "+
+			"Imported histories are only kept on this device."))
+	desc.SetXAlign(0)
+	desc.SetWrap(true)
+	desc.SetWrapMode(pango.WrapWordChar)
+
+	placeholder := gtk.NewLabel(locale.S(ctx, "Nothing imported yet."))
+	placeholder.AddCSSClass("dim-label")
+	placeholder.SetMarginTop(8)
+	placeholder.SetMarginBottom(8)
+
+	list := gtk.NewListBox()
+	list.SetSelectionMode(gtk.SelectionNone)
+	list.SetPlaceholder(placeholder)
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetMinContentHeight(200)
+	scroll.SetChild(list)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(desc)
+	box.Append(scroll)
+	dialogCSS(box)
+
+	d := dialogs.NewLocalize(ctx, "Close", "Import...")
+	d.SetTitle(locale.S(ctx, "Imported History"))
+	d.SetDefaultSize(400, 400)
+	d.SetChild(box)
+	d.BindCancelClose()
+
+	var reload func()
+	reload = func() {
+		gtkutil.Async(ctx, func() func() {
+			saved, err := List(ctx)
+			return func() {
+				if err != nil {
+					app.Error(ctx, err)
+				}
+
+				for row := list.RowAtIndex(0); row != nil; row = list.RowAtIndex(0) {
+					list.Remove(row)
+				}
+
+				for _, s := range saved {
+					list.Append(newSavedRow(ctx, s, reload))
+				}
+			}
+		})
+	}
+
+	d.OK.ConnectClicked(func() {
+		filter := gtk.NewFileFilter()
+		filter.SetName(locale.S(ctx, "Element Export"))
+		filter.AddMIMEType("application/json")
+		filter.AddPattern("*.json")
+
+		chooser := filepick.NewLocalize(
+			ctx, "Import History", gtk.FileChooserActionOpen, "Import", "Cancel")
+		chooser.AddFilter(filter)
+		chooser.ConnectAccept(func() {
+			path := chooser.File().Path()
+			if path == "" {
+				return
+			}
+
+			gtkutil.Async(ctx, func() func() {
+				a, err := Import(ctx, path)
+				if err != nil {
+					return func() { app.Error(ctx, err) }
+				}
+				return func() {
+					reload()
+					Open(ctx, a)
+				}
+			})
+		})
+		chooser.Show()
+	})
+
+	reload()
+	d.Show()
+}
+
+func newSavedRow(ctx context.Context, s Saved, reload func()) gtk.Widgetter {
+	title := gtk.NewLabel(s.Title)
+	title.SetXAlign(0)
+	title.SetEllipsize(pango.EllipsizeEnd)
+
+	info := gtk.NewLabel(locale.Plural(ctx, "%d event", "%d events", s.Messages))
+	info.AddCSSClass("archive-row-info")
+	info.SetXAlign(0)
+
+	text := gtk.NewBox(gtk.OrientationVertical, 0)
+	text.SetHExpand(true)
+	text.Append(title)
+	text.Append(info)
+
+	open := gtk.NewButtonFromIconName("document-open-symbolic")
+	open.SetTooltipText(locale.S(ctx, "Open"))
+	open.SetHasFrame(false)
+	open.SetVAlign(gtk.AlignCenter)
+	open.ConnectClicked(func() {
+		gtkutil.Async(ctx, func() func() {
+			a, err := Load(s.Path)
+			if err != nil {
+				return func() { app.Error(ctx, err) }
+			}
+			return func() { Open(ctx, a) }
+		})
+	})
+
+	remove := gtk.NewButtonFromIconName("user-trash-symbolic")
+	remove.SetTooltipText(locale.S(ctx, "Delete"))
+	remove.SetHasFrame(false)
+	remove.SetVAlign(gtk.AlignCenter)
+	remove.ConnectClicked(func() {
+		if err := Delete(s.Path); err != nil {
+			app.Error(ctx, err)
+		}
+		reload()
+	})
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	box.AddCSSClass("archive-row")
+	box.Append(text)
+	box.Append(open)
+	box.Append(remove)
+
+	return box
+}
@@ -0,0 +1,165 @@
+package archive
+
+import (
+	"context"
+	"html"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mcontent"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var viewerCSS = cssutil.Applier("archive-viewer", `
+	.archive-viewer list {
+		background: none;
+	}
+	.archive-banner {
+		padding: 6px 12px;
+		border-bottom: 1px solid @borders;
+		color: alpha(@theme_fg_color, 0.75);
+		font-size: 0.9em;
+	}
+	.archive-message {
+		padding: 2px 12px;
+	}
+	.archive-message-header {
+		margin-top: 6px;
+	}
+	.archive-message-time {
+		font-size: 0.8em;
+		color: alpha(@theme_fg_color, 0.55);
+	}
+	.archive-event {
+		padding: 2px 12px;
+		font-size: 0.9em;
+		color: alpha(@theme_fg_color, 0.75);
+	}
+`)
+
+// collapseAfter is how long after a message the next message from the same
+// sender is still shown without its author.
+const collapseAfter = 5 * time.Minute
+
+// Open opens the archive in a new window. Nothing in the window is sent to the
+// homeserver; only media is still fetched from it.
+func Open(ctx context.Context, a *Archive) {
+	events := a.Events()
+	names := a.Names(events)
+
+	banner := gtk.NewLabel(locale.Sprintf(ctx,
+		"Exported from Element by %s on %s. This is a read-only archive.",
+		a.ExportedBy, a.ExportDate))
+	banner.AddCSSClass("archive-banner")
+	banner.SetXAlign(0)
+	banner.SetWrap(true)
+	banner.SetWrapMode(pango.WrapWordChar)
+
+	list := gtk.NewListBox()
+	list.SetSelectionMode(gtk.SelectionNone)
+
+	var lastSender matrix.UserID
+	var lastTime matrix.Timestamp
+
+	for _, ev := range events {
+		switch ev := ev.(type) {
+		case *event.RoomMessageEvent:
+			// There's no timeline to apply edits to, so only the original
+			// messages are shown.
+			if gotktrix.ReplacementOf(ev) != "" {
+				continue
+			}
+
+			info := ev.RoomInfo()
+			withAuthor := info.Sender != lastSender ||
+				time.Duration(info.OriginServerTime-lastTime)*time.Millisecond > collapseAfter
+
+			list.Append(newMessageRow(ctx, ev, names, withAuthor))
+			lastSender = info.Sender
+			lastTime = info.OriginServerTime
+
+		case *m.ReactionEvent:
+			// Reactions aren't worth a row of their own.
+			continue
+
+		default:
+			label := gtk.NewLabel("")
+			label.AddCSSClass("archive-event")
+			label.SetXAlign(0)
+			label.SetWrap(true)
+			label.SetWrapMode(pango.WrapWordChar)
+			label.SetMarkup(message.RenderEvent(ctx, ev))
+			list.Append(label)
+			lastSender = ""
+		}
+	}
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(list)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(banner)
+	box.Append(scroll)
+	viewerCSS(box)
+
+	win := gtk.NewWindow()
+	win.SetTransientFor(app.GTKWindowFromContext(ctx))
+	win.SetDefaultSize(600, 650)
+	win.SetTitle(app.FromContext(ctx).SuffixedTitle(a.Title()))
+	win.SetChild(box)
+
+	// Start at the latest messages, like a room would.
+	scroll.VAdjustment().ConnectChanged(func() {
+		adj := scroll.VAdjustment()
+		adj.SetValue(adj.Upper())
+	})
+
+	win.Show()
+}
+
+func newMessageRow(
+	ctx context.Context,
+	ev *event.RoomMessageEvent, names map[matrix.UserID]string, withAuthor bool) gtk.Widgetter {
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.AddCSSClass("archive-message")
+
+	if withAuthor {
+		client := gotktrix.FromContext(ctx)
+		var mods []mauthor.MarkupMod
+		if name, ok := names[ev.Sender]; ok {
+			mods = append(mods, mauthor.WithName(name))
+		}
+
+		author := gtk.NewLabel("")
+		author.SetMarkup(mauthor.Markup(client, "", ev.Sender, mods...))
+		author.SetXAlign(0)
+		author.SetEllipsize(pango.EllipsizeEnd)
+		author.SetTooltipText(string(ev.Sender))
+
+		t := time.UnixMilli(int64(ev.OriginServerTime))
+		timestamp := gtk.NewLabel(html.EscapeString(t.Format("Jan 2, 2006 15:04")))
+		timestamp.AddCSSClass("archive-message-time")
+
+		header := gtk.NewBox(gtk.OrientationHorizontal, 6)
+		header.AddCSSClass("archive-message-header")
+		header.Append(author)
+		header.Append(timestamp)
+
+		box.Append(header)
+	}
+
+	box.Append(mcontent.New(ctx, ev))
+	return box
+}
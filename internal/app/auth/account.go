@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"strings"
 
 	"github.com/diamondburned/gotkit/app/locale"
@@ -19,9 +20,18 @@ type Account struct {
 	UserID    string `json:"user_id"`
 	Username  string `json:"username"`
 	AvatarURL string `json:"avatar_url"`
+	// IdentityServer is the host of the identity server, if any.
+	IdentityServer string `json:"identity_server,omitempty"`
+	// Proxy overrides the global proxy for this account.
+	Proxy string `json:"proxy,omitempty"`
+	// OAuth is the session used to refresh Token if it was issued by an OAuth
+	// 2.0 authorization server, such as when logging in using a QR code.
+	OAuth *gotktrix.OAuthSession `json:"oauth,omitempty"`
 }
 
-func copyAccount(client *gotktrix.Client) (*Account, error) {
+// copyAccount creates a new Account from the given client. The given proxy is
+// kept as the account's proxy.
+func copyAccount(client *gotktrix.Client, proxy string) (*Account, error) {
 	id, err := client.Whoami()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get whoami")
@@ -37,13 +47,52 @@ func copyAccount(client *gotktrix.Client) (*Account, error) {
 		avatarURL, _ = client.SquareThumbnail(*mxc, avatarSize, gtkutil.ScaleFactor())
 	}
 
-	return &Account{
+	acc := &Account{
 		Server:    client.HomeServerScheme + "://" + client.HomeServer,
 		Token:     client.AccessToken,
 		UserID:    string(client.UserID),
 		Username:  username,
 		AvatarURL: avatarURL,
-	}, nil
+
+		IdentityServer: client.IdentityServer,
+		Proxy:          proxy,
+	}
+
+	if token, session, ok := client.OAuthSession(); ok {
+		acc.Token = token
+		acc.OAuth = &session
+	}
+
+	return acc, nil
+}
+
+// newClient creates a new client for the account.
+func (acc *Account) newClient(opts gotktrix.Opts) (*gotktrix.Client, error) {
+	if acc.OAuth != nil {
+		return gotktrix.NewOAuth(acc.Server, acc.Token, *acc.OAuth, opts)
+	}
+	return gotktrix.New(acc.Server, acc.Token, opts)
+}
+
+// keepTokensSaved saves the account into the given drivers every time the
+// client refreshes its access token, since the old refresh token may no longer
+// work.
+func keepTokensSaved(c *gotktrix.Client, acc *Account, drivers ...secret.Driver) {
+	if len(drivers) == 0 {
+		return
+	}
+
+	c.OnTokenRefresh(func(token string, session gotktrix.OAuthSession) {
+		acc := *acc
+		acc.Token = token
+		acc.OAuth = &session
+
+		for _, driver := range drivers {
+			if err := saveAccount(driver, &acc); err != nil {
+				log.Println("cannot save refreshed account tokens:", err)
+			}
+		}
+	})
 }
 
 func saveAccount(driver secret.Driver, a *Account) error {
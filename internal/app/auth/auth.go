@@ -27,6 +27,7 @@ type Assistant struct {
 	// states, can be nil depending on the steps
 	accounts      []assistantAccount
 	currentClient *gotktrix.ClientAuth
+	currentProxy  string
 
 	keyring     *secret.Keyring
 	encrypt     *secret.EncryptedFile
@@ -110,6 +111,7 @@ func (a *Assistant) finish(c *gotktrix.Client, acc *Account) {
 
 	// Restore context.
 	c = c.WithContext(a.ctx)
+	c.SetPrivacyMode(privacyMode.Value())
 
 	a.hasConnected = true
 	a.Continue()
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/secret"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// StoredAccount is an account loaded outside of the assistant, such as from the
+// command line.
+type StoredAccount struct {
+	Account
+	src secret.Driver
+}
+
+// LoadStoredAccounts loads the accounts that were saved when logging in. The
+// keyring is always tried; the encrypted file is only tried if a passphrase is
+// given. The context must have an application.
+func LoadStoredAccounts(ctx context.Context, passphrase string) ([]StoredAccount, error) {
+	a := app.FromContext(ctx)
+
+	drivers := []secret.Driver{secret.KeyringDriver(a.IDDot("secrets"))}
+	if path := a.ConfigPath("secrets"); passphrase != "" && secret.PathIsEncrypted(path) {
+		drivers = append(drivers, secret.EncryptedFileDriver(passphrase, path))
+	}
+
+	var stored []StoredAccount
+	var firstErr error
+
+	for _, driver := range drivers {
+		accounts, err := loadAccounts(ctx, driver)
+		if err != nil && !errors.Is(err, secret.ErrUnsupportedPlatform) && firstErr == nil {
+			firstErr = err
+		}
+
+	accountLoop:
+		for _, acc := range accounts {
+			for _, existing := range stored {
+				if existing.UserID == acc.UserID {
+					continue accountLoop
+				}
+			}
+			stored = append(stored, StoredAccount{acc, driver})
+		}
+	}
+
+	if len(stored) == 0 {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, errors.New("no saved accounts; log in using the application first")
+	}
+
+	return stored, nil
+}
+
+// FindStoredAccount returns the account with the given user ID. If the user ID
+// is empty, then the account is only returned if it's the only one.
+func FindStoredAccount(accounts []StoredAccount, userID matrix.UserID) (*StoredAccount, error) {
+	if userID == "" {
+		if len(accounts) != 1 {
+			return nil, errors.New("there are multiple accounts; choose one")
+		}
+		return &accounts[0], nil
+	}
+
+	for i, acc := range accounts {
+		if matrix.UserID(acc.UserID) == userID {
+			return &accounts[i], nil
+		}
+	}
+
+	return nil, errors.Errorf("no saved account %s", userID)
+}
+
+// Connect creates a new client for the account, going through its proxy and
+// following the privacy mode setting. The account is saved again whenever its
+// access token is refreshed. The context must have an application.
+func (acc *StoredAccount) Connect(ctx context.Context) (*gotktrix.Client, error) {
+	p := effectiveProxy(acc.Proxy)
+	if err := checkPrivacyProxy(p); err != nil {
+		return nil, err
+	}
+
+	client := httputil.NewClient()
+	if p != "" {
+		c, err := gotktrix.NewHTTPClient(p)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid proxy")
+		}
+		client = httputil.NewCustomClient(c)
+	}
+
+	c, err := acc.newClient(gotktrix.Opts{
+		Client:     client.WithContext(ctx),
+		ConfigPath: app.FromContext(ctx),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "server error")
+	}
+
+	c.IdentityServer = acc.IdentityServer
+	c.SetPrivacyMode(privacyMode.Value())
+	keepTokensSaved(c, &acc.Account, acc.src)
+
+	return c, nil
+}
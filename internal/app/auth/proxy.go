@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/pkg/errors"
+)
+
+var proxy = prefs.NewString("", prefs.StringMeta{
+	Name:    "Proxy",
+	Section: "Application",
+	Description: "The HTTP, HTTPS or SOCKS5 proxy to connect through, such as " +
+		"<code>socks5://localhost:9050</code>. Accounts can override this when " +
+		"logging in. Leave blank to use the system's proxy.",
+	Placeholder: "socks5://localhost:9050",
+	Validate: func(str string) error {
+		if str == "" {
+			return nil
+		}
+		_, err := gotktrix.ParseProxy(str)
+		return err
+	},
+})
+
+var privacyMode = prefs.NewBool(false, prefs.PropMeta{
+	Name:    "Privacy Mode",
+	Section: "Application",
+	Description: "Route all traffic through a SOCKS5 proxy, such as Tor, and " +
+		"avoid leaking information: link embeds and media from other servers " +
+		"are disabled, read receipts are sent privately and typing isn't " +
+		"shown to others. A SOCKS5 proxy must be set. Takes effect on the " +
+		"next login.",
+})
+
+// errPrivacyNoProxy is returned if privacy mode is on, but no SOCKS5 proxy is
+// set.
+var errPrivacyNoProxy = errors.New("privacy mode requires a SOCKS5 proxy")
+
+// checkPrivacyProxy ensures that the given proxy can be used in privacy mode.
+func checkPrivacyProxy(proxy string) error {
+	if !privacyMode.Value() {
+		return nil
+	}
+
+	u, err := gotktrix.ParseProxy(proxy)
+	if err != nil || (u.Scheme != "socks5" && u.Scheme != "socks5h") {
+		return errPrivacyNoProxy
+	}
+
+	return nil
+}
+
+// effectiveProxy returns the proxy to use given the account's proxy. The
+// global proxy is used if the account doesn't override it.
+func effectiveProxy(accountProxy string) string {
+	if accountProxy = strings.TrimSpace(accountProxy); accountProxy != "" {
+		return accountProxy
+	}
+	return strings.TrimSpace(proxy.Value())
+}
+
+// mediaTimeout is the timeout for fetching media, which matches imgutil's.
+const mediaTimeout = 30 * time.Second
+
+// MediaClient creates a new HTTP client for fetching media, such as images,
+// that connects through the account's proxy.
+func (a *Account) MediaClient() (*http.Client, error) {
+	proxy := effectiveProxy(a.Proxy)
+	if err := checkPrivacyProxy(proxy); err != nil {
+		return nil, err
+	}
+
+	client, err := gotktrix.NewHTTPClient(proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	client.Timeout = mediaTimeout
+	return client, nil
+}
+
+// httpClient returns the Matrix HTTP client to log in with. The client goes
+// through the given account proxy or the global proxy, if any.
+func (a *Assistant) httpClient(accountProxy string) (httputil.Client, error) {
+	p := effectiveProxy(accountProxy)
+	if err := checkPrivacyProxy(p); err != nil {
+		return httputil.Client{}, err
+	}
+
+	if p == "" {
+		return a.client, nil
+	}
+
+	client, err := gotktrix.NewHTTPClient(p)
+	if err != nil {
+		return httputil.Client{}, err
+	}
+
+	return httputil.NewCustomClient(client), nil
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotktrix/internal/components/assistant"
+	"github.com/diamondburned/gotktrix/internal/components/qrcode"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/pkg/errors"
+)
+
+var qrLoadingCSS = cssutil.Applier("auth-qr-loading", `
+	.auth-qr-loading > label {
+		margin-bottom: 12px;
+	}
+	.auth-qr-loading > .qrcode {
+		margin-bottom: 12px;
+	}
+`)
+
+func loginStepQR(a *Assistant) *assistant.Step {
+	desc := gtk.NewLabel(locale.S(a.ctx, "Creating QR code..."))
+	desc.SetWrap(true)
+	desc.SetWrapMode(pango.WrapWordChar)
+	desc.SetJustify(gtk.JustifyCenter)
+
+	qr := qrcode.NewWidget(240)
+	qr.Hide()
+
+	spinner := gtk.NewSpinner()
+	spinner.SetSizeRequest(24, 24)
+	spinner.Start()
+
+	loading := gtk.NewBox(gtk.OrientationVertical, 0)
+	loading.AddCSSClass("assistant-stepbody") // hax
+	loading.SetSizeRequest(250, -1)
+	loading.SetHAlign(gtk.AlignCenter)
+	loading.SetVAlign(gtk.AlignCenter)
+	loading.Append(desc)
+	loading.Append(qr)
+	loading.Append(spinner)
+	qrLoadingCSS(loading)
+
+	inputBox, inputs := a.makeInputs(locale.S(a.ctx, "Code shown on your other device"))
+	inputs[0].SetInputPurpose(gtk.InputPurposeDigits)
+	inputs[0].SetMaxLength(2)
+
+	errLabel := makeErrorLabel()
+	errLabel.Hide()
+
+	rememberMe := newRememberMeBox(a)
+
+	codeBox := gtk.NewBox(gtk.OrientationVertical, 0)
+	codeBox.Append(inputBox)
+	codeBox.Append(rememberMe)
+	codeBox.Hide()
+
+	step := assistant.NewStep(locale.S(a.ctx, "QR Code Login"), locale.S(a.ctx, "Continue"))
+	step.Loading = loading
+	step.CanBack = true
+
+	content := step.ContentArea()
+	content.SetOrientation(gtk.OrientationVertical)
+	content.Append(codeBox)
+	content.Append(errLabel)
+
+	var login *gotktrix.QRLogin
+
+	onError := func(err error) {
+		if login != nil {
+			go login.Close()
+			login = nil
+		}
+
+		// Just go back directly if this is a context cancelled error, since
+		// the user hit the cancel button.
+		if errors.Is(err, context.Canceled) {
+			a.GoBack()
+			return
+		}
+
+		codeBox.Hide()
+		errLabel.SetMarkup(textutil.ErrorMarkup(err.Error()))
+		errLabel.Show()
+		a.Continue()
+	}
+
+	// start shows the QR code and waits until it's scanned.
+	start := func() {
+		desc.SetText(locale.S(a.ctx, "Creating QR code..."))
+		qr.Hide()
+		codeBox.Hide()
+		errLabel.Hide()
+
+		ctx := a.CancellableBusy(a.ctx)
+
+		go func() {
+			l, err := a.currentClient.WithContext(ctx).StartQRLogin()
+			if err != nil {
+				glib.IdleAdd(func() { onError(err) })
+				return
+			}
+
+			code, err := qrcode.Encode(l.QRCode())
+			if err != nil {
+				l.Close()
+				glib.IdleAdd(func() { onError(err) })
+				return
+			}
+
+			glib.IdleAdd(func() {
+				login = l
+				qr.SetCode(code)
+				qr.Show()
+				desc.SetText(locale.S(a.ctx,
+					"Scan this QR code with a device that's already signed in, "+
+						"such as your phone."))
+			})
+
+			err = l.WaitForScan()
+
+			glib.IdleAdd(func() {
+				if err != nil {
+					onError(err)
+					return
+				}
+
+				codeBox.Show()
+				inputs[0].SetText("")
+				a.Continue()
+				inputs[0].GrabFocus()
+			})
+		}()
+	}
+
+	step.SwitchedTo = func(*assistant.Step) { start() }
+
+	step.Done = func(*assistant.Step) {
+		if login == nil {
+			// The previous attempt failed, so try again.
+			start()
+			return
+		}
+
+		if !login.VerifyCheckCode(inputs[0].Text()) {
+			errLabel.SetMarkup(textutil.ErrorMarkup(locale.S(a.ctx, "The code does not match. Please try again.")))
+			errLabel.Show()
+			return
+		}
+
+		errLabel.Hide()
+
+		qr.Hide()
+		desc.SetText(locale.S(a.ctx, "Waiting for the login to be approved on your other device..."))
+
+		ctx := a.CancellableBusy(a.ctx)
+		l := login.WithContext(ctx)
+
+		go func() {
+			c, err := l.Login()
+			if err != nil {
+				glib.IdleAdd(func() { onError(err) })
+				return
+			}
+
+			acc, err := copyAccount(c, a.currentProxy)
+			if err != nil {
+				glib.IdleAdd(func() { onError(err) })
+				return
+			}
+
+			glib.IdleAdd(func() {
+				// Assistant is still busy at this point.
+				rememberMe.saveAndFinish(c, a, acc)
+			})
+		}()
+	}
+
+	return step
+}
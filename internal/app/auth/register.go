@@ -0,0 +1,333 @@
+package auth
+
+import (
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotktrix/internal/components/assistant"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// registerPage shows the step that creates a new account on the current
+// homeserver.
+func (a *Assistant) registerPage() {
+	step := registerStep(a)
+	a.AddStep(step)
+	a.SetStep(step)
+}
+
+func registerStep(a *Assistant) *assistant.Step {
+	inputBox, inputs := a.makeInputs(
+		locale.S(a.ctx, "Username"),
+		locale.S(a.ctx, "Password"),
+		locale.S(a.ctx, "Confirm Password"),
+	)
+	inputs[1].SetInputPurpose(gtk.InputPurposePassword)
+	inputs[1].SetVisibility(false)
+	inputs[2].SetInputPurpose(gtk.InputPurposePassword)
+	inputs[2].SetVisibility(false)
+
+	errLabel := makeErrorLabel()
+	errLabel.Hide()
+
+	rememberMe := newRememberMeBox(a)
+
+	step := assistant.NewStep(locale.S(a.ctx, "Create an Account"), locale.S(a.ctx, "Register"))
+	step.CanBack = true
+
+	content := step.ContentArea()
+	content.SetOrientation(gtk.OrientationVertical)
+	content.Append(inputBox)
+	content.Append(errLabel)
+	content.Append(rememberMe)
+
+	step.Done = func(step *assistant.Step) {
+		username := inputs[0].Text()
+		password := inputs[1].Text()
+
+		if password != inputs[2].Text() {
+			showRegisterError(errLabel, errors.New(locale.S(a.ctx, "Passwords do not match.")))
+			return
+		}
+
+		ctx := a.CancellableBusy(a.ctx)
+
+		go func() {
+			client := a.currentClient.WithContext(ctx)
+
+			reg, err := client.Register(username, password)
+			if err == nil {
+				err = advanceRegistration(reg)
+			}
+
+			glib.IdleAdd(func() {
+				if err != nil {
+					showRegisterError(errLabel, err)
+					a.Continue()
+					return
+				}
+
+				a.registerNext(reg, rememberMe, errLabel)
+			})
+		}()
+	}
+
+	return step
+}
+
+// advanceRegistration completes the stages that don't need any user input. It
+// must be called outside the main thread.
+func advanceRegistration(reg *gotktrix.Registration) error {
+	for !reg.Done() {
+		switch reg.NextStage() {
+		case matrix.LoginDummy:
+			if err := reg.AuthDummy(); err != nil {
+				return err
+			}
+		case "":
+			// All stages are done, but the homeserver wants us to ask again.
+			return reg.Finish()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// registerNext either finishes the registration or shows the step for the
+// next stage. The assistant must be busy when this is called. errLabel is the
+// error label of the current step.
+func (a *Assistant) registerNext(reg *gotktrix.Registration, rememberMe *rememberMeBox, errLabel *gtk.Label) {
+	if !reg.Done() {
+		step := registerStageStep(a, reg, rememberMe)
+		a.AddStep(step)
+		a.SetStep(step)
+		return
+	}
+
+	c := reg.Client()
+
+	acc, err := copyAccount(c, a.currentProxy)
+	if err != nil {
+		showRegisterError(errLabel, err)
+		a.Continue()
+		return
+	}
+
+	// Assistant is still busy at this point.
+	rememberMe.saveAndFinish(c, a, acc)
+}
+
+func showRegisterError(errLabel *gtk.Label, err error) {
+	errLabel.SetMarkup(textutil.ErrorMarkup(err.Error()))
+	errLabel.Show()
+}
+
+var registerStageCSS = cssutil.Applier("auth-register-stage", `
+	.auth-register-stage > label {
+		margin-bottom: 6px;
+	}
+	.auth-register-stage > linkbutton {
+		margin: 0 4px;
+	}
+	.auth-register-stage > checkbutton {
+		margin-top: 6px;
+	}
+`)
+
+// registerStageStep creates a step that completes the next stage of the given
+// registration.
+func registerStageStep(a *Assistant, reg *gotktrix.Registration, rememberMe *rememberMeBox) *assistant.Step {
+	errLabel := makeErrorLabel()
+	errLabel.Hide()
+
+	stage := reg.NextStage()
+
+	okLabel := locale.S(a.ctx, "Continue")
+	if stage == matrix.LoginEmail {
+		okLabel = locale.S(a.ctx, "Send")
+	}
+
+	step := assistant.NewStep(stageTitle(a, stage), okLabel)
+	step.CanBack = true
+
+	content := step.ContentArea()
+	content.SetOrientation(gtk.OrientationVertical)
+	content.SetSizeRequest(200, -1)
+	registerStageCSS(content)
+
+	var auth func(*gotktrix.Registration) error
+
+	switch stage {
+	case gotktrix.LoginTerms:
+		desc := newRegisterDescription(locale.S(a.ctx,
+			"Please read and accept the following policies of the homeserver."))
+		content.Append(desc)
+
+		for _, policy := range reg.Terms() {
+			link := gtk.NewLinkButtonWithLabel(policy.URL, policy.Name)
+			link.SetHAlign(gtk.AlignStart)
+			content.Append(link)
+		}
+
+		accept := gtk.NewCheckButtonWithLabel(locale.S(a.ctx, "I accept the terms and conditions"))
+		content.Append(accept)
+
+		auth = func(reg *gotktrix.Registration) error {
+			return reg.AuthTerms()
+		}
+
+		step.Done = func(step *assistant.Step) {
+			if !accept.Active() {
+				showRegisterError(errLabel, errors.New(locale.S(a.ctx,
+					"The terms and conditions must be accepted to continue.")))
+				return
+			}
+			a.registerStage(reg, auth, rememberMe, errLabel)
+		}
+
+	case matrix.LoginEmail:
+		content.Append(newRegisterDescription(locale.S(a.ctx,
+			"The homeserver requires an email address. "+
+				"A verification link will be sent to it.")))
+
+		inputBox, inputs := a.makeInputs(locale.S(a.ctx, "Email"))
+		inputs[0].SetInputPurpose(gtk.InputPurposeEmail)
+		content.Append(inputBox)
+
+		var sid string
+		var attempt int
+
+		sent := newRegisterDescription(locale.S(a.ctx,
+			"Click the link in the email that was sent to you, then press Continue. "+
+				"Enter your email again to resend it."))
+		sent.Hide()
+		content.Append(sent)
+
+		auth = func(reg *gotktrix.Registration) error {
+			return reg.AuthEmail(sid)
+		}
+
+		step.Done = func(step *assistant.Step) {
+			if sid != "" && inputs[0].Text() == "" {
+				a.registerStage(reg, auth, rememberMe, errLabel)
+				return
+			}
+
+			email := inputs[0].Text()
+			attempt++
+
+			ctx := a.CancellableBusy(a.ctx)
+
+			go func() {
+				newSID, err := reg.WithContext(ctx).RequestEmailToken(email, attempt)
+
+				glib.IdleAdd(func() {
+					a.Continue()
+
+					if err != nil {
+						showRegisterError(errLabel, err)
+						return
+					}
+
+					sid = newSID
+					errLabel.Hide()
+					sent.Show()
+
+					// Clear the entry so that the next press of the OK button
+					// continues the registration instead of sending another
+					// email.
+					inputs[0].SetText("")
+					inputs[0].SetPlaceholderText(email)
+					a.OKButton().SetLabel(locale.S(a.ctx, "Continue"))
+				})
+			}()
+		}
+
+	default:
+		// Stages that we can't handle natively, such as reCAPTCHA, are done
+		// using the homeserver's fallback page in the browser.
+		content.Append(newRegisterDescription(locale.S(a.ctx,
+			"Complete this step in your web browser, then press Continue.")))
+
+		uri := reg.FallbackURL(stage)
+
+		link := gtk.NewLinkButtonWithLabel(uri, locale.S(a.ctx, "Open in Browser"))
+		link.SetHAlign(gtk.AlignCenter)
+		link.ConnectActivateLink(func() bool {
+			app.OpenURI(a.ctx, uri)
+			return true
+		})
+		content.Append(link)
+
+		auth = func(reg *gotktrix.Registration) error {
+			return reg.AuthFallback()
+		}
+
+		step.SwitchedTo = func(*assistant.Step) {
+			app.OpenURI(a.ctx, uri)
+		}
+
+		step.Done = func(step *assistant.Step) {
+			a.registerStage(reg, auth, rememberMe, errLabel)
+		}
+	}
+
+	content.Append(errLabel)
+	return step
+}
+
+// registerStage runs auth in the background and moves on to the next stage
+// once it's done.
+func (a *Assistant) registerStage(
+	reg *gotktrix.Registration, auth func(*gotktrix.Registration) error,
+	rememberMe *rememberMeBox, errLabel *gtk.Label) {
+
+	ctx := a.CancellableBusy(a.ctx)
+
+	go func() {
+		reg := reg.WithContext(ctx)
+
+		err := auth(reg)
+		if err == nil {
+			err = advanceRegistration(reg)
+		}
+
+		glib.IdleAdd(func() {
+			if err != nil {
+				showRegisterError(errLabel, err)
+				a.Continue()
+				return
+			}
+
+			a.registerNext(reg, rememberMe, errLabel)
+		})
+	}()
+}
+
+func stageTitle(a *Assistant, stage matrix.LoginMethod) string {
+	switch stage {
+	case gotktrix.LoginTerms:
+		return locale.S(a.ctx, "Terms and Conditions")
+	case matrix.LoginEmail:
+		return locale.S(a.ctx, "Email Verification")
+	case matrix.LoginRecaptcha:
+		return locale.S(a.ctx, "CAPTCHA")
+	default:
+		return locale.S(a.ctx, "Verification")
+	}
+}
+
+func newRegisterDescription(text string) *gtk.Label {
+	l := gtk.NewLabel(text)
+	l.SetWrap(true)
+	l.SetWrapMode(pango.WrapWordChar)
+	l.SetXAlign(0)
+	return l
+}
@@ -235,8 +235,15 @@ func accountChooserStep(a *Assistant) *assistant.Step {
 		ctx := a.CancellableBusy(a.ctx)
 
 		go func() {
-			c, err := gotktrix.New(acc.Server, acc.Token, gotktrix.Opts{
-				Client:     a.client.WithContext(ctx),
+			client, err := a.httpClient(acc.Proxy)
+			if err != nil {
+				err = errors.Wrap(err, "invalid proxy")
+				glib.IdleAdd(func() { onError(err) })
+				return
+			}
+
+			c, err := acc.newClient(gotktrix.Opts{
+				Client:     client.WithContext(ctx),
 				ConfigPath: app.FromContext(ctx),
 			})
 			if err != nil {
@@ -250,10 +257,13 @@ func accountChooserStep(a *Assistant) *assistant.Step {
 				return
 			}
 
-			if newAcc, err := copyAccount(c); err == nil {
+			c.IdentityServer = acc.IdentityServer
+
+			if newAcc, err := copyAccount(c, acc.Proxy); err == nil {
 				if err := saveAccount(acc.src, newAcc); err != nil {
 					log.Println("error updating old account:", err)
 				}
+				keepTokensSaved(c, newAcc, acc.src)
 			}
 
 			glib.IdleAdd(func() {
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"strings"
 
 	"github.com/diamondburned/gotk4/pkg/core/glib"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
@@ -13,12 +14,23 @@ import (
 	"github.com/pkg/errors"
 )
 
-var homeserverStepCSS = cssutil.Applier("auth-homeserver-step", ``)
+var homeserverStepCSS = cssutil.Applier("auth-homeserver-step", `
+	.auth-homeserver-step > expander {
+		margin-top: 4px;
+	}
+`)
 
 func homeserverStep(a *Assistant) *assistant.Step {
 	inputBox, inputs := a.makeInputs("Homeserver")
 	inputs[0].SetText("matrix.org")
 
+	advancedBox, advanced := a.makeInputs("Identity Server", "Proxy")
+	advanced[0].SetPlaceholderText("Discovered from homeserver")
+	advanced[1].SetPlaceholderText("Use global proxy")
+
+	advancedExpander := gtk.NewExpander("Advanced")
+	advancedExpander.SetChild(advancedBox)
+
 	errLabel := makeErrorLabel()
 	errLabel.Hide()
 
@@ -28,12 +40,17 @@ func homeserverStep(a *Assistant) *assistant.Step {
 	content := step.ContentArea()
 	content.SetOrientation(gtk.OrientationVertical)
 	content.Append(inputBox)
+	content.Append(advancedExpander)
 	content.Append(errLabel)
 	homeserverStepCSS(content)
 
 	step.Done = func(step *assistant.Step) {
 		ctx := a.CancellableBusy(a.ctx)
 
+		serverName := inputs[0].Text()
+		identityServer := advanced[0].Text()
+		proxy := advanced[1].Text()
+
 		go func() {
 			onErr := func(err error) {
 				glib.IdleAdd(func() {
@@ -43,8 +60,14 @@ func homeserverStep(a *Assistant) *assistant.Step {
 				})
 			}
 
-			c, err := gotktrix.Discover(inputs[0].Text(), gotktrix.Opts{
-				Client:     a.client.WithContext(ctx),
+			client, err := a.httpClient(proxy)
+			if err != nil {
+				onErr(errors.Wrap(err, "invalid proxy"))
+				return
+			}
+
+			c, err := gotktrix.Discover(serverName, gotktrix.Opts{
+				Client:     client.WithContext(ctx),
 				ConfigPath: app.FromContext(ctx),
 			})
 			if err != nil {
@@ -52,12 +75,22 @@ func homeserverStep(a *Assistant) *assistant.Step {
 				return
 			}
 
+			if identityServer != "" {
+				c.SetIdentityServer(identityServer)
+			}
+
 			methods, err := c.LoginMethods()
 			if err != nil {
 				onErr(err)
 				return
 			}
 
+			// QR code login isn't a login method as far as the homeserver is
+			// concerned, so it's checked separately.
+			if c.SupportsQRLogin() == nil {
+				methods = append(methods, loginQRCode)
+			}
+
 			var pass bool
 			for _, method := range methods {
 				if supportedLoginMethods[method] {
@@ -73,6 +106,7 @@ func homeserverStep(a *Assistant) *assistant.Step {
 
 			glib.IdleAdd(func() {
 				c := c.WithContext(context.Background())
+				a.currentProxy = strings.TrimSpace(proxy)
 				a.chooseHomeserver(c, methods)
 			})
 		}()
@@ -12,10 +12,15 @@ func methodToggler(a *Assistant, method matrix.LoginMethod) func() {
 	return func() { a.chooseLoginMethod(method) }
 }
 
+// loginQRCode is the pseudo login method for logging in by scanning a QR code
+// with another device.
+const loginQRCode matrix.LoginMethod = "org.matrix.msc4108"
+
 var supportedLoginMethods = map[matrix.LoginMethod]bool{
 	matrix.LoginPassword: true,
 	matrix.LoginToken:    true,
 	matrix.LoginSSO:      true,
+	loginQRCode:          true,
 }
 
 func chooseLoginStep(a *Assistant, methods []matrix.LoginMethod) *assistant.Step {
@@ -47,6 +52,23 @@ func chooseLoginStep(a *Assistant, methods []matrix.LoginMethod) *assistant.Step
 		))
 	}
 
+	if hasLoginMethod(methods, loginQRCode) {
+		content.Append(loginMethodButton(a, loginQRCode,
+			"QR Code",
+			"Log in by scanning a QR code with a device that's already signed in",
+		))
+	}
+
+	register := gtk.NewButton()
+	register.SetChild(bigSmallTitleBox(
+		"Create an Account",
+		"Register a new account on this homeserver",
+	))
+	register.ConnectClicked(a.registerPage)
+
+	content.Append(gtk.NewSeparator(gtk.OrientationVertical))
+	content.Append(register)
+
 	return step
 }
 
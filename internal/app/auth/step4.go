@@ -27,6 +27,8 @@ func loginStep(a *Assistant, method matrix.LoginMethod) *assistant.Step {
 		return loginStepSSO(a)
 	case matrix.LoginPassword, matrix.LoginToken:
 		return loginStepForm(a, method)
+	case loginQRCode:
+		return loginStepQR(a)
 	default:
 		log.Panicln("unknown login method", method)
 		return nil
@@ -95,7 +97,7 @@ func loginStepForm(a *Assistant, method matrix.LoginMethod) *assistant.Step {
 				return
 			}
 
-			acc, err := copyAccount(c)
+			acc, err := copyAccount(c, a.currentProxy)
 			if err != nil {
 				glib.IdleAdd(func() { onError(err) })
 				return
@@ -177,7 +179,7 @@ func loginStepSSO(a *Assistant) *assistant.Step {
 			return
 		}
 
-		acc, err := copyAccount(c)
+		acc, err := copyAccount(c, a.currentProxy)
 		if err != nil {
 			glib.IdleAdd(func() { onError(err) })
 			return
@@ -357,19 +359,26 @@ func newRememberMeBox(a *Assistant) *rememberMeBox {
 func (r *rememberMeBox) saveAndFinish(c *gotktrix.Client, a *Assistant, acc *Account) {
 	go func() {
 		var errors []error
+		var drivers []secret.Driver
 
 		if r.keyring && a.keyring != nil {
 			if err := saveAccount(a.keyring, acc); err != nil {
 				errors = append(errors, err)
+			} else {
+				drivers = append(drivers, a.keyring)
 			}
 		}
 
 		if r.encrypt && a.encrypt != nil {
 			if err := saveAccount(a.encrypt, acc); err != nil {
 				errors = append(errors, err)
+			} else {
+				drivers = append(drivers, a.encrypt)
 			}
 		}
 
+		keepTokensSaved(c, acc, drivers...)
+
 		glib.IdleAdd(func() {
 			errpopup.Show(a.Window, errors, func() {
 				a.Continue()
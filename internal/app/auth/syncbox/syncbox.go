@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"math"
+	"time"
 
 	"github.com/diamondburned/gotk4/pkg/core/glib"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
@@ -20,6 +21,10 @@ import (
 
 const avatarSize = 36
 
+// shutdownTimeout is how long the application waits for messages that are
+// still being sent before quitting anyway.
+const shutdownTimeout = 5 * time.Second
+
 var popupCSS = cssutil.Applier("syncbox-popup", `
 	.syncbox-popup {
 		padding: 6px 4px;
@@ -113,8 +118,11 @@ func openThen(ctx context.Context, acc *auth.Account, f func()) *Popup {
 			app.FromContext(ctx).ConnectShutdown(func() {
 				log.Println("shutting down Matrix...")
 
-				if err := client.Close(); err != nil {
-					log.Println("failed to close loop:", err)
+				ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				defer cancel()
+
+				if err := client.Shutdown(ctx); err != nil {
+					log.Println("failed to shut down:", err)
 				}
 
 				log.Println("Matrix event loop shut down.")
@@ -0,0 +1,131 @@
+// Package daemon implements the daemon mode, which keeps the saved accounts
+// syncing and notifying without any window open. Windows are only opened on
+// demand, and they reuse the daemon's clients instead of logging in again.
+package daemon
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotktrix/internal/app/auth"
+	"github.com/diamondburned/gotktrix/internal/app/lowdata"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/msgnotify"
+	"github.com/diamondburned/gotktrix/internal/app/scripting"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// shutdownTimeout is how long to wait for messages that are still being sent
+// before quitting anyway.
+const shutdownTimeout = 5 * time.Second
+
+// Account is an account that the daemon keeps synced.
+type Account struct {
+	// Context has the client.
+	Context context.Context
+	Client  *gotktrix.Client
+	Account *auth.Account
+}
+
+var (
+	running  bool
+	accounts []*Account
+)
+
+// Start starts the daemon. The application is held so that it keeps running
+// without any window, and every saved account is logged into and notified for
+// in the background. Accounts saved into the encrypted file are only used if
+// the GOTKTRIX_PASSPHRASE environment variable is set. actionID is the
+// application action that opens a room from a notification.
+//
+// Start must be called in the main thread after the preferences are loaded.
+func Start(ctx context.Context, actionID string) {
+	if running {
+		return
+	}
+	running = true
+
+	app.FromContext(ctx).Hold()
+
+	go func() {
+		stored, err := auth.LoadStoredAccounts(ctx, os.Getenv("GOTKTRIX_PASSPHRASE"))
+		if err != nil {
+			log.Println("daemon: cannot load accounts:", err)
+		}
+
+		for i := range stored {
+			go start(ctx, &stored[i], actionID)
+		}
+	}()
+}
+
+// start logs into the account and syncs it. It blocks until the initial sync
+// is done.
+func start(ctx context.Context, stored *auth.StoredAccount, actionID string) {
+	client, err := stored.Connect(ctx)
+	if err != nil {
+		log.Printf("daemon: cannot log into %s: %v", stored.UserID, err)
+		return
+	}
+
+	client.SetLowDataMode(lowdata.Enabled())
+	client.SetTextOnlyMode(lowdata.TextOnly())
+
+	if err := client.Open(); err != nil {
+		log.Printf("daemon: cannot sync %s: %v", stored.UserID, err)
+		client.Close()
+		return
+	}
+
+	log.Println("daemon: syncing", stored.UserID)
+
+	glib.IdleAdd(func() {
+		ctx := gotktrix.WithClient(ctx, client)
+
+		accounts = append(accounts, &Account{
+			Context: ctx,
+			Client:  client,
+			Account: &stored.Account,
+		})
+
+		msgnotify.LoadMentionNames(ctx)
+		msgnotify.StartNotify(ctx, actionID)
+		msgnotify.StartBadge(ctx)
+		scripting.Bind(ctx)
+
+		app.FromContext(ctx).ConnectShutdown(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+
+			if err := client.Shutdown(ctx); err != nil {
+				log.Println("daemon: failed to shut down:", err)
+			}
+		})
+	})
+}
+
+// IsRunning returns true if the daemon is started.
+func IsRunning() bool {
+	return running
+}
+
+// Accounts returns the accounts that the daemon has synced so far. It must be
+// called in the main thread.
+func Accounts() []*Account {
+	return accounts
+}
+
+// Find returns the daemon's account with the given user ID, or nil if there's
+// none. It must be called in the main thread.
+func Find(userID matrix.UserID) *Account {
+	for _, acc := range accounts {
+		if acc.Client.UserID == userID {
+			return acc
+		}
+	}
+	return nil
+}
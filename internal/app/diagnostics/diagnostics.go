@@ -0,0 +1,162 @@
+// Package diagnostics provides a dialog that checks the connection to the
+// homeserver.
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+)
+
+var diagnosticsCSS = cssutil.Applier("diagnostics", `
+	.diagnostics {
+		padding: 8px;
+	}
+	.diagnostics-row {
+		padding: 6px 4px;
+	}
+	.diagnostics-row > image,
+	.diagnostics-row > spinner {
+		margin: 0 8px;
+	}
+	.diagnostics-result,
+	.diagnostics-latency {
+		color: alpha(@theme_fg_color, 0.75);
+		font-size: 0.9em;
+	}
+	.diagnostics-error {
+		color: @error_color;
+		font-size: 0.9em;
+	}
+`)
+
+type checkRow struct {
+	*gtk.Box
+	status  *gtk.Stack
+	icon    *gtk.Image
+	result  *gtk.Label
+	latency *gtk.Label
+}
+
+func newCheckRow(ctx context.Context, name string) *checkRow {
+	r := checkRow{}
+
+	spinner := gtk.NewSpinner()
+	spinner.Start()
+
+	r.icon = gtk.NewImage()
+
+	r.status = gtk.NewStack()
+	r.status.AddChild(spinner)
+	r.status.AddChild(r.icon)
+	r.status.SetVisibleChild(spinner)
+
+	title := gtk.NewLabel(locale.S(ctx, name))
+	title.SetXAlign(0)
+
+	r.result = gtk.NewLabel("")
+	r.result.AddCSSClass("diagnostics-result")
+	r.result.SetXAlign(0)
+	r.result.SetWrap(true)
+	r.result.SetWrapMode(pango.WrapWordChar)
+	r.result.SetSelectable(true)
+
+	text := gtk.NewBox(gtk.OrientationVertical, 0)
+	text.SetHExpand(true)
+	text.Append(title)
+	text.Append(r.result)
+
+	r.latency = gtk.NewLabel("")
+	r.latency.AddCSSClass("diagnostics-latency")
+
+	r.Box = gtk.NewBox(gtk.OrientationHorizontal, 0)
+	r.Box.AddCSSClass("diagnostics-row")
+	r.Box.Append(r.status)
+	r.Box.Append(text)
+	r.Box.Append(r.latency)
+
+	return &r
+}
+
+func (r *checkRow) set(ctx context.Context, d gotktrix.Diagnostic) {
+	r.latency.SetText(locale.Sprintf(ctx, "%d ms", d.Latency.Milliseconds()))
+
+	if d.Err != nil {
+		r.icon.SetFromIconName("dialog-error-symbolic")
+		r.result.SetText(d.Err.Error())
+		r.result.RemoveCSSClass("diagnostics-result")
+		r.result.AddCSSClass("diagnostics-error")
+	} else {
+		r.icon.SetFromIconName("emblem-ok-symbolic")
+		r.result.SetText(d.Result)
+	}
+
+	r.status.SetVisibleChild(r.icon)
+}
+
+// Show shows a dialog that runs connectivity checks against the homeserver and
+// its media repository. The results can be copied for bug reports.
+func Show(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	client := gotktrix.FromContext(ctx)
+
+	d := dialogs.NewLocalize(ctx, "Close", "Copy")
+	d.SetTitle(locale.S(ctx, "Connection Diagnostics"))
+	d.SetDefaultSize(425, 375)
+	d.BindCancelClose()
+	d.ConnectDestroy(cancel)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	diagnosticsCSS(box)
+
+	names := gotktrix.DiagnosticNames()
+	rows := make(map[string]*checkRow, len(names))
+
+	for _, name := range names {
+		row := newCheckRow(ctx, name)
+		rows[name] = row
+		box.Append(row)
+	}
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(box)
+	d.SetChild(scroll)
+
+	// report keeps track of the results for copying.
+	var report strings.Builder
+	fmt.Fprintf(&report, "Homeserver: %s\n", client.FullRoute(""))
+
+	d.OK.SetSensitive(false)
+	d.OK.ConnectClicked(func() {
+		d.Clipboard().SetText(report.String())
+	})
+
+	go func() {
+		client.Diagnose(func(diag gotktrix.Diagnostic) {
+			glib.IdleAdd(func() {
+				rows[diag.Name].set(ctx, diag)
+
+				result := diag.Result
+				if diag.Err != nil {
+					result = "error: " + diag.Err.Error()
+				}
+				fmt.Fprintf(&report, "%s (%d ms): %s\n",
+					diag.Name, diag.Latency.Milliseconds(), result)
+			})
+		})
+
+		glib.IdleAdd(func() { d.OK.SetSensitive(true) })
+	}()
+
+	d.Show()
+}
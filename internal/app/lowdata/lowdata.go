@@ -0,0 +1,79 @@
+// Package lowdata switches the client into low-data mode when the user asks for
+// it or when the connection is metered, and into text-only mode when the user
+// asks for it.
+package lowdata
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+)
+
+// Modes for the Low-data Mode preference.
+const (
+	Automatic = "Automatic"
+	Always    = "Always"
+	Never     = "Never"
+)
+
+var mode = prefs.NewEnumList(Automatic, prefs.EnumListMeta{
+	PropMeta: prefs.PropMeta{
+		Name:    "Low-data Mode",
+		Section: "Application",
+		Description: "Save data by loading smaller avatars and no link embeds " +
+			"or media until clicked. Automatic turns this on when the " +
+			"connection is metered. Smaller syncs take effect on the next login.",
+	},
+	Options: []string{Automatic, Always, Never},
+})
+
+var textOnly = prefs.NewBool(false, prefs.PropMeta{
+	Name:    "Text-only Mode",
+	Section: "Application",
+	Description: "Don't load any images, link previews, avatars or custom " +
+		"emojis, for slow connections or fewer distractions. Custom emojis " +
+		"are shown as their names instead. Takes effect on newly shown " +
+		"messages and rooms.",
+})
+
+// Enabled returns true if low-data mode should be on right now.
+func Enabled() bool {
+	switch mode.Value() {
+	case Always:
+		return true
+	case Never:
+		return false
+	default:
+		return gio.NetworkMonitorGetDefault().NetworkMetered()
+	}
+}
+
+// TextOnly returns true if text-only mode should be on.
+func TextOnly() bool {
+	return textOnly.Value()
+}
+
+// Bind keeps the low-data and text-only modes of the client within the given
+// context up to date with the preferences and the connection. The returned
+// callback stops following them.
+func Bind(ctx context.Context) func() {
+	client := gotktrix.FromContext(ctx)
+	update := func() {
+		client.SetLowDataMode(Enabled())
+		client.SetTextOnlyMode(TextOnly())
+	}
+	update()
+
+	monitor := gio.NetworkMonitorGetDefault()
+	h := monitor.NotifyProperty("network-metered", update)
+	unsub1 := mode.Subscribe(update)
+	unsub2 := textOnly.Subscribe(update)
+
+	return func() {
+		monitor.HandlerDisconnect(h)
+		unsub1()
+		unsub2()
+	}
+}
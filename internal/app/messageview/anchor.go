@@ -0,0 +1,133 @@
+package messageview
+
+import (
+	"math"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// scrollAnchor keeps the topmost visible message at the same place in the
+// viewport while the user is reading scrollback, so that the timeline doesn't
+// jump when older messages are prepended or when images above finish loading.
+type scrollAnchor struct {
+	row *gtk.ListBoxRow
+	// offset is the distance from the top of the viewport to the top of row.
+	offset float64
+	// restoring is true while the anchor is scrolling the viewport, so that
+	// the anchor isn't moved by its own scrolling.
+	restoring bool
+}
+
+func (p *Page) bindScrollAnchor() {
+	p.scroll.VAdjustment().ConnectAfter("notify::value", p.updateScrollAnchor)
+
+	var clock *gdk.FrameClock
+	var signal glib.SignalHandle
+
+	p.scroll.ConnectMap(func() {
+		clock = gdk.BaseFrameClock(p.scroll.FrameClock())
+		// Restore the anchor after the layout is done, since that's when the
+		// rows have their new positions. See autoscroll.Window.
+		signal = clock.ConnectLayout(p.restoreScrollAnchor)
+	})
+
+	p.scroll.ConnectUnmap(func() {
+		if clock != nil {
+			clock.HandlerDisconnect(signal)
+			clock = nil
+		}
+	})
+}
+
+// updateScrollAnchor anchors the viewport to the topmost visible row. It is
+// called every time the user scrolls.
+func (p *Page) updateScrollAnchor() {
+	if p.anchor.restoring {
+		return
+	}
+
+	// The autoscroller already sticks to the bottom, so there's nothing to
+	// anchor to.
+	if p.scroll.IsBottomed() {
+		p.anchor.row = nil
+		return
+	}
+
+	value := p.scroll.VAdjustment().Value()
+
+	_, listTop, ok := p.list.TranslateCoordinates(p.scroll.Viewport().Child(), 0, 0)
+	if !ok {
+		return
+	}
+
+	var row *gtk.ListBoxRow
+	if y := value - listTop; y >= 0 {
+		row = p.list.RowAtY(int(y))
+	} else {
+		// The load more button is visible, so anchor to the first row, which
+		// is where older messages will be prepended.
+		row = p.firstVisibleRow()
+	}
+
+	if row == nil {
+		p.anchor.row = nil
+		return
+	}
+
+	top, ok := p.rowTop(row)
+	if !ok {
+		p.anchor.row = nil
+		return
+	}
+
+	p.anchor.row = row
+	p.anchor.offset = top - value
+}
+
+// restoreScrollAnchor scrolls the viewport so that the anchored row is at the
+// same place as it was before.
+func (p *Page) restoreScrollAnchor() {
+	if p.anchor.row == nil || p.scroll.IsBottomed() {
+		return
+	}
+
+	if p.anchor.row.Parent() == nil {
+		// The row was removed.
+		p.anchor.row = nil
+		return
+	}
+
+	top, ok := p.rowTop(p.anchor.row)
+	if !ok {
+		return
+	}
+
+	vadj := p.scroll.VAdjustment()
+
+	value := top - p.anchor.offset
+	if math.Abs(vadj.Value()-value) < 1 {
+		return
+	}
+
+	p.anchor.restoring = true
+	vadj.SetValue(value)
+	p.anchor.restoring = false
+}
+
+// rowTop returns the y position of the top of the given row within the
+// scrolled content.
+func (p *Page) rowTop(row *gtk.ListBoxRow) (float64, bool) {
+	_, y, ok := row.TranslateCoordinates(p.scroll.Viewport().Child(), 0, 0)
+	return y, ok
+}
+
+func (p *Page) firstVisibleRow() *gtk.ListBoxRow {
+	for i := 0; ; i++ {
+		row := p.list.RowAtIndex(i)
+		if row == nil || row.Visible() {
+			return row
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package compose
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/components/filepick"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/contact"
+	"github.com/diamondburned/gotrix/event"
+)
+
+var attachTrayCSS = cssutil.Applier("composer-attachtray", `
+	.composer-attachtray {
+		padding: 4px 8px;
+		padding-top: 0;
+	}
+	.composer-attachment {
+		margin-right: 4px;
+		padding-left: 8px;
+		border-radius: 999px;
+		background-color: alpha(@theme_fg_color, 0.1);
+	}
+	.composer-attachment button {
+		margin: 0;
+		padding: 2px;
+		min-width:  0;
+		min-height: 0;
+		border-radius: 999px;
+	}
+`)
+
+// attachment is a file that is staged to be sent with the next message.
+type attachment struct {
+	file gio.Filer
+	chip *gtk.Box
+}
+
+// attachTray shows the files that are staged to be sent with the next message.
+type attachTray struct {
+	*gtk.Revealer
+	box         *gtk.Box
+	attachments []*attachment
+	// changed is called when files are added or removed.
+	changed func()
+
+	ctx context.Context
+}
+
+func newAttachTray(ctx context.Context) *attachTray {
+	t := attachTray{
+		ctx:     ctx,
+		changed: func() {},
+	}
+
+	t.box = gtk.NewBox(gtk.OrientationHorizontal, 0)
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetPolicy(gtk.PolicyAutomatic, gtk.PolicyNever)
+	scroll.SetChild(t.box)
+
+	t.Revealer = gtk.NewRevealer()
+	t.Revealer.SetChild(scroll)
+	t.Revealer.SetRevealChild(false)
+	t.Revealer.SetTransitionType(gtk.RevealerTransitionTypeSlideUp)
+	attachTrayCSS(t)
+
+	return &t
+}
+
+// add stages the given file.
+func (t *attachTray) add(file gio.Filer) {
+	a := &attachment{file: file}
+
+	name := gtk.NewLabel(file.Basename())
+	name.SetEllipsize(pango.EllipsizeMiddle)
+	name.SetMaxWidthChars(24)
+	name.SetTooltipText(file.Basename())
+
+	remove := gtk.NewButtonFromIconName("window-close-symbolic")
+	remove.SetHasFrame(false)
+	remove.SetTooltipText(locale.S(t.ctx, "Remove"))
+	remove.ConnectClicked(func() { t.remove(a) })
+
+	a.chip = gtk.NewBox(gtk.OrientationHorizontal, 2)
+	a.chip.AddCSSClass("composer-attachment")
+	a.chip.Append(name)
+	a.chip.Append(remove)
+
+	t.attachments = append(t.attachments, a)
+	t.box.Append(a.chip)
+	t.Revealer.SetRevealChild(true)
+	t.changed()
+}
+
+// remove unstages the given attachment.
+func (t *attachTray) remove(a *attachment) {
+	for i, attachment := range t.attachments {
+		if attachment == a {
+			t.attachments = append(t.attachments[:i], t.attachments[i+1:]...)
+			break
+		}
+	}
+
+	t.box.Remove(a.chip)
+	t.Revealer.SetRevealChild(len(t.attachments) > 0)
+	t.changed()
+}
+
+// take returns the staged files in order and clears the tray.
+func (t *attachTray) take() []gio.Filer {
+	files := make([]gio.Filer, len(t.attachments))
+	for i, attachment := range t.attachments {
+		files[i] = attachment.file
+		t.box.Remove(attachment.chip)
+	}
+
+	t.attachments = nil
+	t.Revealer.SetRevealChild(false)
+	t.changed()
+
+	return files
+}
+
+// askAttach asks the user for files to attach to the next message.
+func (i *Input) askAttach() {
+	chooser := filepick.NewLocalize(
+		i.ctx, "Attach Files", gtk.FileChooserActionOpen, "Attach", "Cancel")
+	chooser.SetSelectMultiple(true)
+	chooser.ConnectAccept(func() {
+		list := chooser.Files()
+		for n := uint(0); n < list.NItems(); n++ {
+			i.tray.add(&gio.File{Object: list.Item(n)})
+		}
+		i.GrabFocus()
+	})
+	chooser.Show()
+}
+
+// stagedUpload is an attachment that is being sent.
+type stagedUpload struct {
+	file gio.Filer
+	mark interface{}
+	bar  *uploadProgress
+}
+
+// stageUploads takes the attachments out of the tray and adds them as sending
+// messages. It must be called in the main thread.
+func (i *Input) stageUploads() []stagedUpload {
+	files := i.tray.take()
+	uploads := make([]stagedUpload, len(files))
+
+	for n, file := range files {
+		bar := newUploadProgress(file.Basename())
+
+		ev := newRoomMessageEvent(gotktrix.FromContext(i.ctx), i.roomID)
+		ev.MessageType = event.RoomMessageFile // whatever
+
+		uploads[n] = stagedUpload{
+			file: file,
+			mark: i.ctrl.AddSendingMessageCustom(&ev, bar),
+			bar:  bar,
+		}
+	}
+
+	return uploads
+}
+
+// sendStaged sends the staged upload. It blocks until the file is sent.
+func (i *Input) sendStaged(client *gotktrix.Client, staged stagedUpload) {
+	if contact.IsVCard(staged.file.Basename(), "") {
+		if c := loadContact(i.ctx, staged.file); c != nil {
+			i.sendContact(client, staged, c)
+			return
+		}
+	}
+
+	upload, err := newUploadingFile(i.ctx, staged.file)
+	if err != nil {
+		glib.IdleAdd(func() { staged.bar.Error(err) })
+		return
+	}
+
+	used := make(chan struct{})
+	glib.IdleAdd(func() {
+		staged.bar.use(upload)
+		close(used)
+	})
+	<-used
+
+	u := uploader{
+		ctx:    i.ctx,
+		ctrl:   i.ctrl,
+		roomID: i.roomID,
+	}
+	u.sendUpload(client, staged.mark, upload, staged.bar)
+}
+
+// maxContactSize is the largest vCard file that is sent as a contact. Larger
+// files usually have a photo in them, so they're sent as files instead.
+const maxContactSize = 64 * 1024
+
+// loadContact loads the contact in the given vCard file. Nil is returned if the
+// file cannot be sent as a contact.
+func loadContact(ctx context.Context, file gio.Filer) *contact.Contact {
+	b, _, err := file.LoadContents(ctx)
+	if err != nil || len(b) > maxContactSize {
+		return nil
+	}
+
+	c, err := contact.ParseVCard(string(b))
+	if err != nil {
+		return nil
+	}
+
+	return c
+}
+
+// sendContact sends the contact in place of the staged upload.
+func (i *Input) sendContact(client *gotktrix.Client, staged stagedUpload, c *contact.Contact) {
+	msg := contact.NewMessage(newRoomMessageEvent(client, i.roomID), c)
+	eventID, err := client.RoomEventSend(i.roomID, event.TypeRoomMessage, msg)
+
+	glib.IdleAdd(func() {
+		if err != nil {
+			staged.bar.Error(err)
+		} else {
+			i.ctrl.BindSendingMessage(staged.mark, eventID)
+		}
+	})
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/diamondburned/gotk4/pkg/gdk/v4"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/prefs"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 )
 
@@ -40,6 +41,7 @@ type Autocompleter struct {
 	onSelect SelectedFunc
 
 	popover  *gtk.Popover
+	scroll   *gtk.ScrolledWindow
 	listBox  *gtk.ListBox
 	listRows []row
 
@@ -72,7 +74,20 @@ var _ = cssutil.WriteCSS(`
 const AutocompleterWidth = 250
 
 // MaxResults is the maximum number of search results.
-const MaxResults = 8
+const MaxResults = 20
+
+// rowHeight is the estimated height of each row, which is used to calculate the
+// height of the popover from the maximum number of visible rows.
+const rowHeight = 42
+
+var maxVisibleRows = prefs.NewInt(6, prefs.IntMeta{
+	Name:    "Autocomplete Rows",
+	Section: "Text",
+	Description: "The maximum number of visible rows in the autocompletion " +
+		"popover. Longer results can be scrolled.",
+	Min: 2,
+	Max: MaxResults,
+})
 
 // New creates a new instance of autocompleter.
 func New(ctx context.Context, text *gtk.TextView, f SelectedFunc) *Autocompleter {
@@ -90,7 +105,6 @@ func New(ctx context.Context, text *gtk.TextView, f SelectedFunc) *Autocompleter
 	scroll.AddCSSClass("autocomplete-list-scroll")
 	scroll.SetChild(viewport)
 	scroll.SetMinContentHeight(0)
-	scroll.SetMaxContentHeight(250)
 	scroll.SetPropagateNaturalHeight(true)
 
 	popover := gtk.NewPopover()
@@ -108,6 +122,7 @@ func New(ctx context.Context, text *gtk.TextView, f SelectedFunc) *Autocompleter
 		buffer:    text.Buffer(),
 		onSelect:  f,
 		popover:   popover,
+		scroll:    scroll,
 		listBox:   list,
 		listRows:  make([]row, 0, MaxResults),
 		searchers: make(map[rune]Searcher),
@@ -117,6 +132,10 @@ func New(ctx context.Context, text *gtk.TextView, f SelectedFunc) *Autocompleter
 		ac.selectRow(row)
 	})
 
+	maxVisibleRows.SubscribeWidget(popover, func() {
+		scroll.SetMaxContentHeight(maxVisibleRows.Value() * rowHeight)
+	})
+
 	// Ensure the context is cleaned up.
 	runtime.SetFinalizer(&ac, func(ac *Autocompleter) {
 		if ac.cancel != nil {
@@ -205,6 +224,14 @@ func (a *Autocompleter) Autocomplete() {
 
 		r.AddCSSClass("autocomplete-row")
 
+		// Select the row that the mouse is hovering over, like how the
+		// keyboard moves the selection.
+		motion := gtk.NewEventControllerMotion()
+		motion.ConnectEnter(func(x, y float64) {
+			a.listBox.SelectRow(r.ListBoxRow)
+		})
+		r.AddController(motion)
+
 		a.listBox.Append(r.ListBoxRow)
 		a.listRows = append(a.listRows, r)
 	}
@@ -223,7 +250,12 @@ func (a *Autocompleter) Select() bool {
 	if len(a.listRows) == 0 || !a.IsVisible() {
 		return false
 	}
-	a.selectRow(a.listBox.SelectedRow())
+	row := a.listBox.SelectedRow()
+	if row == nil {
+		// Nothing selectable, such as when only placeholders are shown.
+		return false
+	}
+	a.selectRow(row)
 	return true
 }
 
@@ -286,11 +318,19 @@ func (a *Autocompleter) clear() {
 	a.listRows = a.listRows[:0]
 }
 
-func (a *Autocompleter) MoveUp() bool   { return a.move(false) }
-func (a *Autocompleter) MoveDown() bool { return a.move(true) }
+func (a *Autocompleter) MoveUp() bool   { return a.move(-1, true) }
+func (a *Autocompleter) MoveDown() bool { return a.move(+1, true) }
+
+// PageUp moves the selection up by a page of visible rows. Unlike MoveUp, it
+// does not wrap around.
+func (a *Autocompleter) PageUp() bool { return a.move(-maxVisibleRows.Value(), false) }
+
+// PageDown moves the selection down by a page of visible rows. Unlike MoveDown,
+// it does not wrap around.
+func (a *Autocompleter) PageDown() bool { return a.move(+maxVisibleRows.Value(), false) }
 
-func (a *Autocompleter) move(down bool) bool {
-	if len(a.listRows) == 0 {
+func (a *Autocompleter) move(delta int, wrap bool) bool {
+	if len(a.listRows) == 0 || !a.IsVisible() {
 		return false
 	}
 
@@ -300,16 +340,19 @@ func (a *Autocompleter) move(down bool) bool {
 		return true
 	}
 
-	ix := row.Index()
-	if down {
-		ix++
-		if ix == len(a.listRows) {
+	ix := row.Index() + delta
+	switch {
+	case ix >= len(a.listRows):
+		if wrap {
 			ix = 0
+		} else {
+			ix = len(a.listRows) - 1
 		}
-	} else {
-		ix--
-		if ix == -1 {
+	case ix < 0:
+		if wrap {
 			ix = len(a.listRows) - 1
+		} else {
+			ix = 0
 		}
 	}
 
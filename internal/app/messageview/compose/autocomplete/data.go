@@ -2,10 +2,13 @@ package autocomplete
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
 	"github.com/diamondburned/gotkit/gtkutil"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 	"github.com/diamondburned/gotkit/gtkutil/imgutil"
@@ -14,6 +17,7 @@ import (
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
 	"github.com/diamondburned/gotktrix/internal/gotktrix/events/emojis"
 	"github.com/diamondburned/gotktrix/internal/gotktrix/indexer"
+	"github.com/diamondburned/gotrix/event"
 	"github.com/diamondburned/gotrix/matrix"
 	unicodeemoji "github.com/enescakir/emoji"
 	"github.com/sahilm/fuzzy"
@@ -86,18 +90,137 @@ func (d RoomMemberData) Row(ctx context.Context) *gtk.ListBoxRow {
 	return row
 }
 
+// LoadingData is a placeholder shown while the results are still being fetched.
+// It implements Data. Selecting it does nothing.
+type LoadingData string
+
+// Row implements Data.
+func (d LoadingData) Row(ctx context.Context) *gtk.ListBoxRow {
+	spinner := gtk.NewSpinner()
+	spinner.Start()
+
+	label := gtk.NewLabel(string(d))
+	label.SetXAlign(0)
+	label.SetAttributes(subNameAttrs)
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	box.Append(spinner)
+	box.Append(label)
+
+	row := gtk.NewListBoxRow()
+	row.SetChild(box)
+	row.SetActivatable(false)
+	row.SetSelectable(false)
+	row.AddCSSClass("autocomplete-loading")
+
+	return row
+}
+
 // NewRoomMemberSearcher creates a new searcher constructor that can search up
 // room members for the given room. It matches using '@'.
 func NewRoomMemberSearcher(ctx context.Context, roomID matrix.RoomID) Searcher {
+	client := gotktrix.FromContext(ctx)
 	return &roomMemberSearcher{
-		rms: gotktrix.FromContext(ctx).Index.SearchRoomMember(roomID, MaxResults),
-		res: make([]Data, 0, MaxResults),
+		client: client,
+		roomID: roomID,
+		rms:    client.Index.SearchRoomMember(roomID, MaxResults),
+		res:    make([]Data, 0, MaxResults),
 	}
 }
 
 type roomMemberSearcher struct {
+	client *gotktrix.Client
+	roomID matrix.RoomID
+
 	rms indexer.RoomMemberSearcher
 	res dataList
+
+	// recent maps recent speakers to their rank; lower ranks spoke more
+	// recently.
+	recent  map[matrix.UserID]int
+	updated time.Time
+	// last is the list of members that were last shown, which is used to keep
+	// the list from jumping around while the user is typing.
+	last map[matrix.UserID]int
+}
+
+// maxRecentSpeakers is the maximum number of recent speakers to prioritize.
+const maxRecentSpeakers = 50
+
+func (s *roomMemberSearcher) updateRecent() {
+	now := time.Now()
+	if s.recent != nil && s.updated.Add(cacheExpiry).After(now) {
+		return
+	}
+
+	s.updated = now
+	s.recent = make(map[matrix.UserID]int, maxRecentSpeakers)
+
+	s.client.Offline().EachTimelineReverse(s.roomID, func(ev event.RoomEvent) error {
+		if _, ok := ev.(*event.RoomMessageEvent); !ok {
+			return nil
+		}
+
+		sender := ev.RoomInfo().Sender
+		if sender == s.client.UserID {
+			return nil
+		}
+
+		if _, ok := s.recent[sender]; !ok {
+			s.recent[sender] = len(s.recent)
+		}
+
+		if len(s.recent) >= maxRecentSpeakers {
+			return gotktrix.EachBreak
+		}
+		return nil
+	})
+}
+
+// matchRecent returns the recent speakers whose user IDs or names match the
+// given string. It doesn't depend on the index, so it stays fast in huge
+// rooms.
+func (s *roomMemberSearcher) matchRecent(str string) []indexer.IndexedRoomMember {
+	str = strings.ToLower(strings.TrimPrefix(str, "@"))
+
+	userIDs := make([]matrix.UserID, 0, len(s.recent))
+	for userID := range s.recent {
+		userIDs = append(userIDs, userID)
+	}
+
+	names, err := s.client.Offline().MemberNames(s.roomID, userIDs, false)
+	if err != nil {
+		return nil
+	}
+
+	var matches []indexer.IndexedRoomMember
+	for i, userID := range userIDs {
+		name := names[i]
+		if !strings.Contains(strings.ToLower(string(userID)), str) &&
+			!strings.Contains(strings.ToLower(name.Name), str) {
+			continue
+		}
+
+		matches = append(matches, indexer.IndexedRoomMember{
+			ID:   userID,
+			Room: s.roomID,
+			Name: name.Name,
+		})
+	}
+
+	return matches
+}
+
+// rank returns the rank of the given member. Recent speakers come first, then
+// members that were already shown, then everyone else.
+func (s *roomMemberSearcher) rank(userID matrix.UserID) int {
+	if rank, ok := s.recent[userID]; ok {
+		return rank
+	}
+	if rank, ok := s.last[userID]; ok {
+		return maxRecentSpeakers + rank
+	}
+	return maxRecentSpeakers + MaxResults
 }
 
 func (s *roomMemberSearcher) Rune() rune { return '@' }
@@ -109,14 +232,49 @@ func (s *roomMemberSearcher) Search(ctx context.Context, str string) []Data {
 		return nil
 	}
 
-	results := s.rms.Search(ctx, str)
+	s.updateRecent()
+
+	results := append(s.matchRecent(str), s.rms.Search(ctx, str)...)
+
+	// Let the user know that there might be more results once the room
+	// members are fetched.
+	loading := s.client.RoomMembersLoading(s.roomID)
+
 	if len(results) == 0 {
+		if loading {
+			return []Data{LoadingData(locale.S(ctx, "Loading members…"))}
+		}
 		return nil
 	}
 
+	// Stable sort keeps the index's scoring within the same rank.
+	sort.SliceStable(results, func(i, j int) bool {
+		return s.rank(results[i].ID) < s.rank(results[j].ID)
+	})
+
+	if s.last == nil {
+		s.last = make(map[matrix.UserID]int, MaxResults)
+	} else {
+		for id := range s.last {
+			delete(s.last, id)
+		}
+	}
+
 	s.res.clear()
 	for _, result := range results {
+		if _, dupe := s.last[result.ID]; dupe {
+			continue
+		}
+		s.last[result.ID] = len(s.res)
 		s.res.add(RoomMemberData(result))
+
+		if len(s.res) == MaxResults {
+			break
+		}
+	}
+
+	if loading {
+		s.res.add(LoadingData(locale.S(ctx, "Loading members…")))
 	}
 
 	return s.res
@@ -278,11 +436,14 @@ func (d EmojiData) Row(ctx context.Context) *gtk.ListBoxRow {
 		i.AddCSSClass("autocompleter-custom")
 		i.SetSizeRequest(emojiSize, emojiSize)
 
+		// In text-only mode, the name next to it is enough.
 		client := gotktrix.FromContext(ctx).Offline()
-		url, _ := client.SquareThumbnail(d.Custom.URL, emojiSize, gtkutil.ScaleFactor())
-		// Use a background context so we don't constantly thrash the server
-		// with cancelled requests every time we time.
-		imgutil.AsyncGET(ctx, url, imgutil.ImageSetterFromImage(i))
+		if !client.TextOnlyMode() {
+			url, _ := client.SquareThumbnail(d.Custom.URL, emojiSize, gtkutil.ScaleFactor())
+			// Use a background context so we don't constantly thrash the
+			// server with cancelled requests every time we time.
+			imgutil.AsyncGET(ctx, url, imgutil.ImageSetterFromImage(i))
+		}
 
 		b.Append(i)
 	}
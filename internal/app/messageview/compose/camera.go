@@ -0,0 +1,174 @@
+package compose
+
+import (
+	"context"
+	"os"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/components/camera"
+)
+
+var cameraButtonCSS = cssutil.Applier("composer-camera", `
+	.composer-camera {
+		margin:   0px;
+		padding: 10px;
+		border-radius: 0;
+		min-height: 0;
+		min-width:  0;
+	}
+`)
+
+var photoDialogCSS = cssutil.Applier("composer-photo", `
+	.composer-photo {
+		margin: 12px;
+	}
+	.composer-photo-retake {
+		margin-top: 8px;
+	}
+`)
+
+// newCameraButton creates the button that takes a photo to be sent. The button
+// is hidden until a camera is found.
+func newCameraButton(ctx context.Context, upload func() uploader) *gtk.Button {
+	button := gtk.NewButtonFromIconName("camera-photo-symbolic")
+	button.SetTooltipText(locale.S(ctx, "Take Photo"))
+	button.SetHasFrame(false)
+	button.Hide()
+	button.ConnectClicked(func() { upload().takePhoto() })
+	cameraButtonCSS(button)
+
+	gtkutil.Async(ctx, func() func() {
+		if !camera.IsPresent() {
+			return nil
+		}
+		return button.Show
+	})
+
+	return button
+}
+
+// takePhoto shows a dialog that takes a photo with the camera, which can be
+// retaken before it's sent.
+func (u uploader) takePhoto() {
+	d := dialogs.NewLocalize(u.ctx, "Cancel", "Send")
+	d.SetTitle(locale.S(u.ctx, "Take Photo"))
+	d.SetDefaultSize(450, 400)
+	d.BindCancelClose()
+	d.OK.SetSensitive(false)
+
+	spinner := gtk.NewSpinner()
+	spinner.SetSizeRequest(32, 32)
+	spinner.SetHAlign(gtk.AlignCenter)
+	spinner.SetVAlign(gtk.AlignCenter)
+
+	picture := gtk.NewPicture()
+	picture.SetCanShrink(true)
+	picture.SetKeepAspectRatio(true)
+
+	errLabel := gtk.NewLabel("")
+	errLabel.SetWrap(true)
+	errLabel.SetWrapMode(pango.WrapWordChar)
+
+	stack := gtk.NewStack()
+	stack.SetVExpand(true)
+	stack.AddChild(spinner)
+	stack.AddChild(picture)
+	stack.AddChild(errLabel)
+
+	retake := gtk.NewButtonWithLabel(locale.S(u.ctx, "Retake"))
+	retake.AddCSSClass("composer-photo-retake")
+	retake.SetHAlign(gtk.AlignCenter)
+	retake.SetSensitive(false)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(stack)
+	box.Append(retake)
+	photoDialogCSS(box)
+
+	d.SetChild(box)
+
+	ctx, cancel := context.WithCancel(u.ctx)
+
+	// photo is the path to the photo taken last. It's removed when the photo
+	// is retaken or the dialog is closed without sending it.
+	var photo string
+	var closed bool
+
+	discard := func() {
+		if photo != "" {
+			os.Remove(photo)
+			photo = ""
+		}
+	}
+
+	capture := func() {
+		discard()
+
+		d.OK.SetSensitive(false)
+		retake.SetSensitive(false)
+		stack.SetVisibleChild(spinner)
+		spinner.Start()
+
+		go func() {
+			path, err := camera.Capture(ctx)
+
+			glib.IdleAdd(func() {
+				if closed {
+					if err == nil {
+						os.Remove(path)
+					}
+					return
+				}
+
+				spinner.Stop()
+				retake.SetSensitive(true)
+
+				if err != nil {
+					errLabel.SetText(locale.Sprintf(u.ctx, "Cannot take photo: %v", err))
+					stack.SetVisibleChild(errLabel)
+					return
+				}
+
+				photo = path
+				picture.SetFilename(path)
+				stack.SetVisibleChild(picture)
+				d.OK.SetSensitive(true)
+			})
+		}()
+	}
+
+	retake.ConnectClicked(capture)
+
+	d.ConnectDestroy(func() {
+		closed = true
+		cancel()
+		discard()
+	})
+
+	d.OK.ConnectClicked(func() {
+		path := photo
+		photo = ""
+
+		u.upload(fileUpload{
+			name: "photo.jpg",
+			file: func(ctx context.Context) (*uploadingFile, error) {
+				// The file stays readable after it's removed for as long as
+				// it's open.
+				defer os.Remove(path)
+				return newUploadingFile(ctx, gio.NewFileForPath(path))
+			},
+		})
+
+		d.Close()
+	})
+
+	d.Show()
+	capture()
+}
@@ -4,14 +4,21 @@ package compose
 import (
 	"context"
 	"html"
+	"strings"
 
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotk4/pkg/pango"
 	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 	"github.com/diamondburned/gotktrix/internal/app/messageview/message"
 	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mcontent"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/effects"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/poll"
 	"github.com/diamondburned/gotrix/event"
 	"github.com/diamondburned/gotrix/matrix"
 )
@@ -22,7 +29,12 @@ type Composer struct {
 	iscroll     *gtk.ScrolledWindow
 	input       *Input
 	send        *gtk.Button
+	gif         *gtk.MenuButton
+	camera      *gtk.Button
+	counter     *gtk.Label
 	placeholder *gtk.Label
+	bar         *gtk.Box
+	readOnly    *readOnlyBar
 
 	ctx    context.Context
 	ctrl   Controller
@@ -33,6 +45,7 @@ type Composer struct {
 		current func()
 	}
 	editing bool
+	canSend bool
 }
 
 // Controller describes the parent component that the Composer controls.
@@ -52,6 +65,13 @@ type Controller interface {
 	StopSendingMessage(mark interface{}) bool
 	// BindSendingMessage takes in the mark value returned by AddSendingMessage.
 	BindSendingMessage(mark interface{}, evID matrix.EventID) (replaced bool)
+	// FailSendingMessage marks the sending message with the given mark as
+	// failed. The user is offered to either delete the message or send it
+	// again, in which case retry is called.
+	FailSendingMessage(mark interface{}, retry func())
+	// QueueSendingMessage marks the sending message with the given mark as
+	// waiting in the outbox for the connection to come back.
+	QueueSendingMessage(mark interface{})
 }
 
 // inputController wraps a Composer and Controller to implement InputController.
@@ -110,8 +130,6 @@ func New(ctx context.Context, ctrl Controller, roomID matrix.RoomID) *Composer {
 		roomID: roomID,
 	}
 
-	// TODO: turn this into a single action button. There's no point in having a
-	// menu that has only 1 working item.
 	c.action.Button = gtk.NewButton()
 	c.action.SetVAlign(gtk.AlignStart)
 	c.action.SetHasFrame(false)
@@ -143,6 +161,7 @@ func New(ctx context.Context, ctrl Controller, roomID matrix.RoomID) *Composer {
 		start, end := c.input.buffer.Bounds()
 		// Reveal if the buffer has 0 length.
 		revealer.SetRevealChild(start.Offset() == end.Offset())
+		c.updateCounter()
 	})
 
 	c.iscroll = gtk.NewScrolledWindow()
@@ -158,36 +177,109 @@ func New(ctx context.Context, ctrl Controller, roomID matrix.RoomID) *Composer {
 	c.send.ConnectClicked(func() { c.input.Send() })
 	sendCSS(c.send)
 
-	c.Box = gtk.NewBox(gtk.OrientationHorizontal, 0)
-	c.Append(c.action)
-	c.Append(c.iscroll)
-	c.Append(c.send)
-	c.SetFocusChild(c.iscroll)
+	c.counter = newCounter()
+	c.gif = newGIFButton(ctx, c.uploader)
+	c.camera = newCameraButton(ctx, c.uploader)
+
+	c.bar = gtk.NewBox(gtk.OrientationHorizontal, 0)
+	c.bar.Append(c.action)
+	c.bar.Append(c.iscroll)
+	c.bar.Append(c.counter)
+	c.bar.Append(c.gif)
+	c.bar.Append(c.camera)
+	c.bar.Append(c.send)
+	c.bar.SetFocusChild(c.iscroll)
+
+	c.readOnly = newReadOnlyBar(ctx, roomID)
+	c.readOnly.SetVisible(false)
+
+	c.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+	c.Append(c.bar)
+	c.Append(c.readOnly)
+	c.Append(c.input.tray)
+	c.SetFocusChild(c.bar)
 	composerCSS(c.Box)
 
-	// gtkutil.BindActionMap(box, "composer", map[string]func(){
-	// 	"upload-file":   func() { c.upload.ask() },
-	// 	"stop-replying": func() { ctrl.ReplyTo("") },
-	// 	"stop-editing":  func() { ctrl.Edit("") },
-	// })
+	actions := map[string]func(){
+		"composer.attach-files":   func() { c.input.askAttach() },
+		"composer.create-poll":    func() { c.createPoll() },
+		"composer.share-location": func() { c.shareLocation() },
+		"composer.stop-location":  func() { c.stopSharingLive() },
+	}
+	for _, effect := range effects.All {
+		effect := effect
+		actions[effectAction(effect)] = func() { c.input.SendEffect(effect) }
+	}
+	gtkutil.BindActionMap(c, actions)
 
 	c.action.ConnectClicked(func() { c.action.current() })
 	c.resetAction()
-	c.SetPlaceholder("")
+	c.invalidatePermission()
+
+	// Only show the GIF button if GIF search is set up.
+	gtkutil.BindSubscribe(c, func() func() {
+		update := func() { c.gif.SetVisible(gifSearchURL.Value() != "") }
+		update()
+		return gifSearchURL.Subscribe(update)
+	})
+
+	gtkutil.BindSubscribe(c, func() func() {
+		c.invalidatePermission()
+
+		client := gotktrix.FromContext(ctx)
+		return client.SubscribeRoom(roomID, event.TypeRoomPowerLevels, func() {
+			glib.IdleAdd(c.invalidatePermission)
+		})
+	})
 
 	return &c
 }
 
+// invalidatePermission replaces the composer with the read-only bar if the user
+// isn't allowed to send messages in the room.
+func (c *Composer) invalidatePermission() {
+	client := gotktrix.FromContext(c.ctx).Offline()
+	c.canSend = client.CanSendEvent(c.roomID, event.TypeRoomMessage, false)
+
+	c.action.SetSensitive(c.canSend)
+	c.iscroll.SetSensitive(c.canSend)
+	c.gif.SetSensitive(c.canSend)
+	c.camera.SetSensitive(c.canSend)
+	c.send.SetSensitive(c.canSend)
+
+	c.bar.SetVisible(c.canSend)
+	c.readOnly.SetVisible(!c.canSend)
+	if !c.canSend {
+		c.readOnly.invalidate()
+	}
+
+	c.SetPlaceholder("")
+}
+
 // SetPlaceholder sets the composer's placeholder. The default is used if an
 // empty string is given.
 func (c *Composer) SetPlaceholder(markup string) {
 	if markup == "" {
-		roomName, _ := gotktrix.FromContext(c.ctx).Offline().RoomName(c.roomID)
-		markup = locale.Sprintf(c.ctx, "Message %s", html.EscapeString(roomName))
+		switch {
+		case c.canSend && c.input.thread != "":
+			markup = locale.S(c.ctx, "Reply in thread")
+		case c.canSend:
+			roomName, _ := gotktrix.FromContext(c.ctx).Offline().RoomName(c.roomID)
+			markup = locale.Sprintf(c.ctx, "Message %s", html.EscapeString(roomName))
+		default:
+			markup = locale.S(c.ctx, "You can't send messages in this room")
+		}
 	}
 	c.placeholder.SetMarkup(markup)
 }
 
+// SetThread makes the composer send messages in the thread rooted at the given
+// event. An empty string sends them in the room again.
+func (c *Composer) SetThread(root matrix.EventID) {
+	c.input.thread = root
+	c.SetPlaceholder("")
+}
+
 func (c *Composer) uploader() uploader {
 	return uploader{
 		ctx:    c.ctx,
@@ -196,6 +288,39 @@ func (c *Composer) uploader() uploader {
 	}
 }
 
+// CanSend returns true if the user can send messages in the room.
+func (c *Composer) CanSend() bool {
+	return c.canSend
+}
+
+// PromptUploadFiles prompts to upload each of the given files one after
+// another, using the same dialog as pasting a file. Nothing is done if the user
+// can't send messages in the room.
+func (c *Composer) PromptUploadFiles(files []gio.Filer) {
+	if !c.canSend {
+		return
+	}
+
+	uploads := make([]fileUpload, len(files))
+	for i, file := range files {
+		file := file
+		uploads[i] = fileUpload{
+			name: file.Basename(),
+			file: func(ctx context.Context) (*uploadingFile, error) {
+				return newUploadingFile(ctx, file)
+			},
+		}
+	}
+
+	c.uploader().promptUploads(uploads)
+}
+
+// RestoreOutbox shows the room's messages that are still waiting in the outbox
+// as sending messages.
+func (c *Composer) RestoreOutbox() {
+	restoreOutbox(c.ctx, c.ctrl, c.roomID)
+}
+
 // Input returns the composer's input.
 func (c *Composer) Input() *Input {
 	return c.input
@@ -219,12 +344,45 @@ func (c *Composer) setAction(action ActionData) {
 
 func (c *Composer) resetAction() {
 	c.setAction(ActionData{
-		Name: locale.S(c.ctx, "Upload File"),
+		Name: locale.S(c.ctx, "Add to Message"),
 		Icon: "list-add-symbolic",
-		Func: func() { c.uploader().ask() },
+		Func: c.showMenu,
 	})
 }
 
+// showMenu shows the menu of things that can be added to the message.
+func (c *Composer) showMenu() {
+	s := locale.SFunc(c.ctx)
+
+	client := gotktrix.FromContext(c.ctx).Offline()
+	canPoll := client.CanSendEvent(c.roomID, poll.StartEventType, false)
+
+	items := []gtkutil.PopoverMenuItem{
+		gtkutil.MenuItem(s("Attach Files..."), "composer.attach-files"),
+		gtkutil.MenuItem(s("Create Poll..."), "composer.create-poll", canPoll),
+	}
+	if c.isSharingLive() {
+		items = append(items, gtkutil.MenuItem(s("Stop Sharing Live Location"), "composer.stop-location"))
+	} else {
+		items = append(items, gtkutil.MenuItem(s("Share Location..."), "composer.share-location"))
+	}
+
+	effectItems := make([]gtkutil.PopoverMenuItem, len(effects.All))
+	for i, effect := range effects.All {
+		effectItems[i] = gtkutil.MenuItem(s(effects.Name(effect)), effectAction(effect))
+	}
+	items = append(items, gtkutil.Submenu(s("Send with Effect"), effectItems))
+
+	p := gtkutil.NewPopoverMenuCustom(c.action, gtk.PosTop, items)
+	gtkutil.PopupFinally(p)
+}
+
+// effectAction returns the name of the action that sends the message with the
+// given effect.
+func effectAction(effect event.MessageType) string {
+	return "composer.send-" + strings.ToLower(effects.Name(effect))
+}
+
 // Edit switches the composer to edit mode and grabs an older message's body. If
 // the message cannot be fetched from just the timeline state, then it will not
 // be shown to the user. This means that editing backlog messages will behave
@@ -269,9 +427,17 @@ func (c *Composer) edit(eventID matrix.EventID) bool {
 		Func: func() { c.ctrl.Edit("") },
 	})
 
+	// Load the body of the latest edit, if any, so that we don't edit over
+	// changes that were already made.
+	client := gotktrix.FromContext(c.ctx).Offline()
+	body, _ := mcontent.MsgBody(msg)
+	if latest := client.LatestEdit(c.roomID, msg); latest != nil {
+		body, _ = mcontent.MsgBody(latest)
+	}
+
 	c.SetPlaceholder(locale.S(c.ctx, "Editing message"))
 	c.send.SetIconName(editIcon)
-	c.input.SetText(msg.Body)
+	c.input.SetText(body.Body)
 
 	return true
 }
@@ -299,6 +465,8 @@ func roomTimelineEvent(
 func (c *Composer) ReplyTo(eventID matrix.EventID) bool {
 	c.input.editing = ""
 	c.input.replyingTo = eventID
+	c.input.draft.replyingTo = ""
+	c.input.queueDraft()
 
 	if c.input.replyingTo == "" {
 		c.send.SetIconName(sendIcon)
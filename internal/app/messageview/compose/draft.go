@@ -0,0 +1,99 @@
+package compose
+
+import (
+	"log"
+
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// draftSaveDelay is how long the input waits after the last change before it
+// saves the draft, in milliseconds.
+const draftSaveDelay = 1000
+
+type draftState struct {
+	save glib.SourceHandle
+	// replyingTo is the event that the restored draft replies to. It's kept
+	// until the page has loaded the event and replied to it.
+	replyingTo matrix.EventID
+	restoring  bool
+}
+
+// restoreDraft puts the draft that was saved for the room back into the input.
+func (i *Input) restoreDraft() {
+	draft, ok := gotktrix.FromContext(i.ctx).Offline().RoomDraft(i.roomID)
+	if !ok {
+		return
+	}
+
+	i.draft.restoring = true
+	defer func() { i.draft.restoring = false }()
+
+	i.SetText(draft.Text)
+	i.draft.replyingTo = draft.ReplyingTo
+
+	for _, uri := range draft.Attachments {
+		i.tray.add(gio.NewFileForURI(uri))
+	}
+}
+
+// DraftReplyingTo returns the event that the restored draft replies to, if the
+// input hasn't been told to reply to another event since.
+func (i *Input) DraftReplyingTo() matrix.EventID {
+	return i.draft.replyingTo
+}
+
+// queueDraft saves the draft once the user stops changing it for a bit.
+func (i *Input) queueDraft() {
+	if i.draft.restoring {
+		return
+	}
+
+	if i.draft.save != 0 {
+		glib.SourceRemove(i.draft.save)
+	}
+
+	i.draft.save = glib.TimeoutAdd(draftSaveDelay, func() {
+		i.draft.save = 0
+		i.saveDraft()
+	})
+}
+
+// SaveDraft saves the draft right away if it has unsaved changes.
+func (i *Input) SaveDraft() {
+	if i.draft.save == 0 {
+		return
+	}
+
+	glib.SourceRemove(i.draft.save)
+	i.draft.save = 0
+	i.saveDraft()
+}
+
+func (i *Input) saveDraft() {
+	// The input holds the message that's being edited instead of the draft, so
+	// keep the draft that was saved before.
+	if i.editing != "" {
+		return
+	}
+
+	draft := gotktrix.Draft{
+		Text:       i.Text(i.buffer.Bounds()),
+		ReplyingTo: i.replyingTo,
+	}
+
+	if draft.ReplyingTo == "" {
+		draft.ReplyingTo = i.draft.replyingTo
+	}
+
+	for _, attachment := range i.tray.attachments {
+		draft.Attachments = append(draft.Attachments, attachment.file.URI())
+	}
+
+	client := gotktrix.FromContext(i.ctx).Offline()
+	if err := client.SetRoomDraft(i.roomID, draft); err != nil {
+		log.Printf("room %s: %v", i.roomID, err)
+	}
+}
@@ -0,0 +1,114 @@
+package compose
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// localEcho is a message that is shown in the message view while it's being
+// sent. The echo is matched with the event that comes back from syncing by its
+// transaction ID, and if sending fails, then it can be sent again with the same
+// transaction ID, so it's never sent twice. If the connection is down, then
+// the message is put into the outbox instead.
+type localEcho struct {
+	ctx    context.Context
+	ctrl   Controller
+	mark   interface{}
+	roomID matrix.RoomID
+	typ    event.Type
+	txnID  string
+	body   interface{}
+}
+
+// newLocalEcho adds the given event as a sending message. The body is what's
+// actually sent, which is usually the event itself. It must be called in the
+// main thread.
+func newLocalEcho(ctx context.Context, ctrl Controller, ev event.RoomEvent, body interface{}) *localEcho {
+	info := ev.RoomInfo()
+	info.Unsigned.TransactionID = gotktrix.NextTransactionID()
+
+	return &localEcho{
+		ctx:    ctx,
+		ctrl:   ctrl,
+		mark:   ctrl.AddSendingMessage(ev),
+		roomID: info.RoomID,
+		typ:    info.Type,
+		txnID:  info.Unsigned.TransactionID,
+		body:   body,
+	}
+}
+
+// send sends the message and blocks until it's sent or queued. The echo is
+// bound to the sent event, or marked as failed with the option to retry.
+func (e *localEcho) send(client *gotktrix.Client) error {
+	// Messages must not skip ahead of the ones still waiting in the outbox.
+	if client.HasOutbox(e.roomID) {
+		return e.queue(client)
+	}
+
+	eventID, err := client.RoomEventSendTxn(e.roomID, e.typ, e.txnID, e.body)
+	if gotktrix.IsTransientError(err) {
+		return e.queue(client)
+	}
+
+	e.sent(eventID, err)
+	return err
+}
+
+// queue puts the message into the outbox, which is sent once the connection is
+// back.
+func (e *localEcho) queue(client *gotktrix.Client) error {
+	if err := client.QueueMessage(e.roomID, e.typ, e.txnID, e.body); err != nil {
+		glib.IdleAdd(func() { e.ctrl.FailSendingMessage(e.mark, e.retry) })
+		return err
+	}
+
+	glib.IdleAdd(func() { e.ctrl.QueueSendingMessage(e.mark) })
+	client.WaitOutbox(e.txnID, e.sent)
+	return nil
+}
+
+// sent updates the echo once the message is sent or has failed to send. It can
+// be called outside the main thread.
+func (e *localEcho) sent(eventID matrix.EventID, err error) {
+	glib.IdleAdd(func() {
+		if err != nil {
+			e.ctrl.FailSendingMessage(e.mark, e.retry)
+			return
+		}
+		e.ctrl.BindSendingMessage(e.mark, eventID)
+	})
+}
+
+// retry sends the message again in the background.
+func (e *localEcho) retry() {
+	gotktrix.FromContext(e.ctx).Background(func(client *gotktrix.Client) {
+		e.send(client)
+	})
+}
+
+// restoreOutbox shows the room's messages that are still waiting in the outbox,
+// such as the ones queued before the application was restarted. It must be
+// called in the main thread.
+func restoreOutbox(ctx context.Context, ctrl Controller, roomID matrix.RoomID) {
+	client := gotktrix.FromContext(ctx).Offline()
+
+	for _, msg := range client.OutboxMessages(roomID) {
+		e := &localEcho{
+			ctx:    ctx,
+			ctrl:   ctrl,
+			mark:   ctrl.AddSendingMessage(msg.Event(client.UserID)),
+			roomID: msg.RoomID,
+			typ:    msg.Type,
+			txnID:  msg.TxnID,
+			body:   msg.Content,
+		}
+
+		ctrl.QueueSendingMessage(e.mark)
+		client.WaitOutbox(e.txnID, e.sent)
+	}
+}
@@ -0,0 +1,395 @@
+package compose
+
+import (
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/components/onlineimage"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/httputil"
+	"github.com/diamondburned/gotkit/gtkutil/imgutil"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/a11y"
+	"github.com/pkg/errors"
+)
+
+var gifSearchURL = prefs.NewString("", prefs.StringMeta{
+	Name:    "GIF Search",
+	Section: "Text",
+	Description: "The URL of a Tenor or Giphy compatible search API, usually " +
+		"a proxy that adds the API key. The search query is given in the q " +
+		"parameter. The GIF button is hidden if this is empty.",
+	Placeholder: "https://gifs.example.com/v2/search",
+	Validate: func(str string) error {
+		if str == "" {
+			return nil
+		}
+		u, err := url.Parse(str)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.New("URL must be HTTP or HTTPS")
+		}
+		return nil
+	},
+})
+
+const (
+	// gifSearchLimit is the number of GIFs to search for.
+	gifSearchLimit = 30
+	// gifPreviewHeight is the height of the GIF previews in the picker.
+	gifPreviewHeight = 80
+)
+
+// gifResult is a GIF found by searching.
+type gifResult struct {
+	Title   string
+	URL     string
+	Preview string
+	Width   int
+	Height  int
+}
+
+// gifSearchResponse is the response of either the Tenor or the Giphy search
+// API. Only the fields that are used are declared.
+type gifSearchResponse struct {
+	// Tenor
+	Results []struct {
+		ContentDescription string                `json:"content_description"`
+		MediaFormats       map[string]tenorMedia `json:"media_formats"`
+	} `json:"results"`
+	// Giphy
+	Data []struct {
+		Title  string                `json:"title"`
+		Images map[string]giphyImage `json:"images"`
+	} `json:"data"`
+}
+
+type tenorMedia struct {
+	URL  string `json:"url"`
+	Dims []int  `json:"dims"`
+}
+
+type giphyImage struct {
+	URL    string `json:"url"`
+	Width  string `json:"width"`
+	Height string `json:"height"`
+}
+
+// results returns the GIFs in the response.
+func (r *gifSearchResponse) results() []gifResult {
+	results := make([]gifResult, 0, len(r.Results)+len(r.Data))
+
+	for _, result := range r.Results {
+		gif, ok := result.MediaFormats["gif"]
+		if !ok || len(gif.Dims) != 2 {
+			continue
+		}
+
+		preview, ok := result.MediaFormats["tinygif"]
+		if !ok {
+			preview = gif
+		}
+
+		results = append(results, gifResult{
+			Title:   result.ContentDescription,
+			URL:     gif.URL,
+			Preview: preview.URL,
+			Width:   gif.Dims[0],
+			Height:  gif.Dims[1],
+		})
+	}
+
+	for _, data := range r.Data {
+		gif, ok := data.Images["original"]
+		if !ok {
+			continue
+		}
+
+		preview, ok := data.Images["fixed_height_small"]
+		if !ok {
+			preview = gif
+		}
+
+		w, _ := strconv.Atoi(gif.Width)
+		h, _ := strconv.Atoi(gif.Height)
+
+		results = append(results, gifResult{
+			Title:   data.Title,
+			URL:     gif.URL,
+			Preview: preview.URL,
+			Width:   w,
+			Height:  h,
+		})
+	}
+
+	return results
+}
+
+func gifHTTPClient(ctx context.Context) *http.Client {
+	return httputil.FromContext(ctx, http.DefaultClient)
+}
+
+// searchGIFs searches for GIFs matching the given query.
+func searchGIFs(ctx context.Context, query string) ([]gifResult, error) {
+	u, err := url.Parse(gifSearchURL.Value())
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid GIF search URL")
+	}
+
+	q := u.Query()
+	q.Set("q", query)
+	q.Set("limit", strconv.Itoa(gifSearchLimit))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := gifHTTPClient(ctx).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var r gifSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, errors.Wrap(err, "cannot decode GIF search results")
+	}
+
+	return r.results(), nil
+}
+
+// fetchGIF starts downloading the given GIF for uploading.
+func fetchGIF(ctx context.Context, gif gifResult) (*uploadingFile, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", gif.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := gifHTTPClient(ctx).Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot download GIF")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("cannot download GIF: unexpected status %s", resp.Status)
+	}
+
+	mimeType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mimeType, "image/") {
+		mimeType = "image/gif"
+	}
+
+	name := gif.Title
+	if name == "" {
+		name = "gif"
+	}
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		name += exts[0]
+	}
+
+	var size int64
+	if resp.ContentLength > 0 {
+		size = resp.ContentLength
+	}
+
+	return &uploadingFile{
+		ReadCloser: resp.Body,
+		name:       name,
+		mime:       mimeType,
+		size:       size,
+	}, nil
+}
+
+var gifButtonCSS = cssutil.Applier("composer-gif", `
+	.composer-gif {
+		margin:   0px;
+		padding: 10px;
+		border-radius: 0;
+		min-height: 0;
+		min-width:  0;
+	}
+`)
+
+var gifPickerCSS = cssutil.Applier("composer-gifpicker", `
+	.composer-gifpicker-status {
+		margin: 12px;
+		color: alpha(@theme_fg_color, 0.65);
+	}
+	.composer-gifpicker flowboxchild {
+		padding: 0;
+	}
+	.composer-gifpicker flowboxchild button {
+		padding: 0;
+	}
+`)
+
+// newGIFButton creates the button that opens the GIF picker.
+func newGIFButton(ctx context.Context, upload func() uploader) *gtk.MenuButton {
+	picker := newGIFPicker(ctx, func(gif gifResult) {
+		upload().upload(fileUpload{
+			name: gif.Title,
+			file: func(ctx context.Context) (*uploadingFile, error) {
+				return fetchGIF(ctx, gif)
+			},
+		})
+	})
+
+	button := gtk.NewMenuButton()
+	button.SetIconName("image-x-generic-symbolic")
+	button.SetTooltipText(locale.S(ctx, "Search GIFs"))
+	button.SetHasFrame(false)
+	button.SetPopover(picker)
+	gifButtonCSS(button)
+
+	return button
+}
+
+// gifPicker is a popover that searches for GIFs.
+type gifPicker struct {
+	*gtk.Popover
+	search *gtk.SearchEntry
+	status *gtk.Label
+	flow   *gtk.FlowBox
+
+	ctx    context.Context
+	pick   func(gifResult)
+	cancel context.CancelFunc
+}
+
+func newGIFPicker(ctx context.Context, pick func(gifResult)) *gifPicker {
+	p := gifPicker{
+		ctx:    ctx,
+		pick:   pick,
+		cancel: func() {},
+	}
+
+	p.search = gtk.NewSearchEntry()
+	p.search.ConnectSearchChanged(func() { p.searchGIFs(p.search.Text()) })
+
+	p.status = gtk.NewLabel("")
+	p.status.AddCSSClass("composer-gifpicker-status")
+	p.status.SetWrap(true)
+
+	p.flow = gtk.NewFlowBox()
+	p.flow.SetSelectionMode(gtk.SelectionNone)
+	p.flow.SetHomogeneous(false)
+	p.flow.SetVAlign(gtk.AlignStart)
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetSizeRequest(350, 300)
+	scroll.SetVExpand(true)
+	scroll.SetChild(p.flow)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 4)
+	box.Append(p.search)
+	box.Append(p.status)
+	box.Append(scroll)
+
+	p.Popover = gtk.NewPopover()
+	p.Popover.SetChild(box)
+	p.Popover.ConnectShow(func() { p.search.GrabFocus() })
+	gifPickerCSS(p.Popover)
+
+	p.setStatus(locale.S(ctx, "Search for GIFs."))
+
+	return &p
+}
+
+func (p *gifPicker) setStatus(status string) {
+	p.status.SetText(status)
+	p.status.SetVisible(status != "")
+}
+
+func (p *gifPicker) clear() {
+	for child := p.flow.FirstChild(); child != nil; child = p.flow.FirstChild() {
+		p.flow.Remove(child)
+	}
+}
+
+func (p *gifPicker) searchGIFs(query string) {
+	p.cancel()
+	p.clear()
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		p.setStatus(locale.S(p.ctx, "Search for GIFs."))
+		return
+	}
+
+	p.setStatus(locale.S(p.ctx, "Searching…"))
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	p.cancel = cancel
+
+	gtkutil.Async(ctx, func() func() {
+		results, err := searchGIFs(ctx, query)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return func() {
+				p.setStatus(locale.Sprintf(p.ctx, "Cannot search for GIFs: %v", err))
+			}
+		}
+
+		return func() {
+			if len(results) == 0 {
+				p.setStatus(locale.S(p.ctx, "No GIFs found."))
+				return
+			}
+
+			p.setStatus("")
+			for _, result := range results {
+				p.flow.Insert(p.newResult(ctx, result), -1)
+			}
+		}
+	})
+}
+
+func (p *gifPicker) newResult(ctx context.Context, gif gifResult) gtk.Widgetter {
+	w, h := gif.Width, gif.Height
+	if w > 0 && h > 0 {
+		w = w * gifPreviewHeight / h
+	} else {
+		w = gifPreviewHeight
+	}
+
+	preview := onlineimage.NewPicture(ctx, imgutil.HTTPProvider)
+	preview.SetSizeRequest(w, gifPreviewHeight)
+	preview.SetURL(gif.Preview)
+
+	button := gtk.NewButton()
+	button.SetHasFrame(false)
+	button.SetChild(preview)
+	button.SetTooltipText(gif.Title)
+	button.ConnectClicked(func() {
+		p.Popover.Popdown()
+		p.pick(gif)
+	})
+
+	// Only play the GIF on hover unless the user asked for less motion.
+	if !a11y.ReduceMotion() {
+		anim := preview.EnableAnimation()
+		anim.ConnectMotion(button)
+	}
+
+	return button
+}
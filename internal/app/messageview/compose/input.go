@@ -14,6 +14,7 @@ import (
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
 	"github.com/diamondburned/gotkit/gtkutil"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 	"github.com/diamondburned/gotkit/gtkutil/imgutil"
@@ -21,6 +22,7 @@ import (
 	"github.com/diamondburned/gotktrix/internal/app/messageview/compose/autocomplete"
 	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/mediautil"
 	"github.com/diamondburned/gotktrix/internal/md"
 	"github.com/diamondburned/gotrix/event"
 	"github.com/diamondburned/gotrix/matrix"
@@ -40,17 +42,26 @@ type Input struct {
 	buffer  *gtk.TextBuffer
 	acomp   *autocomplete.Autocompleter
 	anchors list.List // T = anchorPiece
+	tray    *attachTray
+	typing  *typingNotifier
 
 	ctx    context.Context
 	ctrl   InputController
 	roomID matrix.RoomID
 
+	// pasteStart marks where the text that is being pasted starts.
+	pasteStart *gtk.TextMark
+
+	draft draftState
+
 	inputState
 }
 
 type inputState struct {
 	editing    matrix.EventID
 	replyingTo matrix.EventID
+	// thread is the root of the thread that messages are sent in, if any.
+	thread matrix.EventID
 }
 
 type anchorPiece struct {
@@ -73,8 +84,6 @@ var inputCSS = cssutil.Applier("composer-input", `
 
 // NewInput creates a new Input instance.
 func NewInput(ctx context.Context, ctrl InputController, roomID matrix.RoomID) *Input {
-	go requestAllMembers(ctx, roomID)
-
 	i := Input{
 		ctx:    ctx,
 		ctrl:   ctrl,
@@ -102,10 +111,24 @@ func NewInput(ctx context.Context, ctrl InputController, roomID matrix.RoomID) *
 	)
 
 	i.buffer = i.TextView.Buffer()
+	i.tray = newAttachTray(ctx)
+	i.tray.changed = i.queueDraft
+	i.typing = newTypingNotifier(ctx, roomID)
 
 	i.buffer.ConnectChanged(func() {
 		md.WYSIWYG(ctx, i.buffer)
 		i.acomp.Autocomplete()
+
+		// Only count changes that the user made, not ones such as the text
+		// of a message being edited.
+		switch {
+		case i.buffer.CharCount() == 0:
+			i.typing.stop()
+		case i.HasFocus():
+			i.typing.typed()
+		}
+
+		i.queueDraft()
 	})
 
 	i.buffer.ConnectDeleteRange(func(start, end *gtk.TextIter) {
@@ -134,6 +157,10 @@ func NewInput(ctx context.Context, ctrl InputController, roomID matrix.RoomID) *
 
 	uploader := uploader{ctx, ctrl, roomID}
 	i.ConnectPasteClipboard(uploader.paste)
+	i.ConnectPasteClipboard(i.markPaste)
+	i.buffer.ConnectPasteDone(func(*gdk.Clipboard) { i.checkPaste() })
+
+	i.restoreDraft()
 
 	return &i
 }
@@ -167,18 +194,22 @@ func (i *Input) onAutocompleted(row autocomplete.SelectedData) bool {
 			i.buffer.Insert(row.Bounds[1], data.Unicode)
 		} else {
 			anchor := i.buffer.CreateChildAnchor(row.Bounds[1])
-
-			image := md.InsertImageWidget(i.TextView, anchor)
-			image.AddCSSClass("compose-inline-emoji")
-			image.SetSizeRequest(inlineEmojiSize, inlineEmojiSize)
-			image.SetName(data.Name)
-
 			client := gotktrix.FromContext(i.ctx).Offline()
-			url, _ := client.SquareThumbnail(data.Custom.URL, inlineEmojiSize, gtkutil.ScaleFactor())
-			imgutil.AsyncGET(i.ctx, url, imgutil.ImageSetter{
-				SetFromPaintable: image.SetFromPaintable,
-				SetFromPixbuf:    image.SetFromPixbuf,
-			})
+
+			if client.TextOnlyMode() {
+				md.InsertAltPill(i.TextView, anchor, data.Name)
+			} else {
+				image := md.InsertImageWidget(i.TextView, anchor)
+				image.AddCSSClass("compose-inline-emoji")
+				image.SetSizeRequest(inlineEmojiSize, inlineEmojiSize)
+				image.SetName(data.Name)
+
+				url, _ := client.SquareThumbnail(data.Custom.URL, inlineEmojiSize, gtkutil.ScaleFactor())
+				mediautil.AsyncGETScaled(i.ctx, image, url, inlineEmojiSize, inlineEmojiSize, imgutil.ImageSetter{
+					SetFromPaintable: image.SetFromPaintable,
+					SetFromPixbuf:    image.SetFromPixbuf,
+				})
+			}
 
 			// Register the anchor.
 			i.anchors.PushBack(anchorPiece{
@@ -242,6 +273,10 @@ func (i *Input) onKey(val, _ uint, state gdk.ModifierType) bool {
 		}
 	case gdk.KEY_Down:
 		return i.acomp.MoveDown()
+	case gdk.KEY_Page_Up:
+		return i.acomp.PageUp()
+	case gdk.KEY_Page_Down:
+		return i.acomp.PageDown()
 	}
 
 	return false
@@ -256,6 +291,61 @@ func (i *Input) SetText(text string) {
 	i.buffer.Insert(start, text)
 }
 
+// InsertQuote appends the given text as a Markdown blockquote attributed to the
+// given user, who is inserted as a mention.
+func (i *Input) InsertQuote(author matrix.UserID, text string) {
+	i.buffer.BeginUserAction()
+	defer i.buffer.EndUserAction()
+
+	end := i.buffer.EndIter()
+	if end.Offset() > 0 {
+		start := i.buffer.StartIter()
+		if !strings.HasSuffix(i.buffer.Text(start, end, false), "\n") {
+			i.buffer.Insert(end, "\n")
+		}
+		i.buffer.Insert(end, "\n")
+	}
+
+	i.insertMention(end, author)
+
+	var quote strings.Builder
+	quote.WriteString(" " + locale.S(i.ctx, "wrote:") + "\n")
+	for _, line := range strings.Split(text, "\n") {
+		quote.WriteString("> " + line + "\n")
+	}
+	quote.WriteString("\n")
+
+	i.buffer.Insert(end, quote.String())
+	i.buffer.PlaceCursor(end)
+}
+
+// InsertMention inserts a mention of the given user at the cursor.
+func (i *Input) InsertMention(userID matrix.UserID) {
+	i.buffer.BeginUserAction()
+	defer i.buffer.EndUserAction()
+
+	iter := i.buffer.IterAtMark(i.buffer.GetInsert())
+	i.insertMention(iter, userID)
+	i.buffer.Insert(iter, " ")
+	i.buffer.PlaceCursor(iter)
+}
+
+// insertMention inserts the user as a chip at the given iterator, which is
+// revalidated to point after it.
+func (i *Input) insertMention(iter *gtk.TextIter, userID matrix.UserID) {
+	chip := mauthor.NewChip(i.ctx, i.roomID, userID)
+	anchor := chip.InsertText(i.TextView, iter)
+
+	i.anchors.PushBack(anchorPiece{
+		anchor: anchor,
+		html: fmt.Sprintf(
+			`<a href="https://matrix.to/#/%s">%s</a>`,
+			html.EscapeString(string(userID)), html.EscapeString(chip.Name()),
+		),
+		text: string(userID),
+	})
+}
+
 // HTML returns the Input's content as HTML.
 func (i *Input) HTML(start, end *gtk.TextIter) string {
 	return i.renderAnchors(start, end, func(anchor anchorPiece) string { return anchor.html })
@@ -311,50 +401,94 @@ func (i *Input) renderAnchors(start, end *gtk.TextIter, f func(anchorPiece) stri
 	return buf.String()
 }
 
-// Send sends the message inside the input off.
+// Send sends the message inside the input off along with the attached files.
+// If the message is too large to be sent, then it's split up or the user is
+// asked what to do with it instead.
 func (i *Input) Send() bool {
+	return i.sendEffect("")
+}
+
+// SendEffect is like Send, except the message is sent with the given effect,
+// which is one of the message types in package effects. Messages that are too
+// large are split or uploaded without the effect.
+func (i *Input) SendEffect(effect event.MessageType) bool {
+	return i.sendEffect(effect)
+}
+
+func (i *Input) sendEffect(effect event.MessageType) bool {
 	dt, ok := i.put()
 	if !ok {
-		return false
+		if len(i.tray.attachments) == 0 {
+			return false
+		}
+
+		i.send()
+		i.reset()
+		return true
 	}
 
-	ctx := i.ctx
-	go func() {
-		client := gotktrix.FromContext(ctx)
-		roomEv := dt.put(client)
-
-		var eventID matrix.EventID
-		var err error
-
-		// Only push a new message if we're not editing.
-		if dt.editing == "" {
-			rowCh := make(chan interface{}, 1)
-			glib.IdleAdd(func() {
-				// Give the controller the RoomMessageEvent instead of our
-				// private type.
-				rowCh <- i.ctrl.AddSendingMessage(&roomEv.RoomMessageEvent)
-			})
+	dt.effect = effect
 
-			defer func() {
-				row := <-rowCh
-				glib.IdleAdd(func() {
-					i.ctrl.BindSendingMessage(row, eventID)
-				})
-			}()
+	if size := dt.size(gotktrix.FromContext(i.ctx).Offline()); size > maxContentSize {
+		i.sendOversize(dt, size)
+		return true
+	}
+
+	i.send(dt)
+	i.reset()
+	return true
+}
+
+// send sends the attached files, then the given messages, in order.
+func (i *Input) send(dts ...inputData) {
+	uploads := i.stageUploads()
+
+	// Send in the background, so that quitting right after sending still lets
+	// the message go through.
+	gotktrix.FromContext(i.ctx).Background(func(client *gotktrix.Client) {
+		for _, upload := range uploads {
+			i.sendStaged(client, upload)
 		}
 
-		eventID, err = client.RoomEventSend(roomEv.RoomID, roomEv.Type, roomEv)
-		if err != nil {
-			app.Error(i.ctx, errors.Wrap(err, "failed to send message"))
+		for _, dt := range dts {
+			if err := i.sendData(client, dt); err != nil {
+				// Messages that fail to send are marked in the message view,
+				// where they can be sent again, but edits aren't shown there.
+				if dt.editing != "" {
+					app.Error(i.ctx, errors.Wrap(err, "failed to edit message"))
+				}
+				return
+			}
 		}
-	}()
+	})
+}
 
+func (i *Input) sendData(client *gotktrix.Client, dt inputData) error {
+	roomEv := dt.put(client)
+
+	// Only push a new message if we're not editing.
+	if dt.editing != "" {
+		_, err := client.RoomEventSend(roomEv.RoomID, roomEv.Type, roomEv)
+		return err
+	}
+
+	echoCh := make(chan *localEcho, 1)
+	glib.IdleAdd(func() {
+		// Give the controller the RoomMessageEvent instead of our private
+		// type.
+		echoCh <- newLocalEcho(i.ctx, i.ctrl, &roomEv.RoomMessageEvent, roomEv)
+	})
+
+	return (<-echoCh).send(client)
+}
+
+// reset clears the input and asks the parent to reset the state.
+func (i *Input) reset() {
 	i.buffer.Delete(i.buffer.Bounds())
+	i.typing.stop()
 
-	// Ask the parent to reset the state.
 	i.ctrl.ReplyTo("")
 	i.ctrl.Edit("")
-	return true
 }
 
 // put steals the buffer and puts it into a message event. If the buffer is
@@ -398,6 +532,9 @@ type inputData struct {
 	roomID matrix.RoomID
 	plain  string
 	html   string
+	// effect is the message type of the effect to send the message with, if
+	// any.
+	effect event.MessageType
 	inputState
 }
 
@@ -424,6 +561,9 @@ func newRoomMessageEvent(client *gotktrix.Client, roomID matrix.RoomID) event.Ro
 func (data inputData) put(client *gotktrix.Client) *messageEvent {
 	ev := messageEvent{RoomMessageEvent: newRoomMessageEvent(client, data.roomID)}
 	ev.MessageType = event.RoomMessageText
+	if data.effect != "" {
+		ev.MessageType = data.effect
+	}
 	ev.RelatesTo = data.relatesTo()
 
 	var html strings.Builder
@@ -493,17 +633,30 @@ func (data inputData) relatesTo() json.RawMessage {
 	}
 
 	var relatesTo struct {
-		EventID   matrix.EventID `json:"event_id,omitempty"`
-		RelType   string         `json:"rel_type,omitempty"`
-		InReplyTo *inReplyTo     `json:"m.in_reply_to,omitempty"`
+		EventID       matrix.EventID `json:"event_id,omitempty"`
+		RelType       string         `json:"rel_type,omitempty"`
+		InReplyTo     *inReplyTo     `json:"m.in_reply_to,omitempty"`
+		IsFallingBack bool           `json:"is_falling_back,omitempty"`
 	}
 
-	if data.editing != "" {
+	switch {
+	case data.editing != "":
+		// Edits only replace the message; they're not put in the thread
+		// again.
 		relatesTo.EventID = data.editing
 		relatesTo.RelType = "m.replace"
+	case data.thread != "":
+		relatesTo.EventID = data.thread
+		relatesTo.RelType = gotktrix.ThreadRelType
+		// Clients that don't know about threads see the message as a reply
+		// to the thread's root if it isn't replying to anything.
+		if data.replyingTo == "" {
+			relatesTo.InReplyTo = &inReplyTo{EventID: data.thread}
+			relatesTo.IsFallingBack = true
+		}
 	}
 
-	if data.replyingTo != "" {
+	if data.replyingTo != "" && data.editing == "" {
 		relatesTo.InReplyTo = &inReplyTo{
 			EventID: data.replyingTo,
 		}
@@ -530,13 +683,3 @@ func customEmojiHTML(emoji autocomplete.EmojiData) string {
 		html.EscapeString(string(emoji.Custom.URL)),
 	)
 }
-
-// requestAllMembers asynchronously fills up the local state with the given
-// room's members.
-func requestAllMembers(ctx context.Context, roomID matrix.RoomID) {
-	client := gotktrix.FromContext(ctx)
-
-	if err := client.RoomEnsureMembers(roomID); err != nil {
-		app.Error(ctx, errors.Wrap(err, "failed to prefetch members"))
-	}
-}
@@ -0,0 +1,377 @@
+package compose
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/components/geolocation"
+	"github.com/diamondburned/gotktrix/internal/components/osmmap"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/location"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// locationZoom is the zoom level that the map is zoomed to once the user's
+// location is found.
+const locationZoom = 16
+
+var locationDialogCSS = cssutil.Applier("composer-location", `
+	.composer-location {
+		margin: 12px;
+	}
+	.composer-location > * {
+		margin-bottom: 6px;
+	}
+	.composer-location-status {
+		font-size: 0.9em;
+		color: alpha(@theme_fg_color, 0.75);
+	}
+`)
+
+// liveShare is the live location that is being shared in a room.
+type liveShare struct {
+	cancel context.CancelFunc
+}
+
+// liveShares holds the live locations that are being shared, keyed by room. It
+// is only used in the main thread.
+var liveShares = map[matrix.RoomID]*liveShare{}
+
+// locationDialog is the dialog that picks a location to share.
+type locationDialog struct {
+	*dialogs.Dialog
+	osm         *osmmap.Map
+	status      *gtk.Label
+	mine        *gtk.Button
+	description *gtk.Entry
+	live        *gtk.CheckButton
+	duration    *gtk.SpinButton
+	interval    *gtk.SpinButton
+
+	composer *Composer
+
+	// position is the user's location, if it's known.
+	position *geolocation.Position
+	// pinned is true if the user picked a location by moving the map.
+	pinned bool
+	// moving is true while the map is moved to the user's location, so that
+	// it isn't taken as the user picking a location.
+	moving bool
+}
+
+// shareLocation shows a dialog that shares a location in the room, either once
+// or live for a while.
+func (c *Composer) shareLocation() {
+	d := locationDialog{composer: c}
+
+	d.Dialog = dialogs.NewLocalize(c.ctx, "Cancel", "Share")
+	d.SetTitle(locale.S(c.ctx, "Share Location"))
+	d.SetDefaultSize(450, 550)
+	d.BindCancelClose()
+	d.OK.SetSensitive(false)
+
+	d.osm = osmmap.NewMap(c.ctx)
+	d.osm.SetVExpand(true)
+	d.osm.SetSizeRequest(-1, 250)
+	d.osm.ConnectMoved(d.pin)
+
+	d.status = gtk.NewLabel(locale.S(c.ctx, "Finding your location..."))
+	d.status.AddCSSClass("composer-location-status")
+	d.status.SetXAlign(0)
+	d.status.SetHExpand(true)
+	d.status.SetWrap(true)
+	d.status.SetWrapMode(pango.WrapWordChar)
+
+	d.mine = gtk.NewButtonWithLabel(locale.S(c.ctx, "Use My Location"))
+	d.mine.SetSensitive(false)
+	d.mine.ConnectClicked(d.useMine)
+
+	statusBox := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	statusBox.Append(d.status)
+	statusBox.Append(d.mine)
+
+	d.description = gtk.NewEntry()
+	d.description.SetPlaceholderText(locale.S(c.ctx, "Description (optional)"))
+
+	d.live = gtk.NewCheckButtonWithLabel(locale.S(c.ctx, "Share live location"))
+	d.live.SetSensitive(false)
+	d.live.ConnectToggled(d.validate)
+
+	d.duration = gtk.NewSpinButtonWithRange(1, 480, 5)
+	d.duration.SetValue(15)
+
+	d.interval = gtk.NewSpinButtonWithRange(5, 300, 5)
+	d.interval.SetValue(30)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(d.osm)
+	box.Append(statusBox)
+	box.Append(d.description)
+	box.Append(d.live)
+	box.Append(spinRow(locale.S(c.ctx, "Share for (minutes)"), d.duration))
+	box.Append(spinRow(locale.S(c.ctx, "Update every (seconds)"), d.interval))
+	locationDialogCSS(box)
+
+	d.SetChild(box)
+	d.validate()
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	d.ConnectDestroy(cancel)
+
+	go func() {
+		err := geolocation.Watch(ctx, func(pos geolocation.Position) {
+			glib.IdleAdd(func() { d.locate(pos) })
+		})
+		if err != nil && ctx.Err() == nil {
+			glib.IdleAdd(func() {
+				d.status.SetText(locale.Sprintf(c.ctx,
+					"Cannot find your location: %v. Drag the map to pick one.", err))
+				d.OK.SetSensitive(true)
+			})
+		}
+	}()
+
+	d.OK.ConnectClicked(func() {
+		d.send()
+		d.Close()
+	})
+
+	d.Show()
+}
+
+func spinRow(label string, spin *gtk.SpinButton) *gtk.Box {
+	l := gtk.NewLabel(label)
+	l.SetXAlign(0)
+	l.SetHExpand(true)
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	box.Append(l)
+	box.Append(spin)
+	return box
+}
+
+// locate updates the user's location. The map follows it unless the user
+// picked a location.
+func (d *locationDialog) locate(pos geolocation.Position) {
+	first := d.position == nil
+	d.position = &pos
+
+	d.mine.SetSensitive(d.pinned)
+	d.OK.SetSensitive(true)
+
+	if d.pinned {
+		return
+	}
+
+	d.moving = true
+	defer func() { d.moving = false }()
+
+	if first {
+		d.osm.SetZoom(locationZoom)
+	}
+	d.osm.SetCenter(pos.Latitude, pos.Longitude)
+	d.osm.SetAccuracy(pos.Accuracy)
+
+	d.status.SetText(locale.S(d.composer.ctx, "Drag the map to pick another location."))
+	d.validate()
+}
+
+// pin is called when the map is moved. Moving it picks the location at its
+// center instead of the user's.
+func (d *locationDialog) pin() {
+	if d.moving || d.pinned {
+		return
+	}
+
+	d.pinned = true
+	d.osm.SetAccuracy(0)
+	d.mine.SetSensitive(d.position != nil)
+	d.OK.SetSensitive(true)
+
+	d.status.SetText(locale.S(d.composer.ctx, "The location at the center of the map is shared."))
+	d.validate()
+}
+
+// useMine moves the map back to the user's location.
+func (d *locationDialog) useMine() {
+	d.pinned = false
+	if d.position != nil {
+		d.locate(*d.position)
+	}
+}
+
+// validate only allows sharing a live location if it's the user's location.
+func (d *locationDialog) validate() {
+	client := gotktrix.FromContext(d.composer.ctx).Offline()
+	canLive := client.CanSendEvent(d.composer.roomID, location.BeaconInfoEventType, true)
+
+	d.live.SetSensitive(canLive && d.position != nil && !d.pinned)
+	if !d.live.Sensitive() {
+		d.live.SetActive(false)
+	}
+
+	d.duration.SetSensitive(d.live.Active())
+	d.interval.SetSensitive(d.live.Active())
+}
+
+// send shares the picked location.
+func (d *locationDialog) send() {
+	c := d.composer
+	description := strings.TrimSpace(d.description.Text())
+
+	if d.live.Active() {
+		c.shareLive(
+			description,
+			time.Duration(d.duration.ValueAsInt())*time.Minute,
+			time.Duration(d.interval.ValueAsInt())*time.Second,
+		)
+		return
+	}
+
+	var uri matrix.GeoURI
+	asset := location.Pin
+
+	if d.pinned || d.position == nil {
+		lat, long := d.osm.Center()
+		uri = location.GeoURI(lat, long, 0)
+	} else {
+		uri = location.GeoURI(d.position.Latitude, d.position.Longitude, d.position.Accuracy)
+		asset = location.Self
+	}
+
+	client := gotktrix.FromContext(c.ctx)
+	msg := location.NewMessage(newRoomMessageEvent(client, c.roomID), uri, description, asset)
+
+	echo := newLocalEcho(c.ctx, c.ctrl, &msg.RoomMessageEvent, msg)
+	client.Background(func(client *gotktrix.Client) { echo.send(client) })
+}
+
+// isSharingLive returns true if the user's live location is being shared in
+// the room.
+func (c *Composer) isSharingLive() bool {
+	_, ok := liveShares[c.roomID]
+	return ok
+}
+
+// stopSharingLive stops sharing the user's live location in the room.
+func (c *Composer) stopSharingLive() {
+	if share, ok := liveShares[c.roomID]; ok {
+		share.cancel()
+	}
+}
+
+// shareLive shares the user's live location in the room for the given
+// duration, sending it at most once every interval. It keeps being shared
+// after the room is closed.
+func (c *Composer) shareLive(description string, timeout, interval time.Duration) {
+	c.stopSharingLive()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	share := &liveShare{cancel: cancel}
+	liveShares[c.roomID] = share
+
+	roomID := c.roomID
+	client := gotktrix.FromContext(c.ctx)
+
+	go func() {
+		defer glib.IdleAdd(func() {
+			if liveShares[roomID] == share {
+				delete(liveShares, roomID)
+			}
+		})
+		defer cancel()
+
+		if err := sendLive(ctx, client, roomID, description, timeout, interval); err != nil {
+			glib.IdleAdd(func() { app.Error(c.ctx, err) })
+		}
+	}()
+}
+
+func sendLive(
+	ctx context.Context, client *gotktrix.Client, roomID matrix.RoomID,
+	description string, timeout, interval time.Duration) error {
+
+	info := location.NewBeaconInfo(description, timeout)
+
+	infoID, err := client.RoomStateSend(roomID, api.RoomStateSendArg{
+		Type:     location.BeaconInfoEventType,
+		StateKey: string(client.UserID),
+		Content:  info,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to share live location")
+	}
+
+	// Only the latest location is kept, so slow sends don't pile them up.
+	positions := make(chan geolocation.Position, 1)
+	watchErr := make(chan error, 1)
+
+	go func() {
+		watchErr <- geolocation.Watch(ctx, func(pos geolocation.Position) {
+			select {
+			case <-positions:
+			default:
+			}
+			positions <- pos
+		})
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var latest *geolocation.Position
+	var sentAt time.Time
+
+	send := func() error {
+		uri := location.GeoURI(latest.Latitude, latest.Longitude, latest.Accuracy)
+		beacon := location.NewBeacon(infoID, uri)
+		latest = nil
+		sentAt = time.Now()
+
+		_, err := client.RoomEventSend(roomID, location.BeaconEventType, beacon)
+		return errors.Wrap(err, "failed to update live location")
+	}
+
+	for err == nil {
+		select {
+		case <-ctx.Done():
+		case err = <-watchErr:
+			if err != nil {
+				err = errors.Wrap(err, "cannot find location")
+			}
+		case pos := <-positions:
+			latest = &pos
+			if time.Since(sentAt) >= interval {
+				err = send()
+			}
+			continue
+		case <-ticker.C:
+			if latest != nil {
+				err = send()
+			}
+			continue
+		}
+		break
+	}
+
+	_, stopErr := client.RoomStateSend(roomID, api.RoomStateSendArg{
+		Type:     location.BeaconInfoEventType,
+		StateKey: string(client.UserID),
+		Content:  info.Stopped(),
+	})
+	if stopErr != nil {
+		return errors.Wrap(stopErr, "failed to stop sharing live location")
+	}
+
+	return err
+}
@@ -0,0 +1,199 @@
+package compose
+
+import (
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/poll"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var pollDialogCSS = cssutil.Applier("composer-poll", `
+	.composer-poll {
+		margin: 12px;
+	}
+	.composer-poll > entry,
+	.composer-poll-answers > box {
+		margin-bottom: 6px;
+	}
+	.composer-poll-add {
+		margin-bottom: 12px;
+	}
+`)
+
+// pollDialog is the dialog that creates a poll.
+type pollDialog struct {
+	*dialogs.Dialog
+	question *gtk.Entry
+	answers  *gtk.Box
+	entries  []*gtk.Entry
+	add      *gtk.Button
+	choices  *gtk.SpinButton
+	hidden   *gtk.CheckButton
+
+	composer *Composer
+}
+
+// createPoll shows a dialog that creates a poll in the room.
+func (c *Composer) createPoll() {
+	d := pollDialog{composer: c}
+
+	d.Dialog = dialogs.NewLocalize(c.ctx, "Cancel", "Create")
+	d.SetTitle(locale.S(c.ctx, "Create Poll"))
+	d.SetDefaultSize(400, -1)
+	d.BindCancelClose()
+
+	d.question = gtk.NewEntry()
+	d.question.SetPlaceholderText(locale.S(c.ctx, "Question"))
+	d.question.ConnectChanged(d.validate)
+
+	d.answers = gtk.NewBox(gtk.OrientationVertical, 0)
+	d.answers.AddCSSClass("composer-poll-answers")
+
+	d.add = gtk.NewButtonWithLabel(locale.S(c.ctx, "Add Answer"))
+	d.add.AddCSSClass("composer-poll-add")
+	d.add.SetHAlign(gtk.AlignStart)
+	d.add.ConnectClicked(func() { d.addAnswer() })
+
+	d.choices = gtk.NewSpinButtonWithRange(1, 1, 1)
+
+	choicesLabel := gtk.NewLabel(locale.S(c.ctx, "Answers per vote"))
+	choicesLabel.SetXAlign(0)
+	choicesLabel.SetHExpand(true)
+
+	choices := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	choices.Append(choicesLabel)
+	choices.Append(d.choices)
+
+	d.hidden = gtk.NewCheckButtonWithLabel(locale.S(c.ctx, "Hide results until the poll ends"))
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(d.question)
+	box.Append(d.answers)
+	box.Append(d.add)
+	box.Append(choices)
+	box.Append(d.hidden)
+	pollDialogCSS(box)
+
+	d.SetChild(box)
+
+	d.addAnswer()
+	d.addAnswer()
+	d.validate()
+
+	d.question.ConnectActivate(func() { d.entries[0].GrabFocus() })
+	d.OK.ConnectClicked(func() {
+		d.send()
+		d.Close()
+	})
+
+	d.Show()
+	d.question.GrabFocus()
+}
+
+// addAnswer adds an entry for another answer.
+func (d *pollDialog) addAnswer() {
+	entry := gtk.NewEntry()
+	entry.SetHExpand(true)
+	entry.SetPlaceholderText(locale.Sprintf(d.composer.ctx, "Answer %d", len(d.entries)+1))
+	entry.ConnectChanged(d.validate)
+
+	remove := gtk.NewButtonFromIconName("list-remove-symbolic")
+	remove.SetTooltipText(locale.S(d.composer.ctx, "Remove Answer"))
+
+	row := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	row.Append(entry)
+	row.Append(remove)
+
+	remove.ConnectClicked(func() {
+		for i, e := range d.entries {
+			if e == entry {
+				d.entries = append(d.entries[:i], d.entries[i+1:]...)
+				break
+			}
+		}
+		d.answers.Remove(row)
+		d.validate()
+	})
+
+	// Pressing Enter moves on to the next answer, adding one if needed.
+	entry.ConnectActivate(func() {
+		for i, e := range d.entries {
+			if e != entry {
+				continue
+			}
+			if i == len(d.entries)-1 {
+				if len(d.entries) == poll.MaxAnswers {
+					return
+				}
+				d.addAnswer()
+			}
+			d.entries[i+1].GrabFocus()
+			return
+		}
+	})
+
+	d.entries = append(d.entries, entry)
+	d.answers.Append(row)
+	d.validate()
+
+	if len(d.entries) > 2 {
+		entry.GrabFocus()
+	}
+}
+
+// pollAnswers returns the answers that aren't empty.
+func (d *pollDialog) pollAnswers() []string {
+	answers := make([]string, 0, len(d.entries))
+	for _, entry := range d.entries {
+		if answer := strings.TrimSpace(entry.Text()); answer != "" {
+			answers = append(answers, answer)
+		}
+	}
+	return answers
+}
+
+// validate only allows creating the poll once it has a question and at least
+// two answers.
+func (d *pollDialog) validate() {
+	answers := d.pollAnswers()
+	question := strings.TrimSpace(d.question.Text())
+
+	d.OK.SetSensitive(question != "" && len(answers) >= 2)
+	d.add.SetSensitive(len(d.entries) < poll.MaxAnswers)
+
+	max := len(answers)
+	if max < 1 {
+		max = 1
+	}
+	d.choices.SetRange(1, float64(max))
+}
+
+// send sends the poll.
+func (d *pollDialog) send() {
+	c := d.composer
+	client := gotktrix.FromContext(c.ctx)
+
+	kind := poll.Disclosed
+	if d.hidden.Active() {
+		kind = poll.Undisclosed
+	}
+
+	ev := poll.NewStartEvent(
+		c.roomID,
+		strings.TrimSpace(d.question.Text()),
+		d.pollAnswers(),
+		kind,
+		d.choices.ValueAsInt(),
+	)
+	ev.Sender = client.UserID
+	ev.OriginServerTime = matrix.Timestamp(time.Now().UnixMilli())
+
+	echo := newLocalEcho(c.ctx, c.ctrl, ev, ev)
+	client.Background(func(client *gotktrix.Client) { echo.send(client) })
+}
@@ -0,0 +1,187 @@
+package compose
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+)
+
+// preformattedLines is the minimum number of lines that pasted text must have
+// to be considered preformatted.
+const preformattedLines = 3
+
+var preformatCSS = cssutil.Applier("composer-preformat", `
+	.composer-preformat {
+		margin: 12px;
+	}
+`)
+
+// looksPreformatted returns true if the text looks like it relies on being
+// shown in a monospace font, such as a table with aligned columns or ASCII art.
+func looksPreformatted(text string) bool {
+	// Text with code blocks of its own is already formatted.
+	if strings.Contains(text, "```") || strings.Contains(text, "~~~") {
+		return false
+	}
+
+	var lines, formatted int
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			continue
+		}
+
+		lines++
+
+		if isAligned(line) || isArt(line) {
+			formatted++
+		}
+	}
+
+	// Require most of the lines to look preformatted, since prose can have the
+	// odd line that does.
+	return lines >= preformattedLines && formatted*3 >= lines*2
+}
+
+// isAligned returns true if the line has a run of spaces or a tab after its
+// indentation, which is usually there to align columns. Two spaces aren't
+// enough, since some people put them after a full stop.
+func isAligned(line string) bool {
+	line = strings.TrimLeft(line, " \t")
+	return strings.Contains(line, "   ") || strings.Contains(line, "\t")
+}
+
+// isArt returns true if at least half of the line is drawn with symbols.
+func isArt(line string) bool {
+	var symbols, total int
+
+	for _, r := range line {
+		if unicode.IsSpace(r) {
+			continue
+		}
+
+		total++
+
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			symbols++
+		}
+	}
+
+	return symbols*2 >= total
+}
+
+// markPaste remembers where the text that is about to be pasted starts.
+func (i *Input) markPaste() {
+	if i.pasteStart != nil {
+		i.buffer.DeleteMark(i.pasteStart)
+	}
+
+	// The pasted text replaces the selection, if any.
+	start, _, _ := i.buffer.SelectionBounds()
+	i.pasteStart = i.buffer.CreateMark("", start, true)
+}
+
+// checkPaste checks the text that was just pasted and offers to put it inside a
+// code block if it looks preformatted, or to quote the message if it's a link
+// to one.
+func (i *Input) checkPaste() {
+	if i.pasteStart == nil {
+		return
+	}
+
+	startMark := i.pasteStart
+	i.pasteStart = nil
+
+	start := i.buffer.IterAtMark(startMark)
+	end := i.buffer.IterAtMark(i.buffer.GetInsert())
+
+	if link, ok := gotktrix.ParseEventPermalink(i.buffer.Slice(start, end, true)); ok {
+		endMark := i.buffer.CreateMark("", end, false)
+		i.quotePermalink(startMark, endMark, link)
+		return
+	}
+
+	if !looksPreformatted(i.buffer.Slice(start, end, true)) || i.inCodeBlock(start) {
+		i.buffer.DeleteMark(startMark)
+		return
+	}
+
+	endMark := i.buffer.CreateMark("", end, false)
+	i.promptCodeBlock(startMark, endMark)
+}
+
+// inCodeBlock returns true if the given position is inside a code block.
+func (i *Input) inCodeBlock(iter *gtk.TextIter) bool {
+	var fence string
+	for _, line := range strings.Split(i.buffer.Slice(i.buffer.StartIter(), iter, true), "\n") {
+		fence = nextFence(fence, line)
+	}
+	return fence != ""
+}
+
+// promptCodeBlock asks the user whether to put the text between the given
+// marks inside a code block.
+func (i *Input) promptCodeBlock(startMark, endMark *gtk.TextMark) {
+	d := dialogs.NewLocalize(i.ctx, "Keep as Is", "Use Code Block")
+	d.SetTitle(locale.S(i.ctx, "Preformatted Text"))
+	d.SetDefaultSize(350, -1)
+	d.BindCancelClose()
+
+	label := gtk.NewLabel(locale.S(i.ctx,
+		"The pasted text looks like it's aligned in columns or drawn as ASCII art. "+
+			"Sending it inside a code block keeps its alignment."))
+	label.SetXAlign(0)
+	label.SetWrap(true)
+	label.SetWrapMode(pango.WrapWordChar)
+	preformatCSS(label)
+	d.SetChild(label)
+
+	d.ConnectDestroy(func() {
+		i.buffer.DeleteMark(startMark)
+		i.buffer.DeleteMark(endMark)
+	})
+
+	d.OK.ConnectClicked(func() {
+		i.wrapCodeBlock(startMark, endMark)
+		d.Close()
+	})
+
+	d.Show()
+}
+
+// wrapCodeBlock puts the text between the given marks inside a code block.
+func (i *Input) wrapCodeBlock(startMark, endMark *gtk.TextMark) {
+	i.buffer.BeginUserAction()
+	defer i.buffer.EndUserAction()
+
+	start := i.buffer.IterAtMark(startMark)
+
+	opening := "```\n"
+	if !start.StartsLine() {
+		opening = "\n" + opening
+	}
+
+	i.buffer.Insert(start, opening)
+
+	end := i.buffer.IterAtMark(endMark)
+
+	var closing string
+	switch {
+	case end.StartsLine():
+		// The pasted text ends with a new line already.
+		closing = "```\n"
+	case end.EndsLine():
+		closing = "\n```"
+	default:
+		closing = "\n```\n"
+	}
+
+	i.buffer.Insert(end, closing)
+}
@@ -0,0 +1,221 @@
+package compose
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// quoteCardLength is the maximum length of the quoted message, since quotes of
+// long messages only need to remind the reader of them.
+const quoteCardLength = 256
+
+type quoteData struct {
+	RoomID     matrix.RoomID
+	RoomName   string
+	EventID    matrix.EventID
+	SenderID   matrix.UserID
+	SenderName string
+	Content    string
+}
+
+const quoteHTML = `
+	<blockquote>
+		<a href="https://matrix.to/#/{{.SenderID}}">{{.SenderName}}</a> in
+		<a href="https://matrix.to/#/{{.RoomID}}/{{.EventID}}">{{.RoomName}}</a>:
+		<br>{{ .Content }}
+	</blockquote>
+`
+
+var quoteTemplate = template.Must(
+	template.New("quote").Parse(
+		// Keep the quote on one line, so that Markdown sees a single HTML
+		// block.
+		templateFormatter.Replace(quoteHTML),
+	),
+)
+
+var quoteCardCSS = cssutil.Applier("composer-quotecard", `
+	.composer-quotecard {
+		margin: 4px 0;
+		padding: 4px 8px;
+		border-left: 3px solid alpha(@theme_fg_color, 0.35);
+		border-radius: 0 4px 4px 0;
+		background-color: alpha(@theme_fg_color, 0.05);
+	}
+	.composer-quotecard-preview {
+		margin: 12px;
+	}
+	.composer-quotecard-room {
+		font-size: 0.9em;
+		color: alpha(@theme_fg_color, 0.75);
+	}
+`)
+
+// newQuoteData describes the given message for quoting it in another room.
+func newQuoteData(client *gotktrix.Client, msg *event.RoomMessageEvent) quoteData {
+	client = client.Offline()
+
+	name, _, _ := msg.Sender.Parse()
+	if n, err := client.MemberName(msg.RoomID, msg.Sender, false); err == nil {
+		name = n.Name
+	}
+
+	roomName, _ := client.RoomName(msg.RoomID)
+	if roomName == "" {
+		roomName = string(msg.RoomID)
+	}
+
+	return quoteData{
+		RoomID:     msg.RoomID,
+		RoomName:   roomName,
+		EventID:    msg.ID,
+		SenderID:   msg.Sender,
+		SenderName: name,
+		Content:    trim(msg.Body, quoteCardLength),
+	}
+}
+
+// permalink returns the matrix.to link to the quoted message.
+func (data quoteData) permalink() string {
+	return "https://matrix.to/#/" + string(data.RoomID) + "/" + string(data.EventID)
+}
+
+// render renders the quote as HTML and as plain text.
+func (data quoteData) render() (html, plain string) {
+	var b strings.Builder
+	if err := quoteTemplate.Execute(&b, data); err != nil {
+		log.Panicln("compose: failed to render quote HTML:", err)
+	}
+	// End the HTML block, in case the user types right below the quote.
+	b.WriteString("\n")
+
+	plain = "> " + data.SenderName + " in " + data.RoomName + ": " + data.Content +
+		"\n> " + data.permalink() + "\n"
+
+	return b.String(), plain
+}
+
+// newQuoteCard creates the widget that shows the quote in the composer.
+func newQuoteCard(ctx context.Context, data quoteData) *gtk.Box {
+	client := gotktrix.FromContext(ctx)
+
+	author := gtk.NewLabel("")
+	author.SetXAlign(0)
+	author.SetEllipsize(pango.EllipsizeEnd)
+	author.SetMarkup(mauthor.Markup(client, data.RoomID, data.SenderID))
+
+	room := gtk.NewLabel(locale.Sprintf(ctx, "in %s", data.RoomName))
+	room.AddCSSClass("composer-quotecard-room")
+	room.SetXAlign(0)
+	room.SetEllipsize(pango.EllipsizeEnd)
+
+	header := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	header.Append(author)
+	header.Append(room)
+
+	content := gtk.NewLabel(data.Content)
+	content.SetXAlign(0)
+	content.SetWrap(true)
+	content.SetWrapMode(pango.WrapWordChar)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 2)
+	box.SetTooltipText(data.permalink())
+	box.Append(header)
+	box.Append(content)
+	quoteCardCSS(box)
+
+	return box
+}
+
+// quotePermalink fetches the message that the pasted permalink between the
+// given marks points to, and then offers to replace the link with a quote of
+// the message. The marks are deleted afterwards.
+func (i *Input) quotePermalink(startMark, endMark *gtk.TextMark, link gotktrix.EventPermalink) {
+	deleteMarks := func() {
+		i.buffer.DeleteMark(startMark)
+		i.buffer.DeleteMark(endMark)
+	}
+
+	gtkutil.Async(i.ctx, func() func() {
+		client := gotktrix.FromContext(i.ctx)
+
+		ev, err := client.PermalinkEvent(link)
+		if err != nil {
+			return func() {
+				deleteMarks()
+				app.Error(i.ctx, err)
+			}
+		}
+
+		msg, ok := ev.(*event.RoomMessageEvent)
+		if !ok {
+			// Only messages can be quoted, so keep the link.
+			return deleteMarks
+		}
+
+		data := newQuoteData(client, msg)
+
+		return func() {
+			d := dialogs.NewLocalize(i.ctx, "Keep Link", "Quote Message")
+			d.SetTitle(locale.S(i.ctx, "Quote Message"))
+			d.SetDefaultSize(350, -1)
+			d.BindCancelClose()
+
+			card := newQuoteCard(i.ctx, data)
+			card.AddCSSClass("composer-quotecard-preview")
+			d.SetChild(card)
+
+			d.ConnectDestroy(deleteMarks)
+
+			d.OK.ConnectClicked(func() {
+				i.insertQuoteCard(startMark, endMark, data)
+				d.Close()
+			})
+
+			d.Show()
+		}
+	})
+}
+
+// insertQuoteCard replaces the text between the given marks with a card that
+// quotes the message. The card is put on its own line.
+func (i *Input) insertQuoteCard(startMark, endMark *gtk.TextMark, data quoteData) {
+	i.buffer.BeginUserAction()
+	defer i.buffer.EndUserAction()
+
+	start := i.buffer.IterAtMark(startMark)
+	end := i.buffer.IterAtMark(endMark)
+	i.buffer.Delete(start, end)
+
+	iter := i.buffer.IterAtMark(startMark)
+	if !iter.StartsLine() {
+		i.buffer.Insert(iter, "\n")
+	}
+
+	anchor := i.buffer.CreateChildAnchor(iter)
+	i.TextView.AddChildAtAnchor(newQuoteCard(i.ctx, data), anchor)
+
+	html, plain := data.render()
+	i.anchors.PushBack(anchorPiece{
+		anchor: anchor,
+		html:   html,
+		text:   plain,
+	})
+
+	i.buffer.Insert(iter, "\n")
+	i.buffer.PlaceCursor(iter)
+}
@@ -0,0 +1,115 @@
+package compose
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// readOnlyBar is shown instead of the composer in rooms where the user can't
+// send messages.
+type readOnlyBar struct {
+	*gtk.Box
+	icon   *gtk.Image
+	label  *gtk.Label
+	notify *gtk.ToggleButton
+
+	ctx    context.Context
+	roomID matrix.RoomID
+
+	// updating is true while the notify toggle is set to the current push
+	// rule, so that it isn't taken as the user toggling it.
+	updating bool
+}
+
+var readOnlyCSS = cssutil.Applier("composer-readonly", `
+	.composer-readonly {
+		padding: 6px 12px;
+		min-height: 36px;
+	}
+	.composer-readonly-label {
+		color: alpha(@theme_fg_color, 0.75);
+	}
+`)
+
+func newReadOnlyBar(ctx context.Context, roomID matrix.RoomID) *readOnlyBar {
+	b := readOnlyBar{
+		ctx:    ctx,
+		roomID: roomID,
+	}
+
+	b.icon = gtk.NewImageFromIconName("")
+
+	b.label = gtk.NewLabel("")
+	b.label.AddCSSClass("composer-readonly-label")
+	b.label.SetHExpand(true)
+	b.label.SetXAlign(0)
+	b.label.SetWrap(true)
+	b.label.SetWrapMode(pango.WrapWordChar)
+
+	b.notify = gtk.NewToggleButtonWithLabel(locale.S(ctx, "Notify Me"))
+	b.notify.SetVAlign(gtk.AlignCenter)
+	b.notify.SetTooltipText(locale.S(ctx, "Get notified of every new message in this room"))
+	b.notify.ConnectToggled(func() {
+		if !b.updating {
+			b.setNotify(b.notify.Active())
+		}
+	})
+
+	b.Box = gtk.NewBox(gtk.OrientationHorizontal, 8)
+	b.Append(b.icon)
+	b.Append(b.label)
+	b.Append(b.notify)
+	readOnlyCSS(b)
+
+	return &b
+}
+
+// invalidate updates the bar to describe why the room is read-only.
+func (b *readOnlyBar) invalidate() {
+	client := gotktrix.FromContext(b.ctx).Offline()
+
+	if client.IsAnnouncementRoom(b.roomID) {
+		b.icon.SetFromIconName("dialog-information-symbolic")
+		b.label.SetText(locale.S(b.ctx,
+			"This is an announcement room. Only moderators can post here."))
+	} else {
+		b.icon.SetFromIconName("action-unavailable-symbolic")
+		b.label.SetText(locale.S(b.ctx,
+			"You don't have the permission to send messages in this room."))
+	}
+
+	b.updating = true
+	b.notify.SetActive(client.RoomNotifiesAll(b.roomID))
+	b.updating = false
+}
+
+// setNotify changes whether the user is notified of every message in the room.
+// The toggle is reverted if that fails.
+func (b *readOnlyBar) setNotify(notify bool) {
+	b.notify.SetSensitive(false)
+
+	client := gotktrix.FromContext(b.ctx)
+	client.Background(func(client *gotktrix.Client) {
+		err := client.SetRoomNotifiesAll(b.roomID, notify)
+
+		glib.IdleAdd(func() {
+			b.notify.SetSensitive(true)
+
+			if err != nil {
+				app.Error(b.ctx, err)
+
+				b.updating = true
+				b.notify.SetActive(!notify)
+				b.updating = false
+			}
+		})
+	})
+}
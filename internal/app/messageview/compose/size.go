@@ -0,0 +1,287 @@
+package compose
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	// maxEventSize is the largest event that servers accept.
+	maxEventSize = 65536
+	// maxContentSize is the largest message that we send. It leaves room for
+	// the fields that the server adds to the event.
+	maxContentSize = maxEventSize - 4096
+	// splitSize is the maximum length of the text of each message that a long
+	// message is split into. The text is sent both as plain text and as HTML,
+	// so this leaves plenty of room for both.
+	splitSize = maxContentSize / 4
+	// counterThreshold is the estimated message size at which the composer
+	// starts showing how large the message is.
+	counterThreshold = maxContentSize / 2
+)
+
+var autoSplit = prefs.NewBool(false, prefs.PropMeta{
+	Name:    "Split Long Messages",
+	Section: "Text",
+	Description: "Automatically split messages that are too long to be sent " +
+		"into multiple messages at paragraph boundaries instead of asking.",
+})
+
+// Dialog responses of the oversized message prompt.
+const (
+	responseSplit = iota + 1
+	responseUpload
+)
+
+var counterCSS = cssutil.Applier("composer-counter", `
+	.composer-counter {
+		margin: 0 6px;
+		margin-bottom: 10px;
+		font-size: 0.8em;
+		color: alpha(@theme_fg_color, 0.65);
+	}
+	.composer-counter.composer-counter-over {
+		color: @error_color;
+	}
+`)
+
+var oversizeCSS = cssutil.Applier("composer-oversize", `
+	.composer-oversize {
+		margin: 12px;
+	}
+`)
+
+// estimateSize estimates the size of the message with the given text. Unlike
+// rendering the message, it's cheap enough to be done on every keystroke.
+func estimateSize(text string) int {
+	// The text is sent as both the plain body and the HTML body.
+	return 2 * len(text)
+}
+
+// newCounter creates the label that shows the length of the message.
+func newCounter() *gtk.Label {
+	counter := gtk.NewLabel("")
+	counter.SetVAlign(gtk.AlignEnd)
+	counter.Hide()
+	counterCSS(counter)
+	return counter
+}
+
+// updateCounter updates the counter with the length of the message in the
+// input. The counter is only shown once the message is getting large.
+func (c *Composer) updateCounter() {
+	start, end := c.input.buffer.Bounds()
+	size := estimateSize(c.input.buffer.Text(start, end, true))
+
+	if size < counterThreshold {
+		c.counter.Hide()
+		return
+	}
+
+	c.counter.SetText(locale.Sprintf(c.ctx,
+		"%d characters (%s)", c.input.buffer.CharCount(), humanize.Bytes(uint64(size))))
+	c.counter.SetTooltipText(locale.Sprintf(c.ctx,
+		"Messages can be at most %s.", humanize.Bytes(maxContentSize)))
+	c.counter.Show()
+
+	if size > maxContentSize {
+		c.counter.AddCSSClass("composer-counter-over")
+	} else {
+		c.counter.RemoveCSSClass("composer-counter-over")
+	}
+}
+
+// size returns the size of the message event created from the input data.
+func (data inputData) size(client *gotktrix.Client) int {
+	b, err := json.Marshal(data.put(client))
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// sendOversize handles a message that is too large to be sent. It's split into
+// multiple messages if the user wants that, otherwise the user is asked whether
+// to split it or to upload it as a file.
+func (i *Input) sendOversize(dt inputData, size int) {
+	// An edit can only replace a single message, so it can't be split.
+	var parts []inputData
+	if dt.editing == "" {
+		parts = i.putParts()
+	}
+
+	if autoSplit.Value() && len(parts) > 1 {
+		i.send(parts...)
+		i.reset()
+		return
+	}
+
+	i.promptOversize(dt, size, parts)
+}
+
+// promptOversize asks the user what to do with a message that is too large to
+// be sent: it can be split into the given parts or uploaded as a file.
+func (i *Input) promptOversize(dt inputData, size int, parts []inputData) {
+
+	d := gtk.NewDialogWithFlags(
+		locale.S(i.ctx, "Message Too Long"), app.GTKWindowFromContext(i.ctx),
+		gtk.DialogUseHeaderBar|gtk.DialogModal|gtk.DialogDestroyWithParent)
+	d.HeaderBar().SetShowTitleButtons(false)
+
+	message := locale.Sprintf(i.ctx,
+		"This message is %s, but messages can be at most %s. "+
+			"It can be sent as a file instead.",
+		humanize.Bytes(uint64(size)), humanize.Bytes(maxContentSize))
+
+	if len(parts) > 1 {
+		message = locale.Sprintf(i.ctx,
+			"This message is %s, but messages can be at most %s. "+
+				"It can be split into %d messages or sent as a file instead.",
+			humanize.Bytes(uint64(size)), humanize.Bytes(maxContentSize), len(parts))
+	}
+
+	label := gtk.NewLabel(message)
+	label.SetWrap(true)
+	label.SetXAlign(0)
+	oversizeCSS(label)
+	d.SetChild(label)
+
+	d.AddButton(locale.S(i.ctx, "Cancel"), int(gtk.ResponseCancel))
+	d.AddButton(locale.S(i.ctx, "Send as File"), responseUpload)
+
+	if len(parts) > 1 {
+		split := d.AddButton(locale.S(i.ctx, "Split"), responseSplit).(*gtk.Button)
+		split.AddCSSClass("suggested-action")
+	}
+
+	d.ConnectResponse(func(resp int) {
+		switch resp {
+		case responseSplit:
+			i.send(parts...)
+			i.reset()
+		case responseUpload:
+			i.uploadText(dt)
+			i.reset()
+		}
+		d.Destroy()
+	})
+	d.Show()
+}
+
+// uploadText uploads the plain text of the message as a file.
+func (i *Input) uploadText(dt inputData) {
+	u := uploader{
+		ctx:    i.ctx,
+		ctrl:   i.ctrl,
+		roomID: i.roomID,
+	}
+
+	u.uploadKnown(&uploadingFile{
+		ReadCloser: io.NopCloser(strings.NewReader(dt.plain)),
+		name:       "message.txt",
+		mime:       "text/plain",
+		size:       int64(len(dt.plain)),
+	})
+}
+
+// putParts is like put, except the buffer is split into parts that are small
+// enough to be sent as separate messages. Only the first part is a reply.
+func (i *Input) putParts() []inputData {
+	head, tail := i.buffer.Bounds()
+
+	// Keep the anchors as object replacement characters, then render each part
+	// with the anchors that it has.
+	text := i.buffer.Slice(head, tail, true)
+	slots := i.anchorSlots(text)
+
+	texts := splitMessage(strings.TrimSpace(text), splitSize)
+	parts := make([]inputData, 0, len(texts))
+
+	for _, text := range texts {
+		html, _ := renderSlots(text, slots, func(anchor anchorPiece) string { return anchor.html })
+		plain, rest := renderSlots(text, slots, func(anchor anchorPiece) string { return anchor.text })
+		slots = rest
+
+		html = strings.TrimSpace(html)
+		if html == "" {
+			continue
+		}
+
+		dt := inputData{
+			roomID:     i.roomID,
+			plain:      strings.TrimSpace(plain),
+			html:       html,
+			inputState: i.inputState,
+		}
+		if len(parts) > 0 {
+			dt.replyingTo = ""
+		}
+
+		parts = append(parts, dt)
+	}
+
+	return parts
+}
+
+// anchorSlots returns the anchors of the object replacement characters in the
+// given buffer text, in order. The characters that aren't our anchors have nil
+// slots.
+func (i *Input) anchorSlots(text string) []*anchorPiece {
+	pieces := make(map[int]*anchorPiece, i.anchors.Len())
+
+	for elem := i.anchors.Front(); elem != nil; elem = elem.Next() {
+		anchor := elem.Value.(anchorPiece)
+		if !anchor.anchor.Deleted() {
+			anIter := i.buffer.IterAtChildAnchor(anchor.anchor)
+			pieces[anIter.Offset()] = &anchor
+		}
+	}
+
+	var slots []*anchorPiece
+	var offset int
+
+	for _, r := range text {
+		if r == '\uFFFC' {
+			slots = append(slots, pieces[offset])
+		}
+		offset++
+	}
+
+	return slots
+}
+
+// renderSlots replaces the object replacement characters in the text with the
+// anchors in slots, returning the slots that are left.
+func renderSlots(
+	text string, slots []*anchorPiece, f func(anchorPiece) string) (string, []*anchorPiece) {
+
+	var buf strings.Builder
+	buf.Grow(len(text))
+
+	for _, r := range text {
+		if r != '\uFFFC' || len(slots) == 0 {
+			buf.WriteRune(r)
+			continue
+		}
+
+		if slots[0] != nil {
+			buf.WriteString(f(*slots[0]))
+		} else {
+			// Preserve the rune if this isn't our anchor.
+			buf.WriteRune(r)
+		}
+
+		slots = slots[1:]
+	}
+
+	return buf.String(), slots
+}
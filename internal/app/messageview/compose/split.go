@@ -0,0 +1,202 @@
+package compose
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// splitMessage splits the given Markdown text into parts that are at most max
+// bytes long. The text is split at paragraph boundaries, which are blank lines
+// outside of code blocks, so code blocks are kept intact. Paragraphs that are
+// too long on their own are split at line boundaries; a code block that is
+// split this way is closed at the end of the part and opened again at the
+// start of the next one. Lines that are still too long are split at max bytes.
+func splitMessage(text string, max int) []string {
+	if len(text) <= max {
+		return []string{text}
+	}
+
+	var parts []string
+	var part string
+
+	for _, block := range splitBlocks(text) {
+		switch {
+		case part == "":
+			part = block
+		case len(part)+len("\n\n")+len(block) <= max:
+			part += "\n\n" + block
+		default:
+			parts = append(parts, part)
+			part = block
+		}
+
+		if len(part) > max {
+			// The block is too long on its own, so split it up and keep the
+			// rest for the next blocks.
+			blockParts := splitBlock(part, max)
+			parts = append(parts, blockParts[:len(blockParts)-1]...)
+			part = blockParts[len(blockParts)-1]
+		}
+	}
+
+	if part != "" {
+		parts = append(parts, part)
+	}
+
+	return parts
+}
+
+// splitBlocks splits the text into paragraphs at blank lines that are outside
+// of code blocks.
+func splitBlocks(text string) []string {
+	var blocks []string
+	var block []string
+	var fence string
+
+	for _, line := range strings.Split(text, "\n") {
+		if fence == "" && strings.TrimSpace(line) == "" {
+			if len(block) > 0 {
+				blocks = append(blocks, strings.Join(block, "\n"))
+				block = nil
+			}
+			continue
+		}
+
+		block = append(block, line)
+		fence = nextFence(fence, line)
+	}
+
+	if len(block) > 0 {
+		blocks = append(blocks, strings.Join(block, "\n"))
+	}
+
+	return blocks
+}
+
+// splitBlock splits a single paragraph into parts of at most max bytes at line
+// boundaries, closing and reopening the code block that it's split in.
+func splitBlock(block string, max int) []string {
+	var parts []string
+	var part strings.Builder
+
+	// fence is the fence of the code block that we're in, and open is the line
+	// that opened it.
+	var fence, open string
+	// fresh is true if the part has nothing but the reopened code block.
+	fresh := true
+
+	flush := func() {
+		if fence != "" {
+			part.WriteString("\n")
+			part.WriteString(fence)
+		}
+
+		parts = append(parts, part.String())
+		part.Reset()
+
+		if fence != "" {
+			part.WriteString(open)
+		}
+		fresh = true
+	}
+
+	write := func(s string) {
+		if part.Len() > 0 {
+			part.WriteString("\n")
+		}
+		part.WriteString(s)
+		fresh = false
+	}
+
+	for _, line := range strings.Split(block, "\n") {
+		rest := line
+
+		for {
+			// Reserve space for closing the code block, unless this line
+			// closes it.
+			var reserve int
+			if fence != "" && nextFence(fence, line) != "" {
+				reserve = len("\n") + len(fence)
+			}
+
+			var sep int
+			if part.Len() > 0 {
+				sep = len("\n")
+			}
+
+			if part.Len()+sep+len(rest)+reserve <= max {
+				write(rest)
+				break
+			}
+
+			// A part with nothing but the line that opened the code block
+			// would be an empty code block, so cut the line into it instead.
+			if !fresh && !(fence != "" && part.String() == open) {
+				flush()
+				continue
+			}
+
+			// The line doesn't fit even in an empty part, so cut it.
+			n := cutIndex(rest, max-part.Len()-sep-reserve)
+			write(rest[:n])
+			flush()
+			rest = rest[n:]
+		}
+
+		wasFence := fence
+		fence = nextFence(fence, line)
+
+		if wasFence == "" && fence != "" {
+			open = line
+		}
+	}
+
+	if !fresh {
+		flush()
+	}
+
+	return parts
+}
+
+// cutIndex returns the index to cut s at so that the first half is at most n
+// bytes long without splitting a rune. At least one rune is always cut off.
+func cutIndex(s string, n int) int {
+	if n >= len(s) {
+		return len(s)
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	if n == 0 {
+		_, n = utf8.DecodeRuneInString(s)
+	}
+
+	return n
+}
+
+// nextFence returns the fence of the code block that the Markdown is in after
+// the given line, given the fence of the code block that it's in before the
+// line. An empty fence means it's not in a code block.
+func nextFence(fence, line string) string {
+	trimmed := strings.TrimSpace(line)
+
+	if fence == "" {
+		for _, char := range []string{"`", "~"} {
+			run := len(trimmed) - len(strings.TrimLeft(trimmed, char))
+			if run >= 3 {
+				return trimmed[:run]
+			}
+		}
+		return ""
+	}
+
+	// A closing fence must be at least as long as the opening one and have
+	// nothing after it.
+	if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+		return ""
+	}
+
+	return fence
+}
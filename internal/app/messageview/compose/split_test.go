@@ -0,0 +1,196 @@
+package compose
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		max    int
+		expect []string
+	}{
+		{
+			name:   "short",
+			text:   "hello world",
+			max:    20,
+			expect: []string{"hello world"},
+		},
+		{
+			name:   "exact",
+			text:   "hello",
+			max:    5,
+			expect: []string{"hello"},
+		},
+		{
+			name:   "paragraphs",
+			text:   "first paragraph\n\nsecond paragraph",
+			max:    20,
+			expect: []string{"first paragraph", "second paragraph"},
+		},
+		{
+			name:   "joined paragraphs",
+			text:   "one\n\ntwo\n\nthree is longer",
+			max:    12,
+			expect: []string{"one\n\ntwo", "three is lon", "ger"},
+		},
+		{
+			name:   "extra blank lines",
+			text:   "one\n\n\n\ntwo\n \nthree",
+			max:    10,
+			expect: []string{"one\n\ntwo", "three"},
+		},
+		{
+			name:   "lines",
+			text:   "line one\nline two\nline three",
+			max:    18,
+			expect: []string{"line one\nline two", "line three"},
+		},
+		{
+			name:   "long line",
+			text:   "abcdefghij",
+			max:    4,
+			expect: []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name:   "code block kept",
+			text:   "intro\n\n```\na\n\nb\n```",
+			max:    14,
+			expect: []string{"intro", "```\na\n\nb\n```"},
+		},
+		{
+			name: "code block split",
+			text: "```go\nline 1\nline 2\nline 3\n```",
+			max:  20,
+			expect: []string{
+				"```go\nline 1\n```",
+				"```go\nline 2\n```",
+				"```go\nline 3\n```",
+			},
+		},
+		{
+			name: "tilde fence",
+			text: "~~~~\naaaa\n~~~\nbbbb\n~~~~",
+			max:  20,
+			expect: []string{
+				"~~~~\naaaa\n~~~\n~~~~",
+				"~~~~\nbbbb\n~~~~",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := splitMessage(test.text, test.max)
+			if !equalParts(got, test.expect) {
+				t.Fatalf("parts mismatch:\n-> %q\n<- %q", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestSplitMessageLimits(t *testing.T) {
+	text := strings.Repeat("Ünïcödé wörds ", 50) + "\n\n```\n" +
+		strings.Repeat("code line\n", 30) + "```\n\n" + strings.Repeat("é", 100)
+
+	for _, max := range []int{16, 33, 64, 100} {
+		for _, part := range splitMessage(text, max) {
+			if len(part) > max {
+				t.Errorf("max %d: part is %d bytes long: %q", max, len(part), part)
+			}
+			if !utf8.ValidString(part) {
+				t.Errorf("max %d: part splits a rune: %q", max, part)
+			}
+		}
+	}
+}
+
+func TestSplitBlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		block  string
+		max    int
+		expect []string
+	}{
+		{
+			name:   "fits",
+			block:  "one\ntwo",
+			max:    10,
+			expect: []string{"one\ntwo"},
+		},
+		{
+			name:   "lines",
+			block:  "one\ntwo\nthree",
+			max:    7,
+			expect: []string{"one\ntwo", "three"},
+		},
+		{
+			name:   "cut rune",
+			block:  "ééé",
+			max:    3,
+			expect: []string{"é", "é", "é"},
+		},
+		{
+			name:   "cut in code block",
+			block:  "```\nabcdefgh\n```",
+			max:    12,
+			expect: []string{"```\nabcd\n```", "```\nefgh\n```"},
+		},
+		{
+			name:   "after code block",
+			block:  "```\ncode\n```\ntext",
+			max:    12,
+			expect: []string{"```\ncode\n```", "text"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := splitBlock(test.block, test.max)
+			if !equalParts(got, test.expect) {
+				t.Fatalf("parts mismatch:\n-> %q\n<- %q", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestNextFence(t *testing.T) {
+	tests := []struct {
+		fence  string
+		line   string
+		expect string
+	}{
+		{"", "text", ""},
+		{"", "```", "```"},
+		{"", "```go", "```"},
+		{"", "  ~~~~", "~~~~"},
+		{"", "``", ""},
+		{"```", "code", "```"},
+		{"```", "```", ""},
+		{"```", "````", ""},
+		{"````", "```", "````"},
+		{"```", "``` not closed", "```"},
+		{"```", "~~~", "```"},
+	}
+
+	for _, test := range tests {
+		if got := nextFence(test.fence, test.line); got != test.expect {
+			t.Errorf("nextFence(%q, %q):\n-> %q\n<- %q", test.fence, test.line, test.expect, got)
+		}
+	}
+}
+
+func equalParts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
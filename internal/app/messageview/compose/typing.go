@@ -0,0 +1,94 @@
+package compose
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+const (
+	// typingTimeout is how long the homeserver shows the user as typing after
+	// each notification.
+	typingTimeout = 10 * time.Second
+	// typingInterval is how often the notification is sent again while the
+	// user keeps typing, which leaves some margin before typingTimeout.
+	typingInterval = 6 * time.Second
+	// typingIdle is how long the user can stop typing for before they're no
+	// longer shown as typing.
+	typingIdle = 4 * time.Second
+)
+
+// typingNotifier tells the homeserver when the user is typing in a room.
+type typingNotifier struct {
+	ctx    context.Context
+	roomID matrix.RoomID
+
+	// sent is when the last typing notification was sent, or zero if the user
+	// isn't shown as typing.
+	sent time.Time
+	idle glib.SourceHandle
+}
+
+func newTypingNotifier(ctx context.Context, roomID matrix.RoomID) *typingNotifier {
+	return &typingNotifier{
+		ctx:    ctx,
+		roomID: roomID,
+	}
+}
+
+// typed marks the user as typing. The notification is only sent again once
+// typingInterval has passed, and the user is marked as no longer typing once
+// they stop for typingIdle.
+func (t *typingNotifier) typed() {
+	client := gotktrix.FromContext(t.ctx)
+	if client.PrivacyMode() {
+		return
+	}
+
+	if t.idle != 0 {
+		glib.SourceRemove(t.idle)
+	}
+	t.idle = glib.TimeoutAdd(uint(typingIdle/time.Millisecond), func() {
+		t.idle = 0
+		t.stop()
+	})
+
+	now := time.Now()
+	if !t.sent.IsZero() && now.Sub(t.sent) < typingInterval {
+		return
+	}
+	t.sent = now
+
+	roomID := t.roomID
+	go func() {
+		if err := client.TypingStart(roomID, typingTimeout); err != nil {
+			log.Println("failed to send typing notification:", err)
+		}
+	}()
+}
+
+// stop marks the user as no longer typing if they were.
+func (t *typingNotifier) stop() {
+	if t.idle != 0 {
+		glib.SourceRemove(t.idle)
+		t.idle = 0
+	}
+
+	if t.sent.IsZero() {
+		return
+	}
+	t.sent = time.Time{}
+
+	client := gotktrix.FromContext(t.ctx)
+	roomID := t.roomID
+
+	go func() {
+		if err := client.TypingStop(roomID); err != nil {
+			log.Println("failed to stop typing notification:", err)
+		}
+	}()
+}
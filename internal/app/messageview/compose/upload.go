@@ -21,7 +21,6 @@ import (
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 	"github.com/diamondburned/gotkit/gtkutil/textutil"
 	"github.com/diamondburned/gotkit/osutil"
-	"github.com/diamondburned/gotktrix/internal/components/filepick"
 	"github.com/diamondburned/gotktrix/internal/components/progress"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
 	"github.com/diamondburned/gotktrix/internal/gtkutil/mediautil"
@@ -168,33 +167,6 @@ type uploader struct {
 	roomID matrix.RoomID
 }
 
-// ask creates a new file chooser asking the user to pick files to be uploaded.
-func (u uploader) ask() {
-	// TODO: allow selecting multiple files
-	chooser := filepick.New(
-		u.ctx, "Upload File",
-		gtk.FileChooserActionOpen,
-		locale.S(u.ctx, "Upload"),
-		locale.S(u.ctx, "Cancel"),
-	)
-	chooser.SetSelectMultiple(false)
-
-	// Cannot use chooser.File(); see
-	// https://github.com/diamondburned/gotk4/issues/29.
-	chooser.ConnectAccept(func() {
-		file := chooser.File()
-
-		u.upload(fileUpload{
-			name: file.Basename(),
-			file: func(ctx context.Context) (*uploadingFile, error) {
-				return newUploadingFile(ctx, file)
-			},
-		})
-	})
-
-	chooser.Show()
-}
-
 // paste pastes the content inside the clipboard. It ignores texts, since texts
 // should be pasted into the composer instead.
 func (u uploader) paste() {
@@ -232,6 +204,22 @@ func mimeIsText(mime string) bool {
 }
 
 func (u uploader) promptUpload(file fileUpload) {
+	u.promptUploadThen(file, nil)
+}
+
+// promptUploads prompts for each of the given files one after another. The
+// next file is prompted once the dialog of the previous one is closed.
+func (u uploader) promptUploads(files []fileUpload) {
+	if len(files) == 0 {
+		return
+	}
+
+	u.promptUploadThen(files[0], func() { u.promptUploads(files[1:]) })
+}
+
+// promptUploadThen prompts for the file upload and calls then once the dialog
+// is closed, whether or not the file was uploaded.
+func (u uploader) promptUploadThen(file fileUpload, then func()) {
 	bin := adaptive.NewBin()
 	bin.SetHAlign(gtk.AlignCenter)
 	bin.SetVAlign(gtk.AlignCenter)
@@ -281,6 +269,18 @@ func (u uploader) promptUpload(file fileUpload) {
 	var upload *uploadingFile
 	ctx, cancel := context.WithCancel(u.ctx)
 
+	if then != nil {
+		var closed bool
+		d.ConnectCloseRequest(func() bool {
+			// The dialog may be asked to close more than once.
+			if !closed {
+				closed = true
+				glib.IdleAdd(then)
+			}
+			return false
+		})
+	}
+
 	close := func() {
 		// Ensure the fd is closed if any.
 		if upload != nil {
@@ -379,34 +379,41 @@ func (u uploader) uploadKnown(upload *uploadingFile) {
 }
 
 func (u uploader) finishUpload(mark interface{}, upload *uploadingFile, bar *uploadProgress) {
-	go func() {
-		client := gotktrix.FromContext(u.ctx)
-		file := gotrix.File{
-			Name:     upload.name,
-			MIMEType: upload.mime,
-			Content:  upload.ReadCloser,
-		}
+	gotktrix.FromContext(u.ctx).Background(func(client *gotktrix.Client) {
+		u.sendUpload(client, mark, upload, bar)
+	})
+}
 
-		var eventID matrix.EventID
-		var err error
+// sendUpload uploads the file and sends it as a message, then binds the sending
+// message with the given mark to it. It blocks until the file is sent.
+func (u uploader) sendUpload(
+	client *gotktrix.Client, mark interface{}, upload *uploadingFile, bar *uploadProgress) {
 
-		switch strings.Split(upload.mime, "/")[0] {
-		case "image":
-			eventID, err = client.SendImage(u.roomID, file)
-		case "audio":
-			eventID, err = client.SendAudio(u.roomID, file)
-		case "video":
-			eventID, err = client.SendVideo(u.roomID, file)
-		default:
-			eventID, err = client.SendFile(u.roomID, file)
-		}
+	file := gotrix.File{
+		Name:     upload.name,
+		MIMEType: upload.mime,
+		Content:  upload.ReadCloser,
+	}
 
-		glib.IdleAdd(func() {
-			if err != nil {
-				bar.Error(err)
-			} else {
-				u.ctrl.BindSendingMessage(mark, eventID)
-			}
-		})
-	}()
+	var eventID matrix.EventID
+	var err error
+
+	switch strings.Split(upload.mime, "/")[0] {
+	case "image":
+		eventID, err = client.SendImage(u.roomID, file)
+	case "audio":
+		eventID, err = client.SendAudio(u.roomID, file)
+	case "video":
+		eventID, err = client.SendVideo(u.roomID, file)
+	default:
+		eventID, err = client.SendFile(u.roomID, file)
+	}
+
+	glib.IdleAdd(func() {
+		if err != nil {
+			bar.Error(err)
+		} else {
+			u.ctrl.BindSendingMessage(mark, eventID)
+		}
+	})
 }
@@ -0,0 +1,100 @@
+package messageview
+
+import (
+	"bufio"
+	"context"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/core/gioutil"
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/pkg/errors"
+)
+
+// uriListMIME is the MIME type that file managers use to drag files.
+const uriListMIME = "text/uri-list"
+
+var fileDropCSS = cssutil.Applier("messageview-filedrop", `
+	.messageview-filedrop-active {
+		box-shadow: inset 0 0 0 2px @accent_color;
+		background-color: alpha(@accent_color, 0.08);
+	}
+`)
+
+// bindFileDrop lets files be dragged onto the page to upload them.
+func (p *Page) bindFileDrop() {
+	fileDropCSS(p.box)
+
+	drop := gtk.NewDropTargetAsync(gdk.NewContentFormats([]string{uriListMIME}), gdk.ActionCopy)
+	drop.ConnectAccept(func(gdk.Dropper) bool {
+		return p.Composer.CanSend()
+	})
+	drop.ConnectDragEnter(func(gdk.Dropper, float64, float64) gdk.DragAction {
+		p.box.AddCSSClass("messageview-filedrop-active")
+		return gdk.ActionCopy
+	})
+	drop.ConnectDragLeave(func(gdk.Dropper) {
+		p.box.RemoveCSSClass("messageview-filedrop-active")
+	})
+	drop.ConnectDrop(func(dropper gdk.Dropper, _, _ float64) bool {
+		p.box.RemoveCSSClass("messageview-filedrop-active")
+
+		d := gdk.BaseDrop(dropper)
+		d.ReadAsync(p.roomCtx, []string{uriListMIME}, 0, func(res gio.AsyncResulter) {
+			_, stream, err := d.ReadFinish(res)
+			if err != nil {
+				d.Finish(0)
+				app.Error(p.roomCtx, errors.Wrap(err, "cannot read dropped files"))
+				return
+			}
+
+			gtkutil.Async(p.roomCtx, func() func() {
+				files := readURIList(p.roomCtx, stream)
+				return func() {
+					if len(files) == 0 {
+						d.Finish(0)
+						return
+					}
+
+					d.Finish(gdk.ActionCopy)
+					p.Composer.PromptUploadFiles(files)
+				}
+			})
+		})
+
+		return true
+	})
+
+	p.box.AddController(drop)
+}
+
+// readURIList reads the list of files in the given text/uri-list stream. Only
+// local files are returned.
+func readURIList(ctx context.Context, stream gio.InputStreamer) []gio.Filer {
+	r := gioutil.ReadCloser(gioutil.Reader(ctx, stream), gioutil.InputCloser(ctx, stream))
+	defer r.Close()
+
+	var files []gio.Filer
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// Lines starting with # are comments.
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		file := gio.NewFileForURI(line)
+		if file.Path() == "" {
+			continue
+		}
+
+		files = append(files, file)
+	}
+
+	return files
+}
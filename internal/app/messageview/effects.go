@@ -0,0 +1,285 @@
+package messageview
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/cairo"
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/effects"
+	"github.com/diamondburned/gotrix/event"
+)
+
+var showEffects = prefs.NewBool(true, prefs.PropMeta{
+	Name:    "Message Effects",
+	Section: "Text",
+	Description: "Play a short animation over the room, such as confetti, " +
+		"when a message with an effect arrives.",
+})
+
+const (
+	// effectDuration is how long an effect plays for, including fading out.
+	effectDuration = 4 * time.Second
+	// effectFadeIn is how long an effect takes to fade in, since some of its
+	// particles start out in the middle of the room.
+	effectFadeIn = 300 * time.Millisecond
+	// effectFadeOut is how long an effect takes to fade out at its end.
+	effectFadeOut = time.Second
+	// maxEffectAge is how old a message may be for its effect to be played,
+	// so that catching up on messages doesn't play a burst of effects.
+	maxEffectAge = time.Minute
+)
+
+// effectColors maps each effect to the colors that its particles are drawn in.
+var effectColors = map[event.MessageType][][3]float64{
+	effects.Confetti: {
+		{0.93, 0.26, 0.26}, // red
+		{0.98, 0.75, 0.18}, // yellow
+		{0.30, 0.73, 0.36}, // green
+		{0.24, 0.52, 0.90}, // blue
+		{0.67, 0.36, 0.86}, // purple
+	},
+	effects.Snowfall: {{0.80, 0.88, 1.00}},
+	effects.Hearts:   {{0.91, 0.23, 0.40}, {0.98, 0.45, 0.60}},
+	effects.Rainfall: {{0.45, 0.62, 0.88}},
+}
+
+type effectParticle struct {
+	x, y   float64
+	vx, vy float64
+	// angle and spin are the rotation and rotation speed of the particle in
+	// radians and radians per second.
+	angle, spin float64
+	// phase offsets the sway of snowflakes and hearts.
+	phase float64
+	size  float64
+	color [3]float64
+}
+
+// effectOverlay is the overlay over the messages that effects are played in.
+// It doesn't take any input, so it never gets in the way of the messages.
+type effectOverlay struct {
+	*gtk.DrawingArea
+	effect    event.MessageType
+	particles []effectParticle
+	// elapsed is how long the current effect has been playing for.
+	elapsed time.Duration
+	// last is the frame time of the last frame in microseconds.
+	last    int64
+	playing bool
+}
+
+func newEffectOverlay() *effectOverlay {
+	o := effectOverlay{DrawingArea: gtk.NewDrawingArea()}
+	o.AddCSSClass("messageview-effects")
+	o.SetCanTarget(false)
+	o.SetCanFocus(false)
+	o.SetDrawFunc(o.draw)
+	return &o
+}
+
+// play starts playing the given effect, replacing the one that's playing.
+func (o *effectOverlay) play(effect event.MessageType) {
+	o.effect = effect
+	o.elapsed = 0
+	o.last = 0
+	o.particles = newEffectParticles(effect, float64(o.Width()), float64(o.Height()))
+
+	if o.playing {
+		return
+	}
+
+	o.playing = true
+	o.AddTickCallback(func(_ gtk.Widgetter, clocker gdk.FrameClocker) bool {
+		now := gdk.BaseFrameClock(clocker).FrameTime()
+		if o.last != 0 {
+			o.step(time.Duration(now-o.last) * time.Microsecond)
+		}
+		o.last = now
+
+		if o.elapsed >= effectDuration || !showEffects.Value() {
+			o.stop()
+			return false
+		}
+
+		o.QueueDraw()
+		return true
+	})
+}
+
+func (o *effectOverlay) stop() {
+	o.playing = false
+	o.particles = nil
+	o.QueueDraw()
+}
+
+// newEffectParticles creates the particles of the given effect within an area
+// of the given size. Particles start out of the area, so that they come in
+// from its edge.
+func newEffectParticles(effect event.MessageType, w, h float64) []effectParticle {
+	colors := effectColors[effect]
+	if len(colors) == 0 {
+		return nil
+	}
+
+	random := func(min, max float64) float64 {
+		return min + rand.Float64()*(max-min)
+	}
+
+	var n int
+	switch effect {
+	case effects.Confetti:
+		n = 150
+	case effects.Snowfall:
+		n = 100
+	case effects.Hearts:
+		n = 30
+	case effects.Rainfall:
+		n = 200
+	}
+
+	particles := make([]effectParticle, n)
+	for i := range particles {
+		p := &particles[i]
+		p.x = random(0, w)
+		p.phase = random(0, 2*math.Pi)
+		p.color = colors[rand.Intn(len(colors))]
+
+		switch effect {
+		case effects.Confetti:
+			p.y = random(-h/2, 0)
+			p.vx = random(-60, 60)
+			p.vy = random(150, 350)
+			p.angle = random(0, 2*math.Pi)
+			p.spin = random(-8, 8)
+			p.size = random(5, 9)
+		case effects.Snowfall:
+			p.y = random(-h/3, h)
+			p.vy = random(30, 80)
+			p.size = random(2, 5)
+		case effects.Hearts:
+			p.y = random(h, h*1.5)
+			p.vy = random(-200, -100)
+			p.size = random(12, 24)
+		case effects.Rainfall:
+			p.y = random(-h, 0)
+			p.vx = -40
+			p.vy = random(600, 900)
+			p.size = random(10, 20)
+		}
+	}
+
+	return particles
+}
+
+// step moves the particles forward by the given time.
+func (o *effectOverlay) step(dt time.Duration) {
+	o.elapsed += dt
+	secs := dt.Seconds()
+	t := o.elapsed.Seconds()
+
+	for i := range o.particles {
+		p := &o.particles[i]
+		p.x += p.vx * secs
+		p.y += p.vy * secs
+		p.angle += p.spin * secs
+
+		switch o.effect {
+		case effects.Snowfall, effects.Hearts:
+			// Sway from side to side.
+			p.x += math.Sin(t*2+p.phase) * 20 * secs
+		case effects.Confetti:
+			// Slow down a little bit as if there's air resistance.
+			p.vx *= 1 - secs
+		}
+	}
+}
+
+func (o *effectOverlay) draw(_ *gtk.DrawingArea, cr *cairo.Context, width, height int) {
+	if len(o.particles) == 0 {
+		return
+	}
+
+	alpha := 1.0
+	if o.elapsed < effectFadeIn {
+		alpha = float64(o.elapsed) / float64(effectFadeIn)
+	}
+	if left := effectDuration - o.elapsed; left < effectFadeOut {
+		alpha = float64(left) / float64(effectFadeOut)
+	}
+
+	for _, p := range o.particles {
+		if p.x < -p.size || p.x > float64(width)+p.size {
+			continue
+		}
+		if p.y < -p.size || p.y > float64(height)+p.size {
+			continue
+		}
+
+		cr.SetSourceRGBA(p.color[0], p.color[1], p.color[2], alpha)
+
+		switch o.effect {
+		case effects.Confetti:
+			cr.Save()
+			cr.Translate(p.x, p.y)
+			cr.Rotate(p.angle)
+			cr.Rectangle(-p.size/2, -p.size/4, p.size, p.size/2)
+			cr.Fill()
+			cr.Restore()
+		case effects.Snowfall:
+			cr.NewSubPath()
+			cr.Arc(p.x, p.y, p.size, 0, 2*math.Pi)
+			cr.Fill()
+		case effects.Hearts:
+			drawHeart(cr, p.x, p.y, p.size)
+		case effects.Rainfall:
+			cr.SetLineWidth(1.5)
+			cr.MoveTo(p.x, p.y)
+			cr.LineTo(p.x+p.vx/p.vy*p.size, p.y+p.size)
+			cr.Stroke()
+		}
+	}
+}
+
+// drawHeart fills a heart of the given size centered at the given point. The
+// heart is a square standing on its corner with a half circle on each of its
+// upper sides.
+func drawHeart(cr *cairo.Context, x, y, size float64) {
+	side := size / 1.6
+
+	cr.Save()
+	cr.Translate(x, y)
+	cr.Rotate(math.Pi / 4)
+
+	cr.NewPath()
+	cr.Rectangle(-side/2, -side/2, side, side)
+	cr.NewSubPath()
+	cr.Arc(-side/2, 0, side/2, 0, 2*math.Pi)
+	cr.NewSubPath()
+	cr.Arc(0, -side/2, side/2, 0, 2*math.Pi)
+	cr.Fill()
+
+	cr.Restore()
+}
+
+// playEffect plays the effect of the given message, if it has one. It's only
+// called for new messages, and old ones that are caught up on are skipped.
+func (p *Page) playEffect(ev event.RoomEvent) {
+	if !showEffects.Value() {
+		return
+	}
+
+	msg, ok := ev.(*event.RoomMessageEvent)
+	if !ok || !effects.IsEffect(msg.MessageType) {
+		return
+	}
+
+	if time.Since(msg.OriginServerTime.Time()) > maxEffectAge {
+		return
+	}
+
+	p.effects.play(msg.MessageType)
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotkit/components/animations"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/a11y"
 )
 
 type extraRevealer struct {
@@ -33,10 +34,15 @@ func newExtraRevealer() *extraRevealer {
 	l.SetXAlign(0)
 	l.AddCSSClass("messageview-extralabel")
 
+	dots := animations.NewBreathingDots()
+
 	b := gtk.NewBox(gtk.OrientationHorizontal, 0)
-	b.Append(animations.NewBreathingDots())
+	b.Append(dots)
 	b.Append(l)
 
+	// The dots don't mean much when they're still.
+	a11y.Subscribe(b, func() { gtk.BaseWidget(dots).SetVisible(!a11y.ReduceMotion()) })
+
 	r := gtk.NewRevealer()
 	r.SetChild(b)
 	r.SetCanTarget(false)
@@ -0,0 +1,116 @@
+package messageview
+
+import (
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var hiddenCSS = cssutil.Applier("messageview-hidden", `
+	.messageview-hidden {
+		margin: 2px 4px;
+		font-size: 0.9em;
+	}
+	.messageview-msglist > row.messageview-hiddenrow {
+		opacity: 0.5;
+	}
+`)
+
+// hiddenIndex keeps track of the messages within a page that the user has
+// hidden locally.
+type hiddenIndex struct {
+	// toggle is the "N hidden messages" button that reveals hidden messages.
+	toggle *gtk.ToggleButton
+	// events is the set of loaded events that are hidden.
+	events map[matrix.EventID]messageKey
+	// shown is true if the hidden messages are currently revealed.
+	shown bool
+}
+
+func newHiddenIndex() hiddenIndex {
+	return hiddenIndex{
+		events: make(map[matrix.EventID]messageKey),
+	}
+}
+
+// isHidden returns true if the row with the given key should be filtered away
+// because the user hid it.
+func (h *hiddenIndex) isHidden(key messageKey) bool {
+	if h.shown || !key.IsEvent() {
+		return false
+	}
+	_, hidden := h.events[key.EventID()]
+	return hidden
+}
+
+func (p *Page) newHiddenToggle() *gtk.ToggleButton {
+	toggle := gtk.NewToggleButton()
+	toggle.SetHAlign(gtk.AlignCenter)
+	toggle.SetHasFrame(false)
+	toggle.Hide()
+	toggle.ConnectToggled(func() {
+		p.hidden.shown = toggle.Active()
+		p.invalidateHidden()
+	})
+	hiddenCSS(toggle)
+
+	return toggle
+}
+
+// addHidden registers the message with the given key if the user has hidden
+// it before.
+func (p *Page) addHidden(key messageKey, ev event.RoomEvent) {
+	id := ev.RoomInfo().ID
+	if !p.parent.client.Offline().EventIsHidden(p.roomID, id) {
+		return
+	}
+
+	p.hidden.events[id] = key
+	p.invalidateHidden()
+}
+
+// invalidateHidden updates the hidden messages toggle and refilters the list.
+func (p *Page) invalidateHidden() {
+	for _, key := range p.hidden.events {
+		if msg, ok := p.messages[key]; ok {
+			if p.hidden.shown {
+				msg.row.AddCSSClass("messageview-hiddenrow")
+			} else {
+				msg.row.RemoveCSSClass("messageview-hiddenrow")
+			}
+		}
+	}
+
+	n := len(p.hidden.events)
+	if n > 0 {
+		p.hidden.toggle.SetLabel(locale.Plural(
+			p.ctx.Take(), "%d hidden message", "%d hidden messages", n,
+		))
+		p.hidden.toggle.Show()
+	} else {
+		p.hidden.shown = false
+		p.hidden.toggle.SetActive(false)
+		p.hidden.toggle.Hide()
+	}
+
+	p.list.InvalidateFilter()
+}
+
+// SetHidden implements message.MessageViewer. The hidden state is persisted, so
+// the message stays hidden the next time the room is opened.
+func (p *Page) SetHidden(eventID matrix.EventID, hidden bool) {
+	p.parent.client.SetEventHidden(p.roomID, eventID, hidden)
+
+	if hidden {
+		p.hidden.events[eventID] = messageKeyEventID(eventID)
+	} else {
+		if msg, ok := p.messages[messageKeyEventID(eventID)]; ok {
+			msg.row.RemoveCSSClass("messageview-hiddenrow")
+		}
+		delete(p.hidden.events, eventID)
+	}
+
+	p.invalidateHidden()
+}
@@ -12,6 +12,9 @@ type loadMoreButton struct {
 
 	errRev *gtk.Revealer
 	error  *adaptive.ErrorLabel
+
+	notice    *gtk.Label
+	endNotice func() string
 }
 
 type paginateDoneFunc func(hasMore bool, err error)
@@ -21,10 +24,17 @@ var loadMoreCSS = cssutil.Applier("messageview-loadmore", `
 		margin: 4px;
 		margin-top: 50px;
 	}
+	.messageview-loadmore-notice {
+		margin: 6px 12px;
+		color: alpha(@theme_fg_color, 0.65);
+		font-size: 0.9em;
+	}
 `)
 
-func newLoadMore(loadMore func(done paginateDoneFunc)) *loadMoreButton {
-	b := &loadMoreButton{}
+// newLoadMore creates a new load more button. Once there's nothing more to
+// load, the button is replaced with the notice returned by endNotice.
+func newLoadMore(loadMore func(done paginateDoneFunc), endNotice func() string) *loadMoreButton {
+	b := &loadMoreButton{endNotice: endNotice}
 	b.button = gtk.NewButtonWithLabel("More")
 	b.button.AddCSSClass("messageview-loadmore-button")
 	b.button.SetHAlign(gtk.AlignCenter)
@@ -39,12 +49,19 @@ func newLoadMore(loadMore func(done paginateDoneFunc)) *loadMoreButton {
 		})
 	})
 
+	b.notice = gtk.NewLabel("")
+	b.notice.AddCSSClass("messageview-loadmore-notice")
+	b.notice.SetWrap(true)
+	b.notice.SetJustify(gtk.JustifyCenter)
+	b.notice.Hide()
+
 	b.errRev = gtk.NewRevealer()
 	b.errRev.SetTransitionType(gtk.RevealerTransitionTypeSlideDown)
 	b.errRev.SetRevealChild(false)
 
 	b.Box = gtk.NewBox(gtk.OrientationVertical, 0)
 	b.Box.Append(b.button)
+	b.Box.Append(b.notice)
 	b.Box.Append(b.errRev)
 	loadMoreCSS(b)
 
@@ -62,6 +79,13 @@ func (b *loadMoreButton) setError(err error) {
 func (b *loadMoreButton) done(hasMore bool) {
 	b.button.SetSensitive(hasMore)
 
+	// Explain why the scrollback ended instead of leaving a dead button.
+	if !hasMore && b.endNotice != nil {
+		b.notice.SetText(b.endNotice())
+		b.notice.Show()
+		b.button.Hide()
+	}
+
 	b.errRev.SetRevealChild(false)
 	b.errRev.SetChild(nil)
 
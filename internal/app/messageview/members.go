@@ -0,0 +1,459 @@
+package messageview
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/components/onlineimage"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
+	"github.com/diamondburned/gotktrix/internal/app/roomdialog"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+var showMembers = prefs.NewBool(false, prefs.PropMeta{
+	Name:        "Show Members",
+	Section:     "Rooms",
+	Description: "Show the members of the room beside its messages.",
+})
+
+const memberAvatarSize = 24
+
+var memberPaneCSS = cssutil.Applier("messageview-members", `
+	.messageview-members {
+		border-left: 1px solid @borders;
+	}
+	.messageview-members list {
+		background: none;
+	}
+	.messageview-members row {
+		padding: 2px 8px;
+	}
+	.messageview-member-group {
+		margin: 8px 8px 2px 8px;
+		font-size: 0.85em;
+		font-weight: bold;
+		color: alpha(@theme_fg_color, 0.75);
+	}
+	.messageview-member-presence {
+		min-width: 8px;
+		min-height: 8px;
+		border-radius: 9999px;
+	}
+	.messageview-member-online {
+		background-color: @success_color;
+	}
+	.messageview-member-unavailable {
+		background-color: @warning_color;
+	}
+	.messageview-member-offline {
+		background-color: alpha(@theme_fg_color, 0.25);
+	}
+`)
+
+// memberGroup is the group that a member is listed under, which depends on
+// their power level.
+type memberGroup uint8
+
+const (
+	memberGroupAdmins memberGroup = iota
+	memberGroupModerators
+	memberGroupMembers
+)
+
+func memberGroupOf(level int) memberGroup {
+	switch {
+	case level >= 100:
+		return memberGroupAdmins
+	case level >= 50:
+		return memberGroupModerators
+	default:
+		return memberGroupMembers
+	}
+}
+
+func (g memberGroup) label(ctx context.Context) string {
+	switch g {
+	case memberGroupAdmins:
+		return locale.S(ctx, "Admins")
+	case memberGroupModerators:
+		return locale.S(ctx, "Moderators")
+	default:
+		return locale.S(ctx, "Members")
+	}
+}
+
+// roomMember is a joined member of the room.
+type roomMember struct {
+	ID     matrix.UserID
+	Name   string
+	Avatar matrix.URL
+	Level  int
+}
+
+// memberPane is the sidebar that lists the joined members of the page's room.
+// The members are only fetched once the pane is first revealed.
+type memberPane struct {
+	*gtk.Revealer
+	list  *gtk.ListBox
+	count *gtk.Label
+
+	ctx  context.Context
+	page *Page
+	rows map[matrix.UserID]*memberRow
+
+	loaded bool
+	// queued is true if a reload is already queued.
+	queued bool
+}
+
+type memberRow struct {
+	*gtk.ListBoxRow
+	avatar   *onlineimage.Avatar
+	name     *gtk.Label
+	presence *gtk.Box
+	member   roomMember
+}
+
+func newMemberPane(p *Page) *memberPane {
+	m := memberPane{
+		ctx:  p.roomCtx,
+		page: p,
+		rows: make(map[matrix.UserID]*memberRow),
+	}
+
+	title := gtk.NewLabel(locale.S(m.ctx, "Members"))
+	title.SetXAlign(0)
+
+	m.count = gtk.NewLabel("")
+	m.count.SetHExpand(true)
+	m.count.SetXAlign(0)
+	m.count.AddCSSClass("dim-label")
+
+	closeMembers := gtk.NewButtonFromIconName("window-close-symbolic")
+	closeMembers.SetHasFrame(false)
+	closeMembers.SetTooltipText(locale.S(m.ctx, "Hide Members"))
+	closeMembers.ConnectClicked(func() { showMembers.Publish(false) })
+
+	header := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	header.AddCSSClass("messageview-split-header")
+	header.Append(title)
+	header.Append(m.count)
+	header.Append(closeMembers)
+
+	m.list = gtk.NewListBox()
+	m.list.SetSelectionMode(gtk.SelectionNone)
+	m.list.SetSortFunc(func(r1, r2 *gtk.ListBoxRow) int {
+		m1, ok1 := m.rows[matrix.UserID(r1.Name())]
+		m2, ok2 := m.rows[matrix.UserID(r2.Name())]
+		if !ok1 || !ok2 {
+			return 0
+		}
+		return compareMembers(m1.member, m2.member)
+	})
+	m.list.SetHeaderFunc(func(row, before *gtk.ListBoxRow) {
+		r, ok := m.rows[matrix.UserID(row.Name())]
+		if !ok {
+			return
+		}
+
+		group := memberGroupOf(r.member.Level)
+		if before != nil {
+			if b, ok := m.rows[matrix.UserID(before.Name())]; ok && memberGroupOf(b.member.Level) == group {
+				row.SetHeader(nil)
+				return
+			}
+		}
+
+		label := gtk.NewLabel(group.label(m.ctx))
+		label.SetXAlign(0)
+		label.AddCSSClass("messageview-member-group")
+		row.SetHeader(label)
+	})
+	m.list.ConnectRowActivated(func(row *gtk.ListBoxRow) {
+		mauthor.ShowProfilePopover(m.ctx, row, p.roomID, matrix.UserID(row.Name()), p)
+	})
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(m.list)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.SetSizeRequest(220, -1)
+	box.Append(header)
+	box.Append(scroll)
+	splitCSS(box)
+	memberPaneCSS(box)
+
+	m.Revealer = gtk.NewRevealer()
+	m.Revealer.SetTransitionType(gtk.RevealerTransitionTypeSlideLeft)
+	m.Revealer.SetChild(box)
+
+	showMembers.SubscribeWidget(m, func() {
+		shown := showMembers.Value()
+		m.SetRevealChild(shown)
+		if shown && !m.loaded {
+			m.loaded = true
+			m.load()
+		}
+	})
+
+	client := gotktrix.FromContext(m.ctx)
+
+	gtkutil.BindSubscribe(m, func() func() {
+		types := []event.Type{event.TypeRoomMember, event.TypeRoomPowerLevels}
+		return client.SubscribeRoomEvents(p.roomID, types, func() {
+			glib.IdleAdd(m.queueLoad)
+		})
+	})
+
+	gtkutil.BindSubscribe(m, func() func() {
+		return client.SubscribeUser(event.TypePresence, func(e event.Event) {
+			ev, ok := e.(*event.PresenceEvent)
+			if !ok {
+				return
+			}
+			glib.IdleAdd(func() {
+				if r, ok := m.rows[ev.User]; ok {
+					r.setPresence(ev.Presence)
+				}
+			})
+		})
+	})
+
+	return &m
+}
+
+func compareMembers(m1, m2 roomMember) int {
+	g1 := memberGroupOf(m1.Level)
+	g2 := memberGroupOf(m2.Level)
+	if g1 != g2 {
+		if g1 < g2 {
+			return -1
+		}
+		return 1
+	}
+
+	return strings.Compare(strings.ToLower(m1.Name), strings.ToLower(m2.Name))
+}
+
+// queueLoad reloads the members once the main loop is idle, so that many member
+// events at once only reload them once. Nothing is done if the pane has never
+// been shown.
+func (m *memberPane) queueLoad() {
+	if !m.loaded || m.queued {
+		return
+	}
+
+	m.queued = true
+	glib.IdleAdd(func() {
+		m.queued = false
+		m.load()
+	})
+}
+
+// load fetches the joined members and their power levels.
+func (m *memberPane) load() {
+	client := gotktrix.FromContext(m.ctx)
+	roomID := m.page.roomID
+
+	gtkutil.Async(m.ctx, func() func() {
+		// The page already shows an error if the members can't be fetched, so
+		// just list the ones that are known.
+		client.RoomEnsureMembers(roomID)
+
+		events, err := client.RoomMembers(roomID)
+		if err != nil {
+			return func() { app.Error(m.ctx, errors.Wrap(err, "failed to get members")) }
+		}
+
+		members := make([]roomMember, 0, len(events))
+		userIDs := make([]matrix.UserID, 0, len(events))
+
+		for _, ev := range events {
+			if ev.NewState != event.MemberJoined {
+				continue
+			}
+			members = append(members, roomMember{ID: ev.UserID, Avatar: ev.AvatarURL})
+			userIDs = append(userIDs, ev.UserID)
+		}
+
+		names, err := client.MemberNames(roomID, userIDs, true)
+		if err != nil {
+			names = nil
+		}
+
+		var levels *event.RoomPowerLevelsEvent
+		if e, err := client.RoomState(roomID, event.TypeRoomPowerLevels, ""); err == nil {
+			levels = e.(*event.RoomPowerLevelsEvent)
+		}
+
+		for i := range members {
+			members[i].Name = string(members[i].ID)
+			if names != nil {
+				members[i].Name = names[i].Name
+			}
+
+			if levels != nil {
+				members[i].Level = levels.UserDefault
+				if level, ok := levels.UserLevel[members[i].ID]; ok {
+					members[i].Level = level
+				}
+			}
+		}
+
+		sort.Slice(members, func(i, j int) bool {
+			return compareMembers(members[i], members[j]) < 0
+		})
+
+		return func() { m.setMembers(members) }
+	})
+}
+
+// setMembers updates the list to have exactly the given members.
+func (m *memberPane) setMembers(members []roomMember) {
+	joined := make(map[matrix.UserID]bool, len(members))
+
+	for _, member := range members {
+		joined[member.ID] = true
+
+		r, ok := m.rows[member.ID]
+		if !ok {
+			r = m.newRow(member.ID)
+			m.rows[member.ID] = r
+			m.list.Append(r)
+		}
+		r.update(member)
+	}
+
+	for id, r := range m.rows {
+		if !joined[id] {
+			m.list.Remove(r)
+			delete(m.rows, id)
+		}
+	}
+
+	m.list.InvalidateSort()
+	m.list.InvalidateHeaders()
+
+	m.count.SetText(locale.Sprintf(m.ctx, "%d", len(members)))
+}
+
+func (m *memberPane) newRow(userID matrix.UserID) *memberRow {
+	r := memberRow{}
+
+	r.avatar = onlineimage.NewAvatar(m.ctx, gotktrix.AvatarProvider, memberAvatarSize)
+	r.avatar.SetInitials(string(userID))
+
+	r.name = gtk.NewLabel(string(userID))
+	r.name.SetHExpand(true)
+	r.name.SetXAlign(0)
+	r.name.SetEllipsize(pango.EllipsizeEnd)
+
+	r.presence = gtk.NewBox(gtk.OrientationHorizontal, 0)
+	r.presence.SetVAlign(gtk.AlignCenter)
+	r.presence.AddCSSClass("messageview-member-presence")
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	box.Append(r.avatar)
+	box.Append(r.name)
+	box.Append(r.presence)
+
+	r.ListBoxRow = gtk.NewListBoxRow()
+	r.ListBoxRow.SetName(string(userID))
+	r.ListBoxRow.SetTooltipText(string(userID))
+	r.ListBoxRow.SetChild(box)
+
+	gtkutil.BindPopoverMenuLazy(r, gtk.PosLeft, func() []gtkutil.PopoverMenuItem {
+		return m.menu(&r)
+	})
+
+	client := gotktrix.FromContext(m.ctx)
+	r.setPresence(client.UserPresence(userID))
+
+	return &r
+}
+
+func (r *memberRow) update(member roomMember) {
+	if r.member.Avatar != member.Avatar {
+		r.avatar.SetFromURL(string(member.Avatar))
+	}
+
+	r.member = member
+	r.avatar.SetInitials(member.Name)
+	r.name.SetText(member.Name)
+}
+
+var presenceClasses = map[matrix.Presence]string{
+	matrix.PresenceOnline:  "messageview-member-online",
+	matrix.PresenceIdle:    "messageview-member-unavailable",
+	matrix.PresenceOffline: "messageview-member-offline",
+}
+
+// setPresence shows the given presence. The dot is hidden if the presence is
+// unknown.
+func (r *memberRow) setPresence(presence matrix.Presence) {
+	for _, class := range presenceClasses {
+		r.presence.RemoveCSSClass(class)
+	}
+
+	class, ok := presenceClasses[presence]
+	r.presence.SetVisible(ok)
+	if ok {
+		r.presence.AddCSSClass(class)
+	}
+}
+
+// menu returns the menu of the given member. The actions are bound to the row.
+func (m *memberPane) menu(r *memberRow) []gtkutil.PopoverMenuItem {
+	client := gotktrix.FromContext(m.ctx).Offline()
+	roomID := m.page.roomID
+	userID := r.member.ID
+
+	isSelf := userID == client.UserID
+	canMention := !isSelf && client.CanSendEvent(roomID, event.TypeRoomMessage, false)
+	canKick := client.ExplainAction(roomID, gotktrix.KickAction, userID).Allowed
+	canBan := client.ExplainAction(roomID, gotktrix.BanAction, userID).Allowed
+
+	isMuted := client.IsMuted(roomID, userID)
+	canMute := client.CanMute(roomID, userID, !isMuted)
+
+	muteLabel := locale.S(m.ctx, "Mu_te")
+	if isMuted {
+		muteLabel = locale.S(m.ctx, "Unmu_te")
+	}
+
+	gtkutil.BindActionMap(r, map[string]func(){
+		"member.mention":        func() { m.page.MentionUser(userID) },
+		"member.direct-message": func() { m.page.DirectMessage(userID) },
+		"member.mute":           func() { roomdialog.SetMuted(m.ctx, roomID, userID, !isMuted) },
+		"member.kick":           func() { roomdialog.Moderate(m.ctx, roomID, userID, gotktrix.KickAction) },
+		"member.ban":            func() { roomdialog.Moderate(m.ctx, roomID, userID, gotktrix.BanAction) },
+		"member.copy-id": func() {
+			display := gtk.BaseWidget(r).Display()
+			display.Clipboard().SetText(string(userID))
+		},
+	})
+
+	return []gtkutil.PopoverMenuItem{
+		gtkutil.MenuItem(locale.S(m.ctx, "_Mention"), "member.mention", canMention),
+		gtkutil.MenuItem(locale.S(m.ctx, "_Direct Message"), "member.direct-message", !isSelf),
+		gtkutil.MenuItem(locale.S(m.ctx, "Copy User _ID"), "member.copy-id"),
+		gtkutil.MenuSeparator(""),
+		gtkutil.MenuItem(muteLabel, "member.mute", canMute),
+		gtkutil.MenuItem(locale.S(m.ctx, "_Kick..."), "member.kick", canKick),
+		gtkutil.MenuItem(locale.S(m.ctx, "_Ban..."), "member.ban", canBan),
+	}
+}
@@ -0,0 +1,54 @@
+package message
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/app/prefs/kvstate"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// roomAccents is published every time a room's accent color is changed.
+var roomAccents = prefs.NewPubsub()
+
+func acquireAccentConfig(ctx context.Context) *kvstate.Config {
+	uID := gotktrix.FromContext(ctx).UserID
+	return kvstate.AcquireConfig(ctx, "messages", gotktrix.Base64UserID(uID), "accent.json")
+}
+
+// RoomAccent returns the accent color of the given room, or nil if the room
+// doesn't have one.
+func RoomAccent(ctx context.Context, roomID matrix.RoomID) *gdk.RGBA {
+	var color string
+	if !acquireAccentConfig(ctx).Get(string(roomID), &color) {
+		return nil
+	}
+
+	rgba := gdk.NewRGBA(0, 0, 0, 1)
+	if !rgba.Parse(color) {
+		return nil
+	}
+
+	return &rgba
+}
+
+// SetRoomAccent sets the accent color of the given room. A nil color removes
+// it.
+func SetRoomAccent(ctx context.Context, roomID matrix.RoomID, color *gdk.RGBA) {
+	cfg := acquireAccentConfig(ctx)
+	if color == nil {
+		cfg.Delete(string(roomID))
+	} else {
+		cfg.Set(string(roomID), color.String())
+	}
+	roomAccents.Publish()
+}
+
+// SubscribeAccent calls f every time the accent color of any room may have
+// changed, for as long as the given widget is mapped.
+func SubscribeAccent(w gtk.Widgetter, f func()) {
+	roomAccents.SubscribeWidget(w, f)
+}
@@ -0,0 +1,171 @@
+package message
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/onlineimage"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/ctxutil"
+	"github.com/diamondburned/gotrix/event"
+)
+
+// bubbleMessage is a message shown in a bubble. The user's own messages are
+// right-aligned, and consecutive messages from the same sender are grouped by
+// only showing the avatar and name on the first one.
+type bubbleMessage struct {
+	*gtk.Box
+	*message
+	bubble *gtk.Box
+	// avatar and sender are nil if the message is the user's own or part of a
+	// group.
+	avatar *onlineimage.Avatar
+	sender *gtk.Label
+}
+
+var bubbleCSS = cssutil.Applier("message-bubble", `
+	.message-bubble {
+		padding-top:    2px;
+		padding-bottom: 2px;
+		padding-left:   8px;
+	}
+	.message-bubble-first {
+		padding-top: 6px;
+	}
+	.message-bubble-body {
+		padding: 4px 10px;
+		border-radius: 12px;
+		background-color: alpha(@theme_fg_color, 0.06);
+	}
+	.message-bubble-own .message-bubble-body {
+		background-color: alpha(@theme_selected_bg_color, 0.35);
+	}
+	.message-bubble-body > .message-timestamp {
+		font-size: 0.7em;
+		margin-top: 2px;
+	}
+`)
+
+func (v messageViewer) bubbleMessage(ev *event.RoomMessageEvent, grouped bool) *bubbleMessage {
+	client := v.client().Offline()
+	own := ev.Sender == client.UserID
+
+	msg := bubbleMessage{}
+	msg.message = v.newMessage(ev, false)
+	msg.timestamp.SetXAlign(1)
+
+	msg.bubble = gtk.NewBox(gtk.OrientationVertical, 0)
+	msg.bubble.AddCSSClass("message-bubble-body")
+
+	if !own && !grouped {
+		msg.sender = gtk.NewLabel("")
+		msg.sender.SetXAlign(0)
+		msg.sender.SetTooltipText(string(ev.Sender))
+		msg.sender.SetSingleLineMode(true)
+		msg.sender.SetEllipsize(pango.EllipsizeEnd)
+		msg.sender.SetMarkup(mauthor.Markup(
+			client, ev.RoomID, ev.Sender,
+			mauthor.WithWidgetColor(),
+		))
+		msg.bubble.Append(msg.sender)
+
+		mauthor.BindProfilePopover(v, msg.sender, ev.RoomID, ev.Sender, v)
+	}
+
+	msg.bubble.Append(msg.content)
+	msg.bubble.Append(msg.timestamp)
+
+	msg.Box = gtk.NewBox(gtk.OrientationHorizontal, 0)
+
+	switch {
+	case own:
+		msg.bubble.SetHAlign(gtk.AlignEnd)
+		msg.bubble.SetHExpand(true)
+		msg.AddCSSClass("message-bubble-own")
+	case grouped:
+		spacer := gtk.NewBox(gtk.OrientationHorizontal, 0)
+		spacer.SetSizeRequest(avatarSize, -1)
+		spacer.SetMarginEnd(8)
+		msg.Box.Append(spacer)
+	default:
+		msg.avatar = onlineimage.NewAvatar(v, gotktrix.AvatarProvider, avatarSize)
+		msg.avatar.ConnectLabel(msg.sender)
+		msg.avatar.SetVAlign(gtk.AlignStart)
+		msg.avatar.SetMarginEnd(8)
+		msg.avatar.SetTooltipText(string(ev.Sender))
+
+		mxc, _ := client.MemberAvatar(ev.RoomID, ev.Sender)
+		if mxc != nil {
+			msg.avatar.SetFromURL(string(*mxc))
+		}
+
+		mauthor.BindProfilePopover(v, msg.avatar, ev.RoomID, ev.Sender, v)
+		msg.Box.Append(msg.avatar)
+	}
+
+	if !own {
+		msg.bubble.SetHAlign(gtk.AlignStart)
+		msg.bubble.SetMarginEnd(avatarWidth)
+	} else {
+		msg.bubble.SetMarginStart(avatarWidth)
+	}
+
+	if !grouped {
+		msg.AddCSSClass("message-bubble-first")
+	}
+
+	msg.Box.Append(msg.bubble)
+	messageCSS(msg)
+	bubbleCSS(msg)
+
+	bindParent(v, msg, msg.content)
+	return &msg
+}
+
+func (m *bubbleMessage) SetBlur(blur bool) {
+	m.message.setBlur(m, blur)
+}
+
+func (m *bubbleMessage) OnRelatedEvent(ev event.RoomEvent) bool {
+	ok := m.message.OnRelatedEvent(ev)
+
+	_, edited := m.content.EditedTimestamp()
+	if edited {
+		m.timestamp.SetText(locale.Sprintf(m.parent, "%s (edited)",
+			formatTime(m.Event().RoomInfo().OriginServerTime.Time(), false)))
+	}
+
+	return ok
+}
+
+func (m *bubbleMessage) LoadMore() {
+	m.asyncFetch()
+	m.message.LoadMore()
+}
+
+func (m *bubbleMessage) asyncFetch() {
+	if m.sender == nil {
+		return
+	}
+
+	opt := mauthor.WithWidgetColor()
+
+	roomEv := m.parent.event.RoomInfo()
+	ctxutil.Async(m.parent, m, func(ctx context.Context) func() {
+		client := gotktrix.FromContext(ctx)
+
+		markup := mauthor.Markup(client, roomEv.RoomID, roomEv.Sender, opt)
+		mxc, _ := client.MemberAvatar(roomEv.RoomID, roomEv.Sender)
+
+		return func() {
+			m.sender.SetMarkup(markup)
+			if mxc != nil {
+				m.avatar.SetFromURL(string(*mxc))
+			}
+		}
+	})
+}
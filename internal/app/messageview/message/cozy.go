@@ -1,13 +1,15 @@
 package message
 
 import (
-	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"context"
+
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotk4/pkg/pango"
 	"github.com/diamondburned/gotkit/components/onlineimage"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/ctxutil"
 	"github.com/diamondburned/gotrix/event"
 )
 
@@ -63,6 +65,9 @@ func (v messageViewer) cozyMessage(ev *event.RoomMessageEvent) *cozyMessage {
 		msg.avatar.SetFromURL(string(*mxc))
 	}
 
+	mauthor.BindProfilePopover(v, msg.sender, ev.RoomID, ev.Sender, v)
+	mauthor.BindProfilePopover(v, msg.avatar, ev.RoomID, ev.Sender, v)
+
 	authorTsBox := gtk.NewBox(gtk.OrientationHorizontal, 0)
 	authorTsBox.Append(msg.sender)
 	authorTsBox.Append(msg.timestamp)
@@ -95,13 +100,17 @@ func (m *cozyMessage) asyncFetch() {
 	opt := mauthor.WithWidgetColor()
 
 	roomEv := m.parent.event.RoomInfo()
-	go func() {
-		markup := mauthor.Markup(m.parent.client(), roomEv.RoomID, roomEv.Sender, opt)
-		glib.IdleAdd(func() { m.sender.SetMarkup(markup) })
+	ctxutil.Async(m.parent, m, func(ctx context.Context) func() {
+		client := gotktrix.FromContext(ctx)
+
+		markup := mauthor.Markup(client, roomEv.RoomID, roomEv.Sender, opt)
+		mxc, _ := client.MemberAvatar(roomEv.RoomID, roomEv.Sender)
 
-		mxc, _ := m.parent.client().MemberAvatar(roomEv.RoomID, roomEv.Sender)
-		if mxc != nil {
-			glib.IdleAdd(func() { m.avatar.SetFromURL(string(*mxc)) })
+		return func() {
+			m.sender.SetMarkup(markup)
+			if mxc != nil {
+				m.avatar.SetFromURL(string(*mxc))
+			}
 		}
-	}()
+	})
 }
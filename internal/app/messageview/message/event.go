@@ -12,7 +12,11 @@ import (
 	"github.com/diamondburned/gotkit/gtkutil"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mcontent/text"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/encryption"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/poll"
 	"github.com/diamondburned/gotktrix/internal/gotktrix/events/sys"
 	"github.com/diamondburned/gotrix/event"
 	"github.com/diamondburned/gotrix/matrix"
@@ -120,8 +124,17 @@ func RenderEvent(ctx context.Context, ev event.RoomEvent) string {
 
 	switch ev := ev.(type) {
 	case *event.RoomMessageEvent:
-		// TODO: light HTML renderer to Pango markup.
-		return fmt.Sprintf(`%s: <span alpha="80%%">%s</span>`, r.sender(), html.EscapeString(ev.Body))
+		return messageEvent(r, p, ev)
+	case *m.ReactionEvent:
+		return p.Sprintf("%s reacted with %s.", r.sender(), html.EscapeString(ev.RelatesTo.Key))
+	case *event.RoomRedactionEvent:
+		return p.Sprintf("%s deleted a message.", r.sender())
+	case *poll.StartEvent:
+		return p.Sprintf("%s started a poll: <i>%s</i>", r.sender(), html.EscapeString(ev.Poll.Question.Text))
+	case *poll.ResponseEvent:
+		return p.Sprintf("%s voted in a poll.", r.sender())
+	case *poll.EndEvent:
+		return p.Sprintf("%s ended a poll.", r.sender())
 	case *event.RoomCreateEvent:
 		return p.Sprintf("%s created this room.", r.sender())
 	case *event.RoomPowerLevelsEvent:
@@ -132,6 +145,8 @@ func RenderEvent(ctx context.Context, ev event.RoomEvent) string {
 			return p.Sprintf("%s made the room public.", r.sender())
 		case event.JoinInvite:
 			return p.Sprintf("%s made the room invite-only.", r.sender())
+		case gotktrix.JoinRestricted:
+			return p.Sprintf("%s let the members of the room's spaces join.", r.sender())
 		default:
 			return p.Sprintf("%s changed the join rule to %q.", r.sender(), ev.JoinRule)
 		}
@@ -161,6 +176,10 @@ func RenderEvent(ctx context.Context, ev event.RoomEvent) string {
 		return p.Sprintf("%s changed the room's name to <i>%s</i>.", r.sender(), html.EscapeString(ev.Name))
 	case *event.RoomTopicEvent:
 		return p.Sprintf("%s changed the room's topic to <i>%s</i>.", r.sender(), html.EscapeString(ev.Topic))
+	case *encryption.Event:
+		return p.Sprintf("%s enabled end-to-end encryption.", r.sender())
+	case *encryption.EncryptedEvent:
+		return p.Sprintf("%s sent an encrypted message that couldn't be decrypted.", r.sender())
 	case *sys.ErroneousEvent:
 		return p.Sprintf(
 			`%s sent an unusual event: <span color="red">%v</span>.`,
@@ -171,6 +190,34 @@ func RenderEvent(ctx context.Context, ev event.RoomEvent) string {
 	}
 }
 
+func messageEvent(r eventRenderer, p *locale.Printer, ev *event.RoomMessageEvent) string {
+	var relatesTo struct {
+		RelType m.RelType `json:"rel_type"`
+	}
+	json.Unmarshal(ev.RelatesTo, &relatesTo)
+
+	if relatesTo.RelType == m.Replace {
+		return p.Sprintf("%s edited a message.", r.sender())
+	}
+
+	switch ev.MessageType {
+	case event.RoomMessageImage:
+		return p.Sprintf("%s sent a photo.", r.sender())
+	case event.RoomMessageVideo:
+		return p.Sprintf("%s sent a video.", r.sender())
+	case event.RoomMessageAudio:
+		return p.Sprintf("%s sent an audio clip.", r.sender())
+	case event.RoomMessageFile:
+		return p.Sprintf("%s sent a file.", r.sender())
+	case event.RoomMessageLocation:
+		return p.Sprintf("%s shared a location.", r.sender())
+	case event.RoomMessageEmote:
+		return fmt.Sprintf(`* %s <span alpha="80%%">%s</span>`, r.sender(), html.EscapeString(text.RenderPreview(ev)))
+	default:
+		return fmt.Sprintf(`%s: <span alpha="80%%">%s</span>`, r.sender(), html.EscapeString(text.RenderPreview(ev)))
+	}
+}
+
 var emptyRoomMember = &event.RoomMemberEvent{}
 
 func memberEvent(r eventRenderer, ev *event.RoomMemberEvent) string {
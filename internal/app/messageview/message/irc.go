@@ -0,0 +1,96 @@
+package message
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mcontent"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/ctxutil"
+	"github.com/diamondburned/gotrix/event"
+)
+
+// ircMessage is a dense message that shows the timestamp, sender and body on a
+// single line, like IRC clients do. Media is shown as links.
+type ircMessage struct {
+	*gtk.Box
+	*message
+	sender *gtk.Label
+}
+
+// ircSenderWidth is the width of the sender column, so that the message bodies
+// line up.
+const ircSenderWidth = 120
+
+var ircCSS = cssutil.Applier("message-irc", `
+	.message-irc {
+		padding: 1px 0 1px 8px;
+	}
+	.message-irc > .message-timestamp {
+		margin-right: 8px;
+		font-family: monospace;
+	}
+	.message-irc-sender {
+		margin-right: 8px;
+	}
+`)
+
+func (v messageViewer) ircMessage(ev *event.RoomMessageEvent) *ircMessage {
+	client := v.client().Offline()
+
+	msg := ircMessage{}
+	msg.message = v.newMessageWithContent(ev, false, mcontent.NewCompact(v.Context, ev))
+	msg.timestamp.SetVAlign(gtk.AlignStart)
+	msg.timestamp.SetYAlign(0)
+
+	msg.sender = gtk.NewLabel("")
+	msg.sender.AddCSSClass("message-irc-sender")
+	msg.sender.SetTooltipText(string(ev.Sender))
+	msg.sender.SetSingleLineMode(true)
+	msg.sender.SetEllipsize(pango.EllipsizeEnd)
+	msg.sender.SetSizeRequest(ircSenderWidth, -1)
+	msg.sender.SetXAlign(1)
+	msg.sender.SetVAlign(gtk.AlignStart)
+	msg.sender.SetMarkup(mauthor.Markup(
+		client, ev.RoomID, ev.Sender,
+		mauthor.WithWidgetColor(),
+		mauthor.WithMinimal(),
+	))
+	mauthor.BindProfilePopover(v, msg.sender, ev.RoomID, ev.Sender, v)
+
+	msg.Box = gtk.NewBox(gtk.OrientationHorizontal, 0)
+	msg.Box.Append(msg.timestamp)
+	msg.Box.Append(msg.sender)
+	msg.Box.Append(msg.content)
+
+	messageCSS(msg)
+	ircCSS(msg)
+
+	bindParent(v, msg, msg.content)
+	return &msg
+}
+
+func (m *ircMessage) SetBlur(blur bool) {
+	m.message.setBlur(m, blur)
+}
+
+func (m *ircMessage) LoadMore() {
+	m.asyncFetch()
+	m.message.LoadMore()
+}
+
+func (m *ircMessage) asyncFetch() {
+	opt := mauthor.WithWidgetColor()
+
+	roomEv := m.parent.event.RoomInfo()
+	ctxutil.Async(m.parent, m, func(ctx context.Context) func() {
+		markup := mauthor.Markup(
+			gotktrix.FromContext(ctx), roomEv.RoomID, roomEv.Sender,
+			opt, mauthor.WithMinimal(),
+		)
+		return func() { m.sender.SetMarkup(markup) }
+	})
+}
@@ -0,0 +1,70 @@
+package message
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/app/prefs/kvstate"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// Message layouts.
+const (
+	FlatLayout   = "Flat"
+	BubbleLayout = "Bubbles"
+	IRCLayout    = "IRC"
+)
+
+// Layout is the preference for how messages are laid out. Each room can
+// override it; see RoomLayout.
+var Layout = prefs.NewEnumList(FlatLayout, prefs.EnumListMeta{
+	PropMeta: prefs.PropMeta{
+		Name:    "Message Layout",
+		Section: "Text",
+		Description: "Show messages as a flat list, as bubbles with your own " +
+			"messages on the right, or as compact IRC-style lines. This can be " +
+			"changed for each room in the room list.",
+	},
+	Options: []string{FlatLayout, BubbleLayout, IRCLayout},
+})
+
+// roomLayouts is published every time a room's layout is changed.
+var roomLayouts = prefs.NewPubsub()
+
+func acquireLayoutConfig(ctx context.Context) *kvstate.Config {
+	uID := gotktrix.FromContext(ctx).UserID
+	return kvstate.AcquireConfig(ctx, "messages", gotktrix.Base64UserID(uID), "layout.json")
+}
+
+// RoomLayout returns the message layout of the given room. The room's own
+// setting takes precedence over the global one.
+func RoomLayout(ctx context.Context, roomID matrix.RoomID) string {
+	var layout string
+	if !acquireLayoutConfig(ctx).Get(string(roomID), &layout) || !Layout.IsValid(layout) {
+		return Layout.Value()
+	}
+	return layout
+}
+
+// SetRoomLayout sets the message layout of the given room, overriding the
+// global setting. An empty layout makes the room follow the global setting
+// again.
+func SetRoomLayout(ctx context.Context, roomID matrix.RoomID, layout string) {
+	cfg := acquireLayoutConfig(ctx)
+	if layout == "" {
+		cfg.Delete(string(roomID))
+	} else {
+		cfg.Set(string(roomID), layout)
+	}
+	roomLayouts.Publish()
+}
+
+// SubscribeLayout calls f every time the message layout of any room may have
+// changed, for as long as the given widget is mapped. Callers should check
+// RoomLayout and recreate their messages if it's different.
+func SubscribeLayout(w gtk.Widgetter, f func()) {
+	Layout.SubscribeWidget(w, f)
+	roomLayouts.SubscribeWidget(w, f)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 	"github.com/diamondburned/gotkit/gtkutil/imgutil"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/mediautil"
 	"github.com/diamondburned/gotrix/matrix"
 )
 
@@ -148,7 +149,7 @@ func (c *Chip) Invalidate() {
 }
 
 func (c *Chip) setAvatar(client *gotktrix.Client, mxc *matrix.URL) {
-	if mxc == nil {
+	if mxc == nil || client.TextOnlyMode() {
 		c.avatar.SetFromPaintable(nil)
 		return
 	}
@@ -161,7 +162,7 @@ func (c *Chip) setAvatar(client *gotktrix.Client, mxc *matrix.URL) {
 
 	avatarURL, _ := client.SquareThumbnail(*mxc, 24, gtkutil.ScaleFactor())
 
-	imgutil.AsyncGET(ctx, avatarURL, imgutil.ImageSetter{
+	mediautil.AsyncGETScaled(ctx, c.avatar, avatarURL, 24, 24, imgutil.ImageSetter{
 		SetFromPaintable: c.avatar.SetFromPaintable,
 		SetFromPixbuf:    c.avatar.SetFromPixbuf,
 	})
@@ -37,6 +37,20 @@ var (
 		[2]float64{0.9, 1.0},
 		[2]float64{0.6, 0.7},
 	}
+	// HighContrastLightColorHasher is like LightColorHasher, except the colors
+	// are almost white, so they stand out more against a dark background.
+	HighContrastLightColorHasher ColorHasher = HSVHasher{
+		FNVHasher,
+		[2]float64{0.15, 0.25},
+		[2]float64{1.0, 1.0},
+	}
+	// HighContrastDarkColorHasher is like DarkColorHasher, except the colors
+	// are much darker, so they stand out more against a light background.
+	HighContrastDarkColorHasher ColorHasher = HSVHasher{
+		FNVHasher,
+		[2]float64{0.9, 1.0},
+		[2]float64{0.35, 0.45},
+	}
 )
 
 // RGBHex converts the given color to a HTML hex color string. The alpha value
@@ -11,6 +11,7 @@ import (
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
 	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
 	"github.com/diamondburned/gotktrix/internal/gotktrix/events/pronouns"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/a11y"
 	"github.com/diamondburned/gotrix/event"
 	"github.com/diamondburned/gotrix/matrix"
 )
@@ -60,11 +61,18 @@ func WithMention() MarkupMod {
 
 // WithWidgetColor determines the best hasher from the given widget. The caller
 // should beware to call this function in the main thread to not cause a race
-// condition.
+// condition. High-contrast colors are used if a high-contrast theme is in use.
 func WithWidgetColor() MarkupMod {
-	if textutil.IsDarkTheme() {
+	dark := textutil.IsDarkTheme()
+
+	switch {
+	case a11y.HighContrast() && dark:
+		return WithColorHasher(HighContrastLightColorHasher)
+	case a11y.HighContrast():
+		return WithColorHasher(HighContrastDarkColorHasher)
+	case dark:
 		return WithColorHasher(LightColorHasher)
-	} else {
+	default:
 		return WithColorHasher(DarkColorHasher)
 	}
 }
@@ -0,0 +1,231 @@
+package mauthor
+
+import (
+	"context"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/onlineimage"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/ignored"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/pronouns"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// ProfileActioner does the quick actions in a profile popover.
+type ProfileActioner interface {
+	// MentionUser inserts a mention of the given user into the composer.
+	MentionUser(matrix.UserID)
+	// DirectMessage opens the direct chat with the given user, creating it if
+	// there's none yet.
+	DirectMessage(matrix.UserID)
+}
+
+const (
+	profileAvatarSize = 64
+	// maxSharedRooms is the number of shared rooms listed before the rest are
+	// only counted.
+	maxSharedRooms = 5
+)
+
+var profileCSS = cssutil.Applier("mauthor-profile", `
+	.mauthor-profile {
+		padding: 6px;
+	}
+	.mauthor-profile-name {
+		font-size: 1.15em;
+		font-weight: bold;
+		margin-top: 6px;
+	}
+	.mauthor-profile-id {
+		font-size: 0.9em;
+	}
+	.mauthor-profile-pronouns {
+		font-size: 0.9em;
+		color: alpha(@theme_fg_color, 0.75);
+	}
+	.mauthor-profile-shared {
+		margin-top: 8px;
+		font-size: 0.9em;
+	}
+	.mauthor-profile-actions {
+		margin-top: 8px;
+	}
+`)
+
+// BindProfilePopover makes clicking the given widget show the profile of the
+// given user in a popover. The room ID may be empty, in which case the user's
+// name and avatar aren't taken from the room.
+func BindProfilePopover(
+	ctx context.Context,
+	w gtk.Widgetter, roomID matrix.RoomID, userID matrix.UserID, actions ProfileActioner) {
+
+	base := gtk.BaseWidget(w)
+	base.SetCursorFromName("pointer")
+
+	click := gtk.NewGestureClick()
+	click.SetButton(gdk.BUTTON_PRIMARY)
+	click.ConnectReleased(func(n int, x, y float64) {
+		if n == 1 {
+			ShowProfilePopover(ctx, w, roomID, userID, actions)
+		}
+	})
+
+	base.AddController(click)
+}
+
+// ShowProfilePopover shows the profile of the given user in a popover pointing
+// at the given widget.
+func ShowProfilePopover(
+	ctx context.Context,
+	w gtk.Widgetter, roomID matrix.RoomID, userID matrix.UserID, actions ProfileActioner) {
+
+	client := gotktrix.FromContext(ctx).Offline()
+	isSelf := userID == client.UserID
+
+	avatar := onlineimage.NewAvatar(ctx, gotktrix.AvatarProvider, profileAvatarSize)
+	avatar.SetHAlign(gtk.AlignCenter)
+	avatar.SetInitials(Name(client, roomID, userID, WithMinimal()))
+	if mxc, _ := client.MemberAvatar(roomID, userID); mxc != nil {
+		avatar.SetFromURL(string(*mxc))
+	}
+
+	name := gtk.NewLabel("")
+	name.AddCSSClass("mauthor-profile-name")
+	name.SetWrap(true)
+	name.SetWrapMode(pango.WrapWordChar)
+	name.SetJustify(gtk.JustifyCenter)
+	name.SetMarkup(Markup(client, roomID, userID, WithMinimal(), WithWidgetColor()))
+
+	id := gtk.NewLabel(string(userID))
+	id.AddCSSClass("mauthor-profile-id")
+	id.AddCSSClass("dim-label")
+	id.SetSelectable(true)
+	id.SetWrap(true)
+	id.SetWrapMode(pango.WrapWordChar)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 2)
+	box.SetSizeRequest(240, -1)
+	box.Append(avatar)
+	box.Append(name)
+	box.Append(id)
+
+	if pronoun := pronouns.UserPronouns(client, roomID, userID).Pronoun(); pronoun != "" {
+		p := gtk.NewLabel(string(pronoun))
+		p.AddCSSClass("mauthor-profile-pronouns")
+		box.Append(p)
+	}
+
+	shared := gtk.NewLabel("")
+	shared.AddCSSClass("mauthor-profile-shared")
+	shared.SetXAlign(0)
+	shared.SetWrap(true)
+	shared.SetWrapMode(pango.WrapWordChar)
+	shared.Hide()
+	box.Append(shared)
+
+	if !isSelf {
+		gtkutil.Async(ctx, func() func() {
+			markup := sharedRoomsMarkup(ctx, client, userID)
+			return func() {
+				shared.SetMarkup(markup)
+				shared.Show()
+			}
+		})
+	}
+
+	mention := gtk.NewButtonWithMnemonic(locale.S(ctx, "_Mention"))
+	mention.SetSensitive(!isSelf && roomID != "" &&
+		client.CanSendEvent(roomID, event.TypeRoomMessage, false))
+
+	message := gtk.NewButtonWithMnemonic(locale.S(ctx, "_Message"))
+	message.SetSensitive(!isSelf)
+
+	ignore := gtk.NewButtonWithMnemonic(locale.S(ctx, "_Ignore"))
+	ignore.SetSensitive(!isSelf)
+	if ignored.IsIgnored(client, userID) {
+		ignore.SetLabel(locale.S(ctx, "Un_ignore"))
+	}
+
+	buttons := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	buttons.AddCSSClass("mauthor-profile-actions")
+	buttons.SetHomogeneous(true)
+	buttons.Append(mention)
+	buttons.Append(message)
+	buttons.Append(ignore)
+	box.Append(buttons)
+
+	profileCSS(box)
+
+	popover := gtk.NewPopover()
+	popover.SetParent(w)
+	popover.SetChild(box)
+	popover.ConnectHide(func() {
+		glib.TimeoutSecondsAdd(2, popover.Unparent)
+	})
+
+	mention.ConnectClicked(func() {
+		popover.Popdown()
+		actions.MentionUser(userID)
+	})
+	message.ConnectClicked(func() {
+		popover.Popdown()
+		actions.DirectMessage(userID)
+	})
+	ignore.ConnectClicked(func() {
+		popover.Popdown()
+		ignoring := !ignored.IsIgnored(client, userID)
+		ignored.SetIgnored(client, userID, ignoring, func(err error) {
+			if err != nil {
+				glib.IdleAdd(func() {
+					app.Error(ctx, errors.Wrap(err, "failed to update ignored users"))
+				})
+			}
+		})
+	})
+
+	popover.Popup()
+}
+
+func sharedRoomsMarkup(ctx context.Context, client *gotktrix.Client, userID matrix.UserID) string {
+	roomIDs := client.SharedRooms(userID)
+	if len(roomIDs) == 0 {
+		return locale.S(ctx, "No rooms in common.")
+	}
+
+	names := make([]string, len(roomIDs))
+	for i, roomID := range roomIDs {
+		names[i], _ = client.RoomName(roomID)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("<b>")
+	b.WriteString(html.EscapeString(locale.Plural(ctx,
+		"%d room in common", "%d rooms in common", len(names))))
+	b.WriteString("</b>")
+
+	for i, name := range names {
+		if i == maxSharedRooms {
+			b.WriteString("\n")
+			b.WriteString(html.EscapeString(locale.Plural(ctx,
+				"and %d more", "and %d more", len(names)-maxSharedRooms)))
+			break
+		}
+		b.WriteString("\n• ")
+		b.WriteString(html.EscapeString(name))
+	}
+
+	return b.String()
+}
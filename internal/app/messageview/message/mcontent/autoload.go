@@ -0,0 +1,41 @@
+package mcontent
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/app/prefs/kvstate"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var autoLoadMedia = prefs.NewBool(true, prefs.PropMeta{
+	Name:    "Auto-load Media",
+	Section: "Text",
+	Description: "Load image and video thumbnails automatically. If this is " +
+		"off, media is only loaded when clicked, which saves data. This can " +
+		"be changed for each room in the room list.",
+})
+
+func acquireAutoLoadConfig(ctx context.Context) *kvstate.Config {
+	uID := gotktrix.FromContext(ctx).UserID
+	return kvstate.AcquireConfig(ctx, "media", gotktrix.Base64UserID(uID), "autoload.json")
+}
+
+// AutoLoadMedia returns true if media thumbnails in the given room should be
+// loaded automatically. The room's own setting takes precedence over the
+// global one, which is off in low-data mode.
+func AutoLoadMedia(ctx context.Context, roomID matrix.RoomID) bool {
+	var autoLoad bool
+	if !acquireAutoLoadConfig(ctx).Get(string(roomID), &autoLoad) {
+		return autoLoadMedia.Value() && !gotktrix.FromContext(ctx).LowDataMode()
+	}
+	return autoLoad
+}
+
+// SetAutoLoadMedia sets whether or not media thumbnails should be loaded
+// automatically in the given room, overriding the global setting. New messages
+// will follow the new setting.
+func SetAutoLoadMedia(ctx context.Context, roomID matrix.RoomID, autoLoad bool) {
+	acquireAutoLoadConfig(ctx).Set(string(roomID), autoLoad)
+}
@@ -0,0 +1,79 @@
+package mcontent
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/app/prefs/kvstate"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+var blurImages = prefs.NewBool(false, prefs.PropMeta{
+	Name:    "Blur Images",
+	Section: "Text",
+	Description: "Blur images sent by others until they're clicked. This can " +
+		"be changed for each room in the room list.",
+})
+
+var contentScanner = prefs.NewString("", prefs.StringMeta{
+	Name:    "Content Scanner",
+	Section: "Text",
+	Description: "The URL of a Matrix content scanner to fetch all media " +
+		"through, which lets the scanner reject unsafe files.",
+	Placeholder: "https://scanner.example.com",
+	Validate: func(str string) error {
+		if str == "" {
+			return nil
+		}
+		u, err := url.Parse(str)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.New("URL must be HTTP or HTTPS")
+		}
+		return nil
+	},
+})
+
+// BindContentScanner makes the client within the given context fetch media
+// through the content scanner in the user's preferences. The returned callback
+// stops following the preference.
+func BindContentScanner(ctx context.Context) func() {
+	client := gotktrix.FromContext(ctx)
+	update := func() { client.SetContentScanner(contentScanner.Value()) }
+	update()
+	return contentScanner.Subscribe(update)
+}
+
+func acquireBlurConfig(ctx context.Context) *kvstate.Config {
+	uID := gotktrix.FromContext(ctx).UserID
+	return kvstate.AcquireConfig(ctx, "media", gotktrix.Base64UserID(uID), "blur.json")
+}
+
+// BlurImages returns true if images sent by others in the given room should be
+// blurred. The room's own setting takes precedence over the global one.
+func BlurImages(ctx context.Context, roomID matrix.RoomID) bool {
+	var blur bool
+	if !acquireBlurConfig(ctx).Get(string(roomID), &blur) {
+		return blurImages.Value()
+	}
+	return blur
+}
+
+// SetBlurImages sets whether or not images should be blurred in the given room,
+// overriding the global setting. New messages will follow the new setting.
+func SetBlurImages(ctx context.Context, roomID matrix.RoomID, blur bool) {
+	acquireBlurConfig(ctx).Set(string(roomID), blur)
+}
+
+// shouldBlur returns true if the given message's media should be blurred.
+// Media sent by the user themselves is never blurred.
+func shouldBlur(ctx context.Context, msg *event.RoomMessageEvent) bool {
+	client := gotktrix.FromContext(ctx)
+	return msg.Sender != client.UserID && BlurImages(ctx, msg.RoomID)
+}
@@ -8,7 +8,11 @@ import (
 	"github.com/diamondburned/gotk4/pkg/gio/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/contact"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/effects"
 	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/poll"
 	"github.com/diamondburned/gotrix/event"
 	"github.com/diamondburned/gotrix/matrix"
 )
@@ -48,10 +52,23 @@ type Content struct {
 	react *reactionBox
 
 	editedTime matrix.Timestamp
+
+	// near is true once the content has been scrolled near the viewport.
+	// Until then, heavy work is queued up in pending.
+	near    bool
+	pending []func()
 }
 
 // New parses the given room message event and renders it into a Content widget.
 func New(ctx context.Context, ev *event.RoomMessageEvent) *Content {
+	// Media is only linked to in text-only mode.
+	if gotktrix.FromContext(ctx).TextOnlyMode() {
+		switch ev.MessageType {
+		case event.RoomMessageVideo, event.RoomMessageImage:
+			return wrapParts(ctx, ev, newMediaLinkContent(ctx, ev))
+		}
+	}
+
 	var part contentPart
 
 	switch ev.MessageType {
@@ -59,18 +76,33 @@ func New(ctx context.Context, ev *event.RoomMessageEvent) *Content {
 		fallthrough
 	case event.RoomMessageText:
 		part = newTextContent(ctx, ev)
+	case effects.Confetti, effects.Snowfall, effects.Hearts, effects.Rainfall:
+		// The effect itself is played by the message view, so the message is
+		// shown like any other text message.
+		part = newTextContent(ctx, ev)
 	case event.RoomMessageEmote:
 		part = newEmoteContent(ctx, ev)
 	case event.RoomMessageVideo:
-		part = newVideoContent(ctx, ev)
+		// Video previews are expensive to construct, so only construct them
+		// once they're about to be seen.
+		w, h := videoSize(ev)
+		part = newLazyContent(w, h, func() contentPart { return newVideoContent(ctx, ev) })
 	case event.RoomMessageImage:
 		part = newImageContent(ctx, ev)
 	case event.RoomMessageAudio:
-		fallthrough
+		part = newAudioContent(ctx, ev)
 	case event.RoomMessageFile:
-		part = newFileContent(ctx, ev)
+		if isVCardFile(ev) {
+			part = newVCardFileContent(ctx, ev)
+		} else {
+			part = newFileContent(ctx, ev)
+		}
 	case event.RoomMessageLocation:
 		part = newLocationContent(ctx, ev)
+	case contact.MessageType:
+		part = newContactMessageContent(ctx, ev)
+	case poll.MessageType:
+		part = newPollMessageContent(ctx, ev)
 	}
 
 	if part == nil {
@@ -80,17 +112,61 @@ func New(ctx context.Context, ev *event.RoomMessageEvent) *Content {
 	return wrapParts(ctx, ev, part)
 }
 
+// NewCompact is like New, except media is shown as links instead of being
+// embedded. It's used for compact layouts.
+func NewCompact(ctx context.Context, ev *event.RoomMessageEvent) *Content {
+	switch ev.MessageType {
+	case
+		event.RoomMessageVideo,
+		event.RoomMessageImage,
+		event.RoomMessageAudio,
+		event.RoomMessageFile:
+
+		return wrapParts(ctx, ev, newMediaLinkContent(ctx, ev))
+	default:
+		return New(ctx, ev)
+	}
+}
+
 func wrapParts(ctx context.Context, ev *event.RoomMessageEvent, part contentPart) *Content {
 	box := gtk.NewBox(gtk.OrientationVertical, 0)
 	box.SetHExpand(true)
 	box.Append(part)
 
-	return &Content{
+	c := &Content{
 		Box:  box,
 		ev:   ev,
 		ctx:  ctx,
 		part: part,
 	}
+
+	if lazy, ok := part.(*lazyContent); ok {
+		c.whenNear(lazy.construct)
+	}
+
+	onNearViewport(c, c.onNear)
+	return c
+}
+
+// whenNear calls f once the content is near the viewport, or immediately if it
+// already has been.
+func (c *Content) whenNear(f func()) {
+	if c.near {
+		f()
+		return
+	}
+	c.pending = append(c.pending, f)
+}
+
+func (c *Content) onNear() {
+	c.near = true
+
+	pending := c.pending
+	c.pending = nil
+
+	for _, f := range pending {
+		f()
+	}
 }
 
 type extraMenuSetter interface {
@@ -134,13 +210,29 @@ func (c *Content) OnRelatedEvent(ev event.RoomEvent) bool {
 		// TODO: if we have a proper graph data structure that keeps track of
 		// relational events separately instead of keeping it nested in its
 		// respective events, then we wouldn't need to do this.
+		if !c.near {
+			c.whenNear(func() {
+				if c.react != nil {
+					c.react.Remove(c.ctx, ev)
+				}
+			})
+			return true
+		}
 		if c.react == nil || c.react.Remove(c.ctx, ev) {
 			return true
 		}
+	case *poll.ResponseEvent, *poll.EndEvent:
+		if p, ok := c.part.(*pollContent); ok {
+			return p.relatedEvent(ev)
+		}
 	case *m.ReactionEvent:
 		if ev.RelatesTo.RelType == "m.annotation" {
-			c.ensureReactions()
-			c.react.Add(c.ctx, ev)
+			c.whenNear(func() {
+				if !c.isRedacted() {
+					c.ensureReactions()
+					c.react.Add(c.ctx, ev)
+				}
+			})
 			return true
 		}
 	}
@@ -156,10 +248,14 @@ func (c *Content) ensureReactions() {
 	}
 }
 
+// LoadMore loads the content's media and link embeds once the content is near
+// the viewport.
 func (c *Content) LoadMore() {
-	if l, ok := c.part.(loadableContentPart); ok {
-		l.LoadMore()
-	}
+	c.whenNear(func() {
+		if l, ok := c.part.(loadableContentPart); ok {
+			l.LoadMore()
+		}
+	})
 }
 
 func (c *Content) isRedacted() bool {
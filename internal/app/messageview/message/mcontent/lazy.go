@@ -0,0 +1,126 @@
+package mcontent
+
+import (
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/gtkutil"
+)
+
+// nearViewport is how close a widget has to be to the viewport, in viewport
+// heights, for it to be considered near it.
+const nearViewport = 1.0
+
+// onNearViewport calls f once, when the widget is first scrolled near the
+// viewport of the scrolled window that it's in. If the widget isn't in a
+// scrolled window, then f is called when the widget is first drawn.
+func onNearViewport(w gtk.Widgetter, f func()) {
+	widget := gtk.BaseWidget(w)
+
+	var done bool
+	var vadj *gtk.Adjustment
+	var signals []glib.SignalHandle
+
+	disconnect := func() {
+		if vadj != nil {
+			for _, signal := range signals {
+				vadj.HandlerDisconnect(signal)
+			}
+			vadj = nil
+			signals = nil
+		}
+	}
+
+	var scroll *gtk.ScrolledWindow
+
+	check := func() {
+		if done || !widget.Mapped() {
+			return
+		}
+		if scroll != nil && !isNearViewport(widget, scroll) {
+			return
+		}
+
+		done = true
+		disconnect()
+		f()
+	}
+
+	bind := func() {
+		if done {
+			return
+		}
+
+		scroll, _ = widget.Ancestor(gtk.GTypeScrolledWindow).(*gtk.ScrolledWindow)
+		if scroll != nil {
+			vadj = scroll.VAdjustment()
+			signals = []glib.SignalHandle{
+				vadj.ConnectValueChanged(check),
+				vadj.ConnectChanged(check),
+			}
+		}
+
+		// The widget isn't allocated until it's drawn, so do the first check
+		// then.
+		gtkutil.OnFirstDraw(widget, check)
+	}
+
+	widget.ConnectMap(bind)
+	widget.ConnectUnmap(disconnect)
+
+	if widget.Mapped() {
+		bind()
+	}
+}
+
+// isNearViewport returns true if the widget is within nearViewport of the
+// visible area of the given scrolled window.
+func isNearViewport(widget *gtk.Widget, scroll *gtk.ScrolledWindow) bool {
+	_, y, ok := widget.TranslateCoordinates(scroll, 0, 0)
+	if !ok {
+		return false
+	}
+
+	h := float64(scroll.AllocatedHeight())
+	margin := h * nearViewport
+
+	return y+float64(widget.AllocatedHeight()) >= -margin && y <= h+margin
+}
+
+// lazyContent is a placeholder for a content part that is expensive to
+// construct. It reserves the part's size until the message is scrolled near
+// the viewport, which is when the actual part is constructed.
+type lazyContent struct {
+	*gtk.Box
+	part contentPart
+	ctor func() contentPart
+}
+
+func newLazyContent(w, h int, ctor func() contentPart) *lazyContent {
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.SetSizeRequest(w, h)
+	box.SetHAlign(gtk.AlignStart)
+
+	return &lazyContent{
+		Box:  box,
+		ctor: ctor,
+	}
+}
+
+// construct constructs the actual part and replaces the placeholder with it.
+func (c *lazyContent) construct() {
+	if c.part != nil {
+		return
+	}
+
+	c.part = c.ctor()
+	c.SetSizeRequest(-1, -1)
+	c.Append(c.part)
+}
+
+func (c *lazyContent) LoadMore() {
+	if l, ok := c.part.(loadableContentPart); ok {
+		l.LoadMore()
+	}
+}
+
+func (c *lazyContent) content() {}
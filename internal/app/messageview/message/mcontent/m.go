@@ -1,13 +1,17 @@
 package mcontent
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"html"
 	"strings"
 
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotk4/pkg/pango"
 	"github.com/diamondburned/gotkit/app/locale"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/md/hl"
 	"github.com/diamondburned/gotrix/event"
 )
 
@@ -65,27 +69,113 @@ func (c redactedContent) content() {}
 // ---
 
 type unknownContent struct {
-	*gtk.Label
+	*gtk.Box
 }
 
 var unknownContentCSS = cssutil.Applier("mcontent-unknown", `
 	.mcontent-unknown {
 		font-size: 0.9em;
+	}
+	.mcontent-unknown-type {
 		color: alpha(@theme_fg_color, 0.8);
 	}
+	.mcontent-unknown textview {
+		font-family: monospace;
+		padding: 4px;
+	}
 `)
 
 func newUnknownContent(ctx context.Context, ev *event.RoomMessageEvent) unknownContent {
 	p := locale.FromContext(ctx)
-	msg := p.Sprintf("Unknown message type %q.", string(ev.MessageType))
 
-	l := gtk.NewLabel(msg)
-	l.SetXAlign(0)
-	l.SetWrap(true)
-	l.SetWrapMode(pango.WrapWordChar)
-	unknownContentCSS(l)
+	header := gtk.NewLabel("")
+	header.AddCSSClass("mcontent-unknown-type")
+	header.SetMarkup(p.Sprintf(
+		"Unknown message type <tt>%s</tt> in a <tt>%s</tt> event.",
+		html.EscapeString(string(ev.MessageType)), html.EscapeString(string(ev.Type)),
+	))
+	header.SetXAlign(0)
+	header.SetWrap(true)
+	header.SetWrapMode(pango.WrapWordChar)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 2)
+	box.Append(header)
+
+	content := unknownEventContent(ev)
+
+	// Show the body or the extensible event fallback, since that's what the
+	// sender wants clients that don't know the type to show.
+	if fallback := unknownFallback(ev, content); fallback != "" {
+		body := gtk.NewLabel(fallback)
+		body.SetXAlign(0)
+		body.SetWrap(true)
+		body.SetWrapMode(pango.WrapWordChar)
+		body.SetSelectable(true)
+		box.Append(body)
+	}
+
+	if len(content) > 0 {
+		expander := gtk.NewExpander(p.Sprint("Content"))
+		// Highlighting is slow, so only do it once the content is shown.
+		expander.ConnectActivate(func() {
+			if expander.Child() == nil {
+				expander.SetChild(newJSONView(ctx, content))
+			}
+		})
+		box.Append(expander)
+	}
+
+	unknownContentCSS(box)
+
+	return unknownContent{box}
+}
+
+// unknownEventContent returns the pretty-printed content of the given event, or
+// nil if it has none.
+func unknownEventContent(ev *event.RoomMessageEvent) []byte {
+	var raw struct {
+		Content json.RawMessage `json:"content"`
+	}
+
+	if ev.Raw == nil || json.Unmarshal(ev.Raw, &raw) != nil || len(raw.Content) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, raw.Content, "", "  "); err != nil {
+		return raw.Content
+	}
+
+	return buf.Bytes()
+}
+
+// unknownFallback returns the text that the event has as a fallback for
+// clients that don't know its type.
+func unknownFallback(ev *event.RoomMessageEvent, content []byte) string {
+	if body := strings.TrimSpace(ev.Body); body != "" {
+		return body
+	}
+
+	var fallback struct {
+		Text string `json:"org.matrix.msc1767.text"`
+	}
+	json.Unmarshal(content, &fallback)
+
+	return strings.TrimSpace(fallback.Text)
+}
+
+// newJSONView creates a highlighted view of the given JSON.
+func newJSONView(ctx context.Context, j []byte) *gtk.TextView {
+	buf := gtk.NewTextBuffer(nil)
+	buf.SetText(string(j))
+	hl.Highlight(ctx, buf.StartIter(), buf.EndIter(), "json")
+
+	t := gtk.NewTextViewWithBuffer(buf)
+	t.SetEditable(false)
+	t.SetCursorVisible(false)
+	t.SetWrapMode(gtk.WrapWordChar)
 
-	return unknownContent{l}
+	return t
 }
 
 func (c unknownContent) content() {}
@@ -0,0 +1,202 @@
+package mcontent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+)
+
+type audioContent struct {
+	*gtk.Box
+	ctx context.Context
+
+	play *gtk.Button
+	seek *gtk.Scale
+	time *gtk.Label
+
+	// media is only created once the user presses play, so that audio
+	// messages don't open a stream each just by being in the timeline.
+	media *gtk.MediaFile
+	url   string
+	// duration is in microseconds, which is what GtkMediaStream uses. It is
+	// taken from the event until the stream knows better.
+	duration int64
+}
+
+var audioCSS = cssutil.Applier("mcontent-audio", `
+	.mcontent-audio {
+		padding: 4px 6px;
+	}
+	.mcontent-audio-name {
+		margin-bottom: 2px;
+	}
+	.mcontent-audio scale {
+		min-width: 150px;
+	}
+	.mcontent-audio-time {
+		font-size: 0.85rem;
+		font-feature-settings: "tnum";
+	}
+`)
+
+// newAudioContent creates an inline player for an audio message. The audio is
+// streamed from the homeserver using GStreamer through GtkMediaFile instead of
+// being downloaded first.
+func newAudioContent(ctx context.Context, msg *event.RoomMessageEvent) contentPart {
+	client := gotktrix.FromContext(ctx).Offline()
+
+	url, err := client.MessageMediaURL(msg)
+	if err != nil {
+		return newMediaLinkContent(ctx, msg)
+	}
+
+	c := audioContent{
+		ctx: ctx,
+		url: url,
+	}
+
+	if info, err := msg.AudioInfo(); err == nil && info.Duration > 0 {
+		c.duration = int64(info.Duration) * int64(time.Millisecond/time.Microsecond)
+	}
+
+	name := gtk.NewLabel(msg.Body)
+	name.AddCSSClass("mcontent-audio-name")
+	name.SetEllipsize(pango.EllipsizeMiddle)
+	name.SetXAlign(0)
+	name.SetTooltipText(msg.Body)
+
+	c.play = gtk.NewButtonFromIconName("media-playback-start-symbolic")
+	c.play.SetTooltipText(locale.S(ctx, "Play"))
+	c.play.SetHasFrame(false)
+	c.play.ConnectClicked(c.toggle)
+
+	c.seek = gtk.NewScaleWithRange(gtk.OrientationHorizontal, 0, 1, 1)
+	c.seek.SetHExpand(true)
+	c.seek.SetDrawValue(false)
+	c.seek.SetSensitive(false)
+	c.seek.ConnectChangeValue(func(_ gtk.ScrollType, value float64) bool {
+		// This is only emitted for user changes, so there's no feedback loop
+		// with the timestamp updates.
+		if c.media != nil && c.media.IsSeekable() {
+			c.media.Seek(int64(value))
+		}
+		return false
+	})
+
+	c.time = gtk.NewLabel("")
+	c.time.AddCSSClass("mcontent-audio-time")
+
+	controls := gtk.NewBox(gtk.OrientationHorizontal, 2)
+	controls.Append(c.play)
+	controls.Append(c.seek)
+	controls.Append(c.time)
+
+	c.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+	c.Box.AddCSSClass("frame")
+	c.Box.SetHAlign(gtk.AlignStart)
+	c.Box.Append(name)
+	c.Box.Append(controls)
+	audioCSS(c.Box)
+
+	// Stop the audio once the message goes away, such as when the user
+	// switches rooms.
+	c.Box.ConnectUnrealize(func() {
+		if c.media != nil {
+			c.media.Pause()
+		}
+	})
+
+	gtkutil.BindActionMap(c.Box, map[string]func(){
+		"audio.open-external": func() { app.OpenURI(ctx, url) },
+	})
+
+	gtkutil.BindRightClick(c.Box, func() {
+		p := gtkutil.NewPopoverMenuCustom(c.Box, gtk.PosBottom, []gtkutil.PopoverMenuItem{
+			gtkutil.MenuItem(locale.S(ctx, "Open Externally"), "audio.open-external"),
+		})
+		gtkutil.PopupFinally(p)
+	})
+
+	c.update()
+	return &c
+}
+
+func (c *audioContent) toggle() {
+	if c.media == nil {
+		c.media = gtk.NewMediaFileForFile(gio.NewFileForURI(c.url))
+		c.media.NotifyProperty("playing", c.update)
+		c.media.NotifyProperty("timestamp", c.update)
+		c.media.NotifyProperty("duration", c.update)
+		c.media.NotifyProperty("ended", c.update)
+		c.media.NotifyProperty("seekable", c.update)
+		c.media.NotifyProperty("error", func() {
+			if err := c.media.Error(); err != nil {
+				app.Error(c.ctx, err)
+			}
+			c.update()
+		})
+	}
+
+	if c.media.GetEnded() {
+		c.media.Seek(0)
+	}
+
+	c.media.SetPlaying(!c.media.Playing())
+}
+
+// update synchronizes the controls with the media stream.
+func (c *audioContent) update() {
+	var timestamp int64
+	var playing bool
+
+	if c.media != nil {
+		if d := c.media.Duration(); d > 0 {
+			c.duration = d
+		}
+		timestamp = c.media.Timestamp()
+		playing = c.media.Playing()
+	}
+
+	if playing {
+		c.play.SetIconName("media-playback-pause-symbolic")
+		c.play.SetTooltipText(locale.S(c.ctx, "Pause"))
+	} else {
+		c.play.SetIconName("media-playback-start-symbolic")
+		c.play.SetTooltipText(locale.S(c.ctx, "Play"))
+	}
+
+	if c.duration > 0 {
+		c.seek.SetRange(0, float64(c.duration))
+		c.seek.SetValue(float64(timestamp))
+	}
+	c.seek.SetSensitive(c.media != nil && c.media.IsSeekable())
+
+	duration := "-:--"
+	if c.duration > 0 {
+		duration = formatAudioTime(c.duration)
+	}
+
+	if c.media == nil {
+		c.time.SetText(duration)
+	} else {
+		c.time.SetText(formatAudioTime(timestamp) + " / " + duration)
+	}
+}
+
+// formatAudioTime formats the given duration in microseconds as m:ss.
+func formatAudioTime(us int64) string {
+	secs := us / int64(time.Second/time.Microsecond)
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
+
+func (c *audioContent) content() {}
@@ -0,0 +1,188 @@
+package mcontent
+
+import (
+	"context"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/httputil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/contact"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/pkg/errors"
+)
+
+// maxVCardSize is the largest vCard file that is fetched to be shown as a
+// contact. Larger files usually have a photo in them.
+const maxVCardSize = 64 * 1024
+
+var contactCSS = cssutil.Applier("mcontent-contact", `
+	.mcontent-contact {
+		padding: 6px 8px;
+	}
+	.mcontent-contact > image {
+		margin-right: 8px;
+	}
+	.mcontent-contact-name {
+		font-weight: bold;
+	}
+	.mcontent-contact-org {
+		color: alpha(@theme_fg_color, 0.75);
+	}
+`)
+
+type contactContent struct {
+	*gtk.Box
+}
+
+// newContactMessageContent renders a contact message, falling back to its body.
+func newContactMessageContent(ctx context.Context, msg *event.RoomMessageEvent) contentPart {
+	c, err := contact.FromMessage(msg)
+	if err != nil {
+		return newTextContent(ctx, msg)
+	}
+	return newContactContent(ctx, c)
+}
+
+func newContactContent(ctx context.Context, c *contact.Contact) *contactContent {
+	icon := gtk.NewImageFromIconName("avatar-default-symbolic")
+	icon.SetIconSize(gtk.IconSizeLarge)
+	icon.SetVAlign(gtk.AlignStart)
+
+	info := gtk.NewBox(gtk.OrientationVertical, 0)
+
+	addLine := func(markup, class string) {
+		l := gtk.NewLabel("")
+		l.SetMarkup(markup)
+		l.SetXAlign(0)
+		l.SetWrap(true)
+		l.SetWrapMode(pango.WrapWordChar)
+		l.SetSelectable(true)
+		if class != "" {
+			l.AddCSSClass(class)
+		}
+		info.Append(l)
+	}
+
+	name := c.Name
+	if name == "" {
+		name = locale.S(ctx, "Unnamed Contact")
+	}
+	addLine(html.EscapeString(name), "mcontent-contact-name")
+
+	if c.Org != "" {
+		addLine(html.EscapeString(c.Org), "mcontent-contact-org")
+	}
+	for _, phone := range c.Phones {
+		addLine(contactLink("tel:"+strings.ReplaceAll(phone, " ", ""), phone), "")
+	}
+	for _, email := range c.Emails {
+		addLine(contactLink("mailto:"+email, email), "")
+	}
+	for _, url := range c.URLs {
+		addLine(contactLink(url, url), "")
+	}
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	box.AddCSSClass("frame")
+	box.SetHAlign(gtk.AlignStart)
+	box.Append(icon)
+	box.Append(info)
+	contactCSS(box)
+
+	return &contactContent{box}
+}
+
+func contactLink(href, text string) string {
+	return `<a href="` + html.EscapeString(href) + `">` + html.EscapeString(text) + `</a>`
+}
+
+func (c *contactContent) content() {}
+
+// vcardFileContent is a vCard file, usually sent by bridges. It's shown as the
+// file, with the contact in it above once it's fetched.
+type vcardFileContent struct {
+	*gtk.Box
+	ctx    context.Context
+	msg    *event.RoomMessageEvent
+	loaded bool
+}
+
+func newVCardFileContent(ctx context.Context, msg *event.RoomMessageEvent) contentPart {
+	c := vcardFileContent{
+		ctx: ctx,
+		msg: msg,
+	}
+
+	c.Box = gtk.NewBox(gtk.OrientationVertical, 4)
+	c.Append(newFileContent(ctx, msg))
+
+	return &c
+}
+
+// isVCardFile returns true if the file message is a vCard.
+func isVCardFile(msg *event.RoomMessageEvent) bool {
+	info, err := msg.FileInfo()
+	if err != nil {
+		return contact.IsVCard(msg.Body, "")
+	}
+	return info.Size <= maxVCardSize && contact.IsVCard(msg.Body, info.MimeType)
+}
+
+func (c *vcardFileContent) LoadMore() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+
+	client := gotktrix.FromContext(c.ctx)
+	url, err := client.MediaDownloadURL(c.msg.URL, true, "")
+	if err != nil {
+		return
+	}
+
+	gtkutil.Async(c.ctx, func() func() {
+		card, err := fetchVCard(c.ctx, url)
+		if err != nil {
+			// Keep showing the file.
+			return nil
+		}
+
+		return func() {
+			c.Prepend(newContactContent(c.ctx, card))
+		}
+	})
+}
+
+func fetchVCard(ctx context.Context, url string) (*contact.Contact, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httputil.FromContext(ctx, http.DefaultClient).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s", resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxVCardSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return contact.ParseVCard(string(b))
+}
+
+func (c *vcardFileContent) content() {}
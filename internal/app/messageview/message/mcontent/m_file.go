@@ -25,6 +25,28 @@ type linkContent struct {
 	*gtk.Label
 }
 
+func newLinkContent(url, name string) *linkContent {
+	c := linkContent{}
+	c.Label = gtk.NewLabel(fmt.Sprintf(
+		`<a href="%s">%s</a>`,
+		html.EscapeString(url), html.EscapeString(name),
+	))
+	c.Label.SetUseMarkup(true)
+	c.Label.SetEllipsize(pango.EllipsizeMiddle)
+	c.Label.SetXAlign(0)
+	return &c
+}
+
+// newMediaLinkContent renders any media message as a link to the media.
+func newMediaLinkContent(ctx context.Context, msg *event.RoomMessageEvent) contentPart {
+	client := gotktrix.FromContext(ctx)
+	url, _ := client.MediaDownloadURL(msg.URL, true, "")
+
+	c := newLinkContent(url, msg.Body)
+	c.AddCSSClass("mcontent-medialink")
+	return c
+}
+
 func (c *linkContent) content() {}
 
 type fileContent struct {
@@ -71,16 +93,9 @@ func newFileContent(ctx context.Context, msg *event.RoomMessageEvent) contentPar
 	info, err := msg.FileInfo()
 	if err != nil {
 		// File has no info for some reason. Just render the URL as a fallback.
-		c := linkContent{}
-		c.Label = gtk.NewLabel(fmt.Sprintf(
-			`<a href="%s">%s</a>`,
-			html.EscapeString(url), html.EscapeString(msg.Body),
-		))
-		c.Label.SetUseMarkup(true)
-		c.Label.SetEllipsize(pango.EllipsizeMiddle)
-		c.Label.SetXAlign(0)
+		c := newLinkContent(url, msg.Body)
 		c.AddCSSClass("mcontent-file-fallback")
-		return &c
+		return c
 	}
 
 	c := fileContent{
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"html"
 	"image"
-	"log"
 
 	"github.com/bbrks/go-blurhash"
 	"github.com/diamondburned/gotk4/pkg/gdk/v4"
@@ -13,11 +12,12 @@ import (
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotk4/pkg/pango"
-	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
 	"github.com/diamondburned/gotkit/gtkutil"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 	"github.com/diamondburned/gotkit/gtkutil/imgutil"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/mediautil"
 	"github.com/diamondburned/gotrix/event"
 )
 
@@ -25,6 +25,9 @@ type imageContent struct {
 	*imageEmbed
 	ctx context.Context
 	msg *event.RoomMessageEvent
+	// deferred is true if the thumbnail is only loaded once the user clicks on
+	// the image.
+	deferred bool
 }
 
 var imageCSS = cssutil.Applier("mcontent-image", `
@@ -53,6 +56,12 @@ var imageCSS = cssutil.Applier("mcontent-image", `
 	.mcontent-image:hover > * {
 		filter: contrast(80%) brightness(80%);
 	}
+	.mcontent-image.mcontent-image-blurred > * {
+		filter: blur(16px);
+	}
+	.mcontent-image.mcontent-image-blurred:hover > * {
+		filter: blur(16px) contrast(80%) brightness(80%);
+	}
 	.mcontent-image-errorlabel {
 		color: @error_color;
 		padding: 4px;
@@ -63,15 +72,7 @@ func newImageContent(ctx context.Context, msg *event.RoomMessageEvent) *imageCon
 	embed := newImageEmbed(msg.Body, maxWidth, maxHeight)
 	embed.AddCSSClass("mcontent-image-content")
 	embed.whole = true
-	embed.setOpenURL(func() {
-		u, err := gotktrix.FromContext(ctx).MessageMediaURL(msg)
-		if err != nil {
-			log.Println("image URL error:", err)
-			return
-		}
-
-		app.OpenURI(ctx, u)
-	})
+	embed.setOpenURL(func() { showImageViewer(ctx, msg) })
 
 	c := imageContent{
 		imageEmbed: embed,
@@ -79,9 +80,20 @@ func newImageContent(ctx context.Context, msg *event.RoomMessageEvent) *imageCon
 		msg:        msg,
 	}
 
+	if shouldBlur(ctx, msg) {
+		c.blur()
+	}
+
+	if !AutoLoadMedia(ctx, msg.RoomID) {
+		c.deferLoad()
+	}
+
 	i, err := msg.ImageInfo()
-	if err == nil && i.Width > 0 && i.Height > 0 {
-		c.setSize(i.Width, i.Height)
+	if w, h, ok := mediaSize(i); err == nil && ok {
+		// Reserve the size now, so the message doesn't resize once the image
+		// is loaded.
+		c.setSize(w, h)
+		c.reserved = true
 	} else {
 		// Oversize and resize it back after.
 		c.setSize(maxWidth, maxHeight)
@@ -95,11 +107,51 @@ func (c *imageContent) LoadMore() {
 		renderBlurhash(c.msg.AdditionalInfo, c.curSize[0], c.curSize[1], c.image.SetPixbuf)
 	}
 
+	if !c.deferred {
+		c.loadThumbnail()
+	}
+}
+
+// loadThumbnail loads the server's thumbnail of the image. The full image is
+// only fetched when the user opens it.
+func (c *imageContent) loadThumbnail() {
 	client := gotktrix.FromContext(c.ctx)
 	url, _ := client.ImageThumbnail(c.msg, maxWidth, maxHeight, gtkutil.ScaleFactor())
 	c.imageEmbed.useURL(c.ctx, url)
 }
 
+// deferLoad keeps the image unloaded until the user clicks on it. The first
+// click loads the thumbnail instead of opening the image.
+func (c *imageContent) deferLoad() {
+	openURL := c.openURL
+	tooltip := c.TooltipText()
+
+	c.deferred = true
+	c.SetTooltipText(locale.S(c.ctx, "Click to load"))
+
+	c.openURL = func() {
+		c.deferred = false
+		c.SetTooltipText(tooltip)
+		c.openURL = openURL
+		c.loadThumbnail()
+	}
+}
+
+// blur blurs the image until the user clicks on it. The first click reveals the
+// image instead of opening it.
+func (c *imageContent) blur() {
+	openURL := c.openURL
+
+	c.AddCSSClass("mcontent-image-blurred")
+	c.SetTooltipText(locale.S(c.ctx, "Click to reveal"))
+
+	c.openURL = func() {
+		c.RemoveCSSClass("mcontent-image-blurred")
+		c.SetTooltipText(c.name)
+		c.openURL = openURL
+	}
+}
+
 func (c *imageContent) content() {}
 
 type imageEmbed struct {
@@ -109,6 +161,10 @@ type imageEmbed struct {
 	name    string
 	curSize [2]int
 	maxSize [2]int
+	// reserved, if true, will keep the current size when the image is loaded
+	// instead of resizing to the image's. Use this if the size is known
+	// beforehand.
+	reserved bool
 	// whole, if true, will make errors show in its full information instead of
 	// being hidden behind an error icon. Use this for messages only.
 	whole bool
@@ -143,17 +199,22 @@ func newImageEmbed(name string, maxW, maxH int) *imageEmbed {
 }
 
 func (e *imageEmbed) useURL(ctx context.Context, url string) {
+	size := e.curSize
+	if size == [2]int{} {
+		size = e.maxSize
+	}
+
 	ctx = imgutil.WithOpts(ctx, imgutil.WithErrorFn(e.onError))
 	// Only load the image when we actually draw the image.
-	gtkutil.OnFirstDraw(e, func() {
-		imgutil.AsyncGET(ctx, url, imgutil.ImageSetter{
-			SetFromPaintable: e.setPaintable,
-		})
+	mediautil.AsyncGETScaled(ctx, e, url, size[0], size[1], imgutil.ImageSetter{
+		SetFromPaintable: e.setPaintable,
 	})
 }
 
 func (e *imageEmbed) setPaintable(p gdk.Paintabler) {
-	e.setSize(p.IntrinsicWidth(), p.IntrinsicHeight())
+	if !e.reserved {
+		e.setSize(p.IntrinsicWidth(), p.IntrinsicHeight())
+	}
 	e.image.SetPaintable(p)
 	e.image.QueueResize()
 
@@ -212,6 +273,19 @@ func (e *imageEmbed) setSize(w, h int) {
 	e.SetSizeRequest(w, h)
 }
 
+// mediaSize returns the intended display size of the media from its info,
+// falling back to the size of its thumbnail. False is returned if neither is
+// known.
+func mediaSize(i event.ImageInfo) (w, h int, ok bool) {
+	if i.Width > 0 && i.Height > 0 {
+		return i.Width, i.Height, true
+	}
+	if t := i.ThumbnailInfo; t.Width > 0 && t.Height > 0 {
+		return t.Width, t.Height, true
+	}
+	return 0, 0, false
+}
+
 // maxBlurhash is the maximum width and height for a blurhash-rendered image. It
 // doesn't have to be high resolution, since it's a blob of blur anyway.
 const maxBlurhash = 25
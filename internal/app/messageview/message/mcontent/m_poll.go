@@ -0,0 +1,277 @@
+package mcontent
+
+import (
+	"context"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/poll"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+var pollCSS = cssutil.Applier("mcontent-poll", `
+	.mcontent-poll {
+		padding: 8px;
+		margin-top: 2px;
+	}
+	.mcontent-poll-question {
+		font-weight: bold;
+		margin-bottom: 4px;
+	}
+	.mcontent-poll-answer {
+		margin-bottom: 4px;
+	}
+	.mcontent-poll-answer progressbar {
+		margin-left: 28px;
+	}
+	.mcontent-poll-winner label {
+		font-weight: bold;
+	}
+	.mcontent-poll-status {
+		font-size: 0.9em;
+		color: alpha(@theme_fg_color, 0.75);
+	}
+`)
+
+type pollContent struct {
+	*gtk.Box
+	ctx     context.Context
+	start   *poll.StartEvent
+	tally   *poll.Tally
+	answers []pollAnswer
+	status  *gtk.Label
+	end     *gtk.Button
+
+	// updating is true while the check buttons are being updated to match the
+	// tally, so that they don't cast votes.
+	updating bool
+}
+
+type pollAnswer struct {
+	*gtk.Box
+	id    string
+	check *gtk.CheckButton
+	count *gtk.Label
+	bar   *gtk.ProgressBar
+}
+
+// newPollMessageContent renders a poll, falling back to its body.
+func newPollMessageContent(ctx context.Context, msg *event.RoomMessageEvent) contentPart {
+	start, err := poll.FromMessage(msg)
+	if err != nil {
+		return newTextContent(ctx, msg)
+	}
+	return newPollContent(ctx, start)
+}
+
+func newPollContent(ctx context.Context, start *poll.StartEvent) *pollContent {
+	c := pollContent{
+		ctx:   ctx,
+		start: start,
+		tally: poll.NewTally(start),
+	}
+
+	question := gtk.NewLabel(start.Poll.Question.Text)
+	question.AddCSSClass("mcontent-poll-question")
+	question.SetXAlign(0)
+	question.SetWrap(true)
+	question.SetWrapMode(pango.WrapWordChar)
+	question.SetSelectable(true)
+
+	c.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+	c.Box.AddCSSClass("frame")
+	c.Box.Append(question)
+
+	var group *gtk.CheckButton
+	single := start.MaxVotes() == 1
+
+	c.answers = make([]pollAnswer, len(start.Poll.Answers))
+	for i, answer := range start.Poll.Answers {
+		a := pollAnswer{id: answer.ID}
+
+		a.check = gtk.NewCheckButtonWithLabel(answer.Text)
+		a.check.SetHExpand(true)
+		a.check.ConnectToggled(func() {
+			// Radio buttons are also toggled off when another one is picked.
+			if !c.updating && (!single || a.check.Active()) {
+				c.vote()
+			}
+		})
+
+		// Pick one answer out of many, like a radio button.
+		if single {
+			if group == nil {
+				group = a.check
+			} else {
+				a.check.SetGroup(group)
+			}
+		}
+
+		a.count = gtk.NewLabel("")
+
+		top := gtk.NewBox(gtk.OrientationHorizontal, 4)
+		top.Append(a.check)
+		top.Append(a.count)
+
+		a.bar = gtk.NewProgressBar()
+
+		a.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+		a.AddCSSClass("mcontent-poll-answer")
+		a.Append(top)
+		a.Append(a.bar)
+
+		c.answers[i] = a
+		c.Append(a)
+	}
+
+	c.status = gtk.NewLabel("")
+	c.status.AddCSSClass("mcontent-poll-status")
+	c.status.SetXAlign(0)
+	c.status.SetHExpand(true)
+	c.status.SetWrap(true)
+
+	c.end = gtk.NewButtonWithLabel(locale.S(ctx, "End Poll"))
+	c.end.ConnectClicked(c.endPoll)
+
+	bottom := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	bottom.Append(c.status)
+	bottom.Append(c.end)
+	c.Append(bottom)
+
+	pollCSS(c)
+	c.update()
+
+	return &c
+}
+
+// relatedEvent adds the response or end event to the poll.
+func (c *pollContent) relatedEvent(ev event.RoomEvent) bool {
+	if !c.tally.Add(ev) {
+		return false
+	}
+	c.update()
+	return true
+}
+
+// update updates the poll to match its tally.
+func (c *pollContent) update() {
+	c.updating = true
+	defer func() { c.updating = false }()
+
+	client := gotktrix.FromContext(c.ctx).Offline()
+
+	ended := c.tally.Ended()
+	counts := c.tally.Counts()
+	voters := c.tally.Voters()
+	votes := c.tally.Votes(client.UserID)
+	// Undisclosed polls don't show the results until they're closed.
+	disclosed := ended || c.start.Poll.Kind != poll.Undisclosed
+	// Multiple choice polls only allow picking so many answers.
+	full := len(votes) >= c.start.MaxVotes()
+
+	winners := c.tally.Winners()
+	canVote := !ended && c.start.ID != "" &&
+		client.CanSendEvent(c.start.RoomID, poll.ResponseEventType, false)
+
+	for _, a := range c.answers {
+		voted := containsString(votes, a.id)
+		a.check.SetActive(voted)
+		a.check.SetSensitive(canVote && (voted || !full || c.start.MaxVotes() == 1))
+
+		a.bar.SetVisible(disclosed)
+		a.count.SetVisible(disclosed)
+
+		if !disclosed {
+			continue
+		}
+
+		n := counts[a.id]
+		a.count.SetText(locale.Plural(c.ctx, "%d vote", "%d votes", n))
+
+		if voters > 0 {
+			a.bar.SetFraction(float64(n) / float64(voters))
+		} else {
+			a.bar.SetFraction(0)
+		}
+
+		if ended && containsString(winners, a.id) {
+			a.AddCSSClass("mcontent-poll-winner")
+		} else {
+			a.RemoveCSSClass("mcontent-poll-winner")
+		}
+	}
+
+	voted := locale.Plural(c.ctx, "%d person voted", "%d people voted", voters)
+
+	switch {
+	case ended:
+		c.status.SetText(locale.Sprintf(c.ctx, "Final results. %s.", voted))
+	case !disclosed:
+		c.status.SetText(locale.Sprintf(c.ctx, "Results are shown when the poll ends. %s.", voted))
+	case c.start.MaxVotes() > 1:
+		c.status.SetText(locale.Sprintf(c.ctx, "Choose up to %d answers. %s.", c.start.MaxVotes(), voted))
+	default:
+		c.status.SetText(voted + ".")
+	}
+
+	isAuthor := c.start.Sender == client.UserID && c.start.ID != ""
+	c.end.SetVisible(isAuthor && !ended)
+}
+
+// vote casts the user's vote for the checked answers.
+func (c *pollContent) vote() {
+	answers := make([]string, 0, c.start.MaxVotes())
+	for _, a := range c.answers {
+		if a.check.Active() {
+			answers = append(answers, a.id)
+		}
+	}
+
+	client := gotktrix.FromContext(c.ctx)
+
+	// Show the vote right away. The vote from the server replaces it.
+	c.tally.Vote(client.UserID, answers, matrix.Timestamp(time.Now().UnixMilli()))
+	c.update()
+
+	ev := poll.NewResponseEvent(c.start.RoomID, c.start.ID, answers)
+
+	go func() {
+		if err := client.SendRoomEvent(ev.RoomID, ev); err != nil {
+			app.Error(c.ctx, errors.Wrap(err, "failed to vote"))
+		}
+	}()
+}
+
+// endPoll closes the poll.
+func (c *pollContent) endPoll() {
+	c.end.SetSensitive(false)
+
+	ev := poll.NewEndEvent(c.start.RoomID, c.start.ID)
+	client := gotktrix.FromContext(c.ctx)
+
+	go func() {
+		if err := client.SendRoomEvent(ev.RoomID, ev); err != nil {
+			app.Error(c.ctx, errors.Wrap(err, "failed to end poll"))
+			glib.IdleAdd(func() { c.end.SetSensitive(true) })
+		}
+	}()
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *pollContent) content() {}
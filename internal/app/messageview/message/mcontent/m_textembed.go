@@ -8,7 +8,6 @@ import (
 	"path"
 	"strings"
 
-	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotk4/pkg/pango"
 	"github.com/diamondburned/gotkit/app"
@@ -17,6 +16,7 @@ import (
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 	"github.com/diamondburned/gotkit/gtkutil/textutil"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/ctxutil"
 	"github.com/diamondburned/gotrix/api"
 )
 
@@ -60,11 +60,12 @@ var enableEmbeds = prefs.NewBool(true, prefs.PropMeta{
 })
 
 func loadEmbeds(ctx context.Context, box *gtk.Box, urls []string) {
-	if !enableEmbeds.Value() {
+	client := gotktrix.FromContext(ctx)
+	if !enableEmbeds.Value() || client.PrivacyMode() || client.LowDataMode() || client.TextOnlyMode() {
 		return
 	}
 
-	go func() {
+	ctxutil.Async(ctx, box, func(ctx context.Context) func() {
 		client := gotktrix.FromContext(ctx)
 
 		// Workaround to keep track of inserted URLs. The actual problem is that
@@ -100,7 +101,9 @@ func loadEmbeds(ctx context.Context, box *gtk.Box, urls []string) {
 				continue
 			}
 		}
-	}()
+
+		return nil
+	})
 }
 
 func addTextEmbed(ctx context.Context, box *gtk.Box, m *api.URLMetadata) {
@@ -110,7 +113,7 @@ func addTextEmbed(ctx context.Context, box *gtk.Box, m *api.URLMetadata) {
 	imageURL, _ := client.ScaledThumbnail(m.Image,
 		embedImageWidth, embedImageHeight, gtkutil.ScaleFactor())
 
-	glib.IdleAdd(func() {
+	gtkutil.IdleCtx(ctx, func() {
 		b := gtk.NewBox(gtk.OrientationVertical, 0)
 		b.SetHExpand(true)
 		b.AddCSSClass("mcontent-embed-body")
@@ -177,7 +180,7 @@ func addImageEmbed(ctx context.Context, box *gtk.Box, m *api.URLMetadata) {
 	client := gotktrix.FromContext(ctx)
 	imageURL, _ := client.ScaledThumbnail(m.Image, maxWidth, maxHeight, gtkutil.ScaleFactor())
 
-	glib.IdleAdd(func() {
+	gtkutil.IdleCtx(ctx, func() {
 		embed := newImageEmbed(name, maxWidth, maxHeight)
 		embed.AddCSSClass("mcontent-image-embed")
 		embed.useURL(ctx, imageURL)
@@ -6,9 +6,11 @@ import (
 
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
 	"github.com/diamondburned/gotkit/gtkutil"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 	"github.com/diamondburned/gotkit/gtkutil/imgutil"
+	"github.com/diamondburned/gotktrix/internal/components/pip"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
 	"github.com/diamondburned/gotktrix/internal/gtkutil/mediautil"
 	"github.com/diamondburned/gotrix/event"
@@ -22,6 +24,9 @@ type videoContent struct {
 	thumbURL string
 	url      string
 	size     [2]int
+	// autoLoad is false if the thumbnail should only be loaded when the user
+	// plays the video.
+	autoLoad bool
 }
 
 var videoCSS = cssutil.Applier("mcontent-video", `
@@ -55,15 +60,13 @@ func newVideoContent(ctx context.Context, msg *event.RoomMessageEvent) contentPa
 	preview.SetKeepAspectRatio(true)
 	preview.SetHAlign(gtk.AlignStart)
 
-	w := maxWidth
-	h := maxHeight
+	w, h := videoSize(msg)
 
 	var thumbnailURL string
 
 	v, err := msg.VideoInfo()
 	if err == nil {
-		w, h = gotktrix.MaxSize(v.Width, v.Height, w, h)
-		if v.Height > 0 && v.Width > 0 {
+		if _, _, ok := mediaSize(v.ImageInfo); ok {
 			renderBlurhash(msg.AdditionalInfo, w, h, preview.SetPixbuf)
 		}
 		if v.ThumbnailURL != "" {
@@ -94,12 +97,31 @@ func newVideoContent(ctx context.Context, msg *event.RoomMessageEvent) contentPa
 
 	url, urlErr := client.MessageMediaURL(msg)
 
-	play.ConnectClicked(func() {
-		if urlErr != nil {
-			app.Error(ctx, urlErr)
-			return
+	openURL := func(f func()) func() {
+		return func() {
+			if urlErr != nil {
+				app.Error(ctx, urlErr)
+				return
+			}
+			f()
 		}
-		app.OpenURI(ctx, url)
+	}
+
+	play.ConnectClicked(openURL(func() { app.OpenURI(ctx, url) }))
+
+	gtkutil.BindActionMap(play, map[string]func(){
+		"video.open-external": openURL(func() { app.OpenURI(ctx, url) }),
+		"video.pop-out":       openURL(func() { pip.Play(ctx, msg.Body, url) }),
+	})
+
+	gtkutil.BindRightClick(play, func() {
+		s := locale.SFunc(ctx)
+
+		p := gtkutil.NewPopoverMenuCustom(play, gtk.PosBottom, []gtkutil.PopoverMenuItem{
+			gtkutil.MenuItem(s("Open Externally"), "video.open-external"),
+			gtkutil.MenuItem(s("Play in Pop-out Window"), "video.pop-out"),
+		})
+		gtkutil.PopupFinally(p)
 	})
 
 	return videoContent{
@@ -109,12 +131,33 @@ func newVideoContent(ctx context.Context, msg *event.RoomMessageEvent) contentPa
 		thumbURL:  thumbnailURL,
 		url:       url,
 		size:      [2]int{w, h},
+		autoLoad:  AutoLoadMedia(ctx, msg.RoomID),
+	}
+}
+
+// videoSize returns the size of the video message's preview.
+func videoSize(msg *event.RoomMessageEvent) (w, h int) {
+	w = maxWidth
+	h = maxHeight
+
+	v, err := msg.VideoInfo()
+	if err == nil {
+		if vw, vh, ok := mediaSize(v.ImageInfo); ok {
+			w, h = gotktrix.MaxSize(vw, vh, w, h)
+		}
 	}
+
+	return w, h
 }
 
 func (c videoContent) LoadMore() {
+	if !c.autoLoad {
+		return
+	}
+
 	if c.thumbURL != "" {
-		imgutil.AsyncGET(c.ctx, c.thumbURL, imgutil.ImageSetterFromPicture(c.preview))
+		mediautil.AsyncGETScaled(c.ctx, c.preview, c.thumbURL, c.size[0], c.size[1],
+			imgutil.ImageSetterFromPicture(c.preview))
 		return
 	}
 
@@ -195,6 +195,12 @@ func newReaction(ctx context.Context, ev *m.ReactionEvent) *reaction {
 	uID, _ := client.Whoami()
 	if uID == ev.Sender {
 		btn.SetActive(true)
+	} else if !client.CanSendEvent(ev.RoomID, m.ReactionEventType, false) {
+		// Users can always take back their own reactions, but they can't add
+		// new ones without permission.
+		btn.SetSensitive(false)
+		btn.SetTooltipText(locale.S(ctx,
+			"You don't have the permission to react in this room."))
 	}
 
 	child := gtk.NewFlowBoxChild()
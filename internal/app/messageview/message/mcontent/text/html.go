@@ -15,6 +15,7 @@ import (
 	"github.com/diamondburned/gotkit/gtkutil/textutil"
 	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/mediautil"
 	"github.com/diamondburned/gotktrix/internal/md"
 	"github.com/diamondburned/gotrix/matrix"
 	"golang.org/x/net/html"
@@ -425,11 +426,25 @@ func (s *renderState) renderNode(n *html.Node) traverseStatus {
 				return traverseOK
 			}
 
+			client := gotktrix.FromContext(s.ctx).Offline()
+
+			// Show the alternative text instead of the image in text-only
+			// mode, which is usually the emoji name.
+			if client.TextOnlyMode() {
+				alt := nodeAttr(n, "alt")
+				if alt == "" {
+					alt = "image"
+				}
+
+				text := s.block.richText()
+				md.InsertAltPill(text.TextView, text.buf.CreateChildAnchor(text.iter), alt)
+				md.InsertInvisible(text.iter, alt)
+				return traverseOK
+			}
+
 			var w, h int
 			var url string
 
-			client := gotktrix.FromContext(s.ctx).Offline()
-
 			// TODO: consider if it's a better idea to only allow emoticons to
 			// be inlined. As far as I know, nothing except emojis are really
 			// good for being inlined, but that might not cover everything.
@@ -459,7 +474,7 @@ func (s *renderState) renderNode(n *html.Node) traverseStatus {
 			image.AddCSSClass("mcontent-inline-image")
 			image.SetSizeRequest(w, h)
 
-			imgutil.AsyncGET(s.ctx, url, imgutil.ImageSetter{
+			mediautil.AsyncGETScaled(s.ctx, image, url, w, h, imgutil.ImageSetter{
 				SetFromPaintable: image.SetFromPaintable,
 				SetFromPixbuf:    image.SetFromPixbuf,
 			})
@@ -0,0 +1,140 @@
+package text
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/diamondburned/gotktrix/internal/md"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/yuin/goldmark/ast"
+	"golang.org/x/net/html"
+)
+
+// RenderPreview renders the given message into a single line of plain text
+// that's suitable for previews. Markdown and HTML markup are stripped, custom
+// emojis and images are replaced with their alt text and reply fallbacks are
+// removed.
+func RenderPreview(ev *event.RoomMessageEvent) string {
+	var text string
+	if ev.Format == event.FormatHTML && ev.FormattedBody != "" {
+		text = previewHTML(ev.FormattedBody)
+	} else {
+		text = previewMarkdown(ev.Body, isReply(ev))
+	}
+
+	// Collapse all whitespaces, including new lines, into single spaces. Raw
+	// mxc URLs are useless to the user, so they're replaced as well.
+	words := strings.Fields(text)
+	for i, word := range words {
+		if strings.HasPrefix(word, "mxc://") {
+			words[i] = imagePlaceholder
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// imagePlaceholder is the text shown in place of images without an alt text.
+const imagePlaceholder = "[image]"
+
+func isReply(ev *event.RoomMessageEvent) bool {
+	var relatesTo struct {
+		InReplyTo *json.RawMessage `json:"m.in_reply_to"`
+	}
+	json.Unmarshal(ev.RelatesTo, &relatesTo)
+	return relatesTo.InReplyTo != nil
+}
+
+func previewHTML(formatted string) string {
+	n, err := html.Parse(strings.NewReader(formatted))
+	if err != nil {
+		return formatted
+	}
+
+	var b strings.Builder
+	previewHTMLNode(&b, n)
+	return b.String()
+}
+
+func previewHTMLNode(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(n.Data)
+		return
+	case html.ElementNode:
+		switch n.Data {
+		case "mx-reply":
+			return
+		case "img":
+			b.WriteString(imageAltText(nodeAttr(n, "alt", "title")))
+			return
+		case "br", "p", "div", "li", "tr", "blockquote", "pre",
+			"h1", "h2", "h3", "h4", "h5", "h6":
+			b.WriteByte(' ')
+		}
+	}
+
+	for n := n.FirstChild; n != nil; n = n.NextSibling {
+		previewHTMLNode(b, n)
+	}
+}
+
+// imageAltText returns the text that an inline image should be replaced with.
+// The image's URL is never returned.
+func imageAltText(alt string) string {
+	if alt != "" && !strings.HasPrefix(alt, "mxc://") {
+		return alt
+	}
+	return imagePlaceholder
+}
+
+func previewMarkdown(body string, reply bool) string {
+	src := []byte(body)
+
+	var b strings.Builder
+	var skippedReply bool
+
+	err := md.ParseAndWalk(src, func(n ast.Node, enter bool) (ast.WalkStatus, error) {
+		if !enter {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Blockquote:
+			// Skip the reply fallback, which is the first quote block.
+			if reply && !skippedReply {
+				skippedReply = true
+				return ast.WalkSkipChildren, nil
+			}
+		case *ast.Paragraph, *ast.Heading, *ast.FencedCodeBlock:
+			b.WriteByte(' ')
+			if code, ok := n.(*ast.FencedCodeBlock); ok {
+				lines := code.Lines()
+				for i := 0; i < lines.Len(); i++ {
+					line := lines.At(i)
+					b.Write(line.Value(src))
+				}
+				return ast.WalkSkipChildren, nil
+			}
+		case *ast.Text:
+			b.Write(n.Segment.Value(src))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		case *ast.AutoLink:
+			b.Write(n.URL(src))
+		case *ast.RawHTML:
+			// Drop inline HTML tags.
+			return ast.WalkSkipChildren, nil
+		}
+
+		return ast.WalkContinue, nil
+	})
+	if err != nil {
+		return body
+	}
+
+	return b.String()
+}
@@ -0,0 +1,426 @@
+package mcontent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gdkpixbuf/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/imgutil"
+	"github.com/diamondburned/gotktrix/internal/components/filepick"
+	"github.com/diamondburned/gotktrix/internal/components/progress"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	// maxZoom is the maximum zoom level relative to the image's actual size.
+	maxZoom = 8
+	// zoomStep is the factor that the zoom level changes by for every step.
+	zoomStep = 1.25
+)
+
+var viewerCSS = cssutil.Applier("mcontent-viewer", `
+	.mcontent-viewer scrolledwindow {
+		background-color: black;
+	}
+	.mcontent-viewer-error {
+		color: @error_color;
+	}
+`)
+
+// imageViewer is a window that shows an image message at its full size. The
+// user can zoom, pan and rotate the image, go through the other images in the
+// room and save the original file.
+type imageViewer struct {
+	*gtk.Window
+	ctx context.Context
+
+	title   *gtk.Label
+	scroll  *gtk.ScrolledWindow
+	picture *gtk.Picture
+	spinner *gtk.Spinner
+	brev    *gtk.Revealer
+
+	images []*event.RoomMessageEvent
+	index  int
+
+	// pixbuf is the loaded image with the rotation applied.
+	pixbuf *gdkpixbuf.Pixbuf
+	// zoom is the zoom level relative to the image's actual size. A zero zoom
+	// means that the image is fit into the window.
+	zoom float64
+	// cancel cancels loading the current image.
+	cancel context.CancelFunc
+}
+
+// showImageViewer opens the image viewer on the given image message.
+func showImageViewer(ctx context.Context, msg *event.RoomMessageEvent) {
+	images := roomImages(ctx, msg)
+
+	v := imageViewer{
+		ctx:    ctx,
+		images: images,
+		cancel: func() {},
+	}
+
+	for i, img := range images {
+		if img.ID == msg.ID {
+			v.index = i
+			break
+		}
+	}
+
+	v.title = gtk.NewLabel("")
+	v.title.AddCSSClass("title")
+	v.title.SetEllipsize(pango.EllipsizeMiddle)
+
+	button := func(icon, tooltip string, f func()) *gtk.Button {
+		b := gtk.NewButtonFromIconName(icon)
+		b.SetTooltipText(tooltip)
+		b.ConnectClicked(f)
+		return b
+	}
+
+	header := gtk.NewHeaderBar()
+	header.SetTitleWidget(v.title)
+	header.PackStart(button("go-previous-symbolic", locale.S(ctx, "Previous Image"), func() { v.move(-1) }))
+	header.PackStart(button("go-next-symbolic", locale.S(ctx, "Next Image"), func() { v.move(+1) }))
+	header.PackEnd(button("document-save-as-symbolic", locale.S(ctx, "Save As..."), v.save))
+	header.PackEnd(button("object-rotate-right-symbolic", locale.S(ctx, "Rotate Right"), func() {
+		v.rotate(gdkpixbuf.PixbufRotateClockwise)
+	}))
+	header.PackEnd(button("object-rotate-left-symbolic", locale.S(ctx, "Rotate Left"), func() {
+		v.rotate(gdkpixbuf.PixbufRotateCounterclockwise)
+	}))
+	header.PackEnd(button("zoom-fit-best-symbolic", locale.S(ctx, "Fit to Window"), func() { v.setZoom(0) }))
+	header.PackEnd(button("zoom-in-symbolic", locale.S(ctx, "Zoom In"), func() { v.zoomBy(zoomStep) }))
+	header.PackEnd(button("zoom-out-symbolic", locale.S(ctx, "Zoom Out"), func() { v.zoomBy(1 / zoomStep) }))
+
+	v.picture = gtk.NewPicture()
+	v.picture.SetKeepAspectRatio(true)
+	v.picture.SetHAlign(gtk.AlignCenter)
+	v.picture.SetVAlign(gtk.AlignCenter)
+
+	v.spinner = gtk.NewSpinner()
+	v.spinner.SetSizeRequest(32, 32)
+	v.spinner.SetHAlign(gtk.AlignCenter)
+	v.spinner.SetVAlign(gtk.AlignCenter)
+
+	overlay := gtk.NewOverlay()
+	overlay.SetChild(v.picture)
+	overlay.AddOverlay(v.spinner)
+
+	v.scroll = gtk.NewScrolledWindow()
+	v.scroll.SetVExpand(true)
+	v.scroll.SetHExpand(true)
+	v.scroll.SetChild(overlay)
+
+	v.brev = gtk.NewRevealer()
+	v.brev.SetTransitionType(gtk.RevealerTransitionTypeSlideUp)
+	v.brev.SetRevealChild(false)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(v.scroll)
+	box.Append(v.brev)
+
+	v.Window = gtk.NewWindow()
+	v.Window.SetTransientFor(app.GTKWindowFromContext(ctx))
+	v.Window.SetModal(true)
+	v.Window.SetDestroyWithParent(true)
+	v.Window.SetTitlebar(header)
+	v.Window.SetChild(box)
+	v.Window.ConnectCloseRequest(func() bool {
+		v.cancel()
+		return false
+	})
+	viewerCSS(v.Window)
+
+	if parent := app.GTKWindowFromContext(ctx); parent != nil {
+		v.Window.SetDefaultSize(parent.AllocatedWidth(), parent.AllocatedHeight())
+	}
+
+	v.bindPan()
+	v.bindZoomScroll()
+
+	keys := gtk.NewEventControllerKey()
+	keys.ConnectKeyPressed(v.onKey)
+	v.Window.AddController(keys)
+
+	v.load()
+	v.Window.Maximize()
+	v.Window.Show()
+}
+
+// roomImages returns the image messages in the room's stored timeline. The
+// given message is always included, even if it's too old to be stored.
+func roomImages(ctx context.Context, msg *event.RoomMessageEvent) []*event.RoomMessageEvent {
+	client := gotktrix.FromContext(ctx).Offline()
+
+	var images []*event.RoomMessageEvent
+	var found bool
+
+	client.EachTimeline(msg.RoomID, func(ev event.RoomEvent) error {
+		img, ok := ev.(*event.RoomMessageEvent)
+		if ok && img.MessageType == event.RoomMessageImage && gotktrix.ReplacementOf(img) == "" {
+			images = append(images, img)
+			found = found || img.ID == msg.ID
+		}
+		return nil
+	})
+
+	if !found {
+		images = []*event.RoomMessageEvent{msg}
+	}
+
+	return images
+}
+
+func (v *imageViewer) onKey(val, _ uint, state gdk.ModifierType) bool {
+	switch val {
+	case gdk.KEY_Escape:
+		v.Window.Close()
+	case gdk.KEY_Left, gdk.KEY_Page_Up:
+		v.move(-1)
+	case gdk.KEY_Right, gdk.KEY_Page_Down:
+		v.move(+1)
+	case gdk.KEY_plus, gdk.KEY_equal, gdk.KEY_KP_Add:
+		v.zoomBy(zoomStep)
+	case gdk.KEY_minus, gdk.KEY_KP_Subtract:
+		v.zoomBy(1 / zoomStep)
+	case gdk.KEY_0, gdk.KEY_KP_0:
+		v.setZoom(0)
+	case gdk.KEY_1, gdk.KEY_KP_1:
+		v.setZoom(1)
+	case gdk.KEY_r:
+		v.rotate(gdkpixbuf.PixbufRotateClockwise)
+	case gdk.KEY_R:
+		v.rotate(gdkpixbuf.PixbufRotateCounterclockwise)
+	case gdk.KEY_s:
+		if !state.Has(gdk.ControlMask) {
+			return false
+		}
+		v.save()
+	default:
+		return false
+	}
+	return true
+}
+
+// bindPan lets the user pan the image by dragging it around.
+func (v *imageViewer) bindPan() {
+	var start [2]float64
+
+	drag := gtk.NewGestureDrag()
+	drag.ConnectDragBegin(func(x, y float64) {
+		start = [2]float64{
+			v.scroll.HAdjustment().Value(),
+			v.scroll.VAdjustment().Value(),
+		}
+	})
+	drag.ConnectDragUpdate(func(x, y float64) {
+		v.scroll.HAdjustment().SetValue(start[0] - x)
+		v.scroll.VAdjustment().SetValue(start[1] - y)
+	})
+	v.scroll.AddController(drag)
+}
+
+// bindZoomScroll lets the user zoom by scrolling while holding Control.
+func (v *imageViewer) bindZoomScroll() {
+	scroll := gtk.NewEventControllerScroll(gtk.EventControllerScrollVertical)
+	scroll.SetPropagationPhase(gtk.PhaseCapture)
+	scroll.ConnectScroll(func(_, dy float64) bool {
+		if !scroll.CurrentEventState().Has(gdk.ControlMask) {
+			return false
+		}
+		if dy < 0 {
+			v.zoomBy(zoomStep)
+		} else {
+			v.zoomBy(1 / zoomStep)
+		}
+		return true
+	})
+	v.scroll.AddController(scroll)
+}
+
+// move moves to the image that's delta images away from the current one.
+func (v *imageViewer) move(delta int) {
+	i := v.index + delta
+	if i < 0 || i >= len(v.images) {
+		return
+	}
+	v.index = i
+	v.load()
+}
+
+// load loads the current image at its full size.
+func (v *imageViewer) load() {
+	v.cancel()
+
+	msg := v.images[v.index]
+
+	title := msg.Body
+	if len(v.images) > 1 {
+		title = locale.Sprintf(v.ctx, "%s (%d of %d)", msg.Body, v.index+1, len(v.images))
+	}
+	v.title.SetText(title)
+	v.Window.SetTitle(app.FromContext(v.ctx).SuffixedTitle(msg.Body))
+
+	v.pixbuf = nil
+	v.zoom = 0
+	v.picture.SetPixbuf(nil)
+	v.picture.RemoveCSSClass("mcontent-viewer-error")
+	v.spinner.Start()
+	v.spinner.Show()
+
+	url, err := gotktrix.FromContext(v.ctx).MessageMediaURL(msg)
+	if err != nil {
+		v.onError(err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(v.ctx)
+	v.cancel = cancel
+
+	ctx = imgutil.WithOpts(ctx, imgutil.WithErrorFn(func(err error) {
+		if ctx.Err() == nil {
+			v.onError(err)
+		}
+	}))
+
+	imgutil.AsyncGET(ctx, url, imgutil.ImageSetter{
+		SetFromPixbuf: func(p *gdkpixbuf.Pixbuf) {
+			v.spinner.Stop()
+			v.spinner.Hide()
+			v.pixbuf = p
+			v.picture.SetPixbuf(p)
+			v.invalidateZoom()
+		},
+	})
+}
+
+func (v *imageViewer) onError(err error) {
+	v.spinner.Stop()
+	v.spinner.Hide()
+	v.picture.SetPaintable(imgutil.IconPaintable("image-missing", 64, 64))
+	v.picture.SetTooltipText(err.Error())
+	v.picture.AddCSSClass("mcontent-viewer-error")
+}
+
+// rotate rotates the loaded image. The rotation isn't kept when going to
+// another image.
+func (v *imageViewer) rotate(rotation gdkpixbuf.PixbufRotation) {
+	if v.pixbuf == nil {
+		return
+	}
+	v.pixbuf = v.pixbuf.RotateSimple(rotation)
+	v.picture.SetPixbuf(v.pixbuf)
+	v.invalidateZoom()
+}
+
+// fitZoom returns the zoom level at which the image fits the window.
+func (v *imageViewer) fitZoom() float64 {
+	if v.pixbuf == nil {
+		return 1
+	}
+	w := float64(v.scroll.AllocatedWidth()) / float64(v.pixbuf.Width())
+	h := float64(v.scroll.AllocatedHeight()) / float64(v.pixbuf.Height())
+	return math.Min(1, math.Min(w, h))
+}
+
+func (v *imageViewer) zoomBy(factor float64) {
+	zoom := v.zoom
+	if zoom == 0 {
+		zoom = v.fitZoom()
+	}
+	v.setZoom(zoom * factor)
+}
+
+// setZoom sets the zoom level. The image can't be zoomed out further than the
+// window's size; zooming out that far makes the image fit the window again.
+func (v *imageViewer) setZoom(zoom float64) {
+	if zoom != 0 && zoom <= v.fitZoom() {
+		zoom = 0
+	}
+	v.zoom = math.Min(zoom, maxZoom)
+	v.invalidateZoom()
+}
+
+func (v *imageViewer) invalidateZoom() {
+	if v.pixbuf == nil || v.zoom == 0 {
+		v.picture.SetCanShrink(true)
+		v.picture.SetSizeRequest(-1, -1)
+		return
+	}
+
+	v.picture.SetCanShrink(false)
+	v.picture.SetSizeRequest(
+		int(float64(v.pixbuf.Width())*v.zoom),
+		int(float64(v.pixbuf.Height())*v.zoom),
+	)
+}
+
+// save asks the user where to save the current image, then downloads the
+// original file there.
+func (v *imageViewer) save() {
+	msg := v.images[v.index]
+
+	url, err := gotktrix.FromContext(v.ctx).MessageMediaURL(msg)
+	if err != nil {
+		app.Error(v.ctx, err)
+		return
+	}
+
+	chooser := filepick.NewWithWindow(
+		v.Window, locale.S(v.ctx, "Save Image"),
+		gtk.FileChooserActionSave,
+		locale.S(v.ctx, "Save"),
+		locale.S(v.ctx, "Cancel"),
+	)
+	chooser.SetCurrentName(msg.Body)
+	chooser.ConnectAccept(func() {
+		if path := chooser.File().Path(); path != "" {
+			v.saveTo(url, path, msg)
+		}
+	})
+	chooser.Show()
+}
+
+func (v *imageViewer) saveTo(url, path string, msg *event.RoomMessageEvent) {
+	bar := progress.NewBar()
+	if info, err := msg.FileInfo(); err == nil && info.Size > 0 {
+		bar.SetMax(int64(info.Size))
+		bar.SetLabelFunc(func(n, max int64) string {
+			return fmt.Sprintf(
+				"%s (%.0f%%)",
+				humanize.Bytes(uint64(n)), float64(n)/float64(max)*100,
+			)
+		})
+	}
+
+	v.brev.SetChild(bar)
+	v.brev.SetRevealChild(true)
+
+	go func() {
+		err := progress.Download(v.ctx, url, path, bar)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Println("cannot save image:", err)
+			return
+		}
+
+		glib.IdleAdd(func() {
+			v.brev.SetRevealChild(false)
+			bar.Unparent()
+		})
+	}()
+}
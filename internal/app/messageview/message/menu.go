@@ -7,12 +7,15 @@ import (
 
 	"github.com/diamondburned/adaptive"
 	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotkit/app"
 	"github.com/diamondburned/gotkit/app/locale"
 	"github.com/diamondburned/gotkit/components/dialogs"
 	"github.com/diamondburned/gotkit/gtkutil"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/app/roomdialog"
+	"github.com/diamondburned/gotktrix/internal/components/progress"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
 	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
 	"github.com/diamondburned/gotktrix/internal/md/hl"
@@ -33,29 +36,118 @@ func bindParent(
 
 	actions := map[string]func(){
 		"message.show-source": func() { showMsgSource(v.Context, v.event) },
-		"message.reply":       func() { v.MessageViewer.ReplyTo(roomEv.ID) },
-		"message.react":       func() { reactor.showEmoji(parent) },
-		"message.react-text":  func() { reactor.showEntry(parent) },
 	}
 
-	client := v.client()
+	// The menu is built in the main thread, so only check the permissions
+	// against the state.
+	client := v.client().Offline()
+
+	canReply := client.CanSendEvent(roomEv.RoomID, event.TypeRoomMessage, false)
+	if canReply {
+		actions["message.reply"] = func() { v.MessageViewer.ReplyTo(roomEv.ID) }
+	}
+
+	_, isMessage := v.event.(*event.RoomMessageEvent)
+	canQuote := canReply && isMessage
+	if canQuote {
+		actions["message.quote"] = func() { quoteMessage(v, parent) }
+	}
+
+	// Threads can't be nested, so messages in a thread can't start one.
+	canThread := canReply && isMessage && gotktrix.ThreadOf(v.event) == ""
+	if canThread {
+		actions["message.reply-in-thread"] = func() { v.MessageViewer.OpenThread(roomEv.ID) }
+	}
+
+	canReact := client.CanSendEvent(roomEv.RoomID, m.ReactionEventType, false)
+	if canReact {
+		actions["message.react"] = func() { reactor.showEmoji(parent) }
+		actions["message.react-text"] = func() { reactor.showEntry(parent) }
+	}
 
 	isSelf := client.UserID == roomEv.Sender
-	if isSelf {
+	// Only messages can be edited, which excludes polls.
+	canEdit := isSelf && isMessage
+	if canEdit {
 		actions["message.edit"] = func() { v.MessageViewer.Edit(roomEv.ID) }
 	}
 
+	deleteLabel := locale.S(v, "_Delete")
+
 	canRedact := isSelf || client.HasPower(roomEv.RoomID, gotktrix.RedactAction)
-	if canRedact {
+	switch {
+	case canRedact && isSelf:
 		actions["message.delete"] = func() { redactMessage(v) }
+	case canRedact:
+		// Moderators are asked for a reason, since the sender will see it.
+		deleteLabel = locale.S(v, "_Delete...")
+		actions["message.delete"] = func() { removeMessage(v) }
+	}
+
+	// Moderators can clean up after spammers in one go.
+	canRemoveRecent := !isSelf && client.HasPower(roomEv.RoomID, gotktrix.RedactAction)
+	if canRemoveRecent {
+		actions["message.remove-recent"] = func() { removeRecentMessages(v) }
+	}
+
+	canKick := !isSelf && client.ExplainAction(roomEv.RoomID, gotktrix.KickAction, roomEv.Sender).Allowed
+	if canKick {
+		actions["message.kick"] = func() {
+			roomdialog.Moderate(v, roomEv.RoomID, roomEv.Sender, gotktrix.KickAction)
+		}
+	}
+
+	canBan := !isSelf && client.ExplainAction(roomEv.RoomID, gotktrix.BanAction, roomEv.Sender).Allowed
+	if canBan {
+		actions["message.ban"] = func() {
+			roomdialog.Moderate(v, roomEv.RoomID, roomEv.Sender, gotktrix.BanAction)
+		}
+	}
+
+	isMuted := client.IsMuted(roomEv.RoomID, roomEv.Sender)
+	canMute := !isSelf && client.CanMute(roomEv.RoomID, roomEv.Sender, !isMuted)
+	if canMute {
+		actions["message.mute"] = func() {
+			roomdialog.SetMuted(v, roomEv.RoomID, roomEv.Sender, !isMuted)
+		}
+	}
+
+	muteLabel := locale.S(v, "M_ute Sender")
+	if isMuted {
+		muteLabel = locale.S(v, "Unm_ute Sender")
+	}
+
+	actions["message.select"] = func() { v.MessageViewer.SelectMessages(roomEv.ID) }
+
+	isHidden := client.EventIsHidden(roomEv.RoomID, roomEv.ID)
+	actions["message.hide"] = func() { v.MessageViewer.SetHidden(roomEv.ID, !isHidden) }
+
+	hideLabel := locale.S(v, "_Hide for Me")
+	if isHidden {
+		hideLabel = locale.S(v, "Un_hide")
+	}
+
+	// Reporting our own messages makes no sense.
+	canReport := !isSelf
+	if canReport {
+		actions["message.report"] = func() { reportMessage(v, canRedact) }
 	}
 
 	menuItems := []gtkutil.PopoverMenuItem{
-		gtkutil.MenuItem(locale.S(v, "_Edit"), "message.edit", isSelf),
-		gtkutil.MenuItem(locale.S(v, "_Reply"), "message.reply"),
-		gtkutil.MenuItem(locale.S(v, "Add Rea_ction"), "message.react"),
-		gtkutil.MenuItem(locale.S(v, "Add Reaction with _Text"), "message.react-text"),
-		gtkutil.MenuItem(locale.S(v, "_Delete"), "message.delete", canRedact),
+		gtkutil.MenuItem(locale.S(v, "_Edit"), "message.edit", canEdit),
+		gtkutil.MenuItem(locale.S(v, "_Reply"), "message.reply", canReply),
+		gtkutil.MenuItem(locale.S(v, "Reply in _Thread"), "message.reply-in-thread", canThread),
+		gtkutil.MenuItem(locale.S(v, "_Quote"), "message.quote", canQuote),
+		gtkutil.MenuItem(locale.S(v, "Add Rea_ction"), "message.react", canReact),
+		gtkutil.MenuItem(locale.S(v, "Add Reaction with _Text"), "message.react-text", canReact),
+		gtkutil.MenuItem(deleteLabel, "message.delete", canRedact),
+		gtkutil.MenuItem(locale.S(v, "Remove Recent _Messages..."), "message.remove-recent", canRemoveRecent),
+		gtkutil.MenuItem(muteLabel, "message.mute", canMute),
+		gtkutil.MenuItem(locale.S(v, "_Kick Sender..."), "message.kick", canKick),
+		gtkutil.MenuItem(locale.S(v, "_Ban Sender..."), "message.ban", canBan),
+		gtkutil.MenuItem(locale.S(v, "_Select to Copy as Quote"), "message.select"),
+		gtkutil.MenuItem(hideLabel, "message.hide"),
+		gtkutil.MenuItem(locale.S(v, "Re_port..."), "message.report", canReport),
 		gtkutil.MenuItem(locale.S(v, "Show _Source"), "message.show-source"),
 	}
 
@@ -84,9 +176,249 @@ func redactMessage(v messageViewer) {
 	client := v.client()
 	roomEv := v.event.RoomInfo()
 
-	if err := client.Redact(roomEv.RoomID, roomEv.ID, ""); err != nil {
-		app.Error(v, errors.Wrap(err, "cannot delete message"))
+	gtkutil.Async(v, func() func() {
+		if err := client.Redact(roomEv.RoomID, roomEv.ID, ""); err != nil {
+			return func() { app.Error(v, errors.Wrap(err, "cannot delete message")) }
+		}
+		return nil
+	})
+}
+
+var removeCSS = cssutil.Applier("message-remove", `
+	.message-remove {
+		padding: 15px;
+	}
+	.message-remove > entry {
+		margin-top: 8px;
 	}
+`)
+
+// removeMessage asks a moderator for the reason to delete someone else's
+// message for, and then deletes it.
+func removeMessage(v messageViewer) {
+	roomEv := v.event.RoomInfo()
+
+	label := gtk.NewLabel(locale.S(v,
+		"This message will be deleted for everyone. This cannot be undone."))
+	label.SetWrap(true)
+	label.SetXAlign(0)
+
+	reason := gtk.NewEntry()
+	reason.SetPlaceholderText(locale.S(v, "Reason (optional)"))
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(label)
+	box.Append(reason)
+	removeCSS(box)
+
+	d := dialogs.NewLocalize(v, "Cancel", "Delete")
+	d.SetTitle(locale.S(v, "Delete Message"))
+	d.SetDefaultSize(350, -1)
+	d.SetChild(box)
+	d.BindEnterOK()
+	d.BindCancelClose()
+	d.OK.AddCSSClass("destructive-action")
+
+	d.OK.ConnectClicked(func() {
+		why := reason.Text()
+		client := v.client()
+
+		d.Close()
+		d.Destroy()
+
+		gtkutil.Async(v, func() func() {
+			if err := client.Redact(roomEv.RoomID, roomEv.ID, why); err != nil {
+				return func() { app.Error(v, errors.Wrap(err, "cannot delete message")) }
+			}
+			return nil
+		})
+	})
+
+	d.Show()
+}
+
+var reportCSS = cssutil.Applier("message-report", `
+	.message-report {
+		padding: 15px;
+	}
+	.message-report > entry {
+		margin: 8px 0 4px 0;
+	}
+`)
+
+// reportMessage shows a dialog asking for the reason to report the message for.
+// If canRedact is true, then the user can also choose to delete the message. The
+// user can always choose to hide the message locally.
+func reportMessage(v messageViewer, canRedact bool) {
+	roomEv := v.event.RoomInfo()
+
+	label := gtk.NewLabel(locale.S(v,
+		"This message will be reported to the administrators of your homeserver."))
+	label.SetWrap(true)
+	label.SetXAlign(0)
+
+	reason := gtk.NewEntry()
+	reason.SetPlaceholderText(locale.S(v, "Reason (optional)"))
+
+	redact := gtk.NewCheckButtonWithLabel(locale.S(v, "Also delete this message"))
+	redact.SetVisible(canRedact)
+
+	hide := gtk.NewCheckButtonWithLabel(locale.S(v, "Hide this message for me"))
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(label)
+	box.Append(reason)
+	box.Append(redact)
+	box.Append(hide)
+	reportCSS(box)
+
+	d := dialogs.NewLocalize(v, "Cancel", "Report")
+	d.SetTitle(locale.S(v, "Report Message"))
+	d.SetDefaultSize(350, -1)
+	d.SetChild(box)
+	d.BindEnterOK()
+	d.BindCancelClose()
+
+	d.OK.ConnectClicked(func() {
+		reason := reason.Text()
+		redact := canRedact && redact.Active()
+
+		if hide.Active() {
+			v.MessageViewer.SetHidden(roomEv.ID, true)
+		}
+
+		d.Close()
+		d.Destroy()
+
+		client := v.client()
+
+		gtkutil.Async(v, func() func() {
+			if err := client.ReportEvent(roomEv.RoomID, roomEv.ID, reason); err != nil {
+				return func() { app.Error(v, errors.Wrap(err, "cannot report message")) }
+			}
+
+			if redact {
+				if err := client.Redact(roomEv.RoomID, roomEv.ID, reason); err != nil {
+					return func() { app.Error(v, errors.Wrap(err, "cannot delete message")) }
+				}
+			}
+
+			return nil
+		})
+	})
+
+	d.Show()
+}
+
+var removeRecentCSS = cssutil.Applier("message-removerecent", `
+	.message-removerecent {
+		padding: 15px;
+	}
+	.message-removerecent > * {
+		margin-bottom: 6px;
+	}
+	.message-removerecent > box:last-child {
+		margin-bottom: 0;
+	}
+`)
+
+// removeRecentMessages shows a dialog that lets a moderator redact the most
+// recent messages that the sender of the message sent in the room.
+func removeRecentMessages(v messageViewer) {
+	roomEv := v.event.RoomInfo()
+	client := v.client()
+
+	name := string(roomEv.Sender)
+	if member, err := client.Offline().MemberName(roomEv.RoomID, roomEv.Sender, false); err == nil {
+		name = member.Name
+	}
+
+	label := gtk.NewLabel(locale.Sprintf(v,
+		"Delete the most recent messages that %s sent in this room. This cannot be undone.", name))
+	label.SetWrap(true)
+	label.SetXAlign(0)
+
+	count := gtk.NewSpinButtonWithRange(1, 500, 10)
+	count.SetValue(50)
+
+	countLabel := gtk.NewLabel(locale.S(v, "Messages to delete"))
+	countLabel.SetHExpand(true)
+	countLabel.SetXAlign(0)
+
+	countBox := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	countBox.Append(countLabel)
+	countBox.Append(count)
+
+	reason := gtk.NewEntry()
+	reason.SetPlaceholderText(locale.S(v, "Reason (optional)"))
+
+	bar := progress.NewBar()
+	bar.SetVisible(false)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(label)
+	box.Append(countBox)
+	box.Append(reason)
+	box.Append(bar)
+	removeRecentCSS(box)
+
+	ctx, cancel := context.WithCancel(v.Context)
+
+	d := dialogs.NewLocalize(v, "Cancel", "Delete")
+	d.SetTitle(locale.S(v, "Remove Recent Messages"))
+	d.SetDefaultSize(350, -1)
+	d.SetChild(box)
+	d.ConnectDestroy(cancel)
+	d.BindCancelClose()
+	d.OK.AddCSSClass("destructive-action")
+
+	d.OK.ConnectClicked(func() {
+		limit := count.ValueAsInt()
+		why := reason.Text()
+
+		d.OK.SetSensitive(false)
+		countBox.SetSensitive(false)
+		reason.SetSensitive(false)
+
+		bar.SetVisible(true)
+		bar.SetShowText(true)
+		bar.SetText(locale.S(v, "Looking for messages..."))
+
+		onProgress := func(p gotktrix.RedactProgress) {
+			glib.IdleAdd(func() {
+				switch {
+				case p.Total < 0:
+					bar.Set(0)
+				case p.RateLimited > 0:
+					bar.SetText(locale.Sprintf(v,
+						"Rate limited, waiting %.0fs...", p.RateLimited.Seconds()))
+				default:
+					bar.SetMax(int64(p.Total))
+					bar.Set(int64(p.Done))
+					bar.SetText(locale.Sprintf(v, "Deleted %d of %d messages", p.Done, p.Total))
+				}
+			})
+		}
+
+		go func() {
+			n, err := client.RedactRecent(ctx, roomEv.RoomID, roomEv.Sender, limit, why, onProgress)
+			glib.IdleAdd(func() {
+				if ctx.Err() != nil {
+					// Cancelled; the dialog is already gone.
+					return
+				}
+				if err != nil {
+					bar.Error(err)
+					app.Error(v, errors.Wrapf(err, "cannot delete messages (%d deleted)", n))
+					return
+				}
+				d.Close()
+				d.Destroy()
+			})
+		}()
+	})
+
+	d.Show()
 }
 
 var reactCSS = cssutil.Applier("message-react", `
@@ -8,8 +8,10 @@ import (
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotk4/pkg/pango"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
 	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mcontent"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/poll"
 	"github.com/diamondburned/gotrix/event"
 	"github.com/diamondburned/gotrix/matrix"
 )
@@ -58,9 +60,23 @@ type MessageViewer interface {
 	ReplyTo(matrix.EventID)
 	// Edit starts the editing for given message ID.
 	Edit(matrix.EventID)
+	// Quote inserts the given text from the given message into the composer as
+	// a quote.
+	Quote(matrix.EventID, string)
 	// ScrollTo scrolls to the given event, or if it doesn't exist, then false
 	// is returned.
 	ScrollTo(matrix.EventID) bool
+	// SetHidden hides or unhides the given event locally without redacting
+	// it.
+	SetHidden(matrix.EventID, bool)
+	// OpenThread opens the thread rooted at the given event.
+	OpenThread(matrix.EventID)
+	// SelectMessages lets the user select a range of messages, starting with
+	// the given one, to copy as a quote.
+	SelectMessages(matrix.EventID)
+	// ProfileActioner does the quick actions in the profile popovers of the
+	// message authors.
+	mauthor.ProfileActioner
 }
 
 // messageViewer fuses MessageViewer into Context. It's only used internally;
@@ -81,7 +97,8 @@ func (v messageViewer) client() *gotktrix.Client {
 //  - have MessageViewer.BeforeMessage take a mark to grab the previous message,
 //    if needed
 
-// NewCozyMessage creates a new cozy or collapsed message.
+// NewCozyMessage creates a new cozy or collapsed message, or a bubble or IRC
+// message if the room uses those layouts.
 func NewCozyMessage(ctx context.Context, view MessageViewer, ev event.RoomEvent, before Message) Message {
 	viewer := messageViewer{
 		Context:       ctx,
@@ -91,10 +108,18 @@ func NewCozyMessage(ctx context.Context, view MessageViewer, ev event.RoomEvent,
 
 	var message Message
 
-	if ev, ok := ev.(*event.RoomMessageEvent); ok {
-		if lastIsAuthor(before, ev) {
+	if ev, ok := asMessage(ev); ok {
+		layout := RoomLayout(ctx, ev.RoomID)
+		grouped := lastIsAuthor(before, ev)
+
+		switch {
+		case layout == IRCLayout:
+			message = viewer.ircMessage(ev)
+		case layout == BubbleLayout:
+			message = viewer.bubbleMessage(ev, grouped)
+		case grouped:
 			message = viewer.collapsedMessage(ev)
-		} else {
+		default:
 			message = viewer.cozyMessage(ev)
 		}
 
@@ -111,12 +136,25 @@ func NewCozyMessage(ctx context.Context, view MessageViewer, ev event.RoomEvent,
 	return message
 }
 
+// asMessage returns the event as a room message if it should be shown as
+// one. Polls are shown as messages.
+func asMessage(ev event.RoomEvent) (*event.RoomMessageEvent, bool) {
+	switch ev := ev.(type) {
+	case *event.RoomMessageEvent:
+		return ev, true
+	case *poll.StartEvent:
+		return poll.MessageEvent(ev), true
+	default:
+		return nil, false
+	}
+}
+
 const maxCozyAge = 10 * time.Minute
 
 func lastIsAuthor(before Message, ev *event.RoomMessageEvent) bool {
-	// Ensure that the last message IS a cozy OR compact message.
+	// Ensure that the last message IS a cozy, compact OR bubble message.
 	switch before := before.(type) {
-	case *cozyMessage, *collapsedMessage:
+	case *cozyMessage, *collapsedMessage, *bubbleMessage:
 		last := before.Event().RoomInfo()
 		return last.Sender == ev.Sender &&
 			ev.OriginServerTime.Time().Sub(last.OriginServerTime.Time()) < maxCozyAge
@@ -133,11 +171,15 @@ type message struct {
 }
 
 func (v messageViewer) newMessage(ev *event.RoomMessageEvent, longTimestamp bool) *message {
+	return v.newMessageWithContent(ev, longTimestamp, mcontent.New(v.Context, ev))
+}
+
+func (v messageViewer) newMessageWithContent(
+	ev *event.RoomMessageEvent, longTimestamp bool, content *mcontent.Content) *message {
+
 	timestamp := newTimestamp(v, v.event.RoomInfo().OriginServerTime.Time(), longTimestamp)
 	timestamp.SetEllipsize(pango.EllipsizeEnd)
 
-	content := mcontent.New(v.Context, ev)
-
 	if replyID := messageRepliesTo(ev); replyID != "" {
 		reply := NewReply(v.Context, v.MessageViewer, ev.RoomID, replyID)
 		reply.InvalidateContent()
@@ -188,8 +230,15 @@ func messageRepliesTo(ev *event.RoomMessageEvent) matrix.EventID {
 		InReplyTo struct {
 			EventID matrix.EventID `json:"event_id"`
 		} `json:"m.in_reply_to"`
+		IsFallingBack bool `json:"is_falling_back"`
 	}
 
 	json.Unmarshal(ev.RelatesTo, &relatesTo)
+
+	// Thread messages only reply to the thread's root for clients that don't
+	// know about threads.
+	if relatesTo.IsFallingBack {
+		return ""
+	}
 	return relatesTo.InReplyTo.EventID
 }
@@ -0,0 +1,138 @@
+package message
+
+import (
+	"context"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mcontent"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+)
+
+// quoteMessage quotes the text selected within the given message widget, or
+// the whole message body if nothing is selected.
+func quoteMessage(v messageViewer, parent gtk.Widgetter) {
+	text := selectedText(parent)
+	if text == "" {
+		if msg, ok := v.event.(*event.RoomMessageEvent); ok {
+			body, _ := mcontent.MsgBody(msg)
+			text = body.Body
+			if messageRepliesTo(msg) != "" {
+				text = trimReplyFallback(text)
+			}
+		}
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	v.MessageViewer.Quote(v.event.RoomInfo().ID, text)
+}
+
+// trimReplyFallback removes the quote of the replied message that clients put
+// at the start of the body of replies.
+func trimReplyFallback(body string) string {
+	lines := strings.Split(body, "\n")
+	for len(lines) > 0 && strings.HasPrefix(lines[0], ">") {
+		lines = lines[1:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// selectedText returns the text selected in all labels and text views within
+// the given widget, joined by new lines.
+func selectedText(w gtk.Widgetter) string {
+	var parts []string
+
+	var walk func(w gtk.Widgetter)
+	walk = func(w gtk.Widgetter) {
+		switch w := w.(type) {
+		case *gtk.Label:
+			start, end, ok := w.SelectionBounds()
+			if ok && start != end {
+				runes := []rune(w.Text())
+				if start <= end && end <= len(runes) {
+					parts = append(parts, string(runes[start:end]))
+				}
+			}
+		case *gtk.TextView:
+			buf := w.Buffer()
+			start, end, ok := buf.SelectionBounds()
+			if ok {
+				parts = append(parts, buf.Text(start, end, false))
+			}
+		}
+
+		base := gtk.BaseWidget(w)
+		for child := base.FirstChild(); child != nil; child = gtk.BaseWidget(child).NextSibling() {
+			walk(child)
+		}
+	}
+
+	walk(w)
+
+	return strings.Join(parts, "\n")
+}
+
+// quoteTimeFormat is the timestamp format used in QuoteConversation. It's
+// unambiguous regardless of the reader's locale.
+const quoteTimeFormat = "2006-01-02 15:04"
+
+// QuoteConversation formats the given messages as a Markdown quote block that
+// can be pasted into other rooms or issue trackers. Consecutive messages from
+// the same author are put under a single header with the author's name and the
+// time of their first message. Events that aren't messages are skipped.
+func QuoteConversation(ctx context.Context, events []event.RoomEvent) string {
+	client := gotktrix.FromContext(ctx).Offline()
+
+	var b strings.Builder
+	var last event.RoomEvent
+
+	for _, ev := range events {
+		msg, ok := ev.(*event.RoomMessageEvent)
+		if !ok {
+			continue
+		}
+
+		body, _ := mcontent.MsgBody(msg)
+		text := body.Body
+		if messageRepliesTo(msg) != "" {
+			text = trimReplyFallback(text)
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		if last == nil || last.RoomInfo().Sender != msg.Sender {
+			if last != nil {
+				b.WriteString(">\n")
+			}
+
+			name, err := client.MemberName(msg.RoomID, msg.Sender, false)
+			author := string(msg.Sender)
+			if err == nil && name.Name != "" {
+				author = name.Name
+			}
+
+			b.WriteString("> **")
+			b.WriteString(author)
+			b.WriteString("** (")
+			b.WriteString(msg.OriginServerTime.Time().Format(quoteTimeFormat))
+			b.WriteString("):\n")
+		}
+
+		for _, line := range strings.Split(text, "\n") {
+			b.WriteString(strings.TrimRight("> "+line, " "))
+			b.WriteString("\n")
+		}
+
+		last = ev
+	}
+
+	return b.String()
+}
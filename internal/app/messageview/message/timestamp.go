@@ -3,21 +3,82 @@ package message
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotk4/pkg/pango"
 	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/app/prefs"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
 )
 
+var timezone = prefs.NewString("", prefs.StringMeta{
+	Name:    "Timezone",
+	Section: "Text",
+	Description: "The timezone to show message timestamps in, such as " +
+		"<code>Europe/Berlin</code> or <code>UTC</code>.",
+	Placeholder: "Leave blank for system timezone",
+	Validate: func(tz string) error {
+		_, err := loadLocation(tz)
+		return err
+	},
+})
+
+// timeLocation is the location that timestamps are shown in. It is updated by
+// the timezone preference.
+var timeLocation = time.Local
+
+func init() {
+	timezone.SubscribeInit(func() {
+		loc, err := loadLocation(timezone.Value())
+		if err != nil {
+			loc = time.Local
+		}
+		timeLocation = loc
+	})
+}
+
+func loadLocation(tz string) (*time.Location, error) {
+	tz = strings.TrimSpace(tz)
+	if tz == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(tz)
+}
+
 var timestampCSS = cssutil.Applier("message-timestamp", `
 	.message-timestamp {
 		font-size: 0.80em;
 		color: alpha(@theme_fg_color, 0.55);
 	}
+	.message-timestamp-future {
+		color: alpha(@warning_color, 0.85);
+	}
 `)
 
+// futureTolerance is how far into the future a timestamp can be before it is
+// flagged. Small differences are normal, since clocks are never perfectly in
+// sync.
+const futureTolerance = 2 * time.Minute
+
+// serverNow returns the current time according to the homeserver, so that
+// timestamps are rendered consistently even if the local clock is off.
+func serverNow(ctx context.Context) time.Time {
+	if client := gotktrix.FromContext(ctx); client != nil {
+		return client.ServerTime()
+	}
+	return time.Now()
+}
+
+// isFuture returns true if the given time is too far in the future, which
+// happens if the sender's clock is wrong.
+func isFuture(ctx context.Context, t time.Time) bool {
+	return t.Sub(serverNow(ctx)) > futureTolerance
+}
+
 type timestamp struct {
 	*gtk.Label
 	ctx  context.Context
@@ -30,29 +91,123 @@ type timestamp struct {
 func newTimestamp(ctx context.Context, ts time.Time, long bool) *timestamp {
 	var t string
 	if long {
-		t = locale.TimeAgo(ctx, ts)
+		t = timeAgo(ctx, ts)
 	} else {
-		t = locale.Time(ts, false)
+		t = formatTime(ts, false)
 	}
 
 	l := gtk.NewLabel(t)
-	l.SetTooltipText(locale.Time(ts, true))
 	l.SetEllipsize(pango.EllipsizeMiddle)
 	timestampCSS(l)
 
-	return &timestamp{l, ctx, ts, long}
+	if isFuture(ctx, ts) {
+		l.AddCSSClass("message-timestamp-future")
+	}
+
+	timestamp := &timestamp{l, ctx, ts, long}
+	timestamp.SetTooltipText(timestamp.tooltip(formatTime(ts, true)))
+
+	return timestamp
 }
 
 func (t *timestamp) setEdited(editedTs time.Time) {
-	t.SetTooltipText(locale.Sprintf(t.ctx,
+	t.SetTooltipText(t.tooltip(locale.Sprintf(t.ctx,
 		"%s (edited %s)",
-		locale.Time(t.time, true),
-		locale.Time(editedTs, true),
-	))
+		formatTime(t.time, true),
+		formatTime(editedTs, true),
+	)))
 	if t.long {
 		t.SetText(fmt.Sprintf(
 			"%s "+locale.S(t.ctx, "(edited)"),
-			locale.TimeAgo(t.ctx, t.time),
+			timeAgo(t.ctx, t.time),
 		))
 	}
 }
+
+// tooltip appends the UTC time and the raw origin server timestamp to the given
+// tooltip header.
+func (t *timestamp) tooltip(header string) string {
+	utc := glib.NewDateTimeFromGo(t.time.UTC())
+
+	var b strings.Builder
+	b.WriteString(header)
+	b.WriteByte('\n')
+	b.WriteString(locale.Sprintf(t.ctx, "UTC: %s", utc.Format("%c")))
+	b.WriteByte('\n')
+	b.WriteString(locale.Sprintf(t.ctx, "Origin server timestamp: %d", t.time.UnixMilli()))
+
+	if isFuture(t.ctx, t.time) {
+		b.WriteByte('\n')
+		b.WriteString(locale.S(t.ctx,
+			"This message is dated in the future. The sender's clock may be wrong."))
+	}
+
+	if client := gotktrix.FromContext(t.ctx); client != nil {
+		if skew := client.ClockSkew(); skew != 0 {
+			b.WriteByte('\n')
+			b.WriteString(locale.Sprintf(t.ctx,
+				"Your clock differs from the homeserver's by %s.", formatSkew(t.ctx, skew)))
+		}
+	}
+
+	return b.String()
+}
+
+// formatSkew formats the absolute value of the given clock skew.
+func formatSkew(ctx context.Context, skew time.Duration) string {
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew < time.Hour {
+		return locale.Sprintf(ctx, "%d minutes", int(skew.Round(time.Minute)/time.Minute))
+	}
+	return locale.Sprintf(ctx, "%.1f hours", skew.Hours())
+}
+
+// formatTime formats the given time in the user's chosen timezone. It behaves
+// like locale.Time.
+func formatTime(t time.Time, long bool) string {
+	glibTime := glib.NewDateTimeFromGo(t.In(timeLocation))
+
+	if long {
+		return strings.ReplaceAll(glibTime.Format("%c"), "  ", " ")
+	}
+
+	return glibTime.Format("%X")
+}
+
+var timeAgoTruncators = []struct {
+	d time.Duration
+	s string
+}{
+	{d: locale.Day, s: "Today at %X"},
+	{d: locale.Week, s: "Monday at %X"},
+	{d: -1, s: "%X %x"},
+}
+
+// timeAgo formats the given time relative to now in the user's chosen
+// timezone. It behaves like locale.TimeAgo, except now is the homeserver's
+// time, and future times are always formatted in full.
+func timeAgo(ctx context.Context, t time.Time) string {
+	t = t.In(timeLocation)
+
+	if isFuture(ctx, t) {
+		glibTime := glib.NewDateTimeFromGo(t)
+		return glibTime.Format(locale.S(ctx, "%X %x"))
+	}
+
+	trunc := t
+	now := serverNow(ctx).In(timeLocation)
+
+	for _, truncator := range timeAgoTruncators {
+		trunc = trunc.Truncate(truncator.d)
+		now = now.Truncate(truncator.d)
+
+		if trunc.Equal(now) || truncator.d == -1 {
+			glibTime := glib.NewDateTimeFromGo(t)
+			return glibTime.Format(locale.S(ctx, truncator.s))
+		}
+	}
+
+	return ""
+}
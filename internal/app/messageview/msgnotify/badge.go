@@ -0,0 +1,131 @@
+package msgnotify
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/api"
+)
+
+// ShowUnreadBadge is a preference.
+var ShowUnreadBadge = prefs.NewBool(true, prefs.PropMeta{
+	Name:    "Show Unread Badge",
+	Section: "Application",
+	Description: "Show the number of unread notifications on the application " +
+		"icon in the taskbar or dock, if supported.",
+})
+
+const (
+	launcherEntryPath  = "/com/canonical/unity/launcherentry/"
+	launcherEntryIface = "com.canonical.Unity.LauncherEntry"
+)
+
+// badgeCount is the total unread counts across all rooms.
+type badgeCount struct {
+	notifications int
+	highlights    int
+}
+
+// StartBadge starts updating the application icon's badge using the Unity
+// LauncherEntry D-Bus API with the total number of unread notifications. A stop
+// callback is returned.
+func StartBadge(ctx context.Context) (stop func()) {
+	conn, err := gio.BusGetSync(ctx, gio.BusTypeSession)
+	if err != nil {
+		log.Println("cannot get session bus for unread badge:", err)
+		return func() {}
+	}
+
+	appURI := "application://" + app.FromContext(ctx).ID() + ".desktop"
+	client := gotktrix.FromContext(ctx)
+
+	var last badgeCount
+
+	update := func(count badgeCount) {
+		if !ShowUnreadBadge.Value() {
+			count = badgeCount{}
+		}
+		if count == last {
+			return
+		}
+		last = count
+		emitBadge(conn, appURI, count)
+	}
+
+	invalidate := func() {
+		gtkutil.Async(ctx, func() func() {
+			count := countUnread(client.Offline())
+			return func() { update(count) }
+		})
+	}
+
+	invalidate()
+
+	rmSync := client.OnSync(func(*api.SyncResponse) {
+		glib.IdleAdd(invalidate)
+	})
+	rmPref := ShowUnreadBadge.Subscribe(invalidate)
+
+	return func() {
+		rmSync()
+		rmPref()
+		update(badgeCount{})
+	}
+}
+
+func countUnread(client *gotktrix.Client) badgeCount {
+	var count badgeCount
+
+	rooms, err := client.Rooms()
+	if err != nil {
+		return count
+	}
+
+	for _, roomID := range rooms {
+		n := client.State.RoomNotificationCount(roomID)
+		count.notifications += n.Notification
+		count.highlights += n.Highlight
+	}
+
+	return count
+}
+
+// emitBadge emits the LauncherEntry Update signal. See
+// https://wiki.ubuntu.com/Unity/LauncherAPI.
+func emitBadge(conn *gio.DBusConnection, appURI string, count badgeCount) {
+	props := glib.NewVariantDict(nil)
+	props.InsertValue("count", glib.NewVariantInt64(int64(count.notifications)))
+	props.InsertValue("count-visible", glib.NewVariantBoolean(count.notifications > 0))
+	props.InsertValue("urgent", glib.NewVariantBoolean(count.highlights > 0))
+
+	params := glib.NewVariantTuple([]*glib.Variant{
+		glib.NewVariantString(appURI),
+		props.End(),
+	})
+
+	path := launcherEntryPath + objectPathHash(appURI)
+
+	if err := conn.EmitSignal("", path, launcherEntryIface, "Update", params); err != nil {
+		log.Println("cannot emit LauncherEntry update:", err)
+	}
+}
+
+// objectPathHash turns the given string into something that can be used as an
+// object path element, since those may only contain [A-Za-z0-9_].
+func objectPathHash(str string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, str)
+}
@@ -0,0 +1,105 @@
+package msgnotify
+
+import (
+	"context"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/app/prefs/kvstate"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+const mentionNamesKey = "names"
+
+func acquireMentionsConfig(ctx context.Context, uID matrix.UserID) *kvstate.Config {
+	return kvstate.AcquireConfig(ctx, "notify", gotktrix.Base64UserID(uID), "mentions.json")
+}
+
+// LoadMentionNames loads the current account's alternative names to be notified
+// on into the client.
+func LoadMentionNames(ctx context.Context) {
+	client := gotktrix.FromContext(ctx)
+	client.SetMentionNames(mentionNames(ctx, client.UserID))
+}
+
+func mentionNames(ctx context.Context, uID matrix.UserID) []string {
+	var names []string
+	acquireMentionsConfig(ctx, uID).Get(mentionNamesKey, &names)
+	return names
+}
+
+var mentionsCSS = cssutil.Applier("msgnotify-mentions", `
+	.msgnotify-mentions {
+		padding: 15px;
+	}
+	.msgnotify-mentions > scrolledwindow {
+		margin-top: 8px;
+	}
+	.msgnotify-mentions textview {
+		padding: 4px;
+	}
+`)
+
+// EditMentionNames shows a dialog that lets the user edit the alternative names
+// to be notified on, such as their IRC nickname or their display names on
+// bridged networks. The names are stored per account.
+func EditMentionNames(ctx context.Context) {
+	client := gotktrix.FromContext(ctx)
+
+	description := gtk.NewLabel(locale.S(ctx,
+		"Also notify me when messages mention any of these names, one per line. "+
+			"This is useful for IRC nicknames or names used on bridged networks."))
+	description.SetWrap(true)
+	description.SetXAlign(0)
+
+	text := gtk.NewTextView()
+	text.SetWrapMode(gtk.WrapWordChar)
+	text.SetAcceptsTab(false)
+	text.Buffer().SetText(strings.Join(mentionNames(ctx, client.UserID), "\n"))
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(text)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(description)
+	box.Append(scroll)
+	mentionsCSS(box)
+
+	d := dialogs.New(ctx, locale.S(ctx, "Cancel"), locale.S(ctx, "Save"))
+	d.SetDefaultSize(375, 300)
+	d.SetTitle(locale.S(ctx, "Mention Names"))
+	d.SetChild(box)
+	d.BindCancelClose()
+
+	d.OK.ConnectClicked(func() {
+		start, end := text.Buffer().Bounds()
+		lines := strings.Split(text.Buffer().Text(start, end, false), "\n")
+
+		names := make([]string, 0, len(lines))
+		for _, line := range lines {
+			if line = strings.TrimSpace(line); line != "" {
+				names = append(names, line)
+			}
+		}
+
+		config := acquireMentionsConfig(ctx, client.UserID)
+		if len(names) > 0 {
+			config.Set(mentionNamesKey, names)
+		} else {
+			config.Delete(mentionNamesKey)
+		}
+
+		client.SetMentionNames(names)
+
+		d.Close()
+		d.Destroy()
+	})
+
+	d.Show()
+}
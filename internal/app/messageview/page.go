@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -22,8 +23,10 @@ import (
 	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mauthor"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
 	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/poll"
 	"github.com/diamondburned/gotrix/event"
 	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
 )
 
 type messageKey string
@@ -99,15 +102,19 @@ type Page struct {
 	gtk.Widgetter
 	Composer *compose.Composer
 
-	main *adaptive.LoadablePage
-	box  *gtk.Box
+	main  *adaptive.LoadablePage
+	paned *gtk.Paned
+	box   *gtk.Box
 
 	// moreMsgBar is the bar on top that pops up when there are new unread
 	// messages in the current room.
 	moreMsgBar  *moreMessageBar
 	markReadBtn *gtk.Button
+	// effects is the overlay that message effects are played in.
+	effects *effectOverlay
 
 	scroll *autoscroll.Window
+	anchor scrollAnchor
 	list   *gtk.ListBox
 	// TODO: it might be better to refactor these maps into a map of only an
 	// event object that simultaneously has a linked anchor. This way, there's
@@ -115,6 +122,17 @@ type Page struct {
 	// pieces of events in separate places.
 	messages map[messageKey]messageRow
 	mrelated map[matrix.EventID]matrix.EventID // keep track of reactions
+	replies  replyIndex
+	hidden   hiddenIndex
+	spam     spamIndex
+	status   statusIndex
+	threads  threadIndex
+	receipts receiptIndex
+
+	// thread is the thread pane that is open, if any.
+	thread *threadPane
+	// members is the member sidebar, which is beside the thread pane.
+	members *memberPane
 
 	// extra is the bottom popup for typing indicators and etc.
 	extra *extraRevealer
@@ -122,15 +140,31 @@ type Page struct {
 	name    string
 	onTitle func(title string)
 	ctx     gtkutil.Canceller
+	// roomCtx is cancelled when the page is closed. Unlike ctx, it isn't
+	// cancelled when the page is merely hidden.
+	roomCtx context.Context
+	cancel  context.CancelFunc
 
 	parent *View
 	pager  *gotktrix.RoomPaginator
+	more   *loadMoreButton
 	roomID matrix.RoomID
 
 	editing    matrix.EventID
 	replyingTo matrix.EventID
 
+	search *searchBar
+	// selection is the bar shown while messages are being selected.
+	selection *selectionBar
+	// jumping is the message that the page is jumping to once it's loaded.
+	jumping matrix.EventID
+
+	// layout is the message layout that the messages were created with.
+	layout string
+
 	loaded bool
+	// ready is true once the loaded messages are shown.
+	ready bool
 }
 
 type messageRow struct {
@@ -201,6 +235,7 @@ const maxFetch = 40
 
 var messageviewEvents = []event.Type{
 	event.TypeTyping,
+	event.TypeReceipt,
 	m.FullyReadEventType,
 }
 
@@ -208,23 +243,39 @@ var messageviewEvents = []event.Type{
 func NewPage(ctx context.Context, parent *View, roomID matrix.RoomID) *Page {
 	name, _ := parent.client.Offline().RoomName(roomID)
 
+	roomCtx, cancel := context.WithCancel(ctx)
+
 	p := Page{
 		messages: make(map[messageKey]messageRow),
 		mrelated: make(map[matrix.EventID]matrix.EventID),
+		replies:  newReplyIndex(),
+		hidden:   newHiddenIndex(),
+		spam:     newSpamIndex(),
+		status:   newStatusIndex(),
+		threads:  newThreadIndex(),
+		receipts: newReceiptIndex(),
 
 		onTitle: func(string) {},
 		name:    name,
 
 		parent: parent,
-		pager:  parent.client.RoomPaginator(roomID, maxFetch),
+		pager:  parent.client.TakeRoomPaginator(roomID, maxFetch),
 		roomID: roomID,
+
+		roomCtx: roomCtx,
+		cancel:  cancel,
 	}
 
 	p.list = gtk.NewListBox()
 	p.list.SetSelectionMode(gtk.SelectionNone)
+	p.list.SetFilterFunc(func(row *gtk.ListBoxRow) bool {
+		key := messageKeyRow(row)
+		return !p.replies.hidden[key] && !p.hidden.isHidden(key) && p.threads.roots[key] == ""
+	})
 	msgListCSS(p.list)
 
-	p.ctx = gtkutil.WithVisibility(ctx, p.list)
+	p.ctx = gtkutil.WithVisibility(roomCtx, p.list)
+	p.layout = message.RoomLayout(ctx, roomID)
 
 	// This sorting is a HUGE issue. It's a really, really big issue, actually.
 	// Right now, we're checking whether or not a message should be collapsed by
@@ -261,8 +312,13 @@ func NewPage(ctx context.Context, parent *View, roomID matrix.RoomID) *Page {
 		return 1 // t1 > t2
 	})
 
+	p.more = newLoadMore(p.loadMore, p.endNotice)
+
 	innerBox := gtk.NewBox(gtk.OrientationVertical, 0)
-	innerBox.Append(newLoadMore(p.loadMore))
+	p.hidden.toggle = p.newHiddenToggle()
+
+	innerBox.Append(p.more)
+	innerBox.Append(p.hidden.toggle)
 	innerBox.Append(p.list)
 	innerBox.SetFocusChild(p.list)
 
@@ -278,9 +334,15 @@ func NewPage(ctx context.Context, parent *View, roomID matrix.RoomID) *Page {
 
 	// Bind the scrolled window for automatic scrolling.
 	p.list.SetAdjustment(p.scroll.VAdjustment())
+	p.bindScrollAnchor()
 
+	// The composer keeps the view's context, since messages that are being
+	// sent shouldn't be cancelled when the page is closed.
 	p.Composer = compose.New(ctx, &p, roomID)
 
+	// Prefetch the room members for the composer's autocompletion.
+	go requestAllMembers(roomCtx, roomID)
+
 	p.extra = newExtraRevealer()
 	p.extra.SetVAlign(gtk.AlignEnd)
 
@@ -290,20 +352,51 @@ func NewPage(ctx context.Context, parent *View, roomID matrix.RoomID) *Page {
 	p.markReadBtn = p.moreMsgBar.AddButton(locale.S(ctx, "Mark as read"))
 	p.markReadBtn.ConnectClicked(func() { p.MarkAsRead() })
 
+	p.effects = newEffectOverlay()
+
 	overlay := gtk.NewOverlay()
 	overlay.SetVExpand(true)
 	overlay.SetChild(p.scroll)
 	overlay.AddOverlay(p.extra)
 	overlay.AddOverlay(p.moreMsgBar)
+	overlay.AddOverlay(p.effects)
+
+	p.search = newSearchBar(&p)
+
+	p.selection = newSelectionBar(&p)
+	p.list.ConnectSelectedRowsChanged(p.invalidateSelection)
 
 	p.box = gtk.NewBox(gtk.OrientationVertical, 0)
+	p.box.Append(p.search)
+	p.box.Append(p.selection)
 	p.box.Append(overlay)
 	p.box.Append(p.Composer)
 	p.box.SetFocusChild(p.Composer)
 	p.box.AddCSSClass("messageview-box")
+	for _, class := range roomClasses(parent.client.Offline(), roomID) {
+		p.box.AddCSSClass(class)
+	}
+	p.bindAccent()
+	p.bindFileDrop()
+
+	// The thread pane is put beside the messages once it's opened.
+	p.paned = gtk.NewPaned(gtk.OrientationHorizontal)
+	p.paned.SetWideHandle(true)
+	p.paned.SetResizeStartChild(true)
+	p.paned.SetResizeEndChild(true)
+	p.paned.SetShrinkStartChild(false)
+	p.paned.SetShrinkEndChild(false)
+	p.paned.SetStartChild(p.box)
+
+	p.paned.SetHExpand(true)
+	p.members = newMemberPane(&p)
+
+	outer := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	outer.Append(p.paned)
+	outer.Append(p.members)
 
 	p.main = adaptive.NewLoadablePage()
-	p.main.SetChild(p.box)
+	p.main.SetChild(outer)
 	rhsCSS(p.main)
 
 	// main widget
@@ -322,6 +415,9 @@ func NewPage(ctx context.Context, parent *View, roomID matrix.RoomID) *Page {
 				switch e := e.(type) {
 				case *event.TypingEvent:
 					p.onTypingEvent(e)
+				case *event.ReceiptEvent:
+					p.onReceipt(e)
+					p.addReceipts(e)
 				case *m.FullyReadEvent:
 					p.moreMsgBar.Invalidate()
 				}
@@ -329,6 +425,9 @@ func NewPage(ctx context.Context, parent *View, roomID matrix.RoomID) *Page {
 		})
 	})
 
+	// Receipts are kept until the messages that they point to are loaded.
+	p.loadReceipts()
+
 	// Mark the latest message as read everytime the user scrolls down to the
 	// bottom.
 	p.scroll.OnBottomed(p.OnScrollBottomed)
@@ -343,12 +442,33 @@ func NewPage(ctx context.Context, parent *View, roomID matrix.RoomID) *Page {
 	// composer.
 	gtkutil.ForwardTyping(p.list, p.Composer.Input())
 
+	collapseReplies.SubscribeWidget(p.list, p.invalidateAllReplies)
+	message.SubscribeLayout(p.list, p.relayoutMessages)
+
 	return &p
 }
 
-// IsActive returns true if this page is the one the user is viewing.
+// Close stops everything that the page is still doing in the background, such
+// as fetching members, backfilling messages and loading images. It is called
+// once the page is removed from the view.
+func (p *Page) Close() {
+	p.Composer.Input().SaveDraft()
+	p.cancel()
+}
+
+// requestAllMembers fills up the local state with the given room's members.
+func requestAllMembers(ctx context.Context, roomID matrix.RoomID) {
+	client := gotktrix.FromContext(ctx)
+
+	if err := client.RoomEnsureMembers(roomID); err != nil && ctx.Err() == nil {
+		app.Error(ctx, errors.Wrap(err, "failed to prefetch members"))
+	}
+}
+
+// IsActive returns true if this page is the one the user is viewing, either as
+// the current page or in the split view.
 func (p *Page) IsActive() bool {
-	return p.parent.current != nil && p.parent.current.roomID == p.roomID
+	return p == p.parent.current || p == p.parent.split.page
 }
 
 // OnTitle subscribes to the page's title changes.
@@ -384,29 +504,31 @@ func (p *Page) RoomTopic() string {
 }
 
 func (p *Page) onTypingEvent(ev *event.TypingEvent) {
-	if len(ev.UserID) == 0 {
+	client := gotktrix.FromContext(p.ctx.Take())
+
+	// Don't show the user as typing to themselves.
+	userIDs := make([]matrix.UserID, 0, len(ev.UserID))
+	for _, id := range ev.UserID {
+		if id != client.UserID {
+			userIDs = append(userIDs, id)
+		}
+	}
+
+	if len(userIDs) == 0 {
 		p.extra.Clear()
 		return
 	}
 
 	// 3 UserIDs max.
-	if len(ev.UserID) > 3 {
-		ev.UserID = ev.UserID[:3]
-	}
-
-	client := gotktrix.FromContext(p.ctx.Take())
-
-	names := make([]string, len(ev.UserID))
-	for i, id := range ev.UserID {
-		author := mauthor.Markup(client, p.roomID, id, mauthor.WithMinimal())
-		names[i] = "<b>" + author + "</b>"
+	names := make([]string, 0, 3)
+	for i := 0; i < len(userIDs) && i < 3; i++ {
+		author := mauthor.Markup(client, p.roomID, userIDs[i], mauthor.WithMinimal())
+		names = append(names, "<b>"+author+"</b>")
 	}
 
 	sprintf := locale.FromContext(p.ctx.Take()).Sprintf
 
-	switch len(names) {
-	case 0:
-		p.extra.SetMarkup("")
+	switch len(userIDs) {
 	case 1:
 		p.extra.SetMarkup(sprintf("%s is typing...", names[0]))
 	case 2:
@@ -509,7 +631,8 @@ func (p *Page) MarkAsRead() {
 			return func() { done(true) }
 		}
 
-		if err := client.MarkRoomAsRead(roomID, latest.RoomInfo().ID); err != nil {
+		err := client.MarkRoomAsRead(roomID, latest.RoomInfo().ID, !sendReceipts.Value())
+		if err != nil {
 			// No need to interrupt the user for this.
 			log.Println("failed to mark room as read:", err)
 			return func() { done(false) }
@@ -536,8 +659,19 @@ func (p *Page) clean() {
 
 		id := messageKeyRow(row)
 		delete(p.messages, id)
+		delete(p.replies.hidden, id)
+		delete(p.replies.summaries, id)
+		delete(p.replies.boxes, id)
+		delete(p.threads.roots, id)
+		delete(p.spam.collapsed, id)
+		p.status.delete(id)
 
 		if id.IsEvent() {
+			if _, ok := p.hidden.events[id.EventID()]; ok {
+				delete(p.hidden.events, id.EventID())
+				p.invalidateHidden()
+			}
+
 			for k, relatesTo := range p.mrelated {
 				if relatesTo == id.EventID() {
 					delete(p.mrelated, k)
@@ -568,6 +702,12 @@ func (p *Page) AddSendingMessage(ev event.RoomEvent) interface{} {
 	})
 
 	p.messages[key].body.SetBlur(true)
+	p.setStatus(key, statusSending)
+
+	if txnID := ev.RoomInfo().Unsigned.TransactionID; txnID != "" {
+		p.status.txns[txnID] = key
+	}
+
 	return key
 }
 
@@ -606,11 +746,44 @@ func (p *Page) StopSendingMessage(mark interface{}) bool {
 	}
 
 	delete(p.messages, key)
+	p.status.delete(key)
 	p.list.Remove(msg.row)
 
 	return true
 }
 
+// FailSendingMessage marks the sending message with the given mark as failed.
+// The user can then send it again or delete it from the message's status icon.
+func (p *Page) FailSendingMessage(mark interface{}, retry func()) {
+	key, ok := mark.(messageKey)
+	if !ok {
+		return
+	}
+
+	msg, ok := p.messages[key]
+	if !ok || msg.custom {
+		return
+	}
+
+	if retry != nil {
+		p.status.retries[key] = retry
+	}
+	p.setStatus(key, statusFailed)
+}
+
+// QueueSendingMessage marks the sending message with the given mark as waiting
+// in the outbox.
+func (p *Page) QueueSendingMessage(mark interface{}) {
+	key, ok := mark.(messageKey)
+	if !ok {
+		return
+	}
+
+	if _, ok := p.messages[key]; ok {
+		p.setStatus(key, statusQueued)
+	}
+}
+
 // BindSendingMessage is used after the sending message has been sent through
 // the backend, and that an event ID is returned. The page will try to match the
 // message up with an existing event.
@@ -631,6 +804,7 @@ func (p *Page) BindSendingMessage(mark interface{}, evID matrix.EventID) (replac
 	// Check if the message has been synchronized before it's replied.
 	if old, ok := p.messages[eventKey]; ok {
 		// Yes, so replace our sending message.
+		p.status.delete(key)
 		p.list.Remove(msg.row)
 		// The synchronized message is going to be compacted when it saw that
 		// our fake message is already there, so we have to invalidate it after
@@ -654,6 +828,14 @@ func (p *Page) BindSendingMessage(mark interface{}, evID matrix.EventID) (replac
 	msg.row.SetName(string(eventKey))
 	p.messages[eventKey] = msg
 
+	if row, ok := p.status.rows[key]; ok {
+		p.status.rows[eventKey] = row
+	}
+	p.status.delete(key)
+	if !msg.custom {
+		p.setStatus(eventKey, statusSent)
+	}
+
 	return false
 }
 
@@ -674,11 +856,24 @@ func (p *Page) OnRoomEvent(ev event.RoomEvent) {
 		return
 	}
 
+	// Match the user's own messages with their local echoes before they're
+	// added, so that they take the place of the echoes.
+	if txnID := ev.RoomInfo().Unsigned.TransactionID; txnID != "" {
+		if key, ok := p.status.txns[txnID]; ok {
+			p.BindSendingMessage(key, ev.RoomInfo().ID)
+		}
+	}
+
 	key := p.onRoomEvent(ev)
 
+	if p.thread != nil {
+		p.thread.onRoomEvent(ev)
+	}
+
 	r, ok := p.messages[key]
 	if ok {
 		r.body.LoadMore()
+		p.playEffect(ev)
 	}
 
 	p.clean()
@@ -703,6 +898,7 @@ func (p *Page) onRoomEvent(ev event.RoomEvent) (key messageKey) {
 	if existing, ok := p.messages[key]; ok {
 		existing.ev = ev
 		p.setMessage(key, existing)
+		p.checkOwnMessage(key, ev)
 		return
 	}
 
@@ -715,6 +911,13 @@ func (p *Page) onRoomEvent(ev event.RoomEvent) (key messageKey) {
 	row.SetName(string(key))
 	row.AddCSSClass("messageview-messagerow")
 
+	// Messages in a thread are only shown in the thread pane, so they're hidden
+	// before they're added.
+	thread := gotktrix.ThreadOf(ev)
+	if thread != "" {
+		p.addThreadReply(key, thread)
+	}
+
 	// Prematurely initialize this with an empty body for the sort function to
 	// work.
 	p.setMessage(key, messageRow{
@@ -722,6 +925,24 @@ func (p *Page) onRoomEvent(ev event.RoomEvent) (key messageKey) {
 		ev:  ev,
 	})
 
+	if thread != "" {
+		p.invalidateThread(thread)
+	}
+
+	if root := p.addReply(key, ev); root != "" {
+		p.invalidateReplies(root)
+	}
+
+	p.addHidden(key, ev)
+	p.addSpam(key, ev)
+	p.checkOwnMessage(key, ev)
+
+	// Reply again to the message that the draft was replying to once it's
+	// loaded.
+	if eventID := p.Composer.Input().DraftReplyingTo(); eventID == ev.RoomInfo().ID {
+		p.ReplyTo(eventID)
+	}
+
 	// Show the message bar if we haven't received an existing message. We put
 	// this here so it doesn't get triggered if an existing message is found,
 	// which usually happens if the new message is the user's.
@@ -783,7 +1004,7 @@ func (p *Page) resetMessage(key messageKey, before messageRow) bool {
 
 	// Recreate the body if the raw events don't match.
 	if recreate {
-		msg.body = message.NewCozyMessage(p.parent.ctx, p, msg.ev, before.body)
+		msg.body = message.NewCozyMessage(p.roomCtx, p, msg.ev, before.body)
 		msg.before = ""
 
 		if before.ev != nil {
@@ -792,7 +1013,7 @@ func (p *Page) resetMessage(key messageKey, before messageRow) bool {
 		}
 
 		p.messages[key] = msg
-		msg.row.SetChild(msg.body)
+		p.setRowChild(key, msg)
 	}
 
 	return true
@@ -825,7 +1046,63 @@ func relatesTo(ev event.RoomEvent) matrix.EventID {
 		json.Unmarshal(ev.RelatesTo, &relatesTo)
 		return relatesTo.EventID
 	default:
-		return ""
+		return poll.RelatesTo(ev)
+	}
+}
+
+// relayoutMessages recreates all messages if the room's message layout has
+// changed. Related events such as edits and reactions are applied again from
+// the state.
+func (p *Page) relayoutMessages() {
+	layout := message.RoomLayout(p.ctx.Take(), p.roomID)
+	if layout == p.layout {
+		return
+	}
+	p.layout = layout
+
+	for i := 0; ; i++ {
+		row := p.list.RowAtIndex(i)
+		if row == nil {
+			break
+		}
+
+		key := messageKeyRow(row)
+
+		msg, ok := p.messages[key]
+		if !ok || msg.custom {
+			continue
+		}
+
+		msg.body = nil
+		p.messages[key] = msg
+		p.resetMessageIx(i)
+	}
+
+	client := p.parent.client.Offline()
+
+	related := make([]event.RoomEvent, 0, len(p.mrelated))
+	for relatedID := range p.mrelated {
+		ev, err := client.RoomTimelineEvent(p.roomID, relatedID)
+		if err == nil {
+			related = append(related, ev)
+		}
+	}
+
+	// Apply the events in order, so that the latest edit wins.
+	sort.Slice(related, func(i, j int) bool {
+		return related[i].RoomInfo().OriginServerTime < related[j].RoomInfo().OriginServerTime
+	})
+
+	for _, ev := range related {
+		if r, ok := p.relatedEvent(ev.RoomInfo().ID); ok {
+			r.body.OnRelatedEvent(ev)
+		}
+	}
+
+	for _, msg := range p.messages {
+		if msg.body != nil {
+			msg.body.LoadMore()
+		}
 	}
 }
 
@@ -848,6 +1125,8 @@ func (p *Page) Load() {
 	}
 	p.loaded = true
 
+	start := time.Now()
+
 	p.ctx.Renew()
 	ctx := p.ctx.Take()
 	client := p.parent.client.WithContext(ctx)
@@ -855,7 +1134,9 @@ func (p *Page) Load() {
 	fetchName := p.name == ""
 
 	load := func(events []event.RoomEvent) {
-		p.main.SetChild(p.box)
+		resolveSenders(client, p.roomID, events)
+
+		p.main.SetChild(p.paned)
 		p.list.GrabFocus()
 		p.scroll.ScrollToBottom()
 
@@ -885,6 +1166,22 @@ func (p *Page) Load() {
 				glib.TimeoutAddPriority(time, glib.PriorityHighIdle, load)
 			}
 		}
+
+		if p.pager.Exhausted() {
+			p.more.done(false)
+		}
+
+		p.ready = true
+		p.scrollToJumped()
+
+		// Show the messages that were left in the outbox last time.
+		p.Composer.RestoreOutbox()
+
+		if gotktrix.InfoEnabled {
+			gtkutil.OnFirstDraw(p.list, func() {
+				log.Printf("room %s: first %d messages drawn in %v", p.roomID, len(events), time.Since(start))
+			})
+		}
 	}
 
 	// We can rely on this comparison to directly call Paginate on the main
@@ -934,6 +1231,8 @@ func (p *Page) loadMore(done paginateDoneFunc) {
 			return func() { done(true, err) }
 		}
 
+		resolveSenders(gotktrix.FromContext(ctx), p.roomID, events)
+
 		return func() {
 			keys := make([]messageKey, len(events))
 			// Require old messages first, so cozy mode works properly.
@@ -941,10 +1240,8 @@ func (p *Page) loadMore(done paginateDoneFunc) {
 				keys[i] = p.onRoomEvent(ev)
 			}
 
-			p.list.GrabFocus()
-
 			// Load the newest messages first so it doesn't screw up scrolling as
-			// hard.
+			// hard. The scroll anchor keeps the viewport in place.
 			for i := len(keys) - 1; i >= 0; i-- {
 				r, ok := p.messages[keys[i]]
 				if ok {
@@ -952,21 +1249,55 @@ func (p *Page) loadMore(done paginateDoneFunc) {
 				}
 			}
 
-			// Scroll to the middle message.
-			for i := len(keys) - 1; i >= 0; i-- {
-				r, ok := p.messages[keys[i]]
-				if ok {
-					glib.IdleAdd(func() { r.row.GrabFocus() })
-					break
-				}
-			}
-
-			// TODO: check for hasMore.
-			done(true, nil)
+			done(!p.pager.Exhausted(), nil)
 		}
 	})
 }
 
+// resolveSenders resolves the names of the senders of the given events all at
+// once. The member events are cached afterwards, so rendering each message
+// doesn't need its own database transaction.
+func resolveSenders(client *gotktrix.Client, roomID matrix.RoomID, events []event.RoomEvent) {
+	seen := make(map[matrix.UserID]struct{}, len(events))
+	senders := make([]matrix.UserID, 0, len(events))
+
+	for _, ev := range events {
+		sender := ev.RoomInfo().Sender
+		if _, ok := seen[sender]; !ok {
+			seen[sender] = struct{}{}
+			senders = append(senders, sender)
+		}
+	}
+
+	client.Offline().MemberNames(roomID, senders, true)
+}
+
+// endNotice returns the notice shown at the top of the timeline once there are
+// no more messages to load.
+func (p *Page) endNotice() string {
+	if p.pager.ReachedCreation() {
+		return locale.S(p.ctx.Take(), "This is the beginning of the room.")
+	}
+
+	client := gotktrix.FromContext(p.ctx.Take()).Offline()
+
+	e, err := client.RoomState(p.roomID, event.TypeRoomHistoryVisibility, "")
+	if err == nil {
+		switch e.(*event.RoomHistoryVisibilityEvent).Visibility {
+		case event.VisibilityJoined:
+			return locale.S(p.ctx.Take(),
+				"You can't see earlier messages, since this room only shows "+
+					"messages sent after you joined.")
+		case event.VisibilityInvited:
+			return locale.S(p.ctx.Take(),
+				"You can't see earlier messages, since this room only shows "+
+					"messages sent after you were invited.")
+		}
+	}
+
+	return locale.S(p.ctx.Take(), "You can't see earlier messages.")
+}
+
 // ScrollTo implements message.MessageViewer.
 func (p *Page) ScrollTo(eventID matrix.EventID) bool {
 	m, ok := p.relatedEvent(eventID)
@@ -1002,6 +1333,44 @@ func (p *Page) ReplyTo(eventID matrix.EventID) {
 	)
 }
 
+// Quote implements message.MessageViewer.
+func (p *Page) Quote(eventID matrix.EventID, text string) {
+	msg, ok := p.messages[messageKeyEventID(eventID)]
+	if !ok {
+		return
+	}
+
+	input := p.Composer.Input()
+	input.InsertQuote(msg.ev.RoomInfo().Sender, text)
+	input.GrabFocus()
+}
+
+// MentionUser implements message.MessageViewer.
+func (p *Page) MentionUser(userID matrix.UserID) {
+	input := p.Composer.Input()
+	input.InsertMention(userID)
+	input.GrabFocus()
+}
+
+// DirectMessage implements message.MessageViewer.
+func (p *Page) DirectMessage(userID matrix.UserID) {
+	ctx := p.ctx.Take()
+	client := gotktrix.FromContext(ctx)
+
+	if roomID, ok := client.Offline().DirectRoom(userID); ok {
+		p.parent.ctrl.OpenRoom(roomID)
+		return
+	}
+
+	gtkutil.Async(ctx, func() func() {
+		roomID, err := client.CreateDirectRoom(userID)
+		if err != nil {
+			return func() { app.Error(ctx, err) }
+		}
+		return func() { p.parent.ctrl.OpenRoom(roomID) }
+	})
+}
+
 func (p *Page) singleMessageState(
 	eventID matrix.EventID,
 	field *matrix.EventID, set func(matrix.EventID) bool, class string) {
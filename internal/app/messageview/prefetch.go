@@ -0,0 +1,56 @@
+package messageview
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// nPrefetch is the number of most recently active rooms to prefetch.
+const nPrefetch = 10
+
+// Prefetch fetches the latest messages of the user's most recently active rooms
+// in the background, so that opening them can render right away. It should be
+// called once the initial sync is done. Nothing is fetched in low-data mode.
+func Prefetch(ctx context.Context) {
+	client := gotktrix.FromContext(ctx)
+	if client.LowDataMode() {
+		return
+	}
+
+	go func() {
+		roomIDs, err := client.Rooms()
+		if err != nil {
+			log.Println("cannot get rooms to prefetch:", err)
+			return
+		}
+
+		latest := make(map[matrix.RoomID]matrix.Timestamp, len(roomIDs))
+		for _, roomID := range roomIDs {
+			ev, _ := client.State.LatestInTimeline(roomID, "")
+			if ev != nil {
+				latest[roomID] = ev.RoomInfo().OriginServerTime
+			}
+		}
+
+		sort.Slice(roomIDs, func(i, j int) bool {
+			return latest[roomIDs[i]] > latest[roomIDs[j]]
+		})
+
+		if len(roomIDs) > nPrefetch {
+			roomIDs = roomIDs[:nPrefetch]
+		}
+
+		for _, roomID := range roomIDs {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := client.PrefetchRoom(ctx, roomID, maxFetch); err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,219 @@
+package messageview
+
+import (
+	"context"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/components/onlineimage"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var sendReceipts = prefs.NewBool(true, prefs.PropMeta{
+	Name:    "Send Read Receipts",
+	Section: "Rooms",
+	Description: "Let other people see which messages you've read. If this " +
+		"is off, read receipts are sent privately, so only your own devices " +
+		"know.",
+})
+
+// maxReceiptAvatars is the number of avatars shown under a message before the
+// rest are counted.
+const maxReceiptAvatars = 5
+
+const receiptAvatarSize = 16
+
+var receiptsCSS = cssutil.Applier("messageview-receipts", `
+	.messageview-receipts {
+		margin: 0 8px 2px 0;
+	}
+	.messageview-receipts > .messageview-receipt {
+		margin-left: -4px;
+	}
+	.messageview-receipts > .messageview-receipt:first-child {
+		margin-left: 0;
+	}
+	.messageview-receipts > label {
+		margin-left: 2px;
+		font-size: 0.75em;
+		color: alpha(@theme_fg_color, 0.75);
+	}
+`)
+
+// receiptIndex keeps track of the messages that other users have read up to.
+type receiptIndex struct {
+	// users maps each user to the event that they've read up to.
+	users map[matrix.UserID]matrix.EventID
+}
+
+func newReceiptIndex() receiptIndex {
+	return receiptIndex{
+		users: make(map[matrix.UserID]matrix.EventID),
+	}
+}
+
+// readers returns the users that have read up to the message with the given
+// key. Receipts on related events, such as reactions, count as receipts on the
+// message that they relate to.
+func (p *Page) readers(key messageKey) []matrix.UserID {
+	if !key.IsEvent() {
+		return nil
+	}
+
+	var users []matrix.UserID
+	for userID, eventID := range p.receipts.users {
+		if r, ok := p.relatedEvent(eventID); ok && r.row.Name() == string(key) {
+			users = append(users, userID)
+		}
+	}
+
+	return users
+}
+
+// addReceipts moves the read markers of the users in the receipt event, and
+// then updates the avatar stacks of the affected messages.
+func (p *Page) addReceipts(ev *event.ReceiptEvent) {
+	self := p.parent.client.UserID
+	changed := make(map[messageKey]bool)
+
+	for eventID, receipt := range ev.Events {
+		for userID := range receipt.Read {
+			if userID == self {
+				continue
+			}
+
+			old, ok := p.receipts.users[userID]
+			if ok && old == eventID {
+				continue
+			}
+
+			// Receipts only move forward, so ignore receipts that arrive
+			// out of order.
+			if ok && p.isOlder(eventID, old) {
+				continue
+			}
+
+			if r, ok := p.relatedEvent(old); ok {
+				changed[messageKeyRow(r.row)] = true
+			}
+			if r, ok := p.relatedEvent(eventID); ok {
+				changed[messageKeyRow(r.row)] = true
+			}
+
+			p.receipts.users[userID] = eventID
+		}
+	}
+
+	for key := range changed {
+		if msg, ok := p.messages[key]; ok {
+			p.setRowChild(key, msg)
+		}
+	}
+}
+
+// isOlder returns true if the first event is known to be older than the
+// second one.
+func (p *Page) isOlder(id1, id2 matrix.EventID) bool {
+	r1, ok1 := p.relatedEvent(id1)
+	r2, ok2 := p.relatedEvent(id2)
+	if !ok1 || !ok2 {
+		return false
+	}
+	return r1.ev.RoomInfo().OriginServerTime < r2.ev.RoomInfo().OriginServerTime
+}
+
+// receiptStack returns the avatars of the users who've read up to the message
+// with the given key, or nil if there are none.
+func (p *Page) receiptStack(key messageKey) gtk.Widgetter {
+	users := p.readers(key)
+	if len(users) == 0 {
+		return nil
+	}
+
+	ctx := p.ctx.Take()
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	box.SetHAlign(gtk.AlignEnd)
+	receiptsCSS(box)
+
+	avatars := make([]*onlineimage.Avatar, 0, maxReceiptAvatars)
+	for i := 0; i < len(users) && i < maxReceiptAvatars; i++ {
+		avatar := onlineimage.NewAvatar(ctx, gotktrix.AvatarProvider, receiptAvatarSize)
+		avatar.AddCSSClass("messageview-receipt")
+		avatar.SetInitials(string(users[i]))
+		box.Append(avatar)
+		avatars = append(avatars, avatar)
+	}
+
+	if more := len(users) - maxReceiptAvatars; more > 0 {
+		box.Append(gtk.NewLabel(locale.Sprintf(ctx, "+%d", more)))
+	}
+
+	roomID := p.roomID
+
+	gtkutil.Async(ctx, func() func() {
+		client := gotktrix.FromContext(ctx).Offline()
+
+		names, err := client.MemberNames(roomID, users, false)
+		if err != nil {
+			names = make([]gotktrix.MemberName, len(users))
+			for i, userID := range users {
+				names[i].Name = string(userID)
+			}
+		}
+
+		mxcs := make([]*matrix.URL, len(avatars))
+		for i := range avatars {
+			mxcs[i], _ = client.MemberAvatar(roomID, users[i])
+		}
+
+		return func() {
+			for i, avatar := range avatars {
+				avatar.SetInitials(names[i].Name)
+				if mxcs[i] != nil {
+					avatar.SetFromURL(string(*mxcs[i]))
+				}
+			}
+
+			box.SetTooltipText(readByTooltip(ctx, names))
+		}
+	})
+
+	return box
+}
+
+func readByTooltip(ctx context.Context, names []gotktrix.MemberName) string {
+	strs := make([]string, len(names))
+	for i, name := range names {
+		strs[i] = name.Name
+	}
+
+	const maxNames = 10
+	if len(strs) > maxNames {
+		more := len(strs) - maxNames
+		return locale.Sprintf(ctx, "Read by %s and %d more",
+			strings.Join(strs[:maxNames], ", "), more)
+	}
+
+	return locale.Sprintf(ctx, "Read by %s", strings.Join(strs, ", "))
+}
+
+// loadReceipts adds the latest receipts that are in the state.
+func (p *Page) loadReceipts() {
+	client := p.parent.client.Offline()
+
+	e, err := client.RoomEvent(p.roomID, event.TypeReceipt)
+	if err != nil {
+		return
+	}
+
+	if ev, ok := e.(*event.ReceiptEvent); ok {
+		p.addReceipts(ev)
+	}
+}
@@ -0,0 +1,254 @@
+package messageview
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var collapseReplies = prefs.NewBool(true, prefs.PropMeta{
+	Name:    "Collapse Reply Chains",
+	Section: "Text",
+	Description: "Collapse long chains of replies to a message, only showing " +
+		"the latest reply.",
+})
+
+// maxReplies is the number of replies that a message can have before its reply
+// chain is collapsed.
+const maxReplies = 3
+
+var repliesCSS = cssutil.Applier("messageview-replies", `
+	.messageview-replies {
+		margin: 2px 0;
+		margin-left: calc(8px + 36px + 8px); /* see cozy.go */
+		padding: 0 6px;
+		font-size: 0.9em;
+	}
+`)
+
+// replyIndex keeps track of reply chains within a page. A chain is rooted at
+// the message that isn't a reply to another message that we know of.
+type replyIndex struct {
+	// parents maps a reply to the event that it replies to.
+	parents map[matrix.EventID]matrix.EventID
+	// chains maps a root event to all replies within its chain.
+	chains map[matrix.EventID][]messageKey
+	// expanded is the set of chains that the user has expanded.
+	expanded map[matrix.EventID]bool
+	// hidden is the set of replies that are collapsed away.
+	hidden map[messageKey]bool
+	// summaries maps the reply that holds the "View N replies" button to the
+	// number of collapsed replies and the chain's root.
+	summaries map[messageKey]replySummary
+	// boxes keeps track of rows whose child is a box that wraps the message
+	// body together with the reply or thread summary buttons.
+	boxes map[messageKey]replyBox
+}
+
+type replyBox struct {
+	*gtk.Box
+	body gtk.Widgetter
+}
+
+type replySummary struct {
+	root matrix.EventID
+	n    int
+}
+
+func newReplyIndex() replyIndex {
+	return replyIndex{
+		parents:   make(map[matrix.EventID]matrix.EventID),
+		chains:    make(map[matrix.EventID][]messageKey),
+		expanded:  make(map[matrix.EventID]bool),
+		hidden:    make(map[messageKey]bool),
+		summaries: make(map[messageKey]replySummary),
+		boxes:     make(map[messageKey]replyBox),
+	}
+}
+
+// root returns the root of the chain that the given event is in.
+func (r *replyIndex) root(id matrix.EventID) matrix.EventID {
+	// Guard against malicious cycles.
+	for i := 0; i < 1000; i++ {
+		parent, ok := r.parents[id]
+		if !ok {
+			break
+		}
+		id = parent
+	}
+	return id
+}
+
+// repliesTo returns the event ID that the given event is replying to, or an
+// empty string if it's not a reply.
+func repliesTo(ev event.RoomEvent) matrix.EventID {
+	msg, ok := ev.(*event.RoomMessageEvent)
+	if !ok {
+		return ""
+	}
+
+	var relatesTo struct {
+		InReplyTo struct {
+			EventID matrix.EventID `json:"event_id"`
+		} `json:"m.in_reply_to"`
+		IsFallingBack bool `json:"is_falling_back"`
+	}
+
+	json.Unmarshal(msg.RelatesTo, &relatesTo)
+
+	if relatesTo.IsFallingBack {
+		return ""
+	}
+	return relatesTo.InReplyTo.EventID
+}
+
+// addReply registers the message with the given key into the reply index if
+// it's a reply. The root of its chain is returned, or an empty string if the
+// message isn't a reply.
+func (p *Page) addReply(key messageKey, ev event.RoomEvent) matrix.EventID {
+	parent := repliesTo(ev)
+	if parent == "" {
+		return ""
+	}
+
+	p.replies.parents[ev.RoomInfo().ID] = parent
+
+	root := p.replies.root(parent)
+	for _, reply := range p.replies.chains[root] {
+		if reply == key {
+			return root
+		}
+	}
+
+	p.replies.chains[root] = append(p.replies.chains[root], key)
+	return root
+}
+
+// invalidateReplies recalculates which replies in the chain rooted at the
+// given event should be collapsed.
+func (p *Page) invalidateReplies(root matrix.EventID) {
+	chain := p.replies.chains[root][:0]
+	for _, key := range p.replies.chains[root] {
+		// Drop messages that have been cleaned up.
+		if _, ok := p.messages[key]; ok {
+			chain = append(chain, key)
+		}
+	}
+
+	if len(chain) == 0 {
+		delete(p.replies.chains, root)
+		delete(p.replies.expanded, root)
+		return
+	}
+
+	sort.SliceStable(chain, func(i, j int) bool {
+		ti := p.messages[chain[i]].ev.RoomInfo().OriginServerTime
+		tj := p.messages[chain[j]].ev.RoomInfo().OriginServerTime
+		return ti < tj
+	})
+	p.replies.chains[root] = chain
+
+	collapsed := collapseReplies.Value() &&
+		len(chain) > maxReplies &&
+		!p.replies.expanded[root]
+
+	for i, key := range chain {
+		last := i == len(chain)-1
+		_, hadSummary := p.replies.summaries[key]
+
+		if collapsed && !last {
+			p.replies.hidden[key] = true
+		} else {
+			delete(p.replies.hidden, key)
+		}
+
+		if collapsed && last {
+			p.replies.summaries[key] = replySummary{root: root, n: len(chain) - 1}
+		} else {
+			delete(p.replies.summaries, key)
+		}
+
+		// Only update the widget if the summary changes.
+		if _, hasSummary := p.replies.summaries[key]; hasSummary || hadSummary {
+			p.setRowChild(key, p.messages[key])
+		}
+	}
+
+	p.list.InvalidateFilter()
+}
+
+// invalidateAllReplies invalidates all reply chains.
+func (p *Page) invalidateAllReplies() {
+	for root := range p.replies.chains {
+		p.invalidateReplies(root)
+	}
+}
+
+// expandReplies expands the reply chain rooted at the given event.
+func (p *Page) expandReplies(root matrix.EventID) {
+	p.replies.expanded[root] = true
+	p.invalidateReplies(root)
+}
+
+// setRowChild sets the message's body as the child of its row, prepending the
+// reply summary button and appending the thread summary button and the read
+// receipts if there are any.
+func (p *Page) setRowChild(key messageKey, msg messageRow) {
+	if msg.body == nil || msg.custom {
+		return
+	}
+
+	p.unwrapStatus(key)
+
+	// Unparent the body from the old box, if any, so it can be reparented.
+	if box, ok := p.replies.boxes[key]; ok {
+		box.Remove(box.body)
+		delete(p.replies.boxes, key)
+	}
+
+	if _, ok := p.spam.collapsed[key]; ok {
+		msg.row.SetChild(p.spamPlaceholder(key))
+		return
+	}
+
+	summary, ok := p.replies.summaries[key]
+	thread := p.threadSummary(key, msg)
+	receipts := p.receiptStack(key)
+
+	if !ok && thread == nil && receipts == nil {
+		msg.row.SetChild(p.wrapStatus(key, msg.body))
+		return
+	}
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+
+	if ok {
+		button := gtk.NewButtonWithLabel(locale.Plural(
+			p.ctx.Take(), "View %d reply", "View %d replies", summary.n,
+		))
+		button.SetHasFrame(false)
+		button.SetHAlign(gtk.AlignStart)
+		button.ConnectClicked(func() { p.expandReplies(summary.root) })
+		repliesCSS(button)
+		box.Append(button)
+	}
+
+	box.Append(msg.body)
+
+	if thread != nil {
+		box.Append(thread)
+	}
+
+	if receipts != nil {
+		box.Append(receipts)
+	}
+
+	p.replies.boxes[key] = replyBox{box, msg.body}
+	msg.row.SetChild(p.wrapStatus(key, box))
+}
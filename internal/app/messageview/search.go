@@ -0,0 +1,331 @@
+package messageview
+
+import (
+	"context"
+	"html"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// jumpContext is the number of messages around a jumped-to message that are
+// loaded with it.
+const jumpContext = 10
+
+var searchCSS = cssutil.Applier("messageview-search", `
+	.messageview-search > revealer > box {
+		padding: 4px;
+	}
+	.messageview-search-results {
+		background: none;
+	}
+	.messageview-search-results > row {
+		padding: 4px 6px;
+	}
+	.messageview-search-results .messageview-search-header {
+		font-size: 0.9em;
+	}
+	.messageview-search-status {
+		margin: 6px;
+	}
+`)
+
+// searchBar is the bar on top of a page that searches for messages, either in
+// the page's room or in all rooms.
+type searchBar struct {
+	*gtk.SearchBar
+	entry    *gtk.SearchEntry
+	allRooms *gtk.CheckButton
+	scroll   *gtk.ScrolledWindow
+	list     *gtk.ListBox
+	status   *gtk.Label
+	more     *gtk.Button
+
+	page    *Page
+	cancel  context.CancelFunc
+	term    string
+	next    string
+	results []gotktrix.SearchResult
+}
+
+func newSearchBar(p *Page) *searchBar {
+	s := searchBar{page: p}
+	ctx := p.roomCtx
+
+	s.entry = gtk.NewSearchEntry()
+	s.entry.SetHExpand(true)
+	s.entry.SetObjectProperty("placeholder-text", locale.S(ctx, "Search Messages..."))
+	s.entry.ConnectActivate(func() { s.search(s.entry.Text()) })
+	s.entry.ConnectStopSearch(func() { s.SetSearchMode(false) })
+
+	s.allRooms = gtk.NewCheckButtonWithLabel(locale.S(ctx, "All Rooms"))
+	s.allRooms.ConnectToggled(func() {
+		if s.term != "" {
+			s.search(s.term)
+		}
+	})
+
+	top := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	top.Append(s.entry)
+	top.Append(s.allRooms)
+
+	s.list = gtk.NewListBox()
+	s.list.AddCSSClass("messageview-search-results")
+	s.list.SetSelectionMode(gtk.SelectionNone)
+	s.list.SetActivateOnSingleClick(true)
+	s.list.ConnectRowActivated(func(row *gtk.ListBoxRow) {
+		if ix := row.Index(); ix < len(s.results) {
+			s.jump(s.results[ix])
+		}
+	})
+
+	s.more = gtk.NewButtonWithLabel(locale.S(ctx, "More Results"))
+	s.more.SetHasFrame(false)
+	s.more.SetVisible(false)
+	s.more.ConnectClicked(func() { s.load(s.term, s.next) })
+
+	results := gtk.NewBox(gtk.OrientationVertical, 0)
+	results.Append(s.list)
+	results.Append(s.more)
+
+	s.scroll = gtk.NewScrolledWindow()
+	s.scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	s.scroll.SetPropagateNaturalHeight(true)
+	s.scroll.SetMaxContentHeight(300)
+	s.scroll.SetChild(results)
+	s.scroll.SetVisible(false)
+
+	s.status = gtk.NewLabel("")
+	s.status.AddCSSClass("messageview-search-status")
+	s.status.AddCSSClass("dim-label")
+	s.status.SetVisible(false)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(top)
+	box.Append(s.status)
+	box.Append(s.scroll)
+
+	s.SearchBar = gtk.NewSearchBar()
+	s.SearchBar.ConnectEntry(&s.entry.Editable)
+	s.SearchBar.SetShowCloseButton(true)
+	s.SearchBar.SetChild(box)
+	s.SearchBar.NotifyProperty("search-mode-enabled", func() {
+		if !s.SearchMode() {
+			s.clear()
+		}
+	})
+	searchCSS(s)
+
+	return &s
+}
+
+// show reveals the search bar and focuses the entry.
+func (s *searchBar) show() {
+	s.SetSearchMode(true)
+	s.entry.GrabFocus()
+}
+
+// clear stops the ongoing search and removes all results.
+func (s *searchBar) clear() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+
+	for row := s.list.RowAtIndex(0); row != nil; row = s.list.RowAtIndex(0) {
+		s.list.Remove(row)
+	}
+
+	s.term = ""
+	s.next = ""
+	s.results = nil
+
+	s.more.SetVisible(false)
+	s.scroll.SetVisible(false)
+	s.status.SetVisible(false)
+}
+
+func (s *searchBar) search(term string) {
+	s.clear()
+	if term == "" {
+		return
+	}
+
+	s.term = term
+	s.load(term, "")
+}
+
+// load fetches the page of results after the given batch.
+func (s *searchBar) load(term, next string) {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	ctx, cancel := context.WithCancel(s.page.roomCtx)
+	s.cancel = cancel
+
+	var roomID matrix.RoomID
+	if !s.allRooms.Active() {
+		roomID = s.page.roomID
+	}
+
+	client := gotktrix.FromContext(ctx)
+
+	s.more.SetSensitive(false)
+	if next == "" {
+		s.status.SetLabel(locale.S(ctx, "Searching..."))
+		s.status.SetVisible(true)
+	}
+
+	gtkutil.Async(ctx, func() func() {
+		results, err := client.SearchMessages(term, roomID, next)
+		if err != nil {
+			return func() {
+				s.status.SetVisible(false)
+				app.Error(ctx, errors.Wrap(err, "failed to search messages"))
+			}
+		}
+
+		return func() {
+			s.more.SetSensitive(true)
+			s.addResults(ctx, results)
+		}
+	})
+}
+
+func (s *searchBar) addResults(ctx context.Context, results gotktrix.SearchResults) {
+	client := gotktrix.FromContext(ctx).Offline()
+
+	for _, result := range results.Results {
+		s.results = append(s.results, result)
+		s.list.Append(s.newResultRow(ctx, client, result))
+	}
+
+	s.next = results.NextBatch
+	s.more.SetVisible(s.next != "")
+
+	if len(s.results) == 0 {
+		s.status.SetLabel(locale.S(ctx, "No messages found."))
+		s.status.SetVisible(true)
+		s.scroll.SetVisible(false)
+		return
+	}
+
+	s.status.SetVisible(false)
+	s.scroll.SetVisible(true)
+}
+
+func (s *searchBar) newResultRow(
+	ctx context.Context, client *gotktrix.Client, result gotktrix.SearchResult) *gtk.ListBoxRow {
+
+	sender := string(result.Sender)
+	if name, err := client.MemberName(result.RoomID, result.Sender, false); err == nil {
+		sender = name.Name
+	}
+
+	markup := "<b>" + html.EscapeString(sender) + "</b>"
+	if result.RoomID != s.page.roomID {
+		room, _ := client.RoomName(result.RoomID)
+		markup += " " + html.EscapeString(locale.Sprintf(ctx, "in %s", room))
+	}
+	markup += ` <span alpha="75%">` +
+		html.EscapeString(locale.Time(result.Time.Time(), true)) +
+		`</span>`
+
+	header := gtk.NewLabel("")
+	header.AddCSSClass("messageview-search-header")
+	header.SetMarkup(markup)
+	header.SetXAlign(0)
+	header.SetEllipsize(pango.EllipsizeEnd)
+
+	body := gtk.NewLabel(result.Body)
+	body.SetXAlign(0)
+	body.SetWrap(true)
+	body.SetWrapMode(pango.WrapWordChar)
+	body.SetLines(3)
+	body.SetEllipsize(pango.EllipsizeEnd)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 2)
+	box.Append(header)
+	box.Append(body)
+
+	row := gtk.NewListBoxRow()
+	row.SetChild(box)
+	return row
+}
+
+// jump shows the message of the result, opening its room if it's in another
+// one.
+func (s *searchBar) jump(result gotktrix.SearchResult) {
+	if result.RoomID == s.page.roomID {
+		s.page.JumpTo(result.EventID)
+		return
+	}
+
+	v := s.page.parent
+	v.ctrl.OpenRoom(result.RoomID)
+
+	if page := v.Current(); page != nil && page.roomID == result.RoomID {
+		page.JumpTo(result.EventID)
+	}
+}
+
+// ShowSearch reveals the bar to search for messages.
+func (p *Page) ShowSearch() {
+	p.search.show()
+}
+
+// JumpTo scrolls to the message with the given event ID. If the message isn't
+// loaded yet, then it's fetched along with the messages around it first.
+func (p *Page) JumpTo(eventID matrix.EventID) {
+	if p.ScrollTo(eventID) {
+		return
+	}
+
+	p.jumping = eventID
+
+	ctx := p.ctx.Take()
+	client := gotktrix.FromContext(ctx)
+
+	gtkutil.Async(ctx, func() func() {
+		events, err := client.RoomEventContext(p.roomID, eventID, jumpContext)
+		if err != nil {
+			return func() { app.Error(ctx, errors.Wrap(err, "failed to load message")) }
+		}
+
+		resolveSenders(client, p.roomID, events)
+
+		return func() {
+			for _, ev := range events {
+				key := p.onRoomEvent(ev)
+				if r, ok := p.messages[key]; ok {
+					r.body.LoadMore()
+				}
+			}
+
+			p.scrollToJumped()
+		}
+	})
+}
+
+// scrollToJumped scrolls to the message that was jumped to once the page is
+// shown.
+func (p *Page) scrollToJumped() {
+	if p.jumping == "" || !p.ready {
+		return
+	}
+
+	eventID := p.jumping
+	gtkutil.OnFirstDraw(p.list, func() {
+		if p.ScrollTo(eventID) {
+			p.jumping = ""
+		}
+	})
+}
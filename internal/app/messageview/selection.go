@@ -0,0 +1,126 @@
+package messageview
+
+import (
+	"sort"
+
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// selectionBar is the bar shown on top of the page while messages are being
+// selected.
+type selectionBar struct {
+	*gtk.Revealer
+	label *gtk.Label
+	copy  *gtk.Button
+}
+
+var selectionCSS = cssutil.Applier("messageview-selection", `
+	.messageview-selection {
+		padding: 4px 8px;
+		border-bottom: 1px solid @borders;
+	}
+	.messageview-selecting > row:selected {
+		background-color: alpha(@theme_selected_bg_color, 0.35);
+	}
+`)
+
+func newSelectionBar(p *Page) *selectionBar {
+	b := selectionBar{}
+
+	b.label = gtk.NewLabel("")
+	b.label.SetHExpand(true)
+	b.label.SetXAlign(0)
+
+	b.copy = gtk.NewButtonWithLabel(locale.S(p.roomCtx, "Copy as Quote"))
+	b.copy.AddCSSClass("suggested-action")
+	b.copy.ConnectClicked(func() {
+		p.copySelection()
+		p.stopSelecting()
+	})
+
+	cancel := gtk.NewButtonWithLabel(locale.S(p.roomCtx, "Cancel"))
+	cancel.ConnectClicked(p.stopSelecting)
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 6)
+	box.Append(b.label)
+	box.Append(cancel)
+	box.Append(b.copy)
+	selectionCSS(box)
+
+	b.Revealer = gtk.NewRevealer()
+	b.Revealer.SetTransitionType(gtk.RevealerTransitionTypeSlideDown)
+	b.Revealer.SetRevealChild(false)
+	b.Revealer.SetChild(box)
+
+	return &b
+}
+
+// SelectMessages implements message.MessageViewer. It puts the message list
+// into selection mode with the given message selected. More messages are
+// selected with Ctrl-click, and a range with Shift-click.
+func (p *Page) SelectMessages(eventID matrix.EventID) {
+	msg, ok := p.messages[messageKeyEventID(eventID)]
+	if !ok {
+		return
+	}
+
+	if p.list.SelectionMode() != gtk.SelectionMultiple {
+		p.list.SetSelectionMode(gtk.SelectionMultiple)
+		p.list.AddCSSClass("messageview-selecting")
+		p.selection.SetRevealChild(true)
+	}
+
+	p.list.SelectRow(msg.row)
+	p.invalidateSelection()
+}
+
+// stopSelecting leaves selection mode.
+func (p *Page) stopSelecting() {
+	// Setting the mode to none unselects everything.
+	p.list.SetSelectionMode(gtk.SelectionNone)
+	p.list.RemoveCSSClass("messageview-selecting")
+	p.selection.SetRevealChild(false)
+}
+
+// invalidateSelection updates the selection bar for the selected messages.
+func (p *Page) invalidateSelection() {
+	if p.list.SelectionMode() != gtk.SelectionMultiple {
+		return
+	}
+
+	n := len(p.list.SelectedRows())
+	p.selection.label.SetText(locale.Plural(p.roomCtx,
+		"%d message selected, Shift-click to select more",
+		"%d messages selected, Shift-click to select more", n))
+	p.selection.copy.SetSensitive(n > 0)
+}
+
+// copySelection copies the selected messages into the clipboard as a quote.
+func (p *Page) copySelection() {
+	rows := p.list.SelectedRows()
+	events := make([]event.RoomEvent, 0, len(rows))
+
+	for _, row := range rows {
+		msg, ok := p.messages[messageKeyRow(row)]
+		if ok && !msg.custom {
+			events = append(events, msg.ev)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].RoomInfo().OriginServerTime < events[j].RoomInfo().OriginServerTime
+	})
+
+	text := message.QuoteConversation(p.roomCtx, events)
+	if text == "" {
+		return
+	}
+
+	gdk.DisplayGetDefault().Clipboard().SetText(text)
+}
@@ -0,0 +1,76 @@
+package messageview
+
+import (
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+)
+
+var spamCSS = cssutil.Applier("messageview-spam", `
+	.messageview-spam {
+		margin: 2px 8px;
+		font-size: 0.9em;
+		opacity: 0.6;
+	}
+`)
+
+// spamIndex keeps track of the messages within a page that are collapsed
+// because they matched one of the user's spam rules. Messages that are hidden
+// by a rule go into the hiddenIndex instead.
+type spamIndex struct {
+	collapsed map[messageKey]struct{}
+}
+
+func newSpamIndex() spamIndex {
+	return spamIndex{
+		collapsed: make(map[messageKey]struct{}),
+	}
+}
+
+// addSpam checks the message with the given key against the user's spam rules
+// and subscribed policy lists, and hides or collapses it if it matches any.
+func (p *Page) addSpam(key messageKey, ev event.RoomEvent) {
+	client := p.parent.client.Offline()
+
+	if _, isMessage := ev.(*event.RoomMessageEvent); isMessage {
+		// Messages from users banned by a policy list are always hidden.
+		if _, ok := client.MatchPolicy(ev.RoomInfo().Sender); ok {
+			p.hidden.events[ev.RoomInfo().ID] = key
+			p.invalidateHidden()
+			return
+		}
+	}
+
+	rule, ok := client.MatchSpam(ev)
+	if !ok {
+		return
+	}
+
+	switch rule.Action {
+	case gotktrix.SpamHide:
+		// Rule-hidden messages aren't persisted, so they're shown again once
+		// the rule is removed.
+		p.hidden.events[ev.RoomInfo().ID] = key
+		p.invalidateHidden()
+	case gotktrix.SpamCollapse:
+		p.spam.collapsed[key] = struct{}{}
+	}
+}
+
+// spamPlaceholder creates the widget that's shown in place of a collapsed
+// message. Clicking it reveals the message.
+func (p *Page) spamPlaceholder(key messageKey) gtk.Widgetter {
+	button := gtk.NewButtonWithLabel(locale.S(p.ctx.Take(), "Message collapsed by a spam rule"))
+	button.SetTooltipText(locale.S(p.ctx.Take(), "Show Message"))
+	button.SetHasFrame(false)
+	button.SetHAlign(gtk.AlignStart)
+	button.ConnectClicked(func() {
+		delete(p.spam.collapsed, key)
+		p.setRowChild(key, p.messages[key])
+	})
+	spamCSS(button)
+
+	return button
+}
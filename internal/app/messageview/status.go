@@ -0,0 +1,287 @@
+package messageview
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// deliveryStatus is the delivery status of one of the user's own messages.
+type deliveryStatus uint8
+
+const (
+	// statusSending means the message is being sent.
+	statusSending deliveryStatus = iota
+	// statusSent means the homeserver has accepted the message.
+	statusSent
+	// statusDelivered means the message has come back from the homeserver
+	// through syncing.
+	statusDelivered
+	// statusRead means someone else has read the message.
+	statusRead
+	// statusFailed means the message could not be sent.
+	statusFailed
+	// statusQueued means the message is waiting in the outbox for the
+	// connection to come back.
+	statusQueued
+)
+
+func (s deliveryStatus) icon() string {
+	switch s {
+	case statusSending:
+		return "content-loading-symbolic"
+	case statusSent:
+		return "object-select-symbolic"
+	case statusDelivered:
+		return "emblem-ok-symbolic"
+	case statusRead:
+		return "view-reveal-symbolic"
+	case statusFailed:
+		return "dialog-error-symbolic"
+	case statusQueued:
+		return "network-offline-symbolic"
+	default:
+		return ""
+	}
+}
+
+func (s deliveryStatus) tooltip(ctx context.Context) string {
+	switch s {
+	case statusSending:
+		return locale.S(ctx, "Sending")
+	case statusSent:
+		return locale.S(ctx, "Sent")
+	case statusDelivered:
+		return locale.S(ctx, "Delivered to the server")
+	case statusRead:
+		return locale.S(ctx, "Read")
+	case statusFailed:
+		return locale.S(ctx, "Failed to send")
+	case statusQueued:
+		return locale.S(ctx, "Waiting for the connection to send")
+	default:
+		return ""
+	}
+}
+
+var statusCSS = cssutil.Applier("messageview-status", `
+	.messageview-status {
+		margin: 4px 8px 0 4px;
+		opacity: 0.5;
+	}
+	.messageview-status-failed {
+		color: @error_color;
+		opacity: 1;
+		padding: 0;
+		min-width: 0;
+		min-height: 0;
+	}
+`)
+
+// statusRow is the box that puts a message's status icon at the end of its
+// row.
+type statusRow struct {
+	*gtk.Box
+	child gtk.Widgetter
+	icon  *gtk.Image
+	// failed replaces the icon once the message fails to send. It shows the
+	// options to send the message again or to delete it.
+	failed *gtk.Button
+}
+
+// statusIndex keeps track of the delivery status of the user's own messages
+// within a page.
+type statusIndex struct {
+	statuses map[messageKey]deliveryStatus
+	rows     map[messageKey]statusRow
+	// retries holds the callbacks that send the failed messages again.
+	retries map[messageKey]func()
+	// txns maps the transaction IDs of the messages that are being sent to
+	// their local keys, so that they can be matched with the events that come
+	// back from syncing.
+	txns map[string]messageKey
+	// readUpTo is the timestamp of the latest message of the user's that was
+	// read by someone else.
+	readUpTo matrix.Timestamp
+}
+
+func newStatusIndex() statusIndex {
+	return statusIndex{
+		statuses: make(map[messageKey]deliveryStatus),
+		rows:     make(map[messageKey]statusRow),
+		retries:  make(map[messageKey]func()),
+		txns:     make(map[string]messageKey),
+	}
+}
+
+// delete forgets the message with the given key.
+func (s *statusIndex) delete(key messageKey) {
+	delete(s.statuses, key)
+	delete(s.rows, key)
+	delete(s.retries, key)
+
+	for txnID, k := range s.txns {
+		if k == key {
+			delete(s.txns, txnID)
+			break
+		}
+	}
+}
+
+// unwrapStatus removes the child from the message's status row, if any, so
+// that it can be reparented.
+func (p *Page) unwrapStatus(key messageKey) {
+	if row, ok := p.status.rows[key]; ok {
+		row.Remove(row.child)
+		delete(p.status.rows, key)
+	}
+}
+
+// wrapStatus puts the given child of the message's row into a box with the
+// message's status icon, if the message has a status.
+func (p *Page) wrapStatus(key messageKey, child gtk.Widgetter) gtk.Widgetter {
+	status, ok := p.status.statuses[key]
+	if !ok {
+		return child
+	}
+
+	gtk.BaseWidget(child).SetHExpand(true)
+
+	icon := gtk.NewImage()
+	icon.SetVAlign(gtk.AlignStart)
+	statusCSS(icon)
+
+	failed := gtk.NewButtonFromIconName(statusFailed.icon())
+	failed.AddCSSClass("messageview-status-failed")
+	failed.SetHasFrame(false)
+	failed.SetVAlign(gtk.AlignStart)
+	failed.SetTooltipText(locale.S(p.ctx.Take(), "Failed to send, click for options"))
+	failed.ConnectClicked(func() { p.showFailedMenu(key, failed) })
+	statusCSS(failed)
+
+	row := statusRow{
+		Box:    gtk.NewBox(gtk.OrientationHorizontal, 0),
+		child:  child,
+		icon:   icon,
+		failed: failed,
+	}
+	row.Append(child)
+	row.Append(icon)
+	row.Append(failed)
+
+	p.status.rows[key] = row
+	p.updateStatusIcon(row, status)
+
+	return row
+}
+
+func (p *Page) updateStatusIcon(row statusRow, status deliveryStatus) {
+	row.icon.SetFromIconName(status.icon())
+	row.icon.SetTooltipText(status.tooltip(p.ctx.Take()))
+	row.icon.SetVisible(status != statusFailed)
+	row.failed.SetVisible(status == statusFailed)
+}
+
+// showFailedMenu shows the menu of the failed message with the given key,
+// which lets the user send it again or delete it.
+func (p *Page) showFailedMenu(key messageKey, button *gtk.Button) {
+	_, canRetry := p.status.retries[key]
+
+	gtkutil.BindActionMap(button, map[string]func(){
+		"sending.retry":  func() { p.retrySending(key) },
+		"sending.delete": func() { p.StopSendingMessage(key) },
+	})
+
+	gtkutil.ShowPopoverMenuCustom(button, gtk.PosBottom, []gtkutil.PopoverMenuItem{
+		gtkutil.MenuItem(locale.S(p.ctx.Take(), "_Retry"), "sending.retry", canRetry),
+		gtkutil.MenuItem(locale.S(p.ctx.Take(), "_Delete"), "sending.delete"),
+	})
+}
+
+// retrySending sends the failed message with the given key again.
+func (p *Page) retrySending(key messageKey) {
+	retry, ok := p.status.retries[key]
+	if !ok {
+		return
+	}
+
+	delete(p.status.retries, key)
+	p.setStatus(key, statusSending)
+	retry()
+}
+
+// setStatus sets the delivery status of the message with the given key.
+func (p *Page) setStatus(key messageKey, status deliveryStatus) {
+	p.status.statuses[key] = status
+
+	if row, ok := p.status.rows[key]; ok {
+		p.updateStatusIcon(row, status)
+		return
+	}
+
+	// The row doesn't have an icon yet, so rewrap it.
+	if msg, ok := p.messages[key]; ok {
+		p.setRowChild(key, msg)
+	}
+}
+
+// checkOwnMessage updates the status of the given message if it's the user's.
+// The message must have come from the homeserver.
+func (p *Page) checkOwnMessage(key messageKey, ev event.RoomEvent) {
+	if _, ok := ev.(*event.RoomMessageEvent); !ok {
+		return
+	}
+	if ev.RoomInfo().Sender != p.parent.client.UserID {
+		return
+	}
+
+	status := statusDelivered
+	if ev.RoomInfo().OriginServerTime <= p.status.readUpTo {
+		status = statusRead
+	}
+
+	if p.status.statuses[key] != status {
+		p.setStatus(key, status)
+	}
+}
+
+// onReceipt marks the user's messages that were read by someone else as read.
+func (p *Page) onReceipt(ev *event.ReceiptEvent) {
+	self := p.parent.client.UserID
+
+	for eventID, receipt := range ev.Events {
+		msg, ok := p.messages[messageKeyEventID(eventID)]
+		if !ok {
+			continue
+		}
+
+		readByOthers := false
+		for userID := range receipt.Read {
+			if userID != self {
+				readByOthers = true
+				break
+			}
+		}
+
+		ts := msg.ev.RoomInfo().OriginServerTime
+		if readByOthers && ts > p.status.readUpTo {
+			p.status.readUpTo = ts
+		}
+	}
+
+	for key, status := range p.status.statuses {
+		if status != statusSent && status != statusDelivered {
+			continue
+		}
+
+		msg, ok := p.messages[key]
+		if ok && msg.ev.RoomInfo().OriginServerTime <= p.status.readUpTo {
+			p.setStatus(key, statusRead)
+		}
+	}
+}
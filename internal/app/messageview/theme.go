@@ -0,0 +1,99 @@
+package messageview
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// RoomClass returns the CSS class that is given to the message view of the room
+// with the given ID. Custom CSS can use it to theme specific rooms. The ID is
+// kept as-is, except for characters that can't be in a class name, which are
+// replaced with dashes, so "!abc:matrix.org" becomes
+// "messageview-room-abc-matrix-org".
+func RoomClass(roomID matrix.RoomID) string {
+	return "messageview-room-" + classID(string(roomID))
+}
+
+// SpaceClass returns the CSS class that is given to the message views of rooms
+// inside the space with the given ID. It is formatted like RoomClass.
+func SpaceClass(spaceID matrix.RoomID) string {
+	return "messageview-space-" + classID(string(spaceID))
+}
+
+func classID(id string) string {
+	id = strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '_':
+			return r
+		default:
+			return '-'
+		}
+	}, id)
+	return strings.Trim(id, "-")
+}
+
+// roomClasses returns the CSS classes of the room's message view: the room's
+// class and the classes of the spaces that it's in.
+func roomClasses(client *gotktrix.Client, roomID matrix.RoomID) []string {
+	classes := []string{"messageview-room", RoomClass(roomID)}
+
+	client.EachRoomStateLen(roomID, m.SpaceParentEventType, func(ev event.StateEvent, _ int) error {
+		if parent, ok := ev.(*m.SpaceParentEvent); ok {
+			classes = append(classes, SpaceClass(parent.SpaceRoomID()))
+		}
+		return nil
+	})
+
+	return classes
+}
+
+// accentCSS is the CSS that uses the room's accent color. %[1]s is the room's
+// class, and %[2]s is the color.
+const accentCSS = `
+	.%[1]s .message-mentions {
+		border-left-color: %[2]s;
+		background-color: alpha(%[2]s, 0.05);
+	}
+	.%[1]s.titlebar,
+	.%[1]s.messageview-split-header {
+		box-shadow: inset 0 -2px %[2]s;
+	}
+`
+
+// bindAccent applies the room's accent color, if any, to the page and to
+// anything else with the room's class, such as the header, for as long as the
+// page is mapped.
+func (p *Page) bindAccent() {
+	provider := gtk.NewCSSProvider()
+
+	update := func() {
+		var css string
+		if color := message.RoomAccent(p.roomCtx, p.roomID); color != nil {
+			css = fmt.Sprintf(accentCSS, RoomClass(p.roomID), color.String())
+		}
+		provider.LoadFromData(css)
+	}
+
+	gtkutil.BindSubscribe(p.box, func() func() {
+		update()
+
+		display := gdk.DisplayGetDefault()
+		gtk.StyleContextAddProviderForDisplay(
+			display, provider, gtk.STYLE_PROVIDER_PRIORITY_APPLICATION)
+
+		return func() {
+			gtk.StyleContextRemoveProviderForDisplay(display, provider)
+		}
+	})
+
+	message.SubscribeAccent(p.box, update)
+}
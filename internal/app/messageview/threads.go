@@ -0,0 +1,586 @@
+package messageview
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/autoscroll"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/compose"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+var threadSummaryCSS = cssutil.Applier("messageview-thread-summary", `
+	.messageview-thread-summary {
+		margin: 2px 0;
+		margin-left: calc(8px + 36px + 8px); /* see cozy.go */
+		padding: 0 6px;
+		font-size: 0.9em;
+	}
+`)
+
+var threadPaneCSS = cssutil.Applier("messageview-thread", `
+	.messageview-thread {
+		border-left: 1px solid @borders;
+	}
+`)
+
+// threadIndex keeps track of the messages within a page that are in a thread.
+// These messages are only shown in the thread pane.
+type threadIndex struct {
+	// roots maps a message to the root of the thread that it's in.
+	roots map[messageKey]matrix.EventID
+}
+
+func newThreadIndex() threadIndex {
+	return threadIndex{
+		roots: make(map[messageKey]matrix.EventID),
+	}
+}
+
+// count returns the number of messages in the page that are in the thread
+// rooted at the given event.
+func (t *threadIndex) count(root matrix.EventID) int {
+	var n int
+	for _, r := range t.roots {
+		if r == root {
+			n++
+		}
+	}
+	return n
+}
+
+// addThreadReply registers the message with the given key as a message in the
+// given thread. It's hidden from the list once it's added.
+func (p *Page) addThreadReply(key messageKey, root matrix.EventID) {
+	p.threads.roots[key] = root
+}
+
+// invalidateThread updates the summary of the thread rooted at the given event.
+func (p *Page) invalidateThread(root matrix.EventID) {
+	key := messageKeyEventID(root)
+	if msg, ok := p.messages[key]; ok {
+		p.setRowChild(key, msg)
+	}
+}
+
+// threadSummary returns the button that opens the thread rooted at the given
+// message, or nil if the message has no thread.
+func (p *Page) threadSummary(key messageKey, msg messageRow) gtk.Widgetter {
+	if !key.IsEvent() {
+		return nil
+	}
+
+	root := key.EventID()
+
+	// The homeserver's count might not include replies that arrived after the
+	// root was synced, so take whichever's larger.
+	n := p.threads.count(root)
+	if count := gotktrix.ThreadCount(msg.ev); count > n {
+		n = count
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	button := gtk.NewButtonWithLabel(locale.Plural(
+		p.ctx.Take(), "%d reply in thread", "%d replies in thread", n,
+	))
+	button.SetHasFrame(false)
+	button.SetHAlign(gtk.AlignStart)
+	button.ConnectClicked(func() { p.OpenThread(root) })
+	threadSummaryCSS(button)
+
+	return button
+}
+
+// OpenThread opens the thread rooted at the given event in the pane beside the
+// messages. The previous thread is closed.
+func (p *Page) OpenThread(root matrix.EventID) {
+	if p.thread != nil {
+		if p.thread.root == root {
+			p.thread.composer.Input().GrabFocus()
+			return
+		}
+		p.CloseThread()
+	}
+
+	p.thread = newThreadPane(p, root)
+	p.paned.SetEndChild(p.thread)
+	p.paned.SetPosition(p.paned.AllocatedWidth() * 3 / 5)
+
+	p.thread.composer.Input().GrabFocus()
+}
+
+// CloseThread closes the thread pane, if it's open.
+func (p *Page) CloseThread() {
+	if p.thread == nil {
+		return
+	}
+
+	p.thread.cancel()
+	p.thread = nil
+	p.paned.SetEndChild(nil)
+}
+
+// threadPane shows the messages in a thread with a composer that sends
+// messages into it.
+type threadPane struct {
+	*gtk.Box
+	scroll   *autoscroll.Window
+	list     *gtk.ListBox
+	composer *compose.Composer
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	page   *Page
+	root   matrix.EventID
+
+	messages map[messageKey]threadMessage
+
+	editing    matrix.EventID
+	replyingTo matrix.EventID
+}
+
+type threadMessage struct {
+	row    *gtk.ListBoxRow
+	ev     event.RoomEvent
+	body   message.Message
+	custom bool
+	// before is the event that the body was created after.
+	before matrix.EventID
+}
+
+var _ compose.Controller = (*threadPane)(nil)
+
+func newThreadPane(p *Page, root matrix.EventID) *threadPane {
+	ctx, cancel := context.WithCancel(p.roomCtx)
+
+	t := threadPane{
+		ctx:      ctx,
+		cancel:   cancel,
+		page:     p,
+		root:     root,
+		messages: make(map[messageKey]threadMessage),
+	}
+
+	title := gtk.NewLabel(locale.S(ctx, "Thread"))
+	title.SetHExpand(true)
+	title.SetXAlign(0)
+
+	closeThread := gtk.NewButtonFromIconName("window-close-symbolic")
+	closeThread.SetHasFrame(false)
+	closeThread.SetTooltipText(locale.S(ctx, "Close Thread"))
+	closeThread.ConnectClicked(p.CloseThread)
+
+	header := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	header.AddCSSClass("messageview-split-header")
+	header.Append(title)
+	header.Append(closeThread)
+
+	t.list = gtk.NewListBox()
+	t.list.SetSelectionMode(gtk.SelectionNone)
+	t.list.SetSortFunc(func(r1, r2 *gtk.ListBoxRow) int {
+		m1, ok1 := t.messages[messageKeyRow(r1)]
+		m2, ok2 := t.messages[messageKeyRow(r2)]
+		if !ok1 || !ok2 {
+			return 0
+		}
+
+		t1 := m1.ev.RoomInfo().OriginServerTime
+		t2 := m2.ev.RoomInfo().OriginServerTime
+		switch {
+		case t1 < t2:
+			return -1
+		case t1 > t2:
+			return 1
+		default:
+			return 0
+		}
+	})
+	msgListCSS(t.list)
+
+	t.scroll = autoscroll.NewWindow()
+	t.scroll.SetVExpand(true)
+	t.scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	t.scroll.SetChild(t.list)
+	t.list.SetAdjustment(t.scroll.VAdjustment())
+
+	t.composer = compose.New(ctx, &t, p.roomID)
+	t.composer.SetThread(root)
+
+	t.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+	t.Box.SetHExpand(true)
+	t.Box.Append(header)
+	t.Box.Append(t.scroll)
+	t.Box.Append(t.composer)
+	t.Box.AddCSSClass("messageview-box")
+	splitCSS(t.Box)
+	threadPaneCSS(t.Box)
+
+	gtkutil.ForwardTyping(t.list, t.composer.Input())
+
+	// Show what the page already has, then fill in the rest.
+	if msg, ok := p.messages[messageKeyEventID(root)]; ok {
+		t.addEvent(msg.ev)
+	}
+	for key, r := range p.threads.roots {
+		if msg, ok := p.messages[key]; ok && r == root {
+			t.addEvent(msg.ev)
+		}
+	}
+	t.relayout()
+
+	t.load()
+
+	return &t
+}
+
+// load fetches the thread's root and messages.
+func (t *threadPane) load() {
+	client := gotktrix.FromContext(t.ctx)
+	roomID := t.page.roomID
+
+	gtkutil.Async(t.ctx, func() func() {
+		root, err := client.RoomTimelineEvent(roomID, t.root)
+		if err != nil {
+			return func() { app.Error(t.ctx, errors.Wrap(err, "failed to get thread root")) }
+		}
+
+		events, err := client.RoomThread(roomID, t.root)
+
+		return func() {
+			if err != nil {
+				app.Error(t.ctx, errors.Wrap(err, "failed to get thread"))
+			}
+
+			t.addEvent(root)
+			for _, ev := range events {
+				t.addEvent(ev)
+			}
+			t.relayout()
+			t.scroll.ScrollToBottom()
+		}
+	})
+}
+
+// onRoomEvent adds the event if it's in the thread, or applies it to the
+// message that it's related to.
+func (t *threadPane) onRoomEvent(ev event.RoomEvent) {
+	if gotktrix.ThreadOf(ev) == t.root {
+		t.addEvent(ev)
+		t.relayout()
+		return
+	}
+
+	if id := relatesTo(ev); id != "" {
+		if msg, ok := t.messages[messageKeyEventID(id)]; ok && msg.body != nil {
+			msg.body.OnRelatedEvent(ev)
+		}
+	}
+}
+
+// addEvent adds the given event into the list. The bodies are created in
+// relayout.
+func (t *threadPane) addEvent(ev event.RoomEvent) {
+	key := messageKeyEvent(ev)
+
+	if msg, ok := t.messages[key]; ok {
+		if !eventEq(msg.ev, ev) {
+			msg.ev = ev
+			msg.body = nil
+			t.messages[key] = msg
+		}
+		return
+	}
+
+	t.addRow(key, threadMessage{ev: ev})
+}
+
+func (t *threadPane) addRow(key messageKey, msg threadMessage) {
+	if msg.row == nil {
+		msg.row = gtk.NewListBoxRow()
+		msg.row.SetName(string(key))
+		msg.row.AddCSSClass("messageview-messagerow")
+	}
+
+	t.messages[key] = msg
+	t.list.Append(msg.row)
+}
+
+// relayout creates the bodies of the messages that don't have one or whose
+// previous message has changed, so that they're collapsed properly.
+func (t *threadPane) relayout() {
+	var before message.Message
+	var beforeID matrix.EventID
+
+	for i := 0; ; i++ {
+		row := t.list.RowAtIndex(i)
+		if row == nil {
+			break
+		}
+
+		key := messageKeyRow(row)
+
+		msg, ok := t.messages[key]
+		if !ok {
+			continue
+		}
+
+		if !msg.custom && (msg.body == nil || msg.before != beforeID) {
+			msg.body = message.NewCozyMessage(t.ctx, t, msg.ev, before)
+			msg.before = beforeID
+			msg.row.SetChild(msg.body)
+			msg.body.SetBlur(key.IsLocal())
+			msg.body.LoadMore()
+			t.messages[key] = msg
+		}
+
+		if !msg.custom {
+			before = msg.body
+			beforeID = msg.ev.RoomInfo().ID
+		}
+	}
+}
+
+// FocusLatestUserEventID implements compose.Controller.
+func (t *threadPane) FocusLatestUserEventID() matrix.EventID {
+	userID := gotktrix.FromContext(t.ctx).UserID
+
+	for i := len(t.messages) - 1; i >= 0; i-- {
+		row := t.list.RowAtIndex(i)
+		if row == nil {
+			continue
+		}
+
+		key := messageKeyRow(row)
+		if !key.IsEvent() {
+			continue
+		}
+
+		msg, ok := t.messages[key]
+		if ok && msg.ev.RoomInfo().Sender == userID {
+			row.GrabFocus()
+			return msg.ev.RoomInfo().ID
+		}
+	}
+
+	return ""
+}
+
+// AddSendingMessage implements compose.Controller.
+func (t *threadPane) AddSendingMessage(ev event.RoomEvent) interface{} {
+	key := messageKeyLocal()
+	t.addRow(key, threadMessage{ev: ev})
+	t.relayout()
+	t.scroll.ScrollToBottom()
+	return key
+}
+
+// AddSendingMessageCustom implements compose.Controller.
+func (t *threadPane) AddSendingMessageCustom(ev event.RoomEvent, w gtk.Widgetter) interface{} {
+	key := messageKeyLocal()
+
+	row := gtk.NewListBoxRow()
+	row.SetName(string(key))
+	row.SetChild(w)
+	row.AddCSSClass("messageview-messagerow")
+	row.AddCSSClass("messageview-usermessage-custom")
+
+	t.addRow(key, threadMessage{row: row, ev: ev, custom: true})
+	t.scroll.ScrollToBottom()
+	return key
+}
+
+// StopSendingMessage implements compose.Controller.
+func (t *threadPane) StopSendingMessage(mark interface{}) bool {
+	key, ok := mark.(messageKey)
+	if !ok {
+		return false
+	}
+
+	msg, ok := t.messages[key]
+	if !ok {
+		return false
+	}
+
+	delete(t.messages, key)
+	t.list.Remove(msg.row)
+	t.relayout()
+
+	return true
+}
+
+// FailSendingMessage implements compose.Controller. Clicking the failed message
+// shows the options to send it again or to delete it.
+func (t *threadPane) FailSendingMessage(mark interface{}, retry func()) {
+	key, ok := mark.(messageKey)
+	if !ok {
+		return
+	}
+
+	msg, ok := t.messages[key]
+	if !ok {
+		return
+	}
+
+	msg.row.SetTooltipText(locale.S(t.ctx, "Failed to send, click for options"))
+
+	click := gtk.NewGestureClick()
+	click.ConnectReleased(func(int, float64, float64) {
+		gtkutil.BindActionMap(msg.row, map[string]func(){
+			"sending.retry": func() {
+				msg.row.RemoveController(click)
+				msg.row.SetTooltipText("")
+				retry()
+			},
+			"sending.delete": func() { t.StopSendingMessage(key) },
+		})
+
+		gtkutil.ShowPopoverMenuCustom(msg.row, gtk.PosBottom, []gtkutil.PopoverMenuItem{
+			gtkutil.MenuItem(locale.S(t.ctx, "_Retry"), "sending.retry", retry != nil),
+			gtkutil.MenuItem(locale.S(t.ctx, "_Delete"), "sending.delete"),
+		})
+	})
+	msg.row.AddController(click)
+}
+
+// QueueSendingMessage implements compose.Controller.
+func (t *threadPane) QueueSendingMessage(mark interface{}) {
+	key, ok := mark.(messageKey)
+	if !ok {
+		return
+	}
+
+	if msg, ok := t.messages[key]; ok {
+		msg.row.SetTooltipText(locale.S(t.ctx, "Waiting for the connection to send"))
+	}
+}
+
+// BindSendingMessage implements compose.Controller.
+func (t *threadPane) BindSendingMessage(mark interface{}, evID matrix.EventID) bool {
+	key, ok := mark.(messageKey)
+	if !ok {
+		return false
+	}
+
+	msg, ok := t.messages[key]
+	if !ok {
+		return false
+	}
+	delete(t.messages, key)
+
+	eventKey := messageKeyEventID(evID)
+
+	// The synchronized message arrived first, so just use that.
+	if _, ok := t.messages[eventKey]; ok {
+		t.list.Remove(msg.row)
+		t.relayout()
+		return true
+	}
+
+	msg.ev.RoomInfo().ID = evID
+	msg.custom = false
+	msg.body = nil
+	msg.row.SetName(string(eventKey))
+	msg.row.SetTooltipText("")
+	t.messages[eventKey] = msg
+	t.relayout()
+
+	return false
+}
+
+// ReplyTo implements message.MessageViewer.
+func (t *threadPane) ReplyTo(eventID matrix.EventID) {
+	if t.editing != "" {
+		t.Edit("")
+	}
+	t.singleMessageState(eventID, &t.replyingTo, t.composer.ReplyTo, "messageview-replyingto")
+}
+
+// Edit implements message.MessageViewer.
+func (t *threadPane) Edit(eventID matrix.EventID) {
+	if t.replyingTo != "" {
+		t.ReplyTo("")
+	}
+	t.singleMessageState(eventID, &t.editing, t.composer.Edit, "messageview-editing")
+}
+
+func (t *threadPane) singleMessageState(
+	eventID matrix.EventID,
+	field *matrix.EventID, set func(matrix.EventID) bool, class string) {
+
+	if *field != "" {
+		if msg, ok := t.messages[messageKeyEventID(*field)]; ok {
+			msg.row.RemoveCSSClass(class)
+		}
+		*field = ""
+	}
+
+	msg, ok := t.messages[messageKeyEventID(eventID)]
+	if !ok || !set(eventID) {
+		set("")
+		return
+	}
+
+	msg.row.AddCSSClass(class)
+	*field = eventID
+}
+
+// Quote implements message.MessageViewer.
+func (t *threadPane) Quote(eventID matrix.EventID, text string) {
+	msg, ok := t.messages[messageKeyEventID(eventID)]
+	if !ok {
+		return
+	}
+
+	input := t.composer.Input()
+	input.InsertQuote(msg.ev.RoomInfo().Sender, text)
+	input.GrabFocus()
+}
+
+// ScrollTo implements message.MessageViewer. Messages that aren't in the thread
+// are scrolled to in the page.
+func (t *threadPane) ScrollTo(eventID matrix.EventID) bool {
+	if msg, ok := t.messages[messageKeyEventID(eventID)]; ok {
+		return msg.row.GrabFocus()
+	}
+	return t.page.ScrollTo(eventID)
+}
+
+// SetHidden implements message.MessageViewer.
+func (t *threadPane) SetHidden(eventID matrix.EventID, hidden bool) {
+	t.page.SetHidden(eventID, hidden)
+}
+
+// OpenThread implements message.MessageViewer.
+func (t *threadPane) OpenThread(root matrix.EventID) {
+	t.page.OpenThread(root)
+}
+
+// SelectMessages implements message.MessageViewer. Messages are selected in
+// the page, since the selection bar belongs to it.
+func (t *threadPane) SelectMessages(eventID matrix.EventID) {
+	t.page.SelectMessages(eventID)
+}
+
+// MentionUser implements message.MessageViewer. The mention is inserted into
+// the thread's composer.
+func (t *threadPane) MentionUser(userID matrix.UserID) {
+	input := t.composer.Input()
+	input.InsertMention(userID)
+	input.GrabFocus()
+}
+
+// DirectMessage implements message.MessageViewer.
+func (t *threadPane) DirectMessage(userID matrix.UserID) {
+	t.page.DirectMessage(userID)
+}
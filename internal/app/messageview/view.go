@@ -4,15 +4,27 @@ import (
 	"context"
 
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
 	"github.com/diamondburned/gotrix/matrix"
 )
 
-// View describes a view for multiple message views.
+// View describes a view for multiple message views. It can optionally show a
+// second room side by side with the current one.
 type View struct {
-	*gtk.Stack
+	*gtk.Paned
+	stack *gtk.Stack
 	empty gtk.Widgetter
 
+	split struct {
+		*gtk.Box
+		header *gtk.Box
+		title  *gtk.Label
+		page   *Page
+	}
+
 	ctx    context.Context
 	ctrl   Controller
 	client *gotktrix.Client
@@ -24,6 +36,8 @@ type View struct {
 
 type Controller interface {
 	SetSelectedRoom(id matrix.RoomID)
+	// OpenRoom opens the room as the current page.
+	OpenRoom(id matrix.RoomID)
 }
 
 // New creates a new instance of View.
@@ -35,27 +49,69 @@ func New(ctx context.Context, ctrl Controller) *View {
 	// })
 
 	stack := gtk.NewStack()
+	stack.SetHExpand(true)
 	stack.SetTransitionType(gtk.StackTransitionTypeCrossfade)
 
-	return &View{
-		Stack:  stack,
+	paned := gtk.NewPaned(gtk.OrientationHorizontal)
+	paned.SetWideHandle(true)
+	paned.SetResizeStartChild(true)
+	paned.SetResizeEndChild(true)
+	paned.SetShrinkStartChild(false)
+	paned.SetShrinkEndChild(false)
+	paned.SetStartChild(stack)
+
+	v := View{
+		Paned:  paned,
+		stack:  stack,
 		ctx:    ctx,
 		ctrl:   ctrl,
 		client: gotktrix.FromContext(ctx),
 	}
+
+	v.split.title = gtk.NewLabel("")
+	v.split.title.SetHExpand(true)
+	v.split.title.SetXAlign(0)
+	v.split.title.SetEllipsize(pango.EllipsizeEnd)
+
+	closeSplit := gtk.NewButtonFromIconName("window-close-symbolic")
+	closeSplit.SetHasFrame(false)
+	closeSplit.SetTooltipText(locale.S(ctx, "Close Split View"))
+	closeSplit.ConnectClicked(v.CloseSplit)
+
+	v.split.header = gtk.NewBox(gtk.OrientationHorizontal, 0)
+	v.split.header.AddCSSClass("messageview-split-header")
+	v.split.header.Append(v.split.title)
+	v.split.header.Append(closeSplit)
+
+	v.split.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+	v.split.Box.SetHExpand(true)
+	v.split.Box.Append(v.split.header)
+	splitCSS(v.split.Box)
+
+	return &v
 }
 
+var splitCSS = cssutil.Applier("messageview-split", `
+	.messageview-split-header {
+		padding: 2px 2px 2px 8px;
+		border-bottom: 1px solid @borders;
+	}
+	.messageview-split-header label {
+		font-weight: bold;
+	}
+`)
+
 // SetPlaceholder sets the placeholder widget.
 func (v *View) SetPlaceholder(w gtk.Widgetter) {
-	v.Stack.AddChild(w)
+	v.stack.AddChild(w)
 
 	if v.empty != nil {
-		v.Stack.Remove(v.empty)
+		v.stack.Remove(v.empty)
 	}
 	v.empty = w
 
 	if v.current == nil {
-		v.Stack.SetVisibleChild(w)
+		v.stack.SetVisibleChild(w)
 	}
 }
 
@@ -81,23 +137,100 @@ func (v *View) openRoom(id matrix.RoomID, newTab bool) *Page {
 		return v.current
 	}
 
+	// Move the room out of the split view if it's there, since we can't have
+	// two pages of the same room.
+	if v.split.page != nil && v.split.page.roomID == id {
+		v.CloseSplit()
+	}
+
 	page := NewPage(v.ctx, v, id)
 	page.Load()
 
 	gtk.BaseWidget(page).SetName(string(id))
 
-	v.Stack.AddChild(page)
-	v.Stack.SetVisibleChild(page)
+	v.stack.AddChild(page)
+	v.stack.SetVisibleChild(page)
 
 	if v.current != nil {
-		v.Stack.Remove(v.current)
+		v.stack.Remove(v.current)
+		v.current.Close()
 	}
 	v.current = page
 
 	return page
 }
 
+// OpenRoomInSplit opens the room in a second page beside the current one. If
+// the room is already opened in the split view, then it is returned.
+func (v *View) OpenRoomInSplit(id matrix.RoomID) *Page {
+	if v.split.page != nil && v.split.page.roomID == id {
+		return v.split.page
+	}
+	// Don't show the same room twice.
+	if v.current != nil && v.current.roomID == id {
+		return v.current
+	}
+
+	page := NewPage(v.ctx, v, id)
+	page.Load()
+	page.OnTitle(v.split.title.SetLabel)
+
+	gtk.BaseWidget(page).SetName(string(id))
+	gtk.BaseWidget(page).SetVExpand(true)
+
+	if v.split.page != nil {
+		v.split.Box.Remove(v.split.page)
+		v.split.header.RemoveCSSClass(RoomClass(v.split.page.roomID))
+		v.split.page.Close()
+	}
+	v.split.page = page
+	v.split.header.AddCSSClass(RoomClass(id))
+	v.split.Box.Append(page)
+
+	if v.Paned.EndChild() == nil {
+		v.Paned.SetEndChild(v.split)
+		// Split the view evenly.
+		v.Paned.SetPosition(v.Paned.AllocatedWidth() / 2)
+	}
+
+	return page
+}
+
+// CloseSplit closes the split view, if any.
+func (v *View) CloseSplit() {
+	if v.split.page == nil {
+		return
+	}
+
+	v.split.Box.Remove(v.split.page)
+	v.split.header.RemoveCSSClass(RoomClass(v.split.page.roomID))
+	v.split.page.Close()
+	v.split.page = nil
+	v.Paned.SetEndChild(nil)
+}
+
 // Current returns the current page or nil if none.
 func (v *View) Current() *Page {
 	return v.current
 }
+
+// Split returns the page in the split view or nil if none.
+func (v *View) Split() *Page {
+	return v.split.page
+}
+
+// MembersShown returns true if the member sidebar is shown beside the messages.
+func (v *View) MembersShown() bool {
+	return showMembers.Value()
+}
+
+// SetMembersShown shows or hides the member sidebar.
+func (v *View) SetMembersShown(shown bool) {
+	showMembers.Publish(shown)
+}
+
+// NotifyMembersShown calls f every time the member sidebar is shown or hidden
+// for as long as the given widget is mapped.
+func (v *View) NotifyMembersShown(widget gtk.Widgetter, f func(shown bool)) {
+	showMembers.SubscribeWidget(widget, func() { f(showMembers.Value()) })
+}
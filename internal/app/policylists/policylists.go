@@ -0,0 +1,332 @@
+// Package policylists provides the user's subscriptions to moderation policy
+// lists (MSC2313), also known as ban lists, and a dialog to manage them.
+package policylists
+
+import (
+	"context"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/app/prefs/kvstate"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/policy"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+const listsKey = "lists"
+
+func acquireListsConfig(ctx context.Context, uID matrix.UserID) *kvstate.Config {
+	return kvstate.AcquireConfig(ctx, "policy", gotktrix.Base64UserID(uID), "lists.json")
+}
+
+// Load loads the current account's policy list subscriptions into the client.
+func Load(ctx context.Context) {
+	client := gotktrix.FromContext(ctx)
+	client.SetPolicyLists(lists(ctx, client.UserID))
+}
+
+func lists(ctx context.Context, uID matrix.UserID) []gotktrix.PolicyList {
+	var lists []gotktrix.PolicyList
+	acquireListsConfig(ctx, uID).Get(listsKey, &lists)
+	return lists
+}
+
+var modes = []gotktrix.PolicyMode{
+	gotktrix.PolicyFilter,
+	gotktrix.PolicyBan,
+}
+
+func modeNames(ctx context.Context) []string {
+	return []string{
+		locale.S(ctx, "Hide messages"),
+		locale.S(ctx, "Hide and ban"),
+	}
+}
+
+var listsCSS = cssutil.Applier("policylists", `
+	.policylists {
+		padding: 15px;
+	}
+	.policylists > scrolledwindow {
+		margin: 8px 0;
+	}
+	.policylists-row {
+		padding: 4px 0;
+	}
+	.policylists-row > box > * {
+		margin-right: 6px;
+	}
+	.policylists-rules {
+		font-size: 0.9em;
+		margin-left: 12px;
+	}
+	.policylists-count {
+		color: alpha(@theme_fg_color, 0.75);
+		font-size: 0.9em;
+	}
+	.policylists-add > * {
+		margin-right: 6px;
+	}
+	.policylists-add {
+		margin-bottom: 6px;
+	}
+`)
+
+type listRow struct {
+	*gtk.Box
+	roomID matrix.RoomID
+	mode   *gtk.DropDown
+}
+
+func newListRow(ctx context.Context, list gotktrix.PolicyList, remove func(*listRow)) *listRow {
+	client := gotktrix.FromContext(ctx).Offline()
+
+	r := listRow{roomID: list.RoomID}
+
+	name := gtk.NewLabel(string(list.RoomID))
+	name.SetHExpand(true)
+	name.SetXAlign(0)
+	name.SetEllipsize(pango.EllipsizeEnd)
+	name.SetTooltipText(string(list.RoomID))
+
+	if roomName, err := client.RoomName(list.RoomID); err == nil {
+		name.SetText(roomName)
+	}
+
+	rules := client.PolicyRules(list.RoomID)
+
+	count := gtk.NewLabel(locale.Plural(ctx, "%d rule", "%d rules", len(rules)))
+	count.AddCSSClass("policylists-count")
+
+	r.mode = gtk.NewDropDownFromStrings(modeNames(ctx))
+	r.mode.SetTooltipText(locale.S(ctx, "Bans only apply in rooms where you can ban"))
+	for i, mode := range modes {
+		if mode == list.Mode {
+			r.mode.SetSelected(uint(i))
+		}
+	}
+
+	removeButton := gtk.NewButtonFromIconName("list-remove-symbolic")
+	removeButton.SetTooltipText(locale.S(ctx, "Unsubscribe"))
+	removeButton.SetHasFrame(false)
+	removeButton.ConnectClicked(func() { remove(&r) })
+
+	top := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	top.Append(name)
+	top.Append(count)
+	top.Append(r.mode)
+	top.Append(removeButton)
+
+	ruleList := gtk.NewLabel(formatRules(ctx, rules))
+	ruleList.AddCSSClass("policylists-rules")
+	ruleList.SetSelectable(true)
+	ruleList.SetWrap(true)
+	ruleList.SetWrapMode(pango.WrapWordChar)
+	ruleList.SetXAlign(0)
+
+	expander := gtk.NewExpander(locale.S(ctx, "Rules"))
+	expander.SetChild(ruleList)
+
+	r.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+	r.Box.AddCSSClass("policylists-row")
+	r.Box.Append(top)
+	r.Box.Append(expander)
+
+	return &r
+}
+
+func formatRules(ctx context.Context, rules []gotktrix.PolicyRule) string {
+	if len(rules) == 0 {
+		return locale.S(ctx, "This list has no ban rules.")
+	}
+
+	var b strings.Builder
+	for i, rule := range rules {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+
+		switch rule.Type {
+		case policy.UserRuleEventType:
+			b.WriteString(locale.S(ctx, "User"))
+		case policy.ServerRuleEventType:
+			b.WriteString(locale.S(ctx, "Server"))
+		case policy.RoomRuleEventType:
+			b.WriteString(locale.S(ctx, "Room"))
+		}
+
+		b.WriteString(": ")
+		b.WriteString(rule.Entity)
+
+		if rule.Reason != "" {
+			b.WriteString(" (")
+			b.WriteString(rule.Reason)
+			b.WriteString(")")
+		}
+	}
+
+	return b.String()
+}
+
+func (r *listRow) list() gotktrix.PolicyList {
+	return gotktrix.PolicyList{
+		RoomID: r.roomID,
+		Mode:   modes[r.mode.Selected()],
+	}
+}
+
+// Show shows a dialog that lets the user subscribe to policy lists, choose how
+// each list is applied and unsubscribe from them. Subscribing to a list joins
+// its room. The subscriptions are stored per account.
+func Show(ctx context.Context) {
+	client := gotktrix.FromContext(ctx)
+
+	description := gtk.NewLabel(locale.S(ctx,
+		"Messages from users and servers banned by these lists are hidden on this device. "+
+			"Lists that also ban can be applied to the rooms that you moderate."))
+	description.SetWrap(true)
+	description.SetXAlign(0)
+
+	list := gtk.NewBox(gtk.OrientationVertical, 0)
+
+	var rows []*listRow
+
+	remove := func(r *listRow) {
+		list.Remove(r)
+		for i, row := range rows {
+			if row == r {
+				rows = append(rows[:i], rows[i+1:]...)
+				break
+			}
+		}
+	}
+
+	addRow := func(l gotktrix.PolicyList) {
+		for _, row := range rows {
+			if row.roomID == l.RoomID {
+				return
+			}
+		}
+
+		row := newListRow(ctx, l, remove)
+		rows = append(rows, row)
+		list.Append(row)
+	}
+
+	for _, l := range lists(ctx, client.UserID) {
+		addRow(l)
+	}
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(list)
+
+	entry := gtk.NewEntry()
+	entry.SetHExpand(true)
+	entry.SetPlaceholderText("#ban-list:example.com")
+	entry.SetInputPurpose(gtk.InputPurposeURL)
+
+	subscribe := gtk.NewButtonWithLabel(locale.S(ctx, "Subscribe"))
+
+	doSubscribe := func() {
+		idOrAlias := strings.TrimSpace(entry.Text())
+		if idOrAlias == "" {
+			return
+		}
+
+		entry.SetSensitive(false)
+		subscribe.SetSensitive(false)
+
+		gtkutil.Async(ctx, func() func() {
+			roomID, err := client.JoinPolicyList(idOrAlias)
+			return func() {
+				entry.SetSensitive(true)
+				subscribe.SetSensitive(true)
+
+				if err != nil {
+					app.Error(ctx, err)
+					return
+				}
+
+				entry.SetText("")
+				addRow(gotktrix.PolicyList{RoomID: roomID, Mode: gotktrix.PolicyFilter})
+			}
+		})
+	}
+
+	entry.ConnectActivate(doSubscribe)
+	subscribe.ConnectClicked(doSubscribe)
+
+	addBox := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	addBox.AddCSSClass("policylists-add")
+	addBox.Append(entry)
+	addBox.Append(subscribe)
+
+	apply := gtk.NewButtonWithLabel(locale.S(ctx, "Apply Bans Now"))
+	apply.SetTooltipText(locale.S(ctx,
+		"Ban members matching the lists that ban from the rooms where you can ban"))
+	apply.SetHAlign(gtk.AlignStart)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(description)
+	box.Append(scroll)
+	box.Append(addBox)
+	box.Append(apply)
+	listsCSS(box)
+
+	d := dialogs.New(ctx, locale.S(ctx, "Cancel"), locale.S(ctx, "Save"))
+	d.SetDefaultSize(500, 400)
+	d.SetTitle(locale.S(ctx, "Policy Lists"))
+	d.SetChild(box)
+	d.BindCancelClose()
+
+	save := func() []gotktrix.PolicyList {
+		newLists := make([]gotktrix.PolicyList, len(rows))
+		for i, row := range rows {
+			newLists[i] = row.list()
+		}
+
+		config := acquireListsConfig(ctx, client.UserID)
+		if len(newLists) > 0 {
+			config.Set(listsKey, newLists)
+		} else {
+			config.Delete(listsKey)
+		}
+
+		client.SetPolicyLists(newLists)
+		return newLists
+	}
+
+	apply.ConnectClicked(func() {
+		save()
+		apply.SetSensitive(false)
+
+		gtkutil.Async(ctx, func() func() {
+			n, err := client.ApplyPolicyBans(ctx)
+			return func() {
+				apply.SetSensitive(true)
+				apply.SetLabel(locale.Plural(ctx, "Banned %d user", "Banned %d users", n))
+
+				if err != nil {
+					app.Error(ctx, errors.Wrap(err, "cannot apply bans"))
+				}
+			}
+		})
+	})
+
+	d.OK.ConnectClicked(func() {
+		save()
+		d.Close()
+		d.Destroy()
+	})
+
+	d.Show()
+}
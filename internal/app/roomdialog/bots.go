@@ -0,0 +1,220 @@
+package roomdialog
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+var botsCSS = cssutil.Applier("roomdialog-bots", `
+	.roomdialog-bots {
+		margin-top: 2px;
+	}
+	.roomdialog-bot {
+		padding: 4px 0;
+	}
+	.roomdialog-bot-kind {
+		font-size: 0.9em;
+		color: alpha(@theme_fg_color, 0.75);
+	}
+	.roomdialog-bots-invite {
+		margin-top: 4px;
+	}
+`)
+
+// addBots adds the section that lists the bots and bridged users in the room.
+// The dialog is closed once a bot's direct chat is opened.
+func (f *form) addBots(ctx context.Context, roomID matrix.RoomID, open OpenFunc) {
+	l := gtk.NewLabel(locale.S(ctx, "Bots and Bridges"))
+	l.SetXAlign(0)
+	l.SetAttributes(textutil.Attrs(
+		pango.NewAttrWeight(pango.WeightBold),
+	))
+
+	placeholder := gtk.NewLabel(locale.S(ctx, "No bots in this room."))
+	placeholder.AddCSSClass("roomdialog-bot-kind")
+	placeholder.SetXAlign(0)
+
+	list := gtk.NewBox(gtk.OrientationVertical, 0)
+	list.Append(placeholder)
+
+	client := gotktrix.FromContext(ctx).Offline()
+	canInvite := client.ExplainAction(roomID, gotktrix.InviteAction, "").Allowed
+
+	// Only offer each network's first bridge, since the rest use the same
+	// network under another namespace.
+	var bridges []gotktrix.KnownBridge
+	var networks []string
+	for _, bridge := range gotktrix.KnownBridges {
+		if len(networks) == 0 || networks[len(networks)-1] != bridge.Network {
+			bridges = append(bridges, bridge)
+			networks = append(networks, bridge.Network)
+		}
+	}
+
+	bridgeDropDown := gtk.NewDropDownFromStrings(networks)
+	bridgeDropDown.SetHExpand(true)
+
+	invite := gtk.NewButtonWithLabel(locale.S(ctx, "Invite Bridge"))
+	invite.SetTooltipText(locale.S(ctx, "Invite the bridge's bot on your homeserver"))
+
+	inviteBox := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	inviteBox.AddCSSClass("roomdialog-bots-invite")
+	inviteBox.SetSensitive(canInvite)
+	inviteBox.Append(bridgeDropDown)
+	inviteBox.Append(invite)
+
+	// Bridged rooms may have many puppets, so keep the dialog from growing
+	// past the screen.
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetPropagateNaturalHeight(true)
+	scroll.SetMaxContentHeight(200)
+	scroll.SetChild(list)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.AddCSSClass("roomdialog-bots")
+	box.Append(scroll)
+	box.Append(inviteBox)
+	botsCSS(box)
+
+	f.box.Append(l)
+	f.box.Append(box)
+
+	closeAndOpen := func(id matrix.RoomID) {
+		f.Close()
+		f.Destroy()
+		if open != nil {
+			open(id)
+		}
+	}
+
+	addBot := func(bot gotktrix.Bot) {
+		placeholder.Hide()
+		list.Append(newBotRow(ctx, roomID, bot, closeAndOpen))
+	}
+
+	invite.ConnectClicked(func() {
+		bridge := bridges[bridgeDropDown.Selected()]
+		botID := client.BridgeBotID(bridge)
+		if botID == "" {
+			return
+		}
+
+		invite.SetSensitive(false)
+
+		gtkutil.Async(ctx, func() func() {
+			err := gotktrix.FromContext(ctx).Invite(roomID, botID, "")
+			return func() {
+				invite.SetSensitive(true)
+				if err != nil {
+					app.Error(ctx, errors.Wrapf(err, "failed to invite %s", botID))
+					return
+				}
+				addBot(gotktrix.DetectBot(botID))
+			}
+		})
+	})
+
+	gtkutil.Async(ctx, func() func() {
+		bots, err := gotktrix.FromContext(ctx).RoomBots(roomID)
+		if err != nil {
+			return func() { app.Error(ctx, err) }
+		}
+
+		return func() {
+			for _, bot := range bots {
+				addBot(bot)
+			}
+		}
+	})
+}
+
+func newBotRow(ctx context.Context, roomID matrix.RoomID, bot gotktrix.Bot, opened OpenFunc) gtk.Widgetter {
+	client := gotktrix.FromContext(ctx).Offline()
+
+	name := gtk.NewLabel(string(bot.UserID))
+	name.SetXAlign(0)
+	name.SetEllipsize(pango.EllipsizeEnd)
+	name.SetTooltipText(string(bot.UserID))
+
+	var kindText string
+	switch bot.Kind {
+	case gotktrix.BridgeBot:
+		kindText = locale.Sprintf(ctx, "%s bridge", bot.Bridge.Network)
+	case gotktrix.BridgedUser:
+		kindText = locale.Sprintf(ctx, "Bridged from %s", bot.Bridge.Network)
+	default:
+		kindText = locale.S(ctx, "Bot")
+	}
+
+	kind := gtk.NewLabel(kindText)
+	kind.AddCSSClass("roomdialog-bot-kind")
+	kind.SetXAlign(0)
+
+	info := gtk.NewBox(gtk.OrientationVertical, 0)
+	info.SetHExpand(true)
+	info.Append(name)
+	info.Append(kind)
+
+	message := gtk.NewButtonFromIconName("mail-send-symbolic")
+	message.SetTooltipText(locale.S(ctx, "Message"))
+	message.SetHasFrame(false)
+	message.SetVAlign(gtk.AlignCenter)
+	message.ConnectClicked(func() {
+		if roomID, ok := client.DirectRoom(bot.UserID); ok {
+			opened(roomID)
+			return
+		}
+
+		message.SetSensitive(false)
+
+		gtkutil.Async(ctx, func() func() {
+			roomID, err := gotktrix.FromContext(ctx).CreateDirectRoom(bot.UserID)
+			if err != nil {
+				return func() {
+					message.SetSensitive(true)
+					app.Error(ctx, err)
+				}
+			}
+			return func() { opened(roomID) }
+		})
+	})
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	box.AddCSSClass("roomdialog-bot")
+	box.Append(info)
+	box.Append(message)
+
+	kick := gtk.NewButtonFromIconName("list-remove-symbolic")
+	kick.SetTooltipText(locale.S(ctx, "Kick"))
+	kick.SetHasFrame(false)
+	kick.SetVAlign(gtk.AlignCenter)
+	kick.SetSensitive(client.ExplainAction(roomID, gotktrix.KickAction, bot.UserID).Allowed)
+	kick.ConnectClicked(func() {
+		kick.SetSensitive(false)
+
+		gtkutil.Async(ctx, func() func() {
+			err := gotktrix.FromContext(ctx).Kick(roomID, bot.UserID, "")
+			if err != nil {
+				return func() {
+					kick.SetSensitive(true)
+					app.Error(ctx, errors.Wrap(err, "failed to kick bot"))
+				}
+			}
+			return func() { box.Hide() }
+		})
+	})
+	box.Append(kick)
+
+	return box
+}
@@ -0,0 +1,94 @@
+package roomdialog
+
+import (
+	"context"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// StartChat shows a dialog that asks for a user ID to start a direct chat
+// with.
+func StartChat(ctx context.Context, open OpenFunc) {
+	f := newForm(ctx, "Start a Chat", "Start")
+
+	userEntry := f.addEntry(locale.S(ctx, "User ID"), "@alice:matrix.org")
+	userEntry.SetInputPurpose(gtk.InputPurposeFreeForm)
+
+	f.OK.ConnectClicked(func() {
+		userID := matrix.UserID(strings.TrimSpace(userEntry.Text()))
+		var roomID matrix.RoomID
+
+		f.do(ctx, func() error {
+			if _, _, err := userID.Parse(); err != nil {
+				return errors.Wrap(err, "invalid user ID")
+			}
+
+			id, err := gotktrix.FromContext(ctx).CreateDirectRoom(userID)
+			if err != nil {
+				return err
+			}
+
+			roomID = id
+			return nil
+		}, func() {
+			if open != nil {
+				open(roomID)
+			}
+		})
+	})
+
+	f.Show()
+}
+
+// CreateRoom shows a dialog that creates a new room.
+func CreateRoom(ctx context.Context, open OpenFunc) {
+	f := newForm(ctx, "Create Room", "Create")
+
+	nameEntry := f.addEntry(locale.S(ctx, "Name"), "")
+	topicEntry := f.addEntry(locale.S(ctx, "Topic"), locale.S(ctx, "Optional"))
+
+	public := gtk.NewCheckButtonWithLabel(locale.S(ctx, "Publish to the room directory"))
+	public.SetMarginTop(8)
+	f.box.Append(public)
+
+	f.OK.ConnectClicked(func() {
+		arg := api.RoomCreateArg{
+			Name:       strings.TrimSpace(nameEntry.Text()),
+			Topic:      strings.TrimSpace(topicEntry.Text()),
+			Visibility: api.RoomPrivate,
+			Preset:     api.PresetPrivateChat,
+		}
+		if public.Active() {
+			arg.Visibility = api.RoomPublic
+			arg.Preset = api.PresetPublicChat
+		}
+
+		var roomID matrix.RoomID
+
+		f.do(ctx, func() error {
+			if arg.Name == "" {
+				return errors.New("room name cannot be empty")
+			}
+
+			id, err := gotktrix.FromContext(ctx).RoomCreate(arg)
+			if err != nil {
+				return errors.Wrap(err, "failed to create room")
+			}
+
+			roomID = id
+			return nil
+		}, func() {
+			if open != nil {
+				open(roomID)
+			}
+		})
+	})
+
+	f.Show()
+}
@@ -0,0 +1,267 @@
+package roomdialog
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// exploreLimit is the maximum number of public rooms fetched at once.
+const exploreLimit = 50
+
+var exploreCSS = cssutil.Applier("roomdialog-explore", `
+	.roomdialog-explore list {
+		background: inherit;
+	}
+	.roomdialog-explore-room {
+		padding: 6px 8px;
+	}
+	.roomdialog-explore-room button {
+		margin-left: 6px;
+	}
+	.roomdialog-explore-topic,
+	.roomdialog-explore-members {
+		font-size: 0.9em;
+	}
+	.roomdialog-explore-members {
+		color: alpha(@theme_fg_color, 0.75);
+	}
+`)
+
+// Explore shows a dialog that lists the public rooms advertised by the user's
+// homeserver. If the homeserver bridges to other networks, then their rooms can
+// be listed too, and their channels and users can be looked up.
+func Explore(ctx context.Context, open OpenFunc) {
+	list := gtk.NewListBox()
+	list.SetSelectionMode(gtk.SelectionNone)
+	list.SetShowSeparators(true)
+	list.SetPlaceholder(gtk.NewLabel(locale.S(ctx, "No rooms found.")))
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(list)
+
+	busy := gtk.NewSpinner()
+	busy.SetSizeRequest(24, 24)
+
+	search := gtk.NewSearchEntry()
+	search.SetHExpand(true)
+	search.SetObjectProperty("placeholder-text", locale.S(ctx, "Search Public Rooms..."))
+
+	// network is only added if the homeserver bridges to other networks.
+	// networks holds the third-party instance ID of each of its items, with
+	// the homeserver's own directory first.
+	var network *gtk.DropDown
+	networks := []string{""}
+
+	bridged := gtk.NewButtonFromIconName("system-search-symbolic")
+	bridged.SetTooltipText(locale.S(ctx, "Look Up Bridged Channels and Users"))
+	bridged.Hide()
+
+	top := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	top.Append(search)
+	top.Append(bridged)
+	top.Append(busy)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 4)
+	box.Append(top)
+	box.Append(scroll)
+	exploreCSS(box)
+
+	win := gtk.NewWindow()
+	win.SetTransientFor(app.GTKWindowFromContext(ctx))
+	win.SetModal(true)
+	win.SetDefaultSize(450, 550)
+	win.SetTitle(app.FromContext(ctx).SuffixedTitle(locale.S(ctx, "Explore Rooms")))
+	win.SetChild(box)
+
+	var cancel context.CancelFunc = func() {}
+
+	fetch := func() {
+		cancel()
+
+		var fetchCtx context.Context
+		fetchCtx, cancel = context.WithCancel(ctx)
+
+		keyword := search.Text()
+		var instanceID string
+		if network != nil {
+			instanceID = networks[network.Selected()]
+		}
+		busy.Start()
+
+		gtkutil.Async(fetchCtx, func() func() {
+			client := gotktrix.FromContext(fetchCtx).Online(fetchCtx)
+
+			arg := api.PublicRoomsSearchArg{
+				Limit:                exploreLimit,
+				ThirdPartyInstanceID: instanceID,
+			}
+			if keyword != "" {
+				arg.Filter = &api.PublicRoomsSearchFilter{Keyword: &keyword}
+			}
+
+			resp, err := client.PublicRoomsSearch(arg)
+			if err != nil {
+				return func() {
+					busy.Stop()
+					app.Error(ctx, errors.Wrap(err, "failed to fetch public rooms"))
+				}
+			}
+
+			rooms, _ := client.Offline().Rooms()
+			joinedRooms := make(map[matrix.RoomID]bool, len(rooms))
+			for _, id := range rooms {
+				joinedRooms[id] = true
+			}
+
+			return func() {
+				busy.Stop()
+
+				for row := list.RowAtIndex(0); row != nil; row = list.RowAtIndex(0) {
+					list.Remove(row)
+				}
+
+				for _, room := range resp.Chunk {
+					joined := joinedRooms[matrix.RoomID(room.RoomID)]
+					list.Append(newPublicRoom(ctx, room, joined, func(id matrix.RoomID) {
+						win.Close()
+						if open != nil {
+							open(id)
+						}
+					}))
+				}
+			}
+		})
+	}
+
+	search.ConnectSearchChanged(fetch)
+	gtkutil.Async(ctx, func() func() {
+		// Most homeservers don't bridge to anything, so errors are ignored.
+		protocols, _ := gotktrix.FromContext(ctx).ThirdPartyProtocols()
+		if len(protocols) == 0 {
+			return nil
+		}
+
+		return func() {
+			names := []string{locale.S(ctx, "Matrix")}
+
+			for _, protocol := range protocols {
+				for _, instance := range protocol.Instances {
+					name := instance.Desc
+					if name == "" {
+						name = protocol.Name
+					}
+					names = append(names, name)
+					networks = append(networks, instance.InstanceID)
+				}
+			}
+
+			if len(networks) > 1 {
+				network = gtk.NewDropDownFromStrings(names)
+				network.SetTooltipText(locale.S(ctx, "Network"))
+				network.NotifyProperty("selected", fetch)
+				top.InsertChildAfter(network, search)
+			}
+
+			bridged.ConnectClicked(func() {
+				lookupBridged(ctx, protocols, func(id matrix.RoomID) {
+					win.Close()
+					if open != nil {
+						open(id)
+					}
+				})
+			})
+			bridged.Show()
+		}
+	})
+	win.ConnectCloseRequest(func() bool {
+		cancel()
+		return false
+	})
+
+	fetch()
+	win.Show()
+}
+
+func newPublicRoom(ctx context.Context, room api.PublicRoom, isJoined bool, joined OpenFunc) gtk.Widgetter {
+	roomID := matrix.RoomID(room.RoomID)
+
+	name := room.RoomID
+	switch {
+	case room.Name != nil && *room.Name != "":
+		name = *room.Name
+	case room.CanonicalAlias != nil:
+		name = *room.CanonicalAlias
+	}
+
+	nameLabel := gtk.NewLabel(name)
+	nameLabel.SetXAlign(0)
+	nameLabel.SetEllipsize(pango.EllipsizeEnd)
+	nameLabel.SetAttributes(textutil.Attrs(
+		pango.NewAttrWeight(pango.WeightBold),
+	))
+
+	info := gtk.NewBox(gtk.OrientationVertical, 0)
+	info.SetHExpand(true)
+	info.Append(nameLabel)
+
+	if room.Topic != nil && *room.Topic != "" {
+		topic := gtk.NewLabel(*room.Topic)
+		topic.AddCSSClass("roomdialog-explore-topic")
+		topic.SetXAlign(0)
+		topic.SetWrap(true)
+		topic.SetWrapMode(pango.WrapWordChar)
+		topic.SetLines(2)
+		topic.SetEllipsize(pango.EllipsizeEnd)
+		info.Append(topic)
+	}
+
+	members := gtk.NewLabel(locale.Plural(
+		ctx, "%d member", "%d members", room.JoinedMemberCount,
+	))
+	members.AddCSSClass("roomdialog-explore-members")
+	members.SetXAlign(0)
+	info.Append(members)
+
+	join := gtk.NewButtonWithLabel(locale.S(ctx, "Join"))
+	join.SetVAlign(gtk.AlignCenter)
+
+	if isJoined {
+		join.SetLabel(locale.S(ctx, "Open"))
+		join.ConnectClicked(func() { joined(roomID) })
+	} else {
+		join.AddCSSClass("suggested-action")
+		join.ConnectClicked(func() {
+			join.SetSensitive(false)
+
+			gtkutil.Async(ctx, func() func() {
+				if err := gotktrix.FromContext(ctx).RoomJoin(roomID, ""); err != nil {
+					return func() {
+						join.SetSensitive(true)
+						app.Error(ctx, errors.Wrap(err, "failed to join room"))
+					}
+				}
+				return func() { joined(roomID) }
+			})
+		})
+	}
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	box.AddCSSClass("roomdialog-explore-room")
+	box.Append(info)
+	box.Append(join)
+
+	return box
+}
@@ -0,0 +1,223 @@
+package roomdialog
+
+import (
+	"context"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// ExploreSpace shows a dialog that lists the rooms in the space and its
+// subspaces, including the ones that the user hasn't joined yet.
+func ExploreSpace(ctx context.Context, spaceID matrix.RoomID, open OpenFunc) {
+	list := gtk.NewListBox()
+	list.SetSelectionMode(gtk.SelectionNone)
+	list.SetShowSeparators(true)
+	list.SetPlaceholder(gtk.NewLabel(locale.S(ctx, "This space has no rooms.")))
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(list)
+
+	busy := gtk.NewSpinner()
+	busy.SetSizeRequest(24, 24)
+	busy.SetHAlign(gtk.AlignCenter)
+	busy.SetVAlign(gtk.AlignCenter)
+	busy.SetVExpand(true)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 4)
+	box.Append(busy)
+	exploreCSS(box)
+
+	name, _ := gotktrix.FromContext(ctx).Offline().RoomName(spaceID)
+
+	win := gtk.NewWindow()
+	win.SetTransientFor(app.GTKWindowFromContext(ctx))
+	win.SetModal(true)
+	win.SetDefaultSize(450, 550)
+	win.SetTitle(app.FromContext(ctx).SuffixedTitle(locale.Sprintf(ctx, "Explore %s", name)))
+	win.SetChild(box)
+
+	ctx, cancel := context.WithCancel(ctx)
+	win.ConnectCloseRequest(func() bool {
+		cancel()
+		return false
+	})
+
+	busy.Start()
+
+	gtkutil.Async(ctx, func() func() {
+		client := gotktrix.FromContext(ctx).Online(ctx)
+
+		rooms, err := client.SpaceHierarchy(spaceID)
+		if err != nil {
+			return func() {
+				win.Close()
+				app.Error(ctx, err)
+			}
+		}
+
+		// Rooms that grant access to restricted rooms are usually in the
+		// hierarchy too, so their names are known even if they aren't joined.
+		names := make(map[matrix.RoomID]string, len(rooms)+1)
+		names[spaceID] = name
+		for _, room := range rooms {
+			names[room.RoomID] = hierarchyRoomName(room)
+		}
+
+		type roomState struct {
+			joined  bool
+			canJoin bool
+			allowed []string
+		}
+
+		states := make([]roomState, len(rooms))
+		for i, room := range rooms {
+			state := roomState{
+				joined:  client.IsJoined(room.RoomID),
+				canJoin: room.JoinRule == event.JoinPublic,
+			}
+
+			if room.JoinRule == gotktrix.JoinRestricted {
+				state.canJoin = client.CanJoinRestricted(room)
+
+				for _, allowed := range room.Allowed {
+					name, ok := names[allowed]
+					if !ok {
+						name, _ = client.Offline().RoomName(allowed)
+					}
+					state.allowed = append(state.allowed, name)
+				}
+			}
+
+			states[i] = state
+		}
+
+		return func() {
+			busy.Stop()
+			box.Remove(busy)
+			box.Append(scroll)
+
+			for i, room := range rooms {
+				state := states[i]
+				list.Append(newHierarchyRoom(ctx, room, state.joined, state.canJoin, state.allowed,
+					func(id matrix.RoomID) {
+						win.Close()
+						if open != nil {
+							open(id)
+						}
+					},
+				))
+			}
+		}
+	})
+
+	win.Show()
+}
+
+func hierarchyRoomName(room gotktrix.HierarchyRoom) string {
+	switch {
+	case room.Name != "":
+		return room.Name
+	case room.CanonicalAlias != "":
+		return room.CanonicalAlias
+	default:
+		return string(room.RoomID)
+	}
+}
+
+func newHierarchyRoom(
+	ctx context.Context, room gotktrix.HierarchyRoom,
+	isJoined, canJoin bool, allowed []string, joined OpenFunc) gtk.Widgetter {
+
+	nameLabel := gtk.NewLabel(hierarchyRoomName(room))
+	nameLabel.SetXAlign(0)
+	nameLabel.SetEllipsize(pango.EllipsizeEnd)
+	nameLabel.SetTooltipText(string(room.RoomID))
+	nameLabel.SetAttributes(textutil.Attrs(
+		pango.NewAttrWeight(pango.WeightBold),
+	))
+
+	info := gtk.NewBox(gtk.OrientationVertical, 0)
+	info.SetHExpand(true)
+	info.Append(nameLabel)
+
+	if room.Topic != "" {
+		topic := gtk.NewLabel(room.Topic)
+		topic.AddCSSClass("roomdialog-explore-topic")
+		topic.SetXAlign(0)
+		topic.SetWrap(true)
+		topic.SetWrapMode(pango.WrapWordChar)
+		topic.SetLines(2)
+		topic.SetEllipsize(pango.EllipsizeEnd)
+		info.Append(topic)
+	}
+
+	details := locale.Plural(ctx, "%d member", "%d members", room.Members)
+	if room.IsSpace() {
+		details = locale.Sprintf(ctx, "Space, %s", details)
+	}
+
+	members := gtk.NewLabel(details)
+	members.AddCSSClass("roomdialog-explore-members")
+	members.SetXAlign(0)
+	info.Append(members)
+
+	if len(allowed) > 0 {
+		access := gtk.NewLabel(locale.Sprintf(
+			ctx, "Members of %s can join", strings.Join(allowed, ", "),
+		))
+		access.AddCSSClass("roomdialog-explore-members")
+		access.SetXAlign(0)
+		access.SetWrap(true)
+		access.SetWrapMode(pango.WrapWordChar)
+		info.Append(access)
+	}
+
+	join := gtk.NewButtonWithLabel(locale.S(ctx, "Join"))
+	join.SetVAlign(gtk.AlignCenter)
+
+	switch {
+	case isJoined:
+		join.SetLabel(locale.S(ctx, "Open"))
+		join.ConnectClicked(func() { joined(room.RoomID) })
+	case !canJoin:
+		join.SetSensitive(false)
+		if room.JoinRule == gotktrix.JoinRestricted {
+			join.SetTooltipText(locale.S(ctx, "You're not in any of the rooms that can join this room."))
+		} else {
+			join.SetTooltipText(locale.S(ctx, "You need to be invited to join this room."))
+		}
+	default:
+		join.AddCSSClass("suggested-action")
+		join.ConnectClicked(func() {
+			join.SetSensitive(false)
+
+			gtkutil.Async(ctx, func() func() {
+				if err := gotktrix.FromContext(ctx).JoinHierarchyRoom(room); err != nil {
+					return func() {
+						join.SetSensitive(true)
+						app.Error(ctx, err)
+					}
+				}
+				return func() { joined(room.RoomID) }
+			})
+		})
+	}
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	box.AddCSSClass("roomdialog-explore-room")
+	box.Append(info)
+	box.Append(join)
+
+	return box
+}
@@ -0,0 +1,104 @@
+package roomdialog
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+var moderateCSS = cssutil.Applier("roomdialog-moderate", `
+	.roomdialog-moderate {
+		padding: 15px;
+	}
+	.roomdialog-moderate > entry {
+		margin-top: 8px;
+	}
+`)
+
+// Moderate asks for a reason to kick or ban the given user for, and then does
+// it. Only KickAction and BanAction are supported.
+func Moderate(ctx context.Context, roomID matrix.RoomID, userID matrix.UserID, action gotktrix.PowerAction) {
+	name := string(userID)
+	if member, err := gotktrix.FromContext(ctx).Offline().MemberName(roomID, userID, false); err == nil {
+		name = member.Name
+	}
+
+	title := locale.S(ctx, "Kick Member")
+	ok := locale.S(ctx, "Kick")
+	text := locale.Sprintf(ctx, "%s will be removed from the room, but they can join again.", name)
+	if action == gotktrix.BanAction {
+		title = locale.S(ctx, "Ban Member")
+		ok = locale.S(ctx, "Ban")
+		text = locale.Sprintf(ctx, "%s will be removed from the room and won't be able to join again.", name)
+	}
+
+	label := gtk.NewLabel(text)
+	label.SetWrap(true)
+	label.SetXAlign(0)
+
+	reason := gtk.NewEntry()
+	reason.SetPlaceholderText(locale.S(ctx, "Reason (optional)"))
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(label)
+	box.Append(reason)
+	moderateCSS(box)
+
+	d := dialogs.New(ctx, locale.S(ctx, "Cancel"), ok)
+	d.SetTitle(title)
+	d.SetDefaultSize(350, -1)
+	d.SetChild(box)
+	d.BindEnterOK()
+	d.BindCancelClose()
+	d.OK.AddCSSClass("destructive-action")
+
+	d.OK.ConnectClicked(func() {
+		why := reason.Text()
+		client := gotktrix.FromContext(ctx)
+
+		d.Close()
+		d.Destroy()
+
+		gtkutil.Async(ctx, func() func() {
+			var err error
+			if action == gotktrix.BanAction {
+				err = errors.Wrap(client.Ban(roomID, userID, why), "cannot ban member")
+			} else {
+				err = errors.Wrap(client.Kick(roomID, userID, why), "cannot kick member")
+			}
+
+			if err != nil {
+				return func() { app.Error(ctx, err) }
+			}
+			return nil
+		})
+	})
+
+	d.Show()
+}
+
+// SetMuted mutes or unmutes the given user in the background. Muted users can
+// still read the room, but their power level is too low to send messages.
+func SetMuted(ctx context.Context, roomID matrix.RoomID, userID matrix.UserID, muted bool) {
+	client := gotktrix.FromContext(ctx)
+
+	gtkutil.Async(ctx, func() func() {
+		if err := client.SetMuted(roomID, userID, muted); err != nil {
+			if muted {
+				err = errors.Wrap(err, "cannot mute member")
+			} else {
+				err = errors.Wrap(err, "cannot unmute member")
+			}
+			return func() { app.Error(ctx, err) }
+		}
+		return nil
+	})
+}
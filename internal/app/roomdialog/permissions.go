@@ -0,0 +1,263 @@
+package roomdialog
+
+import (
+	"context"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var permissionsCSS = cssutil.Applier("roomdialog-permissions", `
+	.roomdialog-permissions {
+		padding: 15px;
+	}
+	.roomdialog-permissions > entry {
+		margin-bottom: 8px;
+	}
+	.roomdialog-permission {
+		padding: 6px 0;
+	}
+	.roomdialog-permission > image {
+		margin: 0 10px 0 4px;
+	}
+	.roomdialog-permission-allowed > image {
+		color: @success_color;
+	}
+	.roomdialog-permission-denied > image {
+		color: @error_color;
+	}
+	.roomdialog-permission-reason {
+		color: alpha(@theme_fg_color, 0.75);
+		font-size: 0.9em;
+	}
+`)
+
+type permissionCheck struct {
+	name    string
+	explain func(c *gotktrix.Client, roomID matrix.RoomID, target matrix.UserID) gotktrix.PermissionExplanation
+	// target is true if the check is about the target user.
+	target bool
+}
+
+func sendCheck(name string, typ event.Type, state bool) permissionCheck {
+	return permissionCheck{
+		name: name,
+		explain: func(c *gotktrix.Client, roomID matrix.RoomID, _ matrix.UserID) gotktrix.PermissionExplanation {
+			return c.ExplainSendEvent(roomID, typ, state)
+		},
+	}
+}
+
+func actionCheck(name string, action gotktrix.PowerAction, target bool) permissionCheck {
+	return permissionCheck{
+		name:   name,
+		target: target,
+		explain: func(c *gotktrix.Client, roomID matrix.RoomID, t matrix.UserID) gotktrix.PermissionExplanation {
+			if !target {
+				t = ""
+			}
+			return c.ExplainAction(roomID, action, t)
+		},
+	}
+}
+
+func permissionChecks(ctx context.Context) []permissionCheck {
+	return []permissionCheck{
+		sendCheck(locale.S(ctx, "Send messages"), event.TypeRoomMessage, false),
+		sendCheck(locale.S(ctx, "React to messages"), m.ReactionEventType, false),
+		sendCheck(locale.S(ctx, "Change the room name"), event.TypeRoomName, true),
+		sendCheck(locale.S(ctx, "Change the topic"), event.TypeRoomTopic, true),
+		sendCheck(locale.S(ctx, "Change permissions"), event.TypeRoomPowerLevels, true),
+		actionCheck(locale.S(ctx, "Delete other people's messages"), gotktrix.RedactAction, false),
+		actionCheck(locale.S(ctx, "Invite the user"), gotktrix.InviteAction, true),
+		actionCheck(locale.S(ctx, "Kick the user"), gotktrix.KickAction, true),
+		actionCheck(locale.S(ctx, "Ban the user"), gotktrix.BanAction, true),
+	}
+}
+
+// ExplainPermissions shows a dialog that lists what the user can and can't do
+// in the room, and why, by going through the room's power levels, join rules
+// and the user's membership the same way the homeserver does. Moderation
+// actions are checked against a user that can be entered into the dialog.
+func ExplainPermissions(ctx context.Context, roomID matrix.RoomID) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	target := gtk.NewEntry()
+	target.SetPlaceholderText(locale.S(ctx, "User to moderate, e.g. @alice:example.com"))
+	target.SetInputPurpose(gtk.InputPurposeFreeForm)
+
+	list := gtk.NewBox(gtk.OrientationVertical, 0)
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(list)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(target)
+	box.Append(scroll)
+	permissionsCSS(box)
+
+	checks := permissionChecks(ctx)
+
+	update := func() {
+		userID := matrix.UserID(strings.TrimSpace(target.Text()))
+		if _, _, err := userID.Parse(); err != nil {
+			userID = ""
+		}
+
+		gtkutil.Async(ctx, func() func() {
+			client := gotktrix.FromContext(ctx)
+
+			explanations := make([]gotktrix.PermissionExplanation, len(checks))
+			for i, check := range checks {
+				explanations[i] = check.explain(client, roomID, userID)
+			}
+
+			return func() {
+				for child := list.FirstChild(); child != nil; child = list.FirstChild() {
+					list.Remove(child)
+				}
+
+				for i, check := range checks {
+					if check.target && userID == "" {
+						continue
+					}
+					list.Append(newPermissionRow(ctx, check.name, explanations[i]))
+				}
+			}
+		})
+	}
+
+	target.ConnectActivate(update)
+	target.ConnectChanged(func() {
+		// Only recheck once the user ID is complete.
+		if _, _, err := matrix.UserID(strings.TrimSpace(target.Text())).Parse(); err == nil {
+			update()
+		}
+	})
+
+	d := dialogs.NewLocalize(ctx, "Close", "Refresh")
+	d.SetTitle(locale.S(ctx, "Permissions"))
+	d.SetDefaultSize(400, 450)
+	d.SetChild(box)
+	d.BindCancelClose()
+	d.ConnectDestroy(cancel)
+	d.OK.ConnectClicked(update)
+
+	update()
+	d.Show()
+}
+
+func newPermissionRow(ctx context.Context, name string, x gotktrix.PermissionExplanation) gtk.Widgetter {
+	icon := gtk.NewImageFromIconName("object-select-symbolic")
+	if !x.Allowed {
+		icon.SetFromIconName("action-unavailable-symbolic")
+	}
+	icon.SetVAlign(gtk.AlignStart)
+
+	title := gtk.NewLabel(name)
+	title.SetXAlign(0)
+
+	reason := gtk.NewLabel(explainPermission(ctx, x))
+	reason.AddCSSClass("roomdialog-permission-reason")
+	reason.SetXAlign(0)
+	reason.SetWrap(true)
+
+	labels := gtk.NewBox(gtk.OrientationVertical, 0)
+	labels.SetHExpand(true)
+	labels.Append(title)
+	labels.Append(reason)
+
+	row := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	row.AddCSSClass("roomdialog-permission")
+	if x.Allowed {
+		row.AddCSSClass("roomdialog-permission-allowed")
+	} else {
+		row.AddCSSClass("roomdialog-permission-denied")
+	}
+	row.Append(icon)
+	row.Append(labels)
+
+	return row
+}
+
+// explainPermission explains the given explanation in words. Only the first
+// thing that stops the user is explained.
+func explainPermission(ctx context.Context, x gotktrix.PermissionExplanation) string {
+	switch x.Membership {
+	case event.MemberJoined:
+		// ok
+	case event.MemberInvited:
+		return locale.S(ctx, "You've been invited, but you need to join the room first.")
+	case event.MemberBanned:
+		return locale.S(ctx, "You're banned from this room.")
+	default:
+		switch x.JoinRule {
+		case event.JoinPublic:
+			return locale.S(ctx, "You're not in this room. Anyone can join it.")
+		case event.JoinKnock:
+			return locale.S(ctx, "You're not in this room. You can ask to join it.")
+		default:
+			return locale.S(ctx, "You're not in this room, and you need an invite to join it.")
+		}
+	}
+
+	var level string
+	switch {
+	case x.RequiredSource == gotktrix.PowerNoLevels && x.IsCreator:
+		level = locale.S(ctx, "The room has no power levels, so you have power level 100 as its creator.")
+	case x.RequiredSource == gotktrix.PowerNoLevels:
+		level = locale.S(ctx, "The room has no power levels, so you have the default power level 0.")
+	case x.UserLevelExplicit:
+		level = locale.Sprintf(ctx, "You have power level %d.", x.UserLevel)
+	default:
+		level = locale.Sprintf(ctx, "You have power level %d, the default for this room.", x.UserLevel)
+	}
+
+	if x.UserLevel < x.Required {
+		var need string
+		switch x.RequiredSource {
+		case gotktrix.PowerEventOverride:
+			need = locale.Sprintf(ctx, "This needs power level %d.", x.Required)
+		case gotktrix.PowerEventsDefault:
+			need = locale.Sprintf(ctx, "Sending needs power level %d by default.", x.Required)
+		case gotktrix.PowerStateDefault:
+			need = locale.Sprintf(ctx, "Changing room settings needs power level %d by default.", x.Required)
+		default:
+			need = locale.Sprintf(ctx, "This action needs power level %d.", x.Required)
+		}
+		return need + " " + level
+	}
+
+	if !x.Allowed && x.Target != "" {
+		switch x.Action {
+		case gotktrix.InviteAction:
+			switch x.TargetMembership {
+			case event.MemberJoined:
+				return locale.Sprintf(ctx, "%s is already in the room.", x.Target)
+			case event.MemberBanned:
+				return locale.Sprintf(ctx, "%s is banned, so they need to be unbanned first.", x.Target)
+			}
+		case gotktrix.KickAction, gotktrix.BanAction:
+			if x.Target == gotktrix.FromContext(ctx).UserID {
+				return locale.S(ctx, "You can't do this to yourself. You can leave the room instead.")
+			}
+			if x.TargetOutranks() {
+				return locale.Sprintf(ctx,
+					"%s has power level %d, and you can only do this to users below your level %d.",
+					x.Target, x.TargetLevel, x.UserLevel)
+			}
+		}
+	}
+
+	return level
+}
@@ -0,0 +1,222 @@
+package roomdialog
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// minPowerLevel is the lowest power level that the editor offers. Negative
+// levels are mostly used to mute users.
+const minPowerLevel = -100
+
+var powerLevelsCSS = cssutil.Applier("roomdialog-powerlevels", `
+	.roomdialog-powerlevel {
+		margin-top: 4px;
+	}
+	.roomdialog-powerlevel-users {
+		margin-top: 2px;
+	}
+	.roomdialog-powerlevel-add {
+		margin-top: 6px;
+	}
+`)
+
+// PowerLevels shows a dialog that edits the power levels of the room: the levels
+// needed for each action and the levels of each user. Levels above the user's
+// own can't be edited.
+func PowerLevels(ctx context.Context, roomID matrix.RoomID) {
+	client := gotktrix.FromContext(ctx).Offline()
+	current := client.RoomPowerLevels(roomID)
+
+	x := client.ExplainSendEvent(roomID, event.TypeRoomPowerLevels, true)
+	canEdit := x.Allowed
+	ownLevel := x.UserLevel
+
+	f := newForm(ctx, "Power Levels", "Save")
+	f.SetDefaultSize(400, 550)
+	f.OK.SetSensitive(canEdit)
+	powerLevelsCSS(f.box)
+
+	newLevel := func(level int) *gtk.SpinButton {
+		max := ownLevel
+		if level > max {
+			max = level
+		}
+
+		spin := gtk.NewSpinButtonWithRange(minPowerLevel, float64(max), 1)
+		spin.SetValue(float64(level))
+		spin.SetSensitive(canEdit && level <= ownLevel)
+		spin.SetVAlign(gtk.AlignCenter)
+		return spin
+	}
+
+	addLevel := func(label string, level int) *gtk.SpinButton {
+		l := gtk.NewLabel(label)
+		l.SetXAlign(0)
+		l.SetHExpand(true)
+		l.SetWrap(true)
+
+		spin := newLevel(level)
+
+		box := gtk.NewBox(gtk.OrientationHorizontal, 6)
+		box.AddCSSClass("roomdialog-powerlevel")
+		box.Append(l)
+		box.Append(spin)
+		f.box.Append(box)
+
+		return spin
+	}
+
+	addHeader := func(label string) {
+		l := gtk.NewLabel(label)
+		l.SetXAlign(0)
+		l.SetAttributes(textutil.Attrs(
+			pango.NewAttrWeight(pango.WeightBold),
+		))
+		f.box.Append(l)
+	}
+
+	addHeader(locale.S(ctx, "Needed To"))
+	eventsDefault := addLevel(locale.S(ctx, "Send messages"), current.EventsDefault)
+	stateDefault := addLevel(locale.S(ctx, "Change settings"), current.StateDefault)
+	invite := addLevel(locale.S(ctx, "Invite users"), current.Invite)
+	kick := addLevel(locale.S(ctx, "Kick users"), current.Kick)
+	ban := addLevel(locale.S(ctx, "Ban users"), current.Ban)
+	redact := addLevel(locale.S(ctx, "Delete messages of others"), current.Redact)
+
+	addHeader(locale.S(ctx, "Users"))
+	usersDefault := addLevel(locale.S(ctx, "Everyone else"), current.UsersDefault)
+
+	users := gtk.NewBox(gtk.OrientationVertical, 0)
+
+	usersScroll := gtk.NewScrolledWindow()
+	usersScroll.AddCSSClass("roomdialog-powerlevel-users")
+	usersScroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	usersScroll.SetPropagateNaturalHeight(true)
+	usersScroll.SetMaxContentHeight(250)
+	usersScroll.SetChild(users)
+	f.box.Append(usersScroll)
+
+	// userLevels maps the users with their own levels to their spin buttons.
+	userLevels := make(map[matrix.UserID]*gtk.SpinButton, len(current.Users))
+
+	addUser := func(userID matrix.UserID, level int) {
+		if spin, ok := userLevels[userID]; ok {
+			spin.GrabFocus()
+			return
+		}
+
+		name := gtk.NewLabel(string(userID))
+		name.SetXAlign(0)
+		name.SetHExpand(true)
+		name.SetEllipsize(pango.EllipsizeEnd)
+		name.SetTooltipText(string(userID))
+		if member, err := client.MemberName(roomID, userID, false); err == nil {
+			name.SetText(member.Name)
+		}
+
+		editable := canEdit && (userID == client.UserID || level < ownLevel)
+
+		spin := newLevel(level)
+		spin.SetSensitive(editable)
+		userLevels[userID] = spin
+
+		box := gtk.NewBox(gtk.OrientationHorizontal, 6)
+		box.AddCSSClass("roomdialog-powerlevel")
+
+		remove := gtk.NewButtonFromIconName("list-remove-symbolic")
+		remove.SetTooltipText(locale.S(ctx, "Use the level of everyone else"))
+		remove.SetHasFrame(false)
+		remove.SetVAlign(gtk.AlignCenter)
+		remove.SetSensitive(editable)
+		remove.ConnectClicked(func() {
+			delete(userLevels, userID)
+			users.Remove(box)
+		})
+
+		box.Append(name)
+		box.Append(spin)
+		box.Append(remove)
+		users.Append(box)
+	}
+
+	userIDs := make([]matrix.UserID, 0, len(current.Users))
+	for userID := range current.Users {
+		userIDs = append(userIDs, userID)
+	}
+	// Show the most powerful users first.
+	sort.Slice(userIDs, func(i, j int) bool {
+		li, lj := current.Users[userIDs[i]], current.Users[userIDs[j]]
+		if li != lj {
+			return li > lj
+		}
+		return userIDs[i] < userIDs[j]
+	})
+	for _, userID := range userIDs {
+		addUser(userID, current.Users[userID])
+	}
+
+	newUser := gtk.NewEntry()
+	newUser.SetHExpand(true)
+	newUser.SetPlaceholderText("@user:example.com")
+
+	add := gtk.NewButtonWithLabel(locale.S(ctx, "Add"))
+	add.SetSensitive(false)
+
+	newUser.ConnectChanged(func() {
+		_, _, err := matrix.UserID(strings.TrimSpace(newUser.Text())).Parse()
+		add.SetSensitive(err == nil)
+	})
+
+	add.ConnectClicked(func() {
+		userID := matrix.UserID(strings.TrimSpace(newUser.Text()))
+		addUser(userID, current.UserLevel(userID))
+		newUser.SetText("")
+	})
+	newUser.ConnectActivate(func() {
+		if add.Sensitive() {
+			add.Activate()
+		}
+	})
+
+	addBox := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	addBox.AddCSSClass("roomdialog-powerlevel-add")
+	addBox.SetSensitive(canEdit)
+	addBox.Append(newUser)
+	addBox.Append(add)
+	f.box.Append(addBox)
+
+	f.OK.ConnectClicked(func() {
+		updated := gotktrix.PowerLevels{
+			UsersDefault:  usersDefault.ValueAsInt(),
+			EventsDefault: eventsDefault.ValueAsInt(),
+			StateDefault:  stateDefault.ValueAsInt(),
+			Invite:        invite.ValueAsInt(),
+			Kick:          kick.ValueAsInt(),
+			Ban:           ban.ValueAsInt(),
+			Redact:        redact.ValueAsInt(),
+			Users:         make(map[matrix.UserID]int, len(userLevels)),
+		}
+		for userID, spin := range userLevels {
+			updated.Users[userID] = spin.ValueAsInt()
+		}
+
+		client := gotktrix.FromContext(ctx)
+
+		f.do(ctx, func() error {
+			return client.UpdatePowerLevels(roomID, current, updated)
+		}, nil)
+	})
+
+	f.Show()
+}
@@ -0,0 +1,151 @@
+// Package roomdialog provides dialogs to start new chats, create new rooms and
+// explore public rooms.
+package roomdialog
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// OpenFunc is called once the dialog has created or joined a room.
+type OpenFunc func(matrix.RoomID)
+
+var formCSS = cssutil.Applier("roomdialog-form", `
+	.roomdialog-form {
+		padding: 15px;
+	}
+	.roomdialog-form > label {
+		margin-top: 6px;
+	}
+	.roomdialog-form > entry,
+	.roomdialog-form > dropdown {
+		margin-top: 2px;
+	}
+	.roomdialog-form > button {
+		margin-top: 6px;
+	}
+	.roomdialog-error {
+		padding-top: 4px;
+	}
+`)
+
+// form is a dialog that contains a list of labeled inputs.
+type form struct {
+	*dialogs.Dialog
+	box   *gtk.Box
+	error *gtk.Label
+	busy  *gtk.Spinner
+}
+
+func newForm(ctx context.Context, title, ok string) *form {
+	errLabel := textutil.ErrorLabel("")
+	errLabel.AddCSSClass("roomdialog-error")
+	errLabel.Hide()
+
+	busy := gtk.NewSpinner()
+	busy.Hide()
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.SetVAlign(gtk.AlignStart)
+	formCSS(box)
+
+	outer := gtk.NewBox(gtk.OrientationVertical, 0)
+	outer.Append(box)
+	outer.Append(errLabel)
+	outer.Append(busy)
+
+	d := dialogs.New(ctx, locale.S(ctx, "Cancel"), locale.S(ctx, ok))
+	d.SetDefaultSize(375, 250)
+	d.SetTitle(locale.S(ctx, title))
+	d.SetChild(outer)
+	d.BindEnterOK()
+	d.BindCancelClose()
+
+	return &form{
+		Dialog: d,
+		box:    box,
+		error:  errLabel,
+		busy:   busy,
+	}
+}
+
+// addEntry adds a new labeled entry into the form.
+func (f *form) addEntry(label, placeholder string) *gtk.Entry {
+	l := gtk.NewLabel(label)
+	l.SetXAlign(0)
+	l.SetAttributes(textutil.Attrs(
+		pango.NewAttrWeight(pango.WeightBold),
+	))
+
+	entry := gtk.NewEntry()
+	entry.SetPlaceholderText(placeholder)
+
+	f.box.Append(l)
+	f.box.Append(entry)
+
+	return entry
+}
+
+// addDropDown adds a new labeled drop-down into the form.
+func (f *form) addDropDown(label string, items []string) *gtk.DropDown {
+	l := gtk.NewLabel(label)
+	l.SetXAlign(0)
+	l.SetAttributes(textutil.Attrs(
+		pango.NewAttrWeight(pango.WeightBold),
+	))
+
+	dropDown := gtk.NewDropDownFromStrings(items)
+
+	f.box.Append(l)
+	f.box.Append(dropDown)
+
+	return dropDown
+}
+
+// setBusy sets whether or not the form is working on something.
+func (f *form) setBusy(busy bool) {
+	f.box.SetSensitive(!busy)
+	f.OK.SetSensitive(!busy)
+	f.busy.SetVisible(busy)
+	if busy {
+		f.busy.Start()
+		f.error.Hide()
+	} else {
+		f.busy.Stop()
+	}
+}
+
+// do runs fn asynchronously while the form is busy. If fn returns an error,
+// then it is shown in the form, otherwise the form is closed and done is
+// called.
+func (f *form) do(ctx context.Context, fn func() error, done func()) {
+	f.setBusy(true)
+
+	gtkutil.Async(ctx, func() func() {
+		err := fn()
+		return func() {
+			f.setBusy(false)
+
+			if err != nil {
+				f.error.SetMarkup(textutil.ErrorMarkup(err.Error()))
+				f.error.Show()
+				return
+			}
+
+			f.Close()
+			f.Destroy()
+
+			if done != nil {
+				done()
+			}
+		}
+	})
+}
@@ -0,0 +1,224 @@
+package roomdialog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/onlineimage"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotktrix/internal/components/filepick"
+	"github.com/diamondburned/gotktrix/internal/components/uploadutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+const settingsAvatarSize = 64
+
+var joinRules = []event.JoinRule{
+	event.JoinInvite,
+	event.JoinKnock,
+	event.JoinPublic,
+}
+
+func joinRuleLabels(ctx context.Context) []string {
+	return []string{
+		locale.S(ctx, "Only invited people"),
+		locale.S(ctx, "Anyone who asks and is let in"),
+		locale.S(ctx, "Anyone"),
+	}
+}
+
+var historyVisibilities = []event.HistoryVisibility{
+	event.VisibilityShared,
+	event.VisibilityInvited,
+	event.VisibilityJoined,
+	event.VisibilityWorldReadable,
+}
+
+func historyVisibilityLabels(ctx context.Context) []string {
+	return []string{
+		locale.S(ctx, "Members, including messages from before they joined"),
+		locale.S(ctx, "Members, since they were invited"),
+		locale.S(ctx, "Members, since they joined"),
+		locale.S(ctx, "Anyone"),
+	}
+}
+
+// RoomSettings shows a dialog that changes the room's name, topic, avatar,
+// address, join rules and history visibility. Settings that the user isn't
+// allowed to change are shown but can't be edited. The power levels are edited
+// in their own dialog. The bots and bridges in the room are also listed; open is
+// called when one of their direct chats is opened.
+func RoomSettings(ctx context.Context, roomID matrix.RoomID, open OpenFunc) {
+	client := gotktrix.FromContext(ctx).Offline()
+	current := client.RoomSettings(roomID)
+
+	can := func(typ event.Type) bool {
+		return client.CanSendEvent(roomID, typ, true)
+	}
+
+	f := newForm(ctx, "Room Settings", "Save")
+	f.SetDefaultSize(400, 500)
+
+	// avatarPath is the path of the new avatar to upload, if any.
+	var avatarPath string
+	avatarURL := current.Avatar
+
+	avatar := onlineimage.NewAvatar(ctx, gotktrix.AvatarProvider, settingsAvatarSize)
+	avatar.SetInitials(current.Name)
+	if avatarURL != "" {
+		avatar.SetFromURL(string(avatarURL))
+	}
+
+	changeAvatar := gtk.NewButtonWithMnemonic(locale.S(ctx, "_Change…"))
+	removeAvatar := gtk.NewButtonWithMnemonic(locale.S(ctx, "_Remove"))
+	removeAvatar.SetSensitive(avatarURL != "")
+
+	changeAvatar.ConnectClicked(func() {
+		filter := gtk.NewFileFilter()
+		filter.AddMIMEType("image/*")
+
+		chooser := filepick.NewLocalize(
+			ctx, "Room Avatar", gtk.FileChooserActionOpen, "Choose", "Cancel")
+		chooser.AddFilter(filter)
+		chooser.ConnectAccept(func() {
+			path := chooser.File().Path()
+			if path == "" {
+				return
+			}
+			avatarPath = path
+			avatar.SetFromFile(path)
+			removeAvatar.SetSensitive(true)
+		})
+		chooser.Show()
+	})
+
+	removeAvatar.ConnectClicked(func() {
+		avatarPath = ""
+		avatarURL = ""
+		avatar.SetFromPaintable(nil)
+		removeAvatar.SetSensitive(false)
+	})
+
+	avatarButtons := gtk.NewBox(gtk.OrientationVertical, 4)
+	avatarButtons.SetVAlign(gtk.AlignCenter)
+	avatarButtons.Append(changeAvatar)
+	avatarButtons.Append(removeAvatar)
+
+	avatarBox := gtk.NewBox(gtk.OrientationHorizontal, 12)
+	avatarBox.SetSensitive(can(event.TypeRoomAvatar))
+	avatarBox.Append(avatar)
+	avatarBox.Append(avatarButtons)
+	f.box.Append(avatarBox)
+
+	name := f.addEntry(locale.S(ctx, "Name"), "")
+	name.SetText(current.Name)
+	name.SetSensitive(can(event.TypeRoomName))
+
+	topic := f.addEntry(locale.S(ctx, "Topic"), "")
+	topic.SetText(current.Topic)
+	topic.SetSensitive(can(event.TypeRoomTopic))
+
+	alias := f.addEntry(locale.S(ctx, "Address"), "#room:example.com")
+	alias.SetText(current.Alias)
+	alias.SetSensitive(can(event.TypeRoomCanonicalAlias))
+
+	rules, ruleLabels := joinRules, joinRuleLabels(ctx)
+	if !containsJoinRule(rules, current.JoinRule) {
+		// Keep join rules that the dialog doesn't know, such as restricted.
+		rules = append(rules[:len(rules):len(rules)], current.JoinRule)
+		ruleLabels = append(ruleLabels, locale.Sprintf(ctx, "Other (%s)", current.JoinRule))
+	}
+
+	joinRule := f.addDropDown(locale.S(ctx, "Who Can Join"), ruleLabels)
+	joinRule.SetSensitive(can(event.TypeRoomJoinRules))
+	for i, rule := range rules {
+		if rule == current.JoinRule {
+			joinRule.SetSelected(uint(i))
+		}
+	}
+
+	history := f.addDropDown(locale.S(ctx, "Who Can Read the History"), historyVisibilityLabels(ctx))
+	history.SetSensitive(can(event.TypeRoomHistoryVisibility))
+	for i, visibility := range historyVisibilities {
+		if visibility == current.HistoryVisibility {
+			history.SetSelected(uint(i))
+		}
+	}
+
+	powerLevels := gtk.NewButtonWithMnemonic(locale.S(ctx, "_Power Levels…"))
+	powerLevels.SetHAlign(gtk.AlignStart)
+	powerLevels.ConnectClicked(func() { PowerLevels(ctx, roomID) })
+	f.box.Append(powerLevels)
+
+	f.addBots(ctx, roomID, open)
+
+	f.OK.ConnectClicked(func() {
+		updated := current
+		updated.Name = strings.TrimSpace(name.Text())
+		updated.Topic = strings.TrimSpace(topic.Text())
+		updated.Alias = strings.TrimSpace(alias.Text())
+		updated.Avatar = avatarURL
+
+		if i := joinRule.Selected(); i < uint(len(rules)) {
+			updated.JoinRule = rules[i]
+		}
+		if i := history.Selected(); i < uint(len(historyVisibilities)) {
+			updated.HistoryVisibility = historyVisibilities[i]
+		}
+
+		if updated.Alias != "" && !strings.HasPrefix(updated.Alias, "#") {
+			f.error.SetMarkup(textutil.ErrorMarkup(
+				locale.S(ctx, "The address must start with a #.")))
+			f.error.Show()
+			return
+		}
+
+		path := avatarPath
+		client := gotktrix.FromContext(ctx)
+
+		f.do(ctx, func() error {
+			if path != "" {
+				u, err := uploadAvatar(client, path)
+				if err != nil {
+					return err
+				}
+				updated.Avatar = u
+			}
+
+			return client.UpdateRoomSettings(roomID, current, updated)
+		}, nil)
+	})
+
+	f.Show()
+}
+
+func uploadAvatar(client *gotktrix.Client, path string) (matrix.URL, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to open avatar")
+	}
+	defer f.Close()
+
+	u, err := uploadutil.Upload(client, f, filepath.Base(path))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to upload avatar")
+	}
+
+	return u, nil
+}
+
+func containsJoinRule(rules []event.JoinRule, rule event.JoinRule) bool {
+	for _, r := range rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
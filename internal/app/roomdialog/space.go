@@ -0,0 +1,348 @@
+package roomdialog
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+var spaceCSS = cssutil.Applier("roomdialog-space", `
+	.roomdialog-space list {
+		background: inherit;
+	}
+	.roomdialog-space-child {
+		padding: 4px 8px;
+	}
+	.roomdialog-space-child checkbutton {
+		margin: 0 6px;
+	}
+	.roomdialog-space-bottom {
+		padding: 6px;
+	}
+	.roomdialog-space-addroom {
+		padding: 2px 4px;
+	}
+`)
+
+// spaceManager is the window that manages the rooms in a space.
+type spaceManager struct {
+	*gtk.Window
+	list   *gtk.ListBox
+	busy   *gtk.Spinner
+	add    *gtk.ListBox
+	addBtn *gtk.MenuButton
+
+	ctx     context.Context
+	spaceID matrix.RoomID
+	changed func()
+
+	children []m.SpaceChildEvent
+}
+
+// ManageSpace shows a window that adds, removes and reorders the rooms in the
+// given space. The changed callback is called once the window is closed if the
+// space was changed.
+func ManageSpace(ctx context.Context, spaceID matrix.RoomID, changed func()) {
+	s := spaceManager{
+		ctx:     ctx,
+		spaceID: spaceID,
+	}
+
+	var dirty bool
+	s.changed = func() { dirty = true }
+
+	s.list = gtk.NewListBox()
+	s.list.SetSelectionMode(gtk.SelectionNone)
+	s.list.SetShowSeparators(true)
+	s.list.SetPlaceholder(gtk.NewLabel(locale.S(ctx, "This space has no rooms.")))
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(s.list)
+
+	s.add = gtk.NewListBox()
+	s.add.SetSelectionMode(gtk.SelectionNone)
+	s.add.SetPlaceholder(gtk.NewLabel(locale.S(ctx, "No other rooms to add.")))
+
+	addScroll := gtk.NewScrolledWindow()
+	addScroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	addScroll.SetPropagateNaturalHeight(true)
+	addScroll.SetMaxContentHeight(300)
+	addScroll.SetChild(s.add)
+
+	addPopover := gtk.NewPopover()
+	addPopover.SetChild(addScroll)
+	addPopover.ConnectShow(s.invalidateAddable)
+
+	s.addBtn = gtk.NewMenuButton()
+	s.addBtn.SetLabel(locale.S(ctx, "Add Rooms"))
+	s.addBtn.SetPopover(addPopover)
+
+	subspace := gtk.NewButtonWithLabel(locale.S(ctx, "Create Subspace..."))
+	subspace.ConnectClicked(s.promptSubspace)
+
+	s.busy = gtk.NewSpinner()
+	s.busy.SetHExpand(true)
+	s.busy.SetHAlign(gtk.AlignEnd)
+
+	bottom := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	bottom.AddCSSClass("roomdialog-space-bottom")
+	bottom.Append(s.addBtn)
+	bottom.Append(subspace)
+	bottom.Append(s.busy)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(scroll)
+	box.Append(gtk.NewSeparator(gtk.OrientationHorizontal))
+	box.Append(bottom)
+	spaceCSS(box)
+
+	name, _ := gotktrix.FromContext(ctx).Offline().RoomName(spaceID)
+
+	s.Window = gtk.NewWindow()
+	s.SetTransientFor(app.GTKWindowFromContext(ctx))
+	s.SetModal(true)
+	s.SetDefaultSize(450, 500)
+	s.SetTitle(app.FromContext(ctx).SuffixedTitle(locale.Sprintf(ctx, "Manage %s", name)))
+	s.SetChild(box)
+	s.ConnectCloseRequest(func() bool {
+		if dirty && changed != nil {
+			changed()
+		}
+		return false
+	})
+
+	s.reload()
+	s.Show()
+}
+
+// do runs fn in the background while the window is busy, and then reloads the
+// children.
+func (s *spaceManager) do(fn func(client *gotktrix.Client) error) {
+	s.busy.Start()
+	s.list.SetSensitive(false)
+	s.addBtn.SetSensitive(false)
+
+	gtkutil.Async(s.ctx, func() func() {
+		err := fn(gotktrix.FromContext(s.ctx))
+		return func() {
+			if err != nil {
+				app.Error(s.ctx, err)
+			}
+			s.changed()
+			s.reload()
+		}
+	})
+}
+
+// reload fetches the children of the space again.
+func (s *spaceManager) reload() {
+	s.busy.Start()
+
+	gtkutil.Async(s.ctx, func() func() {
+		client := gotktrix.FromContext(s.ctx)
+
+		children, err := client.SpaceChildren(s.spaceID)
+		if err != nil {
+			return func() {
+				s.busy.Stop()
+				app.Error(s.ctx, err)
+			}
+		}
+
+		names := make([]string, len(children))
+		for i, child := range children {
+			names[i], _ = client.Offline().RoomName(child.ChildRoomID())
+		}
+
+		return func() {
+			s.busy.Stop()
+			s.list.SetSensitive(true)
+			s.addBtn.SetSensitive(true)
+			s.children = children
+
+			for row := s.list.RowAtIndex(0); row != nil; row = s.list.RowAtIndex(0) {
+				s.list.Remove(row)
+			}
+
+			for i, child := range children {
+				s.list.Append(s.newChildRow(i, child, names[i]))
+			}
+		}
+	})
+}
+
+func (s *spaceManager) newChildRow(i int, child m.SpaceChildEvent, name string) gtk.Widgetter {
+	roomID := child.ChildRoomID()
+	client := gotktrix.FromContext(s.ctx).Offline()
+
+	if name == "" {
+		name = string(roomID)
+	}
+
+	nameLabel := gtk.NewLabel(name)
+	nameLabel.SetTooltipText(string(roomID))
+	nameLabel.SetHExpand(true)
+	nameLabel.SetXAlign(0)
+	nameLabel.SetEllipsize(pango.EllipsizeEnd)
+	if client.RoomIsSpace(roomID) {
+		nameLabel.SetAttributes(textutil.Attrs(
+			pango.NewAttrWeight(pango.WeightBold),
+		))
+	}
+
+	suggested := gtk.NewCheckButtonWithLabel(locale.S(s.ctx, "Suggested"))
+	suggested.SetTooltipText(locale.S(s.ctx, "Suggest this room to the members of the space"))
+	suggested.SetActive(child.Suggested)
+	suggested.ConnectToggled(func() {
+		child.Suggested = suggested.Active()
+		s.do(func(client *gotktrix.Client) error {
+			return client.SetSpaceChild(s.spaceID, child)
+		})
+	})
+
+	up := gtk.NewButtonFromIconName("go-up-symbolic")
+	up.SetTooltipText(locale.S(s.ctx, "Move Up"))
+	up.SetHasFrame(false)
+	up.SetSensitive(i > 0)
+	up.ConnectClicked(func() { s.move(i, i-1) })
+
+	down := gtk.NewButtonFromIconName("go-down-symbolic")
+	down.SetTooltipText(locale.S(s.ctx, "Move Down"))
+	down.SetHasFrame(false)
+	down.SetSensitive(i < len(s.children)-1)
+	down.ConnectClicked(func() { s.move(i, i+1) })
+
+	remove := gtk.NewButtonFromIconName("list-remove-symbolic")
+	remove.SetTooltipText(locale.S(s.ctx, "Remove from Space"))
+	remove.SetHasFrame(false)
+	remove.ConnectClicked(func() {
+		s.do(func(client *gotktrix.Client) error {
+			return client.RemoveSpaceChild(s.spaceID, roomID)
+		})
+	})
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	box.AddCSSClass("roomdialog-space-child")
+	box.Append(nameLabel)
+	box.Append(suggested)
+	box.Append(up)
+	box.Append(down)
+	box.Append(remove)
+
+	return box
+}
+
+// move moves the child at the given index to the other index.
+func (s *spaceManager) move(from, to int) {
+	children := append([]m.SpaceChildEvent(nil), s.children...)
+	children[from], children[to] = children[to], children[from]
+
+	s.do(func(client *gotktrix.Client) error {
+		return client.ReorderSpaceChildren(s.spaceID, children)
+	})
+}
+
+// invalidateAddable lists the joined rooms that aren't in the space yet.
+func (s *spaceManager) invalidateAddable() {
+	for row := s.add.RowAtIndex(0); row != nil; row = s.add.RowAtIndex(0) {
+		s.add.Remove(row)
+	}
+
+	client := gotktrix.FromContext(s.ctx).Offline()
+
+	roomIDs, err := client.Rooms()
+	if err != nil {
+		return
+	}
+
+	inSpace := make(map[matrix.RoomID]bool, len(s.children))
+	for _, child := range s.children {
+		inSpace[child.ChildRoomID()] = true
+	}
+
+	type addable struct {
+		id   matrix.RoomID
+		name string
+	}
+
+	rooms := make([]addable, 0, len(roomIDs))
+	for _, roomID := range roomIDs {
+		if inSpace[roomID] || roomID == s.spaceID {
+			continue
+		}
+		name, _ := client.RoomName(roomID)
+		rooms = append(rooms, addable{roomID, name})
+	}
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return strings.ToLower(rooms[i].name) < strings.ToLower(rooms[j].name)
+	})
+
+	for _, room := range rooms {
+		roomID := room.id
+
+		label := gtk.NewLabel(room.name)
+		label.SetTooltipText(string(roomID))
+		label.SetHExpand(true)
+		label.SetXAlign(0)
+		label.SetEllipsize(pango.EllipsizeEnd)
+		label.SetMaxWidthChars(35)
+
+		add := gtk.NewButtonFromIconName("list-add-symbolic")
+		add.SetTooltipText(locale.S(s.ctx, "Add to Space"))
+		add.SetHasFrame(false)
+		add.ConnectClicked(func() {
+			s.addBtn.Popdown()
+			s.do(func(client *gotktrix.Client) error {
+				return client.AddSpaceChild(s.spaceID, roomID, false)
+			})
+		})
+
+		box := gtk.NewBox(gtk.OrientationHorizontal, 4)
+		box.AddCSSClass("roomdialog-space-addroom")
+		box.Append(label)
+		box.Append(add)
+
+		s.add.Append(box)
+	}
+}
+
+// promptSubspace asks for the name of a new subspace and creates it.
+func (s *spaceManager) promptSubspace() {
+	f := newForm(s.ctx, "Create Subspace", "Create")
+	f.SetTransientFor(s.Window)
+
+	nameEntry := f.addEntry(locale.S(s.ctx, "Name"), "")
+
+	f.OK.ConnectClicked(func() {
+		name := strings.TrimSpace(nameEntry.Text())
+
+		f.do(s.ctx, func() error {
+			if name == "" {
+				return errors.New("space name cannot be empty")
+			}
+
+			_, err := gotktrix.FromContext(s.ctx).CreateSubspace(s.spaceID, name)
+			return err
+		}, func() {
+			s.changed()
+			s.reload()
+		})
+	})
+
+	f.Show()
+}
@@ -0,0 +1,300 @@
+package roomdialog
+
+import (
+	"context"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var bridgedCSS = cssutil.Applier("roomdialog-bridged", `
+	.roomdialog-bridged {
+		padding: 12px;
+	}
+	.roomdialog-bridged list {
+		background: inherit;
+	}
+	.roomdialog-bridged-fields > entry {
+		margin-top: 4px;
+	}
+	.roomdialog-bridged-result {
+		padding: 6px 8px;
+	}
+	.roomdialog-bridged-result button {
+		margin-left: 6px;
+	}
+	.roomdialog-bridged-fields-info {
+		font-size: 0.9em;
+		color: alpha(@theme_fg_color, 0.75);
+	}
+`)
+
+// bridgedKind is what is looked up on a bridged network.
+type bridgedKind uint8
+
+const (
+	bridgedChannels bridgedKind = iota
+	bridgedUsers
+)
+
+// lookupBridged shows a dialog that looks up channels and users on the networks
+// that the homeserver bridges to. Found channels can be joined, and found users
+// can be messaged directly.
+func lookupBridged(ctx context.Context, protocols []gotktrix.ThirdPartyProtocol, open OpenFunc) {
+	names := make([]string, len(protocols))
+	for i, protocol := range protocols {
+		names[i] = protocolName(protocol)
+	}
+
+	protocol := gtk.NewDropDownFromStrings(names)
+	protocol.SetHExpand(true)
+
+	kind := gtk.NewDropDownFromStrings([]string{
+		locale.S(ctx, "Channels"),
+		locale.S(ctx, "Users"),
+	})
+
+	top := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	top.Append(protocol)
+	top.Append(kind)
+
+	fields := gtk.NewBox(gtk.OrientationVertical, 0)
+	fields.AddCSSClass("roomdialog-bridged-fields")
+
+	search := gtk.NewButtonWithLabel(locale.S(ctx, "Look Up"))
+	search.AddCSSClass("suggested-action")
+	search.SetHAlign(gtk.AlignEnd)
+
+	busy := gtk.NewSpinner()
+	busy.SetSizeRequest(24, 24)
+
+	actions := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	actions.SetHAlign(gtk.AlignEnd)
+	actions.Append(busy)
+	actions.Append(search)
+
+	list := gtk.NewListBox()
+	list.SetSelectionMode(gtk.SelectionNone)
+	list.SetShowSeparators(true)
+	list.SetPlaceholder(gtk.NewLabel(locale.S(ctx, "Nothing found.")))
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(list)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 6)
+	box.Append(top)
+	box.Append(fields)
+	box.Append(actions)
+	box.Append(scroll)
+	bridgedCSS(box)
+
+	win := gtk.NewWindow()
+	win.SetTransientFor(app.GTKWindowFromContext(ctx))
+	win.SetModal(true)
+	win.SetDefaultSize(400, 500)
+	win.SetTitle(app.FromContext(ctx).SuffixedTitle(locale.S(ctx, "Bridged Networks")))
+	win.SetChild(box)
+
+	ctx, cancel := context.WithCancel(ctx)
+	win.ConnectCloseRequest(func() bool {
+		cancel()
+		return false
+	})
+
+	// entries maps each field of the current protocol and kind to its entry.
+	var entries map[string]*gtk.Entry
+
+	current := func() (gotktrix.ThirdPartyProtocol, bridgedKind) {
+		return protocols[protocol.Selected()], bridgedKind(kind.Selected())
+	}
+
+	clearResults := func() {
+		for row := list.RowAtIndex(0); row != nil; row = list.RowAtIndex(0) {
+			list.Remove(row)
+		}
+	}
+
+	resetFields := func() {
+		for child := fields.FirstChild(); child != nil; child = fields.FirstChild() {
+			fields.Remove(child)
+		}
+
+		p, k := current()
+
+		names := p.LocationFields
+		if k == bridgedUsers {
+			names = p.UserFields
+		}
+
+		entries = make(map[string]*gtk.Entry, len(names))
+		for _, name := range names {
+			entry := gtk.NewEntry()
+			entry.SetPlaceholderText(p.FieldTypes[name].Placeholder)
+			entry.SetTooltipText(name)
+			entry.ConnectActivate(func() { search.Activate() })
+			entries[name] = entry
+			fields.Append(entry)
+		}
+
+		if len(names) == 0 {
+			info := gtk.NewLabel(locale.S(ctx, "This network can't be searched."))
+			info.AddCSSClass("roomdialog-bridged-fields-info")
+			info.SetXAlign(0)
+			fields.Append(info)
+		}
+
+		search.SetSensitive(len(names) > 0)
+		clearResults()
+	}
+
+	protocol.NotifyProperty("selected", resetFields)
+	kind.NotifyProperty("selected", resetFields)
+
+	search.ConnectClicked(func() {
+		p, k := current()
+
+		query := make(map[string]string, len(entries))
+		for name, entry := range entries {
+			if text := strings.TrimSpace(entry.Text()); text != "" {
+				query[name] = text
+			}
+		}
+
+		search.SetSensitive(false)
+		busy.Start()
+
+		gtkutil.Async(ctx, func() func() {
+			client := gotktrix.FromContext(ctx)
+
+			var locations []gotktrix.ThirdPartyLocation
+			var users []gotktrix.ThirdPartyUser
+			var err error
+
+			switch k {
+			case bridgedChannels:
+				locations, err = client.ThirdPartyLocations(p.Name, query)
+			case bridgedUsers:
+				users, err = client.ThirdPartyUsers(p.Name, query)
+			}
+
+			return func() {
+				busy.Stop()
+				search.SetSensitive(true)
+
+				if err != nil {
+					app.Error(ctx, err)
+					return
+				}
+
+				opened := func(id matrix.RoomID) {
+					win.Close()
+					if open != nil {
+						open(id)
+					}
+				}
+
+				clearResults()
+				for _, location := range locations {
+					list.Append(newBridgedChannel(ctx, location, opened))
+				}
+				for _, user := range users {
+					list.Append(newBridgedUser(ctx, user, opened))
+				}
+			}
+		})
+	})
+
+	resetFields()
+	win.Show()
+}
+
+func protocolName(p gotktrix.ThirdPartyProtocol) string {
+	if len(p.Instances) == 1 && p.Instances[0].Desc != "" {
+		return p.Instances[0].Desc
+	}
+	return p.Name
+}
+
+func newBridgedChannel(ctx context.Context, location gotktrix.ThirdPartyLocation, joined OpenFunc) gtk.Widgetter {
+	name := gtk.NewLabel(location.Alias)
+	name.SetXAlign(0)
+	name.SetHExpand(true)
+	name.SetEllipsize(pango.EllipsizeEnd)
+	name.SetAttributes(textutil.Attrs(
+		pango.NewAttrWeight(pango.WeightBold),
+	))
+
+	join := gtk.NewButtonWithLabel(locale.S(ctx, "Join"))
+	join.AddCSSClass("suggested-action")
+	join.SetVAlign(gtk.AlignCenter)
+	join.ConnectClicked(func() {
+		join.SetSensitive(false)
+
+		gtkutil.Async(ctx, func() func() {
+			roomID, err := gotktrix.FromContext(ctx).RoomJoinAlias(location.Alias)
+			if err != nil {
+				return func() {
+					join.SetSensitive(true)
+					app.Error(ctx, err)
+				}
+			}
+			return func() { joined(roomID) }
+		})
+	})
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	box.AddCSSClass("roomdialog-bridged-result")
+	box.Append(name)
+	box.Append(join)
+
+	return box
+}
+
+func newBridgedUser(ctx context.Context, user gotktrix.ThirdPartyUser, opened OpenFunc) gtk.Widgetter {
+	name := gtk.NewLabel(string(user.UserID))
+	name.SetXAlign(0)
+	name.SetHExpand(true)
+	name.SetEllipsize(pango.EllipsizeEnd)
+	name.SetSelectable(true)
+
+	message := gtk.NewButtonWithLabel(locale.S(ctx, "Message"))
+	message.SetVAlign(gtk.AlignCenter)
+	message.ConnectClicked(func() {
+		client := gotktrix.FromContext(ctx)
+
+		if roomID, ok := client.Offline().DirectRoom(user.UserID); ok {
+			opened(roomID)
+			return
+		}
+
+		message.SetSensitive(false)
+
+		gtkutil.Async(ctx, func() func() {
+			roomID, err := client.CreateDirectRoom(user.UserID)
+			if err != nil {
+				return func() {
+					message.SetSensitive(true)
+					app.Error(ctx, err)
+				}
+			}
+			return func() { opened(roomID) }
+		})
+	})
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	box.AddCSSClass("roomdialog-bridged-result")
+	box.Append(name)
+	box.Append(message)
+
+	return box
+}
@@ -0,0 +1,148 @@
+package roomdialog
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// UpgradeRoom shows a dialog that upgrades the room to a newer room version.
+// The homeserver creates the replacement room and points the old room to it;
+// the dialog then makes sure that the room's settings came along and
+// optionally invites the current members. Once done, the new room is opened.
+func UpgradeRoom(ctx context.Context, roomID matrix.RoomID, open OpenFunc) {
+	gtkutil.Async(ctx, func() func() {
+		client := gotktrix.FromContext(ctx)
+
+		versions, def, err := client.RoomVersions()
+		if err != nil {
+			return func() { app.Error(ctx, err) }
+		}
+
+		current := client.Offline().RoomVersion(roomID)
+
+		return func() { upgradeRoom(ctx, roomID, current, versions, def, open) }
+	})
+}
+
+func upgradeRoom(
+	ctx context.Context, roomID matrix.RoomID,
+	current string, versions []string, def string, open OpenFunc) {
+
+	f := newForm(ctx, "Upgrade Room", "Upgrade")
+	f.SetDefaultSize(400, 300)
+
+	info := gtk.NewLabel(locale.Sprintf(ctx,
+		"This room is on version %s. Upgrading replaces it with a new room; "+
+			"the old room is closed and points members to the new one.", current))
+	info.SetXAlign(0)
+	info.SetWrap(true)
+	f.box.Append(info)
+
+	versionLabel := gtk.NewLabel(locale.S(ctx, "New Version"))
+	versionLabel.SetXAlign(0)
+	versionLabel.SetMarginTop(8)
+	f.box.Append(versionLabel)
+
+	version := gtk.NewDropDownFromStrings(versions)
+	for i, v := range versions {
+		if v == def {
+			version.SetSelected(uint(i))
+			break
+		}
+	}
+	f.box.Append(version)
+
+	invite := gtk.NewCheckButtonWithLabel(locale.S(ctx, "Invite current members to the new room"))
+	invite.SetActive(true)
+	invite.SetMarginTop(8)
+	f.box.Append(invite)
+
+	status := gtk.NewLabel("")
+	status.SetXAlign(0)
+	status.SetMarginTop(8)
+	status.Hide()
+	f.box.Append(status)
+
+	progress := func(step gotktrix.UpgradeStep, done, total int) {
+		var text string
+		switch step {
+		case gotktrix.UpgradeCreating:
+			text = locale.S(ctx, "Creating the new room…")
+		case gotktrix.UpgradeCopyingState:
+			text = locale.S(ctx, "Copying room settings…")
+		case gotktrix.UpgradeInviting:
+			text = locale.Sprintf(ctx, "Inviting members (%d/%d)…", done, total)
+		}
+
+		glib.IdleAdd(func() {
+			status.SetText(text)
+			status.Show()
+		})
+	}
+
+	// newRoomID is set once the room is upgraded. If that happened with
+	// errors, such as members that couldn't be invited, then the dialog stays
+	// open to show them, and OK only opens the new room.
+	var newRoomID matrix.RoomID
+
+	f.OK.ConnectClicked(func() {
+		if newRoomID != "" {
+			f.Close()
+			f.Destroy()
+			if open != nil {
+				open(newRoomID)
+			}
+			return
+		}
+
+		if len(versions) == 0 {
+			return
+		}
+
+		newVersion := versions[version.Selected()]
+		inviteMembers := invite.Active()
+
+		var upgradedID matrix.RoomID
+
+		f.do(ctx, func() error {
+			if newVersion == current {
+				return errors.New("the room is already on this version")
+			}
+
+			id, err := gotktrix.FromContext(ctx).UpgradeRoom(
+				ctx, roomID, newVersion, inviteMembers, progress)
+			if err != nil {
+				if id != "" {
+					// The room was already replaced, so the user should still
+					// be taken to it.
+					glib.IdleAdd(func() {
+						newRoomID = id
+						status.SetText(locale.S(ctx, "Room upgraded with errors."))
+						f.OK.SetLabel(locale.S(ctx, "Open Room"))
+						version.SetSensitive(false)
+						invite.SetSensitive(false)
+					})
+					return errors.Wrap(err, "room upgraded with errors")
+				}
+				return errors.Wrap(err, "failed to upgrade room")
+			}
+
+			upgradedID = id
+			return nil
+		}, func() {
+			if open != nil {
+				open(upgradedID)
+			}
+		})
+	})
+
+	f.Show()
+}
@@ -0,0 +1,141 @@
+package roomlist
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/components/onlineimage"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/app/roomlist/room"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/breadcrumbs"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// breadcrumbsShown is the maximum number of recently viewed rooms shown.
+const breadcrumbsShown = 8
+
+var breadcrumbsCSS = cssutil.Applier("roomlist-breadcrumbs", `
+	.roomlist-breadcrumbs {
+		padding: 4px 6px;
+		border-bottom: 1px solid @borders;
+	}
+	.roomlist-breadcrumbs > button {
+		border-radius: 999px 999px;
+		padding:    0;
+		min-width:  0;
+		min-height: 0;
+		margin-right: 4px;
+	}
+`)
+
+// Breadcrumbs is a row of the rooms that the user has recently viewed, shown
+// above the room list for quick access. The list is kept in the account data,
+// so it's shared with other clients.
+type Breadcrumbs struct {
+	*gtk.Revealer
+	box *gtk.Box
+
+	ctx   context.Context
+	open  func(matrix.RoomID)
+	known func(matrix.RoomID) bool
+}
+
+// NewBreadcrumbs creates a new Breadcrumbs row. open is called when a room is
+// clicked, and known filters out the rooms that can't be opened.
+func NewBreadcrumbs(
+	ctx context.Context, open func(matrix.RoomID), known func(matrix.RoomID) bool) *Breadcrumbs {
+
+	b := Breadcrumbs{
+		ctx:   ctx,
+		open:  open,
+		known: known,
+	}
+
+	b.box = gtk.NewBox(gtk.OrientationHorizontal, 0)
+	breadcrumbsCSS(b.box)
+
+	b.Revealer = gtk.NewRevealer()
+	b.Revealer.SetChild(b.box)
+	b.Revealer.SetRevealChild(false)
+	b.Revealer.SetTransitionType(gtk.RevealerTransitionTypeSlideDown)
+
+	gtkutil.BindSubscribe(b, func() func() {
+		client := gotktrix.FromContext(ctx)
+		return client.SubscribeUser(breadcrumbs.EventType, func() {
+			glib.IdleAdd(b.Invalidate)
+		})
+	})
+
+	return &b
+}
+
+// Visit records the given room as the most recently viewed one.
+func (b *Breadcrumbs) Visit(roomID matrix.RoomID) {
+	client := gotktrix.FromContext(b.ctx)
+
+	breadcrumbs.Visit(client, roomID, func(err error) {
+		if err != nil {
+			glib.IdleAdd(func() {
+				app.Error(b.ctx, errors.Wrap(err, "cannot update recent rooms"))
+			})
+		}
+	})
+
+	b.Invalidate()
+}
+
+// Invalidate rebuilds the row from the recently viewed rooms. The room that is
+// currently viewed is left out, since it's already open.
+func (b *Breadcrumbs) Invalidate() {
+	for child := b.box.FirstChild(); child != nil; child = b.box.FirstChild() {
+		b.box.Remove(child)
+	}
+
+	client := gotktrix.FromContext(b.ctx).Offline()
+	recent := breadcrumbs.Recent(client)
+
+	var n int
+	for i, roomID := range recent {
+		if i == 0 || !b.known(roomID) {
+			continue
+		}
+
+		b.box.Append(b.newCrumb(roomID))
+
+		if n++; n == breadcrumbsShown {
+			break
+		}
+	}
+
+	b.Revealer.SetRevealChild(n > 0)
+}
+
+func (b *Breadcrumbs) newCrumb(roomID matrix.RoomID) gtk.Widgetter {
+	icon := onlineimage.NewAvatar(b.ctx, gotktrix.AvatarProvider, spaceIconSize)
+	icon.SetInitials(string(roomID))
+
+	button := gtk.NewButton()
+	button.SetHasFrame(false)
+	button.SetChild(icon)
+	button.ConnectClicked(func() { b.open(roomID) })
+
+	state := room.NewState(b.ctx, roomID)
+	state.NotifyName(func(ctx context.Context, s room.State) {
+		icon.SetInitials(s.Name)
+		button.SetTooltipText(s.Name)
+	})
+	state.NotifyAvatar(func(ctx context.Context, s room.State) {
+		icon.SetFromURL(string(s.Avatar))
+	})
+
+	gtkutil.BindSubscribe(button, func() func() {
+		return state.Subscribe()
+	})
+
+	return button
+}
@@ -6,7 +6,11 @@ import (
 
 	"github.com/diamondburned/gotk4/pkg/core/glib"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/app/prefs/kvstate"
+	"github.com/diamondburned/gotkit/gtkutil"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/app/roomdialog"
 	"github.com/diamondburned/gotktrix/internal/app/roomlist/room"
 	"github.com/diamondburned/gotktrix/internal/app/roomlist/space"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
@@ -17,12 +21,18 @@ import (
 type Browser struct {
 	*gtk.Box
 	list   *space.List
+	crumbs *Breadcrumbs
 	spaces struct {
 		*gtk.Revealer
 		scroll *gtk.ScrolledWindow
 
 		box     *gtk.Box
 		buttons map[matrix.RoomID]spaceButton
+
+		// config remembers the last chosen space, which is chosen again once
+		// its button is added.
+		config *kvstate.Config
+		last   matrix.RoomID
 	}
 
 	ctx context.Context
@@ -40,6 +50,14 @@ var spacesCSS = cssutil.Applier("roomlist-spaces", `
 	}
 `)
 
+// lastSpaceKey is the key in the config of the last chosen space.
+const lastSpaceKey = "last"
+
+func acquireSpaceConfig(ctx context.Context) *kvstate.Config {
+	uID := gotktrix.FromContext(ctx).UserID
+	return kvstate.AcquireConfig(ctx, "roomlist", gotktrix.Base64UserID(uID), "space.json")
+}
+
 var spacesRevealerCSS = cssutil.Applier("roomlist-spaces-revealer", ``)
 
 // New creates a new spaces browser.
@@ -48,6 +66,10 @@ func New(ctx context.Context, ctrl space.Controller) *Browser {
 	b.list = space.New(ctx, ctrl)
 	b.list.SetVExpand(true)
 
+	b.crumbs = NewBreadcrumbs(ctx, ctrl.OpenRoom, func(id matrix.RoomID) bool {
+		return b.list.Room(id) != nil
+	})
+
 	allRooms := NewAllRoomsButton(ctx)
 	allRooms.SetActive(true)
 	allRooms.ConnectClicked(func() { b.chooseSpace(allRooms) })
@@ -61,6 +83,9 @@ func New(ctx context.Context, ctrl space.Controller) *Browser {
 	b.spaces.buttons = make(map[matrix.RoomID]spaceButton, 1)
 	b.spaces.buttons[""] = allRooms
 
+	b.spaces.config = acquireSpaceConfig(ctx)
+	b.spaces.config.Get(lastSpaceKey, &b.spaces.last)
+
 	viewport := gtk.NewViewport(nil, nil)
 	viewport.SetChild(b.spaces.box)
 	viewport.SetHScrollPolicy(gtk.ScrollNatural)
@@ -79,6 +104,7 @@ func New(ctx context.Context, ctrl space.Controller) *Browser {
 	spacesRevealerCSS(b.spaces.Revealer)
 
 	b.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+	b.Box.Append(b.crumbs)
 	b.Box.Append(b.list)
 	b.Box.Append(b.spaces)
 
@@ -97,6 +123,7 @@ func (b *Browser) InvalidateRooms() {
 		}
 
 		b.list.InvalidateSections()
+		b.crumbs.Invalidate()
 	}
 
 	go func() {
@@ -128,7 +155,10 @@ func (b *Browser) InvalidateRooms() {
 		}
 
 		if len(known) > 0 {
-			glib.IdleAdd(func() { b.list.InvalidateSections() })
+			glib.IdleAdd(func() {
+				b.list.InvalidateSections()
+				b.crumbs.Invalidate()
+			})
 		}
 	}()
 }
@@ -153,10 +183,43 @@ func (b *Browser) addSpace(spaceID matrix.RoomID) {
 	space := NewSpaceButton(b.ctx, spaceID)
 	space.ConnectClicked(func() { b.chooseSpace(space) })
 
+	gtkutil.BindActionMap(space, map[string]func(){
+		"space.explore": func() {
+			roomdialog.ExploreSpace(b.ctx, spaceID, b.list.OpenRoom)
+		},
+		"space.manage": func() {
+			roomdialog.ManageSpace(b.ctx, spaceID, func() {
+				// Fetch the rooms in the space again if it's shown.
+				if b.spaces.last == spaceID {
+					b.list.SetSpaceID(spaceID)
+				}
+			})
+		},
+	})
+
+	gtkutil.BindRightClick(space, func() {
+		items := []gtkutil.PopoverMenuItem{
+			gtkutil.MenuItem(locale.S(b.ctx, "Explore Space..."), "space.explore"),
+		}
+
+		client := gotktrix.FromContext(b.ctx).Offline()
+		if client.CanManageSpace(spaceID) {
+			items = append(items,
+				gtkutil.MenuItem(locale.S(b.ctx, "Manage Space..."), "space.manage"),
+			)
+		}
+
+		gtkutil.ShowPopoverMenuCustom(space, gtk.PosBottom, items)
+	})
+
 	b.spaces.buttons[spaceID] = space
 	b.spaces.box.Append(space)
 
 	b.spaces.SetRevealChild(true)
+
+	if spaceID == b.spaces.last {
+		b.chooseSpace(space)
+	}
 }
 
 func (b *Browser) chooseSpace(chosen spaceButton) {
@@ -165,11 +228,18 @@ func (b *Browser) chooseSpace(chosen spaceButton) {
 		button.SetActive(button == chosen)
 	}
 
-	switch button := chosen.(type) {
-	case *SpaceButton:
-		b.list.SetSpaceID(button.SpaceID())
-	case *AllRoomsButton:
-		b.list.SetSpaceID("")
+	var spaceID matrix.RoomID
+	if button, ok := chosen.(*SpaceButton); ok {
+		spaceID = button.SpaceID()
+	}
+
+	b.list.SetSpaceID(spaceID)
+
+	b.spaces.last = spaceID
+	if spaceID == "" {
+		b.spaces.config.Delete(lastSpaceKey)
+	} else {
+		b.spaces.config.Set(lastSpaceKey, spaceID)
 	}
 }
 
@@ -183,12 +253,33 @@ func (b *Browser) SearchBar() *gtk.SearchBar {
 	return b.list.SearchBar
 }
 
+// RecentShown returns true if the section of recently active rooms is shown.
+func (b *Browser) RecentShown() bool {
+	return b.list.RecentShown()
+}
+
+// SetRecentShown shows or hides the section of recently active rooms.
+func (b *Browser) SetRecentShown(shown bool) {
+	b.list.SetRecentShown(shown)
+}
+
+// NotifyRecentShown calls f every time the section of recently active rooms is
+// shown or hidden for as long as the given widget is mapped.
+func (b *Browser) NotifyRecentShown(widget gtk.Widgetter, f func(shown bool)) {
+	b.list.NotifyRecentShown(widget, f)
+}
+
 // SetSelectedRoom sets the given room ID as the selected room row. It does not
 // activate the room.
 func (b *Browser) SetSelectedRoom(id matrix.RoomID) {
 	b.list.SetSelectedRoom(id)
 }
 
+// VisitRoom records the given room as recently viewed in the breadcrumbs.
+func (b *Browser) VisitRoom(id matrix.RoomID) {
+	b.crumbs.Visit(id)
+}
+
 // Room gets the room with the given ID, or nil if it's not known.
 func (b *Browser) Room(id matrix.RoomID) *room.Room {
 	return b.list.Room(id)
@@ -0,0 +1,195 @@
+package room
+
+import (
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+)
+
+var showHoverCard = prefs.NewBool(true, prefs.PropMeta{
+	Name:        "Hover Preview",
+	Section:     "Rooms",
+	Description: "Show the room topic and the latest messages when hovering over a room.",
+})
+
+const (
+	// hoverCardDelay is the time in milliseconds that the user has to hover
+	// over a room for the card to show up.
+	hoverCardDelay = 650
+	// hoverCardMessages is the maximum number of messages shown in the card.
+	hoverCardMessages = 3
+)
+
+var hoverCardCSS = cssutil.Applier("room-hovercard", `
+	.room-hovercard {
+		padding: 4px 2px;
+	}
+	.room-hovercard-topic {
+		margin-top: 2px;
+	}
+	.room-hovercard-members,
+	.room-hovercard-message {
+		font-size: 0.9em;
+	}
+	.room-hovercard-members {
+		color: alpha(@theme_fg_color, 0.75);
+	}
+	.room-hovercard-messages {
+		margin-top: 6px;
+		padding-top: 4px;
+		border-top: 1px solid @borders;
+	}
+	.room-hovercard-message {
+		margin-top: 2px;
+	}
+`)
+
+// hoverCard describes the state of a room's hover preview card.
+type hoverCard struct {
+	room    *Room
+	popover *gtk.Popover
+	timeout glib.SourceHandle
+}
+
+// bindHoverCard binds a motion controller to the room that shows a preview card
+// after the user has hovered over it for a while.
+func bindHoverCard(r *Room) {
+	card := hoverCard{room: r}
+
+	motion := gtk.NewEventControllerMotion()
+	motion.ConnectEnter(func(x, y float64) {
+		if showHoverCard.Value() {
+			card.schedule()
+		}
+	})
+	motion.ConnectLeave(func() {
+		card.cancel()
+		card.popdown()
+	})
+
+	r.AddController(motion)
+}
+
+func (c *hoverCard) schedule() {
+	c.cancel()
+	c.timeout = glib.TimeoutAdd(hoverCardDelay, func() {
+		c.timeout = 0
+		c.popup()
+	})
+}
+
+func (c *hoverCard) cancel() {
+	if c.timeout != 0 {
+		glib.SourceRemove(c.timeout)
+		c.timeout = 0
+	}
+}
+
+func (c *hoverCard) popdown() {
+	if c.popover != nil {
+		c.popover.Popdown()
+		c.popover = nil
+	}
+}
+
+func (c *hoverCard) popup() {
+	ctx := c.room.ctx.Take()
+	if ctx.Err() != nil {
+		return
+	}
+
+	name := gtk.NewLabel(c.room.Name)
+	name.SetXAlign(0)
+	name.SetWrap(true)
+	name.SetWrapMode(pango.WrapWordChar)
+	name.SetAttributes(textutil.Attrs(
+		pango.NewAttrWeight(pango.WeightBold),
+	))
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(name)
+	hoverCardCSS(box)
+
+	if c.room.Topic != "" {
+		topic := gtk.NewLabel(c.room.Topic)
+		topic.AddCSSClass("room-hovercard-topic")
+		topic.SetXAlign(0)
+		topic.SetWrap(true)
+		topic.SetWrapMode(pango.WrapWordChar)
+		topic.SetLines(4)
+		topic.SetEllipsize(pango.EllipsizeEnd)
+		box.Append(topic)
+	}
+
+	p := gtk.NewPopover()
+	p.SetParent(c.room)
+	p.SetPosition(gtk.PosRight)
+	p.SetAutohide(false)
+	p.SetCanTarget(false)
+	p.SetSizeRequest(gtkutil.PopoverWidth, -1)
+	p.SetChild(box)
+	gtkutil.PopupFinally(p)
+
+	c.popdown()
+	c.popover = p
+
+	roomID := c.room.ID
+
+	gtkutil.Async(ctx, func() func() {
+		client := gotktrix.FromContext(ctx).Offline()
+
+		var members int
+		if summary, err := client.State.RoomSummary(roomID); err == nil {
+			members = summary.JoinedCount
+		}
+
+		events := make([]event.RoomEvent, 0, hoverCardMessages)
+		client.EachTimelineReverse(roomID, func(ev event.RoomEvent) error {
+			if ev.Info().Type == event.TypeRoomMessage {
+				events = append(events, ev)
+			}
+			if len(events) == hoverCardMessages {
+				return gotktrix.EachBreak
+			}
+			return nil
+		})
+
+		return func() {
+			if members > 0 {
+				l := gtk.NewLabel(locale.Plural(ctx, "%d member", "%d members", members))
+				l.AddCSSClass("room-hovercard-members")
+				l.SetXAlign(0)
+				box.Append(l)
+			}
+
+			if len(events) == 0 {
+				return
+			}
+
+			messages := gtk.NewBox(gtk.OrientationVertical, 0)
+			messages.AddCSSClass("room-hovercard-messages")
+			box.Append(messages)
+
+			// Show the messages from oldest to newest.
+			for i := len(events) - 1; i >= 0; i-- {
+				l := gtk.NewLabel("")
+				l.AddCSSClass("room-hovercard-message")
+				l.SetXAlign(0)
+				l.SetWrap(true)
+				l.SetWrapMode(pango.WrapWordChar)
+				l.SetLines(2)
+				l.SetEllipsize(pango.EllipsizeEnd)
+				l.SetMarkup(message.RenderEvent(ctx, events[i]))
+				messages.Append(l)
+			}
+		}
+	})
+}
@@ -2,7 +2,7 @@ package room
 
 import (
 	"context"
-	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/diamondburned/gotk4/pkg/gdk/v4"
@@ -18,7 +18,10 @@ import (
 	"github.com/diamondburned/gotkit/gtkutil/textutil"
 	"github.com/diamondburned/gotktrix/internal/app/emojiview"
 	"github.com/diamondburned/gotktrix/internal/app/messageview/message"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mcontent"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/emojis"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
 	"github.com/diamondburned/gotrix/event"
 	"github.com/diamondburned/gotrix/matrix"
 	"github.com/pkg/errors"
@@ -40,8 +43,9 @@ type Room struct {
 
 	name struct {
 		*gtk.Box
-		label  *gtk.Label
-		unread *gtk.Label
+		label    *gtk.Label
+		unread   *gtk.Label
+		mentions *gtk.Label
 	}
 
 	preview struct {
@@ -52,6 +56,8 @@ type Room struct {
 
 	ctx     gtkutil.Cancellable
 	section Section
+
+	notifications m.NotificationCount
 }
 
 var rowCSS = cssutil.Applier("room-row", `
@@ -89,16 +95,35 @@ var roomBoxCSS = cssutil.Applier("room-box", `
 	.room-preview {
 		margin-right: 2px;
 	}
-	.room-unread-count,
 	.room-preview,
 	.room-preview-extra {
 		font-size: 0.8em;
 	}
-	.room-unread-count,
 	.room-preview-extra {
 		color: alpha(@theme_fg_color, 0.75);
 		margin-left: 2px;
 	}
+	.room-unread-count,
+	.room-mention-count {
+		font-size: 0.75em;
+		font-weight: bold;
+		min-width: 1em;
+		padding: 0 5px;
+		margin-left: 4px;
+		margin-right: 6px;
+		border-radius: 99px;
+	}
+	.room-unread-count {
+		background-color: alpha(@theme_fg_color, 0.15);
+	}
+	.room-mention-count {
+		color: @theme_selected_fg_color;
+		/* See message/message.go @ messageCSS. */
+		background-color: @highlighted_message;
+	}
+	.room-unread-count + .room-mention-count {
+		margin-left: 0;
+	}
 	.room-highlighted-message {
 		/* See message/message.go @ messageCSS. */
 		background-color: alpha(@highlighted_message, 0.15);
@@ -122,6 +147,7 @@ type Section interface {
 
 	OpenRoom(matrix.RoomID)
 	OpenRoomInTab(matrix.RoomID)
+	OpenRoomInSplit(matrix.RoomID)
 
 	// MoveRoomToTag moves the room with the given ID to the given tag name. A
 	// new section must be created if needed.
@@ -154,12 +180,19 @@ func AddTo(ctx context.Context, section Section, roomID matrix.RoomID) *Room {
 	r.name.label.AddCSSClass("room-name")
 
 	r.name.unread = gtk.NewLabel("")
-	r.name.unread.SetXAlign(1)
+	r.name.unread.SetVAlign(gtk.AlignCenter)
 	r.name.unread.AddCSSClass("room-unread-count")
+	r.name.unread.Hide()
+
+	r.name.mentions = gtk.NewLabel("")
+	r.name.mentions.SetVAlign(gtk.AlignCenter)
+	r.name.mentions.AddCSSClass("room-mention-count")
+	r.name.mentions.Hide()
 
 	r.name.Box = gtk.NewBox(gtk.OrientationHorizontal, 0)
 	r.name.Box.Append(r.name.label)
 	r.name.Box.Append(r.name.unread)
+	r.name.Box.Append(r.name.mentions)
 
 	r.preview.label = gtk.NewLabel("")
 	r.preview.label.AddCSSClass("room-preview")
@@ -225,43 +258,110 @@ func AddTo(ctx context.Context, section Section, roomID matrix.RoomID) *Room {
 	gtkutil.BindActionMap(r, map[string]func(){
 		"room.open":            func() { section.OpenRoom(roomID) },
 		"room.open-in-tab":     func() { section.OpenRoomInTab(roomID) },
+		"room.open-in-split":   func() { section.OpenRoomInSplit(roomID) },
 		"room.prompt-reorder":  func() { r.promptReorder() },
 		"room.move-to-section": nil,
 		"room.add-emojis":      func() { emojiview.ForRoom(r.ctx.Take(), r.ID) },
+		"room.set-accent":      func() { r.promptAccent() },
+		"room.toggle-announcement": func() {
+			ctx := r.ctx.Take()
+			client := gotktrix.FromContext(ctx).Offline()
+			r.SetAnnouncement(!client.IsAnnouncementRoom(roomID))
+		},
+		"room.toggle-blur": func() {
+			ctx := r.ctx.Take()
+			mcontent.SetBlurImages(ctx, roomID, !mcontent.BlurImages(ctx, roomID))
+		},
+		"room.toggle-autoload": func() {
+			ctx := r.ctx.Take()
+			mcontent.SetAutoLoadMedia(ctx, roomID, !mcontent.AutoLoadMedia(ctx, roomID))
+		},
+		"room.toggle-irc": func() {
+			ctx := r.ctx.Take()
+			switch {
+			case message.RoomLayout(ctx, roomID) != message.IRCLayout:
+				message.SetRoomLayout(ctx, roomID, message.IRCLayout)
+			case message.Layout.Value() == message.IRCLayout:
+				// The room follows the global setting, so override it.
+				message.SetRoomLayout(ctx, roomID, message.FlatLayout)
+			default:
+				message.SetRoomLayout(ctx, roomID, "")
+			}
+		},
 	})
 
+	client := gotktrix.FromContext(r.ctx.Take()).Offline()
+
 	gtkutil.BindRightClick(r, func() {
 		s := locale.SFunc(ctx)
 
+		// Room emojis are stored in a state event.
+		canEditEmojis := client.CanSendEvent(roomID, emojis.RoomEmotesEventType, true)
+
+		blurLabel := s("Blur Images")
+		if mcontent.BlurImages(ctx, roomID) {
+			blurLabel = s("Don't Blur Images")
+		}
+
+		autoLoadLabel := s("Auto-load Media")
+		if mcontent.AutoLoadMedia(ctx, roomID) {
+			autoLoadLabel = s("Tap to Load Media")
+		}
+
+		// Marking an announcement room changes its power levels.
+		canAnnounce := client.CanSendEvent(roomID, event.TypeRoomPowerLevels, true)
+
+		announceLabel := s("Mark as Announcement Room")
+		if client.IsAnnouncementRoom(roomID) {
+			announceLabel = s("Unmark as Announcement Room")
+		}
+
+		ircLabel := s("Use IRC Layout")
+		if message.RoomLayout(ctx, roomID) == message.IRCLayout {
+			ircLabel = s("Don't Use IRC Layout")
+		}
+
 		p := gtkutil.NewPopoverMenuCustom(r, gtk.PosBottom, []gtkutil.PopoverMenuItem{
 			gtkutil.MenuItem(s("Open"), "room.open"),
 			gtkutil.MenuItem(s("Open in New Tab"), "room.open-in-tab"),
+			gtkutil.MenuItem(s("Open in Split View"), "room.open-in-split"),
 			gtkutil.MenuSeparator(s("Section")),
 			gtkutil.MenuItem(s("Reorder Room..."), "room.prompt-reorder"),
 			gtkutil.Submenu(s("Move to Section..."), []gtkutil.PopoverMenuItem{
 				gtkutil.MenuWidget("room.move-to-section", r.moveToSectionBox()),
 			}),
 			gtkutil.MenuSeparator(s("Emojis")),
-			gtkutil.MenuItem(s("Add Emojis..."), "room.add-emojis"),
+			gtkutil.MenuItem(s("Add Emojis..."), "room.add-emojis", canEditEmojis),
+			gtkutil.MenuSeparator(s("Media")),
+			gtkutil.MenuItem(blurLabel, "room.toggle-blur"),
+			gtkutil.MenuItem(autoLoadLabel, "room.toggle-autoload"),
+			gtkutil.MenuSeparator(s("Messages")),
+			gtkutil.MenuItem(ircLabel, "room.toggle-irc"),
+			gtkutil.MenuItem(s("Accent Color..."), "room.set-accent"),
+			gtkutil.MenuItem(announceLabel, "room.toggle-announcement", canAnnounce),
 		})
 		p.SetAutohide(true)
 		p.SetCascadePopdown(true)
 		gtkutil.PopupFinally(p)
 	})
 
-	client := gotktrix.FromContext(r.ctx.Take()).Offline()
-
 	// Bind the message handler to update itself.
 	r.ctx.OnRenew(func(ctx context.Context) func() {
 		r.InvalidatePreview(ctx)
 
+		gtkutil.Async(ctx, func() func() {
+			count := client.RoomCountNotifications(roomID)
+			return func() { r.setNotifications(count) }
+		})
+
 		return gtkutil.FuncBatcher(
 			r.State.Subscribe(),
 			client.SubscribeRoomSync(roomID, func() {
 				fn := r.invalidatePreview(ctx)
+				count := client.RoomCountNotifications(roomID)
 				gtkutil.IdleCtx(ctx, func() {
 					fn()
-					r.Changed()
+					r.setNotifications(count)
 				})
 			}),
 		)
@@ -271,6 +371,8 @@ func AddTo(ctx context.Context, section Section, roomID matrix.RoomID) *Room {
 	drag := gtkutil.NewDragSourceWithContent(r, gdk.ActionMove, string(roomID))
 	r.AddController(drag)
 
+	bindHoverCard(&r)
+
 	showEventNum.SubscribeWidget(r, func() { r.InvalidatePreview(r.ctx.Take()) })
 	showMessagePreview.SubscribeWidget(r, func() { r.InvalidatePreview(r.ctx.Take()) })
 
@@ -287,6 +389,38 @@ func (r *Room) Changed() {
 	r.section.Changed(r)
 }
 
+// Notifications returns the room's unread notification and highlight counts as
+// of the last sync. See gotktrix.Client.RoomCountNotifications.
+func (r *Room) Notifications() m.NotificationCount {
+	return r.notifications
+}
+
+// setNotifications updates the room's unread and mention badges to the given
+// counts.
+func (r *Room) setNotifications(count m.NotificationCount) {
+	if count.Notification > 0 {
+		r.AddCSSClass("room-notified-message")
+	} else {
+		r.RemoveCSSClass("room-notified-message")
+	}
+
+	if count.Highlight > 0 {
+		r.AddCSSClass("room-highlighted-message")
+	} else {
+		r.RemoveCSSClass("room-highlighted-message")
+	}
+
+	r.name.unread.SetVisible(count.Notification > 0)
+	r.name.unread.SetText(strconv.Itoa(count.Notification))
+	r.name.mentions.SetVisible(count.Highlight > 0)
+	r.name.mentions.SetText("@" + strconv.Itoa(count.Highlight))
+
+	if r.notifications != count {
+		r.notifications = count
+		r.Changed()
+	}
+}
+
 // IsIn returns true if the room is in the given section.
 func (r *Room) IsIn(s Section) bool {
 	return r.section == s
@@ -350,7 +484,6 @@ func (r *Room) invalidatePreview(ctx context.Context) func() {
 	}
 
 	unread, _ := client.RoomCountUnread(r.ID)
-	notifications := client.State.RoomNotificationCount(r.ID)
 
 	return func() {
 		// Only show the unread bar if we have unread messages, not unread
@@ -363,30 +496,12 @@ func (r *Room) invalidatePreview(ctx context.Context) func() {
 			r.RemoveCSSClass("room-unread-message")
 		}
 
-		if notifications.Notification > 0 {
-			r.AddCSSClass("room-notified-message")
-		} else {
-			r.RemoveCSSClass("room-notified-message")
-		}
-
-		if notifications.Highlight > 0 {
-			r.AddCSSClass("room-highlighted-message")
-		} else {
-			r.RemoveCSSClass("room-highlighted-message")
-		}
-
 		if unread == 0 {
 			r.RemoveCSSClass("room-unread-events")
 		} else {
 			r.AddCSSClass("room-unread-events")
 		}
 
-		if notifications.Notification == 0 {
-			r.name.unread.SetText("")
-		} else {
-			r.name.unread.SetText(fmt.Sprintf("(%d)", notifications.Notification))
-		}
-
 		preview := message.RenderEvent(ctx, first)
 		r.preview.label.SetMarkup(preview)
 		r.preview.label.SetTooltipMarkup(preview)
@@ -440,6 +555,25 @@ func (r *Room) SetOrder(order float64) {
 	})
 }
 
+// SetAnnouncement marks or unmarks the room as an announcement room, in which
+// only moderators can send messages.
+func (r *Room) SetAnnouncement(announce bool) {
+	ctx := r.ctx.Take()
+	if ctx.Err() != nil {
+		return
+	}
+
+	gtkutil.Async(ctx, func() func() {
+		client := gotktrix.FromContext(ctx)
+
+		if err := client.SetAnnouncementRoom(r.ID, announce); err != nil {
+			app.Error(ctx, errors.Wrap(err, "failed to update announcement room"))
+		}
+
+		return nil
+	})
+}
+
 // Order returns the current room's order number, or -1 if the room doesn't have
 // one.
 func (r *Room) Order() float64 {
@@ -549,6 +683,56 @@ func (r *Room) promptReorder() {
 	dialog.Show()
 }
 
+var accentDialog = cssutil.Applier("room-accent-dialog", `
+	.room-accent-dialog {
+		margin: 12px;
+	}
+	.room-accent-dialog > checkbutton {
+		margin-top: 8px;
+	}
+`)
+
+// promptAccent asks the user for the accent color of the room, which is used
+// for its header and mentions.
+func (r *Room) promptAccent() {
+	ctx := r.ctx.Take()
+
+	chooser := gtk.NewColorChooserWidget()
+	chooser.SetUseAlpha(false)
+
+	reset := gtk.NewCheckButtonWithLabel(locale.S(ctx, "Use the default color"))
+	reset.ConnectToggled(func() {
+		chooser.SetSensitive(!reset.Active())
+	})
+
+	if color := message.RoomAccent(ctx, r.ID); color != nil {
+		chooser.SetRGBA(color)
+	} else {
+		reset.SetActive(true)
+	}
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(chooser)
+	box.Append(reset)
+	accentDialog(box)
+
+	dialog := dialogs.NewLocalize(ctx, "Discard", "Save")
+	dialog.SetChild(box)
+	dialog.SetTitle(locale.Sprintf(ctx, "Accent Color of %s", r.Name))
+	dialog.BindCancelClose()
+
+	dialog.OK.ConnectClicked(func() {
+		dialog.Close()
+		if reset.Active() {
+			message.SetRoomAccent(ctx, r.ID, nil)
+		} else {
+			message.SetRoomAccent(ctx, r.ID, chooser.RGBA())
+		}
+	})
+
+	dialog.Show()
+}
+
 var cleaner = strings.NewReplacer(
 	"\n", " ",
 	"\n\n", "\n",
@@ -3,7 +3,6 @@ package room
 import (
 	"context"
 
-	"github.com/diamondburned/gotk4/pkg/core/glib"
 	"github.com/diamondburned/gotkit/gtkutil"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
 	"github.com/diamondburned/gotktrix/internal/registry"
@@ -122,17 +121,19 @@ func (s *State) InvalidateName(ctx context.Context) {
 		return
 	}
 
-	go func() {
+	gtkutil.Async(ctx, func() func() {
 		n, err := client.RoomName(s.ID)
-		if err == nil {
-			glib.IdleAdd(func() {
-				if s.Name != n {
-					s.Name = n
-					s.handlers.Name.invoke(ctx, *s)
-				}
-			})
+		if err != nil {
+			return nil
 		}
-	}()
+
+		return func() {
+			if s.Name != n {
+				s.Name = n
+				s.handlers.Name.invoke(ctx, *s)
+			}
+		}
+	})
 }
 
 // InvalidateTopic invalidates the room's name and refetches them from the state
@@ -164,10 +165,10 @@ func (s *State) InvalidateAvatar(ctx context.Context) {
 		return
 	}
 
-	go func() {
+	gtkutil.Async(ctx, func() func() {
 		mxc, _ := client.RoomAvatar(s.ID)
-		glib.IdleAdd(func() { s.setAvatar(ctx, mxc) })
-	}()
+		return func() { s.setAvatar(ctx, mxc) }
+	})
 }
 
 func (s *State) setAvatar(ctx context.Context, mxc *matrix.URL) {
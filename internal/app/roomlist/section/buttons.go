@@ -2,10 +2,12 @@ package section
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotkit/app/locale"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
 )
 
 var iconButtonCSS = cssutil.Applier("roomlist-iconbutton", `
@@ -38,13 +40,86 @@ var iconButtonCSS = cssutil.Applier("roomlist-iconbutton", `
 	}
 `)
 
+var countBadgeCSS = cssutil.Applier("roomlist-badge", `
+	.roomlist-badge {
+		margin-right: 6px;
+	}
+	.roomlist-badge label {
+		font-size: 0.8em;
+		font-weight: bold;
+		min-width: 1em;
+		padding: 0 5px;
+		margin-left: 4px;
+		border-radius: 99px;
+	}
+	.roomlist-badge-unread {
+		background-color: alpha(@theme_fg_color, 0.15);
+	}
+	.roomlist-badge-mentions {
+		color: @theme_selected_fg_color;
+		/* See message/message.go @ messageCSS. */
+		background-color: @highlighted_message;
+	}
+`)
+
+// countBadge shows the total unread notification and mention counts of a set
+// of rooms.
+type countBadge struct {
+	*gtk.Box
+	ctx      context.Context
+	unread   *gtk.Label
+	mentions *gtk.Label
+}
+
+func newCountBadge(ctx context.Context) *countBadge {
+	unread := gtk.NewLabel("")
+	unread.AddCSSClass("roomlist-badge-unread")
+	unread.Hide()
+
+	mentions := gtk.NewLabel("")
+	mentions.AddCSSClass("roomlist-badge-mentions")
+	mentions.Hide()
+
+	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	box.SetVAlign(gtk.AlignCenter)
+	box.Append(unread)
+	box.Append(mentions)
+	countBadgeCSS(box)
+
+	return &countBadge{
+		Box:      box,
+		ctx:      ctx,
+		unread:   unread,
+		mentions: mentions,
+	}
+}
+
+// SetCount updates the badge to show the given counts. The badge is hidden if
+// there is nothing to show.
+func (b *countBadge) SetCount(count m.NotificationCount) {
+	b.unread.SetVisible(count.Notification > 0)
+	b.unread.SetText(strconv.Itoa(count.Notification))
+	b.mentions.SetVisible(count.Highlight > 0)
+	b.mentions.SetText("@" + strconv.Itoa(count.Highlight))
+
+	b.SetTooltipText(locale.Sprintf(b.ctx,
+		"%d unread notifications, %d mentions", count.Notification, count.Highlight))
+}
+
+// addCount adds src to dst.
+func addCount(dst *m.NotificationCount, src m.NotificationCount) {
+	dst.Notification += src.Notification
+	dst.Highlight += src.Highlight
+}
+
 type iconButton struct {
 	*gtk.ToggleButton
 	icon  *gtk.Image
 	label *gtk.Label
+	badge *countBadge
 }
 
-func newIconButton(name, icon string) *iconButton {
+func newIconButton(ctx context.Context, name, icon string) *iconButton {
 	arrow := gtk.NewImageFromIconName(icon)
 	arrow.SetPixelSize(16)
 
@@ -52,9 +127,12 @@ func newIconButton(name, icon string) *iconButton {
 	label.SetHExpand(true)
 	label.SetXAlign(0)
 
+	badge := newCountBadge(ctx)
+
 	box := gtk.NewBox(gtk.OrientationHorizontal, 0)
 	box.Append(arrow)
 	box.Append(label)
+	box.Append(badge)
 
 	button := gtk.NewToggleButton()
 	button.SetChild(box)
@@ -64,11 +142,12 @@ func newIconButton(name, icon string) *iconButton {
 		ToggleButton: button,
 		icon:         arrow,
 		label:        label,
+		badge:        badge,
 	}
 }
 
-func newRevealButton(rev *gtk.Revealer, name string) *iconButton {
-	button := newIconButton(name, revealIconName(rev.RevealChild()))
+func newRevealButton(ctx context.Context, rev *gtk.Revealer, name string) *iconButton {
+	button := newIconButton(ctx, name, revealIconName(rev.RevealChild()))
 	button.SetActive(rev.RevealChild())
 	button.AddCSSClass("roomlist-expand")
 
@@ -94,12 +173,13 @@ const cannotMinify = -1
 
 type minifyButton struct {
 	iconButton
-	ctx   context.Context
-	nFunc func() int
+	ctx       context.Context
+	nFunc     func() int
+	countFunc func() m.NotificationCount
 }
 
 func newMinifyButton(ctx context.Context, minify bool) *minifyButton {
-	button := newIconButton("", minifyIconName(minify))
+	button := newIconButton(ctx, "", minifyIconName(minify))
 	button.SetActive(!minify)
 	button.AddCSSClass("roomlist-showmore")
 
@@ -107,6 +187,7 @@ func newMinifyButton(ctx context.Context, minify bool) *minifyButton {
 		*button,
 		ctx,
 		func() int { return 0 },
+		func() m.NotificationCount { return m.NotificationCount{} },
 	}
 }
 
@@ -130,6 +211,12 @@ func (b *minifyButton) SetFunc(f func() (nHidden int)) {
 	b.nFunc = f
 }
 
+// SetCountFunc sets the function that returns the total notification counts of
+// the hidden rooms.
+func (b *minifyButton) SetCountFunc(f func() m.NotificationCount) {
+	b.countFunc = f
+}
+
 func (b *minifyButton) Invalidate() {
 	minified := b.IsMinified()
 	nHidden := b.nFunc()
@@ -142,9 +229,14 @@ func (b *minifyButton) Invalidate() {
 	b.Show()
 
 	if minified {
+		if nHidden > nPage {
+			nHidden = nPage
+		}
 		b.label.SetLabel(locale.Sprintf(b.ctx, "Show %d more", nHidden))
+		b.badge.SetCount(b.countFunc())
 	} else {
 		b.label.SetLabel(locale.S(b.ctx, "Show less"))
+		b.badge.SetCount(m.NotificationCount{})
 	}
 	b.icon.SetFromIconName(minifyIconName(minified))
 }
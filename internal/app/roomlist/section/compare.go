@@ -15,6 +15,31 @@ const (
 	SortActivity
 )
 
+// String returns the name of the sort mode as it's saved.
+func (m SortMode) String() string {
+	switch m {
+	case SortName:
+		return "name"
+	case SortActivity:
+		return "activity"
+	default:
+		return ""
+	}
+}
+
+// ParseSortMode parses the name returned by SortMode.String. False is returned
+// if the name is unknown.
+func ParseSortMode(name string) (SortMode, bool) {
+	switch name {
+	case "name":
+		return SortName, true
+	case "activity":
+		return SortActivity, true
+	default:
+		return 0, false
+	}
+}
+
 // Comparer partially implements sort.Interface: it provides a Less function
 // that Sorter can easily build upon, but exposed for other uses.
 type Comparer struct {
@@ -126,6 +151,16 @@ func (c *Comparer) roomTimestamp(id matrix.RoomID) int64 {
 	return ts
 }
 
+// lastActivity returns the timestamp of the latest event in the room, or 0 if
+// the room has no events. Unlike roomTimestamp, it is not cached.
+func (c *Comparer) lastActivity(id matrix.RoomID) matrix.Timestamp {
+	found, _ := c.client.State.LatestInTimeline(id, "")
+	if found == nil {
+		return 0
+	}
+	return found.RoomInfo().OriginServerTime
+}
+
 func (c *Comparer) roomName(id matrix.RoomID) string {
 	if v, ok := c.roomData[id]; ok {
 		s, _ := v.(string)
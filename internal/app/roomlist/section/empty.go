@@ -0,0 +1,64 @@
+package section
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var emptyStateCSS = cssutil.Applier("roomlist-emptystate", `
+	.roomlist-emptystate {
+		padding: 4px 8px;
+	}
+	.roomlist-emptystate > label {
+		color: alpha(@theme_fg_color, 0.75);
+		font-size: 0.9em;
+		margin-bottom: 4px;
+	}
+	.roomlist-emptystate button {
+		margin: 2px 0;
+	}
+`)
+
+// newEmptyState creates the placeholder widget that is shown when the section
+// with the given tag has no rooms. Nil is returned if the section should just
+// be hidden instead.
+func newEmptyState(ctx context.Context, tag matrix.TagName) gtk.Widgetter {
+	var desc string
+	var actions [][2]string
+
+	switch tag {
+	case DMSection:
+		desc = locale.S(ctx, "You have no direct messages yet.")
+		actions = [][2]string{
+			{locale.S(ctx, "Start a Chat"), "win.start-chat"},
+		}
+	case RoomsSection:
+		desc = locale.S(ctx, "You haven't joined any rooms yet.")
+		actions = [][2]string{
+			{locale.S(ctx, "Explore Rooms"), "win.explore-rooms"},
+			{locale.S(ctx, "Create Room"), "win.create-room"},
+		}
+	default:
+		return nil
+	}
+
+	label := gtk.NewLabel(desc)
+	label.SetXAlign(0)
+	label.SetWrap(true)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(label)
+	emptyStateCSS(box)
+
+	for _, action := range actions {
+		button := gtk.NewButtonWithLabel(action[0])
+		button.SetActionName(action[1])
+		box.Append(button)
+	}
+
+	return box
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"sort"
+	"time"
 
 	"github.com/diamondburned/gotk4/pkg/core/glib"
 	"github.com/diamondburned/gotk4/pkg/gdk/v4"
@@ -15,7 +16,9 @@ import (
 	"github.com/diamondburned/gotkit/gtkutil"
 	"github.com/diamondburned/gotkit/gtkutil/textutil"
 	"github.com/diamondburned/gotktrix/internal/app/roomlist/room"
+	"github.com/diamondburned/gotktrix/internal/app/settingsync"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
 	"github.com/diamondburned/gotktrix/internal/sortutil"
 	"github.com/diamondburned/gotrix/matrix"
 )
@@ -26,6 +29,23 @@ var messageOnly = prefs.NewBool(false, prefs.PropMeta{
 	Description: "Only sort rooms when there are new messages instead of any events.",
 })
 
+var hideInactive = prefs.NewBool(false, prefs.PropMeta{
+	Name:    "Hide Inactive Sections",
+	Section: "Rooms",
+	Description: "Hide sections that have no rooms or whose rooms have all " +
+		"been inactive for a while. Hidden sections can still be shown " +
+		"from the bottom of the room list.",
+})
+
+var inactiveDays = prefs.NewInt(30, prefs.IntMeta{
+	Name:    "Inactive Section Days",
+	Section: "Rooms",
+	Description: "The number of days without any activity in its rooms " +
+		"after which a section is considered inactive.",
+	Min: 1,
+	Max: 365,
+})
+
 // SortSections sorts the given list of sections in a user-friendly way.
 func SortSections(sections []*Section) {
 	sort.Slice(sections, func(i, j int) bool {
@@ -43,6 +63,20 @@ func lessTag(isect, jsect *Section) bool {
 		return sortutil.LessFold(isect.tagName, jsect.tagName)
 	}
 
+	// Unread mentions go above everything else, followed by the recent rooms.
+	if itag == MentionsSection {
+		return true
+	}
+	if jtag == MentionsSection {
+		return false
+	}
+	if itag == RecentSection {
+		return true
+	}
+	if jtag == RecentSection {
+		return false
+	}
+
 	// User tags always go in front.
 	if itag.HasNamespace("u") {
 		return true
@@ -75,6 +109,7 @@ func lessTag(isect, jsect *Section) bool {
 type Controller interface {
 	OpenRoom(matrix.RoomID)
 	OpenRoomInTab(matrix.RoomID)
+	OpenRoomInSplit(matrix.RoomID)
 
 	// RoomIsVisible returns true if the given room should be visible.
 	RoomIsVisible(matrix.RoomID) bool
@@ -92,9 +127,22 @@ type Controller interface {
 	// MoveRoomToTag moves the room with the given ID to the given tag name. A
 	// new section must be created if needed.
 	MoveRoomToTag(src matrix.RoomID, tag matrix.TagName) bool
+	// InvalidateHiddenSections is called when the section is hidden or shown
+	// because of its inactivity.
+	InvalidateHiddenSections()
 }
 
-const nMinified = 8
+const (
+	// nMinified is the number of rooms shown when the section is minified.
+	nMinified = 8
+	// nPage is the number of rooms revealed every time the user clicks the
+	// "Show more" button.
+	nPage = 10
+)
+
+// expandedDepth is the depth saved into the config when the section is fully
+// expanded.
+const expandedDepth = -1
 
 // Section is a room section, such as People or Favorites.
 type Section struct {
@@ -102,6 +150,7 @@ type Section struct {
 	ctx  context.Context
 	ctrl Controller
 
+	header  *iconButton
 	listBox *gtk.ListBox
 	minify  *minifyButton
 
@@ -110,9 +159,23 @@ type Section struct {
 
 	comparer Comparer
 
+	// depth is the number of rooms shown when the section is minified. It
+	// grows by nPage every time the user asks for more rooms.
+	depth    int
+	depthCfg *kvstate.Config
+
 	selected *room.Room
 	tagName  string
 
+	// hasEmpty is true if the section shows a placeholder instead of hiding
+	// itself when it has no rooms.
+	hasEmpty bool
+
+	// hiddenInactive is true if the section is hidden because it's inactive.
+	// showInactive is true if the user has chosen to show it anyway.
+	hiddenInactive bool
+	showInactive   bool
+
 	// filtered is true if we're currently filtering out any rooms, either
 	// because we're searching or we're displaying a space. This causes the
 	// minifier to not work, because we don't keep track of filtered rooms.
@@ -126,6 +189,10 @@ func acquireConfig(ctx context.Context, uID matrix.UserID) *kvstate.Config {
 	return kvstate.AcquireConfig(ctx, "sections", gotktrix.Base64UserID(uID), "state.json")
 }
 
+func acquireDepthConfig(ctx context.Context, uID matrix.UserID) *kvstate.Config {
+	return kvstate.AcquireConfig(ctx, "sections", gotktrix.Base64UserID(uID), "depth.json")
+}
+
 // New creates a new deactivated section.
 func New(ctx context.Context, ctrl Controller, tag matrix.TagName) *Section {
 	list := gtk.NewListBox()
@@ -136,16 +203,26 @@ func New(ctx context.Context, ctrl Controller, tag matrix.TagName) *Section {
 		list.SetAdjustment(vadj)
 	}
 
-	minify := newMinifyButton(ctx, true)
+	client := gotktrix.FromContext(ctx)
+	cfg := acquireConfig(ctx, client.UserID)
+	depthCfg := acquireDepthConfig(ctx, client.UserID)
+
+	depth := nMinified
+	if depthCfg.Get(string(tag), &depth) && depth != expandedDepth && depth < nMinified {
+		depth = nMinified
+	}
+
+	minify := newMinifyButton(ctx, depth != expandedDepth)
 	minify.Hide()
 
+	if depth == expandedDepth {
+		depth = nMinified
+	}
+
 	inner := gtk.NewBox(gtk.OrientationVertical, 0)
 	inner.Append(list)
 	inner.Append(minify)
 
-	client := gotktrix.FromContext(ctx)
-	cfg := acquireConfig(ctx, client.UserID)
-
 	var reveal bool
 	if !cfg.Get(string(tag), &reveal) {
 		reveal = true
@@ -165,7 +242,7 @@ func New(ctx context.Context, ctrl Controller, tag matrix.TagName) *Section {
 
 	name := TagName(ctx, tag)
 
-	btn := newRevealButton(rev, name)
+	btn := newRevealButton(ctx, rev, name)
 	btn.SetHasFrame(false)
 
 	box := gtk.NewBox(gtk.OrientationVertical, 0)
@@ -174,14 +251,22 @@ func New(ctx context.Context, ctrl Controller, tag matrix.TagName) *Section {
 	box.SetVisible(false)
 
 	s := Section{
-		Box:     box,
-		ctx:     ctx,
-		ctrl:    ctrl,
-		minify:  minify,
-		rooms:   make(map[matrix.RoomID]*room.Room),
-		hidden:  make(map[*room.Room]struct{}),
-		listBox: list,
-		tagName: name,
+		Box:      box,
+		ctx:      ctx,
+		ctrl:     ctrl,
+		header:   btn,
+		minify:   minify,
+		depth:    depth,
+		depthCfg: depthCfg,
+		rooms:    make(map[matrix.RoomID]*room.Room),
+		hidden:   make(map[*room.Room]struct{}),
+		listBox:  list,
+		tagName:  name,
+	}
+
+	if empty := newEmptyState(ctx, tag); empty != nil {
+		list.SetPlaceholder(empty)
+		s.hasEmpty = true
 	}
 
 	gtkutil.BindActionMap(btn, map[string]func(){
@@ -209,11 +294,20 @@ func New(ctx context.Context, ctrl Controller, tag matrix.TagName) *Section {
 		}
 		return s.NHidden()
 	})
+	minify.SetCountFunc(func() m.NotificationCount {
+		var count m.NotificationCount
+		for room := range s.hidden {
+			addCount(&count, room.Notifications())
+		}
+		return count
+	})
 	minify.ConnectClicked(func() {
+		// The toggle button has already flipped its state by now, so a
+		// minified button means the user clicked "Show less".
 		if minify.IsMinified() {
-			s.Minimize()
+			s.ShowLess()
 		} else {
-			s.Expand()
+			s.ShowMore()
 		}
 	})
 
@@ -221,7 +315,14 @@ func New(ctx context.Context, ctrl Controller, tag matrix.TagName) *Section {
 		ctrl.OpenRoom(matrix.RoomID(row.Name()))
 	})
 
-	s.comparer = *NewComparer(client.Offline(), SortActivity, tag)
+	sortMode := SortActivity
+	if name, ok := settingsync.SortMode(ctx, tag); ok {
+		if mode, ok := ParseSortMode(name); ok {
+			sortMode = mode
+		}
+	}
+
+	s.comparer = *NewComparer(client.Offline(), sortMode, tag)
 
 	s.listBox.SetSortFunc(func(i, j *gtk.ListBoxRow) int {
 		return s.comparer.Compare(matrix.RoomID(i.Name()), matrix.RoomID(j.Name()))
@@ -252,6 +353,12 @@ func New(ctx context.Context, ctrl Controller, tag matrix.TagName) *Section {
 	// Re-sort if this is changed.
 	messageOnly.SubscribeWidget(s, func() { s.InvalidateSort() })
 
+	hideInactive.SubscribeWidget(s, s.invalidateVisibility)
+	inactiveDays.SubscribeWidget(s, s.invalidateVisibility)
+
+	s.invalidateVisibility()
+	s.invalidateCount()
+
 	return &s
 }
 
@@ -270,6 +377,11 @@ func (s *Section) Tag() matrix.TagName {
 	return s.comparer.Tag
 }
 
+// Name returns the section's name as shown to the user.
+func (s *Section) Name() string {
+	return s.tagName
+}
+
 func (s *Section) sortByBox() gtk.Widgetter {
 	header := gtk.NewLabel(locale.S(s.ctx, "Sort by"))
 	header.SetXAlign(0)
@@ -295,12 +407,13 @@ func (s *Section) sortByBox() gtk.Widgetter {
 	b := gtk.NewBox(gtk.OrientationVertical, 0)
 	b.Append(header)
 	b.Append(gtkutil.NewRadioButtons(radio, func(i int) {
-		switch i {
-		case 0:
-			s.SetSortMode(SortName)
-		case 1:
-			s.SetSortMode(SortActivity)
+		mode := SortActivity
+		if i == 0 {
+			mode = SortName
 		}
+
+		s.SetSortMode(mode)
+		settingsync.SetSortMode(s.ctx, s.Tag(), mode.String())
 	}))
 
 	return b
@@ -312,6 +425,9 @@ func (s *Section) OpenRoom(id matrix.RoomID) { s.ctrl.OpenRoom(id) }
 // OpenRoomInTab calls the parent controller's.
 func (s *Section) OpenRoomInTab(id matrix.RoomID) { s.ctrl.OpenRoomInTab(id) }
 
+// OpenRoomInSplit calls the parent controller's.
+func (s *Section) OpenRoomInSplit(id matrix.RoomID) { s.ctrl.OpenRoomInSplit(id) }
+
 // MoveRoomToTag calls the parent controller's.
 func (s *Section) MoveRoomToTag(src matrix.RoomID, tag matrix.TagName) bool {
 	return s.ctrl.MoveRoomToTag(src, tag)
@@ -352,6 +468,12 @@ func (s *Section) Select(id matrix.RoomID) {
 	s.listBox.SelectRow(rm.ListBoxRow)
 }
 
+// NRooms returns the number of rooms in the section, including the filtered
+// ones.
+func (s *Section) NRooms() int {
+	return len(s.rooms)
+}
+
 // HasRoom returns true if the section contains the given room.
 func (s *Section) HasRoom(id matrix.RoomID) bool {
 	_, ok := s.rooms[id]
@@ -371,12 +493,13 @@ func (s *Section) Insert(room *room.Room) {
 	s.rooms[room.ID] = room
 	delete(s.hidden, room)
 
-	if len(s.rooms) > nMinified && s.minify.IsMinified() {
+	if len(s.rooms) > s.depth && s.minify.IsMinified() {
 		s.Minimize()
 		s.minify.Invalidate()
 	}
 
 	s.invalidateVisibility()
+	s.invalidateCount()
 }
 
 // Remove removes the given room from the list.
@@ -392,6 +515,7 @@ func (s *Section) Remove(room *room.Room) {
 	s.Reminify()
 
 	s.invalidateVisibility()
+	s.invalidateCount()
 }
 
 // Changed reorders the given room specifically.
@@ -399,6 +523,7 @@ func (s *Section) Changed(room *room.Room) {
 	s.comparer.InvalidateRoomCache()
 	s.ReminifyAfter(func() { room.ListBoxRow.Changed() })
 	s.invalidateVisibility()
+	s.invalidateCount()
 }
 
 // InvalidateSort invalidates the section's sort. This should be called if any
@@ -416,14 +541,65 @@ func (s *Section) InvalidateFilter() {
 }
 
 func (s *Section) invalidateVisibility() {
+	// Hide the section if it has no visible room, unless the section has no
+	// rooms at all and can show its empty state.
+	visible := s.hasEmpty && len(s.rooms) == 0 && !s.ctrl.IsSearching()
 	for _, room := range s.rooms {
 		if room.Visible() {
-			s.SetVisible(true)
-			return
+			visible = true
+			break
+		}
+	}
+
+	inactive := visible && s.isInactive()
+	s.SetVisible(visible && !inactive)
+
+	if s.hiddenInactive != inactive {
+		s.hiddenInactive = inactive
+		s.ctrl.InvalidateHiddenSections()
+	}
+}
+
+// isInactive returns true if the section should be hidden because it has no
+// rooms or none of its rooms have had any activity recently.
+func (s *Section) isInactive() bool {
+	if !hideInactive.Value() || s.showInactive || s.ctrl.IsSearching() {
+		return false
+	}
+
+	days := time.Duration(inactiveDays.Value())
+	since := time.Now().Add(-days * 24 * time.Hour)
+
+	for id := range s.rooms {
+		if s.comparer.lastActivity(id).Time().After(since) {
+			return false
 		}
 	}
-	// No visible room, so hide it.
-	s.SetVisible(false)
+
+	return true
+}
+
+// IsHiddenInactive returns true if the section is hidden because it's
+// inactive.
+func (s *Section) IsHiddenInactive() bool {
+	return s.hiddenInactive
+}
+
+// ShowInactive shows the section even if it's inactive.
+func (s *Section) ShowInactive() {
+	s.showInactive = true
+	s.invalidateVisibility()
+}
+
+// invalidateCount updates the header's badge with the total notification
+// counts of all rooms in the section, so that a collapsed section still shows
+// its activity.
+func (s *Section) invalidateCount() {
+	var count m.NotificationCount
+	for _, room := range s.rooms {
+		addCount(&count, room.Notifications())
+	}
+	s.header.badge.SetCount(count)
 }
 
 // Reminify restores the minified state.
@@ -435,7 +611,7 @@ func (s *Section) Reminify() {
 // section is not minified, then after is executed immediately. If after is nil,
 // then it does the same thing as Reminify does.
 func (s *Section) ReminifyAfter(after func()) {
-	if !s.minify.IsMinified() || len(s.rooms) < nMinified {
+	if !s.minify.IsMinified() || len(s.rooms) < s.depth {
 		if after != nil {
 			after()
 		}
@@ -463,16 +639,17 @@ func (s *Section) NHidden() int {
 	return len(s.hidden)
 }
 
-// Minimize minimizes the section to only show 8 entries.
+// Minimize minimizes the section to only show as many entries as its current
+// depth, which is 8 entries unless the user has asked for more.
 func (s *Section) Minimize() {
 	s.minify.SetMinified(true)
 
-	if len(s.rooms) < nMinified {
+	if len(s.rooms) < s.depth {
 		return
 	}
 
 	// Remove the rooms in backwards order so the list doesn't cascade back.
-	for i := len(s.rooms) - 1; i >= nMinified; i-- {
+	for i := len(s.rooms) - 1; i >= s.depth; i-- {
 		row := s.listBox.RowAtIndex(i)
 		if row == nil {
 			// This shouldn't happen.
@@ -512,6 +689,29 @@ func (s *Section) Expand() {
 	s.minify.SetMinified(false)
 	s.expand()
 	s.minify.Invalidate()
+	s.depthCfg.Set(string(s.Tag()), expandedDepth)
+}
+
+// ShowMore reveals the next page of hidden rooms. If there are no more rooms
+// to be revealed after this, then the section is fully expanded.
+func (s *Section) ShowMore() {
+	s.depth += nPage
+	if s.depth >= len(s.rooms) {
+		s.Expand()
+		return
+	}
+
+	s.expand()
+	s.Minimize()
+	s.depthCfg.Set(string(s.Tag()), s.depth)
+}
+
+// ShowLess minimizes the section back to its initial number of rooms.
+func (s *Section) ShowLess() {
+	s.depth = nMinified
+	s.expand()
+	s.Minimize()
+	s.depthCfg.Set(string(s.Tag()), nil)
 }
 
 func (s *Section) expand() {
@@ -27,8 +27,34 @@ const (
 
 	DMSection    matrix.TagName = InternalTagNamespace + ".dm_section"
 	RoomsSection matrix.TagName = InternalTagNamespace + ".rooms_section"
+	// RecentSection is the section that shows the most recently active rooms
+	// regardless of their tags. Its rooms are also in their own sections.
+	RecentSection matrix.TagName = InternalTagNamespace + ".recent_section"
+	// MentionsSection is the section that shows the rooms with unread
+	// highlights. Its rooms are also in their own sections.
+	MentionsSection matrix.TagName = InternalTagNamespace + ".mentions_section"
 )
 
+// SpaceSectionPrefix is the prefix of the pseudo tags of the sections that hold
+// the rooms of a subspace while a space is shown. The subspace's room ID comes
+// after it.
+const SpaceSectionPrefix = InternalTagNamespace + ".space."
+
+// SpaceSection returns the pseudo tag of the section that holds the rooms of
+// the given subspace.
+func SpaceSection(spaceID matrix.RoomID) matrix.TagName {
+	return matrix.TagName(SpaceSectionPrefix + string(spaceID))
+}
+
+// SectionSpace returns the subspace of the given pseudo tag returned by
+// SpaceSection, or an empty string if the tag isn't one.
+func SectionSpace(name matrix.TagName) matrix.RoomID {
+	if !strings.HasPrefix(string(name), SpaceSectionPrefix) {
+		return ""
+	}
+	return matrix.RoomID(strings.TrimPrefix(string(name), SpaceSectionPrefix))
+}
+
 // TagIsIntern returns true if the given tag is a Matrix tag or a tag that
 // belongs only to us.
 func TagIsIntern(name matrix.TagName) bool {
@@ -60,6 +86,18 @@ func TagName(ctx context.Context, name matrix.TagName) string {
 		return p.Sprint("People")
 	case RoomsSection:
 		return p.Sprint("Rooms")
+	case RecentSection:
+		return p.Sprint("Recent")
+	case MentionsSection:
+		return p.Sprint("Mentions")
+	}
+
+	if spaceID := SectionSpace(name); spaceID != "" {
+		client := gotktrix.FromContext(ctx).Offline()
+		if name, err := client.RoomName(spaceID); err == nil {
+			return name
+		}
+		return string(spaceID)
 	}
 
 	return string(name)
@@ -72,6 +110,9 @@ func TagNamespace(name matrix.TagName) string {
 		return "m"
 	case name.HasNamespace("u"):
 		return "u"
+	case SectionSpace(name) != "":
+		// Sort the subspaces by their names.
+		return SpaceSectionPrefix
 	default:
 		return string(name)
 	}
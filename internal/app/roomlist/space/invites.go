@@ -0,0 +1,219 @@
+package space
+
+import (
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/onlineimage"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/textutil"
+	"github.com/diamondburned/gotktrix/internal/app/roomlist/room"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var invitesCSS = cssutil.Applier("space-invites", `
+	.space-invites {
+		margin-bottom: 8px;
+	}
+	.space-invites-header {
+		margin: 4px 8px;
+	}
+	.space-invite {
+		padding: 4px 8px;
+	}
+	.space-invite-avatar {
+		margin-right: 8px;
+	}
+	.space-invite-inviter {
+		font-size: 0.9em;
+		color: alpha(@theme_fg_color, 0.75);
+	}
+	.space-invite-buttons {
+		margin-top: 4px;
+	}
+`)
+
+// invitesState holds the Invites section, which lists the rooms that the user
+// is invited to. Unlike the other sections, its rows aren't rooms that can be
+// opened, since the rooms can't be read before they're joined.
+type invitesState struct {
+	*gtk.Box
+	list *gtk.Box
+	rows map[matrix.RoomID]*gtk.Box
+	// queued is true if invalidateInvites is already queued to run.
+	queued bool
+}
+
+func (l *List) bindInvites() {
+	header := gtk.NewLabel(locale.S(l.ctx, "Invites"))
+	header.AddCSSClass("space-invites-header")
+	header.SetXAlign(0)
+	header.SetAttributes(textutil.Attrs(
+		pango.NewAttrWeight(pango.WeightBold),
+	))
+
+	l.invites.list = gtk.NewBox(gtk.OrientationVertical, 0)
+	l.invites.rows = make(map[matrix.RoomID]*gtk.Box)
+
+	l.invites.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+	l.invites.Append(header)
+	l.invites.Append(l.invites.list)
+	l.invites.Hide()
+	invitesCSS(l.invites)
+
+	client := gotktrix.FromContext(l.ctx)
+
+	gtkutil.BindSubscribe(l, func() func() {
+		return client.OnSync(func(*api.SyncResponse) {
+			glib.IdleAdd(l.queueInvites)
+		})
+	})
+
+	l.queueInvites()
+}
+
+// queueInvites invalidates the Invites section once the main loop is idle.
+func (l *List) queueInvites() {
+	if l.invites.queued {
+		return
+	}
+
+	l.invites.queued = true
+	glib.IdleAdd(func() {
+		l.invites.queued = false
+		l.invalidateInvites()
+	})
+}
+
+// invalidateInvites updates the Invites section to have the user's pending
+// invites. Invites are shown regardless of the shown space, since the rooms
+// aren't known to be in any space yet.
+func (l *List) invalidateInvites() {
+	client := gotktrix.FromContext(l.ctx).Offline()
+
+	gtkutil.Async(l.ctx, func() func() {
+		invites := client.RoomInvites()
+		return func() { l.setInvites(invites) }
+	})
+}
+
+func (l *List) setInvites(invites []gotktrix.RoomInvite) {
+	invited := make(map[matrix.RoomID]bool, len(invites))
+	for _, invite := range invites {
+		invited[invite.RoomID] = true
+	}
+
+	for id, row := range l.invites.rows {
+		if !invited[id] {
+			l.invites.list.Remove(row)
+			delete(l.invites.rows, id)
+		}
+	}
+
+	// Rebuild the order of the rows, since the invites are sorted newest first.
+	for _, invite := range invites {
+		row, ok := l.invites.rows[invite.RoomID]
+		if ok {
+			l.invites.list.Remove(row)
+		} else {
+			row = l.newInviteRow(invite)
+			l.invites.rows[invite.RoomID] = row
+		}
+		l.invites.list.Append(row)
+	}
+
+	l.invites.SetVisible(len(l.invites.rows) > 0)
+}
+
+func (l *List) newInviteRow(invite gotktrix.RoomInvite) *gtk.Box {
+	avatar := onlineimage.NewAvatar(l.ctx, gotktrix.AvatarProvider, room.AvatarSize)
+	avatar.AddCSSClass("space-invite-avatar")
+	avatar.SetVAlign(gtk.AlignStart)
+	avatar.SetName(invite.Name)
+	avatar.SetFromURL(string(invite.Avatar))
+
+	name := gtk.NewLabel(invite.Name)
+	name.SetXAlign(0)
+	name.SetEllipsize(pango.EllipsizeEnd)
+	name.SetTooltipText(invite.Name)
+
+	inviter := gtk.NewLabel("")
+	inviter.AddCSSClass("space-invite-inviter")
+	inviter.SetXAlign(0)
+	inviter.SetEllipsize(pango.EllipsizeEnd)
+	if invite.InviterName != "" {
+		inviter.SetText(locale.Sprintf(l.ctx, "Invited by %s", invite.InviterName))
+		inviter.SetTooltipText(string(invite.Inviter))
+	} else {
+		inviter.Hide()
+	}
+
+	accept := gtk.NewButtonWithLabel(locale.S(l.ctx, "Accept"))
+	accept.AddCSSClass("suggested-action")
+	accept.SetHExpand(true)
+
+	decline := gtk.NewButtonWithLabel(locale.S(l.ctx, "Decline"))
+	decline.SetHExpand(true)
+
+	buttons := gtk.NewBox(gtk.OrientationHorizontal, 4)
+	buttons.AddCSSClass("space-invite-buttons")
+	buttons.SetHomogeneous(true)
+	buttons.Append(decline)
+	buttons.Append(accept)
+
+	right := gtk.NewBox(gtk.OrientationVertical, 0)
+	right.SetHExpand(true)
+	right.Append(name)
+	right.Append(inviter)
+	right.Append(buttons)
+
+	row := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	row.AddCSSClass("space-invite")
+	row.Append(avatar)
+	row.Append(right)
+
+	// answer accepts or declines the invite in the background. The row is
+	// removed once the server is done, and the joined room is opened.
+	answer := func(join bool) {
+		buttons.SetSensitive(false)
+		client := gotktrix.FromContext(l.ctx)
+
+		gtkutil.Async(l.ctx, func() func() {
+			var err error
+			if join {
+				err = client.AcceptInvite(invite)
+			} else {
+				err = client.DeclineInvite(invite.RoomID)
+			}
+
+			return func() {
+				if err != nil {
+					buttons.SetSensitive(true)
+					app.Error(l.ctx, err)
+					return
+				}
+
+				if r, ok := l.invites.rows[invite.RoomID]; ok {
+					l.invites.list.Remove(r)
+					delete(l.invites.rows, invite.RoomID)
+					l.invites.SetVisible(len(l.invites.rows) > 0)
+				}
+
+				if join {
+					l.AddRoom(invite.RoomID)
+					l.OpenRoom(invite.RoomID)
+				}
+			}
+		})
+	}
+
+	accept.ConnectClicked(func() { answer(true) })
+	decline.ConnectClicked(func() { answer(false) })
+
+	return row
+}
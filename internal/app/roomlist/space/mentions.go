@@ -0,0 +1,141 @@
+package space
+
+import (
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotktrix/internal/app/roomlist/room"
+	"github.com/diamondburned/gotktrix/internal/app/roomlist/section"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var showMentions = prefs.NewBool(true, prefs.PropMeta{
+	Name:    "Show Mentions",
+	Section: "Rooms",
+	Description: "Show a section above all others with the rooms that have " +
+		"unread mentions, regardless of their sections.",
+})
+
+// mentionsState holds the Mentions section. Like the Recent section, its rooms
+// are separate rows from the ones in l.rooms.
+type mentionsState struct {
+	section *section.Section
+	rooms   map[matrix.RoomID]*room.Room
+	// queued is true if invalidateMentions is already queued to run.
+	queued bool
+}
+
+func (l *List) bindMentions() {
+	l.mentions.rooms = make(map[matrix.RoomID]*room.Room)
+
+	client := gotktrix.FromContext(l.ctx)
+
+	// Read receipts also arrive through the sync, so this also takes care of
+	// removing rooms once their mentions are read.
+	gtkutil.BindSubscribe(l, func() func() {
+		return client.OnSync(func(*api.SyncResponse) {
+			glib.IdleAdd(l.queueMentions)
+		})
+	})
+
+	showMentions.SubscribeWidget(l, l.queueMentions)
+}
+
+// queueMentions invalidates the Mentions section once the main loop is idle,
+// so that many changes at once only invalidate it once.
+func (l *List) queueMentions() {
+	if l.mentions.queued {
+		return
+	}
+
+	l.mentions.queued = true
+	glib.IdleAdd(func() {
+		l.mentions.queued = false
+		l.invalidateMentions()
+	})
+}
+
+// invalidateMentions updates the Mentions section to have the rooms of the
+// shown space with unread highlights.
+func (l *List) invalidateMentions() {
+	if !showMentions.Value() {
+		l.removeMentions()
+		return
+	}
+
+	roomIDs := make([]matrix.RoomID, 0, len(l.rooms))
+	for id := range l.rooms {
+		if l.space.id == "" || l.space.children.has(id) {
+			roomIDs = append(roomIDs, id)
+		}
+	}
+
+	client := gotktrix.FromContext(l.ctx).Offline()
+
+	// Counting the notifications walks the timeline of every room, so do it
+	// outside the main thread.
+	gtkutil.Async(l.ctx, func() func() {
+		highlighted := make(map[matrix.RoomID]bool, len(roomIDs))
+		for _, id := range roomIDs {
+			if client.RoomCountNotifications(id).Highlight > 0 {
+				highlighted[id] = true
+			}
+		}
+
+		return func() { l.setMentions(highlighted) }
+	})
+}
+
+func (l *List) setMentions(highlighted map[matrix.RoomID]bool) {
+	// The preference might've been changed while we were counting.
+	if !showMentions.Value() {
+		return
+	}
+
+	if l.mentions.section == nil {
+		l.mentions.section = l.getOrCreateSection(section.MentionsSection)
+		l.InvalidateSections()
+	}
+
+	for id, r := range l.mentions.rooms {
+		if !highlighted[id] {
+			l.mentions.section.Remove(r)
+			delete(l.mentions.rooms, id)
+		}
+	}
+
+	for id := range highlighted {
+		if _, ok := l.mentions.rooms[id]; !ok {
+			l.mentions.rooms[id] = room.AddTo(l.ctx, l.mentions.section, id)
+		}
+	}
+
+	l.mentions.section.InvalidateSort()
+}
+
+func (l *List) removeMentions() {
+	if l.mentions.section == nil {
+		return
+	}
+
+	for id, r := range l.mentions.rooms {
+		l.mentions.section.Remove(r)
+		delete(l.mentions.rooms, id)
+	}
+
+	sections := l.sections[:0]
+	for _, s := range l.sections {
+		if s != l.mentions.section {
+			sections = append(sections, s)
+		}
+	}
+	l.sections[len(l.sections)-1] = nil
+	l.sections = sections
+
+	l.mentions.section.Unparent()
+	l.mentions.section = nil
+
+	l.InvalidateHiddenSections()
+}
@@ -0,0 +1,161 @@
+package space
+
+import (
+	"sort"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotktrix/internal/app/roomlist/room"
+	"github.com/diamondburned/gotktrix/internal/app/roomlist/section"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+var showRecent = prefs.NewBool(false, prefs.PropMeta{
+	Name:    "Show Recent Rooms",
+	Section: "Rooms",
+	Description: "Show a section above all others with the most recently " +
+		"active rooms, regardless of their sections.",
+})
+
+var recentRooms = prefs.NewInt(8, prefs.IntMeta{
+	Name:        "Recent Rooms",
+	Section:     "Rooms",
+	Description: "The number of rooms shown in the Recent section.",
+	Min:         1,
+	Max:         50,
+})
+
+// recentState holds the Recent section. Its rooms are separate rows from the
+// ones in l.rooms, since a room can only be in one section.
+type recentState struct {
+	section *section.Section
+	rooms   map[matrix.RoomID]*room.Room
+	// queued is true if invalidateRecent is already queued to run.
+	queued bool
+}
+
+func (l *List) bindRecent() {
+	l.recent.rooms = make(map[matrix.RoomID]*room.Room)
+
+	client := gotktrix.FromContext(l.ctx)
+
+	gtkutil.BindSubscribe(l, func() func() {
+		return client.OnSync(func(*api.SyncResponse) {
+			glib.IdleAdd(l.queueRecent)
+		})
+	})
+
+	showRecent.SubscribeWidget(l, l.invalidateRecent)
+	recentRooms.SubscribeWidget(l, l.invalidateRecent)
+}
+
+// RecentShown returns true if the Recent section is shown.
+func (l *List) RecentShown() bool {
+	return showRecent.Value()
+}
+
+// SetRecentShown shows or hides the Recent section.
+func (l *List) SetRecentShown(shown bool) {
+	showRecent.Publish(shown)
+}
+
+// NotifyRecentShown calls f with whether the Recent section is shown every time
+// it's shown or hidden for as long as the widget is mapped.
+func (l *List) NotifyRecentShown(widget gtk.Widgetter, f func(shown bool)) {
+	showRecent.SubscribeWidget(widget, func() { f(showRecent.Value()) })
+}
+
+// queueRecent invalidates the Recent section once the main loop is idle, so
+// that many changes at once only invalidate it once.
+func (l *List) queueRecent() {
+	if l.recent.queued {
+		return
+	}
+
+	l.recent.queued = true
+	glib.IdleAdd(func() {
+		l.recent.queued = false
+		l.invalidateRecent()
+	})
+}
+
+// invalidateRecent updates the Recent section to have the most recently active
+// rooms of the shown space.
+func (l *List) invalidateRecent() {
+	if !showRecent.Value() {
+		l.removeRecent()
+		return
+	}
+
+	if l.recent.section == nil {
+		l.recent.section = l.getOrCreateSection(section.RecentSection)
+		l.InvalidateSections()
+	}
+
+	client := gotktrix.FromContext(l.ctx).Offline()
+	comparer := section.NewComparer(client, section.SortActivity, section.RecentSection)
+
+	roomIDs := make([]matrix.RoomID, 0, len(l.rooms))
+	for id := range l.rooms {
+		if l.space.id == "" || l.space.children.has(id) {
+			roomIDs = append(roomIDs, id)
+		}
+	}
+
+	sort.Slice(roomIDs, func(i, j int) bool {
+		return comparer.Less(roomIDs[i], roomIDs[j])
+	})
+
+	if n := recentRooms.Value(); len(roomIDs) > n {
+		roomIDs = roomIDs[:n]
+	}
+
+	recent := make(map[matrix.RoomID]bool, len(roomIDs))
+	for _, id := range roomIDs {
+		recent[id] = true
+	}
+
+	for id, r := range l.recent.rooms {
+		if !recent[id] {
+			l.recent.section.Remove(r)
+			delete(l.recent.rooms, id)
+		}
+	}
+
+	for _, id := range roomIDs {
+		if _, ok := l.recent.rooms[id]; !ok {
+			l.recent.rooms[id] = room.AddTo(l.ctx, l.recent.section, id)
+		}
+	}
+
+	l.recent.section.InvalidateSort()
+}
+
+func (l *List) removeRecent() {
+	if l.recent.section == nil {
+		return
+	}
+
+	for id, r := range l.recent.rooms {
+		l.recent.section.Remove(r)
+		delete(l.recent.rooms, id)
+	}
+
+	sections := l.sections[:0]
+	for _, s := range l.sections {
+		if s != l.recent.section {
+			sections = append(sections, s)
+		}
+	}
+	l.sections[len(l.sections)-1] = nil
+	l.sections = sections
+
+	l.recent.section.Unparent()
+	l.recent.section = nil
+
+	l.InvalidateHiddenSections()
+}
@@ -35,9 +35,14 @@ type List struct {
 	inner  *gtk.Box // contains sections
 
 	sections []*section.Section
-
-	space spaceState
-	rooms map[matrix.RoomID]*room.Room
+	// hidden is the button that shows the sections hidden for inactivity.
+	hidden *gtk.Button
+
+	space    spaceState
+	rooms    map[matrix.RoomID]*room.Room
+	recent   recentState
+	mentions mentionsState
+	invites  invitesState
 }
 
 // Controller describes the controller requirement.
@@ -55,6 +60,11 @@ type RoomTabOpener interface {
 	OpenRoomInTab(matrix.RoomID)
 }
 
+// RoomSplitOpener can optionally be implemented by Application.
+type RoomSplitOpener interface {
+	OpenRoomInSplit(matrix.RoomID)
+}
+
 var listCSS = cssutil.Applier("space-list", `
 	.space-list {
 		background: @theme_base_color;
@@ -71,6 +81,11 @@ var listCSS = cssutil.Applier("space-list", `
 	.space-reorderactions button {
 		margin-left: 6px;
 	}
+	.space-hiddensections {
+		font-size: 0.9em;
+		opacity: 0.6;
+		margin: 0 6px 8px 6px;
+	}
 `)
 
 // New creates a new room list widget.
@@ -115,7 +130,22 @@ func New(ctx context.Context, ctrl Controller) *List {
 		return ctrl.ForwardTypingTo()
 	})
 
-	l.space = newSpaceState(l.InvalidateFilter)
+	l.hidden = gtk.NewButton()
+	l.hidden.AddCSSClass("space-hiddensections")
+	l.hidden.SetHasFrame(false)
+	l.hidden.Hide()
+	l.hidden.ConnectClicked(l.popupHiddenSections)
+
+	l.space = newSpaceState(l.invalidateSpace)
+
+	// Always create the default sections, so that they can show their empty
+	// state if the user has no rooms in them.
+	l.getOrCreateSection(section.DMSection)
+	l.getOrCreateSection(section.RoomsSection)
+
+	l.bindRecent()
+	l.bindMentions()
+	l.bindInvites()
 
 	return &l
 }
@@ -133,6 +163,45 @@ func (l *List) SetSpaceID(spaceID matrix.RoomID) {
 	l.space.update(l.ctx, spaceID)
 }
 
+// invalidateSpace regroups the rooms for the shown space and invalidates the
+// filter. Rooms that are in a subspace of the shown space are moved into a
+// section of that subspace, and all other rooms go back into the section of
+// their tag.
+func (l *List) invalidateSpace() {
+	client := gotktrix.FromContext(l.ctx).Offline()
+
+	for id, room := range l.rooms {
+		tag := section.RoomTag(client, id)
+		if parent := l.space.children.parent(id); parent != "" && parent != l.space.id {
+			tag = section.SpaceSection(parent)
+		}
+
+		if sect := l.getOrCreateSection(tag); !room.IsIn(sect) {
+			room.Move(sect)
+		}
+	}
+
+	// Throw away the sections of subspaces that aren't shown anymore.
+	sections := l.sections[:0]
+	for _, s := range l.sections {
+		if section.SectionSpace(s.Tag()) != "" && s.NRooms() == 0 {
+			s.Unparent()
+			continue
+		}
+		sections = append(sections, s)
+	}
+	for i := len(sections); i < len(l.sections); i++ {
+		l.sections[i] = nil
+	}
+	l.sections = sections
+
+	l.InvalidateSections()
+	l.InvalidateHiddenSections()
+	l.InvalidateFilter()
+	l.queueRecent()
+	l.queueMentions()
+}
+
 // VAdjustment returns the list's ScrolledWindow's vertical adjustment for
 // scrolling.
 func (l *List) VAdjustment() *gtk.Adjustment {
@@ -193,6 +262,8 @@ func (l *List) AddRoom(roomID matrix.RoomID) {
 	section := l.getOrCreateSection(tagName)
 
 	l.rooms[roomID] = room.AddTo(l.ctx, section, roomID)
+	l.queueRecent()
+	l.queueMentions()
 }
 
 func (l *List) getOrCreateSection(tag matrix.TagName) *section.Section {
@@ -205,6 +276,7 @@ func (l *List) getOrCreateSection(tag matrix.TagName) *section.Section {
 	sect := section.New(l.ctx, l, tag)
 	sect.AddCSSClass("space-section")
 	l.sections = append(l.sections, sect)
+	l.InvalidateHiddenSections()
 
 	return sect
 }
@@ -216,16 +288,78 @@ func (l *List) InvalidateSections() {
 	for _, s := range l.sections {
 		s.Unparent()
 	}
+	l.hidden.Unparent()
+	l.invites.Unparent()
 
 	section.SortSections(l.sections)
 
 	l.inner = gtk.NewBox(gtk.OrientationVertical, 0)
 	l.outer.SetChild(l.inner)
 
+	// Pending invites always go above the sections.
+	l.inner.Append(l.invites)
+
 	// Insert the previous sections into the new box.
 	for _, s := range l.sections {
 		l.inner.Append(s)
 	}
+	l.inner.Append(l.hidden)
+}
+
+// InvalidateHiddenSections updates the button that shows the sections hidden
+// for inactivity.
+func (l *List) InvalidateHiddenSections() {
+	var n int
+	for _, s := range l.sections {
+		if s.IsHiddenInactive() {
+			n++
+		}
+	}
+
+	l.hidden.SetVisible(n > 0)
+	l.hidden.SetLabel(locale.Sprintf(l.ctx, "%d inactive sections hidden", n))
+}
+
+func (l *List) popupHiddenSections() {
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+
+	popover := gtk.NewPopover()
+	popover.SetSizeRequest(gtkutil.PopoverWidth, -1)
+	popover.SetPosition(gtk.PosTop)
+	popover.SetParent(l.hidden)
+	popover.SetChild(box)
+
+	for _, s := range l.sections {
+		if !s.IsHiddenInactive() {
+			continue
+		}
+
+		s := s
+
+		button := gtk.NewButtonWithLabel(s.Name())
+		button.SetHasFrame(false)
+		button.ConnectClicked(func() {
+			popover.Popdown()
+			s.ShowInactive()
+		})
+		box.Append(button)
+	}
+
+	showAll := gtk.NewButtonWithLabel(locale.S(l.ctx, "Show All"))
+	showAll.SetHasFrame(false)
+	showAll.ConnectClicked(func() {
+		popover.Popdown()
+		for _, s := range l.sections {
+			if s.IsHiddenInactive() {
+				s.ShowInactive()
+			}
+		}
+	})
+
+	box.Append(gtk.NewSeparator(gtk.OrientationHorizontal))
+	box.Append(showAll)
+
+	gtkutil.PopupFinally(popover)
 }
 
 // SetSelectedRoom sets the given room ID as the selected room row. It does not
@@ -254,6 +388,15 @@ func (l *List) OpenRoomInTab(id matrix.RoomID) {
 	}
 }
 
+// OpenRoomInSplit opens the given room beside the current one.
+func (l *List) OpenRoomInSplit(id matrix.RoomID) {
+	if opener, ok := l.ctrl.(RoomSplitOpener); ok {
+		opener.OpenRoomInSplit(id)
+	} else {
+		l.ctrl.OpenRoom(id)
+	}
+}
+
 // MoveRoomToTag moves the room to the new tag.
 func (l *List) MoveRoomToTag(src matrix.RoomID, tag matrix.TagName) bool {
 	oldOrder := -1.0
@@ -383,6 +526,16 @@ func (l *List) canMoveRoom(room *room.Room, sect *section.Section) bool {
 		return false
 	}
 
+	// Subspace sections only exist while their space is shown, and the Recent
+	// and Mentions sections only hold copies of rooms in other sections.
+	switch sect.Tag() {
+	case section.RecentSection, section.MentionsSection:
+		return false
+	}
+	if section.SectionSpace(sect.Tag()) != "" {
+		return false
+	}
+
 	isDirect := gotktrix.FromContext(l.ctx).Offline().IsDirect(room.ID)
 
 	// Moving a non-DM room to the DM section is invalid.
@@ -70,51 +70,65 @@ func (s *spaceState) update(ctx context.Context, spaceID matrix.RoomID) {
 	})
 }
 
-// spaceRooms is a set of room IDs for the purpose of tracking which rooms are
-// in a space.
-type spaceRooms map[matrix.RoomID]struct{}
+// spaceRooms maps the room IDs of the rooms in a space to the space or subspace
+// that they're directly in, for the purpose of tracking which rooms are in a
+// space.
+type spaceRooms map[matrix.RoomID]matrix.RoomID
 
 func (s spaceRooms) has(roomID matrix.RoomID) bool {
 	_, has := s[roomID]
 	return has
 }
 
+// parent returns the space or subspace that the given room is directly in.
+func (s spaceRooms) parent(roomID matrix.RoomID) matrix.RoomID {
+	return s[roomID]
+}
+
 func (s *spaceRooms) reset() {
 	*s = nil
 }
 
-// fetch populates spaceRooms with all room IDs inside a certain given space.
+// fetch populates spaceRooms with all room IDs inside a certain given space,
+// including the rooms inside its subspaces.
 func (s *spaceRooms) fetch(client *gotktrix.Client, spaceID matrix.RoomID) bool {
-	// It's fine if we use the online context here, since the events that we
-	// receive from the API will be saved into the state for the next time.
-	err1 := client.EachRoomStateLen(spaceID, m.SpaceChildEventType,
-		func(ev event.StateEvent, len int) error {
-			if *s == nil {
-				*s = make(map[matrix.RoomID]struct{}, len)
-			}
-
-			space := ev.(*m.SpaceChildEvent)
-			(*s)[space.ChildRoomID()] = struct{}{}
-			return nil
-		},
-	)
+	*s = make(map[matrix.RoomID]matrix.RoomID)
 
 	// Succumb to Matrix's terrible design: iterate over each room and determine
 	// if it's in our space or not. We can do this lazily, but we prefer not to.
-	roomIDs, err2 := client.Rooms()
-	if err2 != nil {
+	roomIDs, err := client.Rooms()
+	if err != nil {
 		return false
 	}
 
-	// At this point, *s shouldn't have been nil, but it might be if we can't
-	// find the space parent in the state because the server splurged out.
-	if *s == nil {
-		*s = make(map[matrix.RoomID]struct{})
+	visited := map[matrix.RoomID]bool{}
+	return s.fetchSpace(client, spaceID, roomIDs, visited)
+}
+
+func (s spaceRooms) fetchSpace(
+	client *gotktrix.Client, spaceID matrix.RoomID,
+	roomIDs []matrix.RoomID, visited map[matrix.RoomID]bool) bool {
+
+	// Spaces may be in each other.
+	if visited[spaceID] {
+		return true
 	}
+	visited[spaceID] = true
+
+	var children []matrix.RoomID
+
+	// It's fine if we use the online context here, since the events that we
+	// receive from the API will be saved into the state for the next time.
+	err := client.EachRoomStateLen(spaceID, m.SpaceChildEventType,
+		func(ev event.StateEvent, _ int) error {
+			space := ev.(*m.SpaceChildEvent)
+			children = append(children, space.ChildRoomID())
+			return nil
+		},
+	)
 
 	for _, roomID := range roomIDs {
-		_, ok := (*s)[roomID]
-		if ok {
+		if _, ok := s[roomID]; ok {
 			continue
 		}
 
@@ -122,10 +136,33 @@ func (s *spaceRooms) fetch(client *gotktrix.Client, spaceID matrix.RoomID) bool
 		// rooms aren't in a space, so we hit the state only.
 		e, _ := client.State.RoomState(roomID, m.SpaceParentEventType, string(spaceID))
 		if e != nil {
-			room := e.(*m.SpaceParentEvent)
-			(*s)[room.SpaceRoomID()] = struct{}{}
+			children = append(children, roomID)
 		}
 	}
 
-	return err1 == nil && err2 == nil
+	var subspaces []matrix.RoomID
+
+	for _, childID := range children {
+		if _, ok := s[childID]; ok || childID == spaceID {
+			continue
+		}
+
+		s[childID] = spaceID
+
+		// Only joined subspaces are known, so the others are just rooms that
+		// can't be shown.
+		if client.Offline().RoomType(childID) == "m.space" {
+			subspaces = append(subspaces, childID)
+		}
+	}
+
+	ok := err == nil
+
+	// Rooms that are both in this space and in a subspace stay in this space,
+	// so the subspaces are only walked after all children are known.
+	for _, subspaceID := range subspaces {
+		ok = s.fetchSpace(client, subspaceID, roomIDs, visited) && ok
+	}
+
+	return ok
 }
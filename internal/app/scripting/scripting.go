@@ -0,0 +1,403 @@
+// Package scripting exposes the running client over D-Bus so that scripts and
+// desktop tools can integrate with it.
+//
+// Each logged in account is exported on the session bus under the
+// com.github.diamondburned.gotktrix.Scripting name at
+// /com/github/diamondburned/gotktrix/accounts/<user>, where <user> is the user
+// ID with every character that isn't a letter or a digit replaced with an
+// underscore, e.g. _alice_matrix_org for @alice:matrix.org. For example:
+//
+//	gdbus call --session \
+//	    --dest com.github.diamondburned.gotktrix.Scripting \
+//	    --object-path /com/github/diamondburned/gotktrix/accounts/_alice_matrix_org \
+//	    --method com.github.diamondburned.gotktrix.Account1.SendMessage \
+//	    '!room:matrix.org' 'Hello from a script!'
+package scripting
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/pkg/errors"
+)
+
+// Enabled is a preference.
+var Enabled = prefs.NewBool(false, prefs.PropMeta{
+	Name:    "D-Bus Scripting",
+	Section: "Application",
+	Description: "Let scripts and other programs send messages, read unread " +
+		"counts and receive notifications over D-Bus. Any program running " +
+		"as you can use this.",
+})
+
+const (
+	// BusName is the well-known name that the accounts are exported under.
+	BusName = "com.github.diamondburned.gotktrix.Scripting"
+	// Interface is the D-Bus interface of each account.
+	Interface = "com.github.diamondburned.gotktrix.Account1"
+	// AccountsPath is the object path that the accounts are exported under.
+	AccountsPath dbus.ObjectPath = "/com/github/diamondburned/gotktrix/accounts"
+)
+
+var introspection = introspect.Node{
+	Interfaces: []introspect.Interface{
+		introspect.IntrospectData,
+		{
+			Name: Interface,
+			Methods: []introspect.Method{
+				{
+					Name: "UserID",
+					Args: []introspect.Arg{
+						{Name: "user_id", Type: "s", Direction: "out"},
+					},
+				},
+				{
+					Name: "SendMessage",
+					Args: []introspect.Arg{
+						{Name: "room_id", Type: "s", Direction: "in"},
+						{Name: "body", Type: "s", Direction: "in"},
+						{Name: "event_id", Type: "s", Direction: "out"},
+					},
+				},
+				{
+					Name: "UnreadCounts",
+					Args: []introspect.Arg{
+						{Name: "counts", Type: "a{s(uu)}", Direction: "out"},
+					},
+				},
+				{
+					Name: "Rooms",
+					Args: []introspect.Arg{
+						{Name: "rooms", Type: "a(ssuu)", Direction: "out"},
+					},
+				},
+			},
+			Signals: []introspect.Signal{
+				{
+					Name: "Notification",
+					Args: []introspect.Arg{
+						{Name: "room_id", Type: "s"},
+						{Name: "event_id", Type: "s"},
+						{Name: "sender", Type: "s"},
+						{Name: "sender_name", Type: "s"},
+						{Name: "body", Type: "s"},
+					},
+				},
+			},
+		},
+	},
+}
+
+// sessionBus holds the session bus connection that is shared by all accounts.
+// The well-known name is owned as long as any account is exported.
+type sessionBus struct {
+	sync.Mutex
+	conn     *dbus.Conn
+	accounts int
+}
+
+var bus sessionBus
+
+// Bind exports the client in the given context over D-Bus whenever the Enabled
+// preference is on. The returned callback unexports it and stops following the
+// preference.
+func Bind(ctx context.Context) func() {
+	client := gotktrix.FromContext(ctx)
+
+	var mu sync.Mutex
+	var stop func()
+
+	update := func() {
+		enabled := Enabled.Value()
+
+		go func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case enabled && stop == nil:
+				s, err := export(ctx, client)
+				if err != nil {
+					log.Println("cannot export D-Bus scripting interface:", err)
+					return
+				}
+				stop = s
+			case !enabled && stop != nil:
+				stop()
+				stop = nil
+			}
+		}()
+	}
+
+	update()
+	unsub := Enabled.Subscribe(update)
+
+	return func() {
+		unsub()
+
+		go func() {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if stop != nil {
+				stop()
+				stop = nil
+			}
+		}()
+	}
+}
+
+// export exports the client and starts emitting its notifications. It blocks
+// on the session bus.
+func export(ctx context.Context, client *gotktrix.Client) (func(), error) {
+	bus.Lock()
+	defer bus.Unlock()
+
+	if bus.conn == nil {
+		conn, err := dbus.SessionBus()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot connect to session bus")
+		}
+		bus.conn = conn
+	}
+
+	if bus.accounts == 0 {
+		reply, err := bus.conn.RequestName(BusName, dbus.NameFlagDoNotQueue)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot request bus name")
+		}
+		if reply != dbus.RequestNameReplyPrimaryOwner && reply != dbus.RequestNameReplyAlreadyOwner {
+			return nil, errors.Errorf("bus name %s is already taken", BusName)
+		}
+	}
+
+	path := AccountPath(client.UserID)
+	acc := &account{ctx: ctx, client: client}
+
+	if err := bus.conn.Export(acc, path, Interface); err != nil {
+		bus.releaseName()
+		return nil, errors.Wrap(err, "cannot export account")
+	}
+
+	intro := introspect.NewIntrospectable(&introspection)
+	if err := bus.conn.Export(intro, path, "org.freedesktop.DBus.Introspectable"); err != nil {
+		bus.conn.Export(nil, path, Interface)
+		bus.releaseName()
+		return nil, errors.Wrap(err, "cannot export introspection")
+	}
+
+	bus.accounts++
+	conn := bus.conn
+
+	unsub := SubscribeNotifications(client, func(n Notification) {
+		err := conn.Emit(path, Interface+".Notification",
+			n.RoomID, n.EventID, n.Sender, n.SenderName, n.Body)
+		if err != nil {
+			log.Println("cannot emit D-Bus notification:", err)
+		}
+	})
+
+	return func() {
+		unsub()
+
+		bus.Lock()
+		defer bus.Unlock()
+
+		conn.Export(nil, path, Interface)
+		conn.Export(nil, path, "org.freedesktop.DBus.Introspectable")
+
+		bus.accounts--
+		bus.releaseName()
+	}, nil
+}
+
+// releaseName releases the bus name if no accounts are exported anymore. The
+// bus must be locked.
+func (b *sessionBus) releaseName() {
+	if b.accounts == 0 {
+		b.conn.ReleaseName(BusName)
+	}
+}
+
+// AccountPath returns the object path that the account with the given user ID
+// is exported at.
+func AccountPath(userID matrix.UserID) dbus.ObjectPath {
+	return AccountsPath + "/" + dbus.ObjectPath(strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, string(userID)))
+}
+
+// Notification is a message that the user is notified for.
+type Notification struct {
+	RoomID     string `json:"room_id"`
+	EventID    string `json:"event_id"`
+	Sender     string `json:"sender"`
+	SenderName string `json:"sender_name"`
+	Body       string `json:"body"`
+}
+
+// SubscribeNotifications calls f for every new message that the user's push
+// rules notify for. f is called outside the main thread.
+func SubscribeNotifications(client *gotktrix.Client, f func(Notification)) func() {
+	return client.SubscribeAllTimeline(func(ev event.RoomEvent) {
+		msg, ok := ev.(*event.RoomMessageEvent)
+		if !ok || client.NotifyMessage(msg, gotktrix.NotifyMessage) == 0 {
+			return
+		}
+
+		senderName := string(msg.Sender)
+		if name, err := client.Offline().MemberName(msg.RoomID, msg.Sender, false); err == nil {
+			senderName = name.Name
+		}
+
+		f(Notification{
+			RoomID:     string(msg.RoomID),
+			EventID:    string(msg.ID),
+			Sender:     string(msg.Sender),
+			SenderName: senderName,
+			Body:       msg.Body,
+		})
+	})
+}
+
+// SendMessage sends a plain text message to the room with the given ID.
+func SendMessage(client *gotktrix.Client, roomID matrix.RoomID, body string) (matrix.EventID, error) {
+	if body == "" {
+		return "", errors.New("message body is empty")
+	}
+
+	if !client.Offline().CanSendEvent(roomID, event.TypeRoomMessage, false) {
+		return "", errors.Errorf("cannot send messages in %s", roomID)
+	}
+
+	msg := event.RoomMessageEvent{
+		RoomEventInfo: event.RoomEventInfo{
+			EventInfo: event.EventInfo{
+				Type: event.TypeRoomMessage,
+			},
+			RoomID:           roomID,
+			Sender:           client.UserID,
+			OriginServerTime: matrix.Timestamp(time.Now().UnixMilli()),
+		},
+		Body:        body,
+		MessageType: event.RoomMessageText,
+	}
+
+	eventID, err := client.RoomEventSend(roomID, event.TypeRoomMessage, msg)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot send message")
+	}
+
+	return eventID, nil
+}
+
+// Room is the D-Bus (ssuu) struct of a joined room.
+type Room struct {
+	ID            string `json:"room_id"`
+	Name          string `json:"name"`
+	Notifications uint32 `json:"notifications"`
+	Highlights    uint32 `json:"highlights"`
+}
+
+// ListRooms lists the user's joined rooms from the state, along with their
+// unread counts.
+func ListRooms(client *gotktrix.Client) ([]Room, error) {
+	client = client.Offline()
+
+	roomIDs, err := client.Rooms()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get rooms")
+	}
+
+	rooms := make([]Room, len(roomIDs))
+	for i, roomID := range roomIDs {
+		name, err := client.RoomName(roomID)
+		if err != nil {
+			name = string(roomID)
+		}
+
+		n := client.State.RoomNotificationCount(roomID)
+		rooms[i] = Room{
+			ID:            string(roomID),
+			Name:          name,
+			Notifications: uint32(n.Notification),
+			Highlights:    uint32(n.Highlight),
+		}
+	}
+
+	return rooms, nil
+}
+
+// account is the object exported for each account. All of its exported methods
+// are D-Bus methods, and they're called outside the main thread.
+type account struct {
+	ctx    context.Context
+	client *gotktrix.Client
+}
+
+// unreadCount is the D-Bus (uu) struct of a room's unread counts.
+type unreadCount struct {
+	Notifications uint32
+	Highlights    uint32
+}
+
+// UserID returns the account's user ID.
+func (a *account) UserID() (string, *dbus.Error) {
+	return string(a.client.UserID), nil
+}
+
+// SendMessage sends a plain text message to the room with the given ID.
+func (a *account) SendMessage(roomID, body string) (string, *dbus.Error) {
+	eventID, err := SendMessage(a.client.WithContext(a.ctx), matrix.RoomID(roomID), body)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return string(eventID), nil
+}
+
+// UnreadCounts returns the unread notification and highlight counts of every
+// room that has any, keyed by room ID.
+func (a *account) UnreadCounts() (map[string]unreadCount, *dbus.Error) {
+	client := a.client.Offline()
+
+	rooms, err := client.Rooms()
+	if err != nil {
+		return nil, dbus.MakeFailedError(errors.Wrap(err, "cannot get rooms"))
+	}
+
+	counts := make(map[string]unreadCount)
+	for _, roomID := range rooms {
+		n := client.State.RoomNotificationCount(roomID)
+		if n.Notification > 0 || n.Highlight > 0 {
+			counts[string(roomID)] = unreadCount{
+				Notifications: uint32(n.Notification),
+				Highlights:    uint32(n.Highlight),
+			}
+		}
+	}
+
+	return counts, nil
+}
+
+// Rooms returns every joined room with its name and unread counts.
+func (a *account) Rooms() ([]Room, *dbus.Error) {
+	rooms, err := ListRooms(a.client)
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+	return rooms, nil
+}
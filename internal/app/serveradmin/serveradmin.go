@@ -0,0 +1,480 @@
+// Package serveradmin provides a panel for Synapse server administrators to
+// manage users, rooms and media through Synapse's admin API.
+package serveradmin
+
+import (
+	"context"
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// pageSize is the number of users or rooms fetched at once.
+const pageSize = 50
+
+var panelCSS = cssutil.Applier("serveradmin", `
+	.serveradmin {
+		padding: 8px 15px 15px 15px;
+	}
+	.serveradmin > stackswitcher {
+		margin-bottom: 8px;
+	}
+	.serveradmin-search {
+		margin-bottom: 6px;
+	}
+	.serveradmin-row {
+		padding: 4px 6px;
+	}
+	.serveradmin-row > button {
+		margin-left: 6px;
+	}
+	.serveradmin-subtitle {
+		color: alpha(@theme_fg_color, 0.75);
+		font-size: 0.9em;
+	}
+	.serveradmin-more {
+		margin-top: 6px;
+	}
+	.serveradmin-media > * {
+		margin-bottom: 6px;
+	}
+`)
+
+// Show shows the server administration panel. It should only be shown if
+// Client.IsSynapseAdmin returns true.
+func Show(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	users := newUsersPage(ctx)
+	rooms := newRoomsPage(ctx)
+	media := newMediaPage(ctx)
+
+	stack := gtk.NewStack()
+	stack.SetVExpand(true)
+	stack.SetTransitionType(gtk.StackTransitionTypeCrossfade)
+	stack.AddTitled(users, "users", locale.S(ctx, "Users"))
+	stack.AddTitled(rooms, "rooms", locale.S(ctx, "Rooms"))
+	stack.AddTitled(media, "media", locale.S(ctx, "Media"))
+
+	switcher := gtk.NewStackSwitcher()
+	switcher.SetStack(stack)
+	switcher.SetHAlign(gtk.AlignCenter)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(switcher)
+	box.Append(stack)
+	panelCSS(box)
+
+	d := dialogs.NewLocalize(ctx, "Close", "Refresh")
+	d.SetTitle(locale.S(ctx, "Server Administration"))
+	d.SetDefaultSize(550, 500)
+	d.SetChild(box)
+	d.BindCancelClose()
+	d.ConnectDestroy(cancel)
+
+	d.OK.ConnectClicked(func() {
+		users.reload()
+		rooms.reload()
+	})
+
+	users.reload()
+	rooms.reload()
+
+	d.Show()
+}
+
+// listPage is a searchable, paginated list.
+type listPage struct {
+	*gtk.Box
+	ctx    context.Context
+	search *gtk.SearchEntry
+	list   *gtk.ListBox
+	more   *gtk.Button
+	// fetch fetches the page after the given one and appends it to the list.
+	// It is called in a goroutine, and the returned function is called in
+	// the main thread.
+	fetch func(search string, first bool) func()
+	busy  bool
+	// stale is true if the search changed while a page was being fetched.
+	stale bool
+}
+
+func newListPage(ctx context.Context, placeholder string) *listPage {
+	p := listPage{ctx: ctx}
+
+	p.search = gtk.NewSearchEntry()
+	p.search.AddCSSClass("serveradmin-search")
+	p.search.SetObjectProperty("placeholder-text", placeholder)
+	p.search.ConnectSearchChanged(p.reload)
+
+	p.list = gtk.NewListBox()
+	p.list.SetSelectionMode(gtk.SelectionNone)
+	p.list.AddCSSClass("boxed-list")
+
+	p.more = gtk.NewButtonWithLabel(locale.S(ctx, "Load More"))
+	p.more.AddCSSClass("serveradmin-more")
+	p.more.SetHAlign(gtk.AlignCenter)
+	p.more.SetVisible(false)
+	p.more.ConnectClicked(func() { p.load(false) })
+
+	inner := gtk.NewBox(gtk.OrientationVertical, 0)
+	inner.Append(p.list)
+	inner.Append(p.more)
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(inner)
+
+	p.Box = gtk.NewBox(gtk.OrientationVertical, 0)
+	p.Box.Append(p.search)
+	p.Box.Append(scroll)
+
+	return &p
+}
+
+func (p *listPage) reload() {
+	p.load(true)
+}
+
+func (p *listPage) load(first bool) {
+	if p.busy {
+		p.stale = p.stale || first
+		return
+	}
+	p.busy = true
+	p.more.SetSensitive(false)
+
+	if first {
+		for child := p.list.FirstChild(); child != nil; child = p.list.FirstChild() {
+			p.list.Remove(child)
+		}
+	}
+
+	search := strings.TrimSpace(p.search.Text())
+
+	gtkutil.Async(p.ctx, func() func() {
+		done := p.fetch(search, first)
+		return func() {
+			p.busy = false
+			p.more.SetSensitive(true)
+			done()
+
+			if p.stale {
+				p.stale = false
+				p.reload()
+			}
+		}
+	})
+}
+
+func newRow(title, subtitle string, buttons ...*gtk.Button) *gtk.Box {
+	titleLabel := gtk.NewLabel(title)
+	titleLabel.SetXAlign(0)
+	titleLabel.SetEllipsize(pango.EllipsizeEnd)
+	titleLabel.SetSelectable(true)
+
+	subtitleLabel := gtk.NewLabel(subtitle)
+	subtitleLabel.AddCSSClass("serveradmin-subtitle")
+	subtitleLabel.SetXAlign(0)
+	subtitleLabel.SetEllipsize(pango.EllipsizeEnd)
+
+	labels := gtk.NewBox(gtk.OrientationVertical, 0)
+	labels.SetHExpand(true)
+	labels.Append(titleLabel)
+	labels.Append(subtitleLabel)
+
+	row := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	row.AddCSSClass("serveradmin-row")
+	row.Append(labels)
+	for _, button := range buttons {
+		button.SetVAlign(gtk.AlignCenter)
+		row.Append(button)
+	}
+
+	return row
+}
+
+// confirm shows a dialog asking the user to confirm a destructive action. If
+// option is not empty, then a check button with it is shown, and its state is
+// given to f.
+func confirm(ctx context.Context, title, message, option string, f func(checked bool)) {
+	label := gtk.NewLabel(message)
+	label.SetWrap(true)
+	label.SetXAlign(0)
+
+	check := gtk.NewCheckButtonWithLabel(option)
+	check.SetVisible(option != "")
+
+	box := gtk.NewBox(gtk.OrientationVertical, 6)
+	box.Append(label)
+	box.Append(check)
+	panelCSS(box)
+
+	d := dialogs.NewLocalize(ctx, "Cancel", "Confirm")
+	d.SetTitle(title)
+	d.SetDefaultSize(350, -1)
+	d.SetChild(box)
+	d.BindCancelClose()
+	d.OK.AddCSSClass("destructive-action")
+	d.OK.ConnectClicked(func() {
+		checked := check.Active()
+		d.Close()
+		d.Destroy()
+		f(checked)
+	})
+	d.Show()
+}
+
+type usersPage struct {
+	*listPage
+	next string
+}
+
+func newUsersPage(ctx context.Context) *usersPage {
+	p := usersPage{listPage: newListPage(ctx, locale.S(ctx, "Search users"))}
+	p.fetch = p.fetchUsers
+	return &p
+}
+
+func (p *usersPage) fetchUsers(search string, first bool) func() {
+	if first {
+		p.next = ""
+	}
+
+	client := gotktrix.FromContext(p.ctx)
+
+	users, err := client.AdminListUsers(search, p.next, pageSize)
+	if err != nil {
+		return func() { app.Error(p.ctx, err) }
+	}
+
+	return func() {
+		p.next = users.NextToken
+		p.more.SetVisible(users.NextToken != "")
+
+		for _, user := range users.Users {
+			p.list.Append(p.newUserRow(user))
+		}
+	}
+}
+
+func (p *usersPage) newUserRow(user gotktrix.AdminUser) gtk.Widgetter {
+	var tags []string
+	if user.DisplayName != "" {
+		tags = append(tags, user.DisplayName)
+	}
+	if user.Admin {
+		tags = append(tags, locale.S(p.ctx, "Admin"))
+	}
+	if user.Deactivated {
+		tags = append(tags, locale.S(p.ctx, "Deactivated"))
+	}
+
+	deactivate := gtk.NewButtonWithLabel(locale.S(p.ctx, "Deactivate"))
+	deactivate.AddCSSClass("destructive-action")
+	deactivate.SetSensitive(!user.Deactivated && user.Name != gotktrix.FromContext(p.ctx).UserID)
+
+	row := newRow(string(user.Name), strings.Join(tags, " · "), deactivate)
+
+	deactivate.ConnectClicked(func() {
+		confirm(p.ctx,
+			locale.S(p.ctx, "Deactivate User"),
+			locale.Sprintf(p.ctx, "%s will be logged out and can no longer log in. This cannot be undone.", user.Name),
+			locale.S(p.ctx, "Also erase their messages"),
+			func(erase bool) {
+				deactivate.SetSensitive(false)
+				client := gotktrix.FromContext(p.ctx)
+
+				gtkutil.Async(p.ctx, func() func() {
+					if err := client.AdminDeactivateUser(user.Name, erase); err != nil {
+						return func() {
+							deactivate.SetSensitive(true)
+							app.Error(p.ctx, err)
+						}
+					}
+					return nil
+				})
+			},
+		)
+	})
+
+	return row
+}
+
+type roomsPage struct {
+	*listPage
+	next int
+}
+
+func newRoomsPage(ctx context.Context) *roomsPage {
+	p := roomsPage{listPage: newListPage(ctx, locale.S(ctx, "Search rooms"))}
+	p.fetch = p.fetchRooms
+	return &p
+}
+
+func (p *roomsPage) fetchRooms(search string, first bool) func() {
+	if first {
+		p.next = 0
+	}
+
+	client := gotktrix.FromContext(p.ctx)
+
+	rooms, err := client.AdminListRooms(search, p.next, pageSize)
+	if err != nil {
+		return func() { app.Error(p.ctx, err) }
+	}
+
+	return func() {
+		p.next = rooms.NextBatch
+		p.more.SetVisible(rooms.NextBatch > 0)
+
+		for _, room := range rooms.Rooms {
+			p.list.Append(p.newRoomRow(room))
+		}
+	}
+}
+
+func (p *roomsPage) newRoomRow(room gotktrix.AdminRoom) gtk.Widgetter {
+	title := room.Name
+	if title == "" {
+		title = room.CanonicalAlias
+	}
+	if title == "" {
+		title = string(room.RoomID)
+	}
+
+	subtitle := locale.Plural(p.ctx, "%d member", "%d members", room.JoinedMembers) +
+		" · " + string(room.RoomID)
+
+	quarantine := gtk.NewButtonFromIconName("image-missing-symbolic")
+	quarantine.SetTooltipText(locale.S(p.ctx, "Quarantine Media"))
+
+	purge := gtk.NewButtonWithLabel(locale.S(p.ctx, "Purge"))
+	purge.AddCSSClass("destructive-action")
+
+	row := newRow(title, subtitle, quarantine, purge)
+
+	quarantine.ConnectClicked(func() {
+		confirm(p.ctx,
+			locale.S(p.ctx, "Quarantine Media"),
+			locale.Sprintf(p.ctx, "All media sent in %s will no longer be downloadable.", title),
+			"",
+			func(bool) {
+				client := gotktrix.FromContext(p.ctx)
+				gtkutil.Async(p.ctx, func() func() {
+					n, err := client.AdminQuarantineRoomMedia(room.RoomID)
+					return func() {
+						if err != nil {
+							app.Error(p.ctx, err)
+							return
+						}
+						quarantine.SetTooltipText(locale.Plural(p.ctx,
+							"Quarantined %d file", "Quarantined %d files", n))
+					}
+				})
+			},
+		)
+	})
+
+	purge.ConnectClicked(func() {
+		confirm(p.ctx,
+			locale.S(p.ctx, "Purge Room"),
+			locale.Sprintf(p.ctx,
+				"All local users will be removed from %s, and its history will be deleted from this server. "+
+					"This cannot be undone.", title),
+			locale.S(p.ctx, "Block the room from being joined again"),
+			func(block bool) {
+				purge.SetSensitive(false)
+				quarantine.SetSensitive(false)
+				client := gotktrix.FromContext(p.ctx)
+
+				gtkutil.Async(p.ctx, func() func() {
+					_, err := client.AdminPurgeRoom(room.RoomID, block)
+					return func() {
+						if err != nil {
+							purge.SetSensitive(true)
+							quarantine.SetSensitive(true)
+							app.Error(p.ctx, err)
+							return
+						}
+						row.SetSensitive(false)
+					}
+				})
+			},
+		)
+	})
+
+	return row
+}
+
+type mediaPage struct {
+	*gtk.Box
+}
+
+func newMediaPage(ctx context.Context) *mediaPage {
+	description := gtk.NewLabel(locale.S(ctx,
+		"Quarantined media can no longer be downloaded from this server. "+
+			"To quarantine all media in a room, use the Rooms page."))
+	description.SetWrap(true)
+	description.SetXAlign(0)
+
+	entry := gtk.NewEntry()
+	entry.SetPlaceholderText("mxc://example.com/AbCdEf")
+	entry.SetInputPurpose(gtk.InputPurposeURL)
+	entry.ConnectChanged(func() { entry.RemoveCSSClass("error") })
+
+	status := gtk.NewLabel("")
+	status.AddCSSClass("serveradmin-subtitle")
+	status.SetXAlign(0)
+
+	quarantine := gtk.NewButtonWithLabel(locale.S(ctx, "Quarantine"))
+	quarantine.AddCSSClass("destructive-action")
+	quarantine.SetHAlign(gtk.AlignStart)
+
+	submit := func() {
+		mxc := matrix.URL(strings.TrimSpace(entry.Text()))
+		if mxc == "" {
+			return
+		}
+
+		quarantine.SetSensitive(false)
+		client := gotktrix.FromContext(ctx)
+
+		gtkutil.Async(ctx, func() func() {
+			err := client.AdminQuarantineMedia(mxc)
+			return func() {
+				quarantine.SetSensitive(true)
+
+				if err != nil {
+					entry.AddCSSClass("error")
+					status.SetText(err.Error())
+					return
+				}
+
+				entry.SetText("")
+				status.SetText(locale.Sprintf(ctx, "Quarantined %s.", mxc))
+			}
+		})
+	}
+
+	entry.ConnectActivate(submit)
+	quarantine.ConnectClicked(submit)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.AddCSSClass("serveradmin-media")
+	box.Append(description)
+	box.Append(entry)
+	box.Append(quarantine)
+	box.Append(status)
+
+	return &mediaPage{box}
+}
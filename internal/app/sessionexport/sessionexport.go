@@ -0,0 +1,144 @@
+// Package sessionexport provides a dialog that exports the current session into
+// a file, so that it can be moved to another machine.
+package sessionexport
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotk4/pkg/pango"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/components/filepick"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/pkg/errors"
+)
+
+var exportCSS = cssutil.Applier("sessionexport", `
+	.sessionexport {
+		padding: 12px;
+	}
+	.sessionexport > label {
+		margin-bottom: 12px;
+	}
+	.sessionexport-warning {
+		color: @warning_color;
+		font-size: 0.9em;
+		margin-top: 6px;
+	}
+	.sessionexport-passphrase {
+		margin-top: 6px;
+	}
+`)
+
+// Show shows a dialog that exports the current session, including the account
+// data and optionally the access token and room keys, into a JSON file.
+func Show(ctx context.Context) {
+	client := gotktrix.FromContext(ctx)
+
+	d := dialogs.NewLocalize(ctx, "Cancel", "Export")
+	d.SetTitle(locale.S(ctx, "Export Session"))
+	d.SetDefaultSize(400, -1)
+	d.BindCancelClose()
+
+	desc := gtk.NewLabel(locale.S(ctx,
+		"Export your account settings into a file to move them to another machine. "+
+			"Server-side key backups are not included."))
+	desc.SetXAlign(0)
+	desc.SetWrap(true)
+	desc.SetWrapMode(pango.WrapWordChar)
+
+	token := gtk.NewCheckButtonWithLabel(locale.S(ctx, "Include access token"))
+
+	warning := gtk.NewLabel(locale.S(ctx,
+		"Anyone with the exported file will be able to access your account."))
+	warning.AddCSSClass("sessionexport-warning")
+	warning.SetXAlign(0)
+	warning.SetWrap(true)
+	warning.SetWrapMode(pango.WrapWordChar)
+	warning.Hide()
+
+	token.ConnectToggled(func() { warning.SetVisible(token.Active()) })
+
+	keys := gtk.NewCheckButtonWithLabel(locale.S(ctx, "Include encryption keys"))
+
+	passphrase := gtk.NewEntry()
+	passphrase.AddCSSClass("sessionexport-passphrase")
+	passphrase.SetInputPurpose(gtk.InputPurposePassword)
+	passphrase.SetVisibility(false)
+	passphrase.SetPlaceholderText(locale.S(ctx, "Passphrase to encrypt the keys with"))
+	passphrase.Hide()
+
+	// Without a passphrase, the keys would be left out, so don't pretend to
+	// export them.
+	updateOK := func() {
+		d.OK.SetSensitive(!keys.Active() || passphrase.Text() != "")
+	}
+
+	keys.ConnectToggled(func() {
+		passphrase.SetVisible(keys.Active())
+		updateOK()
+	})
+	passphrase.ConnectChanged(updateOK)
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(desc)
+	box.Append(token)
+	box.Append(warning)
+	box.Append(keys)
+	box.Append(passphrase)
+	exportCSS(box)
+
+	d.SetChild(box)
+
+	d.OK.ConnectClicked(func() {
+		includeToken := token.Active()
+
+		var keysPassphrase string
+		if keys.Active() {
+			keysPassphrase = passphrase.Text()
+		}
+
+		d.Close()
+
+		chooser := filepick.New(
+			ctx, locale.S(ctx, "Export Session"),
+			gtk.FileChooserActionSave,
+			locale.S(ctx, "Export"),
+			locale.S(ctx, "Cancel"),
+		)
+		chooser.SetCurrentName(gotktrix.Base64UserID(client.UserID) + ".json")
+		chooser.ConnectAccept(func() {
+			if path := chooser.File().Path(); path != "" {
+				go export(ctx, client, path, includeToken, keysPassphrase)
+			}
+		})
+		chooser.Show()
+	})
+
+	d.Show()
+}
+
+func export(ctx context.Context, client *gotktrix.Client, path string, includeToken bool, keysPassphrase string) {
+	export, err := client.ExportSession(includeToken, keysPassphrase)
+	if err != nil {
+		app.Error(ctx, errors.Wrap(err, "cannot export session"))
+		return
+	}
+
+	b, err := json.MarshalIndent(export, "", "\t")
+	if err != nil {
+		app.Error(ctx, errors.Wrap(err, "cannot encode session export"))
+		return
+	}
+
+	// The file may contain the access token, so keep it private.
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		app.Error(ctx, errors.Wrap(err, "cannot write session export"))
+		return
+	}
+}
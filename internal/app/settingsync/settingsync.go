@@ -0,0 +1,276 @@
+// Package settingsync roams the preferences and the sort modes of the room list
+// sections between devices by storing them in the account data.
+//
+// Settings can also be overridden on a single device by putting them into the
+// local.json file of the account's settings directory, using the same layout
+// as the account data event. Local overrides always take precedence over the
+// synced settings, and changing an overridden setting only changes the local
+// value.
+package settingsync
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotkit/app/prefs/kvstate"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/settings"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+var syncSettings = prefs.NewBool(true, prefs.PropMeta{
+	Name:    "Sync Settings",
+	Section: "Application",
+	Description: "Store the settings in the account, so that they are the " +
+		"same on every device.",
+})
+
+// uploadDelay is how long to wait after a setting is changed before uploading
+// the settings, so that changing many settings at once only uploads once.
+const uploadDelay = 3 // seconds
+
+// Keys of the local override config.
+const (
+	localPrefsKey     = "prefs"
+	localSortModesKey = "sort_modes"
+)
+
+func acquireLocalConfig(ctx context.Context) *kvstate.Config {
+	uID := gotktrix.FromContext(ctx).UserID
+	return kvstate.AcquireConfig(ctx, "settings", gotktrix.Base64UserID(uID), "local.json")
+}
+
+// SortMode returns the sort mode of the room list section with the given tag,
+// or false if it has none.
+func SortMode(ctx context.Context, tag matrix.TagName) (string, bool) {
+	var local map[matrix.TagName]string
+	acquireLocalConfig(ctx).Get(localSortModesKey, &local)
+
+	if mode, ok := local[tag]; ok {
+		return mode, true
+	}
+
+	if !syncSettings.Value() {
+		return "", false
+	}
+
+	mode, ok := settings.Current(gotktrix.FromContext(ctx).Offline()).SortModes[tag]
+	return mode, ok
+}
+
+// SetSortMode saves the sort mode of the room list section with the given tag.
+// It is synced unless syncing is disabled or the sort mode is overridden
+// locally.
+func SetSortMode(ctx context.Context, tag matrix.TagName, mode string) {
+	local := acquireLocalConfig(ctx)
+
+	var localModes map[matrix.TagName]string
+	local.Get(localSortModesKey, &localModes)
+
+	if _, ok := localModes[tag]; ok || !syncSettings.Value() {
+		if localModes == nil {
+			localModes = make(map[matrix.TagName]string, 1)
+		}
+		localModes[tag] = mode
+		local.Set(localSortModesKey, localModes)
+		return
+	}
+
+	client := gotktrix.FromContext(ctx)
+
+	ev := settings.Current(client.Offline())
+	ev.SortModes[tag] = mode
+
+	client.AsyncSetConfig(ev, func(err error) {
+		if err != nil {
+			glib.IdleAdd(func() { app.Error(ctx, errors.Wrap(err, "cannot sync sort mode")) })
+		}
+	})
+}
+
+type syncer struct {
+	ctx    context.Context
+	client *gotktrix.Client
+	local  *kvstate.Config
+	props  map[string]prefs.Prop
+
+	// applying is true while the synced settings are being loaded, so that
+	// loading them doesn't upload them again.
+	applying bool
+	upload   glib.SourceHandle
+}
+
+// Bind applies the synced and the locally overridden settings of the client
+// within the given context and keeps them in sync. The returned callback stops
+// syncing.
+func Bind(ctx context.Context) func() {
+	s := syncer{
+		ctx:    ctx,
+		client: gotktrix.FromContext(ctx),
+		local:  acquireLocalConfig(ctx),
+		props:  make(map[string]prefs.Prop),
+	}
+
+	syncID := string(syncSettings.Meta().ID())
+
+	var unsubs []func()
+
+	for _, section := range prefs.ListProperties(ctx) {
+		for _, prop := range section.Props {
+			id := string(prop.Meta().ID())
+			if id == syncID {
+				continue
+			}
+
+			s.props[id] = prop
+			unsubs = append(unsubs, prop.Pubsubber().Subscribe(s.changed))
+		}
+	}
+
+	current := settings.Current(s.client.Offline())
+	s.apply(current)
+
+	// Upload the settings of the first device that syncs them.
+	if syncSettings.Value() && len(current.Prefs) == 0 {
+		s.scheduleUpload()
+	}
+
+	unsubs = append(unsubs, syncSettings.Subscribe(func() {
+		if syncSettings.Value() {
+			s.apply(settings.Current(s.client.Offline()))
+		}
+	}))
+
+	unsubs = append(unsubs, s.client.SubscribeUser(settings.EventType, func(e event.Event) {
+		ev, ok := e.(*settings.Event)
+		if ok {
+			glib.IdleAdd(func() { s.apply(ev) })
+		}
+	}))
+
+	return func() {
+		for _, unsub := range unsubs {
+			unsub()
+		}
+		if s.upload != 0 {
+			glib.SourceRemove(s.upload)
+			s.upload = 0
+		}
+	}
+}
+
+// localPrefs returns the locally overridden preferences.
+func (s *syncer) localPrefs() map[string]json.RawMessage {
+	var local map[string]json.RawMessage
+	s.local.Get(localPrefsKey, &local)
+	return local
+}
+
+// apply loads the given synced settings, then the local overrides on top of
+// them.
+func (s *syncer) apply(ev *settings.Event) {
+	values := make(map[string]json.RawMessage, len(s.props))
+
+	if syncSettings.Value() {
+		for id, value := range ev.Prefs {
+			if _, ok := s.props[id]; ok {
+				values[id] = value
+			}
+		}
+	}
+
+	for id, value := range s.localPrefs() {
+		if _, ok := s.props[id]; ok {
+			values[id] = value
+		}
+	}
+
+	if len(values) == 0 {
+		return
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		log.Println("cannot marshal synced settings:", err)
+		return
+	}
+
+	s.applying = true
+	defer func() { s.applying = false }()
+
+	if err := prefs.LoadData(b); err != nil {
+		app.Error(s.ctx, errors.Wrap(err, "cannot load synced settings"))
+	}
+}
+
+// changed is called when any preference is changed. It updates the local
+// overrides and schedules the rest to be uploaded.
+func (s *syncer) changed() {
+	if s.applying {
+		return
+	}
+
+	if local := s.localPrefs(); len(local) > 0 {
+		for id := range local {
+			prop, ok := s.props[id]
+			if !ok {
+				continue
+			}
+			if b, err := prop.MarshalJSON(); err == nil {
+				local[id] = b
+			}
+		}
+		s.local.Set(localPrefsKey, local)
+	}
+
+	if syncSettings.Value() {
+		s.scheduleUpload()
+	}
+}
+
+// scheduleUpload uploads the preferences after uploadDelay, unless another
+// upload is scheduled before then.
+func (s *syncer) scheduleUpload() {
+	if s.upload != 0 {
+		glib.SourceRemove(s.upload)
+	}
+
+	s.upload = glib.TimeoutSecondsAdd(uploadDelay, func() {
+		s.upload = 0
+		s.uploadPrefs()
+	})
+}
+
+// uploadPrefs uploads all preferences that aren't overridden locally.
+func (s *syncer) uploadPrefs() {
+	local := s.localPrefs()
+
+	ev := settings.Current(s.client.Offline())
+	ev.Prefs = make(map[string]json.RawMessage, len(s.props))
+
+	for id, prop := range s.props {
+		if _, ok := local[id]; ok {
+			continue
+		}
+
+		b, err := prop.MarshalJSON()
+		if err != nil {
+			log.Printf("cannot marshal preference %q: %v", id, err)
+			continue
+		}
+
+		ev.Prefs[id] = b
+	}
+
+	s.client.AsyncSetConfig(ev, func(err error) {
+		if err != nil {
+			glib.IdleAdd(func() { app.Error(s.ctx, errors.Wrap(err, "cannot sync settings")) })
+		}
+	})
+}
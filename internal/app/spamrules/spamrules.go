@@ -0,0 +1,264 @@
+// Package spamrules provides the user's client-side spam rules and a dialog to
+// manage them.
+package spamrules
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/app/prefs/kvstate"
+	"github.com/diamondburned/gotkit/components/dialogs"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+const rulesKey = "rules"
+
+func acquireRulesConfig(ctx context.Context, uID matrix.UserID) *kvstate.Config {
+	return kvstate.AcquireConfig(ctx, "spam", gotktrix.Base64UserID(uID), "rules.json")
+}
+
+// Load loads the current account's spam rules into the client.
+func Load(ctx context.Context) {
+	client := gotktrix.FromContext(ctx)
+	client.SetSpamRules(rules(ctx, client.UserID))
+}
+
+func rules(ctx context.Context, uID matrix.UserID) []gotktrix.SpamRule {
+	var rules []gotktrix.SpamRule
+	acquireRulesConfig(ctx, uID).Get(rulesKey, &rules)
+	return rules
+}
+
+var kinds = []gotktrix.SpamRuleKind{
+	gotktrix.SpamBodyRegex,
+	gotktrix.SpamSenderServer,
+	gotktrix.SpamStrangerMedia,
+}
+
+func kindNames(ctx context.Context) []string {
+	return []string{
+		locale.S(ctx, "Message matches regex"),
+		locale.S(ctx, "Sender's server matches"),
+		locale.S(ctx, "Media from strangers"),
+	}
+}
+
+var actions = []gotktrix.SpamRuleAction{
+	gotktrix.SpamHide,
+	gotktrix.SpamCollapse,
+}
+
+func actionNames(ctx context.Context) []string {
+	return []string{
+		locale.S(ctx, "Hide"),
+		locale.S(ctx, "Collapse"),
+	}
+}
+
+func indexOf(n int, eq func(int) bool) uint {
+	for i := 0; i < n; i++ {
+		if eq(i) {
+			return uint(i)
+		}
+	}
+	return 0
+}
+
+var rulesCSS = cssutil.Applier("spamrules", `
+	.spamrules {
+		padding: 15px;
+	}
+	.spamrules > scrolledwindow {
+		margin: 8px 0;
+	}
+	.spamrules-row {
+		padding: 4px 0;
+	}
+	.spamrules-row > * {
+		margin-right: 6px;
+	}
+	.spamrules-hits {
+		color: alpha(@theme_fg_color, 0.75);
+		font-size: 0.9em;
+	}
+`)
+
+type ruleRow struct {
+	*gtk.Box
+	id      string
+	kind    *gtk.DropDown
+	pattern *gtk.Entry
+	action  *gtk.DropDown
+}
+
+func newRuleRow(ctx context.Context, rule gotktrix.SpamRule, remove func(*ruleRow)) *ruleRow {
+	client := gotktrix.FromContext(ctx)
+
+	r := ruleRow{id: rule.ID}
+
+	r.kind = gtk.NewDropDownFromStrings(kindNames(ctx))
+	r.kind.SetSelected(indexOf(len(kinds), func(i int) bool { return kinds[i] == rule.Kind }))
+
+	r.pattern = gtk.NewEntry()
+	r.pattern.SetHExpand(true)
+	r.pattern.SetText(rule.Pattern)
+	r.pattern.ConnectChanged(func() { r.pattern.RemoveCSSClass("error") })
+
+	// Media from strangers has no pattern.
+	updatePattern := func() {
+		switch kinds[r.kind.Selected()] {
+		case gotktrix.SpamBodyRegex:
+			r.pattern.SetSensitive(true)
+			r.pattern.SetPlaceholderText(`(?i)free\s+crypto`)
+		case gotktrix.SpamSenderServer:
+			r.pattern.SetSensitive(true)
+			r.pattern.SetPlaceholderText("*.example.com")
+		case gotktrix.SpamStrangerMedia:
+			r.pattern.SetSensitive(false)
+			r.pattern.SetPlaceholderText("")
+		}
+	}
+	updatePattern()
+	r.kind.NotifyProperty("selected", updatePattern)
+
+	r.action = gtk.NewDropDownFromStrings(actionNames(ctx))
+	r.action.SetSelected(indexOf(len(actions), func(i int) bool { return actions[i] == rule.Action }))
+
+	hits := gtk.NewLabel(locale.Plural(ctx, "%d hit", "%d hits", client.SpamRuleHits(rule.ID)))
+	hits.AddCSSClass("spamrules-hits")
+	hits.SetTooltipText(locale.S(ctx, "Messages matched during this session"))
+
+	removeButton := gtk.NewButtonFromIconName("list-remove-symbolic")
+	removeButton.SetTooltipText(locale.S(ctx, "Remove Rule"))
+	removeButton.SetHasFrame(false)
+	removeButton.ConnectClicked(func() { remove(&r) })
+
+	r.Box = gtk.NewBox(gtk.OrientationHorizontal, 0)
+	r.Box.AddCSSClass("spamrules-row")
+	r.Box.Append(r.kind)
+	r.Box.Append(r.pattern)
+	r.Box.Append(r.action)
+	r.Box.Append(hits)
+	r.Box.Append(removeButton)
+
+	return &r
+}
+
+func (r *ruleRow) rule() gotktrix.SpamRule {
+	rule := gotktrix.SpamRule{
+		ID:     r.id,
+		Kind:   kinds[r.kind.Selected()],
+		Action: actions[r.action.Selected()],
+	}
+	if rule.Kind != gotktrix.SpamStrangerMedia {
+		rule.Pattern = r.pattern.Text()
+	}
+	return rule
+}
+
+func newRuleID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// Show shows a dialog that lets the user add, change and remove their spam
+// rules. Incoming messages that match a rule are hidden or collapsed locally.
+// The rules are stored per account.
+func Show(ctx context.Context) {
+	client := gotktrix.FromContext(ctx)
+
+	description := gtk.NewLabel(locale.S(ctx,
+		"Messages matching any of these rules are hidden or collapsed on this device. "+
+			"Your own messages are never matched."))
+	description.SetWrap(true)
+	description.SetXAlign(0)
+
+	list := gtk.NewBox(gtk.OrientationVertical, 0)
+
+	var rows []*ruleRow
+
+	remove := func(r *ruleRow) {
+		list.Remove(r)
+		for i, row := range rows {
+			if row == r {
+				rows = append(rows[:i], rows[i+1:]...)
+				break
+			}
+		}
+	}
+
+	addRow := func(rule gotktrix.SpamRule) {
+		row := newRuleRow(ctx, rule, remove)
+		rows = append(rows, row)
+		list.Append(row)
+	}
+
+	for _, rule := range rules(ctx, client.UserID) {
+		addRow(rule)
+	}
+
+	scroll := gtk.NewScrolledWindow()
+	scroll.SetVExpand(true)
+	scroll.SetPolicy(gtk.PolicyNever, gtk.PolicyAutomatic)
+	scroll.SetChild(list)
+
+	add := gtk.NewButtonWithLabel(locale.S(ctx, "Add Rule"))
+	add.SetHAlign(gtk.AlignStart)
+	add.ConnectClicked(func() {
+		addRow(gotktrix.SpamRule{
+			ID:     newRuleID(),
+			Kind:   gotktrix.SpamBodyRegex,
+			Action: gotktrix.SpamHide,
+		})
+	})
+
+	box := gtk.NewBox(gtk.OrientationVertical, 0)
+	box.Append(description)
+	box.Append(scroll)
+	box.Append(add)
+	rulesCSS(box)
+
+	d := dialogs.New(ctx, locale.S(ctx, "Cancel"), locale.S(ctx, "Save"))
+	d.SetDefaultSize(550, 350)
+	d.SetTitle(locale.S(ctx, "Spam Rules"))
+	d.SetChild(box)
+	d.BindCancelClose()
+
+	d.OK.ConnectClicked(func() {
+		newRules := make([]gotktrix.SpamRule, 0, len(rows))
+		valid := true
+
+		for _, row := range rows {
+			rule := row.rule()
+			if err := rule.Validate(); err != nil {
+				row.pattern.AddCSSClass("error")
+				row.pattern.SetTooltipText(err.Error())
+				valid = false
+				continue
+			}
+			newRules = append(newRules, rule)
+		}
+
+		if !valid {
+			return
+		}
+
+		config := acquireRulesConfig(ctx, client.UserID)
+		if len(newRules) > 0 {
+			config.Set(rulesKey, newRules)
+		} else {
+			config.Delete(rulesKey)
+		}
+
+		client.SetSpamRules(newRules)
+
+		d.Close()
+		d.Destroy()
+	})
+
+	d.Show()
+}
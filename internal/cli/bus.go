@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/diamondburned/gotktrix/internal/app/scripting"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/pkg/errors"
+)
+
+// errNotRunning is returned by openBus if no running instance exports the
+// account.
+var errNotRunning = errors.New("gotktrix isn't exporting the account over D-Bus")
+
+// busBackend talks to the running instance over D-Bus.
+type busBackend struct {
+	conn *dbus.Conn
+	path dbus.ObjectPath
+	obj  dbus.BusObject
+}
+
+// openBus connects to the account with the given user ID in the running
+// instance. If the user ID is empty, then the only exported account is used.
+func openBus(userID matrix.UserID) (*busBackend, error) {
+	conn, err := dbus.SessionBusPrivate()
+	if err != nil {
+		return nil, errNotRunning
+	}
+
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, errNotRunning
+	}
+
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		return nil, errNotRunning
+	}
+
+	var hasOwner bool
+	err = conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, scripting.BusName).Store(&hasOwner)
+	if err != nil || !hasOwner {
+		conn.Close()
+		return nil, errNotRunning
+	}
+
+	path, err := findAccountPath(conn, userID)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &busBackend{
+		conn: conn,
+		path: path,
+		obj:  conn.Object(scripting.BusName, path),
+	}, nil
+}
+
+// findAccountPath finds the object path of the account with the given user ID.
+func findAccountPath(conn *dbus.Conn, userID matrix.UserID) (dbus.ObjectPath, error) {
+	node, err := introspect.Call(conn.Object(scripting.BusName, scripting.AccountsPath))
+	if err != nil {
+		return "", errors.Wrap(err, "cannot list exported accounts")
+	}
+
+	if userID != "" {
+		path := scripting.AccountPath(userID)
+		for _, child := range node.Children {
+			if scripting.AccountsPath+"/"+dbus.ObjectPath(child.Name) == path {
+				return path, nil
+			}
+		}
+		return "", errNotRunning
+	}
+
+	switch len(node.Children) {
+	case 0:
+		return "", errNotRunning
+	case 1:
+		return scripting.AccountsPath + "/" + dbus.ObjectPath(node.Children[0].Name), nil
+	}
+
+	userIDs := make([]string, 0, len(node.Children))
+	for _, child := range node.Children {
+		var id string
+		path := scripting.AccountsPath + "/" + dbus.ObjectPath(child.Name)
+		if err := conn.Object(scripting.BusName, path).Call(scripting.Interface+".UserID", 0).Store(&id); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+
+	return "", errors.Errorf(
+		"gotktrix has multiple accounts; choose one using -account: %s",
+		strings.Join(userIDs, ", "))
+}
+
+func (b *busBackend) SendMessage(roomID matrix.RoomID, body string) (matrix.EventID, error) {
+	var eventID string
+	err := b.obj.Call(scripting.Interface+".SendMessage", 0, string(roomID), body).Store(&eventID)
+	return matrix.EventID(eventID), err
+}
+
+func (b *busBackend) Rooms() ([]scripting.Room, error) {
+	var rooms []scripting.Room
+	err := b.obj.Call(scripting.Interface+".Rooms", 0).Store(&rooms)
+	return rooms, err
+}
+
+func (b *busBackend) Watch(ctx context.Context, f func(scripting.Notification)) error {
+	err := b.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(b.path),
+		dbus.WithMatchInterface(scripting.Interface),
+		dbus.WithMatchMember("Notification"),
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot watch notifications")
+	}
+
+	// Also watch for gotktrix going away, since the notifications would just
+	// stop otherwise.
+	err = b.conn.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.DBus"),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchOption("arg0", scripting.BusName),
+	)
+	if err != nil {
+		return errors.Wrap(err, "cannot watch gotktrix")
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	b.conn.Signal(signals)
+	defer b.conn.RemoveSignal(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case sig, ok := <-signals:
+			if !ok {
+				return errors.New("lost connection to the session bus")
+			}
+
+			switch sig.Name {
+			case scripting.Interface + ".Notification":
+				var n scripting.Notification
+				err := dbus.Store(sig.Body, &n.RoomID, &n.EventID, &n.Sender, &n.SenderName, &n.Body)
+				if err == nil {
+					f(n)
+				}
+			case "org.freedesktop.DBus.NameOwnerChanged":
+				var name, oldOwner, newOwner string
+				err := dbus.Store(sig.Body, &name, &oldOwner, &newOwner)
+				if err == nil && name == scripting.BusName && newOwner == "" {
+					return errors.New("gotktrix has quit")
+				}
+			}
+		}
+	}
+}
+
+func (b *busBackend) Close() error {
+	return b.conn.Close()
+}
@@ -0,0 +1,217 @@
+// Package cli implements gotktrix's command-line subcommands, which are meant
+// for automation and for piping notifications into other programs.
+//
+// The subcommands talk to the running instance over D-Bus if it exports its
+// accounts (see package scripting). Otherwise, they connect by themselves using
+// the session saved when logging in. Sessions saved into the encrypted file are
+// only used if the GOTKTRIX_PASSPHRASE environment variable is set.
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotktrix/internal/app/scripting"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// backend is either the running instance or a headless client.
+type backend interface {
+	SendMessage(roomID matrix.RoomID, body string) (matrix.EventID, error)
+	Rooms() ([]scripting.Room, error)
+	// Watch calls f for every notification until the context is done.
+	Watch(ctx context.Context, f func(scripting.Notification)) error
+	Close() error
+}
+
+type command struct {
+	usage string
+	desc  string
+	run   func(ctx context.Context, b backend, f *flags) error
+}
+
+var commands = map[string]command{
+	"send": {
+		usage: "[options] ROOM_ID [MESSAGE...]",
+		desc:  "Send a plain text message. The message is read from stdin if not given.",
+		run:   send,
+	},
+	"rooms": {
+		usage: "[options]",
+		desc:  "List the joined rooms along with their unread counts.",
+		run:   rooms,
+	},
+	"watch": {
+		usage: "[options]",
+		desc:  "Print every notification as it arrives until interrupted.",
+		run:   watch,
+	},
+}
+
+// flags are the flags shared by every subcommand.
+type flags struct {
+	*flag.FlagSet
+	account  string
+	headless bool
+	json     bool
+}
+
+// IsCommand returns true if the given argument names a subcommand.
+func IsCommand(arg string) bool {
+	_, ok := commands[arg]
+	return ok
+}
+
+// Main runs the subcommand in args, where args[0] is the subcommand's name. The
+// application is only used for its paths; it's never ran. The exit code is
+// returned.
+func Main(ctx context.Context, a *app.Application, args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "unknown command", args[0])
+		return 2
+	}
+
+	f := flags{FlagSet: flag.NewFlagSet(args[0], flag.ContinueOnError)}
+	f.StringVar(&f.account, "account", "", "the user ID of the account to use")
+	f.BoolVar(&f.headless, "headless", false, "don't use the running instance")
+	f.BoolVar(&f.json, "json", false, "print JSON instead of tab-separated values")
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "Usage: gotktrix %s %s\n\n%s\n\n", args[0], cmd.usage, cmd.desc)
+		f.PrintDefaults()
+	}
+
+	if err := f.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	b, err := open(app.WithApplication(ctx, a), f.account, f.headless)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	defer b.Close()
+
+	if err := cmd.run(ctx, b, &f); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	return 0
+}
+
+// open opens the backend, preferring the running instance unless headless is
+// true.
+func open(ctx context.Context, account string, headless bool) (backend, error) {
+	if !headless {
+		b, err := openBus(matrix.UserID(account))
+		if err == nil {
+			return b, nil
+		}
+		if !errors.Is(err, errNotRunning) {
+			return nil, err
+		}
+	}
+
+	b, err := openHeadless(ctx, matrix.UserID(account))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot use saved session (if gotktrix is "+
+			"running, enable D-Bus Scripting in its preferences)")
+	}
+
+	return b, nil
+}
+
+func send(ctx context.Context, b backend, f *flags) error {
+	if f.NArg() < 1 {
+		f.Usage()
+		return errors.New("missing room ID")
+	}
+
+	body := strings.Join(f.Args()[1:], " ")
+	if f.NArg() == 1 {
+		stdin, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return errors.Wrap(err, "cannot read message from stdin")
+		}
+		body = strings.TrimSuffix(string(stdin), "\n")
+	}
+
+	eventID, err := b.SendMessage(matrix.RoomID(f.Arg(0)), body)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(eventID)
+	return nil
+}
+
+func rooms(ctx context.Context, b backend, f *flags) error {
+	rooms, err := b.Rooms()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(rooms, func(i, j int) bool {
+		return strings.ToLower(rooms[i].Name) < strings.ToLower(rooms[j].Name)
+	})
+
+	if f.json {
+		if rooms == nil {
+			rooms = []scripting.Room{}
+		}
+		return json.NewEncoder(os.Stdout).Encode(rooms)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	for _, room := range rooms {
+		fmt.Fprintf(out, "%s\t%d\t%d\t%s\n",
+			room.ID, room.Notifications, room.Highlights, oneLine(room.Name))
+	}
+	return out.Flush()
+}
+
+func watch(ctx context.Context, b backend, f *flags) error {
+	enc := json.NewEncoder(os.Stdout)
+
+	err := b.Watch(ctx, func(n scripting.Notification) {
+		if f.json {
+			enc.Encode(n)
+			return
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", n.RoomID, n.Sender, oneLine(n.SenderName), oneLine(n.Body))
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return nil
+}
+
+// oneLine replaces newlines and tabs so the string fits in one
+// tab-separated field.
+func oneLine(str string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, str)
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/diamondburned/gotkit/app/prefs"
+	"github.com/diamondburned/gotktrix/internal/app/auth"
+	"github.com/diamondburned/gotktrix/internal/app/scripting"
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// shutdownTimeout is how long to wait for the client to write everything down
+// when closing.
+const shutdownTimeout = 5 * time.Second
+
+// headlessBackend connects by itself using the saved session.
+type headlessBackend struct {
+	ctx    context.Context
+	client *gotktrix.Client
+	opened bool
+}
+
+// openHeadless connects using the saved session of the account with the given
+// user ID, or the only saved account if the user ID is empty. The context must
+// have an application.
+func openHeadless(ctx context.Context, userID matrix.UserID) (*headlessBackend, error) {
+	// The proxy preferences apply here too.
+	if data, err := prefs.ReadSavedData(ctx); err == nil {
+		if err := prefs.LoadData(data); err != nil {
+			log.Println("cannot load saved preferences:", err)
+		}
+	}
+
+	accounts, err := auth.LoadStoredAccounts(ctx, os.Getenv("GOTKTRIX_PASSPHRASE"))
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := auth.FindStoredAccount(accounts, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := acc.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &headlessBackend{ctx: ctx, client: client}, nil
+}
+
+func (b *headlessBackend) SendMessage(roomID matrix.RoomID, body string) (matrix.EventID, error) {
+	return scripting.SendMessage(b.client.WithContext(b.ctx), roomID, body)
+}
+
+// Rooms lists the rooms as of the last time that the account synced.
+func (b *headlessBackend) Rooms() ([]scripting.Room, error) {
+	return scripting.ListRooms(b.client)
+}
+
+func (b *headlessBackend) Watch(ctx context.Context, f func(scripting.Notification)) error {
+	unsub := scripting.SubscribeNotifications(b.client, f)
+	defer unsub()
+
+	if err := b.client.Open(); err != nil {
+		return errors.Wrap(err, "cannot start syncing")
+	}
+	b.opened = true
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (b *headlessBackend) Close() error {
+	if !b.opened {
+		return b.client.CloseUnopened()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return b.client.Shutdown(ctx)
+}
@@ -0,0 +1,125 @@
+// Package camera takes photos with the camera through the XDG camera portal,
+// which gives access to the camera as a PipeWire stream. The photo is captured
+// from the stream using GStreamer.
+package camera
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/diamondburned/gotktrix/internal/components/portal"
+	"github.com/godbus/dbus/v5"
+	"github.com/pkg/errors"
+)
+
+const cameraInterface = "org.freedesktop.portal.Camera"
+
+// gstLaunch is the GStreamer command that captures the photo.
+const gstLaunch = "gst-launch-1.0"
+
+// ErrDenied is returned if the user didn't allow access to the camera.
+var ErrDenied = errors.New("camera access denied")
+
+var (
+	presentOnce sync.Once
+	present     bool
+)
+
+// IsPresent returns true if there's a camera to take photos with. The result is
+// cached after the first call, which makes a D-Bus call, so it should be called
+// outside the main thread.
+func IsPresent() bool {
+	presentOnce.Do(func() {
+		if _, err := exec.LookPath(gstLaunch); err != nil {
+			return
+		}
+
+		conn, err := dbus.SessionBus()
+		if err != nil {
+			return
+		}
+
+		v, err := conn.Object(portal.Name, portal.Path).GetProperty(cameraInterface + ".IsCameraPresent")
+		if err != nil {
+			return
+		}
+
+		present, _ = v.Value().(bool)
+	})
+
+	return present
+}
+
+// Capture takes a photo and returns the path to it as a JPEG file. The caller
+// owns the file and should remove it once it's done with it. The user may be
+// asked for access to the camera first.
+func Capture(ctx context.Context) (string, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot connect to session bus")
+	}
+
+	if err := accessCamera(ctx, conn); err != nil {
+		return "", err
+	}
+
+	remote, err := openPipeWireRemote(ctx, conn)
+	if err != nil {
+		return "", err
+	}
+	defer remote.Close()
+
+	f, err := os.CreateTemp("", "gotktrix-photo-*.jpg")
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create photo file")
+	}
+	path := f.Name()
+	f.Close()
+
+	// The PipeWire remote is given to GStreamer as fd 3. jpegenc stops the
+	// pipeline after the first frame in snapshot mode.
+	cmd := exec.CommandContext(ctx, gstLaunch, "-q",
+		"pipewiresrc", "fd=3", "!",
+		"videoconvert", "!",
+		"jpegenc", "snapshot=true", "!",
+		"filesink", "location="+path,
+	)
+	cmd.ExtraFiles = []*os.File{remote}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(path)
+		return "", errors.Wrapf(err, "cannot capture photo: %s", strings.TrimSpace(string(out)))
+	}
+
+	return path, nil
+}
+
+// accessCamera asks the portal for access to the camera and waits until the
+// user answers.
+func accessCamera(ctx context.Context, conn *dbus.Conn) error {
+	_, err := portal.Request(ctx, conn, cameraInterface+".AccessCamera", nil)
+	if err != nil {
+		if errors.Is(err, portal.ErrCancelled) {
+			return ErrDenied
+		}
+		return errors.Wrap(err, "cannot request camera access")
+	}
+	return nil
+}
+
+// openPipeWireRemote opens the PipeWire remote that has the camera stream.
+func openPipeWireRemote(ctx context.Context, conn *dbus.Conn) (*os.File, error) {
+	var fd dbus.UnixFD
+
+	err := conn.Object(portal.Name, portal.Path).
+		CallWithContext(ctx, cameraInterface+".OpenPipeWireRemote", 0, map[string]dbus.Variant{}).
+		Store(&fd)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open camera stream")
+	}
+
+	return os.NewFile(uintptr(fd), "pipewire-remote"), nil
+}
@@ -0,0 +1,120 @@
+// Package geolocation finds the user's location through the XDG location
+// portal, which asks the user for access before giving it out.
+package geolocation
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotktrix/internal/components/portal"
+	"github.com/godbus/dbus/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	locationInterface = "org.freedesktop.portal.Location"
+	sessionInterface  = "org.freedesktop.portal.Session"
+)
+
+// exactAccuracy is the most accurate level that the portal can be asked for.
+const exactAccuracy uint32 = 5
+
+// ErrDenied is returned if the user didn't allow access to their location.
+var ErrDenied = errors.New("location access denied")
+
+// Position is a location of the user.
+type Position struct {
+	Latitude  float64
+	Longitude float64
+	// Accuracy is the radius in meters that the user is in. It is 0 if it's
+	// unknown.
+	Accuracy float64
+}
+
+// Watch calls f with the user's location every time it changes until the
+// context is done or an error occurs, which is returned. The user may be asked
+// for access to their location first. f is called outside the main thread.
+func Watch(ctx context.Context, f func(Position)) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return errors.Wrap(err, "cannot connect to session bus")
+	}
+
+	match := []dbus.MatchOption{dbus.WithMatchInterface(locationInterface)}
+	if err := conn.AddMatchSignal(match...); err != nil {
+		return errors.Wrap(err, "cannot listen to location updates")
+	}
+	defer conn.RemoveMatchSignal(match...)
+
+	// Location updates may arrive right after the session is started, so the
+	// channel is added before that.
+	signals := make(chan *dbus.Signal, 10)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	session, err := createSession(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer conn.Object(portal.Name, session).Call(sessionInterface+".Close", 0)
+
+	if err := start(ctx, conn, session); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case sig := <-signals:
+			if sig.Name != locationInterface+".LocationUpdated" || len(sig.Body) < 2 {
+				continue
+			}
+			if path, _ := sig.Body[0].(dbus.ObjectPath); path != session {
+				continue
+			}
+
+			location, _ := sig.Body[1].(map[string]dbus.Variant)
+			f(Position{
+				Latitude:  variantFloat(location["Latitude"]),
+				Longitude: variantFloat(location["Longitude"]),
+				Accuracy:  variantFloat(location["Accuracy"]),
+			})
+		}
+	}
+}
+
+func variantFloat(v dbus.Variant) float64 {
+	f, _ := v.Value().(float64)
+	return f
+}
+
+// createSession creates the location session that the updates are sent for.
+func createSession(ctx context.Context, conn *dbus.Conn) (dbus.ObjectPath, error) {
+	options := map[string]dbus.Variant{
+		"session_handle_token": dbus.MakeVariant(portal.NewToken()),
+		"accuracy":             dbus.MakeVariant(exactAccuracy),
+	}
+
+	var session dbus.ObjectPath
+
+	err := conn.Object(portal.Name, portal.Path).
+		CallWithContext(ctx, locationInterface+".CreateSession", 0, options).
+		Store(&session)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot create location session")
+	}
+
+	return session, nil
+}
+
+// start starts the location session and waits until the user allows it.
+func start(ctx context.Context, conn *dbus.Conn, session dbus.ObjectPath) error {
+	_, err := portal.Request(ctx, conn, locationInterface+".Start", nil, session, "")
+	if err != nil {
+		if errors.Is(err, portal.ErrCancelled) {
+			return ErrDenied
+		}
+		return errors.Wrap(err, "cannot request location access")
+	}
+	return nil
+}
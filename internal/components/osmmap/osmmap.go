@@ -0,0 +1,361 @@
+// Package osmmap implements a map widget that shows OpenStreetMap tiles. The
+// map can be panned by dragging it and zoomed by scrolling, and it marks the
+// location at its center.
+package osmmap
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/diamondburned/gotk4/pkg/cairo"
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gdkpixbuf/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app/locale"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/imgutil"
+)
+
+// TileURL is the URL format of the map tiles. It is given the zoom level and
+// the x and y of the tile, in that order.
+var TileURL = "https://tile.openstreetmap.org/%d/%d/%d.png"
+
+const (
+	// tileSize is the size of each tile in pixels.
+	tileSize = 256
+	// MinZoom and MaxZoom are the zoom levels that the map can be zoomed to.
+	MinZoom = 1
+	MaxZoom = 19
+	// maxTiles is the number of tiles kept around before the tiles of other
+	// zoom levels are thrown away.
+	maxTiles = 128
+	// earthCircumference is the circumference of the Earth at the equator in
+	// meters.
+	earthCircumference = 40075016.686
+)
+
+var mapCSS = cssutil.Applier("osmmap", `
+	.osmmap-zoom {
+		margin: 6px;
+	}
+	.osmmap-attribution {
+		font-size: 0.75em;
+		padding: 0 4px;
+		color: black;
+		background-color: alpha(white, 0.75);
+	}
+`)
+
+type tileKey struct {
+	zoom, x, y int
+}
+
+// Map is a pannable and zoomable map.
+type Map struct {
+	*gtk.Overlay
+	area *gtk.DrawingArea
+	ctx  context.Context
+
+	tiles   map[tileKey]*gdkpixbuf.Pixbuf
+	loading map[tileKey]bool
+
+	// x and y are the center of the map in pixels at the current zoom level.
+	x, y float64
+	zoom int
+
+	// accuracy is the radius of the circle around the center in meters.
+	accuracy float64
+	// pointer is where the pointer is, so that scrolling zooms into it.
+	pointer [2]float64
+
+	moved []func()
+}
+
+// NewMap creates a new map that shows the whole world.
+func NewMap(ctx context.Context) *Map {
+	m := Map{
+		ctx:     ctx,
+		tiles:   make(map[tileKey]*gdkpixbuf.Pixbuf),
+		loading: make(map[tileKey]bool),
+		zoom:    MinZoom,
+	}
+	m.x, m.y = project(0, 0, m.zoom)
+
+	m.area = gtk.NewDrawingArea()
+	m.area.SetHExpand(true)
+	m.area.SetVExpand(true)
+	m.area.SetDrawFunc(m.draw)
+
+	drag := gtk.NewGestureDrag()
+	var startX, startY float64
+	drag.ConnectDragBegin(func(_, _ float64) {
+		startX, startY = m.x, m.y
+	})
+	drag.ConnectDragUpdate(func(dx, dy float64) {
+		m.moveTo(startX-dx, startY-dy)
+	})
+	m.area.AddController(drag)
+
+	motion := gtk.NewEventControllerMotion()
+	motion.ConnectMotion(func(x, y float64) { m.pointer = [2]float64{x, y} })
+	m.area.AddController(motion)
+
+	scroll := gtk.NewEventControllerScroll(gtk.EventControllerScrollVertical | gtk.EventControllerScrollDiscrete)
+	scroll.ConnectScroll(func(_, dy float64) bool {
+		switch {
+		case dy < 0:
+			m.zoomAt(m.zoom+1, m.pointer[0], m.pointer[1])
+		case dy > 0:
+			m.zoomAt(m.zoom-1, m.pointer[0], m.pointer[1])
+		}
+		return true
+	})
+	m.area.AddController(scroll)
+
+	zoomIn := gtk.NewButtonFromIconName("zoom-in-symbolic")
+	zoomIn.SetTooltipText(locale.S(ctx, "Zoom In"))
+	zoomIn.ConnectClicked(func() { m.SetZoom(m.zoom + 1) })
+
+	zoomOut := gtk.NewButtonFromIconName("zoom-out-symbolic")
+	zoomOut.SetTooltipText(locale.S(ctx, "Zoom Out"))
+	zoomOut.ConnectClicked(func() { m.SetZoom(m.zoom - 1) })
+
+	zoom := gtk.NewBox(gtk.OrientationVertical, 0)
+	zoom.AddCSSClass("osmmap-zoom")
+	zoom.AddCSSClass("linked")
+	zoom.SetHAlign(gtk.AlignEnd)
+	zoom.SetVAlign(gtk.AlignStart)
+	zoom.Append(zoomIn)
+	zoom.Append(zoomOut)
+
+	// The tile usage policy asks for the attribution to be shown.
+	attribution := gtk.NewLabel("")
+	attribution.AddCSSClass("osmmap-attribution")
+	attribution.SetMarkup(`© <a href="https://www.openstreetmap.org/copyright">OpenStreetMap</a> contributors`)
+	attribution.SetHAlign(gtk.AlignEnd)
+	attribution.SetVAlign(gtk.AlignEnd)
+
+	m.Overlay = gtk.NewOverlay()
+	m.Overlay.SetOverflow(gtk.OverflowHidden)
+	m.Overlay.SetChild(m.area)
+	m.Overlay.AddOverlay(zoom)
+	m.Overlay.AddOverlay(attribution)
+	mapCSS(m.Overlay)
+
+	return &m
+}
+
+// ConnectMoved connects f to be called every time the user pans or zooms the
+// map.
+func (m *Map) ConnectMoved(f func()) {
+	m.moved = append(m.moved, f)
+}
+
+// Center returns the latitude and longitude at the center of the map.
+func (m *Map) Center() (lat, long float64) {
+	return unproject(m.x, m.y, m.zoom)
+}
+
+// SetCenter moves the map so that the given latitude and longitude is at its
+// center.
+func (m *Map) SetCenter(lat, long float64) {
+	m.x, m.y = project(lat, long, m.zoom)
+	m.area.QueueDraw()
+}
+
+// Zoom returns the zoom level of the map.
+func (m *Map) Zoom() int {
+	return m.zoom
+}
+
+// SetZoom zooms the map to the given level while keeping its center.
+func (m *Map) SetZoom(zoom int) {
+	m.zoomAt(zoom, float64(m.area.AllocatedWidth())/2, float64(m.area.AllocatedHeight())/2)
+}
+
+// SetAccuracy sets the radius in meters of the circle drawn around the center.
+// The circle is hidden if it's 0.
+func (m *Map) SetAccuracy(meters float64) {
+	m.accuracy = meters
+	m.area.QueueDraw()
+}
+
+func (m *Map) moveTo(x, y float64) {
+	size := worldSize(m.zoom)
+
+	// Wrap around horizontally, but stop at the poles.
+	m.x = math.Mod(math.Mod(x, size)+size, size)
+	m.y = math.Max(0, math.Min(y, size))
+
+	m.area.QueueDraw()
+	m.emitMoved()
+}
+
+// zoomAt zooms into the given level while keeping what's at the given point of
+// the widget under it.
+func (m *Map) zoomAt(zoom int, px, py float64) {
+	if zoom < MinZoom {
+		zoom = MinZoom
+	}
+	if zoom > MaxZoom {
+		zoom = MaxZoom
+	}
+	if zoom == m.zoom {
+		return
+	}
+
+	w := float64(m.area.AllocatedWidth())
+	h := float64(m.area.AllocatedHeight())
+
+	// Offset from the center to the point.
+	dx := px - w/2
+	dy := py - h/2
+
+	scale := math.Pow(2, float64(zoom-m.zoom))
+	x := (m.x+dx)*scale - dx
+	y := (m.y+dy)*scale - dy
+
+	m.zoom = zoom
+	m.dropTiles()
+	m.moveTo(x, y)
+}
+
+func (m *Map) emitMoved() {
+	for _, f := range m.moved {
+		f()
+	}
+}
+
+// dropTiles throws away the tiles of other zoom levels if there are too many.
+func (m *Map) dropTiles() {
+	if len(m.tiles) < maxTiles {
+		return
+	}
+	for key := range m.tiles {
+		if key.zoom != m.zoom {
+			delete(m.tiles, key)
+			delete(m.loading, key)
+		}
+	}
+}
+
+// tile returns the tile with the given key, or nil if it's not loaded yet, in
+// which case it starts loading it.
+func (m *Map) tile(key tileKey) *gdkpixbuf.Pixbuf {
+	if pixbuf, ok := m.tiles[key]; ok {
+		return pixbuf
+	}
+	if m.loading[key] {
+		return nil
+	}
+
+	// Failed tiles stay marked as loading, so they're not fetched again on
+	// every draw.
+	m.loading[key] = true
+
+	url := fmt.Sprintf(TileURL, key.zoom, key.x, key.y)
+	imgutil.AsyncGET(m.ctx, url, imgutil.ImageSetter{
+		SetFromPixbuf: func(p *gdkpixbuf.Pixbuf) {
+			delete(m.loading, key)
+			m.tiles[key] = p
+			m.area.QueueDraw()
+		},
+	})
+
+	return nil
+}
+
+func (m *Map) draw(_ *gtk.DrawingArea, cr *cairo.Context, width, height int) {
+	w := float64(width)
+	h := float64(height)
+
+	// Top-left of the widget in pixels at the current zoom level.
+	left := m.x - w/2
+	top := m.y - h/2
+
+	n := 1 << m.zoom
+
+	for ty := int(math.Floor(top / tileSize)); float64(ty*tileSize) < top+h; ty++ {
+		if ty < 0 || ty >= n {
+			continue
+		}
+
+		for tx := int(math.Floor(left / tileSize)); float64(tx*tileSize) < left+w; tx++ {
+			key := tileKey{zoom: m.zoom, x: ((tx % n) + n) % n, y: ty}
+
+			pixbuf := m.tile(key)
+			if pixbuf == nil {
+				continue
+			}
+
+			gdk.CairoSetSourcePixbuf(cr, pixbuf, float64(tx*tileSize)-left, float64(ty*tileSize)-top)
+			cr.Paint()
+		}
+	}
+
+	color, ok := m.area.StyleContext().LookupColor("theme_selected_bg_color")
+	if !ok {
+		rgba := gdk.NewRGBA(0.2, 0.5, 0.9, 1)
+		color = &rgba
+	}
+
+	red := float64(color.Red())
+	green := float64(color.Green())
+	blue := float64(color.Blue())
+
+	cx := w / 2
+	cy := h / 2
+
+	if m.accuracy > 0 {
+		lat, _ := m.Center()
+		radius := m.accuracy / metersPerPixel(lat, m.zoom)
+
+		cr.Arc(cx, cy, radius, 0, 2*math.Pi)
+		cr.SetSourceRGBA(red, green, blue, 0.2)
+		cr.FillPreserve()
+		cr.SetSourceRGBA(red, green, blue, 0.6)
+		cr.SetLineWidth(1)
+		cr.Stroke()
+	}
+
+	// Mark the center with a dot.
+	cr.Arc(cx, cy, 7, 0, 2*math.Pi)
+	cr.SetSourceRGB(1, 1, 1)
+	cr.Fill()
+	cr.Arc(cx, cy, 5, 0, 2*math.Pi)
+	cr.SetSourceRGB(red, green, blue)
+	cr.Fill()
+}
+
+// worldSize returns the size of the whole map in pixels at the given zoom
+// level.
+func worldSize(zoom int) float64 {
+	return tileSize * math.Pow(2, float64(zoom))
+}
+
+// project converts the given latitude and longitude into pixels at the given
+// zoom level using the Web Mercator projection.
+func project(lat, long float64, zoom int) (x, y float64) {
+	size := worldSize(zoom)
+	rad := lat * math.Pi / 180
+
+	x = (long + 180) / 360 * size
+	y = (1 - math.Log(math.Tan(rad)+1/math.Cos(rad))/math.Pi) / 2 * size
+	return
+}
+
+// unproject is the reverse of project.
+func unproject(x, y float64, zoom int) (lat, long float64) {
+	size := worldSize(zoom)
+
+	long = x/size*360 - 180
+	lat = math.Atan(math.Sinh(math.Pi*(1-2*y/size))) * 180 / math.Pi
+	return
+}
+
+// metersPerPixel returns the number of meters that a pixel is at the given
+// latitude and zoom level.
+func metersPerPixel(lat float64, zoom int) float64 {
+	return earthCircumference * math.Cos(lat*math.Pi/180) / worldSize(zoom)
+}
@@ -0,0 +1,70 @@
+// Package pip provides a small picture-in-picture window for playing media
+// while the user navigates elsewhere.
+package pip
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+)
+
+// DefaultSize is the default size of the picture-in-picture window.
+var DefaultSize = [2]int{360, 240}
+
+var windowCSS = cssutil.Applier("pip-window", `
+	.pip-window video {
+		background-color: black;
+	}
+`)
+
+// current is the currently opened window. Only one window is shown at a time,
+// so playing another video replaces the old one.
+var current *gtk.Window
+
+// Play plays the media at the given URI inside a small picture-in-picture
+// window. The window is not bound to any room, so it persists while the user
+// navigates to other rooms.
+//
+// GTK4 does not allow applications to keep a window above others, so the user
+// may have to ask their window manager to do that.
+func Play(ctx context.Context, title, uri string) {
+	video := gtk.NewVideoForFile(gio.NewFileForURI(uri))
+	video.SetAutoplay(true)
+	video.SetHExpand(true)
+	video.SetVExpand(true)
+
+	if current == nil {
+		current = newWindow(ctx)
+	}
+
+	current.SetTitle(app.FromContext(ctx).SuffixedTitle(title))
+	current.SetChild(video)
+	current.Present()
+}
+
+// Close closes the picture-in-picture window, if any.
+func Close() {
+	if current != nil {
+		current.Close()
+	}
+}
+
+func newWindow(ctx context.Context) *gtk.Window {
+	win := gtk.NewWindow()
+	win.SetApplication(app.FromContext(ctx).Application)
+	win.SetDefaultSize(DefaultSize[0], DefaultSize[1])
+	win.SetHideOnClose(false)
+	windowCSS(win)
+
+	win.ConnectCloseRequest(func() bool {
+		// Drop the video so that the media stream stops playing.
+		win.SetChild(nil)
+		current = nil
+		return false
+	})
+
+	return win
+}
@@ -0,0 +1,108 @@
+// Package portal makes requests to the XDG desktop portal, which answers them
+// through a Request object once the user has allowed or denied them.
+package portal
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Name is the bus name of the desktop portal.
+	Name = "org.freedesktop.portal.Desktop"
+	// Path is the object path of the desktop portal.
+	Path = "/org/freedesktop/portal/desktop"
+
+	requestInterface = "org.freedesktop.portal.Request"
+)
+
+// ErrCancelled is returned if the user cancelled the request, such as by
+// denying access.
+var ErrCancelled = errors.New("request cancelled by the user")
+
+// Request calls the given portal method and waits until the portal responds.
+// The options are appended to args with a handle token added, since every
+// portal method that answers through a Request takes its options last. The
+// results of the response are returned.
+func Request(
+	ctx context.Context, conn *dbus.Conn, method string,
+	options map[string]dbus.Variant, args ...interface{}) (map[string]dbus.Variant, error) {
+
+	match := []dbus.MatchOption{
+		dbus.WithMatchInterface(requestInterface),
+		dbus.WithMatchMember("Response"),
+	}
+
+	if err := conn.AddMatchSignal(match...); err != nil {
+		return nil, errors.Wrap(err, "cannot listen to portal responses")
+	}
+	defer conn.RemoveMatchSignal(match...)
+
+	// The responses get their own channel, so other signals that the caller
+	// listens to are left alone.
+	signals := make(chan *dbus.Signal, 1)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	// The request object's path is derived from the handle token, so we can
+	// tell its response apart before the call even returns.
+	token := NewToken()
+	sender := strings.ReplaceAll(strings.TrimPrefix(conn.Names()[0], ":"), ".", "_")
+	path := dbus.ObjectPath(Path + "/request/" + sender + "/" + token)
+
+	opts := make(map[string]dbus.Variant, len(options)+1)
+	for k, v := range options {
+		opts[k] = v
+	}
+	opts["handle_token"] = dbus.MakeVariant(token)
+
+	var handle dbus.ObjectPath
+
+	err := conn.Object(Name, Path).
+		CallWithContext(ctx, method, 0, append(args, opts)...).
+		Store(&handle)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case sig := <-signals:
+			if sig.Name != requestInterface+".Response" || len(sig.Body) == 0 {
+				continue
+			}
+			// Older portals don't use the handle token for the path.
+			if sig.Path != path && sig.Path != handle {
+				continue
+			}
+
+			var results map[string]dbus.Variant
+			if len(sig.Body) > 1 {
+				results, _ = sig.Body[1].(map[string]dbus.Variant)
+			}
+
+			response, _ := sig.Body[0].(uint32)
+			switch response {
+			case 0:
+				return results, nil
+			case 1:
+				return nil, ErrCancelled
+			default:
+				return nil, errors.New("portal request failed")
+			}
+		}
+	}
+}
+
+// NewToken returns a new token for the handle_token and session_handle_token
+// options.
+func NewToken() string {
+	return "gotktrix" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
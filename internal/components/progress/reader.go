@@ -9,6 +9,7 @@ import (
 	"sync/atomic"
 
 	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotkit/gtkutil/httputil"
 	"github.com/pkg/errors"
 )
 
@@ -82,7 +83,14 @@ func download(ctx context.Context, url, dst string, b *Bar) error {
 		return err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	client := http.DefaultClient
+	// Use the transport of the context's HTTP client, which may go through a
+	// proxy. Its timeout is meant for images, so it's not used.
+	if c := httputil.FromContext(ctx, nil); c != nil {
+		client = &http.Client{Transport: c.Transport}
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
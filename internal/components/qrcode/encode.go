@@ -0,0 +1,530 @@
+// Package qrcode provides a minimal QR code encoder and a widget that draws QR
+// codes. Only byte mode with the medium error correction level is supported,
+// which is enough for encoding URLs and binary payloads.
+package qrcode
+
+import (
+	"errors"
+)
+
+// ErrTooLong is returned if the data doesn't fit in the largest QR code.
+var ErrTooLong = errors.New("data too long for a QR code")
+
+// Code is an encoded QR code.
+type Code struct {
+	// Size is the width and height of the QR code in modules, excluding the
+	// quiet zone.
+	Size    int
+	modules [][]bool
+	isFunc  [][]bool
+}
+
+// Dark returns true if the module at the given coordinates is dark.
+// Coordinates outside the code are always light.
+func (c *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+	return c.modules[y][x]
+}
+
+// Error correction parameters for level M, indexed by version.
+var (
+	eccCodewordsPerBlock = [41]int{
+		-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26,
+		26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28,
+	}
+	numErrorCorrectionBlocks = [41]int{
+		-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14,
+		16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49,
+	}
+)
+
+// formatBitsM is the 2-bit format indicator of the medium error correction
+// level.
+const formatBitsM = 0
+
+// Encode encodes the given data into a QR code using the smallest version
+// that fits.
+func Encode(data []byte) (*Code, error) {
+	return encode(data, -1)
+}
+
+// encode encodes the data using the given mask, or the mask with the lowest
+// penalty if it's -1.
+func encode(data []byte, mask int) (*Code, error) {
+	version := 0
+	for v := 1; v <= 40; v++ {
+		if dataBits(v, len(data)) <= numDataCodewords(v)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	// Build the bit stream using byte mode.
+	var bb bitBuffer
+	bb.append(0x4, 4)
+	bb.append(len(data), charCountBits(version))
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+
+	capacity := numDataCodewords(version) * 8
+
+	// Add the terminator and pad to a byte boundary.
+	bb.append(0, min(4, capacity-len(bb)))
+	bb.append(0, (8-len(bb)%8)%8)
+
+	// Pad with alternating bytes until the capacity is reached.
+	for pad := 0xEC; len(bb) < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+
+	codewords := make([]byte, len(bb)/8)
+	for i, bit := range bb {
+		if bit {
+			codewords[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+
+	size := version*4 + 17
+	c := &Code{
+		Size:    size,
+		modules: newGrid(size),
+		isFunc:  newGrid(size),
+	}
+
+	c.drawFunctionPatterns(version)
+	c.drawCodewords(addECCAndInterleave(version, codewords))
+
+	// Choose the mask with the lowest penalty.
+	if mask == -1 {
+		minPenalty := -1
+		for m := 0; m < 8; m++ {
+			c.applyMask(m)
+			c.drawFormatBits(m)
+			if penalty := c.penalty(); minPenalty == -1 || penalty < minPenalty {
+				mask = m
+				minPenalty = penalty
+			}
+			c.applyMask(m) // undo
+		}
+	}
+
+	c.applyMask(mask)
+	c.drawFormatBits(mask)
+
+	return c, nil
+}
+
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+func charCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+func dataBits(version, n int) int {
+	if n >= 1<<uint(charCountBits(version)) {
+		return 1 << 30
+	}
+	return 4 + charCountBits(version) + n*8
+}
+
+// numRawDataModules returns the number of modules that can store data,
+// including error correction, for the given version.
+func numRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+func numDataCodewords(version int) int {
+	return numRawDataModules(version)/8 -
+		eccCodewordsPerBlock[version]*numErrorCorrectionBlocks[version]
+}
+
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunc[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns(version int) {
+	// Timing patterns.
+	for i := 0; i < c.Size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns, including their separators.
+	c.drawFinderPattern(3, 3)
+	c.drawFinderPattern(c.Size-4, 3)
+	c.drawFinderPattern(3, c.Size-4)
+
+	// Alignment patterns, except the ones overlapping the finder patterns.
+	pos := alignmentPositions(version)
+	n := len(pos)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			c.drawAlignmentPattern(pos[i], pos[j])
+		}
+	}
+
+	// Reserve the format bits using a dummy mask. They're drawn again later.
+	c.drawFormatBits(0)
+	c.drawVersion(version)
+}
+
+func (c *Code) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			dist := max(abs(dx), abs(dy))
+			xx, yy := x+dx, y+dy
+			if xx >= 0 && xx < c.Size && yy >= 0 && yy < c.Size {
+				c.set(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+func (c *Code) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+
+	result := make([]int, numAlign)
+	result[0] = 6
+	for i, pos := numAlign-1, version*4+17-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	data := formatBitsM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	// First copy, around the top-left finder pattern.
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(bits, i))
+	}
+	c.set(8, 7, bit(bits, 6))
+	c.set(8, 8, bit(bits, 7))
+	c.set(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(bits, i))
+	}
+
+	// Second copy, split between the other two finder patterns.
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(bits, i))
+	}
+	c.set(8, c.Size-8, true) // always dark
+}
+
+func (c *Code) drawVersion(version int) {
+	if version < 7 {
+		return
+	}
+
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		dark := bit(bits, i)
+		a := c.Size - 11 + i%3
+		b := i / 3
+		c.set(a, b, dark)
+		c.set(b, a, dark)
+	}
+}
+
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if ((right + 1) & 2) == 0 {
+					y = c.Size - 1 - vert
+				}
+				if !c.isFunc[y][x] && i < len(data)*8 {
+					c.modules[y][x] = bit(int(data[i>>3]), 7-(i&7))
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !c.isFunc[y][x] {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty calculates the penalty score of the current modules as described by
+// the QR code specification. Lower is better.
+func (c *Code) penalty() int {
+	var penalty int
+
+	// Runs of 5 or more modules of the same color in rows and columns.
+	for i := 0; i < c.Size; i++ {
+		penalty += runPenalty(c.Size, func(j int) bool { return c.modules[i][j] })
+		penalty += runPenalty(c.Size, func(j int) bool { return c.modules[j][i] })
+	}
+
+	// 2x2 blocks of the same color.
+	for y := 0; y < c.Size-1; y++ {
+		for x := 0; x < c.Size-1; x++ {
+			color := c.modules[y][x]
+			if color == c.modules[y][x+1] &&
+				color == c.modules[y+1][x] &&
+				color == c.modules[y+1][x+1] {
+				penalty += 3
+			}
+		}
+	}
+
+	// Patterns that look like finder patterns.
+	for i := 0; i < c.Size; i++ {
+		penalty += finderPenalty(c.Size, func(j int) bool { return c.modules[i][j] })
+		penalty += finderPenalty(c.Size, func(j int) bool { return c.modules[j][i] })
+	}
+
+	// Imbalance of dark and light modules.
+	var dark int
+	for _, row := range c.modules {
+		for _, module := range row {
+			if module {
+				dark++
+			}
+		}
+	}
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	penalty += k * 10
+
+	return penalty
+}
+
+func runPenalty(size int, at func(int) bool) int {
+	var penalty int
+	run := 1
+	for j := 1; j <= size; j++ {
+		if j < size && at(j) == at(j-1) {
+			run++
+			continue
+		}
+		if run >= 5 {
+			penalty += 3 + (run - 5)
+		}
+		run = 1
+	}
+	return penalty
+}
+
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+func finderPenalty(size int, at func(int) bool) int {
+	var penalty int
+	for j := 0; j+11 <= size; j++ {
+	patterns:
+		for _, pattern := range finderLike {
+			for k, dark := range pattern {
+				if at(j+k) != dark {
+					continue patterns
+				}
+			}
+			penalty += 40
+		}
+	}
+	return penalty
+}
+
+// addECCAndInterleave splits the data into blocks, appends the Reed-Solomon
+// error correction codewords to each block and interleaves them.
+func addECCAndInterleave(version int, data []byte) []byte {
+	numBlocks := numErrorCorrectionBlocks[version]
+	blockECCLen := eccCodewordsPerBlock[version]
+	rawCodewords := numRawDataModules(version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := reedSolomonDivisor(blockECCLen)
+
+	blocks := make([][]byte, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		datLen := shortBlockLen - blockECCLen
+		if i >= numShortBlocks {
+			datLen++
+		}
+
+		dat := data[k : k+datLen]
+		k += datLen
+
+		block := make([]byte, 0, shortBlockLen+1)
+		block = append(block, dat...)
+		if i < numShortBlocks {
+			block = append(block, 0) // placeholder, skipped when interleaving
+		}
+		block = append(block, reedSolomonRemainder(dat, divisor)...)
+		blocks[i] = block
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-blockECCLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+
+	return result
+}
+
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	return result
+}
+
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies two elements in GF(2^8) modulo 0x11D.
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+type bitBuffer []bool
+
+func (bb *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, (v>>uint(i))&1 != 0)
+	}
+}
+
+func bit(v, i int) bool {
+	return (v>>uint(i))&1 != 0
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,372 @@
+package qrcode
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+// byteCapacityM is the number of bytes that fit in a few versions at the
+// medium error correction level, from the capacity table of the QR code
+// specification.
+var byteCapacityM = map[int]int{
+	1:  14,
+	2:  26,
+	3:  42,
+	4:  62,
+	5:  84,
+	6:  106,
+	7:  122,
+	10: 213,
+	40: 2331,
+}
+
+func TestEncodeVersion(t *testing.T) {
+	for version, capacity := range byteCapacityM {
+		for _, n := range []int{capacity, capacity + 1} {
+			code, err := Encode(make([]byte, n))
+			if err != nil {
+				if version == 40 && n > capacity && err == ErrTooLong {
+					continue
+				}
+				t.Fatalf("cannot encode %d bytes: %v", n, err)
+			}
+
+			expect := version
+			if n > capacity {
+				expect++
+			}
+
+			if size := expect*4 + 17; code.Size != size {
+				t.Errorf("%d bytes: expected version %d (size %d), got size %d", n, expect, size, code.Size)
+			}
+		}
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	// From the alignment pattern table of the QR code specification.
+	tests := map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		14: {6, 26, 46, 66},
+		15: {6, 26, 48, 70},
+		32: {6, 34, 60, 86, 112, 138},
+		36: {6, 24, 50, 76, 102, 128, 154},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	}
+
+	for version, expect := range tests {
+		got := alignmentPositions(version)
+		if len(got) != len(expect) {
+			t.Errorf("version %d: expected %v, got %v", version, expect, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != expect[i] {
+				t.Errorf("version %d: expected %v, got %v", version, expect, got)
+				break
+			}
+		}
+	}
+}
+
+func TestReedSolomon(t *testing.T) {
+	// The data codewords of "HELLO WORLD" in a 1-M code and their error
+	// correction codewords, as worked through in the well-known thonky.com QR
+	// code tutorial.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expect := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := reedSolomonRemainder(data, reedSolomonDivisor(len(expect)))
+	if !bytes.Equal(got, expect) {
+		t.Fatalf("ECC mismatch:\n-> %v\n<- %v", expect, got)
+	}
+}
+
+// formatStringsM are the format information strings of the medium error
+// correction level for each mask, as listed by the QR code specification.
+var formatStringsM = [8]string{
+	"101010000010010",
+	"101000100100101",
+	"101111001111100",
+	"101101101001011",
+	"100010111111001",
+	"100000011001110",
+	"100111110010111",
+	"100101010100000",
+}
+
+// versionStrings are the version information strings of a few versions.
+var versionStrings = map[int]string{
+	7:  "000111110010010100",
+	10: "001010010011010011",
+	40: "101000110001101001",
+}
+
+func TestEncodeDecode(t *testing.T) {
+	payloads := [][]byte{
+		[]byte("https://example.com"),
+		[]byte("MATRIX_QR_CODE_LOGIN"),
+		bytes.Repeat([]byte{0x00, 0xFF, 0x5A}, 40), // version 7, with version info
+		bytes.Repeat([]byte("gotktrix "), 24),      // version 10
+		bytes.Repeat([]byte{0xA5}, 2331),           // version 40
+	}
+
+	for _, payload := range payloads {
+		code, err := Encode(payload)
+		if err != nil {
+			t.Fatalf("cannot encode %d bytes: %v", len(payload), err)
+		}
+
+		decoded := decode(t, code)
+		if !bytes.Equal(decoded, payload) {
+			t.Fatalf("decoded payload mismatch:\n-> %q\n<- %q", payload, decoded)
+		}
+	}
+}
+
+func TestEncodeMasks(t *testing.T) {
+	payload := []byte("https://matrix.to/#/#gotktrix:matrix.org")
+
+	for mask := 0; mask < 8; mask++ {
+		code, err := encode(payload, mask)
+		if err != nil {
+			t.Fatalf("cannot encode with mask %d: %v", mask, err)
+		}
+
+		decoded := decode(t, code)
+		if !bytes.Equal(decoded, payload) {
+			t.Fatalf("mask %d: decoded payload mismatch:\n-> %q\n<- %q", mask, payload, decoded)
+		}
+	}
+}
+
+// decode decodes the QR code back into its data, checking the function
+// patterns and the error correction along the way.
+func decode(t *testing.T, c *Code) []byte {
+	t.Helper()
+
+	version := (c.Size - 17) / 4
+
+	checkFinder := func(x0, y0 int) {
+		for y := -1; y <= 7; y++ {
+			for x := -1; x <= 7; x++ {
+				ring := max(abs(x-3), abs(y-3))
+				if got := c.Dark(x0+x, y0+y); got != (ring != 2 && ring != 4) {
+					t.Fatalf("version %d: finder at (%d, %d) has a wrong module at (%d, %d)",
+						version, x0, y0, x, y)
+				}
+			}
+		}
+	}
+
+	checkFinder(0, 0)
+	checkFinder(c.Size-7, 0)
+	checkFinder(0, c.Size-7)
+
+	if !c.Dark(8, c.Size-8) {
+		t.Fatalf("version %d: dark module is light", version)
+	}
+
+	for i := 8; i < c.Size-8; i++ {
+		if c.Dark(i, 6) != (i%2 == 0) || c.Dark(6, i) != (i%2 == 0) {
+			t.Fatalf("version %d: timing pattern is wrong at %d", version, i)
+		}
+	}
+
+	// Read both copies of the format information.
+	var format1, format2 int
+	for i := 0; i < 15; i++ {
+		var x, y int
+		switch {
+		case i <= 5:
+			x, y = 8, i
+		case i == 6:
+			x, y = 8, 7
+		case i == 7:
+			x, y = 8, 8
+		case i == 8:
+			x, y = 7, 8
+		default:
+			x, y = 14-i, 8
+		}
+		if c.Dark(x, y) {
+			format1 |= 1 << uint(i)
+		}
+
+		if i < 8 {
+			x, y = c.Size-1-i, 8
+		} else {
+			x, y = 8, c.Size-15+i
+		}
+		if c.Dark(x, y) {
+			format2 |= 1 << uint(i)
+		}
+	}
+
+	if format1 != format2 {
+		t.Fatalf("version %d: format copies differ: %015b, %015b", version, format1, format2)
+	}
+
+	mask := -1
+	for m, s := range formatStringsM {
+		if v, _ := strconv.ParseInt(s, 2, 32); int(v) == format1 {
+			mask = m
+		}
+	}
+	if mask == -1 {
+		t.Fatalf("version %d: unknown format %015b", version, format1)
+	}
+
+	if s, ok := versionStrings[version]; ok {
+		var info int
+		for i := 0; i < 18; i++ {
+			if c.Dark(c.Size-11+i%3, i/3) {
+				info |= 1 << uint(i)
+			}
+		}
+		if v, _ := strconv.ParseInt(s, 2, 32); int(v) != info {
+			t.Fatalf("version %d: version info is %018b", version, info)
+		}
+	}
+
+	// Find the data modules from a fresh set of function patterns.
+	ref := &Code{Size: c.Size, modules: newGrid(c.Size), isFunc: newGrid(c.Size)}
+	ref.drawFunctionPatterns(version)
+
+	masked := func(x, y int) bool {
+		i, j := y, x
+		switch mask {
+		case 0:
+			return (i+j)%2 == 0
+		case 1:
+			return i%2 == 0
+		case 2:
+			return j%3 == 0
+		case 3:
+			return (i+j)%3 == 0
+		case 4:
+			return (i/2+j/3)%2 == 0
+		case 5:
+			return (i*j)%2+(i*j)%3 == 0
+		case 6:
+			return ((i*j)%2+(i*j)%3)%2 == 0
+		default:
+			return ((i+j)%2+(i*j)%3)%2 == 0
+		}
+	}
+
+	// Read the codewords in the zigzag order: two columns at a time from the
+	// right, alternating between going up and down, skipping the vertical
+	// timing pattern.
+	var bits []bool
+	upward := true
+	for right := c.Size - 1; right > 0; right -= 2 {
+		if right == 6 {
+			right--
+		}
+		for n := 0; n < c.Size; n++ {
+			y := n
+			if upward {
+				y = c.Size - 1 - n
+			}
+			for _, x := range []int{right, right - 1} {
+				if !ref.isFunc[y][x] {
+					bits = append(bits, c.Dark(x, y) != masked(x, y))
+				}
+			}
+		}
+		upward = !upward
+	}
+
+	raw := make([]byte, numRawDataModules(version)/8)
+	for i := range raw {
+		for _, bit := range bits[i*8 : i*8+8] {
+			raw[i] <<= 1
+			if bit {
+				raw[i] |= 1
+			}
+		}
+	}
+
+	// Undo the interleaving, then check that every block is a valid
+	// Reed-Solomon code word.
+	numBlocks := numErrorCorrectionBlocks[version]
+	eccLen := eccCodewordsPerBlock[version]
+	numShort := numBlocks - len(raw)%numBlocks
+	shortLen := len(raw) / numBlocks
+
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := 0; i < shortLen-eccLen+1; i++ {
+		for b := range blocks {
+			if i == shortLen-eccLen && b < numShort {
+				continue
+			}
+			blocks[b] = append(blocks[b], raw[k])
+			k++
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], raw[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for b, block := range blocks {
+		for i := 0; i < eccLen; i++ {
+			if syndrome(block, i) != 0 {
+				t.Fatalf("version %d: block %d has a non-zero syndrome %d", version, b, i)
+			}
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+
+	// Parse the byte mode segment.
+	var bb bitBuffer
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+
+	read := func(n int) int {
+		var v int
+		for _, bit := range bb[:n] {
+			v <<= 1
+			if bit {
+				v |= 1
+			}
+		}
+		bb = bb[n:]
+		return v
+	}
+
+	if mode := read(4); mode != 0x4 {
+		t.Fatalf("version %d: unexpected mode %04b", version, mode)
+	}
+
+	n := read(charCountBits(version))
+	payload := make([]byte, n)
+	for i := range payload {
+		payload[i] = byte(read(8))
+	}
+
+	return payload
+}
+
+// syndrome evaluates the block as a polynomial at 2^i in GF(2^8).
+func syndrome(block []byte, i int) byte {
+	x := byte(1)
+	for ; i > 0; i-- {
+		x = gfMultiply(x, 0x02)
+	}
+
+	var v byte
+	for _, b := range block {
+		v = gfMultiply(v, x) ^ b
+	}
+	return v
+}
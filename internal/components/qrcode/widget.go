@@ -0,0 +1,73 @@
+package qrcode
+
+import (
+	"github.com/diamondburned/gotk4/pkg/cairo"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// quietZone is the number of light modules around the QR code that scanners
+// need to find it.
+const quietZone = 4
+
+// Widget is a widget that draws a QR code. QR codes are always drawn in black
+// on white regardless of the theme, since not all scanners can read inverted
+// codes.
+type Widget struct {
+	*gtk.DrawingArea
+	code *Code
+}
+
+// NewWidget creates a new QR code widget with the given size in pixels.
+func NewWidget(size int) *Widget {
+	w := Widget{DrawingArea: gtk.NewDrawingArea()}
+	w.AddCSSClass("qrcode")
+	w.SetContentWidth(size)
+	w.SetContentHeight(size)
+	w.SetHAlign(gtk.AlignCenter)
+	w.SetVAlign(gtk.AlignCenter)
+	w.SetDrawFunc(w.draw)
+	return &w
+}
+
+// SetCode sets the QR code to be drawn. A nil code clears the widget.
+func (w *Widget) SetCode(code *Code) {
+	w.code = code
+	w.QueueDraw()
+}
+
+func (w *Widget) draw(_ *gtk.DrawingArea, cr *cairo.Context, width, height int) {
+	if w.code == nil {
+		return
+	}
+
+	side := width
+	if height < side {
+		side = height
+	}
+
+	modules := w.code.Size + quietZone*2
+	scale := float64(side) / float64(modules)
+
+	// Center the code within the allocated area.
+	offsetX := float64(width-side) / 2
+	offsetY := float64(height-side) / 2
+
+	cr.SetSourceRGB(1, 1, 1)
+	cr.Rectangle(offsetX, offsetY, float64(side), float64(side))
+	cr.Fill()
+
+	cr.SetSourceRGB(0, 0, 0)
+	for y := 0; y < w.code.Size; y++ {
+		for x := 0; x < w.code.Size; x++ {
+			if !w.code.Dark(x, y) {
+				continue
+			}
+			cr.Rectangle(
+				offsetX+float64(x+quietZone)*scale,
+				offsetY+float64(y+quietZone)*scale,
+				scale, scale,
+			)
+		}
+	}
+	cr.Fill()
+}
@@ -0,0 +1,126 @@
+package gotktrix
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// announcementLevel is the power level that is needed to send messages in an
+// announcement room, which is the moderator level.
+const announcementLevel = 50
+
+// IsAnnouncementRoom returns true if only users above the default power level,
+// such as moderators, can send messages in the room.
+func (c *Client) IsAnnouncementRoom(roomID matrix.RoomID) bool {
+	e, err := c.RoomState(roomID, event.TypeRoomPowerLevels, "")
+	if err != nil {
+		return false
+	}
+
+	ev := e.(*event.RoomPowerLevelsEvent)
+
+	level, ok := ev.Events[event.TypeRoomMessage]
+	if !ok {
+		level = ev.EventRequirement
+	}
+
+	return level > ev.UserDefault
+}
+
+// SetAnnouncementRoom marks or unmarks the room as an announcement room by
+// changing the power level needed to send messages.
+func (c *Client) SetAnnouncementRoom(roomID matrix.RoomID, announce bool) error {
+	route := c.Endpoints.RoomStateExact(roomID, event.TypeRoomPowerLevels, "")
+
+	// The raw content is changed instead of the parsed event, so that fields
+	// that gotrix doesn't know about and omitted defaults are kept as-is.
+	var levels map[string]json.RawMessage
+	if err := c.Request("GET", route, &levels, httputil.WithToken()); err != nil {
+		return errors.Wrap(err, "failed to get power levels")
+	}
+
+	var userDefault int
+	if b, ok := levels["users_default"]; ok {
+		json.Unmarshal(b, &userDefault)
+	}
+
+	level := userDefault
+	if announce {
+		level = announcementLevel
+		if level <= userDefault {
+			level = userDefault + 1
+		}
+	}
+
+	levels["events_default"], _ = json.Marshal(level)
+
+	// A level for messages specifically would override events_default.
+	if b, ok := levels["events"]; ok {
+		var events map[string]json.RawMessage
+		if err := json.Unmarshal(b, &events); err == nil {
+			delete(events, string(event.TypeRoomMessage))
+			levels["events"], _ = json.Marshal(events)
+		}
+	}
+
+	_, err := c.RoomStateSend(roomID, api.RoomStateSendArg{
+		Type:    event.TypeRoomPowerLevels,
+		Content: levels,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to set power levels")
+	}
+
+	return nil
+}
+
+// RoomNotifiesAll returns true if the user has a push rule that notifies them of
+// every message in the room.
+func (c *Client) RoomNotifiesAll(roomID matrix.RoomID) bool {
+	e, err := c.State.UserEvent(event.TypePushRules)
+	if err != nil {
+		return false
+	}
+
+	rules := e.(*event.PushRulesEvent)
+
+	for _, rule := range rules.Global.Room {
+		if rule.RuleID == matrix.PushRuleID(roomID) {
+			return rule.Enabled && rule.Actions.Action == matrix.NotifyAction
+		}
+	}
+
+	return false
+}
+
+// SetRoomNotifiesAll adds or removes the push rule that notifies the user of
+// every message in the room.
+func (c *Client) SetRoomNotifiesAll(roomID matrix.RoomID, notify bool) error {
+	route := c.Endpoints.Base() + "/pushrules/global/room/" + url.PathEscape(string(roomID))
+
+	if !notify {
+		if !c.RoomNotifiesAll(roomID) {
+			return nil
+		}
+		err := c.Request("DELETE", route, nil, httputil.WithToken())
+		return errors.Wrap(err, "failed to remove room push rule")
+	}
+
+	actions := matrix.PushActions{Action: matrix.NotifyAction}
+	actions.SetTweak(matrix.SoundActionTweak, "default")
+
+	body := struct {
+		Actions matrix.PushActions `json:"actions"`
+	}{
+		Actions: actions,
+	}
+
+	err := c.Request("PUT", route, nil, httputil.WithToken(), httputil.WithJSONBody(body))
+	return errors.Wrap(err, "failed to add room push rule")
+}
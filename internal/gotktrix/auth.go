@@ -2,38 +2,75 @@ package gotktrix
 
 import (
 	"context"
+	"net/url"
+	"strings"
 
 	"github.com/diamondburned/gotrix"
 	"github.com/diamondburned/gotrix/api"
 	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
 )
 
 // ClientAuth holds a partial client.
 type ClientAuth struct {
-	c *gotrix.Client
-	o Opts
+	c   *gotrix.Client
+	o   Opts
+	ctx context.Context
 }
 
-// Discover wraps around gotrix.DiscoverWithClienT.
+// Discover wraps around gotrix.DiscoverWithClient. The homeserver and identity
+// server are discovered using the server's .well-known file. If the server
+// doesn't have one, then serverName is used as the homeserver directly.
 func Discover(serverName string, opts Opts) (*ClientAuth, error) {
 	opts.init()
 
 	c, err := gotrix.DiscoverWithClient(opts.Client, serverName)
 	if err != nil {
-		return nil, err
+		if !errors.Is(err, api.ErrServerNotFound) {
+			return nil, err
+		}
+
+		c, err = gotrix.NewWithClient(opts.Client, serverName)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &ClientAuth{
-		c: c,
-		o: opts,
+		c:   c,
+		o:   opts,
+		ctx: context.Background(),
 	}, nil
 }
 
+// SetIdentityServer overrides the identity server that was discovered. The
+// given server can either be a URL or a host.
+func (a *ClientAuth) SetIdentityServer(server string) {
+	a.c.IdentityServer = IdentityServerHost(server)
+}
+
+// IdentityServerHost returns the host part of the given identity server, which
+// can either be a URL or a host.
+func IdentityServerHost(server string) string {
+	server = strings.TrimSpace(server)
+	if !strings.Contains(server, "://") {
+		return strings.TrimSuffix(server, "/")
+	}
+
+	u, err := url.Parse(server)
+	if err != nil {
+		return server
+	}
+
+	return u.Host
+}
+
 // WithContext creates a copy of ClientAuth that uses the provided context.
 func (a *ClientAuth) WithContext(ctx context.Context) *ClientAuth {
 	return &ClientAuth{
-		c: a.c.WithContext(ctx),
-		o: a.o,
+		c:   a.c.WithContext(ctx),
+		o:   a.o,
+		ctx: ctx,
 	}
 }
 
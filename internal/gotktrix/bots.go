@@ -0,0 +1,121 @@
+package gotktrix
+
+import (
+	"strings"
+
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// KnownBridge is a bridge whose user IDs follow a well-known namespace, so its
+// users can be told apart from regular users.
+type KnownBridge struct {
+	// Network is the name of the bridged network, such as "Telegram".
+	Network string
+	// Bot is the localpart of the bridge's management bot, which is invited
+	// into rooms to bridge them and messaged to log in.
+	Bot string
+	// Prefix is the prefix of the localparts of the bridged users.
+	Prefix string
+}
+
+// KnownBridges lists the bridges that are detected by their namespaces. The
+// localparts are the defaults of the bridges; homeservers may change them.
+var KnownBridges = []KnownBridge{
+	{Network: "Telegram", Bot: "telegrambot", Prefix: "telegram_"},
+	{Network: "WhatsApp", Bot: "whatsappbot", Prefix: "whatsapp_"},
+	{Network: "Signal", Bot: "signalbot", Prefix: "signal_"},
+	{Network: "Discord", Bot: "discordbot", Prefix: "discord_"},
+	{Network: "Discord", Bot: "_discord_bot", Prefix: "_discord_"},
+	{Network: "Slack", Bot: "slackbot", Prefix: "slack_"},
+	{Network: "Instagram", Bot: "instagrambot", Prefix: "instagram_"},
+	{Network: "Facebook Messenger", Bot: "facebookbot", Prefix: "facebook_"},
+	{Network: "Twitter", Bot: "twitterbot", Prefix: "twitter_"},
+	{Network: "Google Chat", Bot: "googlechatbot", Prefix: "googlechat_"},
+	{Network: "IRC", Bot: "heisenbridge", Prefix: "heisenbridge_"},
+	{Network: "IRC", Bot: "appservice-irc", Prefix: "irc_"},
+}
+
+// BotKind is the kind of application service user that a user is.
+type BotKind uint8
+
+const (
+	// NotBot is a regular user.
+	NotBot BotKind = iota
+	// GenericBot is a bot that isn't a known bridge, such as a moderation bot.
+	GenericBot
+	// BridgeBot is the management bot of a known bridge.
+	BridgeBot
+	// BridgedUser is a user of another network that a known bridge puppets.
+	BridgedUser
+)
+
+// Bot describes a bot or a bridged user.
+type Bot struct {
+	UserID matrix.UserID
+	Kind   BotKind
+	// Bridge is the bridge of the user, if Kind is BridgeBot or BridgedUser.
+	Bridge *KnownBridge
+}
+
+// DetectBot guesses whether the user is a bot or a bridged user from the
+// namespace of its user ID.
+func DetectBot(userID matrix.UserID) Bot {
+	bot := Bot{UserID: userID}
+
+	localpart, _, err := userID.Parse()
+	if err != nil {
+		return bot
+	}
+
+	for i, bridge := range KnownBridges {
+		switch {
+		case localpart == bridge.Bot:
+			bot.Kind = BridgeBot
+			bot.Bridge = &KnownBridges[i]
+			return bot
+		case strings.HasPrefix(localpart, bridge.Prefix):
+			bot.Kind = BridgedUser
+			bot.Bridge = &KnownBridges[i]
+			return bot
+		}
+	}
+
+	if strings.HasSuffix(strings.ToLower(localpart), "bot") {
+		bot.Kind = GenericBot
+	}
+
+	return bot
+}
+
+// RoomBots returns the joined members of the room that look like bots or
+// bridged users.
+func (c *Client) RoomBots(roomID matrix.RoomID) ([]Bot, error) {
+	members, err := c.RoomMembers(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	var bots []Bot
+
+	for _, member := range members {
+		if member.NewState != event.MemberJoined {
+			continue
+		}
+		if bot := DetectBot(member.UserID); bot.Kind != NotBot {
+			bots = append(bots, bot)
+		}
+	}
+
+	return bots, nil
+}
+
+// BridgeBotID returns the user ID of the bridge's management bot on the current
+// user's homeserver.
+func (c *Client) BridgeBotID(bridge KnownBridge) matrix.UserID {
+	_, server, err := c.UserID.Parse()
+	if err != nil {
+		return ""
+	}
+	return matrix.UserID("@" + bridge.Bot + ":" + server)
+}
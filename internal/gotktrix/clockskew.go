@@ -0,0 +1,65 @@
+package gotktrix
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ClockSkewThreshold is the minimum difference between the local clock and the
+// homeserver's clock for it to be considered skewed. The Date header only has
+// a resolution of a second, so smaller differences are just noise.
+const ClockSkewThreshold = time.Minute
+
+// clockSkew keeps track of the difference between the homeserver's clock and
+// the local clock, as estimated from the Date header of its responses.
+type clockSkew struct {
+	skew  int64 // time.Duration, atomic
+	known uint32
+}
+
+func (s *clockSkew) intercept(r *http.Request, next func() (*http.Response, error)) (*http.Response, error) {
+	sent := time.Now()
+
+	resp, err := next()
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return resp, nil
+	}
+
+	// Assume that the server generated the response halfway through the
+	// round trip.
+	now := time.Now()
+	local := sent.Add(now.Sub(sent) / 2)
+
+	atomic.StoreInt64(&s.skew, int64(date.Sub(local)))
+	atomic.StoreUint32(&s.known, 1)
+
+	return resp, nil
+}
+
+// ClockSkew returns how far the homeserver's clock is ahead of the local clock.
+// The returned duration is negative if the homeserver's clock is behind, and
+// zero if the skew is below ClockSkewThreshold or not yet known.
+func (c *Client) ClockSkew() time.Duration {
+	if atomic.LoadUint32(&c.skew.known) == 0 {
+		return 0
+	}
+
+	skew := time.Duration(atomic.LoadInt64(&c.skew.skew))
+	if skew > -ClockSkewThreshold && skew < ClockSkewThreshold {
+		return 0
+	}
+
+	return skew
+}
+
+// ServerTime returns the current time according to the homeserver's clock. It
+// is the local time if the local clock isn't skewed.
+func (c *Client) ServerTime() time.Time {
+	return time.Now().Add(c.ClockSkew())
+}
@@ -0,0 +1,160 @@
+package gotktrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Diagnostic is the result of a single connectivity check.
+type Diagnostic struct {
+	// Name is the name of the check.
+	Name string
+	// Result describes what the check found. It is empty if Err is not nil.
+	Result string
+	// Latency is the time that the check took.
+	Latency time.Duration
+	// Err is not nil if the check failed.
+	Err error
+}
+
+// diagnosticCheck is a single check. It returns the result text.
+type diagnosticCheck struct {
+	name string
+	run  func(c *Client) (string, error)
+}
+
+var diagnosticChecks = []diagnosticCheck{
+	{"Homeserver Versions", (*Client).diagnoseVersions},
+	{"Authentication", (*Client).diagnoseWhoami},
+	{"Capabilities", (*Client).diagnoseCapabilities},
+	{"Media Repository", (*Client).diagnoseMedia},
+	{"Sliding Sync Proxy", (*Client).diagnoseSlidingSync},
+}
+
+// DiagnosticNames returns the names of all checks that Diagnose runs in order.
+func DiagnosticNames() []string {
+	names := make([]string, len(diagnosticChecks))
+	for i, check := range diagnosticChecks {
+		names[i] = check.name
+	}
+	return names
+}
+
+// Diagnose runs connectivity checks against the homeserver and its media
+// repository to help debug connection issues. The checks are run one by one,
+// and f is called after each check. Diagnose blocks until all checks are done
+// or until the client's context is cancelled.
+func (c *Client) Diagnose(f func(Diagnostic)) {
+	for _, check := range diagnosticChecks {
+		if c.ctx != nil && c.ctx.Err() != nil {
+			return
+		}
+
+		now := time.Now()
+		result, err := check.run(c)
+
+		f(Diagnostic{
+			Name:    check.name,
+			Result:  result,
+			Latency: time.Since(now),
+			Err:     err,
+		})
+	}
+}
+
+func (c *Client) diagnoseVersions() (string, error) {
+	v, err := c.SupportedVersions()
+	if err != nil {
+		return "", err
+	}
+	return "Supported versions: " + strings.Join(v.Versions, ", "), nil
+}
+
+func (c *Client) diagnoseWhoami() (string, error) {
+	u, err := c.Whoami()
+	if err != nil {
+		return "", err
+	}
+	return "Logged in as " + string(u), nil
+}
+
+func (c *Client) diagnoseCapabilities() (string, error) {
+	caps, err := c.ServerCapabilities()
+	if err != nil {
+		return "", errors.Wrap(err, "cannot get capabilities")
+	}
+
+	v, err := caps.RoomVersion()
+	if err != nil || v.Default == "" {
+		return fmt.Sprintf("%d capabilities", len(*caps)), nil
+	}
+
+	return "Default room version: " + v.Default, nil
+}
+
+func (c *Client) diagnoseMedia() (string, error) {
+	cfg, err := c.MediaConfig()
+	if err != nil {
+		return "", err
+	}
+
+	if cfg.UploadSize == 0 {
+		return "No upload size limit given", nil
+	}
+
+	return fmt.Sprintf("Maximum upload size: %.1f MB", float64(cfg.UploadSize)/1e6), nil
+}
+
+// slidingSyncProxyKey is the .well-known key that advertises a sliding sync
+// proxy as per MSC3575.
+const slidingSyncProxyKey = "org.matrix.msc3575.proxy"
+
+func (c *Client) diagnoseSlidingSync() (string, error) {
+	_, server, err := c.UserID.Parse()
+	if err != nil {
+		return "", errors.Wrap(err, "invalid user ID")
+	}
+
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, "GET", "https://"+server+"/.well-known/matrix/client", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.ClientDriver.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot fetch .well-known")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "No .well-known file found", nil
+	}
+
+	var wellKnown map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&wellKnown); err != nil {
+		return "", errors.Wrap(err, "invalid .well-known")
+	}
+
+	var proxy struct {
+		URL string `json:"url"`
+	}
+
+	json.Unmarshal(wellKnown[slidingSyncProxyKey], &proxy)
+	if proxy.URL == "" {
+		return "Not advertised", nil
+	}
+
+	return "Advertised at " + proxy.URL, nil
+}
@@ -0,0 +1,47 @@
+package gotktrix
+
+import (
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// Draft is an unfinished message in the composer of a room. Drafts are only
+// kept locally.
+type Draft struct {
+	Text       string         `json:"text,omitempty"`
+	ReplyingTo matrix.EventID `json:"replying_to,omitempty"`
+	// Attachments is the URIs of the files that are staged to be sent with
+	// the message.
+	Attachments []string `json:"attachments,omitempty"`
+}
+
+// IsEmpty returns true if the draft has nothing in it.
+func (d Draft) IsEmpty() bool {
+	return d.Text == "" && d.ReplyingTo == "" && len(d.Attachments) == 0
+}
+
+// RoomDraft returns the draft that was saved for the room, if any.
+func (c *Client) RoomDraft(roomID matrix.RoomID) (Draft, bool) {
+	var draft Draft
+	if err := c.State.RoomDraft(roomID, &draft); err != nil {
+		return Draft{}, false
+	}
+	return draft, !draft.IsEmpty()
+}
+
+// SetRoomDraft saves the draft of the room. An empty draft deletes the saved
+// one.
+func (c *Client) SetRoomDraft(roomID matrix.RoomID, draft Draft) error {
+	var err error
+	if draft.IsEmpty() {
+		err = c.State.SetRoomDraft(roomID, nil)
+	} else {
+		err = c.State.SetRoomDraft(roomID, draft)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "failed to save draft")
+	}
+
+	return nil
+}
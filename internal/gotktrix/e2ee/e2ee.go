@@ -0,0 +1,183 @@
+// Package e2ee implements end-to-end encryption using Olm and Megolm. It keeps
+// the device's keys and sessions in its own database, since they can't be
+// fetched again like the rest of the state.
+//
+// The private keys of the account and its sessions are stored as plain JSON in
+// that database. They're only protected by the permissions of the database
+// file, which is only readable by the user.
+package e2ee
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/e2ee/olm"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/internal/db"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// ErrNotStarted is returned if the machine hasn't been started yet.
+var ErrNotStarted = errors.New("encryption isn't set up yet")
+
+// storedAccount is the account as it's stored in the database.
+type storedAccount struct {
+	DeviceID matrix.DeviceID `json:"device_id"`
+	Account  *olm.Account    `json:"account"`
+	// Uploaded is true once the device keys are uploaded.
+	Uploaded bool `json:"uploaded"`
+}
+
+// Machine keeps track of the Olm and Megolm sessions of a device.
+type Machine struct {
+	client *api.Client
+	kv     *db.KV
+
+	mu      sync.Mutex
+	account *storedAccount
+	// inbound caches the inbound group sessions, since their ratchets are
+	// advanced as messages are decrypted.
+	inbound map[inboundKey]*inboundSession
+	// uploading is true while one-time keys are being uploaded.
+	uploading bool
+
+	// encryptMu serializes Encrypt, so that the outbound session of a room
+	// isn't replaced or shared twice at once. Unlike mu, it's held while the
+	// room key is being shared.
+	encryptMu sync.Mutex
+}
+
+// Open opens the database at the given path. The machine must be started
+// before it can be used.
+func Open(path string, client *api.Client) (*Machine, error) {
+	kv, err := db.NewKVFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open crypto db")
+	}
+
+	// The database has unencrypted private keys, so no one else may read it.
+	if err := os.Chmod(path, 0600); err != nil {
+		kv.Close()
+		return nil, errors.Wrap(err, "failed to protect crypto db")
+	}
+
+	return &Machine{
+		client:  client,
+		kv:      kv,
+		inbound: make(map[inboundKey]*inboundSession),
+	}, nil
+}
+
+// Close closes the database.
+func (m *Machine) Close() error {
+	return m.kv.Close()
+}
+
+// Start loads the account of the current device, or creates a new one if the
+// device has changed, and then uploads its keys if they haven't been. If the
+// upload fails, then it's retried on the next sync.
+func (m *Machine) Start() error {
+	// The account may be replaced, so wait for events being encrypted with the
+	// old one.
+	m.encryptMu.Lock()
+	defer m.encryptMu.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Device lists that changed while the state was being resynced from
+	// scratch would be missed, so they're always queried again.
+	if err := m.kv.DropPrefix(db.NewNodePath("devices")); err != nil {
+		log.Println("cannot drop known devices:", err)
+	}
+
+	var account storedAccount
+	m.kv.Node("account").GetAny("account", &account)
+
+	deviceID := m.client.DeviceID
+	if deviceID == "" {
+		_, id, err := m.client.Whoami()
+		switch {
+		case err == nil && id != "":
+			deviceID = id
+		case account.Account != nil:
+			// Assume that the device is the same, since the access token
+			// would've been invalidated otherwise.
+			deviceID = account.DeviceID
+		case err != nil:
+			return errors.Wrap(err, "failed to get device ID")
+		default:
+			return errors.New("homeserver didn't return a device ID")
+		}
+	}
+
+	if account.Account == nil || account.DeviceID != deviceID {
+		if account.Account != nil {
+			log.Printf("device changed from %q to %q, dropping old crypto sessions",
+				account.DeviceID, deviceID)
+			m.reset()
+		}
+
+		a, err := olm.NewAccount()
+		if err != nil {
+			return errors.Wrap(err, "failed to create account")
+		}
+
+		account = storedAccount{DeviceID: deviceID, Account: a}
+		if err := m.saveAccount(&account); err != nil {
+			return err
+		}
+	}
+
+	m.account = &account
+
+	if !account.Uploaded {
+		return m.uploadKeys(true, olm.MaxOneTimeKeys/2)
+	}
+
+	return nil
+}
+
+// reset drops the sessions of the old device. Inbound group sessions are kept,
+// since they can still decrypt old messages.
+func (m *Machine) reset() {
+	for _, name := range []string{"olm", "outbound"} {
+		if err := m.kv.DropPrefix(db.NewNodePath(name)); err != nil {
+			log.Printf("cannot drop crypto %s: %v", name, err)
+		}
+	}
+}
+
+func (m *Machine) saveAccount(account *storedAccount) error {
+	if err := m.kv.Node("account").SetAny("account", account); err != nil {
+		return errors.Wrap(err, "failed to save account")
+	}
+	return nil
+}
+
+// DeviceID returns the ID of the device, or an empty string if the machine
+// isn't started.
+func (m *Machine) DeviceID() matrix.DeviceID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.account == nil {
+		return ""
+	}
+	return m.account.DeviceID
+}
+
+// Fingerprint returns the Ed25519 key of the device, which other users can
+// compare to verify the device. An empty string is returned if the machine
+// isn't started.
+func (m *Machine) Fingerprint() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.account == nil {
+		return ""
+	}
+	return m.account.Account.Ed25519()
+}
@@ -0,0 +1,184 @@
+package e2ee
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/encryption"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/internal/db"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	keyExportVersion = 0x01
+	// keyExportRounds is the number of PBKDF2 rounds, which is the same as
+	// other clients use.
+	keyExportRounds = 500000
+	// keyExportLineLength is the length of the base64 lines in the armored
+	// key export.
+	keyExportLineLength = 96
+
+	keyExportHeader = "-----BEGIN MEGOLM SESSION DATA-----"
+	keyExportFooter = "-----END MEGOLM SESSION DATA-----"
+)
+
+// ExportedRoomKey is a Megolm session in the key export format that other
+// clients can import.
+type ExportedRoomKey struct {
+	Algorithm         encryption.Algorithm `json:"algorithm"`
+	ForwardingChain   []string             `json:"forwarding_curve25519_key_chain"`
+	RoomID            matrix.RoomID        `json:"room_id"`
+	SenderKey         string               `json:"sender_key"`
+	SenderClaimedKeys map[string]string    `json:"sender_claimed_keys"`
+	SessionID         string               `json:"session_id"`
+	SessionKey        string               `json:"session_key"`
+}
+
+// ExportRoomKeys returns all inbound group sessions, which can decrypt the
+// messages that the device has received.
+func (m *Machine) ExportRoomKeys() ([]ExportedRoomKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys []ExportedRoomKey
+
+	// Sessions are stored under inbound/room/sender/session. The nested
+	// buckets are listed one level at a time, since read transactions
+	// shouldn't be nested.
+	rooms, err := nodeNames(m.kv.Node("inbound"))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list rooms")
+	}
+
+	for _, roomID := range rooms {
+		senders, err := nodeNames(m.kv.Node("inbound", roomID))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list senders")
+		}
+
+		for _, senderKey := range senders {
+			node := m.kv.Node("inbound", roomID, senderKey)
+
+			err := node.Each(func(sessionID string, b []byte, _ int) error {
+				var session inboundSession
+				if err := node.Unmarshal(b, &session); err != nil || session.Session == nil {
+					return nil
+				}
+
+				key := ExportedRoomKey{
+					Algorithm:         encryption.Megolm,
+					ForwardingChain:   []string{},
+					RoomID:            matrix.RoomID(roomID),
+					SenderKey:         senderKey,
+					SenderClaimedKeys: map[string]string{},
+					SessionID:         sessionID,
+					SessionKey:        session.Session.Export(),
+				}
+
+				if session.SigningKey != "" {
+					key.SenderClaimedKeys["ed25519"] = session.SigningKey
+				}
+
+				keys = append(keys, key)
+				return nil
+			})
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read inbound sessions")
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// nodeNames returns the names of the keys in the node.
+func nodeNames(node db.Node) ([]string, error) {
+	var names []string
+	err := node.Each(func(k string, _ []byte, _ int) error {
+		names = append(names, k)
+		return nil
+	})
+	return names, err
+}
+
+// EncryptKeyExport encrypts the room keys with the given passphrase into the
+// armored key export format, which is what other clients import from a file.
+func EncryptKeyExport(keys []ExportedRoomKey, passphrase string) ([]byte, error) {
+	return encryptKeyExport(keys, passphrase, keyExportRounds)
+}
+
+func encryptKeyExport(keys []ExportedRoomKey, passphrase string, rounds uint32) ([]byte, error) {
+	if keys == nil {
+		keys = []ExportedRoomKey{}
+	}
+
+	plaintext, err := json.Marshal(keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal room keys")
+	}
+
+	// salt and iv are next to each other in the header.
+	random := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return nil, errors.Wrap(err, "failed to read random bytes")
+	}
+
+	salt := random[:16]
+	iv := random[16:]
+	// Clear bit 63 of the counter so that it doesn't wrap around.
+	iv[8] &= 0x7F
+
+	aesKey, macKey := keyExportKeys(passphrase, salt, rounds)
+
+	data := make([]byte, 0, 1+16+16+4+len(plaintext)+sha256.Size)
+	data = append(data, keyExportVersion)
+	data = append(data, salt...)
+	data = append(data, iv...)
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], rounds)
+
+	block, _ := aes.NewCipher(aesKey)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, plaintext)
+	data = append(data, ciphertext...)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(data)
+	data = mac.Sum(data)
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+
+	var out bytes.Buffer
+	out.WriteString(keyExportHeader)
+	out.WriteByte('\n')
+	for len(encoded) > 0 {
+		n := keyExportLineLength
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		out.WriteString(encoded[:n])
+		out.WriteByte('\n')
+		encoded = encoded[n:]
+	}
+	out.WriteString(keyExportFooter)
+	out.WriteByte('\n')
+
+	return out.Bytes(), nil
+}
+
+// keyExportKeys derives the AES and HMAC keys of a key export.
+func keyExportKeys(passphrase string, salt []byte, rounds uint32) (aesKey, macKey []byte) {
+	keys := pbkdf2.Key([]byte(passphrase), salt, int(rounds), 64, sha512.New)
+	return keys[:32], keys[32:]
+}
@@ -0,0 +1,123 @@
+package e2ee
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/e2ee/olm"
+)
+
+func TestExportRoomKeys(t *testing.T) {
+	m, outbound := newTestMachine(t)
+
+	keys, err := m.ExportRoomKeys()
+	if err != nil {
+		t.Fatal("cannot export room keys:", err)
+	}
+
+	if len(keys) != 1 {
+		t.Fatalf("exported %d room keys", len(keys))
+	}
+
+	key := keys[0]
+	if key.RoomID != testRoomID || key.SenderKey != testSenderKey || key.SessionID != outbound.ID() {
+		t.Fatalf("unexpected room key %+v", key)
+	}
+
+	session, _ := olm.NewInboundGroupSession(outbound.SessionKey())
+	if key.SessionKey != session.Export() {
+		t.Fatalf("session key mismatch:\n-> %s\n<- %s", session.Export(), key.SessionKey)
+	}
+}
+
+// decryptKeyExport decrypts the armored key export as described by the
+// specification.
+func decryptKeyExport(t *testing.T, armored []byte, passphrase string) []ExportedRoomKey {
+	t.Helper()
+
+	lines := strings.Split(strings.TrimSpace(string(armored)), "\n")
+	if lines[0] != keyExportHeader || lines[len(lines)-1] != keyExportFooter {
+		t.Fatalf("key export isn't armored:\n%s", armored)
+	}
+
+	for _, line := range lines[1 : len(lines)-1] {
+		if len(line) > keyExportLineLength {
+			t.Fatalf("key export line is %d long", len(line))
+		}
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.Join(lines[1:len(lines)-1], ""))
+	if err != nil {
+		t.Fatal("invalid key export encoding:", err)
+	}
+
+	if data[0] != keyExportVersion {
+		t.Fatalf("key export has version %d", data[0])
+	}
+
+	salt := data[1:17]
+	iv := data[17:33]
+	rounds := binary.BigEndian.Uint32(data[33:37])
+	ciphertext := data[37 : len(data)-sha256.Size]
+
+	if iv[8]&0x80 != 0 {
+		t.Fatal("bit 63 of the IV is set")
+	}
+
+	aesKey, macKey := keyExportKeys(passphrase, salt, rounds)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(data[:len(data)-sha256.Size])
+	if !hmac.Equal(mac.Sum(nil), data[len(data)-sha256.Size:]) {
+		t.Fatal("key export has a bad MAC")
+	}
+
+	block, _ := aes.NewCipher(aesKey)
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, iv).XORKeyStream(plaintext, ciphertext)
+
+	var keys []ExportedRoomKey
+	if err := json.Unmarshal(plaintext, &keys); err != nil {
+		t.Fatalf("invalid key export payload %q: %v", plaintext, err)
+	}
+
+	return keys
+}
+
+func TestEncryptKeyExport(t *testing.T) {
+	m, _ := newTestMachine(t)
+
+	keys, err := m.ExportRoomKeys()
+	if err != nil {
+		t.Fatal("cannot export room keys:", err)
+	}
+
+	armored, err := encryptKeyExport(keys, "correcthorsebatterystaple", 10)
+	if err != nil {
+		t.Fatal("cannot encrypt key export:", err)
+	}
+
+	decrypted := decryptKeyExport(t, armored, "correcthorsebatterystaple")
+	if len(decrypted) != 1 || decrypted[0].SessionKey != keys[0].SessionKey {
+		t.Fatalf("decrypted keys mismatch:\n-> %+v\n<- %+v", keys, decrypted)
+	}
+}
+
+func TestEncryptKeyExportEmpty(t *testing.T) {
+	armored, err := encryptKeyExport(nil, "passphrase", 10)
+	if err != nil {
+		t.Fatal("cannot encrypt key export:", err)
+	}
+
+	// Other clients expect an array, even if it's empty.
+	if keys := decryptKeyExport(t, armored, "passphrase"); keys == nil {
+		t.Fatal("empty key export isn't an array")
+	}
+}
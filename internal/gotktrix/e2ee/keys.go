@@ -0,0 +1,354 @@
+package e2ee
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"log"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/e2ee/olm"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/encryption"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// signedCurve25519 is the algorithm of uploaded one-time keys.
+const signedCurve25519 = "signed_curve25519"
+
+// Signatures maps user IDs to their signatures of an object, keyed by
+// "algorithm:key ID".
+type Signatures map[matrix.UserID]map[string]string
+
+// DeviceKeys is the identity of a device as it's uploaded.
+type DeviceKeys struct {
+	UserID     matrix.UserID          `json:"user_id"`
+	DeviceID   matrix.DeviceID        `json:"device_id"`
+	Algorithms []encryption.Algorithm `json:"algorithms"`
+	Keys       map[string]string      `json:"keys"`
+	Signatures Signatures             `json:"signatures,omitempty"`
+}
+
+// Curve25519 returns the identity key of the device.
+func (k DeviceKeys) Curve25519() string {
+	return k.Keys["curve25519:"+string(k.DeviceID)]
+}
+
+// Ed25519 returns the fingerprint key of the device.
+func (k DeviceKeys) Ed25519() string {
+	return k.Keys["ed25519:"+string(k.DeviceID)]
+}
+
+// signedKey is a one-time key as it's uploaded.
+type signedKey struct {
+	Key        string     `json:"key"`
+	Signatures Signatures `json:"signatures,omitempty"`
+}
+
+// canonicalJSON encodes v as canonical JSON without its signatures and unsigned
+// fields, which is what is signed.
+func canonicalJSON(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	delete(obj, "signatures")
+	delete(obj, "unsigned")
+
+	// Maps are marshaled with sorted keys.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(obj); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// sign signs the object as this device.
+func (m *Machine) sign(v interface{}) (Signatures, error) {
+	b, err := canonicalJSON(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode signed object")
+	}
+
+	return Signatures{
+		m.client.UserID: {
+			"ed25519:" + string(m.account.DeviceID): m.account.Account.Sign(b),
+		},
+	}, nil
+}
+
+// verify checks the signature of the object by the given device.
+func verify(v interface{}, sigs Signatures, userID matrix.UserID, deviceID matrix.DeviceID, key string) bool {
+	sig, ok := sigs[userID]["ed25519:"+string(deviceID)]
+	if !ok {
+		return false
+	}
+
+	pub, err := olm.Encoding.DecodeString(key)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+
+	rawSig, err := olm.Encoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	b, err := canonicalJSON(v)
+	if err != nil {
+		return false
+	}
+
+	return ed25519.Verify(pub, b, rawSig)
+}
+
+// uploadKeys uploads the device keys if needed and n new one-time keys. The
+// lock must be held.
+func (m *Machine) uploadKeys(deviceKeys bool, n int) error {
+	var body struct {
+		DeviceKeys  *DeviceKeys          `json:"device_keys,omitempty"`
+		OneTimeKeys map[string]signedKey `json:"one_time_keys,omitempty"`
+	}
+
+	account := m.account.Account
+
+	if deviceKeys {
+		keys := DeviceKeys{
+			UserID:     m.client.UserID,
+			DeviceID:   m.account.DeviceID,
+			Algorithms: []encryption.Algorithm{encryption.Olm, encryption.Megolm},
+			Keys: map[string]string{
+				"curve25519:" + string(m.account.DeviceID): account.Curve25519(),
+				"ed25519:" + string(m.account.DeviceID):    account.Ed25519(),
+			},
+		}
+
+		sigs, err := m.sign(keys)
+		if err != nil {
+			return err
+		}
+
+		keys.Signatures = sigs
+		body.DeviceKeys = &keys
+	}
+
+	if n > 0 {
+		if err := account.GenerateOneTimeKeys(n); err != nil {
+			return errors.Wrap(err, "failed to generate one-time keys")
+		}
+	}
+
+	unpublished := account.UnpublishedOneTimeKeys()
+	if len(unpublished) > 0 {
+		body.OneTimeKeys = make(map[string]signedKey, len(unpublished))
+
+		for _, key := range unpublished {
+			signed := signedKey{Key: olm.Encoding.EncodeToString(key.Key.Public)}
+
+			sigs, err := m.sign(signed)
+			if err != nil {
+				return err
+			}
+
+			signed.Signatures = sigs
+			body.OneTimeKeys[signedCurve25519+":"+key.KeyID()] = signed
+		}
+	}
+
+	// Save the new one-time keys first, since they can be claimed as soon as
+	// they're uploaded.
+	if err := m.saveAccount(m.account); err != nil {
+		return err
+	}
+
+	err := m.client.Request(
+		"POST", m.client.Endpoints.Base()+"/keys/upload", nil,
+		httputil.WithToken(), httputil.WithJSONBody(body),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to upload keys")
+	}
+
+	account.MarkKeysAsPublished()
+	m.account.Uploaded = true
+
+	return m.saveAccount(m.account)
+}
+
+// replenishKeys uploads more one-time keys in the background if the homeserver
+// is running low on them, along with the device keys if they haven't been
+// uploaded yet. The lock must be held.
+func (m *Machine) replenishKeys(count int) {
+	const target = olm.MaxOneTimeKeys / 2
+
+	if m.uploading || (count >= target && m.account.Uploaded) {
+		return
+	}
+
+	m.uploading = true
+
+	go func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.uploading = false
+
+		n := target - count
+		if n < 0 {
+			n = 0
+		}
+
+		if err := m.uploadKeys(!m.account.Uploaded, n); err != nil {
+			log.Println("cannot upload encryption keys:", err)
+		}
+	}()
+}
+
+// devices returns the known devices of the given users, querying the ones
+// that aren't known. The lock doesn't need to be held, since only the database
+// is used.
+func (m *Machine) devices(userIDs []matrix.UserID) (map[matrix.UserID]map[matrix.DeviceID]DeviceKeys, error) {
+	devices := make(map[matrix.UserID]map[matrix.DeviceID]DeviceKeys, len(userIDs))
+	query := make(map[matrix.UserID][]matrix.DeviceID)
+
+	node := m.kv.Node("devices")
+
+	for _, userID := range userIDs {
+		var known map[matrix.DeviceID]DeviceKeys
+		if err := node.GetAny(string(userID), &known); err != nil {
+			query[userID] = []matrix.DeviceID{}
+			continue
+		}
+		devices[userID] = known
+	}
+
+	if len(query) == 0 {
+		return devices, nil
+	}
+
+	var resp struct {
+		DeviceKeys map[matrix.UserID]map[matrix.DeviceID]json.RawMessage `json:"device_keys"`
+	}
+
+	err := m.client.Request(
+		"POST", m.client.Endpoints.Base()+"/keys/query", &resp,
+		httputil.WithToken(), httputil.WithJSONBody(map[string]interface{}{
+			"device_keys": query,
+			"timeout":     10000,
+		}),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to query device keys")
+	}
+
+	for userID := range query {
+		known := make(map[matrix.DeviceID]DeviceKeys, len(resp.DeviceKeys[userID]))
+
+		for deviceID, raw := range resp.DeviceKeys[userID] {
+			var keys DeviceKeys
+			if err := json.Unmarshal(raw, &keys); err != nil {
+				continue
+			}
+
+			// The raw object is what's signed, since it may have fields that
+			// aren't known here.
+			if keys.UserID != userID || keys.DeviceID != deviceID ||
+				!verify(raw, keys.Signatures, userID, deviceID, keys.Ed25519()) {
+				log.Printf("ignoring device %s of %s with invalid keys", deviceID, userID)
+				continue
+			}
+
+			known[deviceID] = keys
+		}
+
+		if err := node.SetAny(string(userID), known); err != nil {
+			log.Println("cannot save device keys:", err)
+		}
+
+		devices[userID] = known
+	}
+
+	return devices, nil
+}
+
+// deviceByKey returns the device with the given identity key.
+func deviceByKey(devices map[matrix.DeviceID]DeviceKeys, identityKey string) (DeviceKeys, bool) {
+	for _, device := range devices {
+		if device.Curve25519() == identityKey {
+			return device, true
+		}
+	}
+	return DeviceKeys{}, false
+}
+
+// forgetDevices marks the devices of the given users as outdated, so that
+// they're queried again.
+func (m *Machine) forgetDevices(userIDs []matrix.UserID) {
+	node := m.kv.Node("devices")
+	for _, userID := range userIDs {
+		node.Delete(string(userID))
+	}
+}
+
+// claimKeys claims a one-time key of each of the given devices. Devices that
+// have run out of keys are left out.
+func (m *Machine) claimKeys(devices []DeviceKeys) (map[matrix.UserID]map[matrix.DeviceID]string, error) {
+	query := make(map[matrix.UserID]map[matrix.DeviceID]string)
+	for _, device := range devices {
+		if query[device.UserID] == nil {
+			query[device.UserID] = make(map[matrix.DeviceID]string)
+		}
+		query[device.UserID][device.DeviceID] = signedCurve25519
+	}
+
+	var resp struct {
+		OneTimeKeys map[matrix.UserID]map[matrix.DeviceID]map[string]json.RawMessage `json:"one_time_keys"`
+	}
+
+	err := m.client.Request(
+		"POST", m.client.Endpoints.Base()+"/keys/claim", &resp,
+		httputil.WithToken(), httputil.WithJSONBody(map[string]interface{}{
+			"one_time_keys": query,
+			"timeout":       10000,
+		}),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to claim one-time keys")
+	}
+
+	claimed := make(map[matrix.UserID]map[matrix.DeviceID]string)
+
+	for _, device := range devices {
+		for _, raw := range resp.OneTimeKeys[device.UserID][device.DeviceID] {
+			var key signedKey
+			if err := json.Unmarshal(raw, &key); err != nil {
+				continue
+			}
+
+			if !verify(raw, key.Signatures, device.UserID, device.DeviceID, device.Ed25519()) {
+				log.Printf("ignoring one-time key of device %s with an invalid signature",
+					device.DeviceID)
+				continue
+			}
+
+			if claimed[device.UserID] == nil {
+				claimed[device.UserID] = make(map[matrix.DeviceID]string)
+			}
+			claimed[device.UserID][device.DeviceID] = key.Key
+		}
+	}
+
+	return claimed, nil
+}
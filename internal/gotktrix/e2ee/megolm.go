@@ -0,0 +1,550 @@
+package e2ee
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/e2ee/olm"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/encryption"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// errNotEncrypted is returned by decryptEvent for events that aren't
+// encrypted.
+var errNotEncrypted = errors.New("event isn't encrypted")
+
+// megolmPayload is the decrypted payload of a Megolm message.
+type megolmPayload struct {
+	Type    event.Type      `json:"type"`
+	Content json.RawMessage `json:"content"`
+	RoomID  matrix.RoomID   `json:"room_id"`
+}
+
+type inboundKey struct {
+	roomID    matrix.RoomID
+	senderKey string
+	sessionID string
+}
+
+// inboundSession is an inbound group session as it's stored.
+type inboundSession struct {
+	Session *olm.InboundGroupSession `json:"session"`
+	// SigningKey is the Ed25519 key of the device that shared the session.
+	SigningKey string `json:"signing_key"`
+
+	// indices maps the message indices decrypted so far to their events. It's
+	// only kept in memory along with the session.
+	indices map[uint32]matrix.EventID
+}
+
+// checkIndex records that the message at the given index belongs to the given
+// event. An error is returned if another event already used the index, since
+// the homeserver is then replaying the message.
+func (s *inboundSession) checkIndex(index uint32, eventID matrix.EventID) error {
+	if s.indices == nil {
+		s.indices = make(map[uint32]matrix.EventID)
+	}
+
+	if seen, ok := s.indices[index]; ok && seen != eventID {
+		return errors.Errorf("message index %d was already used by event %s", index, seen)
+	}
+
+	s.indices[index] = eventID
+	return nil
+}
+
+// outboundSession is an outbound group session as it's stored.
+type outboundSession struct {
+	Session   *olm.OutboundGroupSession `json:"session"`
+	CreatedAt time.Time                 `json:"created_at"`
+	Messages  int                       `json:"messages"`
+	// SharedWith maps users to the devices that have the session's key.
+	SharedWith map[matrix.UserID]map[matrix.DeviceID]bool `json:"shared_with"`
+}
+
+// Room describes an encrypted room to encrypt events for.
+type Room struct {
+	ID       matrix.RoomID
+	Settings *encryption.Event
+	// Members are the users who are joined or invited to the room.
+	Members []matrix.UserID
+}
+
+// RoomSettings returns the encryption settings last seen in the room, or nil if
+// the room was never seen encrypted.
+func (m *Machine) RoomSettings(roomID matrix.RoomID) *encryption.Event {
+	var settings encryption.Event
+	if err := m.kv.Node("rooms").GetAny(string(roomID), &settings); err != nil {
+		return nil
+	}
+	return &settings
+}
+
+// SetRoomSettings remembers that the room is encrypted. Encryption can't be
+// disabled once it's enabled, so the room is never forgotten, even if its state
+// later goes missing.
+func (m *Machine) SetRoomSettings(roomID matrix.RoomID, settings *encryption.Event) error {
+	if err := m.kv.Node("rooms").SetAny(string(roomID), settings); err != nil {
+		return errors.Wrap(err, "failed to save room settings")
+	}
+	return nil
+}
+
+// addRoomKey stores the Megolm session shared by the device with the given
+// keys. A session that's already known isn't replaced, unless the new one can
+// decrypt earlier messages.
+func (m *Machine) addRoomKey(senderKey, signingKey string, key encryption.RoomKey) error {
+	if key.Algorithm != encryption.Megolm {
+		return errors.Errorf("unknown room key algorithm %q", key.Algorithm)
+	}
+
+	session, err := olm.NewInboundGroupSession(key.SessionKey)
+	if err != nil {
+		return errors.Wrap(err, "invalid room key")
+	}
+
+	if session.ID() != key.SessionID {
+		return errors.New("room key has a mismatching session ID")
+	}
+
+	k := inboundKey{key.RoomID, senderKey, key.SessionID}
+	if old := m.inboundSession(k); old != nil {
+		if old.Session.FirstKnownIndex() <= session.FirstKnownIndex() {
+			return nil
+		}
+	}
+
+	return m.saveInboundSession(k, &inboundSession{
+		Session:    session,
+		SigningKey: signingKey,
+	})
+}
+
+func (m *Machine) inboundSession(k inboundKey) *inboundSession {
+	if session, ok := m.inbound[k]; ok {
+		return session
+	}
+
+	var session inboundSession
+	node := m.kv.Node("inbound", string(k.roomID), k.senderKey)
+	if err := node.GetAny(k.sessionID, &session); err != nil || session.Session == nil {
+		return nil
+	}
+
+	m.inbound[k] = &session
+	return &session
+}
+
+func (m *Machine) saveInboundSession(k inboundKey, session *inboundSession) error {
+	node := m.kv.Node("inbound", string(k.roomID), k.senderKey)
+	if err := node.SetAny(k.sessionID, session); err != nil {
+		return errors.Wrap(err, "failed to save inbound session")
+	}
+
+	m.inbound[k] = session
+	return nil
+}
+
+// DecryptEvent returns the decrypted version of the given raw room event. The
+// event is returned as-is if it's not encrypted or can't be decrypted.
+func (m *Machine) DecryptEvent(roomID matrix.RoomID, raw event.RawEvent) event.RawEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.account == nil {
+		return raw
+	}
+
+	decrypted, err := m.decryptEvent(roomID, raw)
+	if err != nil {
+		if !errors.Is(err, errNotEncrypted) {
+			log.Printf("cannot decrypt event in room %s: %v", roomID, err)
+		}
+		return raw
+	}
+
+	return decrypted
+}
+
+// DecryptEvents decrypts the given raw room events in place.
+func (m *Machine) DecryptEvents(roomID matrix.RoomID, raws []event.RawEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.account != nil {
+		m.decryptEvents(roomID, raws)
+	}
+}
+
+func (m *Machine) decryptEvents(roomID matrix.RoomID, raws []event.RawEvent) {
+	for i, raw := range raws {
+		decrypted, err := m.decryptEvent(roomID, raw)
+		if err != nil {
+			if !errors.Is(err, errNotEncrypted) {
+				log.Printf("cannot decrypt event in room %s: %v", roomID, err)
+			}
+			continue
+		}
+		raws[i] = decrypted
+	}
+}
+
+func (m *Machine) decryptEvent(roomID matrix.RoomID, raw event.RawEvent) (event.RawEvent, error) {
+	var ev struct {
+		ID      matrix.EventID              `json:"event_id"`
+		Type    event.Type                  `json:"type"`
+		Sender  matrix.UserID               `json:"sender"`
+		Content encryption.EncryptedContent `json:"content"`
+	}
+
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		return nil, errNotEncrypted
+	}
+
+	// Redacted events have their content removed, so there's nothing to
+	// decrypt.
+	if ev.Type != encryption.EncryptedEventType || ev.Content.Algorithm == "" {
+		return nil, errNotEncrypted
+	}
+
+	if ev.Content.Algorithm != encryption.Megolm {
+		return nil, errors.Errorf("unknown algorithm %q", ev.Content.Algorithm)
+	}
+
+	var ciphertext string
+	if err := json.Unmarshal(ev.Content.Ciphertext, &ciphertext); err != nil {
+		return nil, errors.Wrap(err, "invalid ciphertext")
+	}
+
+	// Check that the session belongs to the sender if we know their devices.
+	var devices map[matrix.DeviceID]DeviceKeys
+	if m.kv.Node("devices").GetAny(string(ev.Sender), &devices) == nil {
+		device, ok := devices[ev.Content.DeviceID]
+		if ok && device.Curve25519() != ev.Content.SenderKey {
+			return nil, errors.New("sender key doesn't belong to the sender's device")
+		}
+	}
+
+	session := m.inboundSession(inboundKey{roomID, ev.Content.SenderKey, ev.Content.SessionID})
+	if session == nil {
+		return nil, errors.Errorf("unknown session %s", ev.Content.SessionID)
+	}
+
+	plaintext, index, err := session.Session.Decrypt(ciphertext)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt")
+	}
+
+	if err := session.checkIndex(index, ev.ID); err != nil {
+		return nil, err
+	}
+
+	var payload megolmPayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, errors.Wrap(err, "invalid payload")
+	}
+
+	if payload.RoomID != roomID {
+		return nil, errors.New("payload is for another room")
+	}
+
+	content := payload.Content
+
+	// Relations are kept unencrypted, so they may be missing from the
+	// payload.
+	if ev.Content.RelatesTo != nil {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(content, &fields); err == nil {
+			if _, ok := fields["m.relates_to"]; !ok {
+				fields["m.relates_to"] = ev.Content.RelatesTo
+				content, _ = json.Marshal(fields)
+			}
+		}
+	}
+
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, errNotEncrypted
+	}
+
+	obj["type"], _ = json.Marshal(payload.Type)
+	obj["content"] = content
+
+	decrypted, err := json.Marshal(obj)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal decrypted event")
+	}
+
+	return decrypted, nil
+}
+
+// Encrypt encrypts the content of an event to be sent to the room. The room
+// key is shared with the devices of the room's members that don't have it
+// yet.
+//
+// The machine is only locked while the sessions are used, so that syncing and
+// decrypting aren't held up by the requests made to share the room key.
+func (m *Machine) Encrypt(room Room, typ event.Type, content interface{}) (*encryption.EncryptedContent, error) {
+	m.encryptMu.Lock()
+	defer m.encryptMu.Unlock()
+
+	m.mu.Lock()
+	account := m.account
+	m.mu.Unlock()
+
+	if account == nil {
+		return nil, ErrNotStarted
+	}
+
+	plaintext, err := json.Marshal(struct {
+		Type    event.Type    `json:"type"`
+		Content interface{}   `json:"content"`
+		RoomID  matrix.RoomID `json:"room_id"`
+	}{
+		Type:    typ,
+		Content: content,
+		RoomID:  room.ID,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal payload")
+	}
+
+	devices, err := m.devices(room.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	session, err := m.outboundSession(room, devices)
+	m.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.shareRoomKey(account, room.ID, session, devices); err != nil {
+		return nil, err
+	}
+
+	ciphertext, _ := json.Marshal(session.Session.Encrypt(plaintext))
+	session.Messages++
+
+	if err := m.kv.Node("outbound").SetAny(string(room.ID), session); err != nil {
+		return nil, errors.Wrap(err, "failed to save outbound session")
+	}
+
+	encrypted := encryption.EncryptedContent{
+		Algorithm:  encryption.Megolm,
+		SenderKey:  account.Account.Curve25519(),
+		Ciphertext: ciphertext,
+		SessionID:  session.Session.ID(),
+		DeviceID:   account.DeviceID,
+	}
+
+	// Keep the relation visible to the homeserver.
+	b, _ := json.Marshal(content)
+	var relation struct {
+		RelatesTo json.RawMessage `json:"m.relates_to"`
+	}
+	if json.Unmarshal(b, &relation) == nil {
+		encrypted.RelatesTo = relation.RelatesTo
+	}
+
+	return &encrypted, nil
+}
+
+// outboundSession returns the current outbound session of the room, or a new
+// one if it has expired or someone who had its key is gone. The lock must be
+// held.
+func (m *Machine) outboundSession(
+	room Room, devices map[matrix.UserID]map[matrix.DeviceID]DeviceKeys) (*outboundSession, error) {
+
+	var session outboundSession
+	m.kv.Node("outbound").GetAny(string(room.ID), &session)
+
+	if session.Session != nil && !sessionExpired(&session, room, devices) {
+		return &session, nil
+	}
+
+	s, err := olm.NewOutboundGroupSession()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create outbound session")
+	}
+
+	session = outboundSession{
+		Session:    s,
+		CreatedAt:  time.Now(),
+		SharedWith: make(map[matrix.UserID]map[matrix.DeviceID]bool),
+	}
+
+	// Keep the key so that our own messages can be decrypted too.
+	inbound, err := olm.NewInboundGroupSession(s.SessionKey())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create own inbound session")
+	}
+
+	err = m.saveInboundSession(
+		inboundKey{room.ID, m.account.Account.Curve25519(), s.ID()},
+		&inboundSession{Session: inbound, SigningKey: m.account.Account.Ed25519()},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func sessionExpired(
+	session *outboundSession, room Room, devices map[matrix.UserID]map[matrix.DeviceID]DeviceKeys) bool {
+
+	settings := room.Settings
+	if settings == nil {
+		settings = &encryption.Event{}
+	}
+
+	if session.Messages >= settings.RotationMessages() ||
+		time.Since(session.CreatedAt) >= settings.RotationPeriod() {
+		return true
+	}
+
+	// Anyone who left or removed a device must not be able to read new
+	// messages.
+	for userID, shared := range session.SharedWith {
+		for deviceID := range shared {
+			if _, ok := devices[userID][deviceID]; !ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// shareRoomKey sends the session's key to the devices that don't have it yet.
+// The lock must not be held, since it's only taken while the Olm sessions are
+// used.
+func (m *Machine) shareRoomKey(account *storedAccount,
+	roomID matrix.RoomID, session *outboundSession, devices map[matrix.UserID]map[matrix.DeviceID]DeviceKeys) error {
+
+	var pending []DeviceKeys
+	for userID, userDevices := range devices {
+		for deviceID, device := range userDevices {
+			if userID == m.client.UserID && deviceID == account.DeviceID {
+				continue
+			}
+			if session.SharedWith[userID][deviceID] {
+				continue
+			}
+			if device.Curve25519() == "" || device.Ed25519() == "" {
+				continue
+			}
+			pending = append(pending, device)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var unclaimed []DeviceKeys
+	for _, device := range pending {
+		if len(m.olmSessions(device.Curve25519())) == 0 {
+			unclaimed = append(unclaimed, device)
+		}
+	}
+
+	var claimed map[matrix.UserID]map[matrix.DeviceID]string
+	if len(unclaimed) > 0 {
+		var err error
+		claimed, err = m.claimKeys(unclaimed)
+		if err != nil {
+			return err
+		}
+	}
+
+	roomKey := encryption.RoomKey{
+		Algorithm:  encryption.Megolm,
+		RoomID:     roomID,
+		SessionID:  session.Session.ID(),
+		SessionKey: session.Session.SessionKey(),
+	}
+
+	messages := m.encryptRoomKey(pending, claimed, roomKey)
+	if len(messages) == 0 {
+		return nil
+	}
+
+	if err := m.client.SendToDevice(encryption.EncryptedEventType, messages); err != nil {
+		return errors.Wrap(err, "failed to share room key")
+	}
+
+	for userID, userMessages := range messages {
+		if session.SharedWith[userID] == nil {
+			session.SharedWith[userID] = make(map[matrix.DeviceID]bool)
+		}
+		for deviceID := range userMessages {
+			session.SharedWith[userID][deviceID] = true
+		}
+	}
+
+	return nil
+}
+
+// encryptRoomKey encrypts the room key for each of the devices, using the
+// existing Olm session with the device or a new one from its claimed one-time
+// key. Devices without either are left out.
+func (m *Machine) encryptRoomKey(
+	devices []DeviceKeys, claimed map[matrix.UserID]map[matrix.DeviceID]string, roomKey encryption.RoomKey) api.DeviceMessages {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make(api.DeviceMessages)
+
+	for _, device := range devices {
+		s := latestSession(m.olmSessions(device.Curve25519()))
+		if s == nil {
+			key, ok := claimed[device.UserID][device.DeviceID]
+			if !ok {
+				log.Printf("device %s of %s has no one-time keys left", device.DeviceID, device.UserID)
+				continue
+			}
+
+			var err error
+			s, err = m.account.Account.NewOutboundSession(device.Curve25519(), key)
+			if err != nil {
+				log.Printf("cannot create Olm session with device %s: %v", device.DeviceID, err)
+				continue
+			}
+		}
+
+		content, err := m.encryptOlm(s, device, encryption.RoomKeyEventType, roomKey)
+		if err != nil {
+			log.Printf("cannot encrypt room key for device %s: %v", device.DeviceID, err)
+			continue
+		}
+
+		if messages[device.UserID] == nil {
+			messages[device.UserID] = make(map[matrix.DeviceID]interface{})
+		}
+		messages[device.UserID][device.DeviceID] = content
+	}
+
+	return messages
+}
+
+// latestSession picks the session to encrypt with. Sessions that the other
+// device has replied to are preferred, since they're known to work.
+func latestSession(sessions []*olm.Session) *olm.Session {
+	var picked *olm.Session
+	for _, s := range sessions {
+		if picked == nil || (s.ReceivedMessage && !picked.ReceivedMessage) {
+			picked = s
+		}
+	}
+	return picked
+}
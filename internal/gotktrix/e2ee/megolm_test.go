@@ -0,0 +1,217 @@
+package e2ee
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/e2ee/olm"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/encryption"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/internal/db"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+const (
+	testRoomID    matrix.RoomID = "!room:example.com"
+	testSenderKey               = "sender"
+)
+
+// newTestMachine creates a machine that knows the room key of a new outbound
+// session, which is returned to encrypt messages with.
+func newTestMachine(t *testing.T) (*Machine, *olm.OutboundGroupSession) {
+	t.Helper()
+
+	kv, err := db.NewKVFile(filepath.Join(t.TempDir(), "crypto"))
+	if err != nil {
+		t.Fatal("cannot open db:", err)
+	}
+	t.Cleanup(func() { kv.Close() })
+
+	m := &Machine{kv: kv, inbound: make(map[inboundKey]*inboundSession)}
+
+	outbound, err := olm.NewOutboundGroupSession()
+	if err != nil {
+		t.Fatal("cannot create outbound session:", err)
+	}
+
+	err = m.addRoomKey(testSenderKey, "", encryption.RoomKey{
+		Algorithm:  encryption.Megolm,
+		RoomID:     testRoomID,
+		SessionID:  outbound.ID(),
+		SessionKey: outbound.SessionKey(),
+	})
+	if err != nil {
+		t.Fatal("cannot add room key:", err)
+	}
+
+	return m, outbound
+}
+
+// encryptedEvent returns the raw event with the given ID that has the Megolm
+// message as its content.
+func encryptedEvent(t *testing.T, outbound *olm.OutboundGroupSession, id matrix.EventID, ciphertext string) event.RawEvent {
+	t.Helper()
+
+	b, err := json.Marshal(map[string]interface{}{
+		"event_id": id,
+		"type":     encryption.EncryptedEventType,
+		"sender":   "@alice:example.com",
+		"content": map[string]interface{}{
+			"algorithm":  encryption.Megolm,
+			"sender_key": testSenderKey,
+			"ciphertext": ciphertext,
+			"session_id": outbound.ID(),
+			"device_id":  "ALICE",
+		},
+	})
+	if err != nil {
+		t.Fatal("cannot marshal event:", err)
+	}
+
+	return b
+}
+
+func megolmMessage(outbound *olm.OutboundGroupSession, body string) string {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":    "m.room.message",
+		"content": map[string]string{"msgtype": "m.text", "body": body},
+		"room_id": testRoomID,
+	})
+	return outbound.Encrypt(payload)
+}
+
+func TestDecryptEvent(t *testing.T) {
+	m, outbound := newTestMachine(t)
+
+	raw := encryptedEvent(t, outbound, "$first", megolmMessage(outbound, "hello"))
+
+	decrypted, err := m.decryptEvent(testRoomID, raw)
+	if err != nil {
+		t.Fatal("cannot decrypt event:", err)
+	}
+
+	var ev struct {
+		ID      matrix.EventID `json:"event_id"`
+		Type    event.Type     `json:"type"`
+		Content struct {
+			Body string `json:"body"`
+		} `json:"content"`
+	}
+
+	if err := json.Unmarshal(decrypted, &ev); err != nil {
+		t.Fatal("cannot unmarshal decrypted event:", err)
+	}
+
+	if ev.ID != "$first" || ev.Type != "m.room.message" || ev.Content.Body != "hello" {
+		t.Fatalf("unexpected decrypted event %s", decrypted)
+	}
+}
+
+func TestDecryptEventReplayedIndex(t *testing.T) {
+	m, outbound := newTestMachine(t)
+
+	ciphertext := megolmMessage(outbound, "hello")
+
+	if _, err := m.decryptEvent(testRoomID, encryptedEvent(t, outbound, "$first", ciphertext)); err != nil {
+		t.Fatal("cannot decrypt event:", err)
+	}
+
+	// The same event may be decrypted again, such as when it's fetched again
+	// while paginating.
+	if _, err := m.decryptEvent(testRoomID, encryptedEvent(t, outbound, "$first", ciphertext)); err != nil {
+		t.Fatal("cannot decrypt the same event again:", err)
+	}
+
+	// Another event with the same message index is a replay.
+	if _, err := m.decryptEvent(testRoomID, encryptedEvent(t, outbound, "$replay", ciphertext)); err == nil {
+		t.Fatal("replayed message index was decrypted")
+	}
+
+	// Following messages still decrypt.
+	raw := encryptedEvent(t, outbound, "$second", megolmMessage(outbound, "again"))
+	if _, err := m.decryptEvent(testRoomID, raw); err != nil {
+		t.Fatal("cannot decrypt next event:", err)
+	}
+}
+
+func TestDecryptEventWrongRoom(t *testing.T) {
+	m, outbound := newTestMachine(t)
+
+	raw := encryptedEvent(t, outbound, "$first", megolmMessage(outbound, "hello"))
+
+	// The session is only known for its own room.
+	if _, err := m.decryptEvent("!other:example.com", raw); err == nil {
+		t.Fatal("event was decrypted in another room")
+	}
+}
+
+// blockingDriver holds every request until it's released, after which the
+// request fails.
+type blockingDriver struct {
+	requested chan struct{}
+	release   chan struct{}
+}
+
+func (d blockingDriver) Do(*http.Request) (*http.Response, error) {
+	select {
+	case d.requested <- struct{}{}:
+	default:
+	}
+
+	<-d.release
+	return nil, errors.New("offline")
+}
+
+func TestEncryptDoesNotBlockDecrypt(t *testing.T) {
+	m, outbound := newTestMachine(t)
+
+	account, err := olm.NewAccount()
+	if err != nil {
+		t.Fatal("cannot create account:", err)
+	}
+	m.account = &storedAccount{DeviceID: "BOB", Account: account}
+
+	driver := blockingDriver{
+		requested: make(chan struct{}, 1),
+		release:   make(chan struct{}),
+	}
+
+	client := httputil.NewCustomClient(driver)
+	client.HomeServer = "example.com"
+	client.HomeServerScheme = "https"
+	m.client = &api.Client{Client: client, UserID: "@bob:example.com"}
+
+	encrypted := make(chan error)
+	go func() {
+		room := Room{ID: testRoomID, Members: []matrix.UserID{"@alice:example.com"}}
+		_, err := m.Encrypt(room, "m.room.message", map[string]string{"body": "hello"})
+		encrypted <- err
+	}()
+
+	// Wait for the devices of the room's members to be queried.
+	<-driver.requested
+
+	decrypted := make(chan event.RawEvent)
+	go func() {
+		raw := encryptedEvent(t, outbound, "$first", megolmMessage(outbound, "hello"))
+		decrypted <- m.DecryptEvent(testRoomID, raw)
+	}()
+
+	select {
+	case <-decrypted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("decrypting is blocked by the request made while encrypting")
+	}
+
+	close(driver.release)
+
+	if err := <-encrypted; err == nil {
+		t.Fatal("event was encrypted without the devices of the room's members")
+	}
+}
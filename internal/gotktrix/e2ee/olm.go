@@ -0,0 +1,268 @@
+package e2ee
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/e2ee/olm"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/encryption"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// olmPayload is the decrypted payload of an Olm message.
+type olmPayload struct {
+	Type          event.Type        `json:"type"`
+	Content       json.RawMessage   `json:"content"`
+	Sender        matrix.UserID     `json:"sender"`
+	SenderDevice  matrix.DeviceID   `json:"sender_device,omitempty"`
+	Keys          map[string]string `json:"keys"`
+	Recipient     matrix.UserID     `json:"recipient"`
+	RecipientKeys map[string]string `json:"recipient_keys"`
+}
+
+// toDeviceEvent is a to-device event in a sync response.
+type toDeviceEvent struct {
+	Type    event.Type      `json:"type"`
+	Sender  matrix.UserID   `json:"sender"`
+	Content json.RawMessage `json:"content"`
+}
+
+// ProcessSync processes the encryption parts of the sync response. Room keys
+// sent to the device are stored, and the encrypted events in the timelines
+// are replaced with their decrypted versions.
+func (m *Machine) ProcessSync(sync *api.SyncResponse) {
+	// Changed devices are forgotten first, so that a new device that sent a
+	// room key in this sync is queried below.
+	m.forgetDevices(sync.DeviceLists.Changed)
+	m.forgetDevices(sync.DeviceLists.Left)
+
+	var events []toDeviceEvent
+	var senders []matrix.UserID
+
+	for _, raw := range sync.ToDevice.Events {
+		var ev toDeviceEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			continue
+		}
+
+		if ev.Type == encryption.EncryptedEventType {
+			events = append(events, ev)
+			senders = append(senders, ev.Sender)
+		}
+	}
+
+	// The devices of the senders are needed to check the room keys that they
+	// send. They're queried before taking the lock, since that may take a
+	// while.
+	var devices map[matrix.UserID]map[matrix.DeviceID]DeviceKeys
+	if len(senders) > 0 {
+		var err error
+		devices, err = m.devices(senders)
+		if err != nil {
+			log.Println("cannot get devices of to-device senders:", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.account == nil {
+		return
+	}
+
+	for _, ev := range events {
+		if err := m.receiveOlm(ev, devices[ev.Sender]); err != nil {
+			log.Printf("cannot decrypt to-device event from %s: %v", ev.Sender, err)
+		}
+	}
+
+	if count, ok := sync.DeviceOneTimeKeysCount[signedCurve25519]; ok || !m.account.Uploaded {
+		m.replenishKeys(count)
+	}
+
+	for roomID, room := range sync.Rooms.Joined {
+		m.decryptEvents(roomID, room.Timeline.Events)
+	}
+	for roomID, room := range sync.Rooms.Left {
+		m.decryptEvents(roomID, room.Timeline.Events)
+	}
+}
+
+// receiveOlm decrypts an Olm to-device event and handles its payload. The
+// given devices are the known devices of the sender.
+func (m *Machine) receiveOlm(ev toDeviceEvent, devices map[matrix.DeviceID]DeviceKeys) error {
+	var content encryption.EncryptedContent
+	if err := json.Unmarshal(ev.Content, &content); err != nil {
+		return errors.Wrap(err, "invalid encrypted content")
+	}
+
+	if content.Algorithm != encryption.Olm {
+		return errors.Errorf("unknown algorithm %q", content.Algorithm)
+	}
+
+	var ciphertexts encryption.OlmCiphertexts
+	if err := json.Unmarshal(content.Ciphertext, &ciphertexts); err != nil {
+		return errors.Wrap(err, "invalid ciphertext")
+	}
+
+	msg, ok := ciphertexts[m.account.Account.Curve25519()]
+	if !ok {
+		return errors.New("event isn't encrypted for this device")
+	}
+
+	plaintext, err := m.decryptOlm(content.SenderKey, msg)
+	if err != nil {
+		return err
+	}
+
+	var payload olmPayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return errors.Wrap(err, "invalid payload")
+	}
+
+	switch {
+	case payload.Sender != ev.Sender:
+		return errors.New("payload has a mismatching sender")
+	case payload.Recipient != m.client.UserID:
+		return errors.New("payload has a mismatching recipient")
+	case payload.RecipientKeys["ed25519"] != m.account.Account.Ed25519():
+		return errors.New("payload has mismatching recipient keys")
+	}
+
+	// The signing key in the payload is only trusted if it belongs to the
+	// device that the session is with, since the sender could otherwise claim
+	// to be any device.
+	device, ok := deviceByKey(devices, content.SenderKey)
+	switch {
+	case !ok:
+		return errors.New("sender key doesn't belong to any device of the sender")
+	case payload.Keys["ed25519"] != device.Ed25519():
+		return errors.New("payload has mismatching sender keys")
+	case payload.SenderDevice != "" && payload.SenderDevice != device.DeviceID:
+		return errors.New("payload has a mismatching sender device")
+	}
+
+	switch payload.Type {
+	case encryption.RoomKeyEventType:
+		var key encryption.RoomKey
+		if err := json.Unmarshal(payload.Content, &key); err != nil {
+			return errors.Wrap(err, "invalid room key")
+		}
+		return m.addRoomKey(content.SenderKey, device.Ed25519(), key)
+	default:
+		return nil
+	}
+}
+
+// decryptOlm decrypts the message using an existing session with the sender,
+// or a new one if it's a pre-key message for a new session.
+func (m *Machine) decryptOlm(senderKey string, msg encryption.OlmMessage) ([]byte, error) {
+	sessions := m.olmSessions(senderKey)
+
+	for _, session := range sessions {
+		if msg.Type == olm.MessageTypePreKey && !session.MatchesInboundSession(msg.Body) {
+			continue
+		}
+
+		plaintext, err := session.Decrypt(msg.Type, msg.Body)
+		if err != nil {
+			if msg.Type == olm.MessageTypePreKey {
+				// The message is for this session, so no other session can
+				// decrypt it.
+				return nil, errors.Wrap(err, "failed to decrypt with matching session")
+			}
+			continue
+		}
+
+		m.saveOlmSession(senderKey, session)
+		return plaintext, nil
+	}
+
+	if msg.Type != olm.MessageTypePreKey {
+		return nil, errors.New("no session can decrypt the message")
+	}
+
+	session, err := m.account.Account.NewInboundSession(senderKey, msg.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create inbound session")
+	}
+
+	plaintext, err := session.Decrypt(msg.Type, msg.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt with new session")
+	}
+
+	// The used one-time key is now gone from the account.
+	if err := m.saveAccount(m.account); err != nil {
+		return nil, err
+	}
+
+	m.saveOlmSession(senderKey, session)
+	return plaintext, nil
+}
+
+// olmSessions returns the stored Olm sessions with the device with the given
+// identity key.
+func (m *Machine) olmSessions(identityKey string) []*olm.Session {
+	var sessions []*olm.Session
+
+	m.kv.Node("olm", identityKey).Each(func(k string, b []byte, _ int) error {
+		var session olm.Session
+		if err := json.Unmarshal(b, &session); err == nil {
+			sessions = append(sessions, &session)
+		}
+		return nil
+	})
+
+	return sessions
+}
+
+func (m *Machine) saveOlmSession(identityKey string, session *olm.Session) {
+	if err := m.kv.Node("olm", identityKey).SetAny(session.ID(), session); err != nil {
+		log.Println("cannot save Olm session:", err)
+	}
+}
+
+// encryptOlm encrypts the payload for the given device. The payload's sender
+// and recipient fields are filled in.
+func (m *Machine) encryptOlm(
+	session *olm.Session, device DeviceKeys, typ event.Type, content interface{}) (interface{}, error) {
+
+	b, err := json.Marshal(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal content")
+	}
+
+	plaintext, err := json.Marshal(olmPayload{
+		Type:          typ,
+		Content:       b,
+		Sender:        m.client.UserID,
+		SenderDevice:  m.account.DeviceID,
+		Keys:          map[string]string{"ed25519": m.account.Account.Ed25519()},
+		Recipient:     device.UserID,
+		RecipientKeys: map[string]string{"ed25519": device.Ed25519()},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal payload")
+	}
+
+	msgType, body, err := session.Encrypt(plaintext)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt")
+	}
+
+	m.saveOlmSession(device.Curve25519(), session)
+
+	ciphertext, _ := json.Marshal(encryption.OlmCiphertexts{
+		device.Curve25519(): {Type: msgType, Body: body},
+	})
+
+	return encryption.EncryptedContent{
+		Algorithm:  encryption.Olm,
+		SenderKey:  m.account.Account.Curve25519(),
+		Ciphertext: ciphertext,
+	}, nil
+}
@@ -0,0 +1,228 @@
+package olm
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// MaxOneTimeKeys is the maximum number of one-time keys that an account keeps.
+// The oldest keys are forgotten once there are more.
+const MaxOneTimeKeys = 100
+
+// OneTimeKey is a one-time Curve25519 key that other devices claim to start a
+// session with the account.
+type OneTimeKey struct {
+	ID        uint32  `json:"id"`
+	Key       KeyPair `json:"key"`
+	Published bool    `json:"published"`
+}
+
+// KeyID returns the key ID of the one-time key as it's uploaded.
+func (k OneTimeKey) KeyID() string {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], k.ID)
+	return Encoding.EncodeToString(b[:])
+}
+
+// Account holds the long-term identity keys of a device and its one-time keys.
+// It can be marshaled to JSON to be stored.
+type Account struct {
+	IdentityKey KeyPair            `json:"identity_key"`
+	SigningKey  ed25519.PrivateKey `json:"signing_key"`
+	OneTimeKeys []OneTimeKey       `json:"one_time_keys"`
+	NextKeyID   uint32             `json:"next_key_id"`
+}
+
+// NewAccount creates a new account with new identity keys.
+func NewAccount() (*Account, error) {
+	identity, err := NewKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	_, signing, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate Ed25519 key")
+	}
+
+	return &Account{
+		IdentityKey: identity,
+		SigningKey:  signing,
+		NextKeyID:   1,
+	}, nil
+}
+
+// Curve25519 returns the base64 public identity key of the account.
+func (a *Account) Curve25519() string {
+	return Encoding.EncodeToString(a.IdentityKey.Public)
+}
+
+// Ed25519 returns the base64 public signing key of the account.
+func (a *Account) Ed25519() string {
+	return Encoding.EncodeToString(a.SigningKey.Public().(ed25519.PublicKey))
+}
+
+// Sign signs the given message and returns the base64 signature.
+func (a *Account) Sign(message []byte) string {
+	return Encoding.EncodeToString(ed25519.Sign(a.SigningKey, message))
+}
+
+// GenerateOneTimeKeys generates n new one-time keys.
+func (a *Account) GenerateOneTimeKeys(n int) error {
+	for i := 0; i < n; i++ {
+		key, err := NewKeyPair()
+		if err != nil {
+			return err
+		}
+
+		a.OneTimeKeys = append(a.OneTimeKeys, OneTimeKey{
+			ID:  a.NextKeyID,
+			Key: key,
+		})
+		a.NextKeyID++
+	}
+
+	if len(a.OneTimeKeys) > MaxOneTimeKeys {
+		a.OneTimeKeys = a.OneTimeKeys[len(a.OneTimeKeys)-MaxOneTimeKeys:]
+	}
+
+	return nil
+}
+
+// UnpublishedOneTimeKeys returns the one-time keys that haven't been marked as
+// published yet.
+func (a *Account) UnpublishedOneTimeKeys() []OneTimeKey {
+	var keys []OneTimeKey
+	for _, key := range a.OneTimeKeys {
+		if !key.Published {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// MarkKeysAsPublished marks all current one-time keys as published.
+func (a *Account) MarkKeysAsPublished() {
+	for i := range a.OneTimeKeys {
+		a.OneTimeKeys[i].Published = true
+	}
+}
+
+// NewOutboundSession creates a new session to the device with the given
+// identity key and one-time key, which is claimed from the homeserver.
+func (a *Account) NewOutboundSession(theirIdentityKey, theirOneTimeKey string) (*Session, error) {
+	identity, err := decodeKey(theirIdentityKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid identity key")
+	}
+
+	oneTime, err := decodeKey(theirOneTimeKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid one-time key")
+	}
+
+	baseKey, err := NewKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	ratchetKey, err := NewKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := tripleDH(
+		[3]KeyPair{a.IdentityKey, baseKey, baseKey},
+		[3][]byte{oneTime, identity, oneTime},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		AliceIdentityKey: a.IdentityKey.Public,
+		AliceBaseKey:     baseKey.Public,
+		BobOneTimeKey:    oneTime,
+		TheirIdentityKey: identity,
+		Outbound:         true,
+	}
+	s.initialiseAsAlice(secret, ratchetKey)
+
+	return s, nil
+}
+
+// NewInboundSession creates a new session from a pre-key message sent by the
+// device with the given identity key. The one-time key used by the message is
+// removed from the account.
+func (a *Account) NewInboundSession(theirIdentityKey string, body string) (*Session, error) {
+	msg, err := decodePreKeyMessage(body)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := decodeKey(theirIdentityKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid identity key")
+	}
+
+	if !bytesEqual(msg.identityKey, identity) {
+		return nil, errors.New("pre-key message has a mismatching identity key")
+	}
+
+	keyIx := -1
+	for i, key := range a.OneTimeKeys {
+		if bytesEqual(key.Key.Public, msg.oneTimeKey) {
+			keyIx = i
+			break
+		}
+	}
+	if keyIx == -1 {
+		return nil, errors.New("pre-key message uses an unknown one-time key")
+	}
+
+	oneTime := a.OneTimeKeys[keyIx].Key
+
+	inner, err := decodeMessage(msg.message)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := tripleDH(
+		[3]KeyPair{oneTime, a.IdentityKey, oneTime},
+		[3][]byte{identity, msg.baseKey, msg.baseKey},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		AliceIdentityKey: identity,
+		AliceBaseKey:     msg.baseKey,
+		BobOneTimeKey:    oneTime.Public,
+		TheirIdentityKey: identity,
+	}
+	s.initialiseAsBob(secret, inner.ratchetKey)
+
+	a.OneTimeKeys = append(a.OneTimeKeys[:keyIx], a.OneTimeKeys[keyIx+1:]...)
+
+	return s, nil
+}
+
+// tripleDH concatenates the three Diffie-Hellman exchanges of the Olm
+// handshake.
+func tripleDH(ours [3]KeyPair, theirs [3][]byte) ([]byte, error) {
+	secret := make([]byte, 0, 96)
+
+	for i := range ours {
+		s, err := ours[i].sharedSecret(theirs[i])
+		if err != nil {
+			return nil, err
+		}
+		secret = append(secret, s...)
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,308 @@
+package olm
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	megolmRatchetParts  = 4
+	megolmRatchetLength = megolmRatchetParts * 32
+
+	// sessionSharingVersion is the version byte of session keys that are
+	// shared in m.room_key events.
+	sessionSharingVersion = 0x02
+	// sessionExportVersion is the version byte of session keys in key
+	// exports.
+	sessionExportVersion = 0x01
+)
+
+// megolmRatchet is the Megolm ratchet at a message index.
+type megolmRatchet struct {
+	Data    []byte `json:"data"`
+	Counter uint32 `json:"counter"`
+}
+
+func (r *megolmRatchet) part(i int) []byte {
+	return r.Data[i*32 : (i+1)*32]
+}
+
+// rehash sets part to to the hash of part from.
+func (r *megolmRatchet) rehash(from, to int) {
+	copy(r.part(to), hmacSHA256(r.part(from), []byte{byte(to)}))
+}
+
+func (r megolmRatchet) clone() megolmRatchet {
+	r.Data = append([]byte(nil), r.Data...)
+	return r
+}
+
+// advance advances the ratchet by one.
+func (r *megolmRatchet) advance() {
+	r.Counter++
+
+	// Figure out how many parts need to be rekeyed.
+	mask := uint32(0x00FFFFFF)
+	h := 0
+	for h < megolmRatchetParts {
+		if r.Counter&mask == 0 {
+			break
+		}
+		h++
+		mask >>= 8
+	}
+
+	for i := megolmRatchetParts - 1; i >= h; i-- {
+		r.rehash(h, i)
+	}
+}
+
+// advanceTo advances the ratchet to the given index, which must not be before
+// the current one.
+func (r *megolmRatchet) advanceTo(index uint32) {
+	for j := 0; j < megolmRatchetParts; j++ {
+		shift := uint((megolmRatchetParts - j - 1) * 8)
+		mask := ^uint32(0) << shift
+
+		// How many times does this part need to be rehashed? The mask handles
+		// wraparound.
+		steps := ((index >> shift) - (r.Counter >> shift)) & 0xFF
+		if steps == 0 {
+			if index < r.Counter {
+				steps = 0x100
+			} else {
+				continue
+			}
+		}
+
+		// All but the last step only need to bump this part.
+		for ; steps > 1; steps-- {
+			r.rehash(j, j)
+		}
+
+		// The last step also bumps the parts after it.
+		for k := megolmRatchetParts - 1; k >= j; k-- {
+			r.rehash(j, k)
+		}
+
+		r.Counter = index & mask
+	}
+}
+
+func (r *megolmRatchet) cipher() messageCipher {
+	return newMessageCipher(r.Data, "MEGOLM_KEYS")
+}
+
+// OutboundGroupSession is a Megolm session that encrypts messages sent to a
+// room. It can be marshaled to JSON to be stored.
+type OutboundGroupSession struct {
+	Ratchet    megolmRatchet      `json:"ratchet"`
+	SigningKey ed25519.PrivateKey `json:"signing_key"`
+}
+
+// NewOutboundGroupSession creates a new random outbound group session.
+func NewOutboundGroupSession() (*OutboundGroupSession, error) {
+	data := make([]byte, megolmRatchetLength)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		return nil, errors.Wrap(err, "failed to read random bytes")
+	}
+
+	_, signing, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate Ed25519 key")
+	}
+
+	return &OutboundGroupSession{
+		Ratchet:    megolmRatchet{Data: data},
+		SigningKey: signing,
+	}, nil
+}
+
+// ID returns the session ID, which is its base64 public signing key.
+func (s *OutboundGroupSession) ID() string {
+	return Encoding.EncodeToString(s.SigningKey.Public().(ed25519.PublicKey))
+}
+
+// MessageIndex returns the index of the next message.
+func (s *OutboundGroupSession) MessageIndex() uint32 {
+	return s.Ratchet.Counter
+}
+
+// SessionKey returns the base64 session key at the current index, which is
+// shared with other devices so that they can decrypt the following messages.
+func (s *OutboundGroupSession) SessionKey() string {
+	key := make([]byte, 0, 1+4+megolmRatchetLength+32+ed25519.SignatureSize)
+	key = append(key, sessionSharingVersion)
+	key = append(key, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(key[1:], s.Ratchet.Counter)
+	key = append(key, s.Ratchet.Data...)
+	key = append(key, s.SigningKey.Public().(ed25519.PublicKey)...)
+	key = append(key, ed25519.Sign(s.SigningKey, key)...)
+
+	return Encoding.EncodeToString(key)
+}
+
+// Encrypt encrypts the plaintext and returns the base64 message.
+func (s *OutboundGroupSession) Encrypt(plaintext []byte) string {
+	cipher := s.Ratchet.cipher()
+
+	msg := []byte{protocolVersion}
+	msg = appendVarint(msg, 0x08, uint64(s.Ratchet.Counter))
+	msg = appendBytes(msg, 0x12, cipher.encrypt(plaintext))
+	msg = append(msg, cipher.mac(msg)...)
+	msg = append(msg, ed25519.Sign(s.SigningKey, msg)...)
+
+	s.Ratchet.advance()
+
+	return Encoding.EncodeToString(msg)
+}
+
+// InboundGroupSession is a Megolm session that decrypts messages from another
+// device. It can be marshaled to JSON to be stored.
+type InboundGroupSession struct {
+	// Initial is the ratchet at the first known index.
+	Initial megolmRatchet `json:"initial"`
+	// Latest is the ratchet at the latest decrypted index, which saves
+	// rehashing for every new message.
+	Latest     megolmRatchet     `json:"latest"`
+	SigningKey ed25519.PublicKey `json:"signing_key"`
+}
+
+// NewInboundGroupSession creates an inbound group session from the base64
+// session key of an m.room_key event.
+func NewInboundGroupSession(sessionKey string) (*InboundGroupSession, error) {
+	key, err := Encoding.DecodeString(sessionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid session key encoding")
+	}
+
+	if len(key) != 1+4+megolmRatchetLength+32+ed25519.SignatureSize {
+		return nil, errors.New("invalid session key length")
+	}
+	if key[0] != sessionSharingVersion {
+		return nil, errors.New("unknown session key version")
+	}
+
+	signed := key[:len(key)-ed25519.SignatureSize]
+	signingKey := ed25519.PublicKey(signed[len(signed)-32:])
+
+	if !ed25519.Verify(signingKey, signed, key[len(signed):]) {
+		return nil, errors.New("session key has an invalid signature")
+	}
+
+	ratchet := megolmRatchet{
+		Data:    append([]byte(nil), key[5:5+megolmRatchetLength]...),
+		Counter: binary.BigEndian.Uint32(key[1:5]),
+	}
+
+	return &InboundGroupSession{
+		Initial:    ratchet,
+		Latest:     ratchet.clone(),
+		SigningKey: append(ed25519.PublicKey(nil), signingKey...),
+	}, nil
+}
+
+// ID returns the session ID, which is its base64 public signing key.
+func (s *InboundGroupSession) ID() string {
+	return Encoding.EncodeToString(s.SigningKey)
+}
+
+// FirstKnownIndex returns the first message index that the session can
+// decrypt.
+func (s *InboundGroupSession) FirstKnownIndex() uint32 {
+	return s.Initial.Counter
+}
+
+// Export returns the base64 session key at the first known index in the format
+// of key exports. Unlike shared session keys, it isn't signed.
+func (s *InboundGroupSession) Export() string {
+	key := make([]byte, 0, 1+4+megolmRatchetLength+32)
+	key = append(key, sessionExportVersion)
+	key = append(key, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(key[1:], s.Initial.Counter)
+	key = append(key, s.Initial.Data...)
+	key = append(key, s.SigningKey...)
+
+	return Encoding.EncodeToString(key)
+}
+
+// Decrypt decrypts the base64 message and returns the plaintext along with its
+// message index.
+func (s *InboundGroupSession) Decrypt(body string) ([]byte, uint32, error) {
+	raw, err := Encoding.DecodeString(body)
+	if err != nil {
+		return nil, 0, errors.Wrap(ErrBadMessage, "invalid message encoding")
+	}
+
+	if len(raw) < 1+macLength+ed25519.SignatureSize {
+		return nil, 0, ErrBadMessage
+	}
+
+	signed := raw[:len(raw)-ed25519.SignatureSize]
+	if !ed25519.Verify(s.SigningKey, signed, raw[len(signed):]) {
+		return nil, 0, errors.New("message has an invalid signature")
+	}
+
+	payload, err := checkVersion(signed[:len(signed)-macLength])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fields, err := decodeFields(payload)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var index uint32
+	var ciphertext []byte
+	var hasIndex bool
+
+	for _, f := range fields {
+		switch f.tag {
+		case 0x08:
+			index = uint32(f.varint)
+			hasIndex = true
+		case 0x12:
+			ciphertext = f.bytes
+		}
+	}
+
+	if !hasIndex || ciphertext == nil {
+		return nil, 0, errors.Wrap(ErrBadMessage, "message is missing fields")
+	}
+
+	if index < s.Initial.Counter {
+		return nil, 0, errors.Errorf(
+			"message index %d is before the first known index %d", index, s.Initial.Counter)
+	}
+
+	var ratchet megolmRatchet
+	latest := index >= s.Latest.Counter
+	if latest {
+		ratchet = s.Latest.clone()
+	} else {
+		ratchet = s.Initial.clone()
+	}
+
+	ratchet.advanceTo(index)
+
+	cipher := ratchet.cipher()
+	if !cipher.verifyMAC(signed) {
+		return nil, 0, ErrBadMAC
+	}
+
+	plaintext, err := cipher.decrypt(ciphertext)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if latest {
+		s.Latest = ratchet
+	}
+
+	return plaintext, index, nil
+}
@@ -0,0 +1,312 @@
+package olm
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+)
+
+// specRatchet computes the Megolm ratchet at the given index straight from the
+// definition of R(i,j) in the Megolm specification: every time a byte of the
+// index counts up, its part and all parts after it are rehashed from the value
+// that part had before, e.g. R(i,3) = H3(R(2^8(p-1),2)) for i = 2^8 p.
+func specRatchet(initial []byte, index uint32) []byte {
+	h := func(part int, key []byte, n uint32) []byte {
+		for ; n > 0; n-- {
+			key = hmacSHA256(key, []byte{byte(part)})
+		}
+		return key
+	}
+
+	digits := [megolmRatchetParts]uint32{
+		index >> 24 & 0xFF,
+		index >> 16 & 0xFF,
+		index >> 8 & 0xFF,
+		index & 0xFF,
+	}
+
+	// before holds each part as it was before its byte last counted up.
+	var parts, before [megolmRatchetParts][]byte
+
+	for j := range parts {
+		// Find the last part before j that counted up, which seeds this part.
+		base := initial[j*32 : (j+1)*32]
+		for k := j - 1; k >= 0; k-- {
+			if digits[k] > 0 {
+				base = h(j, before[k], 1)
+				break
+			}
+		}
+
+		if digits[j] > 0 {
+			before[j] = h(j, base, digits[j]-1)
+		}
+		parts[j] = h(j, base, digits[j])
+	}
+
+	return bytes.Join(parts[:], nil)
+}
+
+func testRatchetData() []byte {
+	data := make([]byte, megolmRatchetLength)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+func TestMegolmRatchetAdvanceTo(t *testing.T) {
+	indices := []uint32{
+		0,
+		1,
+		2,
+		1 << 8,
+		1<<8 + 1,
+		1 << 16,
+		1<<16 + 1<<8 + 3,
+		1 << 24,
+		1<<24 + 1<<16 + 1<<8 + 1,
+		0xFFFFFFFF,
+	}
+
+	for _, index := range indices {
+		r := megolmRatchet{Data: testRatchetData()}
+		r.advanceTo(index)
+
+		if r.Counter != index {
+			t.Errorf("index %#x: counter is %#x", index, r.Counter)
+		}
+
+		expect := specRatchet(testRatchetData(), index)
+		if !bytes.Equal(r.Data, expect) {
+			t.Errorf("index %#x: ratchet mismatch:\n-> %x\n<- %x", index, expect, r.Data)
+		}
+	}
+}
+
+func TestMegolmRatchetAdvance(t *testing.T) {
+	// Step one at a time past the first two boundaries of the second part, then
+	// compare against jumping straight there.
+	const end = 1<<16 + 1<<8 + 1
+
+	stepped := megolmRatchet{Data: testRatchetData()}
+	for stepped.Counter < end {
+		stepped.advance()
+
+		switch stepped.Counter {
+		case 1 << 8, 1 << 16, end:
+			expect := specRatchet(testRatchetData(), stepped.Counter)
+			if !bytes.Equal(stepped.Data, expect) {
+				t.Fatalf("index %#x: ratchet mismatch:\n-> %x\n<- %x", stepped.Counter, expect, stepped.Data)
+			}
+		}
+	}
+}
+
+func TestMegolmRatchetAdvanceFrom(t *testing.T) {
+	// Inbound sessions start from an index shared by someone else.
+	tests := []struct {
+		from, to uint32
+	}{
+		{5, 5},
+		{5, 1 << 8},
+		{0xFF, 1<<8 + 1},
+		{1<<8 + 7, 1 << 16},
+		{1<<16 + 1, 1<<24 + 2},
+		{1 << 24, 2<<24 + 1<<16},
+	}
+
+	for _, test := range tests {
+		from := megolmRatchet{Data: specRatchet(testRatchetData(), test.from), Counter: test.from}
+		from.advanceTo(test.to)
+
+		expect := specRatchet(testRatchetData(), test.to)
+		if !bytes.Equal(from.Data, expect) {
+			t.Errorf("%#x to %#x: ratchet mismatch:\n-> %x\n<- %x", test.from, test.to, expect, from.Data)
+		}
+	}
+}
+
+func TestMegolmRatchetKnownAnswers(t *testing.T) {
+	// Parts computed separately with Python's hmac module from the ratchet
+	// bytes 0x00 to 0x7F, following libolm's megolm_advance. An empty part is
+	// left unchanged.
+	tests := []struct {
+		index uint32
+		parts [megolmRatchetParts]string
+	}{
+		{1, [4]string{
+			3: "550744e334115fa1fd73d3b71176d4157288631cb37045a49fd62cd0608c8f5d",
+		}},
+		{1 << 8, [4]string{
+			2: "f0bdefbbad3cf097dccb03f2c87159f7608e2480543eef7741c8f2e7f226e78f",
+			3: "07e90dc411406c1ba86b898435b0512f7014666a3ecd3af93f13c32ccaf13050",
+		}},
+		{1 << 16, [4]string{
+			1: "797f21ad97515c3ed5cb1f8e6ec28cd83627aa8dc4ced0717120abbb03397159",
+			2: "193070746b7983cf7a579a6d82328168da7241f7c96bf450b6c90b9a137bec31",
+			3: "5fc7847b9c651ea645d27a333a8023f7a841a6eb66a9f8d7aca523cc4d416795",
+		}},
+		{1 << 24, [4]string{
+			0: "e711546e3faad4c7c4aa756bc26cad6abea8241984a0f6b0839c70ca61c4ef88",
+			1: "9b4c8120a4823a95f47cde17a244f4507244ee6e3957d1fab9fa29b44d3829b7",
+			2: "4304c22c84a53755ab08ead8d97a8d429be5efa480682d7ad1da27f73e1fbe1d",
+			3: "2a24d008789d3c74daf5e02636c675df8f09ec5e740c1bdf6305f9261f7b1c32",
+		}},
+	}
+
+	for _, test := range tests {
+		r := megolmRatchet{Data: testRatchetData()}
+		r.advanceTo(test.index)
+
+		initial := megolmRatchet{Data: testRatchetData()}
+
+		for j, part := range test.parts {
+			expect := initial.part(j)
+			if part != "" {
+				expect, _ = hex.DecodeString(part)
+			}
+
+			if !bytes.Equal(r.part(j), expect) {
+				t.Errorf("R(%#x,%d) mismatch:\n-> %x\n<- %x", test.index, j, expect, r.part(j))
+			}
+		}
+	}
+}
+
+func newTestGroupSessions(t *testing.T) (*OutboundGroupSession, *InboundGroupSession) {
+	t.Helper()
+
+	outbound, err := NewOutboundGroupSession()
+	if err != nil {
+		t.Fatal("cannot create outbound session:", err)
+	}
+
+	inbound, err := NewInboundGroupSession(outbound.SessionKey())
+	if err != nil {
+		t.Fatal("cannot create inbound session:", err)
+	}
+
+	if inbound.ID() != outbound.ID() {
+		t.Fatalf("session ID mismatch:\n-> %s\n<- %s", outbound.ID(), inbound.ID())
+	}
+
+	return outbound, inbound
+}
+
+func TestGroupSessionRoundTrip(t *testing.T) {
+	outbound, inbound := newTestGroupSessions(t)
+
+	var messages []string
+	for _, plaintext := range []string{"hello", "", "世界", string(make([]byte, 1000))} {
+		messages = append(messages, outbound.Encrypt([]byte(plaintext)))
+	}
+
+	// Decrypt out of order so that both the latest and the initial ratchet are
+	// used.
+	for _, i := range []int{2, 0, 3, 1} {
+		plaintext, index, err := inbound.Decrypt(messages[i])
+		if err != nil {
+			t.Fatalf("cannot decrypt message %d: %v", i, err)
+		}
+		if index != uint32(i) {
+			t.Fatalf("message %d has index %d", i, index)
+		}
+
+		expect := [...]string{"hello", "", "世界", string(make([]byte, 1000))}[i]
+		if string(plaintext) != expect {
+			t.Fatalf("message %d mismatch:\n-> %q\n<- %q", i, expect, plaintext)
+		}
+	}
+}
+
+func TestGroupSessionLateKey(t *testing.T) {
+	outbound, _ := newTestGroupSessions(t)
+
+	early := outbound.Encrypt([]byte("early"))
+
+	// Move the outbound session across a boundary before sharing its key.
+	outbound.Ratchet.advanceTo(1<<8 - 1)
+	outbound.Encrypt([]byte("skipped"))
+
+	inbound, err := NewInboundGroupSession(outbound.SessionKey())
+	if err != nil {
+		t.Fatal("cannot create inbound session:", err)
+	}
+
+	if inbound.FirstKnownIndex() != 1<<8 {
+		t.Fatalf("first known index is %d", inbound.FirstKnownIndex())
+	}
+
+	if _, _, err := inbound.Decrypt(early); err == nil {
+		t.Fatal("message before the first known index was decrypted")
+	}
+
+	plaintext, index, err := inbound.Decrypt(outbound.Encrypt([]byte("late")))
+	if err != nil {
+		t.Fatal("cannot decrypt message:", err)
+	}
+	if index != 1<<8 || string(plaintext) != "late" {
+		t.Fatalf("unexpected message %d %q", index, plaintext)
+	}
+}
+
+func TestGroupSessionBadMAC(t *testing.T) {
+	outbound, inbound := newTestGroupSessions(t)
+
+	raw, _ := Encoding.DecodeString(outbound.Encrypt([]byte("hello")))
+
+	// Flip a bit of the ciphertext and sign the message again, so that only
+	// the MAC is wrong.
+	signed := raw[:len(raw)-64]
+	signed[len(signed)-macLength-1] ^= 1
+
+	tampered := append(signed, ed25519.Sign(outbound.SigningKey, signed)...)
+
+	_, _, err := inbound.Decrypt(Encoding.EncodeToString(tampered))
+	if err != ErrBadMAC {
+		t.Fatalf("tampered message got error %v", err)
+	}
+}
+
+func TestGroupSessionBadSignature(t *testing.T) {
+	outbound, inbound := newTestGroupSessions(t)
+
+	raw, _ := Encoding.DecodeString(outbound.Encrypt([]byte("hello")))
+	raw[len(raw)-1] ^= 1
+
+	if _, _, err := inbound.Decrypt(Encoding.EncodeToString(raw)); err == nil {
+		t.Fatal("message with a bad signature was decrypted")
+	}
+}
+
+func TestInboundGroupSessionExport(t *testing.T) {
+	outbound, _ := newTestGroupSessions(t)
+	outbound.Encrypt([]byte("skipped"))
+
+	sessionKey := outbound.SessionKey()
+
+	inbound, err := NewInboundGroupSession(sessionKey)
+	if err != nil {
+		t.Fatal("cannot create inbound session:", err)
+	}
+
+	// Decrypting must not move the exported index.
+	if _, _, err := inbound.Decrypt(outbound.Encrypt([]byte("hello"))); err != nil {
+		t.Fatal("cannot decrypt message:", err)
+	}
+
+	exported, err := Encoding.DecodeString(inbound.Export())
+	if err != nil {
+		t.Fatal("invalid export encoding:", err)
+	}
+
+	// The export is the shared key with another version and no signature.
+	shared, _ := Encoding.DecodeString(sessionKey)
+	expect := append([]byte{sessionExportVersion}, shared[1:len(shared)-ed25519.SignatureSize]...)
+
+	if !bytes.Equal(exported, expect) {
+		t.Fatalf("exported key mismatch:\n-> %x\n<- %x", expect, exported)
+	}
+}
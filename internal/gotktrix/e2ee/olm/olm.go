@@ -0,0 +1,227 @@
+// Package olm implements the Olm and Megolm cryptographic ratchets as
+// specified by the Matrix specification. It is wire-compatible with libolm.
+package olm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// protocolVersion is the version byte of Olm and Megolm messages.
+const protocolVersion = 0x03
+
+// macLength is the length of the truncated MAC appended to messages.
+const macLength = 8
+
+// Encoding is the base64 encoding used for all keys and messages.
+var Encoding = base64.RawStdEncoding
+
+// ErrBadMAC is returned if a message fails its authenticity check.
+var ErrBadMAC = errors.New("message failed MAC check")
+
+// ErrBadMessage is returned if a message is malformed.
+var ErrBadMessage = errors.New("malformed message")
+
+// KeyPair is a Curve25519 key pair.
+type KeyPair struct {
+	Private []byte `json:"private"`
+	Public  []byte `json:"public"`
+}
+
+// NewKeyPair generates a new random Curve25519 key pair.
+func NewKeyPair() (KeyPair, error) {
+	private := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, private); err != nil {
+		return KeyPair{}, errors.Wrap(err, "failed to read random bytes")
+	}
+
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return KeyPair{}, errors.Wrap(err, "failed to derive public key")
+	}
+
+	return KeyPair{Private: private, Public: public}, nil
+}
+
+// sharedSecret does a Diffie-Hellman exchange with the given public key.
+func (p KeyPair) sharedSecret(public []byte) ([]byte, error) {
+	secret, err := curve25519.X25519(p.Private, public)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid Curve25519 key")
+	}
+	return secret, nil
+}
+
+// decodeKey decodes a base64 Curve25519 or Ed25519 public key.
+func decodeKey(key string) ([]byte, error) {
+	b, err := Encoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid key encoding")
+	}
+	if len(b) != 32 {
+		return nil, errors.New("invalid key length")
+	}
+	return b, nil
+}
+
+// deriveSecrets is HKDF-SHA256 with an empty salt unless given.
+func deriveSecrets(secret, salt []byte, info string, n int) []byte {
+	out := make([]byte, n)
+	io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), out)
+	return out
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// messageCipher is the AES-256-CBC with HMAC-SHA256 cipher used by both Olm
+// and Megolm. Its keys are derived from a single secret.
+type messageCipher struct {
+	aesKey []byte
+	macKey []byte
+	aesIV  []byte
+}
+
+func newMessageCipher(secret []byte, info string) messageCipher {
+	keys := deriveSecrets(secret, nil, info, 80)
+	return messageCipher{
+		aesKey: keys[:32],
+		macKey: keys[32:64],
+		aesIV:  keys[64:],
+	}
+}
+
+func (c messageCipher) encrypt(plaintext []byte) []byte {
+	block, _ := aes.NewCipher(c.aesKey)
+
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := make([]byte, len(plaintext)+padding)
+	copy(padded, plaintext)
+	for i := len(plaintext); i < len(padded); i++ {
+		padded[i] = byte(padding)
+	}
+
+	cipher.NewCBCEncrypter(block, c.aesIV).CryptBlocks(padded, padded)
+	return padded
+}
+
+func (c messageCipher) decrypt(ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrBadMessage
+	}
+
+	block, _ := aes.NewCipher(c.aesKey)
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, c.aesIV).CryptBlocks(plaintext, ciphertext)
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plaintext) {
+		return nil, ErrBadMessage
+	}
+
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// mac returns the truncated MAC of the given message.
+func (c messageCipher) mac(message []byte) []byte {
+	return hmacSHA256(c.macKey, message)[:macLength]
+}
+
+// verifyMAC checks the MAC at the end of the given message.
+func (c messageCipher) verifyMAC(message []byte) bool {
+	if len(message) < macLength {
+		return false
+	}
+	body := message[:len(message)-macLength]
+	return hmac.Equal(c.mac(body), message[len(body):])
+}
+
+// The message encoding is a subset of Protocol Buffers: each field is a tag
+// followed by either a varint or a length-prefixed byte string.
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendVarint(b []byte, tag byte, v uint64) []byte {
+	return appendUvarint(append(b, tag), v)
+}
+
+func appendBytes(b []byte, tag byte, v []byte) []byte {
+	b = appendUvarint(append(b, tag), uint64(len(v)))
+	return append(b, v...)
+}
+
+// messageField is a decoded field of a message.
+type messageField struct {
+	tag    byte
+	varint uint64
+	bytes  []byte
+}
+
+// decodeFields decodes the fields after the version byte.
+func decodeFields(b []byte) ([]messageField, error) {
+	var fields []messageField
+
+	for len(b) > 0 {
+		f := messageField{tag: b[0]}
+		b = b[1:]
+
+		switch f.tag & 0x07 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, ErrBadMessage
+			}
+			f.varint = v
+			b = b[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return nil, ErrBadMessage
+			}
+			f.bytes = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			return nil, ErrBadMessage
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+// checkVersion returns the message without its version byte.
+func checkVersion(b []byte) ([]byte, error) {
+	if len(b) == 0 || b[0] != protocolVersion {
+		return nil, errors.Wrap(ErrBadMessage, "unknown message version")
+	}
+	return b[1:], nil
+}
+
+func bytesEqual(a, b []byte) bool {
+	return len(a) > 0 && bytes.Equal(a, b)
+}
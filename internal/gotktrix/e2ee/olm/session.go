@@ -0,0 +1,424 @@
+package olm
+
+import (
+	"crypto/sha256"
+
+	"github.com/pkg/errors"
+)
+
+// Message types of Olm messages.
+const (
+	MessageTypePreKey = 0
+	MessageTypeNormal = 1
+)
+
+const (
+	// maxReceiverChains is the number of receiver chains that a session keeps
+	// to decrypt late messages.
+	maxReceiverChains = 5
+	// maxSkippedKeys is the number of message keys that a session keeps for
+	// messages that haven't arrived yet.
+	maxSkippedKeys = 40
+	// maxMessageGap is the most messages that can be skipped in one go.
+	maxMessageGap = 2000
+)
+
+var (
+	chainKeySeed   = []byte{0x02}
+	messageKeySeed = []byte{0x01}
+)
+
+// chainKey is a key of a sending or receiving chain at an index.
+type chainKey struct {
+	Index uint32 `json:"index"`
+	Key   []byte `json:"key"`
+}
+
+func (c chainKey) advance() chainKey {
+	return chainKey{
+		Index: c.Index + 1,
+		Key:   hmacSHA256(c.Key, chainKeySeed),
+	}
+}
+
+func (c chainKey) messageKey() []byte {
+	return hmacSHA256(c.Key, messageKeySeed)
+}
+
+type senderChain struct {
+	RatchetKey KeyPair  `json:"ratchet_key"`
+	Chain      chainKey `json:"chain"`
+}
+
+type receiverChain struct {
+	RatchetKey []byte   `json:"ratchet_key"`
+	Chain      chainKey `json:"chain"`
+}
+
+type skippedKey struct {
+	RatchetKey []byte `json:"ratchet_key"`
+	Index      uint32 `json:"index"`
+	Key        []byte `json:"key"`
+}
+
+// Session is an Olm session between two devices. It can be marshaled to JSON
+// to be stored.
+type Session struct {
+	AliceIdentityKey []byte `json:"alice_identity_key"`
+	AliceBaseKey     []byte `json:"alice_base_key"`
+	BobOneTimeKey    []byte `json:"bob_one_time_key"`
+	TheirIdentityKey []byte `json:"their_identity_key"`
+
+	RootKey        []byte          `json:"root_key"`
+	SenderChains   []senderChain   `json:"sender_chains"`
+	ReceiverChains []receiverChain `json:"receiver_chains"`
+	SkippedKeys    []skippedKey    `json:"skipped_keys"`
+
+	// Outbound is true if the session was created by this device.
+	Outbound bool `json:"outbound"`
+	// ReceivedMessage is true once the other device has replied. Until then,
+	// pre-key messages are sent so that the other device can create the
+	// session.
+	ReceivedMessage bool `json:"received_message"`
+}
+
+func (s *Session) initialiseAsAlice(secret []byte, ratchetKey KeyPair) {
+	keys := deriveSecrets(secret, nil, "OLM_ROOT", 64)
+	s.RootKey = keys[:32]
+	s.SenderChains = []senderChain{{
+		RatchetKey: ratchetKey,
+		Chain:      chainKey{Key: keys[32:]},
+	}}
+}
+
+func (s *Session) initialiseAsBob(secret, theirRatchetKey []byte) {
+	keys := deriveSecrets(secret, nil, "OLM_ROOT", 64)
+	s.RootKey = keys[:32]
+	s.ReceiverChains = []receiverChain{{
+		RatchetKey: theirRatchetKey,
+		Chain:      chainKey{Key: keys[32:]},
+	}}
+}
+
+// advanceRoot derives the next root key and chain key from the two ratchet
+// keys.
+func advanceRoot(rootKey []byte, ours KeyPair, theirs []byte) (newRoot []byte, chain chainKey, err error) {
+	secret, err := ours.sharedSecret(theirs)
+	if err != nil {
+		return nil, chainKey{}, err
+	}
+
+	keys := deriveSecrets(secret, rootKey, "OLM_RATCHET", 64)
+	return keys[:32], chainKey{Key: keys[32:]}, nil
+}
+
+// ID returns the session ID.
+func (s *Session) ID() string {
+	h := sha256.New()
+	h.Write(s.AliceIdentityKey)
+	h.Write(s.AliceBaseKey)
+	h.Write(s.BobOneTimeKey)
+	return Encoding.EncodeToString(h.Sum(nil))
+}
+
+// TheirCurve25519 returns the base64 identity key of the other device.
+func (s *Session) TheirCurve25519() string {
+	return Encoding.EncodeToString(s.TheirIdentityKey)
+}
+
+// MatchesInboundSession returns true if the given pre-key message was sent
+// for this session.
+func (s *Session) MatchesInboundSession(body string) bool {
+	msg, err := decodePreKeyMessage(body)
+	if err != nil {
+		return false
+	}
+
+	return bytesEqual(msg.identityKey, s.AliceIdentityKey) &&
+		bytesEqual(msg.baseKey, s.AliceBaseKey) &&
+		bytesEqual(msg.oneTimeKey, s.BobOneTimeKey)
+}
+
+// Encrypt encrypts the plaintext and returns the message type and the base64
+// message.
+func (s *Session) Encrypt(plaintext []byte) (int, string, error) {
+	if len(s.SenderChains) == 0 {
+		if len(s.ReceiverChains) == 0 {
+			return 0, "", errors.New("session has no chains")
+		}
+
+		ratchetKey, err := NewKeyPair()
+		if err != nil {
+			return 0, "", err
+		}
+
+		root, chain, err := advanceRoot(s.RootKey, ratchetKey, s.ReceiverChains[0].RatchetKey)
+		if err != nil {
+			return 0, "", err
+		}
+
+		s.RootKey = root
+		s.SenderChains = []senderChain{{RatchetKey: ratchetKey, Chain: chain}}
+	}
+
+	chain := &s.SenderChains[0]
+	cipher := newMessageCipher(chain.Chain.messageKey(), "OLM_KEYS")
+
+	msg := []byte{protocolVersion}
+	msg = appendBytes(msg, 0x0A, chain.RatchetKey.Public)
+	msg = appendVarint(msg, 0x10, uint64(chain.Chain.Index))
+	msg = appendBytes(msg, 0x22, cipher.encrypt(plaintext))
+	msg = append(msg, cipher.mac(msg)...)
+
+	chain.Chain = chain.Chain.advance()
+
+	if s.ReceivedMessage {
+		return MessageTypeNormal, Encoding.EncodeToString(msg), nil
+	}
+
+	preKey := []byte{protocolVersion}
+	preKey = appendBytes(preKey, 0x0A, s.BobOneTimeKey)
+	preKey = appendBytes(preKey, 0x12, s.AliceBaseKey)
+	preKey = appendBytes(preKey, 0x1A, s.AliceIdentityKey)
+	preKey = appendBytes(preKey, 0x22, msg)
+
+	return MessageTypePreKey, Encoding.EncodeToString(preKey), nil
+}
+
+// Decrypt decrypts the base64 message of the given type. The session is only
+// changed if the message is authentic.
+func (s *Session) Decrypt(msgType int, body string) ([]byte, error) {
+	var raw []byte
+
+	switch msgType {
+	case MessageTypePreKey:
+		preKey, err := decodePreKeyMessage(body)
+		if err != nil {
+			return nil, err
+		}
+		raw = preKey.message
+	case MessageTypeNormal:
+		b, err := Encoding.DecodeString(body)
+		if err != nil {
+			return nil, errors.Wrap(ErrBadMessage, "invalid message encoding")
+		}
+		raw = b
+	default:
+		return nil, errors.Errorf("unknown message type %d", msgType)
+	}
+
+	msg, err := decodeMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := s.decrypt(raw, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ReceivedMessage = true
+	return plaintext, nil
+}
+
+func (s *Session) decrypt(raw []byte, msg message) ([]byte, error) {
+	chainIx := -1
+	for i, chain := range s.ReceiverChains {
+		if bytesEqual(chain.RatchetKey, msg.ratchetKey) {
+			chainIx = i
+			break
+		}
+	}
+
+	if chainIx == -1 {
+		// The other device has ratcheted, so start a new receiver chain.
+		if len(s.SenderChains) == 0 {
+			return nil, errors.New("message uses an unknown ratchet key")
+		}
+
+		root, chain, err := advanceRoot(s.RootKey, s.SenderChains[0].RatchetKey, msg.ratchetKey)
+		if err != nil {
+			return nil, err
+		}
+
+		receiver := receiverChain{RatchetKey: msg.ratchetKey, Chain: chain}
+
+		plaintext, skipped, err := decryptChain(&receiver, raw, msg)
+		if err != nil {
+			return nil, err
+		}
+
+		s.RootKey = root
+		s.ReceiverChains = append([]receiverChain{receiver}, s.ReceiverChains...)
+		if len(s.ReceiverChains) > maxReceiverChains {
+			s.ReceiverChains = s.ReceiverChains[:maxReceiverChains]
+		}
+		// Ratchet again on the next message that we send.
+		s.SenderChains = nil
+		s.addSkippedKeys(skipped)
+
+		return plaintext, nil
+	}
+
+	receiver := s.ReceiverChains[chainIx]
+
+	if msg.index < receiver.Chain.Index {
+		for i, key := range s.SkippedKeys {
+			if key.Index != msg.index || !bytesEqual(key.RatchetKey, msg.ratchetKey) {
+				continue
+			}
+
+			cipher := newMessageCipher(key.Key, "OLM_KEYS")
+			if !cipher.verifyMAC(raw) {
+				return nil, ErrBadMAC
+			}
+
+			plaintext, err := cipher.decrypt(msg.ciphertext)
+			if err != nil {
+				return nil, err
+			}
+
+			s.SkippedKeys = append(s.SkippedKeys[:i], s.SkippedKeys[i+1:]...)
+			return plaintext, nil
+		}
+
+		return nil, errors.New("message key was already used")
+	}
+
+	plaintext, skipped, err := decryptChain(&receiver, raw, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ReceiverChains[chainIx] = receiver
+	s.addSkippedKeys(skipped)
+
+	return plaintext, nil
+}
+
+// decryptChain advances the chain to the message and decrypts it. The message
+// keys that were skipped along the way are returned.
+func decryptChain(chain *receiverChain, raw []byte, msg message) ([]byte, []skippedKey, error) {
+	if msg.index-chain.Chain.Index > maxMessageGap {
+		return nil, nil, errors.New("message is too far ahead")
+	}
+
+	c := chain.Chain
+
+	var skipped []skippedKey
+	for c.Index < msg.index {
+		skipped = append(skipped, skippedKey{
+			RatchetKey: chain.RatchetKey,
+			Index:      c.Index,
+			Key:        c.messageKey(),
+		})
+		c = c.advance()
+	}
+
+	cipher := newMessageCipher(c.messageKey(), "OLM_KEYS")
+	if !cipher.verifyMAC(raw) {
+		return nil, nil, ErrBadMAC
+	}
+
+	plaintext, err := cipher.decrypt(msg.ciphertext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chain.Chain = c.advance()
+	return plaintext, skipped, nil
+}
+
+func (s *Session) addSkippedKeys(keys []skippedKey) {
+	s.SkippedKeys = append(s.SkippedKeys, keys...)
+	if len(s.SkippedKeys) > maxSkippedKeys {
+		s.SkippedKeys = s.SkippedKeys[len(s.SkippedKeys)-maxSkippedKeys:]
+	}
+}
+
+// message is a decoded normal Olm message.
+type message struct {
+	ratchetKey []byte
+	index      uint32
+	ciphertext []byte
+}
+
+func decodeMessage(raw []byte) (message, error) {
+	if len(raw) < 1+macLength {
+		return message{}, ErrBadMessage
+	}
+
+	body, err := checkVersion(raw[:len(raw)-macLength])
+	if err != nil {
+		return message{}, err
+	}
+
+	fields, err := decodeFields(body)
+	if err != nil {
+		return message{}, err
+	}
+
+	var msg message
+	for _, f := range fields {
+		switch f.tag {
+		case 0x0A:
+			msg.ratchetKey = f.bytes
+		case 0x10:
+			msg.index = uint32(f.varint)
+		case 0x22:
+			msg.ciphertext = f.bytes
+		}
+	}
+
+	if len(msg.ratchetKey) != 32 || msg.ciphertext == nil {
+		return message{}, errors.Wrap(ErrBadMessage, "message is missing fields")
+	}
+
+	return msg, nil
+}
+
+// preKeyMessage is a decoded pre-key Olm message.
+type preKeyMessage struct {
+	oneTimeKey  []byte
+	baseKey     []byte
+	identityKey []byte
+	message     []byte
+}
+
+func decodePreKeyMessage(body string) (preKeyMessage, error) {
+	raw, err := Encoding.DecodeString(body)
+	if err != nil {
+		return preKeyMessage{}, errors.Wrap(ErrBadMessage, "invalid message encoding")
+	}
+
+	raw, err = checkVersion(raw)
+	if err != nil {
+		return preKeyMessage{}, err
+	}
+
+	fields, err := decodeFields(raw)
+	if err != nil {
+		return preKeyMessage{}, err
+	}
+
+	var msg preKeyMessage
+	for _, f := range fields {
+		switch f.tag {
+		case 0x0A:
+			msg.oneTimeKey = f.bytes
+		case 0x12:
+			msg.baseKey = f.bytes
+		case 0x1A:
+			msg.identityKey = f.bytes
+		case 0x22:
+			msg.message = f.bytes
+		}
+	}
+
+	if len(msg.oneTimeKey) != 32 || len(msg.baseKey) != 32 || len(msg.identityKey) != 32 ||
+		msg.message == nil {
+		return preKeyMessage{}, errors.Wrap(ErrBadMessage, "pre-key message is missing fields")
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,222 @@
+package olm
+
+import (
+	"errors"
+	"testing"
+)
+
+// newTestSessions creates a session from Alice to Bob along with Bob's side,
+// which is made from Alice's first pre-key message.
+func newTestSessions(t *testing.T) (alice, bob *Session) {
+	t.Helper()
+
+	aliceAccount, err := NewAccount()
+	if err != nil {
+		t.Fatal("cannot create Alice's account:", err)
+	}
+
+	bobAccount, err := NewAccount()
+	if err != nil {
+		t.Fatal("cannot create Bob's account:", err)
+	}
+
+	if err := bobAccount.GenerateOneTimeKeys(2); err != nil {
+		t.Fatal("cannot generate one-time keys:", err)
+	}
+
+	oneTimeKey := Encoding.EncodeToString(bobAccount.OneTimeKeys[0].Key.Public)
+
+	alice, err = aliceAccount.NewOutboundSession(bobAccount.Curve25519(), oneTimeKey)
+	if err != nil {
+		t.Fatal("cannot create outbound session:", err)
+	}
+
+	msgType, body, err := alice.Encrypt([]byte("hello Bob"))
+	if err != nil {
+		t.Fatal("cannot encrypt pre-key message:", err)
+	}
+	if msgType != MessageTypePreKey {
+		t.Fatalf("first message has type %d", msgType)
+	}
+
+	bob, err = bobAccount.NewInboundSession(aliceAccount.Curve25519(), body)
+	if err != nil {
+		t.Fatal("cannot create inbound session:", err)
+	}
+
+	if len(bobAccount.OneTimeKeys) != 1 {
+		t.Fatalf("used one-time key wasn't removed, %d left", len(bobAccount.OneTimeKeys))
+	}
+	if !bob.MatchesInboundSession(body) {
+		t.Fatal("inbound session doesn't match its own pre-key message")
+	}
+	if alice.ID() != bob.ID() {
+		t.Fatalf("session ID mismatch:\n-> %s\n<- %s", alice.ID(), bob.ID())
+	}
+
+	plaintext, err := bob.Decrypt(msgType, body)
+	if err != nil {
+		t.Fatal("cannot decrypt pre-key message:", err)
+	}
+	if string(plaintext) != "hello Bob" {
+		t.Fatalf("pre-key message mismatch: %q", plaintext)
+	}
+
+	return alice, bob
+}
+
+func mustEncrypt(t *testing.T, s *Session, plaintext string) (int, string) {
+	t.Helper()
+
+	msgType, body, err := s.Encrypt([]byte(plaintext))
+	if err != nil {
+		t.Fatalf("cannot encrypt %q: %v", plaintext, err)
+	}
+	return msgType, body
+}
+
+func mustDecrypt(t *testing.T, s *Session, msgType int, body, expect string) {
+	t.Helper()
+
+	plaintext, err := s.Decrypt(msgType, body)
+	if err != nil {
+		t.Fatalf("cannot decrypt %q: %v", expect, err)
+	}
+	if string(plaintext) != expect {
+		t.Fatalf("message mismatch:\n-> %q\n<- %q", expect, plaintext)
+	}
+}
+
+func TestSessionPreKeyRoundTrip(t *testing.T) {
+	alice, bob := newTestSessions(t)
+
+	// Alice keeps sending pre-key messages until Bob replies.
+	msgType, body := mustEncrypt(t, alice, "are you there?")
+	if msgType != MessageTypePreKey {
+		t.Fatalf("message before a reply has type %d", msgType)
+	}
+	mustDecrypt(t, bob, msgType, body, "are you there?")
+
+	msgType, body = mustEncrypt(t, bob, "hello Alice")
+	if msgType != MessageTypeNormal {
+		t.Fatalf("reply has type %d", msgType)
+	}
+	mustDecrypt(t, alice, msgType, body, "hello Alice")
+
+	msgType, body = mustEncrypt(t, alice, "hi again")
+	if msgType != MessageTypeNormal {
+		t.Fatalf("message after a reply has type %d", msgType)
+	}
+	mustDecrypt(t, bob, msgType, body, "hi again")
+}
+
+func TestSessionNormalRoundTrip(t *testing.T) {
+	alice, bob := newTestSessions(t)
+
+	// Go back and forth a few times so that the ratchet turns, sending a few
+	// messages in each chain.
+	for turn := 0; turn < 4; turn++ {
+		from, to := bob, alice
+		if turn%2 == 1 {
+			from, to = alice, bob
+		}
+
+		for i := 0; i < 3; i++ {
+			msgType, body := mustEncrypt(t, from, "message")
+			if msgType != MessageTypeNormal {
+				t.Fatalf("turn %d: message %d has type %d", turn, i, msgType)
+			}
+			mustDecrypt(t, to, msgType, body, "message")
+		}
+	}
+}
+
+func TestSessionOutOfOrder(t *testing.T) {
+	alice, bob := newTestSessions(t)
+
+	_, first := mustEncrypt(t, bob, "first")
+	_, second := mustEncrypt(t, bob, "second")
+	_, third := mustEncrypt(t, bob, "third")
+
+	mustDecrypt(t, alice, MessageTypeNormal, third, "third")
+	mustDecrypt(t, alice, MessageTypeNormal, first, "first")
+	mustDecrypt(t, alice, MessageTypeNormal, second, "second")
+}
+
+func TestSessionReplay(t *testing.T) {
+	alice, bob := newTestSessions(t)
+
+	_, first := mustEncrypt(t, bob, "first")
+	_, second := mustEncrypt(t, bob, "second")
+
+	mustDecrypt(t, alice, MessageTypeNormal, second, "second")
+	if _, err := alice.Decrypt(MessageTypeNormal, second); err == nil {
+		t.Fatal("replayed message was decrypted")
+	}
+
+	// The skipped key can only be used once too.
+	mustDecrypt(t, alice, MessageTypeNormal, first, "first")
+	if _, err := alice.Decrypt(MessageTypeNormal, first); err == nil {
+		t.Fatal("replayed skipped message was decrypted")
+	}
+}
+
+func TestSessionBadMAC(t *testing.T) {
+	alice, bob := newTestSessions(t)
+
+	_, body := mustEncrypt(t, bob, "hello")
+
+	raw, _ := Encoding.DecodeString(body)
+	raw[len(raw)-macLength-1] ^= 1
+
+	_, err := alice.Decrypt(MessageTypeNormal, Encoding.EncodeToString(raw))
+	if !errors.Is(err, ErrBadMAC) {
+		t.Fatalf("tampered message got error %v", err)
+	}
+
+	// The session must be untouched, so the real message still decrypts.
+	mustDecrypt(t, alice, MessageTypeNormal, body, "hello")
+}
+
+func TestSessionBadMACNewChain(t *testing.T) {
+	alice, bob := newTestSessions(t)
+
+	// Bob's first reply starts a new chain on Alice's side.
+	_, body := mustEncrypt(t, bob, "hello")
+
+	raw, _ := Encoding.DecodeString(body)
+	raw[len(raw)-1] ^= 1
+
+	_, err := alice.Decrypt(MessageTypeNormal, Encoding.EncodeToString(raw))
+	if !errors.Is(err, ErrBadMAC) {
+		t.Fatalf("tampered message got error %v", err)
+	}
+	if len(alice.ReceiverChains) != 0 {
+		t.Fatal("tampered message added a receiver chain")
+	}
+
+	mustDecrypt(t, alice, MessageTypeNormal, body, "hello")
+}
+
+func TestInboundSessionWrongIdentity(t *testing.T) {
+	aliceAccount, _ := NewAccount()
+	bobAccount, _ := NewAccount()
+	eveAccount, _ := NewAccount()
+
+	bobAccount.GenerateOneTimeKeys(1)
+	oneTimeKey := Encoding.EncodeToString(bobAccount.OneTimeKeys[0].Key.Public)
+
+	alice, err := aliceAccount.NewOutboundSession(bobAccount.Curve25519(), oneTimeKey)
+	if err != nil {
+		t.Fatal("cannot create outbound session:", err)
+	}
+
+	_, body := mustEncrypt(t, alice, "hello")
+
+	if _, err := bobAccount.NewInboundSession(eveAccount.Curve25519(), body); err == nil {
+		t.Fatal("pre-key message was accepted from the wrong identity key")
+	}
+	if len(bobAccount.OneTimeKeys) != 1 {
+		t.Fatal("one-time key was removed by a rejected message")
+	}
+}
@@ -0,0 +1,159 @@
+package e2ee
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/e2ee/olm"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/encryption"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/internal/db"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// newTestDevice creates a started machine for the given device.
+func newTestDevice(t *testing.T, userID matrix.UserID, deviceID matrix.DeviceID) *Machine {
+	t.Helper()
+
+	kv, err := db.NewKVFile(filepath.Join(t.TempDir(), "crypto"))
+	if err != nil {
+		t.Fatal("cannot open db:", err)
+	}
+	t.Cleanup(func() { kv.Close() })
+
+	account, err := olm.NewAccount()
+	if err != nil {
+		t.Fatal("cannot create account:", err)
+	}
+
+	return &Machine{
+		client:  &api.Client{UserID: userID},
+		kv:      kv,
+		account: &storedAccount{DeviceID: deviceID, Account: account},
+		inbound: make(map[inboundKey]*inboundSession),
+	}
+}
+
+// deviceKeys returns the keys of the machine's device as they're queried.
+func deviceKeys(m *Machine) DeviceKeys {
+	id := string(m.account.DeviceID)
+	return DeviceKeys{
+		UserID:   m.client.UserID,
+		DeviceID: m.account.DeviceID,
+		Keys: map[string]string{
+			"curve25519:" + id: m.account.Account.Curve25519(),
+			"ed25519:" + id:    m.account.Account.Ed25519(),
+		},
+	}
+}
+
+// sendRoomKey returns the to-device event that shares the room key from one
+// machine to the other.
+func sendRoomKey(t *testing.T, from, to *Machine, key encryption.RoomKey) toDeviceEvent {
+	t.Helper()
+
+	if err := to.account.Account.GenerateOneTimeKeys(1); err != nil {
+		t.Fatal("cannot generate one-time key:", err)
+	}
+	oneTimeKey := to.account.Account.UnpublishedOneTimeKeys()[0]
+
+	session, err := from.account.Account.NewOutboundSession(
+		to.account.Account.Curve25519(), olm.Encoding.EncodeToString(oneTimeKey.Key.Public))
+	if err != nil {
+		t.Fatal("cannot create Olm session:", err)
+	}
+
+	content, err := from.encryptOlm(session, deviceKeys(to), encryption.RoomKeyEventType, key)
+	if err != nil {
+		t.Fatal("cannot encrypt room key:", err)
+	}
+
+	b, err := json.Marshal(content)
+	if err != nil {
+		t.Fatal("cannot marshal content:", err)
+	}
+
+	return toDeviceEvent{
+		Type:    encryption.EncryptedEventType,
+		Sender:  from.client.UserID,
+		Content: b,
+	}
+}
+
+func TestReceiveOlmRoomKey(t *testing.T) {
+	outbound, err := olm.NewOutboundGroupSession()
+	if err != nil {
+		t.Fatal("cannot create outbound session:", err)
+	}
+
+	key := encryption.RoomKey{
+		Algorithm:  encryption.Megolm,
+		RoomID:     testRoomID,
+		SessionID:  outbound.ID(),
+		SessionKey: outbound.SessionKey(),
+	}
+
+	// impostor has the same device ID as alice, but not her keys.
+	impostor := newTestDevice(t, "@alice:example.com", "ALICE")
+
+	tests := []struct {
+		name    string
+		devices func(alice *Machine) map[matrix.DeviceID]DeviceKeys
+		ok      bool
+	}{
+		{
+			name: "known device",
+			devices: func(alice *Machine) map[matrix.DeviceID]DeviceKeys {
+				return map[matrix.DeviceID]DeviceKeys{"ALICE": deviceKeys(alice)}
+			},
+			ok: true,
+		},
+		{
+			name: "unknown device",
+			devices: func(alice *Machine) map[matrix.DeviceID]DeviceKeys {
+				return nil
+			},
+		},
+		{
+			name: "other device",
+			devices: func(alice *Machine) map[matrix.DeviceID]DeviceKeys {
+				return map[matrix.DeviceID]DeviceKeys{"ALICE": deviceKeys(impostor)}
+			},
+		},
+		{
+			name: "mismatching signing key",
+			devices: func(alice *Machine) map[matrix.DeviceID]DeviceKeys {
+				keys := deviceKeys(alice)
+				keys.Keys["ed25519:ALICE"] = impostor.account.Account.Ed25519()
+				return map[matrix.DeviceID]DeviceKeys{"ALICE": keys}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			alice := newTestDevice(t, "@alice:example.com", "ALICE")
+			bob := newTestDevice(t, "@bob:example.com", "BOB")
+
+			ev := sendRoomKey(t, alice, bob, key)
+			err := bob.receiveOlm(ev, test.devices(alice))
+
+			session := bob.inboundSession(inboundKey{testRoomID, alice.account.Account.Curve25519(), key.SessionID})
+
+			if !test.ok {
+				if err == nil || session != nil {
+					t.Fatal("room key was accepted")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal("cannot receive room key:", err)
+			}
+			if session == nil || session.SigningKey != alice.account.Account.Ed25519() {
+				t.Fatalf("unexpected inbound session %v", session)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package gotktrix
+
+import (
+	"encoding/json"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// ReplacementOf returns the ID of the event that the given event edits, or an
+// empty string if it's not an edit.
+func ReplacementOf(ev event.RoomEvent) matrix.EventID {
+	msg, ok := ev.(*event.RoomMessageEvent)
+	if !ok || msg.RelatesTo == nil {
+		return ""
+	}
+
+	var relatesTo struct {
+		RelType m.RelType      `json:"rel_type"`
+		EventID matrix.EventID `json:"event_id"`
+	}
+
+	json.Unmarshal(msg.RelatesTo, &relatesTo)
+
+	if relatesTo.RelType != m.Replace {
+		return ""
+	}
+	return relatesTo.EventID
+}
+
+// LatestEdit returns the latest edit of the given message within the room's
+// timeline state, or nil if it was never edited. Edits from anyone other than
+// the original sender are ignored, since they're not valid.
+func (c *Client) LatestEdit(
+	roomID matrix.RoomID, orig *event.RoomMessageEvent) *event.RoomMessageEvent {
+
+	var latest *event.RoomMessageEvent
+
+	c.EachTimeline(roomID, func(ev event.RoomEvent) error {
+		msg, ok := ev.(*event.RoomMessageEvent)
+		if !ok || msg.Sender != orig.Sender || ReplacementOf(msg) != orig.ID {
+			return nil
+		}
+		if latest == nil || msg.OriginServerTime >= latest.OriginServerTime {
+			latest = msg
+		}
+		return nil
+	})
+
+	return latest
+}
@@ -0,0 +1,166 @@
+package gotktrix
+
+import (
+	"net/http"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/e2ee"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/encryption"
+	"github.com/diamondburned/gotrix"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// cryptoState decrypts the events of each sync before they're stored and
+// handed to the handlers.
+type cryptoState struct {
+	gotrix.State
+	crypto *e2ee.Machine
+}
+
+func (s cryptoState) AddEvents(sync *api.SyncResponse) error {
+	s.crypto.ProcessSync(sync)
+	return s.State.AddEvents(sync)
+}
+
+// RoomEncryption returns the encryption settings of the room, or nil if the
+// room isn't encrypted. An error is returned if that can't be known, so that
+// the caller doesn't mistake an encrypted room for an unencrypted one. Once a
+// room is seen encrypted, it's always treated as encrypted.
+func (c *Client) RoomEncryption(roomID matrix.RoomID) (*encryption.Event, error) {
+	e, err := c.RoomState(roomID, encryption.EventType, "")
+	if err == nil {
+		ev, ok := e.(*encryption.Event)
+		if !ok {
+			return nil, errors.Errorf("unexpected %s event %T", encryption.EventType, e)
+		}
+
+		if c.crypto.RoomSettings(roomID) == nil {
+			if err := c.crypto.SetRoomSettings(roomID, ev); err != nil {
+				return nil, err
+			}
+		}
+
+		return ev, nil
+	}
+
+	if ev := c.crypto.RoomSettings(roomID); ev != nil {
+		return ev, nil
+	}
+
+	if matrix.StatusCode(err) == http.StatusNotFound {
+		return nil, nil
+	}
+
+	return nil, errors.Wrap(err, "failed to get room encryption")
+}
+
+// IsRoomEncrypted returns true if messages sent to the room are encrypted. The
+// room is assumed to be encrypted if that can't be known.
+func (c *Client) IsRoomEncrypted(roomID matrix.RoomID) bool {
+	ev, err := c.RoomEncryption(roomID)
+	return ev != nil || err != nil
+}
+
+// DeviceFingerprint returns the Ed25519 key of this device, which other users
+// can compare to verify it. An empty string is returned if encryption isn't
+// set up.
+func (c *Client) DeviceFingerprint() string {
+	return c.crypto.Fingerprint()
+}
+
+// RoomEventSend sends the event to the room. The event is encrypted first if
+// the room is encrypted.
+func (c *Client) RoomEventSend(roomID matrix.RoomID, typ event.Type, body interface{}) (matrix.EventID, error) {
+	return c.RoomEventSendTxn(roomID, typ, NextTransactionID(), body)
+}
+
+// NextTransactionID returns a new transaction ID for RoomEventSendTxn.
+func NextTransactionID() string {
+	return api.NextTransactionID()
+}
+
+// RoomEventSendTxn is like RoomEventSend, except the event is sent with the
+// given transaction ID. Sending again with the same transaction ID doesn't send
+// the event twice, and the event comes back from syncing with the transaction
+// ID in its unsigned data.
+func (c *Client) RoomEventSendTxn(
+	roomID matrix.RoomID, typ event.Type, txnID string, body interface{}) (matrix.EventID, error) {
+
+	settings, err := c.RoomEncryption(roomID)
+	if err != nil {
+		return "", err
+	}
+
+	if settings != nil {
+		members, err := c.encryptionMembers(roomID)
+		if err != nil {
+			return "", err
+		}
+
+		encrypted, err := c.crypto.Encrypt(e2ee.Room{
+			ID:       roomID,
+			Settings: settings,
+			Members:  members,
+		}, typ, body)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to encrypt event")
+		}
+
+		typ = encryption.EncryptedEventType
+		body = encrypted
+	}
+
+	var resp struct {
+		EventID matrix.EventID `json:"event_id"`
+	}
+
+	err = c.Request(
+		"PUT", c.Endpoints.RoomSend(roomID, typ, txnID), &resp,
+		httputil.WithToken(), httputil.WithJSONBody(body),
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "error sending room event")
+	}
+
+	return resp.EventID, nil
+}
+
+// encryptionMembers returns the users whose devices should be able to decrypt
+// the messages sent to the room.
+func (c *Client) encryptionMembers(roomID matrix.RoomID) ([]matrix.UserID, error) {
+	// Members are lazily loaded, so the state may not have all of them.
+	if err := c.RoomEnsureMembers(roomID); err != nil {
+		return nil, errors.Wrap(err, "failed to get all room members")
+	}
+
+	members, err := c.RoomMembers(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]matrix.UserID, 0, len(members))
+	for _, member := range members {
+		switch member.NewState {
+		case event.MemberJoined, event.MemberInvited:
+			userIDs = append(userIDs, member.UserID)
+		}
+	}
+
+	return userIDs, nil
+}
+
+// RoomMessages wraps around the API's RoomMessages to decrypt the returned
+// events, which are then indexed for searching.
+func (c *Client) RoomMessages(roomID matrix.RoomID, query api.RoomMessagesQuery) (api.RoomMessagesResponse, error) {
+	r, err := c.Client.RoomMessages(roomID, query)
+	if err != nil {
+		return r, err
+	}
+
+	c.crypto.DecryptEvents(roomID, r.Chunk)
+	c.indexMessages(roomID, r.Chunk)
+	return r, nil
+}
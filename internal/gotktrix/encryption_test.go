@@ -0,0 +1,74 @@
+package gotktrix
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/e2ee"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/encryption"
+)
+
+// notFoundDriver answers every request with M_NOT_FOUND.
+type notFoundDriver struct{}
+
+func (notFoundDriver) Do(*http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusNotFound,
+		Body:       io.NopCloser(strings.NewReader(`{"errcode":"M_NOT_FOUND","error":"Not found"}`)),
+	}, nil
+}
+
+func TestRoomEncryption(t *testing.T) {
+	crypto, err := e2ee.Open(filepath.Join(t.TempDir(), "crypto"), nil)
+	if err != nil {
+		t.Fatal("cannot open crypto db:", err)
+	}
+	t.Cleanup(func() { crypto.Close() })
+
+	// The homeserver can't be reached, so the room may well be encrypted.
+	c := newTestClient(t)
+	c.crypto = crypto
+
+	if ev, err := c.RoomEncryption(testRoom); err == nil {
+		t.Fatalf("unknown room encryption isn't an error, got %v", ev)
+	}
+	if !c.IsRoomEncrypted(testRoom) {
+		t.Fatal("unknown room encryption is assumed to be unencrypted")
+	}
+
+	c.Client.Client.Client.ClientDriver = notFoundDriver{}
+
+	ev, err := c.RoomEncryption(testRoom)
+	if err != nil {
+		t.Fatal("cannot get encryption of unencrypted room:", err)
+	}
+	if ev != nil {
+		t.Fatalf("unencrypted room has encryption %v", ev)
+	}
+
+	encrypted := newTestClient(t, stateEvent(t, encryption.EventType, "", map[string]interface{}{
+		"algorithm": encryption.Megolm,
+	}))
+	encrypted.crypto = crypto
+
+	ev, err = encrypted.RoomEncryption(testRoom)
+	if err != nil {
+		t.Fatal("cannot get encryption of encrypted room:", err)
+	}
+	if ev == nil || ev.Algorithm != encryption.Megolm {
+		t.Fatalf("encrypted room has unexpected encryption %v", ev)
+	}
+
+	// The room was seen encrypted, so it stays encrypted even though the state
+	// event is now missing.
+	ev, err = c.RoomEncryption(testRoom)
+	if err != nil {
+		t.Fatal("cannot get encryption of previously encrypted room:", err)
+	}
+	if ev == nil || ev.Algorithm != encryption.Megolm {
+		t.Fatalf("previously encrypted room has unexpected encryption %v", ev)
+	}
+}
@@ -0,0 +1,72 @@
+// Package breadcrumbs provides an implementation of the
+// im.vector.setting.breadcrumbs account data event, which lists the rooms that
+// the user has recently viewed. Other clients such as Element use the same
+// event, so the list is shared with them.
+package breadcrumbs
+
+import (
+	"encoding/json"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+func init() {
+	event.RegisterDefault(EventType, parseEvent)
+}
+
+// EventType is the event type for im.vector.setting.breadcrumbs.
+const EventType event.Type = "im.vector.setting.breadcrumbs"
+
+// MaxRooms is the maximum number of rooms kept in the list.
+const MaxRooms = 20
+
+// Event describes the im.vector.setting.breadcrumbs event.
+type Event struct {
+	event.EventInfo `json:"-"`
+
+	// RecentRooms is the list of recently viewed rooms, with the most recent
+	// one first.
+	RecentRooms []matrix.RoomID `json:"recent_rooms"`
+}
+
+func parseEvent(content json.RawMessage) (event.Event, error) {
+	var ev Event
+	err := json.Unmarshal(content, &ev)
+	return &ev, err
+}
+
+// Recent returns the rooms that the user has recently viewed, with the most
+// recent one first.
+func Recent(c *gotktrix.Client) []matrix.RoomID {
+	e, _ := c.State.UserEvent(EventType)
+	if ev, ok := e.(*Event); ok {
+		return ev.RecentRooms
+	}
+	return nil
+}
+
+// Visit moves the given room to the front of the recently viewed rooms. The
+// state is updated immediately, while the account data is updated in the
+// background; done is called once that's done, if it's not nil.
+func Visit(c *gotktrix.Client, roomID matrix.RoomID, done func(error)) {
+	recent := Recent(c)
+	if len(recent) > 0 && recent[0] == roomID {
+		return
+	}
+
+	rooms := make([]matrix.RoomID, 1, len(recent)+1)
+	rooms[0] = roomID
+
+	for _, id := range recent {
+		if id != roomID && len(rooms) < MaxRooms {
+			rooms = append(rooms, id)
+		}
+	}
+
+	c.AsyncSetConfig(&Event{
+		EventInfo:   event.EventInfo{Type: EventType},
+		RecentRooms: rooms,
+	}, done)
+}
@@ -0,0 +1,272 @@
+// Package contact implements sharing contacts in messages. A contact is sent as
+// a room message with a custom message type that has the contact as a vCard.
+// Its body has the contact in plain text for clients that don't know the
+// message type.
+package contact
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+
+	"github.com/diamondburned/gotrix/event"
+	"github.com/pkg/errors"
+)
+
+// MessageType is the message type of contact messages.
+const MessageType event.MessageType = "xyz.diamondb.gotktrix.contact"
+
+// contentKey is the key of the contact in the message content.
+const contentKey = "xyz.diamondb.gotktrix.contact"
+
+// IsVCard returns true if a file with the given name and MIME type is a vCard.
+// Bridges send contacts from other networks as vCard files.
+func IsVCard(name, mimeType string) bool {
+	switch mimeType {
+	case "text/vcard", "text/x-vcard", "text/directory":
+		return true
+	}
+	return strings.HasSuffix(strings.ToLower(name), ".vcf")
+}
+
+// Contact is a contact card.
+type Contact struct {
+	Name   string
+	Org    string
+	Phones []string
+	Emails []string
+	URLs   []string
+}
+
+// Content is the contact in the message content.
+type Content struct {
+	VCard string `json:"vcard"`
+}
+
+// Message is a room message that shares a contact.
+type Message struct {
+	event.RoomMessageEvent
+	Contact Content `json:"xyz.diamondb.gotktrix.contact"`
+}
+
+// NewMessage creates a message content that shares the given contact.
+func NewMessage(ev event.RoomMessageEvent, c *Contact) *Message {
+	ev.MessageType = MessageType
+	ev.Body = c.Text()
+
+	return &Message{
+		RoomMessageEvent: ev,
+		Contact:          Content{VCard: c.VCard()},
+	}
+}
+
+// FromMessage parses the contact out of the given contact message.
+func FromMessage(ev *event.RoomMessageEvent) (*Contact, error) {
+	var raw struct {
+		Content map[string]json.RawMessage `json:"content"`
+	}
+
+	if err := json.Unmarshal(ev.Raw, &raw); err != nil {
+		return nil, errors.Wrap(err, "cannot parse message")
+	}
+
+	var content Content
+	if err := json.Unmarshal(raw.Content[contentKey], &content); err != nil {
+		return nil, errors.Wrap(err, "cannot parse contact")
+	}
+
+	return ParseVCard(content.VCard)
+}
+
+// ParseVCard parses the first contact in the given vCard. Only the properties
+// that Contact has are kept.
+func ParseVCard(vcard string) (*Contact, error) {
+	var c Contact
+	var begun bool
+	var name string
+
+lines:
+	for _, line := range unfoldLines(vcard) {
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+
+		// Drop the parameters and the group.
+		prop := strings.ToUpper(line[:colon])
+		if semi := strings.IndexByte(prop, ';'); semi >= 0 {
+			prop = prop[:semi]
+		}
+		if dot := strings.LastIndexByte(prop, '.'); dot >= 0 {
+			prop = prop[dot+1:]
+		}
+
+		value := line[colon+1:]
+
+		switch prop {
+		case "BEGIN":
+			if strings.EqualFold(value, "VCARD") {
+				begun = true
+			}
+			continue
+		case "END":
+			if begun {
+				break lines
+			}
+			continue
+		}
+
+		if !begun {
+			continue
+		}
+
+		switch prop {
+		case "FN":
+			c.Name = unescape(value)
+		case "N":
+			// Family; Given; Additional; Prefix; Suffix
+			parts := splitValue(value)
+			if len(parts) > 1 {
+				name = strings.TrimSpace(parts[1] + " " + parts[0])
+			} else if len(parts) > 0 {
+				name = parts[0]
+			}
+		case "ORG":
+			c.Org = strings.Join(splitValue(value), ", ")
+		case "TEL":
+			c.Phones = append(c.Phones, strings.TrimPrefix(unescape(value), "tel:"))
+		case "EMAIL":
+			c.Emails = append(c.Emails, unescape(value))
+		case "URL":
+			c.URLs = append(c.URLs, unescape(value))
+		}
+	}
+
+	if !begun {
+		return nil, errors.New("not a vCard")
+	}
+
+	if c.Name == "" {
+		c.Name = name
+	}
+
+	return &c, nil
+}
+
+// unfoldLines splits the vCard into lines, joining the lines that are folded.
+func unfoldLines(vcard string) []string {
+	var lines []string
+
+	scanner := bufio.NewScanner(strings.NewReader(vcard))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// splitValue splits a structured value at its unescaped semicolons.
+func splitValue(value string) []string {
+	var parts []string
+	var part strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if i+1 < len(value) {
+				part.WriteByte(value[i])
+				part.WriteByte(value[i+1])
+				i++
+			}
+		case ';':
+			if s := unescape(part.String()); s != "" {
+				parts = append(parts, s)
+			}
+			part.Reset()
+		default:
+			part.WriteByte(value[i])
+		}
+	}
+
+	if s := unescape(part.String()); s != "" {
+		parts = append(parts, s)
+	}
+
+	return parts
+}
+
+var unescaper = strings.NewReplacer(
+	`\n`, "\n",
+	`\N`, "\n",
+	`\,`, ",",
+	`\;`, ";",
+	`\\`, `\`,
+)
+
+func unescape(value string) string {
+	return unescaper.Replace(value)
+}
+
+var escaper = strings.NewReplacer(
+	`\`, `\\`,
+	"\n", `\n`,
+	",", `\,`,
+	";", `\;`,
+)
+
+func escape(value string) string {
+	return escaper.Replace(value)
+}
+
+// VCard returns the contact as a vCard.
+func (c *Contact) VCard() string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCARD\r\n")
+	b.WriteString("VERSION:3.0\r\n")
+	b.WriteString("FN:" + escape(c.Name) + "\r\n")
+	b.WriteString("N:;" + escape(c.Name) + ";;;\r\n")
+
+	if c.Org != "" {
+		b.WriteString("ORG:" + escape(c.Org) + "\r\n")
+	}
+	for _, phone := range c.Phones {
+		b.WriteString("TEL:" + escape(phone) + "\r\n")
+	}
+	for _, email := range c.Emails {
+		b.WriteString("EMAIL:" + escape(email) + "\r\n")
+	}
+	for _, url := range c.URLs {
+		b.WriteString("URL:" + escape(url) + "\r\n")
+	}
+
+	b.WriteString("END:VCARD\r\n")
+	return b.String()
+}
+
+// Text returns the contact in plain text, which is used as the message body.
+func (c *Contact) Text() string {
+	var b strings.Builder
+	b.WriteString("Contact: " + c.Name)
+
+	if c.Org != "" {
+		b.WriteString("\nOrganization: " + c.Org)
+	}
+	for _, phone := range c.Phones {
+		b.WriteString("\nPhone: " + phone)
+	}
+	for _, email := range c.Emails {
+		b.WriteString("\nEmail: " + email)
+	}
+	for _, url := range c.URLs {
+		b.WriteString("\nWebsite: " + url)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,49 @@
+// Package effects implements message effects. A message with an effect is a
+// text message with a custom message type, and clients that know the type play
+// a short animation over the room when it arrives. The message types are the
+// ones that Element sends.
+package effects
+
+import "github.com/diamondburned/gotrix/event"
+
+const (
+	// Confetti is the message type of messages sent with confetti.
+	Confetti event.MessageType = "nic.custom.confetti"
+	// Snowfall is the message type of messages sent with falling snow.
+	Snowfall event.MessageType = "io.element.effect.snowfall"
+	// Hearts is the message type of messages sent with floating hearts.
+	Hearts event.MessageType = "io.element.effect.hearts"
+	// Rainfall is the message type of messages sent with falling rain.
+	Rainfall event.MessageType = "io.element.effect.rainfall"
+)
+
+// All is the list of all known effects, in the order that they're offered to
+// the user.
+var All = []event.MessageType{Confetti, Snowfall, Hearts, Rainfall}
+
+// IsEffect returns true if the given message type is a known effect.
+func IsEffect(msgType event.MessageType) bool {
+	for _, effect := range All {
+		if effect == msgType {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the name of the effect that's shown to the user, or an empty
+// string if the message type isn't a known effect. The name isn't localized.
+func Name(msgType event.MessageType) string {
+	switch msgType {
+	case Confetti:
+		return "Confetti"
+	case Snowfall:
+		return "Snow"
+	case Hearts:
+		return "Hearts"
+	case Rainfall:
+		return "Rain"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,125 @@
+// Package encryption implements the events of end-to-end encrypted rooms.
+package encryption
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+func init() {
+	event.RegisterDefault(EventType, parseEvent)
+	event.RegisterDefault(EncryptedEventType, parseEncryptedEvent)
+}
+
+const (
+	// EventType is the type of the state event that enables encryption in a
+	// room. Encryption can't be disabled once it's enabled.
+	EventType event.Type = "m.room.encryption"
+	// EncryptedEventType is the type of encrypted room and to-device events.
+	EncryptedEventType event.Type = "m.room.encrypted"
+	// RoomKeyEventType is the type of the to-device event that shares a Megolm
+	// session.
+	RoomKeyEventType event.Type = "m.room_key"
+)
+
+// Algorithm is an encryption algorithm.
+type Algorithm string
+
+const (
+	// Olm is the algorithm of to-device messages between two devices.
+	Olm Algorithm = "m.olm.v1.curve25519-aes-sha2"
+	// Megolm is the algorithm of room messages.
+	Megolm Algorithm = "m.megolm.v1.aes-sha2"
+)
+
+const (
+	defaultRotationPeriod     = 7 * 24 * time.Hour
+	defaultRotationPeriodMsgs = 100
+)
+
+// Event is the m.room.encryption state event.
+type Event struct {
+	event.StateEventInfo `json:"-"`
+
+	Algorithm Algorithm `json:"algorithm"`
+	// RotationPeriodMs is how long a Megolm session is used for before it's
+	// replaced.
+	RotationPeriodMs int64 `json:"rotation_period_ms,omitempty"`
+	// RotationPeriodMsgs is how many messages a Megolm session is used for
+	// before it's replaced.
+	RotationPeriodMsgs int `json:"rotation_period_msgs,omitempty"`
+}
+
+var _ event.StateEvent = (*Event)(nil)
+
+func parseEvent(content json.RawMessage) (event.Event, error) {
+	var ev Event
+	err := json.Unmarshal(content, &ev)
+	return &ev, err
+}
+
+// RotationPeriod returns the rotation period or its default.
+func (ev *Event) RotationPeriod() time.Duration {
+	if ev.RotationPeriodMs <= 0 {
+		return defaultRotationPeriod
+	}
+	return time.Duration(ev.RotationPeriodMs) * time.Millisecond
+}
+
+// RotationMessages returns the number of messages per session or its default.
+func (ev *Event) RotationMessages() int {
+	if ev.RotationPeriodMsgs <= 0 {
+		return defaultRotationPeriodMsgs
+	}
+	return ev.RotationPeriodMsgs
+}
+
+// EncryptedEvent is an m.room.encrypted event. Room events are only left
+// encrypted if they can't be decrypted.
+type EncryptedEvent struct {
+	event.RoomEventInfo `json:"-"`
+	EncryptedContent
+}
+
+var _ event.RoomEvent = (*EncryptedEvent)(nil)
+
+func parseEncryptedEvent(content json.RawMessage) (event.Event, error) {
+	var ev EncryptedEvent
+	err := json.Unmarshal(content, &ev)
+	return &ev, err
+}
+
+// EncryptedContent is the content of an m.room.encrypted event.
+type EncryptedContent struct {
+	Algorithm Algorithm `json:"algorithm"`
+	SenderKey string    `json:"sender_key"`
+	// Ciphertext is a string for Megolm or an OlmCiphertexts for Olm.
+	Ciphertext json.RawMessage `json:"ciphertext"`
+	// SessionID and DeviceID are only set for Megolm.
+	SessionID string          `json:"session_id,omitempty"`
+	DeviceID  matrix.DeviceID `json:"device_id,omitempty"`
+	// RelatesTo is kept unencrypted, so that the homeserver can aggregate
+	// relations.
+	RelatesTo json.RawMessage `json:"m.relates_to,omitempty"`
+}
+
+// OlmCiphertexts maps the Curve25519 identity key of each recipient device to
+// its message.
+type OlmCiphertexts map[string]OlmMessage
+
+// OlmMessage is an Olm message to a device.
+type OlmMessage struct {
+	Type int    `json:"type"`
+	Body string `json:"body"`
+}
+
+// RoomKey is the content of an m.room_key event.
+type RoomKey struct {
+	Algorithm  Algorithm     `json:"algorithm"`
+	RoomID     matrix.RoomID `json:"room_id"`
+	SessionID  string        `json:"session_id"`
+	SessionKey string        `json:"session_key"`
+}
@@ -0,0 +1,72 @@
+// Package ignored provides an implementation of the m.ignored_user_list account
+// data event. The homeserver stops sending events from the users in the list,
+// and clients hide what's left.
+package ignored
+
+import (
+	"encoding/json"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+func init() {
+	event.RegisterDefault(EventType, parseEvent)
+}
+
+// EventType is the event type for m.ignored_user_list.
+const EventType event.Type = "m.ignored_user_list"
+
+// Event describes the m.ignored_user_list event.
+type Event struct {
+	event.EventInfo `json:"-"`
+
+	// IgnoredUsers is the set of ignored users. The values are always empty
+	// objects.
+	IgnoredUsers map[matrix.UserID]struct{} `json:"ignored_users"`
+}
+
+func parseEvent(content json.RawMessage) (event.Event, error) {
+	var ev Event
+	err := json.Unmarshal(content, &ev)
+	return &ev, err
+}
+
+// Users returns the set of users that the user has ignored. The returned map
+// must not be modified.
+func Users(c *gotktrix.Client) map[matrix.UserID]struct{} {
+	e, _ := c.State.UserEvent(EventType)
+	if ev, ok := e.(*Event); ok {
+		return ev.IgnoredUsers
+	}
+	return nil
+}
+
+// IsIgnored returns true if the given user is ignored.
+func IsIgnored(c *gotktrix.Client, userID matrix.UserID) bool {
+	_, ok := Users(c)[userID]
+	return ok
+}
+
+// SetIgnored ignores or stops ignoring the given user. The state is updated
+// immediately, while the account data is updated in the background; done is
+// called once that's done, if it's not nil.
+func SetIgnored(c *gotktrix.Client, userID matrix.UserID, ignore bool, done func(error)) {
+	old := Users(c)
+	users := make(map[matrix.UserID]struct{}, len(old)+1)
+	for id := range old {
+		users[id] = struct{}{}
+	}
+
+	if ignore {
+		users[userID] = struct{}{}
+	} else {
+		delete(users, userID)
+	}
+
+	c.AsyncSetConfig(&Event{
+		EventInfo:    event.EventInfo{Type: EventType},
+		IgnoredUsers: users,
+	}, done)
+}
@@ -0,0 +1,146 @@
+// Package location implements sharing locations, both as one-off m.location
+// messages with the extensible event fields of MSC3488 and as live locations
+// as described in MSC3489. Only the unstable event types of live locations are
+// used, since that's what other clients send.
+package location
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+const (
+	// BeaconInfoEventType is the type of the state event that starts or stops
+	// sharing a live location. Its state key is the user's ID.
+	BeaconInfoEventType event.Type = "org.matrix.msc3672.beacon_info"
+	// BeaconEventType is the type of each location update of a live location.
+	BeaconEventType event.Type = "org.matrix.msc3672.beacon"
+)
+
+// referenceType is the relation type of location updates to their beacon info.
+const referenceType = "m.reference"
+
+// AssetType is what a location is of.
+type AssetType string
+
+const (
+	// Self is the location of the user.
+	Self AssetType = "m.self"
+	// Pin is a location that the user picked.
+	Pin AssetType = "m.pin"
+)
+
+// Location is a location in the extensible event format.
+type Location struct {
+	URI         matrix.GeoURI `json:"uri"`
+	Description string        `json:"description,omitempty"`
+}
+
+// Asset is what a location is of.
+type Asset struct {
+	Type AssetType `json:"type"`
+}
+
+// GeoURI returns the geo URI of the given coordinates. The accuracy is in
+// meters, and it's left out if it's 0.
+func GeoURI(lat, long, accuracy float64) matrix.GeoURI {
+	uri := "geo:" +
+		strconv.FormatFloat(lat, 'f', 6, 64) + "," +
+		strconv.FormatFloat(long, 'f', 6, 64)
+
+	if accuracy > 0 {
+		uri += ";u=" + strconv.FormatFloat(accuracy, 'f', 0, 64)
+	}
+
+	return matrix.GeoURI(uri)
+}
+
+// Message is an m.location message that also has the extensible event fields.
+type Message struct {
+	event.RoomMessageEvent
+	Location  Location         `json:"org.matrix.msc3488.location"`
+	Asset     Asset            `json:"org.matrix.msc3488.asset"`
+	Timestamp matrix.Timestamp `json:"org.matrix.msc3488.ts"`
+}
+
+// NewMessage creates a message that shares the given location. The body is
+// the description, or the geo URI if there's none.
+func NewMessage(ev event.RoomMessageEvent, uri matrix.GeoURI, description string, asset AssetType) *Message {
+	ev.MessageType = event.RoomMessageLocation
+	ev.GeoURI = uri
+
+	ev.Body = description
+	if ev.Body == "" {
+		ev.Body = string(uri)
+	}
+
+	return &Message{
+		RoomMessageEvent: ev,
+		Location:         Location{URI: uri, Description: description},
+		Asset:            Asset{Type: asset},
+		Timestamp:        now(),
+	}
+}
+
+// BeaconInfo is the content of the state event that starts or stops sharing a
+// live location.
+type BeaconInfo struct {
+	Description string `json:"description,omitempty"`
+	Live        bool   `json:"live"`
+	// Timeout is how long the location is shared for in milliseconds.
+	Timeout   int64            `json:"timeout"`
+	Timestamp matrix.Timestamp `json:"org.matrix.msc3488.ts"`
+	Asset     Asset            `json:"org.matrix.msc3488.asset"`
+}
+
+// NewBeaconInfo creates the content that starts sharing the user's live
+// location for the given duration.
+func NewBeaconInfo(description string, timeout time.Duration) BeaconInfo {
+	return BeaconInfo{
+		Description: description,
+		Live:        true,
+		Timeout:     timeout.Milliseconds(),
+		Timestamp:   now(),
+		Asset:       Asset{Type: Self},
+	}
+}
+
+// Stopped returns the content that stops sharing the live location that info
+// started.
+func (info BeaconInfo) Stopped() BeaconInfo {
+	info.Live = false
+	return info
+}
+
+// Reference is the relation of a location update to its beacon info.
+type Reference struct {
+	RelType string         `json:"rel_type"`
+	EventID matrix.EventID `json:"event_id"`
+}
+
+// Beacon is the content of a location update of a live location.
+type Beacon struct {
+	RelatesTo Reference        `json:"m.relates_to"`
+	Location  Location         `json:"org.matrix.msc3488.location"`
+	Timestamp matrix.Timestamp `json:"org.matrix.msc3488.ts"`
+}
+
+// NewBeacon creates a location update for the live location started by the
+// beacon info event with the given ID.
+func NewBeacon(infoID matrix.EventID, uri matrix.GeoURI) Beacon {
+	return Beacon{
+		RelatesTo: Reference{
+			RelType: referenceType,
+			EventID: infoID,
+		},
+		Location:  Location{URI: uri},
+		Timestamp: now(),
+	}
+}
+
+func now() matrix.Timestamp {
+	return matrix.Timestamp(time.Now().UnixMilli())
+}
@@ -0,0 +1,71 @@
+// Package policy provides the m.policy.rule.* state events from MSC2313, which
+// moderation policy lists (also known as ban lists) consist of.
+package policy
+
+import (
+	"encoding/json"
+
+	"github.com/diamondburned/gotrix/event"
+)
+
+func init() {
+	event.RegisterDefault(UserRuleEventType, parseRuleEvent)
+	event.RegisterDefault(ServerRuleEventType, parseRuleEvent)
+	event.RegisterDefault(RoomRuleEventType, parseRuleEvent)
+}
+
+const (
+	// UserRuleEventType is the event type for rules that match users.
+	UserRuleEventType event.Type = "m.policy.rule.user"
+	// ServerRuleEventType is the event type for rules that match homeservers.
+	ServerRuleEventType event.Type = "m.policy.rule.server"
+	// RoomRuleEventType is the event type for rules that match rooms.
+	RoomRuleEventType event.Type = "m.policy.rule.room"
+)
+
+// RuleEventTypes lists all policy rule event types.
+var RuleEventTypes = []event.Type{
+	UserRuleEventType,
+	ServerRuleEventType,
+	RoomRuleEventType,
+}
+
+// Recommendation is the action that a policy rule recommends.
+type Recommendation string
+
+const (
+	// Ban recommends banning the entity.
+	Ban Recommendation = "m.ban"
+	// legacyBan is what Mjolnir used before MSC2313 was finalized. Lists that
+	// have been around for a while still have rules with it.
+	legacyBan Recommendation = "org.matrix.mjolnir.ban"
+)
+
+// IsBan returns true if the recommendation is to ban the entity.
+func (r Recommendation) IsBan() bool {
+	return r == Ban || r == legacyBan
+}
+
+// RuleEvent is a single rule inside a policy list. The state key is an opaque
+// identifier; the rule matches the entities that match the Entity glob.
+type RuleEvent struct {
+	event.StateEventInfo `json:"-"`
+
+	// Entity is a glob that matches the user ID, server name or room ID that
+	// the rule applies to. It supports * and ?.
+	Entity         string         `json:"entity"`
+	Recommendation Recommendation `json:"recommendation"`
+	Reason         string         `json:"reason,omitempty"`
+}
+
+func parseRuleEvent(content json.RawMessage) (event.Event, error) {
+	var ev RuleEvent
+	err := json.Unmarshal(content, &ev)
+	return &ev, err
+}
+
+// IsRemoved returns true if the rule was removed. Rules are removed by sending
+// an empty state event over them, so they have no entity.
+func (ev *RuleEvent) IsRemoved() bool {
+	return ev.Entity == ""
+}
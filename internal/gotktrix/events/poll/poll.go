@@ -0,0 +1,383 @@
+// Package poll implements polls as described in MSC3381. Only the unstable
+// event types are used, since that's what other clients send.
+package poll
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	event.RegisterDefault(StartEventType, parseStartEvent)
+	event.RegisterDefault(ResponseEventType, parseResponseEvent)
+	event.RegisterDefault(EndEventType, parseEndEvent)
+}
+
+const (
+	// StartEventType is the event type of the event that starts a poll.
+	StartEventType event.Type = "org.matrix.msc3381.poll.start"
+	// ResponseEventType is the event type of a vote in a poll.
+	ResponseEventType event.Type = "org.matrix.msc3381.poll.response"
+	// EndEventType is the event type of the event that closes a poll.
+	EndEventType event.Type = "org.matrix.msc3381.poll.end"
+)
+
+// MessageType is the message type of the messages returned by MessageEvent. It
+// is never sent.
+const MessageType event.MessageType = event.MessageType(StartEventType)
+
+// referenceType is the relation type of responses and ends to their poll.
+const referenceType = "m.reference"
+
+// Kind is the kind of poll.
+type Kind string
+
+const (
+	// Disclosed polls show their results while they're open.
+	Disclosed Kind = "org.matrix.msc3381.poll.disclosed"
+	// Undisclosed polls only show their results once they're closed.
+	Undisclosed Kind = "org.matrix.msc3381.poll.undisclosed"
+)
+
+// MaxAnswers is the maximum number of answers in a poll.
+const MaxAnswers = 20
+
+// Start is the poll in a poll start event.
+type Start struct {
+	Question      Text     `json:"question"`
+	Kind          Kind     `json:"kind"`
+	MaxSelections int      `json:"max_selections"`
+	Answers       []Answer `json:"answers"`
+}
+
+// Text is a text block in an extensible event.
+type Text struct {
+	Text string `json:"org.matrix.msc1767.text"`
+}
+
+// Answer is an answer that can be voted for.
+type Answer struct {
+	ID   string `json:"id"`
+	Text string `json:"org.matrix.msc1767.text"`
+}
+
+// Reference is the relation of a response or an end event to its poll.
+type Reference struct {
+	RelType string         `json:"rel_type"`
+	EventID matrix.EventID `json:"event_id"`
+}
+
+// StartEvent is an event that starts a poll.
+type StartEvent struct {
+	event.RoomEventInfo `json:"-"`
+
+	Poll Start  `json:"org.matrix.msc3381.poll.start"`
+	Text string `json:"org.matrix.msc1767.text,omitempty"`
+}
+
+// NewStartEvent creates a new disclosed or undisclosed poll. At most
+// maxSelections answers can be voted for at once.
+func NewStartEvent(roomID matrix.RoomID, question string, answers []string, kind Kind, maxSelections int) *StartEvent {
+	start := Start{
+		Question:      Text{question},
+		Kind:          kind,
+		MaxSelections: maxSelections,
+		Answers:       make([]Answer, len(answers)),
+	}
+
+	var fallback strings.Builder
+	fallback.WriteString(question)
+
+	for i, answer := range answers {
+		start.Answers[i] = Answer{
+			ID:   strconv.Itoa(i + 1),
+			Text: answer,
+		}
+		fallback.WriteString("\n" + strconv.Itoa(i+1) + ". " + answer)
+	}
+
+	return &StartEvent{
+		RoomEventInfo: event.RoomEventInfo{
+			EventInfo: event.EventInfo{Type: StartEventType},
+			RoomID:    roomID,
+		},
+		Poll: start,
+		Text: fallback.String(),
+	}
+}
+
+func parseStartEvent(content json.RawMessage) (event.Event, error) {
+	var ev StartEvent
+	err := json.Unmarshal(content, &ev)
+	return &ev, err
+}
+
+// MaxVotes returns the number of answers that can be voted for at once.
+func (ev *StartEvent) MaxVotes() int {
+	if ev.Poll.MaxSelections < 1 {
+		return 1
+	}
+	return ev.Poll.MaxSelections
+}
+
+// MessageEvent returns the poll as a room message, so it can be shown like one.
+// The message has type MessageType, and its body is the fallback text.
+func MessageEvent(ev *StartEvent) *event.RoomMessageEvent {
+	return &event.RoomMessageEvent{
+		RoomEventInfo: ev.RoomEventInfo,
+		MessageType:   MessageType,
+		Body:          ev.Text,
+	}
+}
+
+// FromMessage returns the poll of a message returned by MessageEvent.
+func FromMessage(msg *event.RoomMessageEvent) (*StartEvent, error) {
+	if msg.Raw == nil {
+		return nil, errors.New("poll has no raw event")
+	}
+
+	ev, err := event.Parse(msg.Raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse poll")
+	}
+
+	start, ok := ev.(*StartEvent)
+	if !ok {
+		return nil, errors.New("message is not a poll")
+	}
+
+	return start, nil
+}
+
+// ResponseEvent is a vote in a poll.
+type ResponseEvent struct {
+	event.RoomEventInfo `json:"-"`
+
+	RelatesTo Reference `json:"m.relates_to"`
+	Response  struct {
+		Answers []string `json:"answers"`
+	} `json:"org.matrix.msc3381.poll.response"`
+}
+
+// NewResponseEvent creates a vote for the given answers in the given poll. An
+// empty vote takes back the user's vote.
+func NewResponseEvent(roomID matrix.RoomID, pollID matrix.EventID, answers []string) *ResponseEvent {
+	ev := ResponseEvent{
+		RoomEventInfo: event.RoomEventInfo{
+			EventInfo: event.EventInfo{Type: ResponseEventType},
+			RoomID:    roomID,
+		},
+		RelatesTo: Reference{
+			RelType: referenceType,
+			EventID: pollID,
+		},
+	}
+	ev.Response.Answers = answers
+	if ev.Response.Answers == nil {
+		ev.Response.Answers = []string{}
+	}
+	return &ev
+}
+
+func parseResponseEvent(content json.RawMessage) (event.Event, error) {
+	var ev ResponseEvent
+	err := json.Unmarshal(content, &ev)
+	return &ev, err
+}
+
+// EndEvent closes a poll.
+type EndEvent struct {
+	event.RoomEventInfo `json:"-"`
+
+	RelatesTo Reference       `json:"m.relates_to"`
+	End       json.RawMessage `json:"org.matrix.msc3381.poll.end"`
+	Text      string          `json:"org.matrix.msc1767.text,omitempty"`
+}
+
+// NewEndEvent creates an event that closes the given poll.
+func NewEndEvent(roomID matrix.RoomID, pollID matrix.EventID) *EndEvent {
+	return &EndEvent{
+		RoomEventInfo: event.RoomEventInfo{
+			EventInfo: event.EventInfo{Type: EndEventType},
+			RoomID:    roomID,
+		},
+		RelatesTo: Reference{
+			RelType: referenceType,
+			EventID: pollID,
+		},
+		End:  json.RawMessage("{}"),
+		Text: "Ended poll",
+	}
+}
+
+func parseEndEvent(content json.RawMessage) (event.Event, error) {
+	var ev EndEvent
+	err := json.Unmarshal(content, &ev)
+	return &ev, err
+}
+
+// RelatesTo returns the poll that the given response or end event belongs to,
+// or an empty string if the event isn't either.
+func RelatesTo(ev event.RoomEvent) matrix.EventID {
+	switch ev := ev.(type) {
+	case *ResponseEvent:
+		return ev.RelatesTo.EventID
+	case *EndEvent:
+		return ev.RelatesTo.EventID
+	default:
+		return ""
+	}
+}
+
+type vote struct {
+	answers []string
+	time    matrix.Timestamp
+}
+
+// Tally counts the votes of a poll. Only the latest vote of each user counts,
+// and votes cast after the poll is closed are ignored.
+type Tally struct {
+	start *StartEvent
+	votes map[matrix.UserID]vote
+	ended matrix.Timestamp
+}
+
+// NewTally creates a new tally for the given poll.
+func NewTally(start *StartEvent) *Tally {
+	return &Tally{
+		start: start,
+		votes: make(map[matrix.UserID]vote),
+	}
+}
+
+// Add adds the given response or end event into the tally. False is returned
+// if the event isn't for this poll.
+func (t *Tally) Add(ev event.RoomEvent) bool {
+	if RelatesTo(ev) != t.start.ID {
+		return false
+	}
+
+	switch ev := ev.(type) {
+	case *ResponseEvent:
+		t.Vote(ev.Sender, ev.Response.Answers, ev.OriginServerTime)
+	case *EndEvent:
+		// Only the poll's author can close it.
+		if ev.Sender != t.start.Sender {
+			return true
+		}
+		if t.ended > 0 && t.ended < ev.OriginServerTime {
+			return true
+		}
+
+		t.ended = ev.OriginServerTime
+
+		for user, vote := range t.votes {
+			if vote.time > t.ended {
+				delete(t.votes, user)
+			}
+		}
+	}
+
+	return true
+}
+
+// Vote sets the user's vote to the given answers. Answers that aren't in the
+// poll are dropped, and only the first few answers that can be voted for at
+// once count.
+func (t *Tally) Vote(user matrix.UserID, answers []string, time matrix.Timestamp) {
+	if t.ended > 0 && time > t.ended {
+		return
+	}
+	if last, ok := t.votes[user]; ok && last.time > time {
+		return
+	}
+
+	valid := make([]string, 0, len(answers))
+	for _, answer := range answers {
+		if len(valid) == t.start.MaxVotes() {
+			break
+		}
+		if t.hasAnswer(answer) && !containsString(valid, answer) {
+			valid = append(valid, answer)
+		}
+	}
+
+	// An empty vote is a spoiled vote, which still replaces the last one.
+	t.votes[user] = vote{valid, time}
+}
+
+func (t *Tally) hasAnswer(id string) bool {
+	for _, answer := range t.start.Poll.Answers {
+		if answer.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Ended returns true if the poll is closed.
+func (t *Tally) Ended() bool {
+	return t.ended > 0
+}
+
+// Votes returns the answers that the given user voted for.
+func (t *Tally) Votes(user matrix.UserID) []string {
+	return t.votes[user].answers
+}
+
+// Counts returns the number of votes for each answer ID.
+func (t *Tally) Counts() map[string]int {
+	counts := make(map[string]int, len(t.start.Poll.Answers))
+	for _, vote := range t.votes {
+		for _, answer := range vote.answers {
+			counts[answer]++
+		}
+	}
+	return counts
+}
+
+// Voters returns the number of users who voted for at least one answer.
+func (t *Tally) Voters() int {
+	var n int
+	for _, vote := range t.votes {
+		if len(vote.answers) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Winners returns the answers with the most votes, or nil if nobody voted.
+func (t *Tally) Winners() []string {
+	counts := t.Counts()
+
+	var max int
+	var winners []string
+
+	for _, answer := range t.start.Poll.Answers {
+		switch n := counts[answer.ID]; {
+		case n == 0 || n < max:
+			continue
+		case n > max:
+			max = n
+			winners = winners[:0]
+		}
+		winners = append(winners, answer.ID)
+	}
+
+	return winners
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
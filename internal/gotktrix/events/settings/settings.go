@@ -0,0 +1,56 @@
+// Package settings provides the account data event that gotktrix keeps its
+// settings in, so that they roam between devices.
+package settings
+
+import (
+	"encoding/json"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+func init() {
+	event.RegisterDefault(EventType, parseEvent)
+}
+
+// EventType is the event type for xyz.diamondb.gotktrix.settings.
+const EventType event.Type = "xyz.diamondb.gotktrix.settings"
+
+// Event describes the xyz.diamondb.gotktrix.settings account data event.
+type Event struct {
+	event.EventInfo `json:"-"`
+
+	// Prefs maps preference IDs to their values, like the local prefs.json.
+	Prefs map[string]json.RawMessage `json:"prefs,omitempty"`
+	// SortModes maps room list section tags to how their rooms are sorted.
+	SortModes map[matrix.TagName]string `json:"sort_modes,omitempty"`
+}
+
+func parseEvent(content json.RawMessage) (event.Event, error) {
+	var ev Event
+	err := json.Unmarshal(content, &ev)
+	return &ev, err
+}
+
+// Current returns a copy of the current user's settings event from the state.
+// An empty event is returned if the user has none.
+func Current(c *gotktrix.Client) *Event {
+	ev := Event{
+		EventInfo: event.EventInfo{Type: EventType},
+		Prefs:     map[string]json.RawMessage{},
+		SortModes: map[matrix.TagName]string{},
+	}
+
+	e, _ := c.State.UserEvent(EventType)
+	if current, ok := e.(*Event); ok {
+		for k, v := range current.Prefs {
+			ev.Prefs[k] = v
+		}
+		for k, v := range current.SortModes {
+			ev.SortModes[k] = v
+		}
+	}
+
+	return &ev
+}
@@ -0,0 +1,219 @@
+package gotktrix
+
+import (
+	"encoding/json"
+
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// PowerSource is where the power level required for an action comes from.
+type PowerSource string
+
+const (
+	// PowerNoLevels means the room has no power levels event, so the defaults
+	// from the specification apply: the room creator has power level 100 and
+	// everyone else 0, anyone may send events, and moderation actions other
+	// than inviting need power level 50.
+	PowerNoLevels PowerSource = ""
+	// PowerEventOverride means the event type has its own level in "events".
+	PowerEventOverride PowerSource = "events"
+	// PowerEventsDefault is the default level for sending messages.
+	PowerEventsDefault PowerSource = "events_default"
+	// PowerStateDefault is the default level for sending state events.
+	PowerStateDefault PowerSource = "state_default"
+	// PowerActionLevel is the level of a moderation action such as "ban".
+	PowerActionLevel PowerSource = "action"
+)
+
+// PermissionExplanation describes how the homeserver decides whether the user
+// may do something in a room. It has everything needed to explain to the user
+// why they can or can't do it.
+type PermissionExplanation struct {
+	// Allowed is true if the user may do it.
+	Allowed bool
+
+	// Membership is the user's membership in the room. Users must be joined
+	// to do anything.
+	Membership event.MemberType
+	// JoinRule is the room's join rule, which decides how the user may join if
+	// they aren't joined.
+	JoinRule event.JoinRule
+
+	// UserLevel is the user's power level.
+	UserLevel int
+	// UserLevelExplicit is false if UserLevel is the room's default for users.
+	UserLevelExplicit bool
+	// IsCreator is true if the user created the room, which gives them power
+	// level 100 if the room has no power levels event.
+	IsCreator bool
+
+	// Required is the power level needed.
+	Required int
+	// RequiredSource is where Required comes from.
+	RequiredSource PowerSource
+
+	// Action is the moderation action that was explained, or zero if an event
+	// was explained.
+	Action PowerAction
+	// Target is the user that the action is done to, if any.
+	Target matrix.UserID
+	// TargetLevel is the target's power level. Kicking and banning a user
+	// needs a higher power level than theirs.
+	TargetLevel int
+	// TargetMembership is the target's membership in the room.
+	TargetMembership event.MemberType
+}
+
+// ExplainSendEvent explains whether the user may send an event of the given type
+// in the given room. If state is true, then the event is checked as a state
+// event.
+func (c *Client) ExplainSendEvent(roomID matrix.RoomID, typ event.Type, state bool) PermissionExplanation {
+	x := c.explainMember(roomID)
+
+	levels, raw := c.explainLevels(roomID, &x)
+	if levels != nil {
+		if level, ok := levels.Events[typ]; ok {
+			x.Required = level
+			x.RequiredSource = PowerEventOverride
+		} else if state {
+			// state_default is 50 if it's missing, unlike events_default.
+			x.Required = 50
+			if _, ok := raw["state_default"]; ok {
+				x.Required = levels.StateRequirement
+			}
+			x.RequiredSource = PowerStateDefault
+		} else {
+			x.Required = levels.EventRequirement
+			x.RequiredSource = PowerEventsDefault
+		}
+	}
+
+	x.Allowed = x.Membership == event.MemberJoined && x.hasLevel()
+	return x
+}
+
+// ExplainAction explains whether the user may do the given moderation action in
+// the given room. The target is the user that the action is done to; it may be
+// empty for RedactAction and InviteAction.
+func (c *Client) ExplainAction(roomID matrix.RoomID, action PowerAction, target matrix.UserID) PermissionExplanation {
+	x := c.explainMember(roomID)
+	x.Action = action
+	x.Target = target
+
+	// invite defaults to 0, unlike the other actions.
+	x.Required = 50
+	if action == InviteAction {
+		x.Required = 0
+	}
+
+	levels, _ := c.explainLevels(roomID, &x)
+	if levels == nil {
+		if target != "" {
+			if e, err := c.RoomState(roomID, event.TypeRoomCreate, ""); err == nil &&
+				e.(*event.RoomCreateEvent).Creator == target {
+				x.TargetLevel = 100
+			}
+		}
+	} else {
+		x.RequiredSource = PowerActionLevel
+
+		var level *int
+		switch action {
+		case BanAction:
+			level = levels.BanRequirement
+		case InviteAction:
+			level = levels.InviteRequirement
+		case KickAction:
+			level = levels.KickRequirement
+		case RedactAction:
+			level = levels.RedactRequirement
+		}
+		if level != nil {
+			x.Required = *level
+		}
+
+		if target != "" {
+			x.TargetLevel = levels.UserDefault
+			if l, ok := levels.UserLevel[target]; ok {
+				x.TargetLevel = l
+			}
+		}
+	}
+
+	if target != "" {
+		if e, err := c.RoomState(roomID, event.TypeRoomMember, string(target)); err == nil {
+			x.TargetMembership = e.(*event.RoomMemberEvent).NewState
+		}
+	}
+
+	x.Allowed = x.Membership == event.MemberJoined && x.hasLevel()
+
+	switch action {
+	case KickAction, BanAction:
+		// Users can only kick and ban users below them, and they can leave
+		// on their own instead of kicking themselves.
+		if target != "" && (target == c.UserID || x.TargetLevel >= x.UserLevel) {
+			x.Allowed = false
+		}
+	case InviteAction:
+		if x.TargetMembership == event.MemberJoined || x.TargetMembership == event.MemberBanned {
+			x.Allowed = false
+		}
+	}
+
+	return x
+}
+
+// TargetOutranks returns true if the target's power level is too high for the
+// user to kick or ban them.
+func (x PermissionExplanation) TargetOutranks() bool {
+	return x.Target != "" && x.TargetLevel >= x.UserLevel
+}
+
+func (x PermissionExplanation) hasLevel() bool {
+	return x.UserLevel >= x.Required
+}
+
+func (c *Client) explainMember(roomID matrix.RoomID) PermissionExplanation {
+	var x PermissionExplanation
+
+	x.Membership = event.MemberLeft
+	if e, err := c.RoomState(roomID, event.TypeRoomMember, string(c.UserID)); err == nil {
+		x.Membership = e.(*event.RoomMemberEvent).NewState
+	}
+
+	x.JoinRule = event.JoinInvite
+	if e, err := c.RoomState(roomID, event.TypeRoomJoinRules, ""); err == nil {
+		x.JoinRule = e.(*event.RoomJoinRulesEvent).JoinRule
+	}
+
+	x.IsCreator = c.IsRoomCreator(roomID)
+	return x
+}
+
+// explainLevels fills in the user's power level. The power levels event and
+// its raw content are returned, or nil if the room has none.
+func (c *Client) explainLevels(
+	roomID matrix.RoomID, x *PermissionExplanation) (*event.RoomPowerLevelsEvent, map[string]json.RawMessage) {
+
+	e, err := c.RoomState(roomID, event.TypeRoomPowerLevels, "")
+	if err != nil {
+		if x.IsCreator {
+			x.UserLevel = 100
+		}
+		return nil, nil
+	}
+
+	levels := e.(*event.RoomPowerLevelsEvent)
+
+	x.UserLevel = levels.UserDefault
+	if level, ok := levels.UserLevel[c.UserID]; ok {
+		x.UserLevel = level
+		x.UserLevelExplicit = true
+	}
+
+	// gotrix can't tell missing fields from zeroes, so look at the raw
+	// content for fields whose defaults aren't zero.
+	return levels, powerLevelsContent(levels)
+}
@@ -0,0 +1,120 @@
+package gotktrix
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/e2ee"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// SessionExportVersion is the version of the SessionExport format.
+const SessionExportVersion = 1
+
+// SessionExport is a portable bundle of the current session that can be used
+// to move to another machine or client. Server-side key backups aren't
+// supported, so only the room keys known to this device can be included.
+type SessionExport struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+
+	Homeserver     string          `json:"homeserver"`
+	IdentityServer string          `json:"identity_server,omitempty"`
+	UserID         matrix.UserID   `json:"user_id"`
+	DeviceID       matrix.DeviceID `json:"device_id,omitempty"`
+
+	// AccessToken and OAuth are only included if asked for. Anyone with the
+	// access token has full access to the account.
+	AccessToken string        `json:"access_token,omitempty"`
+	OAuth       *OAuthSession `json:"oauth,omitempty"`
+
+	// RoomKeys is the armored key export of the room keys, encrypted with a
+	// passphrase. It's only included if asked for. Other clients can import
+	// it once it's saved into its own file.
+	RoomKeys string `json:"room_keys,omitempty"`
+
+	AccountData     []event.RawEvent                   `json:"account_data"`
+	RoomAccountData map[matrix.RoomID][]event.RawEvent `json:"room_account_data,omitempty"`
+}
+
+// exportSyncFilter is the sync filter used to fetch only the account data.
+var exportSyncFilter = mustMarshalJSON(map[string]interface{}{
+	"presence": map[string]interface{}{"types": []string{}},
+	"room": map[string]interface{}{
+		"state":     map[string]interface{}{"types": []string{}},
+		"timeline":  map[string]interface{}{"limit": 0, "types": []string{}},
+		"ephemeral": map[string]interface{}{"types": []string{}},
+	},
+})
+
+func mustMarshalJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return string(b)
+}
+
+// ExportSession exports the current session. The account data is fetched from
+// the homeserver, so that the export is complete even if the local state isn't.
+// The access token is only included if includeToken is true, and the room keys
+// are only included if keysPassphrase isn't empty.
+func (c *Client) ExportSession(includeToken bool, keysPassphrase string) (*SessionExport, error) {
+	_, deviceID, err := c.Client.Whoami()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot get device ID")
+	}
+
+	sync, err := c.Client.Sync(api.SyncArg{Filter: exportSyncFilter})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot fetch account data")
+	}
+
+	export := SessionExport{
+		Version:         SessionExportVersion,
+		ExportedAt:      time.Now().UTC(),
+		Homeserver:      c.HomeServerScheme + "://" + c.HomeServer,
+		IdentityServer:  c.IdentityServer,
+		UserID:          c.UserID,
+		DeviceID:        deviceID,
+		AccountData:     sync.AccountData.Events,
+		RoomAccountData: make(map[matrix.RoomID][]event.RawEvent),
+	}
+
+	if export.AccountData == nil {
+		export.AccountData = []event.RawEvent{}
+	}
+
+	for roomID, room := range sync.Rooms.Joined {
+		if len(room.AccountData.Events) > 0 {
+			export.RoomAccountData[roomID] = room.AccountData.Events
+		}
+	}
+
+	if keysPassphrase != "" {
+		keys, err := c.crypto.ExportRoomKeys()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot export room keys")
+		}
+
+		armored, err := e2ee.EncryptKeyExport(keys, keysPassphrase)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot encrypt room keys")
+		}
+
+		export.RoomKeys = string(armored)
+	}
+
+	if includeToken {
+		export.AccessToken = c.AccessToken
+		if token, session, ok := c.OAuthSession(); ok {
+			export.AccessToken = token
+			export.OAuth = &session
+		}
+	}
+
+	return &export, nil
+}
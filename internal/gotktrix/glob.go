@@ -0,0 +1,52 @@
+package gotktrix
+
+import "unicode/utf8"
+
+// globMatch returns true if str matches the glob pattern the way Matrix uses
+// globs in policy rules and server ACLs: "*" matches any number of characters,
+// "?" matches exactly one character, and everything else, including "[" and
+// "\", matches itself.
+func globMatch(pattern, str string) bool {
+	// backtrack is where to resume after the last "*" if the rest of the
+	// pattern doesn't match: the pattern right after the "*" and the string
+	// with one more character eaten by it.
+	backtrackPattern, backtrackStr := -1, -1
+
+	p, s := 0, 0
+	for s < len(str) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				p++
+				backtrackPattern, backtrackStr = p, s
+				continue
+			case '?':
+				_, sz := utf8.DecodeRuneInString(str[s:])
+				p++
+				s += sz
+				continue
+			default:
+				if pattern[p] == str[s] {
+					p++
+					s++
+					continue
+				}
+			}
+		}
+
+		if backtrackPattern == -1 {
+			return false
+		}
+
+		_, sz := utf8.DecodeRuneInString(str[backtrackStr:])
+		backtrackStr += sz
+		p, s = backtrackPattern, backtrackStr
+	}
+
+	// Only trailing "*" may be left.
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
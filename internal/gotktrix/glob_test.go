@@ -0,0 +1,53 @@
+package gotktrix
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "example.com", true},
+		{"example.com", "example.com", true},
+		{"example.com", "example.org", false},
+		{"example.com", "sub.example.com", false},
+		{"*.example.com", "sub.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*example.com", "example.com", true},
+		{"*.example.*", "sub.example.org", true},
+		{"@*:example.com", "@spam:example.com", true},
+		{"@*:example.com", "@spam:example.com.evil", false},
+		{"@spam*:*", "@spammer:matrix.org", true},
+		{"@?:example.com", "@a:example.com", true},
+		{"@?:example.com", "@ab:example.com", false},
+		{"@?:example.com", "@:example.com", false},
+		{"@??:example.com", "@ab:example.com", true},
+		{"?", "é", true},
+		{"??", "é", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "aXbYbZc", true},
+		{"a*b*c", "aXbYbZ", false},
+		{"**", "anything", true},
+		{"a**", "a", true},
+		{"*a", "aaa", true},
+		{"*ab", "aab", true},
+		// Only "*" and "?" are special; everything else is literal.
+		{"[a-z].com", "a.com", false},
+		{"[a-z].com", "[a-z].com", true},
+		{"\\*.com", "\\x.com", true},
+		{"\\*.com", "*.com", false},
+		{"a/b", "a/b", true},
+		{"*", "a/b", true},
+	}
+
+	for _, test := range tests {
+		if got := globMatch(test.pattern, test.str); got != test.match {
+			t.Errorf("globMatch(%q, %q):\n-> %v\n<- %v", test.pattern, test.str, test.match, got)
+		}
+	}
+}
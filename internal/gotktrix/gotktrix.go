@@ -15,6 +15,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/diamondburned/gotktrix/internal/gotktrix/e2ee"
 	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
 	"github.com/diamondburned/gotktrix/internal/gotktrix/events/sys"
 	"github.com/diamondburned/gotktrix/internal/gotktrix/indexer"
@@ -81,6 +82,45 @@ var defaultClient = httputil.NewCustomClient(&http.Client{
 	Transport: DefaultTransport,
 })
 
+// ParseProxy parses the given proxy URL. Only HTTP, HTTPS and SOCKS5 proxies
+// are supported.
+func ParseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid proxy URL")
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		// ok
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, errors.New("proxy URL is missing a host")
+	}
+
+	return u, nil
+}
+
+// NewHTTPClient creates a new HTTP client that connects through the given
+// proxy. If proxy is empty, then the proxy is taken from the environment, like
+// DefaultTransport.
+func NewHTTPClient(proxy string) (*http.Client, error) {
+	transport := DefaultTransport.Clone()
+
+	if proxy != "" {
+		u, err := ParseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
 var deviceName = "gotktrix"
 
 func init() {
@@ -160,7 +200,29 @@ type Client struct {
 	Index       *indexer.Indexer
 	Interceptor *httptrick.Interceptor
 
-	ctx context.Context
+	ctx      context.Context
+	mentions *mentionNames
+	spam     *spamRules
+	policy   *policyLists
+	members  *memberFetches
+	scanner  *contentScanner
+	privacy  *privacyMode
+	lowData  *lowDataMode
+	textOnly *textOnlyMode
+	prefetch *prefetchedPagers
+	oauth    *oauthTransport
+	skew     *clockSkew
+	crypto   *e2ee.Machine
+	outbox   *outbox
+	presence *presences
+	// background tracks the goroutines started by Background.
+	background *sync.WaitGroup
+}
+
+// memberFetches keeps track of rooms whose members are being fetched.
+type memberFetches struct {
+	mu      sync.Mutex
+	loading map[matrix.RoomID]struct{}
 }
 
 // New wraps around gotrix.NewWithClient.
@@ -220,6 +282,11 @@ func wrapClient(c *gotrix.Client, opts Opts) (*Client, error) {
 		return nil, errors.Wrap(err, "failed to make indexer")
 	}
 
+	crypto, err := e2ee.Open(opts.ConfigPath.ConfigPath("matrix-crypto", b64Username), c.Client)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to make crypto db")
+	}
+
 	registry := handler.New()
 	registry.OnSync(func(s *api.SyncResponse) {
 		for _, room := range s.Rooms.Joined {
@@ -238,16 +305,44 @@ func wrapClient(c *gotrix.Client, opts Opts) (*Client, error) {
 		}
 	})
 
-	c.State = registry.Wrap(s)
+	prefetch := &prefetchedPagers{pagers: make(map[matrix.RoomID]*RoomPaginator)}
+	registry.OnSync(prefetch.invalidate)
+
+	c.State = cryptoState{registry.Wrap(s), crypto}
 	c.SyncOpts = SyncOptions
 
-	return &Client{
+	skew := &clockSkew{}
+	interceptor.AddInterceptFull(skew.intercept)
+
+	client := &Client{
 		Client:      c,
 		Registry:    registry,
 		State:       s,
 		Index:       idx,
 		Interceptor: interceptor,
-	}, nil
+		mentions:    &mentionNames{},
+		spam:        &spamRules{},
+		policy:      &policyLists{},
+		members:     &memberFetches{loading: make(map[matrix.RoomID]struct{})},
+		scanner:     &contentScanner{},
+		privacy:     &privacyMode{},
+		lowData:     &lowDataMode{},
+		textOnly:    &textOnlyMode{},
+		prefetch:    prefetch,
+		skew:        skew,
+		crypto:      crypto,
+		outbox:      newOutbox(),
+		presence:    &presences{users: make(map[matrix.UserID]matrix.Presence)},
+		background:  &sync.WaitGroup{},
+	}
+
+	registry.OnSync(client.indexSync)
+	registry.OnSync(client.policySync)
+	registry.OnSync(client.presence.sync)
+	// A successful sync means that the connection is back.
+	registry.OnSync(client.flushOutbox)
+
+	return client, nil
 }
 
 // AddHandler will panic.
@@ -259,15 +354,24 @@ func (c *Client) AddHandler(function interface{}) error {
 
 // Open opens the client with the last next batch string.
 func (c *Client) Open() error {
+	c.Client.SyncOpts = c.syncOptions()
+
+	// Encryption is optional; unencrypted rooms still work without it.
+	if err := c.crypto.Start(); err != nil {
+		log.Println("cannot set up encryption:", err)
+	}
+
 	next, _ := c.State.NextBatch()
 	return c.Client.OpenWithNext(next)
 }
 
-// Close closes the event loop and the internal database, as well as halting all
-// ongoing requests.
+// Close closes the event loop and the internal databases, as well as halting
+// all ongoing requests. Use Shutdown to let the background work finish first.
 func (c *Client) Close() error {
+	c.outbox.close()
+
 	err1 := c.Client.Close()
-	err2 := c.State.Close()
+	err2 := c.closeDatabases()
 
 	if err1 != nil {
 		return err1
@@ -402,11 +506,13 @@ func MaxSize(w, h, maxW, maxH int) (int, int) {
 	if h == 0 {
 		h = maxH
 	}
-	if w < maxW && h < maxH {
+	if w <= maxW && h <= maxH {
 		return w, h
 	}
 
-	if w > h {
+	// Scale down along the side that overflows the most, so that both sides
+	// fit.
+	if w*maxH > h*maxW {
 		h = h * maxW / w
 		w = maxW
 	} else {
@@ -414,6 +520,13 @@ func MaxSize(w, h, maxW, maxH int) (int, int) {
 		h = maxH
 	}
 
+	if w == 0 {
+		w = 1
+	}
+	if h == 0 {
+		h = 1
+	}
+
 	return w, h
 }
 
@@ -460,6 +573,7 @@ func (c *Client) RoomTimelineEvent(roomID matrix.RoomID, id matrix.EventID) (eve
 		return nil, errors.Wrap(err, "cannot get event from API")
 	}
 
+	raw = c.crypto.DecryptEvent(roomID, raw)
 	return sys.ParseTimeline(raw, roomID), nil
 }
 
@@ -485,6 +599,14 @@ func (c *Client) RoomState(
 		return s, nil
 	}
 
+	return c.fetchRoomState(roomID, typ, key)
+}
+
+// fetchRoomState queries the homeserver for the given RoomEvent and saves it
+// into the State.
+func (c *Client) fetchRoomState(
+	roomID matrix.RoomID, typ event.Type, key string) (event.StateEvent, error) {
+
 	raw, err := c.Client.Client.RoomState(roomID, typ, key)
 	if err != nil {
 		return nil, err
@@ -669,21 +791,70 @@ func (c *Client) RoomCountUnread(roomID matrix.RoomID) (n int, more bool) {
 	return unread, !found
 }
 
+// RoomCountNotifications counts the messages after the user's read marker that
+// the user's push rules notify or highlight. If the read marker isn't in the
+// stored timeline, then the counts given by the server in the last sync are
+// returned instead.
+func (c *Client) RoomCountNotifications(roomID matrix.RoomID) m.NotificationCount {
+	latestID := c.RoomLatestReadEvent(roomID)
+
+	var count m.NotificationCount
+	var found bool
+
+	c.EachTimelineReverse(roomID, func(ev event.RoomEvent) error {
+		info := ev.RoomInfo()
+		// See RoomCountUnread.
+		if info.ID == latestID || info.Sender == c.UserID {
+			found = true
+			return EachBreak
+		}
+
+		msg, ok := ev.(*event.RoomMessageEvent)
+		if !ok {
+			return nil
+		}
+
+		action := c.NotifyMessage(msg, NotifyMessage|HighlightMessage)
+		if action&NotifyMessage != 0 {
+			count.Notification++
+		}
+		if action&HighlightMessage != 0 {
+			count.Highlight++
+		}
+
+		return nil
+	})
+
+	if !found {
+		return c.State.RoomNotificationCount(roomID)
+	}
+
+	return count
+}
+
 // MarkRoomAsRead sends to the server that the current user has seen up to the
-// given event in the given room.
-func (c *Client) MarkRoomAsRead(roomID matrix.RoomID, eventID matrix.EventID) error {
+// given event in the given room. If private is true, then other users won't be
+// told that the user has read the room.
+func (c *Client) MarkRoomAsRead(roomID matrix.RoomID, eventID matrix.EventID, private bool) error {
 	if seen, ok := c.hasSeenEvent(roomID, eventID); ok && seen {
 		// Room is already seen; don't waste an API call.
 		return nil
 	}
 
 	var request struct {
-		FullyRead matrix.EventID `json:"m.fully_read"`
-		Read      matrix.EventID `json:"m.read,omitempty"`
+		FullyRead   matrix.EventID `json:"m.fully_read"`
+		Read        matrix.EventID `json:"m.read,omitempty"`
+		ReadPrivate matrix.EventID `json:"m.read.private,omitempty"`
 	}
 
 	request.FullyRead = eventID
-	request.Read = eventID
+
+	// Don't let other users know that we've read the room in privacy mode.
+	if private || c.PrivacyMode() {
+		request.ReadPrivate = eventID
+	} else {
+		request.Read = eventID
+	}
 
 	return c.Request(
 		"POST", c.Endpoints.Room(roomID)+"/read_markers",
@@ -691,7 +862,18 @@ func (c *Client) MarkRoomAsRead(roomID matrix.RoomID, eventID matrix.EventID) er
 	)
 }
 
+// RoomMembersLoading returns true if the given room's members are currently
+// being fetched by RoomEnsureMembers.
+func (c *Client) RoomMembersLoading(roomID matrix.RoomID) bool {
+	c.members.mu.Lock()
+	defer c.members.mu.Unlock()
+
+	_, loading := c.members.loading[roomID]
+	return loading
+}
+
 // RoomEnsureMembers ensures that the given room has all its members fetched.
+// The fetched members are persisted, so the fetch is only done once per room.
 func (c *Client) RoomEnsureMembers(roomID matrix.RoomID) error {
 	const key = "ensure-members"
 
@@ -699,6 +881,16 @@ func (c *Client) RoomEnsureMembers(roomID matrix.RoomID) error {
 		return nil
 	}
 
+	c.members.mu.Lock()
+	c.members.loading[roomID] = struct{}{}
+	c.members.mu.Unlock()
+
+	defer func() {
+		c.members.mu.Lock()
+		delete(c.members.loading, roomID)
+		c.members.mu.Unlock()
+	}()
+
 	p, err := c.State.RoomPreviousBatch(roomID)
 	if err != nil {
 		c.State.ResetRoom(roomID, key)
@@ -749,6 +941,8 @@ type RoomPaginator struct {
 	drained bool
 	// onTop is true if we're out of events.
 	onTop bool
+	// created is true if the room's creation event was paginated.
+	created bool
 }
 
 // RoomPaginator returns a new paginator that can fetch messages from the bottom
@@ -881,6 +1075,20 @@ func (p *RoomPaginator) fill(ctx context.Context) error {
 	return nil
 }
 
+// Exhausted returns true if the paginator has returned all the events that it
+// could get.
+func (p *RoomPaginator) Exhausted() bool {
+	return p.onTop && len(p.buffer) == 0
+}
+
+// ReachedCreation returns true if the paginator has reached the room's creation
+// event. If the paginator is exhausted but this returns false, then the earlier
+// events were hidden from the user, likely because of the room's history
+// visibility.
+func (p *RoomPaginator) ReachedCreation() bool {
+	return p.created
+}
+
 // needFill returns true if the paginator's buffer needs filling.
 func (p *RoomPaginator) needFill() bool {
 	return p.limit > len(p.buffer) && !p.onTop
@@ -897,6 +1105,13 @@ func (p *RoomPaginator) prepend(events []event.RoomEvent) {
 		return
 	}
 
+	for _, ev := range events {
+		if _, ok := ev.(*event.RoomCreateEvent); ok {
+			p.created = true
+			break
+		}
+	}
+
 	// log.Println("current buffer state:")
 	// log.Printf("events | %s", events[0].RoomInfo().OriginServerTime.Time())
 	// log.Printf("       | ...")
@@ -972,12 +1187,12 @@ func LatestMessage(events []event.RoomEvent) *event.RoomMessageEvent {
 func (c *Client) AsyncSetConfig(ev event.Event, done func(error)) {
 	c.State.SetUserEvent(ev)
 
-	go func() {
-		err := c.ClientConfigSet(string(ev.Info().Type), ev)
+	c.Background(func(client *Client) {
+		err := client.ClientConfigSet(string(ev.Info().Type), ev)
 		if done != nil {
 			done(err)
 		}
-	}()
+	})
 }
 
 // UserEvent gets the user event from the state or the API.
@@ -1077,7 +1292,7 @@ func (c *Client) SendRoomEvent(roomID matrix.RoomID, ev event.Event) error {
 		panic("SendRoomEvent: missing event type")
 	}
 
-	_, err := c.Client.RoomEventSend(roomID, ev.Info().Type, ev)
+	_, err := c.RoomEventSend(roomID, ev.Info().Type, ev)
 	return err
 }
 
@@ -1087,6 +1302,35 @@ func (c *Client) Redact(roomID matrix.RoomID, ev matrix.EventID, reason string)
 	return err
 }
 
+// EventIsHidden returns true if the user has hidden the given event locally.
+func (c *Client) EventIsHidden(roomID matrix.RoomID, ev matrix.EventID) bool {
+	return c.State.EventIsHidden(roomID, ev)
+}
+
+// SetEventHidden hides or unhides the given event locally. Unlike Redact, the
+// event is untouched on the server, and other users can still see it.
+func (c *Client) SetEventHidden(roomID matrix.RoomID, ev matrix.EventID, hidden bool) {
+	c.State.SetEventHidden(roomID, ev, hidden)
+}
+
+// ReportEvent reports the given event to the homeserver's administrators. The
+// reason is optional.
+func (c *Client) ReportEvent(roomID matrix.RoomID, ev matrix.EventID, reason string) error {
+	request := struct {
+		Reason string `json:"reason,omitempty"`
+		Score  int    `json:"score"`
+	}{
+		Reason: reason,
+		// -100 is the most offensive score. We don't ask the user for this.
+		Score: -100,
+	}
+
+	return c.Request(
+		"POST", c.Endpoints.Room(roomID)+"/report/"+url.PathEscape(string(ev)),
+		nil, httputil.WithToken(), httputil.WithJSONBody(request),
+	)
+}
+
 // PowerAction describes 1 out of the 4 actions in a PowerLevels event.
 type PowerAction uint8
 
@@ -1099,54 +1343,16 @@ const (
 )
 
 // HasPower checks if the current user can perform the given action inside the
-// given room.
+// given room. It agrees with ExplainAction.
 func (c *Client) HasPower(roomID matrix.RoomID, action PowerAction) bool {
-	e, err := c.RoomState(roomID, event.TypeRoomPowerLevels, "")
-	if err != nil {
-		// Theoretically, this means we have the power to override the room's
-		// power levels to be whatever we want, but we'll play nice and pretend
-		// that we don't have the power to do that, because that's just stupid.
-		return false
-	}
-
-	ev := e.(*event.RoomPowerLevelsEvent)
-
-	powerLevel := 50
-
-	switch action {
-	case BanAction:
-		if ev.BanRequirement != nil {
-			powerLevel = *ev.BanRequirement
-		}
-	case InviteAction:
-		if ev.InviteRequirement != nil {
-			powerLevel = *ev.InviteRequirement
-		}
-	case KickAction:
-		if ev.KickRequirement != nil {
-			powerLevel = *ev.KickRequirement
-		}
-	case RedactAction:
-		if ev.RedactRequirement != nil {
-			powerLevel = *ev.RedactRequirement
-		}
-	}
-
-	ourLevel := ev.UserDefault
-	if level, ok := ev.UserLevel[c.UserID]; ok {
-		ourLevel = level
-	}
-
-	if ourLevel >= powerLevel {
-		return true
-	}
-
-	if c.IsRoomCreator(roomID) {
-		// User made this room, so they have full power.
-		return true
-	}
+	return c.ExplainAction(roomID, action, "").Allowed
+}
 
-	return false
+// CanSendEvent checks if the current user can send an event of the given type
+// inside the given room. If state is true, then the event is checked as a state
+// event. It agrees with ExplainSendEvent.
+func (c *Client) CanSendEvent(roomID matrix.RoomID, typ event.Type, state bool) bool {
+	return c.ExplainSendEvent(roomID, typ, state).Allowed
 }
 
 // IsRoomCreator returns true if the current user is the user who made this
@@ -1178,7 +1384,7 @@ type MemberName struct {
 func (c *Client) MemberName(
 	roomID matrix.RoomID, userID matrix.UserID, check bool) (MemberName, error) {
 
-	names, err := c.memberNames(roomID, []matrix.UserID{userID}, check)
+	names, err := c.MemberNames(roomID, []matrix.UserID{userID}, check)
 	if err != nil {
 		return MemberName{}, err
 	}
@@ -1186,14 +1392,26 @@ func (c *Client) MemberName(
 	return names[0], nil
 }
 
-// memberNames calculates the display name of all the users provided.
-func (c *Client) memberNames(
+// MemberNames calculates the display names of all the given users. The member
+// events of the users are read from the state in a single transaction, so this
+// is much cheaper than calling MemberName for each user.
+func (c *Client) MemberNames(
 	roomID matrix.RoomID, userIDs []matrix.UserID, check bool) ([]MemberName, error) {
 
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = string(userID)
+	}
+
+	states := c.State.RoomStates(roomID, event.TypeRoomMember, keys)
 	results := make([]MemberName, len(userIDs))
 
 	for i, userID := range userIDs {
-		e, _ := c.RoomState(roomID, event.TypeRoomMember, string(userID))
+		e := states[i]
+		if e == nil {
+			// Not in the state, so try the homeserver if we're online.
+			e, _ = c.fetchRoomState(roomID, event.TypeRoomMember, string(userID))
+		}
 		if e == nil {
 			results[i].Name = string(userID)
 			continue
@@ -1278,6 +1496,70 @@ func (c *Client) IsDirect(roomID matrix.RoomID) bool {
 	return ev.IsDirect
 }
 
+// DirectRoom returns a direct chat with the given user that the current user
+// is still joined to, according to the stored m.direct account data.
+func (c *Client) DirectRoom(userID matrix.UserID) (matrix.RoomID, bool) {
+	e, err := c.State.UserEvent(event.TypeDirect)
+	if err != nil {
+		return "", false
+	}
+
+	direct, ok := e.(*event.DirectEvent)
+	if !ok {
+		return "", false
+	}
+
+	for _, roomID := range direct.Rooms[userID] {
+		e, err := c.State.RoomState(roomID, event.TypeRoomMember, string(c.UserID))
+		if err == nil && e.(*event.RoomMemberEvent).NewState == event.MemberJoined {
+			return roomID, true
+		}
+	}
+
+	return "", false
+}
+
+// CreateDirectRoom creates a private room with the given user invited and marks
+// it as a direct chat.
+func (c *Client) CreateDirectRoom(userID matrix.UserID) (matrix.RoomID, error) {
+	roomID, err := c.RoomCreate(api.RoomCreateArg{
+		Visibility:      api.RoomPrivate,
+		Invite:          []matrix.UserID{userID},
+		Preset:          api.PresetTrustedPrivateChat,
+		IsDirectMessage: true,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create chat")
+	}
+
+	if err := c.MarkRoomAsDM(userID, roomID); err != nil {
+		return "", errors.Wrap(err, "failed to mark room as direct chat")
+	}
+
+	return roomID, nil
+}
+
+// SharedRooms returns the rooms that both the current user and the given user
+// are joined to. Only the state is used, so rooms whose members haven't been
+// fetched yet may be missing.
+func (c *Client) SharedRooms(userID matrix.UserID) []matrix.RoomID {
+	roomIDs, err := c.State.Rooms()
+	if err != nil {
+		return nil
+	}
+
+	var shared []matrix.RoomID
+
+	for _, roomID := range roomIDs {
+		e, err := c.State.RoomState(roomID, event.TypeRoomMember, string(userID))
+		if err == nil && e.(*event.RoomMemberEvent).NewState == event.MemberJoined {
+			shared = append(shared, roomID)
+		}
+	}
+
+	return shared
+}
+
 func roomIsDM(dir *event.DirectEvent, roomID matrix.RoomID) bool {
 	for _, ids := range dir.Rooms {
 		for _, id := range ids {
@@ -1311,15 +1593,25 @@ func (c *Client) NotifyMessage(msg *event.RoomMessageEvent, action NotifyMessage
 		return 0
 	}
 
+	var rule *matrix.PushRule
+
 	e, err := c.State.UserEvent(event.TypePushRules)
-	if err != nil {
-		return 0
+	if err == nil {
+		if r, ok := event.PushNotifyMessage(e.(*event.PushRulesEvent).Global, msg); ok {
+			rule = &r
+		}
 	}
 
-	rules := e.(*event.PushRulesEvent)
+	// Push rules don't know about the alternative names that the user has
+	// configured, so those upgrade the result, unless a rule such as a muted
+	// room says not to notify.
+	if rule == nil || rule.Actions.Action != matrix.DontNotifyAction {
+		if c.mentionsName(msg) {
+			return action & (NotifyMessage | NotifySoundMessage | HighlightMessage)
+		}
+	}
 
-	rule, ok := event.PushNotifyMessage(rules.Global, msg)
-	if !ok {
+	if rule == nil {
 		return 0
 	}
 
@@ -0,0 +1,321 @@
+package gotktrix
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/internal/state"
+	"github.com/diamondburned/gotrix"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+func TestParseProxy(t *testing.T) {
+	tests := []struct {
+		proxy string
+		host  string // empty if invalid
+	}{
+		{"http://proxy.example.com:8080", "proxy.example.com:8080"},
+		{"https://proxy.example.com", "proxy.example.com"},
+		{"socks5://127.0.0.1:1080", "127.0.0.1:1080"},
+		{"socks5h://user:pass@[::1]:9050", "[::1]:9050"},
+		{"ftp://proxy.example.com", ""},
+		{"socks4://127.0.0.1:1080", ""},
+		{"proxy.example.com:8080", ""},
+		{"http://", ""},
+		{"http:///path", ""},
+		{"", ""},
+		{"http://proxy.example.com:bad port", ""},
+	}
+
+	for _, test := range tests {
+		u, err := ParseProxy(test.proxy)
+		if test.host == "" {
+			if err == nil {
+				t.Errorf("proxy %q was accepted as %v", test.proxy, u)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("cannot parse proxy %q: %v", test.proxy, err)
+			continue
+		}
+		if u.Host != test.host {
+			t.Errorf("proxy %q host mismatch:\n-> %s\n<- %s", test.proxy, test.host, u.Host)
+		}
+	}
+}
+
+const (
+	testUserID    matrix.UserID = "@alice:example.com"
+	testCreatorID matrix.UserID = "@bob:example.com"
+	testRoom      matrix.RoomID = "!room:example.com"
+)
+
+// offlineDriver fails every request, so that only the state given to
+// newTestClient is ever seen.
+type offlineDriver struct{}
+
+func (offlineDriver) Do(*http.Request) (*http.Response, error) {
+	return nil, errors.New("offline")
+}
+
+// newTestClient creates a client for testUserID whose state has testRoom with
+// the given state events in it.
+func newTestClient(t *testing.T, events ...event.RawEvent) *Client {
+	t.Helper()
+
+	s, err := state.New(filepath.Join(t.TempDir(), "state"), testUserID)
+	if err != nil {
+		t.Fatal("cannot create state:", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	var sync api.SyncResponse
+	sync.Rooms.Joined = map[matrix.RoomID]api.SyncJoinedRoomEvents{}
+
+	room := sync.Rooms.Joined[testRoom]
+	room.State.Events = events
+	sync.Rooms.Joined[testRoom] = room
+
+	if err := s.AddEvents(&sync); err != nil {
+		t.Fatal("cannot add events:", err)
+	}
+
+	client := httputil.NewCustomClient(offlineDriver{})
+	client.HomeServer = "example.com"
+	client.HomeServerScheme = "https"
+
+	return &Client{
+		Client: &gotrix.Client{
+			Client: &api.Client{
+				Client: client,
+				UserID: testUserID,
+			},
+		},
+		State: s,
+	}
+}
+
+func stateEvent(t *testing.T, typ event.Type, key string, content interface{}) event.RawEvent {
+	t.Helper()
+
+	b, err := json.Marshal(map[string]interface{}{
+		"type":             typ,
+		"state_key":        key,
+		"content":          content,
+		"event_id":         "$" + string(typ) + key,
+		"sender":           testCreatorID,
+		"origin_server_ts": 1,
+	})
+	if err != nil {
+		t.Fatal("cannot marshal event:", err)
+	}
+
+	return b
+}
+
+// testRoomState returns the create event, our membership and the join rules,
+// which every explanation looks at.
+func testRoomState(t *testing.T, membership event.MemberType) []event.RawEvent {
+	return []event.RawEvent{
+		stateEvent(t, event.TypeRoomCreate, "", map[string]interface{}{
+			"creator": testCreatorID,
+		}),
+		stateEvent(t, event.TypeRoomMember, string(testUserID), map[string]interface{}{
+			"membership": membership,
+		}),
+		stateEvent(t, event.TypeRoomJoinRules, "", map[string]interface{}{
+			"join_rule": "public",
+		}),
+	}
+}
+
+func TestCanSendEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		membership event.MemberType
+		levels     map[string]interface{} // nil for no power levels event
+		typ        event.Type
+		state      bool
+		expect     bool
+	}{
+		{
+			name:   "message at events_default",
+			levels: map[string]interface{}{"events_default": 0},
+			typ:    event.TypeRoomMessage,
+			expect: true,
+		},
+		{
+			name:   "message below events_default",
+			levels: map[string]interface{}{"events_default": 10},
+			typ:    event.TypeRoomMessage,
+			expect: false,
+		},
+		{
+			name:   "message with users_default",
+			levels: map[string]interface{}{"events_default": 10, "users_default": 10},
+			typ:    event.TypeRoomMessage,
+			expect: true,
+		},
+		{
+			name:   "state with explicit zero state_default",
+			levels: map[string]interface{}{"state_default": 0},
+			typ:    event.TypeRoomTopic,
+			state:  true,
+			expect: true,
+		},
+		{
+			name:   "state with missing state_default",
+			levels: map[string]interface{}{},
+			typ:    event.TypeRoomTopic,
+			state:  true,
+			expect: false,
+		},
+		{
+			name: "state with missing state_default at 50",
+			levels: map[string]interface{}{
+				"users": map[matrix.UserID]int{testUserID: 50},
+			},
+			typ:    event.TypeRoomTopic,
+			state:  true,
+			expect: true,
+		},
+		{
+			name: "events override",
+			levels: map[string]interface{}{
+				"users":         map[matrix.UserID]int{testUserID: 50},
+				"state_default": 0,
+				"events":        map[event.Type]int{event.TypeRoomName: 100},
+			},
+			typ:    event.TypeRoomName,
+			state:  true,
+			expect: false,
+		},
+		{
+			name: "events override below default",
+			levels: map[string]interface{}{
+				"events_default": 50,
+				"events":         map[event.Type]int{event.TypeRoomMessage: 0},
+			},
+			typ:    event.TypeRoomMessage,
+			expect: true,
+		},
+		{
+			name:       "not joined",
+			membership: event.MemberLeft,
+			levels:     map[string]interface{}{"state_default": 0},
+			typ:        event.TypeRoomMessage,
+			expect:     false,
+		},
+		{
+			name:   "message without power levels",
+			typ:    event.TypeRoomMessage,
+			expect: true,
+		},
+		{
+			name:   "state without power levels",
+			typ:    event.TypeRoomTopic,
+			state:  true,
+			expect: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			membership := test.membership
+			if membership == "" {
+				membership = event.MemberJoined
+			}
+
+			events := testRoomState(t, membership)
+			if test.levels != nil {
+				events = append(events, stateEvent(t, event.TypeRoomPowerLevels, "", test.levels))
+			}
+
+			c := newTestClient(t, events...)
+
+			got := c.CanSendEvent(testRoom, test.typ, test.state)
+			if got != test.expect {
+				t.Fatalf("CanSendEvent mismatch:\n-> %v\n<- %v", test.expect, got)
+			}
+
+			// The power levels shown to the user must agree.
+			if test.state {
+				x := c.ExplainSendEvent(testRoom, test.typ, test.state)
+				if x.RequiredSource == PowerStateDefault || x.RequiredSource == PowerNoLevels {
+					if levels := c.RoomPowerLevels(testRoom); levels.StateDefault != x.Required {
+						t.Fatalf("state_default mismatch:\n-> %d\n<- %d", x.Required, levels.StateDefault)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHasPower(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels map[string]interface{} // nil for no power levels event
+		action PowerAction
+		expect bool
+	}{
+		{
+			name:   "ban at default",
+			levels: map[string]interface{}{},
+			action: BanAction,
+			expect: false,
+		},
+		{
+			name: "ban at 50",
+			levels: map[string]interface{}{
+				"users": map[matrix.UserID]int{testUserID: 50},
+			},
+			action: BanAction,
+			expect: true,
+		},
+		{
+			name:   "explicit zero kick",
+			levels: map[string]interface{}{"kick": 0},
+			action: KickAction,
+			expect: true,
+		},
+		{
+			name:   "invite at default",
+			levels: map[string]interface{}{},
+			action: InviteAction,
+			expect: true,
+		},
+		{
+			name:   "ban without power levels",
+			action: BanAction,
+			expect: false,
+		},
+		{
+			name:   "invite without power levels",
+			action: InviteAction,
+			expect: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events := testRoomState(t, event.MemberJoined)
+			if test.levels != nil {
+				events = append(events, stateEvent(t, event.TypeRoomPowerLevels, "", test.levels))
+			}
+
+			c := newTestClient(t, events...)
+
+			if got := c.HasPower(testRoom, test.action); got != test.expect {
+				t.Fatalf("HasPower mismatch:\n-> %v\n<- %v", test.expect, got)
+			}
+		})
+	}
+}
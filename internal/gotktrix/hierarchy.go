@@ -0,0 +1,231 @@
+package gotktrix
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// JoinRestricted is the join rule of rooms that the members of some other
+// rooms, usually spaces, can join without being invited.
+const JoinRestricted event.JoinRule = "restricted"
+
+// maxHierarchyRooms is the maximum number of rooms fetched from the hierarchy
+// of a space.
+const maxHierarchyRooms = 200
+
+// HierarchyRoom is a room in the hierarchy of a space, which the user might not
+// have joined.
+type HierarchyRoom struct {
+	RoomID         matrix.RoomID
+	Type           string
+	Name           string
+	Topic          string
+	CanonicalAlias string
+	AvatarURL      matrix.URL
+	Members        int
+	JoinRule       event.JoinRule
+	// Allowed is the rooms whose members can join this room if its join rule
+	// is restricted.
+	Allowed []matrix.RoomID
+	// Parent is the space that lists this room.
+	Parent matrix.RoomID
+	// Via is the servers that the parent space says the room can be joined
+	// through.
+	Via []string
+}
+
+// IsSpace returns true if the room is a space.
+func (r HierarchyRoom) IsSpace() bool {
+	return r.Type == "m.space"
+}
+
+// SpaceHierarchy fetches the rooms in the space and its subspaces from the
+// homeserver, including the ones that the user hasn't joined. The space itself
+// isn't included.
+func (c *Client) SpaceHierarchy(spaceID matrix.RoomID) ([]HierarchyRoom, error) {
+	route := "_matrix/client/v1/rooms/" + url.PathEscape(string(spaceID)) + "/hierarchy"
+
+	type childState struct {
+		Type     string          `json:"type"`
+		StateKey matrix.RoomID   `json:"state_key"`
+		Content  json.RawMessage `json:"content"`
+	}
+
+	type hierarchyRoom struct {
+		RoomID         matrix.RoomID   `json:"room_id"`
+		RoomType       string          `json:"room_type"`
+		Name           string          `json:"name"`
+		Topic          string          `json:"topic"`
+		CanonicalAlias string          `json:"canonical_alias"`
+		AvatarURL      matrix.URL      `json:"avatar_url"`
+		JoinedMembers  int             `json:"num_joined_members"`
+		JoinRule       event.JoinRule  `json:"join_rule"`
+		AllowedRoomIDs []matrix.RoomID `json:"allowed_room_ids"`
+		ChildrenState  []childState    `json:"children_state"`
+	}
+
+	var rooms []hierarchyRoom
+	var from string
+
+	for len(rooms) < maxHierarchyRooms {
+		query := map[string]string{"limit": "50"}
+		if from != "" {
+			query["from"] = from
+		}
+
+		var resp struct {
+			Rooms     []hierarchyRoom `json:"rooms"`
+			NextBatch string          `json:"next_batch"`
+		}
+
+		err := c.Request(
+			"GET", route, &resp,
+			httputil.WithToken(), httputil.WithQuery(query),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get space hierarchy")
+		}
+
+		rooms = append(rooms, resp.Rooms...)
+
+		if resp.NextBatch == "" {
+			break
+		}
+		from = resp.NextBatch
+	}
+
+	type parent struct {
+		id  matrix.RoomID
+		via []string
+	}
+
+	parents := make(map[matrix.RoomID]parent, len(rooms))
+	for _, room := range rooms {
+		for _, child := range room.ChildrenState {
+			if child.Type != m.SpaceChildEventType {
+				continue
+			}
+
+			var content m.SpaceChildEvent
+			if err := json.Unmarshal(child.Content, &content); err != nil {
+				continue
+			}
+
+			if _, ok := parents[child.StateKey]; !ok && len(content.Via) > 0 {
+				parents[child.StateKey] = parent{room.RoomID, content.Via}
+			}
+		}
+	}
+
+	hierarchy := make([]HierarchyRoom, 0, len(rooms))
+	for _, room := range rooms {
+		if room.RoomID == spaceID {
+			continue
+		}
+
+		hierarchy = append(hierarchy, HierarchyRoom{
+			RoomID:         room.RoomID,
+			Type:           room.RoomType,
+			Name:           room.Name,
+			Topic:          room.Topic,
+			CanonicalAlias: room.CanonicalAlias,
+			AvatarURL:      room.AvatarURL,
+			Members:        room.JoinedMembers,
+			JoinRule:       room.JoinRule,
+			Allowed:        room.AllowedRoomIDs,
+			Parent:         parents[room.RoomID].id,
+			Via:            parents[room.RoomID].via,
+		})
+	}
+
+	return hierarchy, nil
+}
+
+// CanJoinRestricted returns true if the user is in one of the rooms that allow
+// their members to join the given restricted room.
+func (c *Client) CanJoinRestricted(room HierarchyRoom) bool {
+	for _, allowed := range room.Allowed {
+		if c.IsJoined(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsJoined returns true if the user has joined the room.
+func (c *Client) IsJoined(roomID matrix.RoomID) bool {
+	rooms, err := c.State.Rooms()
+	if err != nil {
+		return false
+	}
+
+	for _, id := range rooms {
+		if id == roomID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// JoinHierarchyRoom joins the room from the hierarchy of a space. For
+// restricted rooms, the servers of the joined rooms that grant access are also
+// tried, since only a server that is in one of those rooms can authorise the
+// join.
+func (c *Client) JoinHierarchyRoom(room HierarchyRoom) error {
+	vias := append([]string(nil), room.Via...)
+
+	if room.JoinRule == JoinRestricted {
+		for _, allowed := range room.Allowed {
+			if c.IsJoined(allowed) {
+				vias = append(vias, c.RoomVias(allowed)...)
+			}
+		}
+	}
+
+	if _, server, err := room.RoomID.Parse(); err == nil {
+		vias = append(vias, server)
+	}
+
+	return c.RoomJoinVia(room.RoomID, dedupeStrings(vias))
+}
+
+// RoomJoinVia joins the room through the given servers, which is needed if the
+// user's homeserver isn't in the room yet.
+func (c *Client) RoomJoinVia(roomID matrix.RoomID, vias []string) error {
+	var query map[string][]string
+	if len(vias) > 0 {
+		query = map[string][]string{"server_name": vias}
+	}
+
+	err := c.Request(
+		"POST", c.Endpoints.Base()+"/join/"+url.PathEscape(string(roomID)), nil,
+		httputil.WithToken(), httputil.WithFullQuery(query),
+		httputil.WithJSONBody(struct{}{}),
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to join room")
+	}
+
+	return nil
+}
+
+func dedupeStrings(strs []string) []string {
+	seen := make(map[string]bool, len(strs))
+	deduped := strs[:0]
+
+	for _, str := range strs {
+		if !seen[str] {
+			seen[str] = true
+			deduped = append(deduped, str)
+		}
+	}
+
+	return deduped
+}
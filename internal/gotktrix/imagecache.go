@@ -0,0 +1,171 @@
+package gotktrix
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/diamondburned/gotk4/pkg/core/glib"
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
+	"github.com/diamondburned/gotk4/pkg/gdkpixbuf/v2"
+	"github.com/diamondburned/gotkit/app"
+	"github.com/diamondburned/gotkit/gtkutil/httputil"
+	"github.com/diamondburned/gotkit/gtkutil/imgutil"
+	"github.com/diamondburned/gotktrix/internal/gtkutil/a11y"
+)
+
+// sharedImageCacheSize is the maximum number of decoded images to keep around
+// after all widgets showing them are gone.
+const sharedImageCacheSize = 128
+
+// sharedImages deduplicates fetches of the same image URL and shares the
+// decoded images between all widgets that show them, such as the avatar of a
+// user that appears in many rooms and messages.
+var sharedImages = sharedImageCache{
+	images:   make(map[sharedImageKey]*list.Element, sharedImageCacheSize),
+	order:    list.New(),
+	fetching: make(map[sharedImageKey][]imageWaiter),
+}
+
+type sharedImageKey struct {
+	url  string
+	w, h int
+	// client is the HTTP client of the account that fetches the image. Accounts
+	// behind different proxies must not share fetches.
+	client *http.Client
+}
+
+type sharedImage struct {
+	key     sharedImageKey
+	pixbuf  *gdkpixbuf.Pixbuf
+	anim    *gdkpixbuf.PixbufAnimation
+	texture *gdk.Texture
+}
+
+// set sets the image into the given setter. Animations are only played if the
+// user didn't ask for less motion. It must be called in the main thread.
+func (i *sharedImage) set(img imgutil.ImageSetter) {
+	switch {
+	case i.anim != nil && img.SetFromAnimation != nil && !a11y.ReduceMotion():
+		img.SetFromAnimation(i.anim)
+	case img.SetFromPixbuf != nil:
+		img.SetFromPixbuf(i.pixbuf)
+	case img.SetFromPaintable != nil:
+		if i.texture == nil {
+			i.texture = gdk.NewTextureForPixbuf(i.pixbuf)
+		}
+		img.SetFromPaintable(i.texture)
+	}
+}
+
+type imageWaiter struct {
+	ctx context.Context
+	img imgutil.ImageSetter
+}
+
+type sharedImageCache struct {
+	mu       sync.Mutex
+	images   map[sharedImageKey]*list.Element
+	order    *list.List // front is most recently used
+	fetching map[sharedImageKey][]imageWaiter
+}
+
+// get gets the image at the given URL into img. If the image is already being
+// fetched for another widget, then it waits for that fetch instead of starting
+// another one.
+func (c *sharedImageCache) get(ctx context.Context, url string, img imgutil.ImageSetter) {
+	opts := imgutil.OptsFromContext(ctx)
+
+	key := sharedImageKey{
+		url:    url,
+		client: httputil.FromContext(ctx, nil),
+	}
+	key.w, key.h = opts.Size()
+
+	c.mu.Lock()
+
+	if elem, ok := c.images[key]; ok {
+		c.order.MoveToFront(elem)
+		c.mu.Unlock()
+
+		image := elem.Value.(*sharedImage)
+		glib.IdleAdd(func() {
+			if ctx.Err() == nil {
+				image.set(img)
+			}
+		})
+		return
+	}
+
+	waiters, fetching := c.fetching[key]
+	c.fetching[key] = append(waiters, imageWaiter{ctx, img})
+
+	c.mu.Unlock()
+
+	if fetching {
+		return
+	}
+
+	// The fetch is shared, so it must not be cancelled when the widget that
+	// started it goes away. It must still go through the account's HTTP client,
+	// which may be behind a proxy.
+	fetchCtx := app.WithApplication(context.Background(), app.FromContext(ctx))
+	if key.client != nil {
+		fetchCtx = httputil.WithClient(fetchCtx, key.client)
+	}
+	fetchCtx = imgutil.WithOpts(fetchCtx,
+		imgutil.WithRescale(key.w, key.h),
+		imgutil.WithErrorFn(func(err error) { c.fail(key, err) }),
+	)
+
+	imgutil.AsyncGET(fetchCtx, url, imgutil.ImageSetter{
+		SetFromPixbuf: func(p *gdkpixbuf.Pixbuf) {
+			c.done(&sharedImage{key: key, pixbuf: p})
+		},
+		SetFromAnimation: func(anim *gdkpixbuf.PixbufAnimation) {
+			c.done(&sharedImage{key: key, pixbuf: anim.StaticImage(), anim: anim})
+		},
+	})
+}
+
+// done caches the fetched image and gives it to everyone waiting for it. It is
+// called in the main thread.
+func (c *sharedImageCache) done(image *sharedImage) {
+	c.mu.Lock()
+
+	waiters := c.fetching[image.key]
+	delete(c.fetching, image.key)
+
+	c.images[image.key] = c.order.PushFront(image)
+	for c.order.Len() > sharedImageCacheSize {
+		back := c.order.Back()
+		c.order.Remove(back)
+		delete(c.images, back.Value.(*sharedImage).key)
+	}
+
+	c.mu.Unlock()
+
+	for _, waiter := range waiters {
+		if waiter.ctx.Err() == nil {
+			image.set(waiter.img)
+		}
+	}
+}
+
+// fail gives the error to everyone waiting for the image. It is called in the
+// main thread.
+func (c *sharedImageCache) fail(key sharedImageKey, err error) {
+	c.mu.Lock()
+
+	waiters := c.fetching[key]
+	delete(c.fetching, key)
+
+	c.mu.Unlock()
+
+	for _, waiter := range waiters {
+		if waiter.ctx.Err() == nil {
+			imgutil.OptsError(waiter.ctx, err)
+		}
+	}
+}
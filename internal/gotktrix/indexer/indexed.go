@@ -14,6 +14,9 @@ type IndexedRoomMember struct {
 	ID   matrix.UserID `json:"id"`
 	Room matrix.RoomID `json:"room_id"`
 	Name string        `json:"name"`
+	// Server is the homeserver part of the user ID. It is indexed separately
+	// so that members can be searched by their homeserver.
+	Server string `json:"server,omitempty"`
 }
 
 func indexRoomMember(m *event.RoomMemberEvent) IndexedRoomMember {
@@ -21,6 +24,9 @@ func indexRoomMember(m *event.RoomMemberEvent) IndexedRoomMember {
 		ID:   m.UserID,
 		Room: m.RoomID,
 	}
+	if _, server, err := m.UserID.Parse(); err == nil {
+		idx.Server = server
+	}
 	if m.DisplayName != nil {
 		idx.Name = *m.DisplayName
 	}
@@ -37,3 +43,34 @@ func (m *IndexedRoomMember) Index(b *bleve.Batch) error {
 func (m *IndexedRoomMember) Type() string {
 	return "RoomMember"
 }
+
+// IndexedMessage is the data structure representing an indexed message. Its
+// fields are named differently from IndexedRoomMember's, so that searching
+// members never matches messages.
+type IndexedMessage struct {
+	ID     matrix.EventID   `json:"event_id"`
+	Room   matrix.RoomID    `json:"in_room"`
+	Sender matrix.UserID    `json:"sender"`
+	Body   string           `json:"body"`
+	Time   matrix.Timestamp `json:"ts"`
+}
+
+func indexMessage(m *event.RoomMessageEvent) IndexedMessage {
+	return IndexedMessage{
+		ID:     m.ID,
+		Room:   m.RoomID,
+		Sender: m.Sender,
+		Body:   m.Body,
+		Time:   m.OriginServerTime,
+	}
+}
+
+// Index indexes m into the given Bleve indexer.
+func (m *IndexedMessage) Index(b *bleve.Batch) error {
+	return b.Index(string(m.Room)+"\x02"+string(m.ID), m)
+}
+
+// Type returns RoomMessage.
+func (m *IndexedMessage) Type() string {
+	return "RoomMessage"
+}
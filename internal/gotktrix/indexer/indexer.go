@@ -3,6 +3,7 @@ package indexer
 import (
 	"context"
 	"log"
+	"strings"
 	"sync"
 
 	"github.com/blevesearch/bleve/v2"
@@ -64,6 +65,11 @@ func Open(path string) (*Indexer, error) {
 	return &Indexer{idx}, nil
 }
 
+// Close closes the index. The Indexer must not be used afterwards.
+func (idx *Indexer) Close() error {
+	return idx.idx.Close()
+}
+
 // BatchIndexer wraps around a Bleve indexer for batch writing.
 type BatchIndexer struct {
 	idx bleve.Index
@@ -91,6 +97,12 @@ func (b BatchIndexer) IndexRoomMember(m *event.RoomMemberEvent) {
 	b.index(&data)
 }
 
+// IndexMessage indexes the body of the given message.
+func (b BatchIndexer) IndexMessage(m *event.RoomMessageEvent) {
+	data := indexMessage(m)
+	b.index(&data)
+}
+
 type indexable interface {
 	Index(*bleve.Batch) error
 }
@@ -130,6 +142,10 @@ func (idx *Indexer) SearchRoomMember(roomID matrix.RoomID, limit int) RoomMember
 // Search looks up the indexing database and searches for the given string. The
 // returned list of IDs is valid until the next time Search is called.
 func (s *RoomMemberSearcher) Search(ctx context.Context, str string) []IndexedRoomMember {
+	// Prefix queries aren't analyzed, so the string must match the lowercased
+	// tokens.
+	str = strings.ToLower(strings.TrimPrefix(str, "@"))
+
 	if s.queries != nil {
 		// Set all known queries.
 		for _, qry := range s.queries {
@@ -148,17 +164,19 @@ func (s *RoomMemberSearcher) Search(ctx context.Context, str string) []IndexedRo
 		s.queries = []query.Query{
 			&query.FuzzyQuery{Term: str, FieldVal: "name", Fuzziness: 1},
 			&query.PrefixQuery{Prefix: str, FieldVal: "name"},
+			&query.PrefixQuery{Prefix: str, FieldVal: "id"},
+			&query.PrefixQuery{Prefix: str, FieldVal: "server"},
 		}
 
 		// Create an AND match so that only queries matching the RoomID is
-		// searched on. It is written as (roomID AND (id OR name)).
+		// searched on. It is written as (roomID AND (id OR name OR server)).
 		and := query.NewConjunctionQuery([]query.Query{
 			&query.MatchQuery{
 				Match:    string(s.room),
 				Prefix:   len(s.room),
 				FieldVal: "room_id",
 			},
-			// id OR name
+			// id OR name OR server
 			query.NewDisjunctionQuery(s.queries),
 		})
 
@@ -188,3 +206,58 @@ func (s *RoomMemberSearcher) Search(ctx context.Context, str string) []IndexedRo
 
 	return s.res
 }
+
+// SearchMessages searches the indexed messages for the given string, newest
+// first. If roomID is not empty, then only messages in that room are searched.
+func (idx *Indexer) SearchMessages(
+	ctx context.Context, str string, roomID matrix.RoomID, limit int) []IndexedMessage {
+
+	var q query.Query = &query.MatchQuery{
+		Match:    str,
+		FieldVal: "body",
+		Operator: query.MatchQueryOperatorAnd,
+	}
+
+	if roomID != "" {
+		q = query.NewConjunctionQuery([]query.Query{
+			&query.MatchPhraseQuery{
+				MatchPhrase: string(roomID),
+				FieldVal:    "in_room",
+			},
+			q,
+		})
+	}
+
+	req := bleve.NewSearchRequestOptions(q, limit, 0, false)
+	req.Fields = []string{"event_id", "in_room", "sender", "body", "ts"}
+	req.SortByCustom(search.SortOrder{
+		&search.SortField{Field: "ts", Desc: true},
+	})
+
+	results, err := idx.idx.SearchInContext(ctx, req)
+	if err != nil {
+		log.Println("indexer: query error:", err)
+		return nil
+	}
+
+	messages := make([]IndexedMessage, 0, len(results.Hits))
+	for _, res := range results.Hits {
+		msg := IndexedMessage{
+			ID:     matrix.EventID(fieldString(res.Fields["event_id"])),
+			Room:   matrix.RoomID(fieldString(res.Fields["in_room"])),
+			Sender: matrix.UserID(fieldString(res.Fields["sender"])),
+			Body:   fieldString(res.Fields["body"]),
+		}
+		if ts, ok := res.Fields["ts"].(float64); ok {
+			msg.Time = matrix.Timestamp(ts)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages
+}
+
+func fieldString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
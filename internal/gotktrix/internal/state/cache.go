@@ -0,0 +1,205 @@
+package state
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/internal/db"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+const (
+	// stateCacheSize is the maximum number of room state events that are
+	// kept in memory.
+	stateCacheSize = 4096
+	// timelineCacheSize is the maximum number of room timelines that are kept
+	// in memory. Only the timelines of opened rooms are cached, so this is
+	// kept small.
+	timelineCacheSize = 16
+)
+
+// cacheKey is the key of a value in an lruCache. Type and Key are empty for
+// timelines.
+type cacheKey struct {
+	RoomID matrix.RoomID
+	Type   event.Type
+	Key    string
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	value interface{}
+}
+
+// lruCache is an in-memory least-recently-used cache in front of the database.
+// It's used for hot keys that are read much more often than they are written,
+// such as the room state, since every database read is a bbolt transaction.
+type lruCache struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List // front is most recently used
+	items map[cacheKey]*list.Element
+	// gen is incremented on every invalidation. Values read from the database
+	// are only stored if no invalidation happened during the read, since they
+	// might be outdated.
+	gen uint64
+}
+
+func newLRUCache(max int) *lruCache {
+	return &lruCache{
+		max:   max,
+		order: list.New(),
+		items: make(map[cacheKey]*list.Element, max),
+	}
+}
+
+// generation returns the current generation of the cache. It must be called
+// before reading from the database, and the value must be given to store.
+func (c *lruCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.gen
+}
+
+func (c *lruCache) load(k cacheKey) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[k]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).value, true
+}
+
+// store stores the value read from the database, unless the cache has been
+// invalidated since gen.
+func (c *lruCache) store(gen uint64, k cacheKey, v interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.gen != gen {
+		return
+	}
+
+	if elem, ok := c.items[k]; ok {
+		elem.Value.(*cacheEntry).value = v
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[k] = c.order.PushFront(&cacheEntry{key: k, value: v})
+
+	for c.order.Len() > c.max {
+		back := c.order.Back()
+		c.order.Remove(back)
+		delete(c.items, back.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidateRooms removes all values of the given rooms.
+func (c *lruCache) invalidateRooms(roomIDs map[matrix.RoomID]struct{}) {
+	if len(roomIDs) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+
+	for k, elem := range c.items {
+		if _, ok := roomIDs[k.RoomID]; ok {
+			c.order.Remove(elem)
+			delete(c.items, k)
+		}
+	}
+}
+
+// stateCaches holds the in-memory caches of a State.
+type stateCaches struct {
+	state     *lruCache // cacheKey -> event.StateEvent
+	timelines *lruCache // cacheKey -> []event.RoomEvent
+}
+
+func newStateCaches() stateCaches {
+	return stateCaches{
+		state:     newLRUCache(stateCacheSize),
+		timelines: newLRUCache(timelineCacheSize),
+	}
+}
+
+// invalidate drops everything cached about the given rooms. It must be called
+// after the database writes are done.
+func (s *State) invalidate(roomIDs ...matrix.RoomID) {
+	rooms := make(map[matrix.RoomID]struct{}, len(roomIDs))
+	for _, roomID := range roomIDs {
+		rooms[roomID] = struct{}{}
+		s.memberNames.Delete(roomID)
+	}
+
+	s.caches.state.invalidateRooms(rooms)
+	s.caches.timelines.invalidateRooms(rooms)
+}
+
+// invalidateSync drops everything cached about the rooms in the given sync
+// response.
+func (s *State) invalidateSync(sync *api.SyncResponse) {
+	roomIDs := make([]matrix.RoomID, 0,
+		len(sync.Rooms.Joined)+len(sync.Rooms.Invited)+len(sync.Rooms.Left))
+
+	for k := range sync.Rooms.Joined {
+		roomIDs = append(roomIDs, k)
+	}
+	for k := range sync.Rooms.Invited {
+		roomIDs = append(roomIDs, k)
+	}
+	for k := range sync.Rooms.Left {
+		roomIDs = append(roomIDs, k)
+	}
+
+	s.invalidate(roomIDs...)
+}
+
+// cachedTimeline returns the cached timeline of the given room, if any. The
+// returned slice must not be modified.
+func (s *State) cachedTimeline(roomID matrix.RoomID) ([]event.RoomEvent, bool) {
+	v, ok := s.caches.timelines.load(cacheKey{RoomID: roomID})
+	if !ok {
+		return nil, false
+	}
+	return v.([]event.RoomEvent), true
+}
+
+// eachCachedTimeline calls f on each event in the cached timeline of the given
+// room and returns true, or returns false if it's not cached. It behaves like
+// db.Node.Each.
+func (s *State) eachCachedTimeline(
+	roomID matrix.RoomID, rev bool, f func(event.RoomEvent) error) (bool, error) {
+
+	evs, ok := s.cachedTimeline(roomID)
+	if !ok {
+		return false, nil
+	}
+
+	for i := range evs {
+		if rev {
+			i = len(evs) - i - 1
+		}
+
+		if err := f(evs[i]); err != nil {
+			if errors.Is(err, db.EachBreak) {
+				return true, nil
+			}
+			return true, err
+		}
+	}
+
+	return true, nil
+}
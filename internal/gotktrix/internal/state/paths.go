@@ -20,6 +20,8 @@ type dbPaths struct {
 	directs   db.NodePath
 	summaries db.NodePath
 	timelines db.NodePath
+	drafts    db.NodePath
+	outbox    db.NodePath
 }
 
 func newDBPaths(topPath db.NodePath) dbPaths {
@@ -29,6 +31,8 @@ func newDBPaths(topPath db.NodePath) dbPaths {
 		directs:   topPath.Tail("directs"),
 		summaries: topPath.Tail("summaries"),
 		timelines: topPath.Tail("timelines"),
+		drafts:    topPath.Tail("drafts"),
+		outbox:    topPath.Tail("outbox"),
 	}
 }
 
@@ -167,6 +171,23 @@ func (p *dbPaths) setTimeline(n db.Node, roomID matrix.RoomID, tl api.SyncTimeli
 	}
 }
 
+// setTimelineState sets the state events in the timeline as room state. Left
+// rooms have no timeline kept, but the leave event itself is usually only in
+// the timeline.
+func (p *dbPaths) setTimelineState(n db.Node, roomID matrix.RoomID, tl api.SyncTimeline) {
+	n = n.FromPath(p.rooms).Node(string(roomID))
+
+	for _, raw := range tl.Events {
+		var base struct {
+			StateKey *string `json:"state_key"`
+		}
+		if err := json.Unmarshal(raw, &base); err != nil || base.StateKey == nil {
+			continue
+		}
+		setRawEvent(n, roomID, raw, true)
+	}
+}
+
 func (p *dbPaths) deleteTimeline(n db.Node, roomID matrix.RoomID) {
 	n = p.timelineNode(n, roomID)
 
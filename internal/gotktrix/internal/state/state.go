@@ -36,6 +36,7 @@ type State struct {
 
 	// caches
 	memberNames memberNameCache
+	caches      stateCaches
 }
 
 // New creates a new State using bbolt pointing to the given path.
@@ -69,6 +70,7 @@ func New(path string, userID matrix.UserID) (*State, error) {
 		top:    kv.NodeFromPath(topPath),
 		paths:  newDBPaths(topPath),
 		userID: userID,
+		caches: newStateCaches(),
 	}, nil
 }
 
@@ -118,6 +120,29 @@ func (s *State) ResetRoom(roomID matrix.RoomID, key string) {
 	s.top.FromPath(s.paths.rooms.Tail(string(roomID), "_roombool")).Delete(key)
 }
 
+// EventIsHidden returns true if the event has been hidden locally using
+// SetEventHidden.
+func (s *State) EventIsHidden(roomID matrix.RoomID, eventID matrix.EventID) bool {
+	return s.top.FromPath(s.paths.rooms.Tail(string(roomID), "_hidden")).Exists(string(eventID))
+}
+
+// SetEventHidden marks the given event as hidden or not. Hidden events are only
+// hidden locally; they're still kept in the timeline.
+func (s *State) SetEventHidden(roomID matrix.RoomID, eventID matrix.EventID, hidden bool) {
+	n := s.top.FromPath(s.paths.rooms.Tail(string(roomID), "_hidden"))
+
+	var err error
+	if hidden {
+		err = n.Set(string(eventID), nil)
+	} else {
+		err = n.Delete(string(eventID))
+	}
+
+	if err != nil {
+		log.Printf("failed to set hidden event %q in room %q: %v", eventID, roomID, err)
+	}
+}
+
 // RoomEvent queries the event with the given type. If the event type implies a
 // state event, then the empty key is tried.
 func (s *State) RoomEvent(roomID matrix.RoomID, typ event.Type) (event.Event, error) {
@@ -138,10 +163,18 @@ func (s *State) RoomEvent(roomID matrix.RoomID, typ event.Type) (event.Event, er
 }
 
 // RoomState returns the last event set by RoomEventSet. It never returns an
-// error as it does not forget state.
+// error as it does not forget state. The returned event may be cached, so it
+// must not be modified.
 func (s *State) RoomState(
 	roomID matrix.RoomID, typ event.Type, key string) (event.StateEvent, error) {
 
+	k := cacheKey{RoomID: roomID, Type: typ, Key: key}
+	if v, ok := s.caches.state.load(k); ok {
+		return v.(event.StateEvent), nil
+	}
+
+	gen := s.caches.state.generation()
+
 	n := s.db.NodeFromPath(s.paths.rooms).Node(string(roomID), string(typ))
 
 	e, err := getEvent(n, key, typ)
@@ -157,9 +190,63 @@ func (s *State) RoomState(
 	info := state.StateInfo()
 	info.RoomID = roomID
 
+	s.caches.state.store(gen, k, state)
 	return state, nil
 }
 
+// RoomStates is like RoomState, except it gets the events with all the given
+// state keys in a single transaction. The returned slice has the same length as
+// keys, and events that aren't in the state are nil.
+func (s *State) RoomStates(
+	roomID matrix.RoomID, typ event.Type, keys []string) []event.StateEvent {
+
+	states := make([]event.StateEvent, len(keys))
+	missing := 0
+
+	for i, key := range keys {
+		v, ok := s.caches.state.load(cacheKey{RoomID: roomID, Type: typ, Key: key})
+		if ok {
+			states[i] = v.(event.StateEvent)
+		} else {
+			missing++
+		}
+	}
+
+	if missing == 0 {
+		return states
+	}
+
+	gen := s.caches.state.generation()
+
+	n := s.db.NodeFromPath(s.paths.rooms).Node(string(roomID), string(typ))
+	n.TxView(func(n db.Node) error {
+		for i, key := range keys {
+			if states[i] != nil {
+				continue
+			}
+
+			e, err := getEvent(n, key, typ)
+			if err != nil {
+				continue
+			}
+
+			state, ok := e.(event.StateEvent)
+			if !ok {
+				continue
+			}
+
+			info := state.StateInfo()
+			info.RoomID = roomID
+
+			states[i] = state
+			s.caches.state.store(gen, cacheKey{RoomID: roomID, Type: typ, Key: key}, state)
+		}
+		return nil
+	})
+
+	return states
+}
+
 // EachRoomState calls f on every raw event in the room state. It satisfies the
 // EachRoomState method requirement inside gotrix.State, but most callers should
 // not use this method, since there is no length information.
@@ -311,6 +398,39 @@ func (s *State) RoomSummary(roomID matrix.RoomID) (api.SyncRoomSummary, error) {
 	return summary, s.db.NodeFromPath(s.paths.summaries).GetAny(string(roomID), &summary)
 }
 
+// RoomDraft unmarshals the draft that was saved for the room into v.
+func (s *State) RoomDraft(roomID matrix.RoomID, v interface{}) error {
+	return s.db.NodeFromPath(s.paths.drafts).GetAny(string(roomID), v)
+}
+
+// SetRoomDraft saves v as the draft of the room. If v is nil, then the room's
+// draft is deleted.
+func (s *State) SetRoomDraft(roomID matrix.RoomID, v interface{}) error {
+	n := s.db.NodeFromPath(s.paths.drafts)
+	if v == nil {
+		return n.Delete(string(roomID))
+	}
+	return n.SetAny(string(roomID), v)
+}
+
+// EachOutbox calls f with every message in the outbox, sorted by their keys.
+// The given bytes are only valid within f.
+func (s *State) EachOutbox(f func(key string, b []byte) error) error {
+	return s.db.NodeFromPath(s.paths.outbox).Each(func(k string, b []byte, _ int) error {
+		return f(k, b)
+	})
+}
+
+// SetOutbox saves v into the outbox under the given key. If v is nil, then the
+// message is deleted from the outbox.
+func (s *State) SetOutbox(key string, v interface{}) error {
+	n := s.db.NodeFromPath(s.paths.outbox)
+	if v == nil {
+		return n.Delete(key)
+	}
+	return n.SetAny(key, v)
+}
+
 // Rooms returns the keys of all room states in the state.
 func (s *State) Rooms() ([]matrix.RoomID, error) {
 	var roomIDs []matrix.RoomID
@@ -354,6 +474,46 @@ func (s *State) Rooms() ([]matrix.RoomID, error) {
 	return roomIDs, err
 }
 
+// InvitedRooms returns the rooms that the user is invited to but hasn't joined
+// or declined yet. Only the stripped state sent along with the invite is known
+// about these rooms.
+func (s *State) InvitedRooms() ([]matrix.RoomID, error) {
+	var roomIDs []matrix.RoomID
+
+	err := s.top.FromPath(s.paths.rooms).TxView(func(n db.Node) error {
+		return n.Each(func(k string, _ []byte, l int) error {
+			if roomIDs == nil {
+				roomIDs = make([]matrix.RoomID, 0, l)
+			}
+			roomIDs = append(roomIDs, matrix.RoomID(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invited := roomIDs[:0]
+
+	for _, id := range roomIDs {
+		// Joined rooms have a timeline, even if the join event itself only
+		// came in the timeline and not as state.
+		if _, err := s.RoomPreviousBatch(id); err == nil {
+			continue
+		}
+
+		e, err := s.RoomState(id, event.TypeRoomMember, string(s.userID))
+		if err != nil {
+			continue
+		}
+		if member, ok := e.(*event.RoomMemberEvent); ok && member.NewState == event.MemberInvited {
+			invited = append(invited, id)
+		}
+	}
+
+	return invited, nil
+}
+
 // RoomPreviousBatch gets the previous batch string for the given room.
 func (s *State) RoomPreviousBatch(roomID matrix.RoomID) (prev string, err error) {
 	n := s.paths.timelineNode(s.top, roomID)
@@ -366,8 +526,17 @@ func (s *State) RoomPreviousBatch(roomID matrix.RoomID) (prev string, err error)
 }
 
 // RoomTimeline returns the latest raw timeline events of a room. The order of
-// the returned events are always guaranteed to be latest last.
+// the returned events are always guaranteed to be latest last. The timeline is
+// cached until the next sync of the room, so the returned events must not be
+// modified.
 func (s *State) RoomTimeline(roomID matrix.RoomID) ([]event.RoomEvent, error) {
+	if evs, ok := s.cachedTimeline(roomID); ok {
+		// Don't let callers append into the cached slice.
+		return evs[:len(evs):len(evs)], nil
+	}
+
+	gen := s.caches.timelines.generation()
+
 	var evs []event.RoomEvent
 
 	n := s.paths.timelineEventsNode(s.top, roomID)
@@ -387,11 +556,16 @@ func (s *State) RoomTimeline(roomID matrix.RoomID) ([]event.RoomEvent, error) {
 		return nil, errors.New("empty timeline state")
 	}
 
-	return evs, nil
+	s.caches.timelines.store(gen, cacheKey{RoomID: roomID}, evs)
+	return evs[:len(evs):len(evs)], nil
 }
 
 // EachTimeline iterates through the timeline.
 func (s *State) EachTimeline(roomID matrix.RoomID, f func(event.RoomEvent) error) error {
+	if ok, err := s.eachCachedTimeline(roomID, false, f); ok {
+		return err
+	}
+
 	n := s.paths.timelineEventsNode(s.top, roomID)
 
 	return n.Each(func(_ string, b []byte, _ int) error {
@@ -401,6 +575,10 @@ func (s *State) EachTimeline(roomID matrix.RoomID, f func(event.RoomEvent) error
 
 // EachTimelineReverse iterates through the timeline in reverse.
 func (s *State) EachTimelineReverse(roomID matrix.RoomID, f func(event.RoomEvent) error) error {
+	if ok, err := s.eachCachedTimeline(roomID, true, f); ok {
+		return err
+	}
+
 	n := s.paths.timelineEventsNode(s.top, roomID)
 
 	return n.EachReverse(func(_ string, b []byte, _ int) error {
@@ -495,12 +673,17 @@ func (s *State) AddRoomMessages(roomID matrix.RoomID, resp *api.RoomMessagesResp
 	if err != nil {
 		log.Println("AddRoomEvents error:", err)
 	}
+
+	s.invalidate(roomID)
 }
 
 // AddRoomEvents adds the given list of raw events. Note that values set here
 // will never override values from /sync.
 func (s *State) AddRoomEvents(roomID matrix.RoomID, evs []event.RawEvent) {
 	s.paths.setRaws(s.top, roomID, evs, false)
+	// Existing values are never overridden, so only the member names need to
+	// be recalculated in case a member was added.
+	s.memberNames.Delete(roomID)
 }
 
 // UseDirectEvent fills the state cache with information from the direct event.
@@ -543,6 +726,10 @@ func (s *State) RoomNotificationCount(roomID matrix.RoomID) m.NotificationCount
 
 // AddEvent sets the room state events inside a State to be returned by State later.
 func (s *State) AddEvents(sync *api.SyncResponse) error {
+	// Invalidate the caches only after the transaction is committed, so that
+	// they can't be refilled with old values.
+	defer s.invalidateSync(sync)
+
 	return s.top.TxUpdate(func(n db.Node) error {
 		s.paths.setRaws(n, "", sync.AccountData.Events, true)
 		s.paths.setRaws(n, "", sync.Presence.Events, true)
@@ -577,6 +764,7 @@ func (s *State) AddEvents(sync *api.SyncResponse) error {
 		for k, v := range sync.Rooms.Left {
 			s.paths.setRaws(n, k, v.State.Events, true)
 			s.paths.setRaws(n, k, v.AccountData.Events, true)
+			s.paths.setTimelineState(n, k, v.Timeline)
 			s.paths.deleteTimeline(n, k)
 		}
 
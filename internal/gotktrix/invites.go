@@ -0,0 +1,103 @@
+package gotktrix
+
+import (
+	"sort"
+
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// RoomInvite is an invite to a room that the user hasn't joined or declined
+// yet. It's described using the stripped state that came with the invite, so
+// some fields may be empty.
+type RoomInvite struct {
+	RoomID matrix.RoomID
+	Name   string
+	Avatar matrix.URL
+	// Inviter is the user who sent the invite.
+	Inviter     matrix.UserID
+	InviterName string
+	// IsDirect is true if the inviter wants to chat with only the user.
+	IsDirect bool
+	// Time is when the invite was sent, if known.
+	Time matrix.Timestamp
+}
+
+// RoomInvites returns the user's pending invites, newest first.
+func (c *Client) RoomInvites() []RoomInvite {
+	roomIDs, err := c.State.InvitedRooms()
+	if err != nil {
+		return nil
+	}
+
+	invites := make([]RoomInvite, 0, len(roomIDs))
+	for _, roomID := range roomIDs {
+		invites = append(invites, c.RoomInvite(roomID))
+	}
+
+	sort.SliceStable(invites, func(i, j int) bool {
+		return invites[i].Time > invites[j].Time
+	})
+
+	return invites
+}
+
+// RoomInvite describes the user's invite to the given room.
+func (c *Client) RoomInvite(roomID matrix.RoomID) RoomInvite {
+	invite := RoomInvite{RoomID: roomID}
+
+	if e, err := c.State.RoomState(roomID, event.TypeRoomMember, string(c.UserID)); err == nil {
+		member := e.(*event.RoomMemberEvent)
+		invite.Inviter = member.Sender
+		invite.IsDirect = member.IsDirect
+		invite.Time = member.OriginServerTime
+	}
+
+	if invite.Inviter != "" {
+		invite.InviterName, _, _ = invite.Inviter.Parse()
+		if name, err := c.Offline().MemberName(roomID, invite.Inviter, false); err == nil {
+			invite.InviterName = name.Name
+		}
+	}
+
+	if e, err := c.State.RoomState(roomID, event.TypeRoomAvatar, ""); err == nil {
+		invite.Avatar = e.(*event.RoomAvatarEvent).URL
+	}
+
+	// Direct chats usually have no name, so they're named after the inviter.
+	invite.Name, _ = c.Offline().RoomName(roomID)
+	if invite.Name == "" || invite.Name == string(roomID) {
+		invite.Name = invite.InviterName
+	}
+	if invite.Name == "" {
+		invite.Name = string(roomID)
+	}
+
+	return invite
+}
+
+// AcceptInvite joins the room that the user is invited to. Invites to direct
+// chats are also marked as direct, so that they show up with the other direct
+// chats.
+func (c *Client) AcceptInvite(invite RoomInvite) error {
+	if err := c.RoomJoin(invite.RoomID, ""); err != nil {
+		return errors.Wrap(err, "failed to accept invite")
+	}
+
+	if invite.IsDirect && invite.Inviter != "" {
+		if err := c.MarkRoomAsDM(invite.Inviter, invite.RoomID); err != nil {
+			return errors.Wrap(err, "failed to mark the room as direct")
+		}
+	}
+
+	return nil
+}
+
+// DeclineInvite declines the invite to the given room.
+func (c *Client) DeclineInvite(roomID matrix.RoomID) error {
+	if err := c.RoomLeave(roomID, ""); err != nil {
+		return errors.Wrap(err, "failed to decline invite")
+	}
+	return nil
+}
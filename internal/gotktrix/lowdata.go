@@ -0,0 +1,42 @@
+package gotktrix
+
+import (
+	"sync/atomic"
+
+	"github.com/diamondburned/gotrix"
+)
+
+// lowDataTimelineLimit is the number of timeline events that the sync asks for
+// in each room in low-data mode.
+const lowDataTimelineLimit = 10
+
+// lowDataMode is true if the client should avoid using too much data, such as
+// when the connection is metered.
+type lowDataMode struct {
+	on uint32
+}
+
+// SetLowDataMode sets whether or not the client is in low-data mode. In
+// low-data mode, images are fetched at the smallest scale, and the sync asks
+// for fewer events if the client is opened in this mode.
+func (c *Client) SetLowDataMode(on bool) {
+	var v uint32
+	if on {
+		v = 1
+	}
+	atomic.StoreUint32(&c.lowData.on, v)
+}
+
+// LowDataMode returns true if the client is in low-data mode.
+func (c *Client) LowDataMode() bool {
+	return atomic.LoadUint32(&c.lowData.on) == 1
+}
+
+// syncOptions returns the options to open the sync loop with.
+func (c *Client) syncOptions() gotrix.SyncOptions {
+	opts := SyncOptions
+	if c.LowDataMode() {
+		opts.Filter.Room.Timeline.Limit = lowDataTimelineLimit
+	}
+	return opts
+}
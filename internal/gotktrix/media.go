@@ -0,0 +1,80 @@
+package gotktrix
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// contentScanner holds the base URL of a Matrix content scanner that media is
+// fetched through, if any.
+type contentScanner struct {
+	mu   sync.RWMutex
+	base string
+}
+
+// SetContentScanner sets the base URL of the Matrix content scanner to fetch
+// media through, such as "https://scanner.example.com". Media URLs returned by
+// the client will point to the scanner's media proxy instead of the homeserver.
+// An empty URL fetches media from the homeserver directly.
+func (c *Client) SetContentScanner(base string) {
+	c.scanner.mu.Lock()
+	c.scanner.base = strings.TrimSuffix(strings.TrimSpace(base), "/")
+	c.scanner.mu.Unlock()
+}
+
+// scannerURL returns the media proxy URL for the given endpoint and Matrix
+// URL, or false if there's no content scanner or the URL isn't an MXC URL.
+func (c *Client) scannerURL(endpoint string, mURL matrix.URL) (string, bool) {
+	c.scanner.mu.RLock()
+	base := c.scanner.base
+	c.scanner.mu.RUnlock()
+
+	if base == "" {
+		return "", false
+	}
+
+	u, err := url.Parse(string(mURL))
+	if err != nil || u.Scheme != "mxc" {
+		return "", false
+	}
+
+	mediaID := strings.TrimPrefix(u.Path, "/")
+
+	return base + "/_matrix/media_proxy/unstable/" + endpoint + "/" +
+		url.PathEscape(u.Host) + "/" + url.PathEscape(mediaID), true
+}
+
+// MediaDownloadURL wraps around gotrix's MediaDownloadURL. If a content scanner
+// is set, then the returned URL points to it. In privacy mode, the homeserver
+// isn't allowed to fetch media from other servers.
+func (c *Client) MediaDownloadURL(mURL matrix.URL, allowRemote bool, filename string) (string, error) {
+	if u, ok := c.scannerURL("download", mURL); ok {
+		return u, nil
+	}
+	allowRemote = allowRemote && !c.PrivacyMode()
+	return c.Client.MediaDownloadURL(mURL, allowRemote, filename)
+}
+
+// MediaThumbnailURL wraps around gotrix's MediaThumbnailURL. If a content
+// scanner is set, then the returned URL points to it. Remote media is disabled
+// in privacy mode, like MediaDownloadURL.
+func (c *Client) MediaThumbnailURL(
+	mURL matrix.URL, allowRemote bool, w, h int, method api.MediaThumbnailMethod) (string, error) {
+
+	if u, ok := c.scannerURL("thumbnail", mURL); ok {
+		query := url.Values{
+			"width":  {strconv.Itoa(w)},
+			"height": {strconv.Itoa(h)},
+			"method": {string(method)},
+		}
+		return u + "?" + query.Encode(), nil
+	}
+
+	allowRemote = allowRemote && !c.PrivacyMode()
+	return c.Client.MediaThumbnailURL(mURL, allowRemote, w, h, method)
+}
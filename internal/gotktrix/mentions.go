@@ -0,0 +1,96 @@
+package gotktrix
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/diamondburned/gotrix/event"
+)
+
+// mentionNames holds the alternative names that the user also wants to be
+// notified on, such as their IRC nickname or their display names on bridged
+// networks.
+type mentionNames struct {
+	mu    sync.RWMutex
+	names []string
+}
+
+// SetMentionNames sets the alternative names that the user also wants to be
+// notified on. Messages that mention any of these names as a whole word will be
+// notified and highlighted, as if they had matched a push rule, unless the push
+// rule that matches says not to notify. Names are matched case-insensitively.
+func (c *Client) SetMentionNames(names []string) {
+	lowered := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			lowered = append(lowered, strings.ToLower(name))
+		}
+	}
+
+	c.mentions.mu.Lock()
+	c.mentions.names = lowered
+	c.mentions.mu.Unlock()
+}
+
+// mentionsName returns true if the given message mentions any of the names set
+// using SetMentionNames. Messages sent by the user themselves never match.
+func (c *Client) mentionsName(msg *event.RoomMessageEvent) bool {
+	if msg.Sender == c.UserID {
+		return false
+	}
+
+	c.mentions.mu.RLock()
+	defer c.mentions.mu.RUnlock()
+
+	if len(c.mentions.names) == 0 {
+		return false
+	}
+
+	body := strings.ToLower(msg.Body)
+	for _, name := range c.mentions.names {
+		if containsWord(body, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsWord returns true if str contains word and that word isn't part of a
+// bigger word, so that "bob" doesn't match "bobby".
+func containsWord(str, word string) bool {
+	for i := 0; i < len(str); {
+		j := strings.Index(str[i:], word)
+		if j == -1 {
+			return false
+		}
+
+		start := i + j
+		end := start + len(word)
+
+		if !isWordBefore(str, start) && !isWordAt(str, end) {
+			return true
+		}
+
+		i = start + 1
+	}
+
+	return false
+}
+
+func isWordBefore(str string, i int) bool {
+	r, sz := utf8.DecodeLastRuneInString(str[:i])
+	return sz > 0 && isWordRune(r)
+}
+
+func isWordAt(str string, i int) bool {
+	r, sz := utf8.DecodeRuneInString(str[i:])
+	return sz > 0 && isWordRune(r)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
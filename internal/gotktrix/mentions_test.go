@@ -0,0 +1,37 @@
+package gotktrix
+
+import "testing"
+
+func TestContainsWord(t *testing.T) {
+	tests := []struct {
+		str    string
+		word   string
+		expect bool
+	}{
+		{"bob", "bob", true},
+		{"hi bob", "bob", true},
+		{"bob: hi", "bob", true},
+		{"hi bob!", "bob", true},
+		{"(bob)", "bob", true},
+		{"hi bobby", "bob", false},
+		{"hi jimbob", "bob", false},
+		{"bob_", "bob", false},
+		{"bob2", "bob", false},
+		{"bobby and bob", "bob", true},
+		{"bobbob bob", "bob", true},
+		{"bobbob", "bob", false},
+		{"", "bob", false},
+		{"zoë", "zoë", true},
+		{"zoëy", "zoë", false},
+		{"éric", "ric", false},
+		{"@alice:example.com", "alice", true},
+		{"two words here", "two words", true},
+		{"two wordsmiths", "two words", false},
+	}
+
+	for _, test := range tests {
+		if got := containsWord(test.str, test.word); got != test.expect {
+			t.Errorf("containsWord(%q, %q):\n-> %v\n<- %v", test.str, test.word, test.expect, got)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package gotktrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// redactScanLimit is the maximum number of events that RedactRecent looks
+// through to find the user's messages, so that a user with no recent messages
+// doesn't make it paginate through the whole room.
+const redactScanLimit = 1000
+
+// RedactProgress describes the progress of a RedactRecent call.
+type RedactProgress struct {
+	// Done is the number of events redacted so far.
+	Done int
+	// Total is the number of events that will be redacted. It is -1 while the
+	// events are still being collected.
+	Total int
+	// RateLimited is how long the homeserver asked us to wait before the next
+	// redaction. It is zero unless the last request was rate-limited.
+	RateLimited time.Duration
+}
+
+// RedactRecent redacts up to limit of the most recent events that the given user
+// sent in the given room. State events and events that are already redacted are
+// skipped. The progress function is called from the calling goroutine after
+// every change. The number of redacted events is returned; it is non-zero even
+// if an error is returned partway through.
+//
+// Rate limits are respected: the homeserver's requested delay is waited out
+// before the redaction is retried, and the delay is reported through progress.
+func (c *Client) RedactRecent(
+	ctx context.Context,
+	roomID matrix.RoomID, userID matrix.UserID, limit int, reason string,
+	progress func(RedactProgress)) (int, error) {
+
+	state := RedactProgress{Total: -1}
+	progress(state)
+
+	var events []matrix.EventID
+	var scanned int
+
+	paginator := c.RoomPaginator(roomID, 50)
+
+	for len(events) < limit && scanned < redactScanLimit && !paginator.Exhausted() {
+		page, err := paginator.Paginate(ctx)
+		if err != nil {
+			return 0, errors.Wrap(err, "cannot fetch recent messages")
+		}
+		if len(page) == 0 {
+			break
+		}
+
+		// Pages are in chronological order, so walk them backwards to get the
+		// latest events first.
+		for i := len(page) - 1; i >= 0 && len(events) < limit; i-- {
+			info := page[i].RoomInfo()
+			if info.Sender != userID || isRedactedEvent(page[i]) {
+				continue
+			}
+			if _, ok := page[i].(event.StateEvent); ok {
+				continue
+			}
+			events = append(events, info.ID)
+		}
+
+		scanned += len(page)
+	}
+
+	state.Total = len(events)
+	progress(state)
+
+	rateLimited := make(chan time.Duration, 1)
+
+	removeIntercept := c.Interceptor.AddInterceptFull(
+		func(r *http.Request, next func() (*http.Response, error)) (*http.Response, error) {
+			resp, err := next()
+			if err != nil || resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+				return resp, err
+			}
+			if !strings.Contains(r.URL.Path, "/redact/") {
+				return resp, err
+			}
+
+			// Read the body out to get the delay and put it back for the
+			// client, which does the actual waiting.
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			var apiError matrix.APIError
+			if json.Unmarshal(body, &apiError) == nil {
+				select {
+				case rateLimited <- time.Duration(apiError.RetryAfterMillisecond) * time.Millisecond:
+				default:
+				}
+			}
+
+			return resp, nil
+		},
+	)
+	defer removeIntercept()
+
+	client := c.WithContext(ctx)
+
+	for _, id := range events {
+		if err := ctx.Err(); err != nil {
+			return state.Done, err
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- client.Redact(roomID, id, reason) }()
+
+	wait:
+		for {
+			select {
+			case err := <-done:
+				if err != nil {
+					return state.Done, errors.Wrapf(err, "cannot redact event %s", id)
+				}
+				break wait
+			case <-ctx.Done():
+				return state.Done, ctx.Err()
+			case delay := <-rateLimited:
+				state.RateLimited = delay
+				progress(state)
+			}
+		}
+
+		state.Done++
+		state.RateLimited = 0
+		progress(state)
+	}
+
+	return state.Done, nil
+}
+
+// isRedactedEvent returns true if the event has already been redacted.
+func isRedactedEvent(ev event.RoomEvent) bool {
+	return len(ev.RoomInfo().Unsigned.RedactReason) > 0
+}
@@ -0,0 +1,216 @@
+package gotktrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/gotrix"
+	"github.com/pkg/errors"
+)
+
+// OAuthSession holds the information needed to refresh an access token that
+// was issued by the homeserver's OAuth 2.0 authorization server, as described
+// by MSC3861.
+type OAuthSession struct {
+	TokenEndpoint string    `json:"token_endpoint"`
+	ClientID      string    `json:"client_id"`
+	RefreshToken  string    `json:"refresh_token"`
+	Expiry        time.Time `json:"expiry"`
+}
+
+// oauthToken is the token response of an OAuth 2.0 token endpoint.
+type oauthToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (t *oauthToken) err() error {
+	if t.Error == "" {
+		return nil
+	}
+	if t.ErrorDescription != "" {
+		return fmt.Errorf("%s: %s", t.Error, t.ErrorDescription)
+	}
+	return errors.New(t.Error)
+}
+
+// requestOAuthToken posts the given form to an OAuth 2.0 token endpoint.
+// OAuth errors are returned as the token's Error field, not as an error.
+func requestOAuthToken(ctx context.Context, rt http.RoundTripper, endpoint string, form url.Values) (*oauthToken, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token oauthToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, errors.Wrapf(err, "cannot decode token response (status %d)", resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK && token.Error == "" {
+		return nil, fmt.Errorf("unexpected status %d from token endpoint", resp.StatusCode)
+	}
+
+	return &token, nil
+}
+
+// oauthTransport is an http.RoundTripper that keeps an OAuth access token
+// fresh. Every authenticated request has its token replaced by the current
+// one, so copies of the client holding an outdated AccessToken keep working.
+type oauthTransport struct {
+	base http.RoundTripper
+
+	mu        sync.Mutex
+	token     string
+	session   OAuthSession
+	onRefresh []func(token string, session OAuthSession)
+}
+
+// refreshMargin is how long before the token expires that it is refreshed.
+const refreshMargin = 30 * time.Second
+
+func (t *oauthTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return t.base.RoundTrip(r)
+	}
+
+	token, err := t.currentToken(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	return t.base.RoundTrip(r)
+}
+
+func (t *oauthTransport) currentToken(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.session.Expiry.IsZero() || time.Until(t.session.Expiry) > refreshMargin {
+		return t.token, nil
+	}
+
+	token, err := requestOAuthToken(ctx, t.base, t.session.TokenEndpoint, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.session.RefreshToken},
+		"client_id":     {t.session.ClientID},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "cannot refresh access token")
+	}
+	if err := token.err(); err != nil {
+		return "", errors.Wrap(err, "cannot refresh access token")
+	}
+
+	t.token = token.AccessToken
+	if token.RefreshToken != "" {
+		t.session.RefreshToken = token.RefreshToken
+	}
+	t.session.Expiry = tokenExpiry(token.ExpiresIn)
+
+	for _, f := range t.onRefresh {
+		go f(t.token, t.session)
+	}
+
+	return t.token, nil
+}
+
+func tokenExpiry(expiresIn int) time.Time {
+	if expiresIn <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(expiresIn) * time.Second)
+}
+
+// useOAuth makes the given client refresh its access token using the given
+// OAuth session.
+func useOAuth(c *gotrix.Client, token string, session OAuthSession) *oauthTransport {
+	t := &oauthTransport{
+		base:    DefaultTransport,
+		token:   token,
+		session: session,
+	}
+
+	client := &http.Client{Transport: t}
+	if driver, ok := c.ClientDriver.(*http.Client); ok {
+		if driver.Transport != nil {
+			t.base = driver.Transport
+		}
+		client.Timeout = driver.Timeout
+	}
+
+	c.ClientDriver = client
+	c.AccessToken = token
+
+	return t
+}
+
+// NewOAuth creates a new client like New, except the access token was issued
+// by an OAuth 2.0 authorization server and is refreshed using the given
+// session when it expires.
+func NewOAuth(serverName, token string, session OAuthSession, opts Opts) (*Client, error) {
+	opts.init()
+
+	c, err := gotrix.NewWithClient(opts.Client, serverName)
+	if err != nil {
+		return nil, err
+	}
+
+	t := useOAuth(c, token, session)
+
+	client, err := wrapClient(c, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	client.oauth = t
+	return client, nil
+}
+
+// OAuthSession returns the client's current OAuth session and access token.
+// False is returned if the client doesn't use OAuth.
+func (c *Client) OAuthSession() (string, OAuthSession, bool) {
+	if c.oauth == nil {
+		return "", OAuthSession{}, false
+	}
+
+	c.oauth.mu.Lock()
+	defer c.oauth.mu.Unlock()
+
+	return c.oauth.token, c.oauth.session, true
+}
+
+// OnTokenRefresh adds a function that is called in a goroutine every time the
+// access token is refreshed. The new refresh token should be saved, since
+// authorization servers may invalidate the old one. It does nothing if the
+// client doesn't use OAuth.
+func (c *Client) OnTokenRefresh(f func(token string, session OAuthSession)) {
+	if c.oauth == nil {
+		return
+	}
+
+	c.oauth.mu.Lock()
+	c.oauth.onRefresh = append(c.oauth.onRefresh, f)
+	c.oauth.mu.Unlock()
+}
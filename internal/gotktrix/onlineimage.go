@@ -60,14 +60,22 @@ func (p mxcProvider) Do(ctx context.Context, url *url.URL, img imgutil.ImageSett
 		return
 	}
 
+	// Leave the widget empty, so avatars keep showing their initials.
+	if client.TextOnlyMode() {
+		return
+	}
+
 	w := p.Width
 	h := p.Height
 	s := gtkutil.ScaleFactor()
 
-	switch s {
-	case 0:
+	switch {
+	case s == 0:
 		return
-	case 1:
+	case client.LowDataMode():
+		// Don't bother with HiDPI images in low-data mode.
+		s = 1
+	case s == 1:
 		if p.Flags.Has(ImageSkip1xScale) {
 			s = 2
 		}
@@ -89,5 +97,5 @@ func (p mxcProvider) Do(ctx context.Context, url *url.URL, img imgutil.ImageSett
 		return
 	}
 
-	imgutil.AsyncGET(ctx, str, img)
+	sharedImages.get(ctx, str, img)
 }
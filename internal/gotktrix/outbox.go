@@ -0,0 +1,273 @@
+package gotktrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/sys"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// outboxMaxBackoff is the longest time to wait between two attempts at sending
+// the outbox.
+const outboxMaxBackoff = 5 * time.Minute
+
+// outboxBackoff returns how long to wait before trying to send the outbox again
+// after the given number of failed attempts. The wait doubles from a second with
+// every attempt, up to outboxMaxBackoff.
+func outboxBackoff(attempts int) time.Duration {
+	if attempts < 8 {
+		return time.Second << attempts
+	}
+	return outboxMaxBackoff
+}
+
+// OutboxMessage is a message waiting in the outbox to be sent.
+type OutboxMessage struct {
+	RoomID   matrix.RoomID    `json:"room_id"`
+	Type     event.Type       `json:"type"`
+	TxnID    string           `json:"txn_id"`
+	Content  json.RawMessage  `json:"content"`
+	QueuedAt matrix.Timestamp `json:"queued_at"`
+
+	key string
+}
+
+// Event returns the message as an event from the given sender. The event has
+// no ID, since it's not sent yet, but it has the transaction ID.
+func (m OutboxMessage) Event(sender matrix.UserID) event.RoomEvent {
+	raw, _ := json.Marshal(struct {
+		Type     event.Type         `json:"type"`
+		Content  json.RawMessage    `json:"content"`
+		Sender   matrix.UserID      `json:"sender"`
+		Time     matrix.Timestamp   `json:"origin_server_ts"`
+		Unsigned event.UnsignedData `json:"unsigned"`
+	}{
+		Type:     m.Type,
+		Content:  m.Content,
+		Sender:   sender,
+		Time:     m.QueuedAt,
+		Unsigned: event.UnsignedData{TransactionID: m.TxnID},
+	})
+
+	return sys.ParseTimeline(raw, m.RoomID)
+}
+
+// outbox keeps track of sending the messages in the outbox. The messages
+// themselves are kept in the state.
+type outbox struct {
+	mu sync.Mutex
+	// waiters holds the callbacks of WaitOutbox by transaction ID.
+	waiters map[string][]func(matrix.EventID, error)
+	// seq keeps the keys of messages queued at the same time in order.
+	seq      uint32
+	sending  bool
+	closed   bool
+	attempts int
+	nextTry  time.Time
+}
+
+func newOutbox() *outbox {
+	return &outbox{waiters: make(map[string][]func(matrix.EventID, error))}
+}
+
+// nextKey returns a new key that sorts after all previous keys.
+func (o *outbox) nextKey() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.seq++
+	return fmt.Sprintf("%020d-%010d", time.Now().UnixNano(), o.seq)
+}
+
+// done calls the waiters of the message with the given transaction ID.
+func (o *outbox) done(txnID string, eventID matrix.EventID, err error) {
+	o.mu.Lock()
+	waiters := o.waiters[txnID]
+	delete(o.waiters, txnID)
+	o.mu.Unlock()
+
+	for _, f := range waiters {
+		f(eventID, err)
+	}
+}
+
+func (o *outbox) isClosed() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.closed
+}
+
+// close stops the outbox from sending. The messages that aren't sent yet stay
+// in the state.
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.closed = true
+}
+
+// IsTransientError returns true if the request likely failed because of the
+// connection or the homeserver being unavailable, rather than the request
+// itself, meaning that it may succeed if tried again later.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// The request never made it to the homeserver.
+		return true
+	}
+
+	code := matrix.StatusCode(err)
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// QueueMessage puts the event into the outbox. The outbox is sent once the
+// sync loop connects again, in the order that the events were queued in for
+// each room. The outbox is kept in the state, so the events are still sent if
+// the client is closed before then.
+//
+// The transaction ID should be the one that the event was already tried with,
+// so that it's not sent twice if the homeserver did get it.
+func (c *Client) QueueMessage(roomID matrix.RoomID, typ event.Type, txnID string, body interface{}) error {
+	content, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+
+	msg := OutboxMessage{
+		RoomID:   roomID,
+		Type:     typ,
+		TxnID:    txnID,
+		Content:  content,
+		QueuedAt: matrix.Timestamp(time.Now().UnixMilli()),
+	}
+
+	if err := c.State.SetOutbox(c.outbox.nextKey(), msg); err != nil {
+		return errors.Wrap(err, "failed to save to outbox")
+	}
+
+	return nil
+}
+
+// OutboxMessages returns the messages in the outbox of the given room in the
+// order that they will be sent in. If roomID is empty, then the messages of all
+// rooms are returned.
+func (c *Client) OutboxMessages(roomID matrix.RoomID) []OutboxMessage {
+	var msgs []OutboxMessage
+
+	c.State.EachOutbox(func(key string, b []byte) error {
+		var msg OutboxMessage
+		if err := json.Unmarshal(b, &msg); err != nil {
+			log.Println("invalid outbox message:", err)
+			return nil
+		}
+
+		if roomID == "" || msg.RoomID == roomID {
+			msg.key = key
+			msgs = append(msgs, msg)
+		}
+
+		return nil
+	})
+
+	return msgs
+}
+
+// HasOutbox returns true if the room has messages waiting in the outbox. New
+// messages should be queued after them instead of being sent right away.
+func (c *Client) HasOutbox(roomID matrix.RoomID) bool {
+	return len(c.OutboxMessages(roomID)) > 0
+}
+
+// WaitOutbox calls done once the message with the given transaction ID leaves
+// the outbox. If the message is sent, then its event ID is given; otherwise,
+// the error that made it impossible to send is given. done is called outside
+// the main thread.
+func (c *Client) WaitOutbox(txnID string, done func(matrix.EventID, error)) {
+	c.outbox.mu.Lock()
+	defer c.outbox.mu.Unlock()
+
+	c.outbox.waiters[txnID] = append(c.outbox.waiters[txnID], done)
+}
+
+// flushOutbox starts sending the outbox in the background unless it's already
+// being sent or the last attempt was too recent.
+func (c *Client) flushOutbox(*api.SyncResponse) {
+	o := c.outbox
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed || o.sending || time.Now().Before(o.nextTry) {
+		return
+	}
+	o.sending = true
+
+	c.Background(func(c *Client) {
+		retry := c.sendOutbox()
+
+		o.mu.Lock()
+		defer o.mu.Unlock()
+
+		o.sending = false
+
+		if !retry {
+			o.attempts = 0
+			o.nextTry = time.Time{}
+			return
+		}
+
+		o.nextTry = time.Now().Add(outboxBackoff(o.attempts))
+		o.attempts++
+	})
+}
+
+// sendOutbox sends the messages in the outbox. Once a message in a room fails
+// to send, the rest of the room's messages are skipped until the next attempt,
+// so that they're never sent out of order. True is returned if any message
+// should be tried again.
+func (c *Client) sendOutbox() (retry bool) {
+	blocked := make(map[matrix.RoomID]bool)
+
+	for _, msg := range c.OutboxMessages("") {
+		if blocked[msg.RoomID] {
+			continue
+		}
+
+		if c.outbox.isClosed() {
+			return false
+		}
+
+		eventID, err := c.RoomEventSendTxn(msg.RoomID, msg.Type, msg.TxnID, msg.Content)
+		if err != nil {
+			if IsTransientError(err) {
+				blocked[msg.RoomID] = true
+				retry = true
+				continue
+			}
+			log.Printf("dropping message %s from outbox: %v", msg.TxnID, err)
+		}
+
+		if err := c.State.SetOutbox(msg.key, nil); err != nil {
+			log.Println("cannot remove message from outbox:", err)
+		}
+
+		c.outbox.done(msg.TxnID, eventID, err)
+	}
+
+	return
+}
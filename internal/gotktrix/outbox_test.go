@@ -0,0 +1,38 @@
+package gotktrix
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expect   time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{5, 32 * time.Second},
+		{7, 128 * time.Second},
+		{8, outboxMaxBackoff},
+		{9, outboxMaxBackoff},
+		{100, outboxMaxBackoff},
+	}
+
+	for _, test := range tests {
+		if got := outboxBackoff(test.attempts); got != test.expect {
+			t.Errorf("backoff after %d attempts:\n-> %v\n<- %v", test.attempts, test.expect, got)
+		}
+	}
+
+	// The wait must never go past the maximum or shrink.
+	last := time.Duration(0)
+	for attempts := 0; attempts < 64; attempts++ {
+		backoff := outboxBackoff(attempts)
+		if backoff > outboxMaxBackoff || backoff < last {
+			t.Fatalf("backoff after %d attempts is %v, after %v", attempts, backoff, last)
+		}
+		last = backoff
+	}
+}
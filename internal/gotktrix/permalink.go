@@ -0,0 +1,196 @@
+package gotktrix
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// maxVias is the maximum number of servers that are put into a permalink.
+const maxVias = 3
+
+// RoomCanonicalAlias returns the canonical alias of the room, or an empty
+// string if the room has none.
+func (c *Client) RoomCanonicalAlias(roomID matrix.RoomID) string {
+	e, err := c.RoomState(roomID, event.TypeRoomCanonicalAlias, "")
+	if err != nil {
+		return ""
+	}
+
+	ev, _ := e.(*event.RoomCanonicalAliasEvent)
+	if ev == nil {
+		return ""
+	}
+
+	return ev.Alias
+}
+
+// RoomVias returns the servers that are likely to stay in the room, which other
+// servers can join the room through. The server of the user with the highest
+// power level is picked first, followed by the servers with the most joined
+// members. Servers that are IP addresses are skipped, since they can't be
+// moved.
+func (c *Client) RoomVias(roomID matrix.RoomID) []string {
+	members, err := c.RoomMembers(roomID)
+	if err != nil {
+		return nil
+	}
+
+	var levels map[matrix.UserID]int
+	if e, err := c.RoomState(roomID, event.TypeRoomPowerLevels, ""); err == nil {
+		levels = e.(*event.RoomPowerLevelsEvent).UserLevel
+	}
+
+	counts := make(map[string]int)
+
+	var topServer string
+	var topLevel int
+
+	for _, member := range members {
+		if member.NewState != event.MemberJoined {
+			continue
+		}
+
+		_, server, err := member.UserID.Parse()
+		if err != nil || isIPServer(server) {
+			continue
+		}
+
+		counts[server]++
+
+		// Only moderators and above are considered, since they're the ones
+		// that keep the room around.
+		if level := levels[member.UserID]; level >= announcementLevel && level > topLevel {
+			topLevel = level
+			topServer = server
+		}
+	}
+
+	servers := make([]string, 0, len(counts))
+	for server := range counts {
+		if server != topServer {
+			servers = append(servers, server)
+		}
+	}
+
+	sort.Slice(servers, func(i, j int) bool {
+		if counts[servers[i]] != counts[servers[j]] {
+			return counts[servers[i]] > counts[servers[j]]
+		}
+		return servers[i] < servers[j]
+	})
+
+	if topServer != "" {
+		servers = append([]string{topServer}, servers...)
+	}
+
+	if len(servers) > maxVias {
+		servers = servers[:maxVias]
+	}
+
+	return servers
+}
+
+// isIPServer returns true if the server name is an IP address with an
+// optional port.
+func isIPServer(server string) bool {
+	if host, _, err := net.SplitHostPort(server); err == nil {
+		server = host
+	}
+	server = strings.TrimSuffix(strings.TrimPrefix(server, "["), "]")
+	return net.ParseIP(server) != nil
+}
+
+// RoomPermalink returns the matrix.to link to the room. The link uses the
+// room ID along with the servers from RoomVias, so it keeps working if the
+// alias changes. The room's members should be loaded first using
+// RoomEnsureMembers for the servers to be accurate.
+func (c *Client) RoomPermalink(roomID matrix.RoomID) string {
+	link := "https://matrix.to/#/" + url.PathEscape(string(roomID))
+
+	vias := c.RoomVias(roomID)
+	if len(vias) == 0 {
+		return link
+	}
+
+	return link + "?" + url.Values{"via": vias}.Encode()
+}
+
+// EventPermalink is a matrix.to link to an event.
+type EventPermalink struct {
+	// Room is the ID or the alias of the room that the event is in.
+	Room    string
+	EventID matrix.EventID
+}
+
+// ParseEventPermalink parses the given matrix.to link to an event. False is
+// returned if the link isn't one.
+func ParseEventPermalink(link string) (EventPermalink, bool) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host != "matrix.to" {
+		return EventPermalink{}, false
+	}
+
+	// The identifiers are in the fragment, which may have its own query.
+	fragment := u.Fragment
+	if i := strings.IndexByte(fragment, '?'); i != -1 {
+		fragment = fragment[:i]
+	}
+
+	parts := strings.Split(strings.TrimPrefix(fragment, "/"), "/")
+	if len(parts) != 2 {
+		return EventPermalink{}, false
+	}
+
+	for i, part := range parts {
+		if unescaped, err := url.PathUnescape(part); err == nil {
+			parts[i] = unescaped
+		}
+	}
+
+	room, eventID := parts[0], parts[1]
+	if !strings.HasPrefix(room, "!") && !strings.HasPrefix(room, "#") {
+		return EventPermalink{}, false
+	}
+	if !strings.HasPrefix(eventID, "$") {
+		return EventPermalink{}, false
+	}
+
+	return EventPermalink{
+		Room:    room,
+		EventID: matrix.EventID(eventID),
+	}, true
+}
+
+// PermalinkEvent fetches the event that the permalink points to using the
+// room's /context endpoint. The room's alias is resolved first if the link has
+// one. The user must be able to read the room's history.
+func (c *Client) PermalinkEvent(link EventPermalink) (event.RoomEvent, error) {
+	roomID := matrix.RoomID(link.Room)
+
+	if strings.HasPrefix(link.Room, "#") {
+		resp, err := c.Client.RoomAlias(link.Room)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to look up room address")
+		}
+		roomID = resp.RoomID
+	}
+
+	events, err := c.RoomEventContext(roomID, link.EventID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ev := range events {
+		if ev.RoomInfo().ID == link.EventID {
+			return ev, nil
+		}
+	}
+
+	return nil, errors.New("the linked message wasn't found")
+}
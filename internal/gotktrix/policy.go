@@ -0,0 +1,240 @@
+package gotktrix
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/policy"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// PolicyMode is how the rules of a subscribed policy list are applied.
+type PolicyMode string
+
+const (
+	// PolicyFilter hides messages from matching users and servers on this
+	// device only.
+	PolicyFilter PolicyMode = "filter"
+	// PolicyBan also bans matching users from the rooms that the user can ban
+	// in when ApplyPolicyBans is called.
+	PolicyBan PolicyMode = "ban"
+)
+
+// PolicyList is a policy list (MSC2313) that the user is subscribed to.
+type PolicyList struct {
+	RoomID matrix.RoomID `json:"room_id"`
+	Mode   PolicyMode    `json:"mode"`
+}
+
+// PolicyRule is a single ban rule inside a policy list.
+type PolicyRule struct {
+	List   matrix.RoomID
+	Type   event.Type
+	Entity string
+	Reason string
+}
+
+// Matches returns true if the rule matches the given user, either directly or
+// through their homeserver. Room rules never match users.
+func (r PolicyRule) Matches(userID matrix.UserID) bool {
+	switch r.Type {
+	case policy.UserRuleEventType:
+		return globMatch(r.Entity, string(userID))
+	case policy.ServerRuleEventType:
+		_, server, err := userID.Parse()
+		return err == nil && globMatch(r.Entity, server)
+	default:
+		return false
+	}
+}
+
+// policyLists holds the user's subscribed policy lists and the rules from them
+// that apply to users.
+type policyLists struct {
+	mu    sync.RWMutex
+	lists []PolicyList
+	rules []PolicyRule
+}
+
+// SetPolicyLists sets the policy lists that the user is subscribed to. The
+// user must have joined the list rooms so that their rules stay up to date.
+func (c *Client) SetPolicyLists(lists []PolicyList) {
+	c.policy.mu.Lock()
+	c.policy.lists = append([]PolicyList(nil), lists...)
+	c.policy.mu.Unlock()
+
+	c.reloadPolicyRules()
+}
+
+// PolicyLists returns the policy lists that the user is subscribed to.
+func (c *Client) PolicyLists() []PolicyList {
+	c.policy.mu.RLock()
+	defer c.policy.mu.RUnlock()
+
+	return append([]PolicyList(nil), c.policy.lists...)
+}
+
+// PolicyRules returns all the ban rules in the given policy list, including
+// room rules, which are otherwise unused.
+func (c *Client) PolicyRules(roomID matrix.RoomID) []PolicyRule {
+	var rules []PolicyRule
+
+	for _, typ := range policy.RuleEventTypes {
+		c.EachRoomStateLen(roomID, typ, func(ev event.StateEvent, _ int) error {
+			rule, ok := ev.(*policy.RuleEvent)
+			if !ok || rule.IsRemoved() || !rule.Recommendation.IsBan() {
+				return nil
+			}
+
+			rules = append(rules, PolicyRule{
+				List:   roomID,
+				Type:   typ,
+				Entity: rule.Entity,
+				Reason: rule.Reason,
+			})
+			return nil
+		})
+	}
+
+	return rules
+}
+
+// MatchPolicy returns the first rule in the subscribed policy lists that
+// matches the given user. The user never matches themselves.
+func (c *Client) MatchPolicy(userID matrix.UserID) (PolicyRule, bool) {
+	if userID == c.UserID {
+		return PolicyRule{}, false
+	}
+
+	c.policy.mu.RLock()
+	defer c.policy.mu.RUnlock()
+
+	for _, rule := range c.policy.rules {
+		if rule.Matches(userID) {
+			return rule, true
+		}
+	}
+
+	return PolicyRule{}, false
+}
+
+func (c *Client) reloadPolicyRules() {
+	var rules []PolicyRule
+	for _, list := range c.PolicyLists() {
+		for _, rule := range c.Offline().PolicyRules(list.RoomID) {
+			if rule.Type != policy.RoomRuleEventType {
+				rules = append(rules, rule)
+			}
+		}
+	}
+
+	c.policy.mu.Lock()
+	c.policy.rules = rules
+	c.policy.mu.Unlock()
+}
+
+// policySync reloads the policy rules if any of the subscribed lists changed.
+func (c *Client) policySync(s *api.SyncResponse) {
+	for _, list := range c.PolicyLists() {
+		if _, ok := s.Rooms.Joined[list.RoomID]; ok {
+			c.reloadPolicyRules()
+			return
+		}
+	}
+}
+
+// JoinPolicyList joins the policy list room with the given ID or alias and
+// returns its room ID. It does not subscribe to it.
+func (c *Client) JoinPolicyList(idOrAlias string) (matrix.RoomID, error) {
+	var resp struct {
+		RoomID matrix.RoomID `json:"room_id"`
+	}
+
+	err := c.Request(
+		"POST", c.Endpoints.Base()+"/join/"+url.PathEscape(idOrAlias), &resp,
+		httputil.WithToken(), httputil.WithJSONBody(struct{}{}),
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to join policy list")
+	}
+
+	// Fetch the rules now, since the list won't be synced until later.
+	if events, err := c.Client.RoomStates(resp.RoomID); err == nil {
+		c.State.AddRoomEvents(resp.RoomID, events)
+	}
+
+	return resp.RoomID, nil
+}
+
+// ApplyPolicyBans bans the joined members that match a rule from a list in
+// PolicyBan mode, in every room where the user has the power to ban. The number
+// of bans is returned.
+func (c *Client) ApplyPolicyBans(ctx context.Context) (int, error) {
+	var rules []PolicyRule
+
+	banLists := make(map[matrix.RoomID]bool)
+	for _, list := range c.PolicyLists() {
+		banLists[list.RoomID] = list.Mode == PolicyBan
+	}
+
+	c.policy.mu.RLock()
+	for _, rule := range c.policy.rules {
+		if banLists[rule.List] {
+			rules = append(rules, rule)
+		}
+	}
+	c.policy.mu.RUnlock()
+
+	if len(rules) == 0 {
+		return 0, nil
+	}
+
+	rooms, err := c.State.Rooms()
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot get rooms")
+	}
+
+	client := c.WithContext(ctx)
+	var banned int
+
+	for _, roomID := range rooms {
+		// Lists themselves don't need moderating.
+		if _, ok := banLists[roomID]; ok {
+			continue
+		}
+		if !client.HasPower(roomID, BanAction) {
+			continue
+		}
+
+		members, err := client.RoomMembers(roomID)
+		if err != nil {
+			continue
+		}
+
+		for _, member := range members {
+			if member.UserID == c.UserID || member.NewState != event.MemberJoined {
+				continue
+			}
+
+			for _, rule := range rules {
+				if !rule.Matches(member.UserID) {
+					continue
+				}
+
+				if err := client.Ban(roomID, member.UserID, rule.Reason); err != nil {
+					return banned, errors.Wrapf(err, "cannot ban %s", member.UserID)
+				}
+
+				banned++
+				break
+			}
+		}
+	}
+
+	return banned, nil
+}
@@ -0,0 +1,242 @@
+package gotktrix
+
+import (
+	"encoding/json"
+
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// PowerLevels is the part of a room's power levels that the power level editor
+// edits. Unlike event.RoomPowerLevelsEvent, missing fields are filled in with
+// their defaults, so every field can be shown as is.
+type PowerLevels struct {
+	UsersDefault  int
+	EventsDefault int
+	StateDefault  int
+	Invite        int
+	Kick          int
+	Ban           int
+	Redact        int
+	// Users maps the users with their own power levels to their levels.
+	Users map[matrix.UserID]int
+}
+
+// RoomPowerLevels returns the power levels of the room. If the room has no power
+// levels event, then the defaults are returned, with the room creator at 100.
+func (c *Client) RoomPowerLevels(roomID matrix.RoomID) PowerLevels {
+	p := PowerLevels{
+		StateDefault: 50,
+		Kick:         50,
+		Ban:          50,
+		Redact:       50,
+		Users:        map[matrix.UserID]int{},
+	}
+
+	e, err := c.RoomState(roomID, event.TypeRoomPowerLevels, "")
+	if err != nil {
+		// state_default is only 50 if there is a power levels event.
+		p.StateDefault = 0
+		if e, err := c.RoomState(roomID, event.TypeRoomCreate, ""); err == nil {
+			p.Users[e.(*event.RoomCreateEvent).Creator] = 100
+		}
+		return p
+	}
+
+	ev := e.(*event.RoomPowerLevelsEvent)
+	p.UsersDefault = ev.UserDefault
+	p.EventsDefault = ev.EventRequirement
+
+	// state_default is 50 if it's missing, so look at the raw content to tell
+	// it apart from an explicit 0.
+	if _, ok := powerLevelsContent(ev)["state_default"]; ok {
+		p.StateDefault = ev.StateRequirement
+	}
+
+	for _, action := range []struct {
+		dst *int
+		src *int
+	}{
+		{&p.Invite, ev.InviteRequirement},
+		{&p.Kick, ev.KickRequirement},
+		{&p.Ban, ev.BanRequirement},
+		{&p.Redact, ev.RedactRequirement},
+	} {
+		if action.src != nil {
+			*action.dst = *action.src
+		}
+	}
+
+	for userID, level := range ev.UserLevel {
+		p.Users[userID] = level
+	}
+
+	return p
+}
+
+// UserLevel returns the power level of the given user.
+func (p PowerLevels) UserLevel(userID matrix.UserID) int {
+	if level, ok := p.Users[userID]; ok {
+		return level
+	}
+	return p.UsersDefault
+}
+
+// UpdatePowerLevels sends a new power levels event with the fields that differ
+// between from and to changed. Fields that PowerLevels doesn't cover, such as
+// the levels of each event type, are kept as they are.
+func (c *Client) UpdatePowerLevels(roomID matrix.RoomID, from, to PowerLevels) error {
+	content := map[string]json.RawMessage{}
+
+	// Without a power levels event, the creator only has power through
+	// RoomPowerLevels, so the users must always be sent.
+	e, err := c.RoomState(roomID, event.TypeRoomPowerLevels, "")
+	fresh := err != nil
+
+	if !fresh {
+		ev := e.(*event.RoomPowerLevelsEvent)
+		if raw := powerLevelsContent(ev); raw != nil {
+			content = raw
+		} else if b, err := json.Marshal(ev); err == nil {
+			// Events that we sent ourselves may not have their raw JSON.
+			json.Unmarshal(b, &content)
+		}
+	}
+
+	set := func(key string, from, to int) {
+		if from != to {
+			b, _ := json.Marshal(to)
+			content[key] = b
+		}
+	}
+
+	set("users_default", from.UsersDefault, to.UsersDefault)
+	set("events_default", from.EventsDefault, to.EventsDefault)
+	set("state_default", from.StateDefault, to.StateDefault)
+	set("invite", from.Invite, to.Invite)
+	set("kick", from.Kick, to.Kick)
+	set("ban", from.Ban, to.Ban)
+	set("redact", from.Redact, to.Redact)
+
+	if fresh || !sameUserLevels(from.Users, to.Users) {
+		b, err := json.Marshal(to.Users)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode user power levels")
+		}
+		content["users"] = b
+	}
+
+	_, err = c.RoomStateSend(roomID, api.RoomStateSendArg{
+		Type:    event.TypeRoomPowerLevels,
+		Content: content,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to change power levels")
+	}
+
+	return nil
+}
+
+// SetUserPowerLevel changes the power level of the given user in the room.
+func (c *Client) SetUserPowerLevel(roomID matrix.RoomID, userID matrix.UserID, level int) error {
+	from := c.RoomPowerLevels(roomID)
+
+	to := from
+	to.Users = make(map[matrix.UserID]int, len(from.Users)+1)
+	for id, l := range from.Users {
+		to.Users[id] = l
+	}
+
+	if level == from.UsersDefault {
+		delete(to.Users, userID)
+	} else {
+		to.Users[userID] = level
+	}
+
+	return c.UpdatePowerLevels(roomID, from, to)
+}
+
+// CanSetPowerLevel returns true if the user may change the target's power level
+// to the given level. Users may only change the levels of users below them,
+// and only to levels up to their own.
+func (c *Client) CanSetPowerLevel(roomID matrix.RoomID, target matrix.UserID, level int) bool {
+	x := c.ExplainSendEvent(roomID, event.TypeRoomPowerLevels, true)
+	if !x.Allowed || level > x.UserLevel {
+		return false
+	}
+
+	if target == c.UserID {
+		return true
+	}
+
+	return c.RoomPowerLevels(roomID).UserLevel(target) < x.UserLevel
+}
+
+// messageLevel returns the power level needed to send messages in the room.
+func (c *Client) messageLevel(roomID matrix.RoomID, p PowerLevels) int {
+	if e, err := c.RoomState(roomID, event.TypeRoomPowerLevels, ""); err == nil {
+		if level, ok := e.(*event.RoomPowerLevelsEvent).Events[event.TypeRoomMessage]; ok {
+			return level
+		}
+	}
+	return p.EventsDefault
+}
+
+// IsMuted returns true if the given user's power level is too low to send
+// messages in the room.
+func (c *Client) IsMuted(roomID matrix.RoomID, userID matrix.UserID) bool {
+	p := c.RoomPowerLevels(roomID)
+	return p.UserLevel(userID) < c.messageLevel(roomID, p)
+}
+
+// MuteLevel returns the power level that SetMuted gives to muted or unmuted
+// users.
+func (c *Client) MuteLevel(roomID matrix.RoomID, muted bool) int {
+	p := c.RoomPowerLevels(roomID)
+	required := c.messageLevel(roomID, p)
+
+	if muted {
+		return required - 1
+	}
+	if p.UsersDefault >= required {
+		return p.UsersDefault
+	}
+	return required
+}
+
+// CanMute returns true if the user may mute or unmute the given user.
+func (c *Client) CanMute(roomID matrix.RoomID, userID matrix.UserID, muted bool) bool {
+	return userID != c.UserID && c.CanSetPowerLevel(roomID, userID, c.MuteLevel(roomID, muted))
+}
+
+// SetMuted mutes or unmutes the given user by lowering their power level below
+// the level needed to send messages, or by restoring it.
+func (c *Client) SetMuted(roomID matrix.RoomID, userID matrix.UserID, muted bool) error {
+	return c.SetUserPowerLevel(roomID, userID, c.MuteLevel(roomID, muted))
+}
+
+// powerLevelsContent returns the raw content of the power levels event, which
+// has the fields that gotrix doesn't know about or can't tell apart from zero.
+func powerLevelsContent(ev *event.RoomPowerLevelsEvent) map[string]json.RawMessage {
+	var raw struct {
+		Content map[string]json.RawMessage `json:"content"`
+	}
+	if b := ev.Info().Raw; b != nil {
+		json.Unmarshal(b, &raw)
+	}
+	return raw.Content
+}
+
+func sameUserLevels(a, b map[matrix.UserID]int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, level := range a {
+		if l, ok := b[id]; !ok || l != level {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package gotktrix
+
+import (
+	"context"
+	"sync"
+
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// prefetchedPagers holds the paginators that were filled in the background,
+// ready to be taken by the room once it's opened.
+type prefetchedPagers struct {
+	mu     sync.Mutex
+	pagers map[matrix.RoomID]*RoomPaginator
+}
+
+// invalidate drops the paginators of rooms that got new timeline events, since
+// those events would be missing from them.
+func (p *prefetchedPagers) invalidate(s *api.SyncResponse) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for roomID, room := range s.Rooms.Joined {
+		if len(room.Timeline.Events) > 0 {
+			delete(p.pagers, roomID)
+		}
+	}
+	for roomID := range s.Rooms.Left {
+		delete(p.pagers, roomID)
+	}
+}
+
+// PrefetchRoom fetches the latest limit events of the given room in the
+// background if the state doesn't have as many, so that opening the room
+// doesn't have to wait for the homeserver. The fetched events are kept until
+// the room is opened using TakeRoomPaginator or until the room gets new events.
+func (c *Client) PrefetchRoom(ctx context.Context, roomID matrix.RoomID, limit int) error {
+	evs, err := c.State.RoomTimeline(roomID)
+	if err == nil && len(evs) >= limit {
+		return nil
+	}
+
+	c.prefetch.mu.Lock()
+	_, ok := c.prefetch.pagers[roomID]
+	c.prefetch.mu.Unlock()
+
+	if ok {
+		return nil
+	}
+
+	p := c.RoomPaginator(roomID, limit)
+	if err := p.fill(ctx); err != nil {
+		return errors.Wrapf(err, "failed to prefetch room %q", roomID)
+	}
+
+	c.prefetch.mu.Lock()
+	c.prefetch.pagers[roomID] = p
+	c.prefetch.mu.Unlock()
+
+	return nil
+}
+
+// TakeRoomPaginator returns the paginator that was prefetched for the given
+// room using PrefetchRoom with the same limit. A new paginator is returned if
+// there isn't one.
+func (c *Client) TakeRoomPaginator(roomID matrix.RoomID, limit int) *RoomPaginator {
+	c.prefetch.mu.Lock()
+	p, ok := c.prefetch.pagers[roomID]
+	delete(c.prefetch.pagers, roomID)
+	c.prefetch.mu.Unlock()
+
+	if ok && p.limit == limit {
+		return p
+	}
+
+	return c.RoomPaginator(roomID, limit)
+}
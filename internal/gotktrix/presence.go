@@ -0,0 +1,47 @@
+package gotktrix
+
+import (
+	"sync"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/sys"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/internal/state"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// presences keeps the latest presence of every user that the homeserver sent
+// while syncing. It's only kept in memory, since presence goes stale quickly.
+type presences struct {
+	mu    sync.RWMutex
+	users map[matrix.UserID]matrix.Presence
+}
+
+func (p *presences) sync(s *api.SyncResponse) {
+	if len(s.Presence.Events) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, raw := range s.Presence.Events {
+		if state.GuessType(raw) != event.TypePresence {
+			continue
+		}
+
+		if ev, ok := sys.Parse(raw).(*event.PresenceEvent); ok {
+			p.users[ev.User] = ev.Presence
+		}
+	}
+}
+
+// UserPresence returns the last known presence of the given user, or an empty
+// string if the homeserver hasn't told us about it since the client started.
+// Subscribe to event.TypePresence to know when it changes.
+func (c *Client) UserPresence(userID matrix.UserID) matrix.Presence {
+	c.presence.mu.RLock()
+	defer c.presence.mu.RUnlock()
+
+	return c.presence.users[userID]
+}
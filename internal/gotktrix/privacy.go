@@ -0,0 +1,43 @@
+package gotktrix
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/matrix"
+)
+
+// ErrPrivacyMode is returned by methods that are disabled in privacy mode.
+var ErrPrivacyMode = errors.New("disabled in privacy mode")
+
+// privacyMode is true if the client should avoid leaking information to other
+// servers and users.
+type privacyMode struct {
+	on uint32
+}
+
+// SetPrivacyMode sets whether or not the client is in privacy mode. In privacy
+// mode, the client doesn't ask the homeserver for URL previews or media from
+// other servers, and read receipts are sent privately.
+func (c *Client) SetPrivacyMode(on bool) {
+	var v uint32
+	if on {
+		v = 1
+	}
+	atomic.StoreUint32(&c.privacy.on, v)
+}
+
+// PrivacyMode returns true if the client is in privacy mode.
+func (c *Client) PrivacyMode() bool {
+	return atomic.LoadUint32(&c.privacy.on) == 1
+}
+
+// PreviewURL wraps around gotrix's PreviewURL. It returns ErrPrivacyMode in
+// privacy mode, since the homeserver would have to fetch the URL.
+func (c *Client) PreviewURL(url string, ts matrix.Timestamp) (*api.URLMetadata, error) {
+	if c.PrivacyMode() {
+		return nil, ErrPrivacyMode
+	}
+	return c.Client.PreviewURL(url, ts)
+}
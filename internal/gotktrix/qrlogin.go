@@ -0,0 +1,500 @@
+package gotktrix
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// qrCodePrefix is the prefix of every MSC4108 QR code.
+const qrCodePrefix = "MATRIX"
+
+const (
+	qrCodeVersion = 0x02
+	// qrCodeIntentLogin is the intent of a QR code shown by a new device that
+	// wants to be logged in by an existing device.
+	qrCodeIntentLogin = 0x00
+)
+
+// deviceCodeGrant is the OAuth 2.0 device authorization grant type.
+const deviceCodeGrant = "urn:ietf:params:oauth:grant-type:device_code"
+
+// QRLogin is a login where an existing device signs this device in by scanning
+// a QR code, as described by MSC4108. The homeserver must delegate its
+// authentication to an OAuth 2.0 authorization server (MSC3861).
+type QRLogin struct {
+	a *ClientAuth
+	s *qrLoginState
+}
+
+type qrLoginState struct {
+	oauth   *oauthMetadata
+	key     *ephemeralKey
+	session *rendezvousSession
+	channel *secureChannel
+	// verified is true once the check code of the channel is entered.
+	verified bool
+	done     bool
+}
+
+// qrLoginMessage is a message sent over the secure channel. Only the fields
+// used by this device are listed.
+type qrLoginMessage struct {
+	Type string `json:"type"`
+
+	// m.login.protocols
+	Protocols  []string `json:"protocols,omitempty"`
+	Homeserver string   `json:"homeserver,omitempty"`
+
+	// m.login.protocol
+	Protocol  string          `json:"protocol,omitempty"`
+	DeviceID  string          `json:"device_id,omitempty"`
+	GrantInfo *deviceGrantURI `json:"device_authorization_grant,omitempty"`
+
+	// m.login.failure
+	Reason string `json:"reason,omitempty"`
+}
+
+type deviceGrantURI struct {
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+}
+
+// oauthMetadata is the subset of the OAuth 2.0 authorization server metadata
+// that's needed to log in.
+type oauthMetadata struct {
+	Issuer                      string `json:"issuer"`
+	RegistrationEndpoint        string `json:"registration_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+}
+
+// SupportsQRLogin returns nil if the homeserver supports logging in using a QR
+// code. Otherwise, an error describing why is returned.
+func (a *ClientAuth) SupportsQRLogin() error {
+	var versions struct {
+		UnstableFeatures map[string]bool `json:"unstable_features"`
+	}
+
+	if err := a.c.Request("GET", "_matrix/client/versions", &versions); err != nil {
+		return errors.Wrap(err, "cannot get supported versions")
+	}
+
+	if !versions.UnstableFeatures["org.matrix.msc4108"] {
+		return errors.New("homeserver does not support QR code login")
+	}
+
+	if _, err := a.oauthMetadata(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// oauthMetadata fetches the metadata of the homeserver's authorization server.
+func (a *ClientAuth) oauthMetadata() (*oauthMetadata, error) {
+	var meta oauthMetadata
+
+	err := a.c.Request("GET", "_matrix/client/unstable/org.matrix.msc2965/auth_metadata", &meta)
+	if err != nil {
+		// Older homeservers only tell us the issuer, so we have to go through
+		// OpenID Connect discovery.
+		var issuer struct {
+			Issuer string `json:"issuer"`
+		}
+
+		if err := a.c.Request("GET", "_matrix/client/unstable/org.matrix.msc2965/auth_issuer", &issuer); err != nil {
+			return nil, errors.New("homeserver does not use OAuth 2.0 authentication")
+		}
+
+		discovery := strings.TrimSuffix(issuer.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := a.getJSON(discovery, &meta); err != nil {
+			return nil, errors.Wrap(err, "cannot discover authorization server")
+		}
+	}
+
+	if meta.RegistrationEndpoint == "" || meta.DeviceAuthorizationEndpoint == "" {
+		return nil, errors.New("authorization server does not support device authorization")
+	}
+
+	return &meta, nil
+}
+
+func (a *ClientAuth) getJSON(endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(a.ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.c.ClientDriver.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (a *ClientAuth) postJSON(endpoint string, body, v interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(a.ctx, "POST", endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.c.ClientDriver.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (a *ClientAuth) postForm(endpoint string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(a.ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.c.ClientDriver.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// StartQRLogin starts logging in using a QR code. Close must be called if the
+// login is abandoned.
+func (a *ClientAuth) StartQRLogin() (*QRLogin, error) {
+	meta, err := a.oauthMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := newEphemeralKey()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := newRendezvousSession(a.ctx, &a.c.Client.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QRLogin{
+		a: a,
+		s: &qrLoginState{
+			oauth:   meta,
+			key:     key,
+			session: session,
+		},
+	}, nil
+}
+
+// WithContext creates a copy of QRLogin that uses the provided context. The
+// copy shares the same login progress.
+func (l *QRLogin) WithContext(ctx context.Context) *QRLogin {
+	return &QRLogin{
+		a: l.a.WithContext(ctx),
+		s: l.s,
+	}
+}
+
+// QRCode returns the binary data to be shown as a QR code.
+func (l *QRLogin) QRCode() []byte {
+	var b bytes.Buffer
+	b.WriteString(qrCodePrefix)
+	b.WriteByte(qrCodeVersion)
+	b.WriteByte(qrCodeIntentLogin)
+	b.Write(l.s.key.public[:])
+	binary.Write(&b, binary.BigEndian, uint16(len(l.s.session.url)))
+	b.WriteString(l.s.session.url)
+	return b.Bytes()
+}
+
+// WaitForScan blocks until the other device has scanned the QR code and a
+// secure channel is established. The other device then shows a check code that
+// the user must enter on this device before Login is called.
+func (l *QRLogin) WaitForScan() error {
+	ch, err := acceptSecureChannel(l.a.ctx, l.s.session, l.s.key)
+	if err != nil {
+		return err
+	}
+
+	l.s.channel = ch
+	l.s.verified = false
+	return nil
+}
+
+// VerifyCheckCode returns true if the given check code matches the one shown on
+// the other device. WaitForScan must have returned successfully.
+func (l *QRLogin) VerifyCheckCode(code string) bool {
+	if l.s.channel == nil || strings.TrimSpace(code) != l.s.channel.checkCode {
+		return false
+	}
+
+	l.s.verified = true
+	return true
+}
+
+// Login completes the login once the user approves it on the other device,
+// which opens the authorization server's approval page by itself. An error is
+// returned if VerifyCheckCode hasn't returned true yet.
+func (l *QRLogin) Login() (*Client, error) {
+	if l.s.channel == nil {
+		return nil, errors.New("QR code not scanned yet")
+	}
+
+	// Anyone could've scanned the QR code, so the check code proves that it's
+	// the user's other device on the other end.
+	if !l.s.verified {
+		return nil, errors.New("check code not verified yet")
+	}
+
+	var protocols qrLoginMessage
+	if err := l.receive(&protocols, "m.login.protocols"); err != nil {
+		return nil, err
+	}
+
+	if !containsString(protocols.Protocols, "device_authorization_grant") {
+		l.fail("unsupported_protocol")
+		return nil, errors.New("the other device does not support device authorization")
+	}
+
+	clientID, err := l.registerClient()
+	if err != nil {
+		l.fail("unsupported_protocol")
+		return nil, errors.Wrap(err, "cannot register with authorization server")
+	}
+
+	deviceID := newDeviceID()
+
+	var auth struct {
+		DeviceCode              string `json:"device_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		Interval                int    `json:"interval"`
+	}
+
+	err = l.a.postForm(l.s.oauth.DeviceAuthorizationEndpoint, url.Values{
+		"client_id": {clientID},
+		"scope": {"urn:matrix:org.matrix.msc2967.client:api:* " +
+			"urn:matrix:org.matrix.msc2967.client:device:" + deviceID},
+	}, &auth)
+	if err != nil {
+		l.fail("authorization_expired")
+		return nil, errors.Wrap(err, "cannot start device authorization")
+	}
+
+	err = l.s.channel.send(l.a.ctx, qrLoginMessage{
+		Type:     "m.login.protocol",
+		Protocol: "device_authorization_grant",
+		DeviceID: deviceID,
+		GrantInfo: &deviceGrantURI{
+			VerificationURI:         auth.VerificationURI,
+			VerificationURIComplete: auth.VerificationURIComplete,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var accepted qrLoginMessage
+	if err := l.receive(&accepted, "m.login.protocol_accepted"); err != nil {
+		return nil, err
+	}
+
+	token, err := l.pollToken(clientID, auth.DeviceCode, auth.Interval)
+	if err != nil {
+		l.fail("authorization_expired")
+		return nil, err
+	}
+
+	session := OAuthSession{
+		TokenEndpoint: l.s.oauth.TokenEndpoint,
+		ClientID:      clientID,
+		RefreshToken:  token.RefreshToken,
+		Expiry:        tokenExpiry(token.ExpiresIn),
+	}
+
+	t := useOAuth(l.a.c, token.AccessToken, session)
+
+	client, err := wrapClient(l.a.c, l.a.o)
+	if err != nil {
+		return nil, err
+	}
+	client.oauth = t
+
+	l.s.done = true
+
+	// The other device may send its secrets afterwards, but we have no use
+	// for them, so the session is closed right away.
+	l.s.channel.send(l.a.ctx, qrLoginMessage{Type: "m.login.success", DeviceID: deviceID})
+	l.s.session.close()
+
+	return client, nil
+}
+
+// Close cancels the login. It does nothing if the login has succeeded.
+func (l *QRLogin) Close() {
+	if l.s.done {
+		return
+	}
+	if l.s.channel != nil {
+		l.fail("user_cancelled")
+	}
+	l.s.session.close()
+}
+
+// receive receives the next message and checks that it has the given type.
+func (l *QRLogin) receive(msg *qrLoginMessage, typ string) error {
+	if err := l.s.channel.receive(l.a.ctx, msg); err != nil {
+		return err
+	}
+
+	switch msg.Type {
+	case typ:
+		return nil
+	case "m.login.failure":
+		return fmt.Errorf("the other device cancelled the login: %s", msg.Reason)
+	case "m.login.declined":
+		return errors.New("the login was declined on the other device")
+	default:
+		l.fail("unexpected_message_received")
+		return fmt.Errorf("unexpected message %q from the other device", msg.Type)
+	}
+}
+
+// fail tells the other device that the login failed. Errors are ignored.
+func (l *QRLogin) fail(reason string) {
+	// The login's context may already be cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	l.s.channel.send(ctx, qrLoginMessage{Type: "m.login.failure", Reason: reason})
+}
+
+// registerClient registers gotktrix as a public client with the authorization
+// server and returns the client ID.
+func (l *QRLogin) registerClient() (string, error) {
+	var resp struct {
+		ClientID string `json:"client_id"`
+	}
+
+	err := l.a.postJSON(l.s.oauth.RegistrationEndpoint, map[string]interface{}{
+		"client_name":                deviceName,
+		"client_uri":                 "https://github.com/diamondburned/gotktrix",
+		"application_type":           "native",
+		"grant_types":                []string{deviceCodeGrant, "refresh_token"},
+		"response_types":             []string{},
+		"token_endpoint_auth_method": "none",
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.ClientID == "" {
+		return "", errors.New("no client ID given")
+	}
+
+	return resp.ClientID, nil
+}
+
+// pollToken polls the token endpoint until the user approves the login on the
+// other device.
+func (l *QRLogin) pollToken(clientID, deviceCode string, interval int) (*oauthToken, error) {
+	wait := time.Duration(interval) * time.Second
+	if wait <= 0 {
+		wait = 5 * time.Second
+	}
+
+	rt := http.RoundTripper(DefaultTransport)
+	if driver, ok := l.a.c.ClientDriver.(*http.Client); ok && driver.Transport != nil {
+		rt = driver.Transport
+	}
+
+	for {
+		select {
+		case <-l.a.ctx.Done():
+			return nil, l.a.ctx.Err()
+		case <-time.After(wait):
+		}
+
+		token, err := requestOAuthToken(l.a.ctx, rt, l.s.oauth.TokenEndpoint, url.Values{
+			"grant_type":  {deviceCodeGrant},
+			"device_code": {deviceCode},
+			"client_id":   {clientID},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot get access token")
+		}
+
+		switch token.Error {
+		case "":
+			return token, nil
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			wait += 5 * time.Second
+			continue
+		case "access_denied":
+			return nil, errors.New("the login was declined on the other device")
+		default:
+			return nil, errors.Wrap(token.err(), "cannot get access token")
+		}
+	}
+}
+
+const deviceIDChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// newDeviceID generates a random device ID in the same format as Synapse's.
+func newDeviceID() string {
+	b := make([]byte, 10)
+	rand.Read(b)
+	for i := range b {
+		b[i] = deviceIDChars[int(b[i])%len(deviceIDChars)]
+	}
+	return string(b)
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,398 @@
+package gotktrix
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// LoginTerms is the user-interactive authentication stage that requires the
+// user to accept the homeserver's terms and conditions.
+const LoginTerms matrix.LoginMethod = "m.login.terms"
+
+// supportedRegisterStages lists the user-interactive authentication stages that
+// Registration knows how to handle. Stages not in this list can still be
+// completed using the homeserver's fallback web page.
+var supportedRegisterStages = map[matrix.LoginMethod]bool{
+	matrix.LoginDummy:     true,
+	matrix.LoginEmail:     true,
+	matrix.LoginRecaptcha: true,
+	LoginTerms:            true,
+}
+
+// Registration is an ongoing account registration. It walks through the
+// user-interactive authentication stages that the homeserver requires before
+// an account can be created.
+type Registration struct {
+	a *ClientAuth
+	s *registerState
+}
+
+type registerState struct {
+	body registerBody
+	uiaa registerUIAA
+
+	flow   []matrix.LoginMethod
+	secret string
+	client *Client
+}
+
+type registerBody struct {
+	Auth                     interface{} `json:"auth,omitempty"`
+	Username                 string      `json:"username,omitempty"`
+	Password                 string      `json:"password"`
+	InitialDeviceDisplayName string      `json:"initial_device_display_name"`
+}
+
+type registerUIAA struct {
+	Flows []struct {
+		Stages []matrix.LoginMethod `json:"stages"`
+	} `json:"flows"`
+	Params    map[matrix.LoginMethod]json.RawMessage `json:"params"`
+	Session   string                                 `json:"session"`
+	Completed []matrix.LoginMethod                   `json:"completed"`
+	Error     string                                 `json:"error"`
+}
+
+type registerResponse struct {
+	UserID      matrix.UserID   `json:"user_id"`
+	AccessToken string          `json:"access_token"`
+	DeviceID    matrix.DeviceID `json:"device_id"`
+}
+
+// Register starts registering a new account with the given username and
+// password. The returned Registration must be driven until Done returns true.
+func (a *ClientAuth) Register(username, password string) (*Registration, error) {
+	r := &Registration{
+		a: a,
+		s: &registerState{
+			body: registerBody{
+				Username:                 username,
+				Password:                 password,
+				InitialDeviceDisplayName: deviceName,
+			},
+		},
+	}
+
+	if err := r.auth(nil); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// WithContext creates a copy of Registration that uses the provided context.
+// The copy shares the same registration progress.
+func (r *Registration) WithContext(ctx context.Context) *Registration {
+	return &Registration{
+		a: r.a.WithContext(ctx),
+		s: r.s,
+	}
+}
+
+// auth sends the registration request with the given auth dictionary and
+// updates the registration's state from the response.
+func (r *Registration) auth(auth interface{}) error {
+	r.s.body.Auth = auth
+
+	var raw json.RawMessage
+
+	err := r.a.c.Request(
+		"POST", r.a.c.Endpoints.Register(), &raw,
+		httputil.WithJSONBody(r.s.body),
+		httputil.WithQuery(map[string]string{"kind": "user"}),
+	)
+	if err != nil {
+		if matrix.StatusCode(err) != http.StatusUnauthorized {
+			return errors.Wrap(err, "cannot register")
+		}
+
+		var uiaa registerUIAA
+		if err := json.Unmarshal(raw, &uiaa); err != nil {
+			return errors.Wrap(err, "cannot decode registration flows")
+		}
+
+		// A 401 without any flows is a genuine error, such as a wrong
+		// response to a stage.
+		if len(uiaa.Flows) == 0 {
+			return errors.Wrap(err, "cannot register")
+		}
+
+		r.s.uiaa = uiaa
+		r.chooseFlow()
+
+		// The homeserver still sends the flows when a stage fails, along with
+		// the reason why.
+		if uiaa.Error != "" {
+			return errors.New(uiaa.Error)
+		}
+
+		return nil
+	}
+
+	var resp registerResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return errors.Wrap(err, "cannot decode registration response")
+	}
+
+	r.a.c.UserID = resp.UserID
+	r.a.c.AccessToken = resp.AccessToken
+	r.a.c.DeviceID = resp.DeviceID
+
+	c, err := wrapClient(r.a.c, r.a.o)
+	if err != nil {
+		return err
+	}
+
+	r.s.client = c
+	return nil
+}
+
+// chooseFlow picks the flow that is the easiest to complete: flows that only
+// have stages that we know how to handle are preferred, and shorter flows are
+// preferred over longer ones.
+func (r *Registration) chooseFlow() {
+	if r.s.flow != nil && r.flowAvailable(r.s.flow) {
+		return
+	}
+
+	r.s.flow = nil
+	bestScore := -1
+
+	for _, flow := range r.s.uiaa.Flows {
+		score := 1000 - len(flow.Stages)
+		for _, stage := range flow.Stages {
+			if !supportedRegisterStages[stage] {
+				score -= 100
+			}
+		}
+
+		if score > bestScore {
+			r.s.flow = flow.Stages
+			bestScore = score
+		}
+	}
+}
+
+func (r *Registration) flowAvailable(stages []matrix.LoginMethod) bool {
+	for _, flow := range r.s.uiaa.Flows {
+		if stagesEqual(flow.Stages, stages) {
+			return true
+		}
+	}
+	return false
+}
+
+func stagesEqual(a, b []matrix.LoginMethod) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Done returns true if the account has been registered.
+func (r *Registration) Done() bool {
+	return r.s.client != nil
+}
+
+// Client returns the client of the newly registered account. It returns nil if
+// the registration isn't done yet.
+func (r *Registration) Client() *Client {
+	return r.s.client
+}
+
+// NextStage returns the next stage that has to be completed. An empty string
+// is returned if there are no stages left.
+func (r *Registration) NextStage() matrix.LoginMethod {
+	for _, stage := range r.s.flow {
+		if !r.isCompleted(stage) {
+			return stage
+		}
+	}
+	return ""
+}
+
+func (r *Registration) isCompleted(stage matrix.LoginMethod) bool {
+	for _, completed := range r.s.uiaa.Completed {
+		if completed == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// Finish completes the registration if all stages are completed. This is only
+// needed when the homeserver didn't register the account after the last stage.
+func (r *Registration) Finish() error {
+	return r.auth(map[string]string{"session": r.s.uiaa.Session})
+}
+
+// AuthDummy completes the dummy stage, which requires no user input.
+func (r *Registration) AuthDummy() error {
+	return r.auth(map[string]string{
+		"type":    string(matrix.LoginDummy),
+		"session": r.s.uiaa.Session,
+	})
+}
+
+// Policy is a document, such as the terms of service or the privacy policy,
+// that the user must accept before registering.
+type Policy struct {
+	Name string
+	URL  string
+}
+
+// Terms returns the policies that the user must accept during the terms stage.
+// The names and URLs of the given languages are preferred if available.
+func (r *Registration) Terms(langs ...string) []Policy {
+	var params struct {
+		Policies map[string]map[string]json.RawMessage `json:"policies"`
+	}
+
+	if err := json.Unmarshal(r.s.uiaa.Params[LoginTerms], &params); err != nil {
+		return nil
+	}
+
+	type translation struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+	}
+
+	policies := make([]Policy, 0, len(params.Policies))
+
+	for id, policy := range params.Policies {
+		translations := make(map[string]translation, len(policy))
+		for key, raw := range policy {
+			var t translation
+			if key != "version" && json.Unmarshal(raw, &t) == nil && t.URL != "" {
+				translations[key] = t
+			}
+		}
+
+		if len(translations) == 0 {
+			continue
+		}
+
+		var chosen *translation
+		for _, lang := range append(langs, "en") {
+			if t, ok := translations[lang]; ok {
+				chosen = &t
+				break
+			}
+		}
+		if chosen == nil {
+			for _, t := range translations {
+				t := t
+				chosen = &t
+				break
+			}
+		}
+
+		name := chosen.Name
+		if name == "" {
+			name = id
+		}
+
+		policies = append(policies, Policy{Name: name, URL: chosen.URL})
+	}
+
+	return policies
+}
+
+// AuthTerms completes the terms stage. It must only be called once the user has
+// accepted all the policies returned by Terms.
+func (r *Registration) AuthTerms() error {
+	return r.auth(map[string]string{
+		"type":    string(LoginTerms),
+		"session": r.s.uiaa.Session,
+	})
+}
+
+// RequestEmailToken asks the homeserver to send a verification email to the
+// given address. The returned session ID must be given to AuthEmail once the
+// user has clicked the link in the email.
+func (r *Registration) RequestEmailToken(email string, attempt int) (string, error) {
+	if r.s.secret == "" {
+		secret, err := newClientSecret()
+		if err != nil {
+			return "", err
+		}
+		r.s.secret = secret
+	}
+
+	var resp struct {
+		SID string `json:"sid"`
+	}
+
+	err := r.a.c.Request(
+		"POST", r.a.c.Endpoints.RegisterRequestToken("email"), &resp,
+		httputil.WithJSONBody(map[string]interface{}{
+			"client_secret": r.s.secret,
+			"email":         email,
+			"send_attempt":  attempt,
+		}),
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot request email verification")
+	}
+
+	return resp.SID, nil
+}
+
+// AuthEmail completes the email stage using the session ID returned by
+// RequestEmailToken.
+func (r *Registration) AuthEmail(sid string) error {
+	return r.auth(map[string]interface{}{
+		"type":    string(matrix.LoginEmail),
+		"session": r.s.uiaa.Session,
+		"threepid_creds": map[string]string{
+			"sid":           sid,
+			"client_secret": r.s.secret,
+		},
+	})
+}
+
+// FallbackURL returns the URL to the homeserver's web page that completes the
+// given stage. This is used for stages that can't be done natively, such as
+// reCAPTCHA. Once the user is done with the page, AuthFallback must be called.
+func (r *Registration) FallbackURL(stage matrix.LoginMethod) string {
+	return r.a.c.FullRoute(r.a.c.Endpoints.Base() +
+		"/auth/" + url.PathEscape(string(stage)) + "/fallback/web" +
+		"?session=" + url.QueryEscape(r.s.uiaa.Session))
+}
+
+// AuthFallback continues the registration after a stage has been completed
+// using FallbackURL.
+func (r *Registration) AuthFallback() error {
+	stage := r.NextStage()
+
+	if err := r.Finish(); err != nil {
+		return err
+	}
+
+	if !r.Done() && r.NextStage() == stage {
+		return errors.New("the previous step has not been completed yet")
+	}
+
+	return nil
+}
+
+func newClientSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "cannot generate client secret")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
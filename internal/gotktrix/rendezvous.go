@@ -0,0 +1,377 @@
+package gotktrix
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ErrRendezvousExpired is returned if the rendezvous session has expired or was
+// closed by the other device.
+var ErrRendezvousExpired = errors.New("the QR code has expired")
+
+// rendezvousPollInterval is how often the rendezvous session is polled for new
+// messages.
+const rendezvousPollInterval = time.Second
+
+// rendezvousSession is an MSC4108 rendezvous session, which is a mailbox on the
+// homeserver that two devices use to exchange messages. Each message replaces
+// the previous one.
+type rendezvousSession struct {
+	driver httputil.ClientDriver
+	url    string
+	etag   string
+}
+
+// newRendezvousSession creates a new rendezvous session on the homeserver.
+func newRendezvousSession(ctx context.Context, c *httputil.Client) (*rendezvousSession, error) {
+	route := c.FullRoute("_matrix/client/unstable/org.matrix.msc4108/rendezvous")
+
+	req, err := http.NewRequestWithContext(ctx, "POST", route, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	resp, err := c.ClientDriver.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create rendezvous session")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot create rendezvous session: unexpected status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		URL string `json:"url"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	if body.URL == "" {
+		// Older revisions of the proposal return the URL as a header.
+		location, err := resp.Location()
+		if err != nil {
+			return nil, errors.New("rendezvous session has no URL")
+		}
+		body.URL = location.String()
+	}
+
+	return &rendezvousSession{
+		driver: c.ClientDriver,
+		url:    body.URL,
+		etag:   resp.Header.Get("ETag"),
+	}, nil
+}
+
+// send replaces the message in the session.
+func (s *rendezvousSession) send(ctx context.Context, data string) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", s.url, strings.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	if s.etag != "" {
+		req.Header.Set("If-Match", s.etag)
+	}
+
+	resp, err := s.driver.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "cannot send to rendezvous session")
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		s.etag = resp.Header.Get("ETag")
+		return nil
+	case http.StatusNotFound:
+		return ErrRendezvousExpired
+	default:
+		return fmt.Errorf("cannot send to rendezvous session: unexpected status %d", resp.StatusCode)
+	}
+}
+
+// receive waits until the other device replaces the message in the session
+// and returns it.
+func (s *rendezvousSession) receive(ctx context.Context) (string, error) {
+	for {
+		data, ok, err := s.poll(ctx)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return data, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(rendezvousPollInterval):
+		}
+	}
+}
+
+func (s *rendezvousSession) poll(ctx context.Context) (string, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url, nil)
+	if err != nil {
+		return "", false, err
+	}
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+
+	resp, err := s.driver.Do(req)
+	if err != nil {
+		return "", false, errors.Wrap(err, "cannot poll rendezvous session")
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return "", false, nil
+	case http.StatusNotFound:
+		return "", false, ErrRendezvousExpired
+	case http.StatusOK:
+		// ok
+	default:
+		return "", false, fmt.Errorf("cannot poll rendezvous session: unexpected status %d", resp.StatusCode)
+	}
+
+	etag := resp.Header.Get("ETag")
+	if etag != "" && etag == s.etag {
+		return "", false, nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, errors.Wrap(err, "cannot read rendezvous message")
+	}
+
+	s.etag = etag
+
+	// The session starts out empty.
+	if len(b) == 0 {
+		return "", false, nil
+	}
+
+	return string(b), true, nil
+}
+
+// close deletes the session. Errors are ignored, since the session expires on
+// its own anyway.
+func (s *rendezvousSession) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", s.url, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := s.driver.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
+
+// Messages exchanged while establishing the secure channel.
+const (
+	qrLoginInitiate = "MATRIX_QR_CODE_LOGIN_INITIATE"
+	qrLoginOK       = "MATRIX_QR_CODE_LOGIN_OK"
+)
+
+// ephemeralKey is a Curve25519 key pair that is only used for a single login.
+type ephemeralKey struct {
+	private [32]byte
+	public  [32]byte
+}
+
+func newEphemeralKey() (*ephemeralKey, error) {
+	var k ephemeralKey
+	if _, err := io.ReadFull(rand.Reader, k.private[:]); err != nil {
+		return nil, errors.Wrap(err, "cannot generate key")
+	}
+
+	public, err := curve25519.X25519(k.private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot derive public key")
+	}
+	copy(k.public[:], public)
+
+	return &k, nil
+}
+
+// secureChannel is the end-to-end encrypted channel established over a
+// rendezvous session. This device is always the one that generated the QR
+// code, so the other device initiates the channel.
+type secureChannel struct {
+	session *rendezvousSession
+
+	enc      cipher.AEAD
+	dec      cipher.AEAD
+	encNonce uint64
+	decNonce uint64
+
+	checkCode string
+}
+
+// acceptSecureChannel waits for the device that scanned the QR code to
+// initiate a secure channel, then confirms it.
+func acceptSecureChannel(ctx context.Context, session *rendezvousSession, key *ephemeralKey) (*secureChannel, error) {
+	initiate, err := session.receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(initiate, "="))
+	if err != nil || len(raw) <= 32 {
+		return nil, errors.New("invalid secure channel initiation")
+	}
+
+	// The initiate message is the ciphertext followed by the other device's
+	// public key.
+	ciphertext := raw[:len(raw)-32]
+	theirKey := raw[len(raw)-32:]
+
+	keys, err := deriveSecureChannelKeys(key, theirKey)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := chacha20poly1305.New(keys.enc)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := chacha20poly1305.New(keys.dec)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := &secureChannel{
+		session:   session,
+		enc:       enc,
+		dec:       dec,
+		checkCode: keys.checkCode,
+	}
+
+	plaintext, err := ch.open(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if string(plaintext) != qrLoginInitiate {
+		return nil, errors.New("unexpected secure channel initiation")
+	}
+
+	if err := ch.session.send(ctx, ch.seal([]byte(qrLoginOK))); err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// secureChannelKeys are the keys of a secure channel, which are derived from
+// the two ephemeral keys.
+type secureChannelKeys struct {
+	enc       []byte
+	dec       []byte
+	checkCode string
+}
+
+// deriveSecureChannelKeys derives the keys of the secure channel between our
+// key and the other device's public key.
+func deriveSecureChannelKeys(key *ephemeralKey, theirKey []byte) (*secureChannelKeys, error) {
+	shared, err := curve25519.X25519(key.private[:], theirKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot compute shared secret")
+	}
+
+	ourB64 := base64.RawStdEncoding.EncodeToString(key.public[:])
+	theirB64 := base64.RawStdEncoding.EncodeToString(theirKey)
+
+	derive := func(name string, n int) []byte {
+		info := name + "|" + ourB64 + "|" + theirB64
+		out := make([]byte, n)
+		io.ReadFull(hkdf.New(sha512.New, shared, nil, []byte(info)), out)
+		return out
+	}
+
+	check := derive("MATRIX_QR_CODE_LOGIN_CHECKCODE", 2)
+
+	return &secureChannelKeys{
+		enc:       derive("MATRIX_QR_CODE_LOGIN_ENCKEY_G", chacha20poly1305.KeySize),
+		dec:       derive("MATRIX_QR_CODE_LOGIN_ENCKEY_S", chacha20poly1305.KeySize),
+		checkCode: fmt.Sprintf("%d%d", check[0]%10, check[1]%10),
+	}, nil
+}
+
+func nonce(counter uint64) []byte {
+	n := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(n, counter)
+	return n
+}
+
+func (ch *secureChannel) seal(plaintext []byte) string {
+	ciphertext := ch.enc.Seal(nil, nonce(ch.encNonce), plaintext, nil)
+	ch.encNonce++
+	return base64.RawStdEncoding.EncodeToString(ciphertext)
+}
+
+func (ch *secureChannel) open(ciphertext []byte) ([]byte, error) {
+	plaintext, err := ch.dec.Open(nil, nonce(ch.decNonce), ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("cannot decrypt message from the other device")
+	}
+	ch.decNonce++
+	return plaintext, nil
+}
+
+// send encrypts the given value as JSON and sends it to the other device.
+func (ch *secureChannel) send(ctx context.Context, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ch.session.send(ctx, ch.seal(b))
+}
+
+// receive waits for the next message from the other device and decodes it into
+// the given value.
+func (ch *secureChannel) receive(ctx context.Context, v interface{}) error {
+	msg, err := ch.session.receive(ctx)
+	if err != nil {
+		return err
+	}
+
+	ciphertext, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(msg, "="))
+	if err != nil {
+		return errors.Wrap(err, "invalid message from the other device")
+	}
+
+	plaintext, err := ch.open(ciphertext)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(plaintext, v); err != nil {
+		return errors.Wrap(err, "invalid message from the other device")
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package gotktrix
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal("invalid hex:", err)
+	}
+	return b
+}
+
+// rfc7748Keys returns the Curve25519 key pairs of Alice and Bob from section
+// 6.1 of RFC 7748. Alice is the device that shows the QR code.
+func rfc7748Keys(t *testing.T) (alice *ephemeralKey, bobPublic []byte) {
+	t.Helper()
+
+	alice = &ephemeralKey{}
+	copy(alice.private[:], mustDecodeHex(t, "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a"))
+	copy(alice.public[:], mustDecodeHex(t, "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a"))
+
+	bobPublic = mustDecodeHex(t, "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f")
+	return
+}
+
+func TestDeriveSecureChannelKeys(t *testing.T) {
+	alice, bob := rfc7748Keys(t)
+
+	// HKDF-SHA512 of the RFC 7748 shared secret with the info strings
+	// "<name>|<Alice's base64 key>|<Bob's base64 key>", computed separately
+	// with Python's hmac module.
+	const (
+		encKey    = "2c5ac905f420d1cb1e63e52462a929eb1f1c98187bdfc97059a92694b6075566"
+		decKey    = "37a44244ac8009127afe28d28beea1e6124cc7b55b9b7056107add018b895b70"
+		checkCode = "85" // from the bytes 0x80 0x05
+	)
+
+	keys, err := deriveSecureChannelKeys(alice, bob)
+	if err != nil {
+		t.Fatal("cannot derive keys:", err)
+	}
+
+	if got := hex.EncodeToString(keys.enc); got != encKey {
+		t.Errorf("encryption key mismatch:\n-> %s\n<- %s", encKey, got)
+	}
+	if got := hex.EncodeToString(keys.dec); got != decKey {
+		t.Errorf("decryption key mismatch:\n-> %s\n<- %s", decKey, got)
+	}
+	if keys.checkCode != checkCode {
+		t.Errorf("check code mismatch:\n-> %s\n<- %s", checkCode, keys.checkCode)
+	}
+}
+
+func TestDeriveSecureChannelKeysLowOrder(t *testing.T) {
+	alice, _ := rfc7748Keys(t)
+
+	// An all-zero public key gives an all-zero shared secret, which must be
+	// refused.
+	if _, err := deriveSecureChannelKeys(alice, make([]byte, 32)); err == nil {
+		t.Fatal("low order public key was accepted")
+	}
+}
+
+func TestSecureChannelNonces(t *testing.T) {
+	alice, bob := rfc7748Keys(t)
+
+	keys, err := deriveSecureChannelKeys(alice, bob)
+	if err != nil {
+		t.Fatal("cannot derive keys:", err)
+	}
+
+	enc, _ := chacha20poly1305.New(keys.enc)
+	dec, _ := chacha20poly1305.New(keys.dec)
+	ch := &secureChannel{enc: enc, dec: dec}
+
+	// The other device encrypts with our decryption key, counting its own
+	// nonces from zero.
+	theirEnc, _ := chacha20poly1305.New(keys.dec)
+	theirDec, _ := chacha20poly1305.New(keys.enc)
+
+	initiate := theirEnc.Seal(nil, nonce(0), []byte(qrLoginInitiate), nil)
+
+	plaintext, err := ch.open(initiate)
+	if err != nil {
+		t.Fatal("cannot open initiate message:", err)
+	}
+	if string(plaintext) != qrLoginInitiate {
+		t.Fatalf("unexpected initiate message %q", plaintext)
+	}
+
+	// The same message can't be opened twice, since the nonce moved on.
+	if _, err := ch.open(initiate); err == nil {
+		t.Fatal("replayed message was opened")
+	}
+
+	for i := uint64(0); i < 3; i++ {
+		sealed, err := base64.RawStdEncoding.DecodeString(ch.seal([]byte(qrLoginOK)))
+		if err != nil {
+			t.Fatal("sealed message isn't base64:", err)
+		}
+
+		if _, err := theirDec.Open(nil, nonce(i), sealed, nil); err != nil {
+			t.Fatalf("message %d doesn't use nonce %d: %v", i, i, err)
+		}
+	}
+}
+
+func TestNonce(t *testing.T) {
+	expect := "0201000000000000" + "00000000"
+	if got := hex.EncodeToString(nonce(0x0102)); got != expect {
+		t.Fatalf("nonce mismatch:\n-> %s\n<- %s", expect, got)
+	}
+}
+
+func TestQRLoginCheckCode(t *testing.T) {
+	l := &QRLogin{s: &qrLoginState{channel: &secureChannel{checkCode: "85"}}}
+
+	if _, err := l.Login(); err == nil {
+		t.Fatal("login went ahead without the check code")
+	}
+
+	if l.VerifyCheckCode("58") {
+		t.Fatal("wrong check code was accepted")
+	}
+	if _, err := l.Login(); err == nil {
+		t.Fatal("login went ahead after a wrong check code")
+	}
+
+	if !l.VerifyCheckCode(" 85\n") {
+		t.Fatal("check code was rejected")
+	}
+	if !l.s.verified {
+		t.Fatal("check code isn't recorded as verified")
+	}
+}
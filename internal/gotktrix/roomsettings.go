@@ -0,0 +1,139 @@
+package gotktrix
+
+import (
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// RoomSettings is the part of a room's state that its settings dialog edits.
+type RoomSettings struct {
+	Name              string
+	Topic             string
+	Avatar            matrix.URL
+	Alias             string
+	JoinRule          event.JoinRule
+	HistoryVisibility event.HistoryVisibility
+}
+
+// RoomSettings returns the current settings of the room. Settings that the room
+// has no state event for are left empty, except for the join rule and history
+// visibility, which are given their defaults.
+func (c *Client) RoomSettings(roomID matrix.RoomID) RoomSettings {
+	s := RoomSettings{
+		JoinRule:          event.JoinInvite,
+		HistoryVisibility: event.VisibilityShared,
+	}
+
+	if e, err := c.RoomState(roomID, event.TypeRoomName, ""); err == nil {
+		s.Name = e.(*event.RoomNameEvent).Name
+	}
+	if e, err := c.RoomState(roomID, event.TypeRoomTopic, ""); err == nil {
+		s.Topic = e.(*event.RoomTopicEvent).Topic
+	}
+	if e, err := c.RoomState(roomID, event.TypeRoomAvatar, ""); err == nil {
+		s.Avatar = e.(*event.RoomAvatarEvent).URL
+	}
+	if e, err := c.RoomState(roomID, event.TypeRoomJoinRules, ""); err == nil {
+		s.JoinRule = e.(*event.RoomJoinRulesEvent).JoinRule
+	}
+	if e, err := c.RoomState(roomID, event.TypeRoomHistoryVisibility, ""); err == nil {
+		s.HistoryVisibility = e.(*event.RoomHistoryVisibilityEvent).Visibility
+	}
+
+	s.Alias = c.RoomCanonicalAlias(roomID)
+	return s
+}
+
+// UpdateRoomSettings sends the state events for the settings that differ
+// between from and to. If the new canonical alias doesn't exist yet, then it's
+// created first, since the homeserver only accepts aliases that point to the
+// room.
+func (c *Client) UpdateRoomSettings(roomID matrix.RoomID, from, to RoomSettings) error {
+	send := func(typ event.Type, content interface{}) error {
+		_, err := c.RoomStateSend(roomID, api.RoomStateSendArg{
+			Type:    typ,
+			Content: content,
+		})
+		return err
+	}
+
+	if from.Name != to.Name {
+		if err := send(event.TypeRoomName, event.RoomNameEvent{Name: to.Name}); err != nil {
+			return errors.Wrap(err, "failed to change the room name")
+		}
+	}
+
+	if from.Topic != to.Topic {
+		if err := send(event.TypeRoomTopic, event.RoomTopicEvent{Topic: to.Topic}); err != nil {
+			return errors.Wrap(err, "failed to change the topic")
+		}
+	}
+
+	if from.Avatar != to.Avatar {
+		var content interface{} = event.RoomAvatarEvent{URL: to.Avatar}
+		if to.Avatar == "" {
+			// An avatar event without a URL removes the avatar.
+			content = struct{}{}
+		}
+		if err := send(event.TypeRoomAvatar, content); err != nil {
+			return errors.Wrap(err, "failed to change the room avatar")
+		}
+	}
+
+	if from.Alias != to.Alias {
+		if err := c.setCanonicalAlias(roomID, to.Alias); err != nil {
+			return err
+		}
+	}
+
+	if from.JoinRule != to.JoinRule {
+		ev := event.RoomJoinRulesEvent{JoinRule: to.JoinRule}
+		if err := send(event.TypeRoomJoinRules, ev); err != nil {
+			return errors.Wrap(err, "failed to change who can join")
+		}
+	}
+
+	if from.HistoryVisibility != to.HistoryVisibility {
+		ev := event.RoomHistoryVisibilityEvent{Visibility: to.HistoryVisibility}
+		if err := send(event.TypeRoomHistoryVisibility, ev); err != nil {
+			return errors.Wrap(err, "failed to change who can read the history")
+		}
+	}
+
+	return nil
+}
+
+// setCanonicalAlias sets the canonical alias of the room while keeping its
+// alternative aliases.
+func (c *Client) setCanonicalAlias(roomID matrix.RoomID, alias string) error {
+	var ev event.RoomCanonicalAliasEvent
+	if e, err := c.RoomState(roomID, event.TypeRoomCanonicalAlias, ""); err == nil {
+		ev = *e.(*event.RoomCanonicalAliasEvent)
+	}
+
+	if alias != "" {
+		resp, err := c.Client.RoomAlias(alias)
+		switch {
+		case err != nil:
+			if err := c.Client.RoomAliasCreate(alias, roomID); err != nil {
+				return errors.Wrap(err, "failed to create the room address")
+			}
+		case resp.RoomID != roomID:
+			return errors.New("the address is already used by another room")
+		}
+	}
+
+	ev.Alias = alias
+
+	_, err := c.RoomStateSend(roomID, api.RoomStateSendArg{
+		Type:    event.TypeRoomCanonicalAlias,
+		Content: ev,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to change the room address")
+	}
+
+	return nil
+}
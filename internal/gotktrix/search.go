@@ -0,0 +1,219 @@
+package gotktrix
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/sys"
+	"github.com/diamondburned/gotktrix/internal/gotktrix/internal/state"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// searchLimit is the maximum number of messages that are searched locally at
+// once.
+const searchLimit = 25
+
+// SearchResult is a message that matches a search.
+type SearchResult struct {
+	RoomID  matrix.RoomID
+	EventID matrix.EventID
+	Sender  matrix.UserID
+	Body    string
+	Time    matrix.Timestamp
+}
+
+// SearchResults is a page of search results.
+type SearchResults struct {
+	Results []SearchResult
+	// NextBatch is used to get the next page of results. It is empty if there
+	// are no more results.
+	NextBatch string
+}
+
+// SearchMessages searches the bodies of the messages for the given term, newest
+// first. If roomID is not empty, then only messages in that room are searched.
+//
+// The homeserver can't search encrypted messages, so those are searched in the
+// local index instead, which only has the messages that this device has
+// decrypted. Local results are only included in the first page.
+func (c *Client) SearchMessages(term string, roomID matrix.RoomID, nextBatch string) (SearchResults, error) {
+	var filter struct {
+		Rooms []matrix.RoomID `json:"rooms,omitempty"`
+	}
+	if roomID != "" {
+		filter.Rooms = []matrix.RoomID{roomID}
+	}
+
+	var query map[string]string
+	if nextBatch != "" {
+		query = map[string]string{"next_batch": nextBatch}
+	}
+
+	var resp struct {
+		SearchCategories struct {
+			RoomEvents struct {
+				Results []struct {
+					Result json.RawMessage `json:"result"`
+				} `json:"results"`
+				NextBatch string `json:"next_batch"`
+			} `json:"room_events"`
+		} `json:"search_categories"`
+	}
+
+	err := c.Request(
+		"POST", c.Endpoints.Base()+"/search", &resp,
+		httputil.WithToken(), httputil.WithQuery(query),
+		httputil.WithJSONBody(map[string]interface{}{
+			"search_categories": map[string]interface{}{
+				"room_events": map[string]interface{}{
+					"search_term": term,
+					"keys":        []string{"content.body"},
+					"order_by":    "recent",
+					"filter":      filter,
+				},
+			},
+		}),
+	)
+	if err != nil {
+		return SearchResults{}, errors.Wrap(err, "failed to search messages")
+	}
+
+	events := resp.SearchCategories.RoomEvents
+
+	results := SearchResults{
+		Results:   make([]SearchResult, 0, len(events.Results)),
+		NextBatch: events.NextBatch,
+	}
+
+	for _, result := range events.Results {
+		var info struct {
+			RoomID matrix.RoomID `json:"room_id"`
+		}
+		if err := json.Unmarshal(result.Result, &info); err != nil {
+			continue
+		}
+
+		msg, ok := sys.ParseTimeline(result.Result, info.RoomID).(*event.RoomMessageEvent)
+		if ok {
+			results.Results = append(results.Results, searchResult(msg))
+		}
+	}
+
+	if nextBatch == "" {
+		results.Results = append(results.Results, c.searchLocalMessages(term, roomID)...)
+		sort.SliceStable(results.Results, func(i, j int) bool {
+			return results.Results[i].Time > results.Results[j].Time
+		})
+	}
+
+	return results, nil
+}
+
+func searchResult(msg *event.RoomMessageEvent) SearchResult {
+	return SearchResult{
+		RoomID:  msg.RoomID,
+		EventID: msg.ID,
+		Sender:  msg.Sender,
+		Body:    msg.Body,
+		Time:    msg.OriginServerTime,
+	}
+}
+
+// searchLocalMessages searches the decrypted messages in the local index.
+func (c *Client) searchLocalMessages(term string, roomID matrix.RoomID) []SearchResult {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	messages := c.Index.SearchMessages(ctx, term, roomID, searchLimit)
+	results := make([]SearchResult, len(messages))
+
+	for i, msg := range messages {
+		results[i] = SearchResult{
+			RoomID:  msg.Room,
+			EventID: msg.ID,
+			Sender:  msg.Sender,
+			Body:    msg.Body,
+			Time:    msg.Time,
+		}
+	}
+
+	return results
+}
+
+// indexMessages indexes the messages of the given raw events if the room is
+// encrypted, since the homeserver can't search them. The events must already
+// be decrypted.
+func (c *Client) indexMessages(roomID matrix.RoomID, raws []event.RawEvent) {
+	if len(raws) == 0 || !c.IsRoomEncrypted(roomID) {
+		return
+	}
+
+	b := c.Index.Begin()
+
+	for _, raw := range raws {
+		if state.GuessType(raw) != event.TypeRoomMessage {
+			continue
+		}
+
+		msg, ok := sys.ParseTimeline(raw, roomID).(*event.RoomMessageEvent)
+		if ok && msg.Body != "" {
+			b.IndexMessage(msg)
+		}
+	}
+
+	b.Commit()
+}
+
+// RoomEventContext fetches the event along with up to limit events around it
+// from the homeserver, oldest first.
+func (c *Client) RoomEventContext(
+	roomID matrix.RoomID, eventID matrix.EventID, limit int) ([]event.RoomEvent, error) {
+
+	route := c.Endpoints.Room(roomID) + "/context/" + url.PathEscape(string(eventID))
+
+	var resp struct {
+		EventsBefore []event.RawEvent `json:"events_before"`
+		Event        event.RawEvent   `json:"event"`
+		EventsAfter  []event.RawEvent `json:"events_after"`
+	}
+
+	err := c.Request(
+		"GET", route, &resp,
+		httputil.WithToken(),
+		httputil.WithQuery(map[string]string{"limit": strconv.Itoa(limit)}),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get event context")
+	}
+
+	// The events before are newest first.
+	raws := make([]event.RawEvent, 0, len(resp.EventsBefore)+1+len(resp.EventsAfter))
+	for i := len(resp.EventsBefore) - 1; i >= 0; i-- {
+		raws = append(raws, resp.EventsBefore[i])
+	}
+	if resp.Event != nil {
+		raws = append(raws, resp.Event)
+	}
+	raws = append(raws, resp.EventsAfter...)
+
+	c.crypto.DecryptEvents(roomID, raws)
+	c.indexMessages(roomID, raws)
+
+	return sys.ParseAllTimeline(raws, roomID), nil
+}
+
+// indexSync indexes the decrypted messages of the joined rooms in the sync.
+func (c *Client) indexSync(sync *api.SyncResponse) {
+	for roomID, room := range sync.Rooms.Joined {
+		c.indexMessages(roomID, room.Timeline.Events)
+	}
+}
@@ -0,0 +1,79 @@
+package gotktrix
+
+import (
+	"context"
+	"log"
+
+	"github.com/pkg/errors"
+)
+
+// Background runs f in a goroutine with a client whose requests aren't
+// cancelled when the application quits. It is meant for work that the user
+// expects to be finished, such as sending a message, since Shutdown waits for f
+// to return before closing the databases.
+func (c *Client) Background(f func(*Client)) {
+	c.background.Add(1)
+	go func() {
+		defer c.background.Done()
+		f(c.WithContext(context.Background()))
+	}()
+}
+
+// Shutdown shuts the client down gracefully. It stops the sync loop, waits for
+// the work started with Background to finish so that messages being sent and
+// their state writes aren't lost, then closes the internal databases.
+//
+// If ctx expires before the background work is done, then the databases are
+// closed anyway, and whatever is still running will fail to write.
+func (c *Client) Shutdown(ctx context.Context) error {
+	// The rest of the outbox is sent next time.
+	c.outbox.close()
+
+	// Stopping the sync loop waits for the ongoing sync to be written to the
+	// state.
+	if err := c.Client.Close(); err != nil {
+		return errors.Wrap(err, "failed to stop sync loop")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("gave up waiting for background work:", ctx.Err())
+	}
+
+	return c.closeDatabases()
+}
+
+// CloseUnopened closes the internal databases of a client that was never opened
+// using Open, such as one that only sends a few requests. Shutdown must not be
+// used for such a client, since there's no sync loop to stop.
+func (c *Client) CloseUnopened() error {
+	c.outbox.close()
+	return c.closeDatabases()
+}
+
+// closeDatabases closes the state, the index and the crypto db. Closing the
+// state waits for ongoing transactions, so it never leaves the database
+// half-written.
+func (c *Client) closeDatabases() error {
+	err1 := c.State.Close()
+	err2 := c.Index.Close()
+	err3 := c.crypto.Close()
+
+	if err1 != nil {
+		return errors.Wrap(err1, "failed to close state")
+	}
+	if err2 != nil {
+		return errors.Wrap(err2, "failed to close index")
+	}
+	if err3 != nil {
+		return errors.Wrap(err3, "failed to close crypto db")
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package gotktrix
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/m"
+	"github.com/diamondburned/gotrix/api"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// SpaceChildren returns the rooms that the space lists as its children, sorted
+// the way the space wants them to be shown. Children with an order come first,
+// followed by the rest from oldest to newest.
+func (c *Client) SpaceChildren(spaceID matrix.RoomID) ([]m.SpaceChildEvent, error) {
+	var children []m.SpaceChildEvent
+
+	err := c.EachRoomStateLen(spaceID, m.SpaceChildEventType,
+		func(ev event.StateEvent, _ int) error {
+			child := ev.(*m.SpaceChildEvent)
+			// A child without any via servers has been removed.
+			if len(child.Via) > 0 {
+				children = append(children, *child)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get space children")
+	}
+
+	sort.SliceStable(children, func(i, j int) bool {
+		ci, cj := children[i], children[j]
+		switch {
+		case ci.Order != "" && cj.Order != "":
+			if ci.Order != cj.Order {
+				return ci.Order < cj.Order
+			}
+		case ci.Order != "":
+			return true
+		case cj.Order != "":
+			return false
+		}
+		if ci.OriginServerTime != cj.OriginServerTime {
+			return ci.OriginServerTime < cj.OriginServerTime
+		}
+		return ci.ChildRoomID() < cj.ChildRoomID()
+	})
+
+	return children, nil
+}
+
+// CanManageSpace returns true if the user can change the rooms in the space.
+func (c *Client) CanManageSpace(spaceID matrix.RoomID) bool {
+	return c.CanSendEvent(spaceID, m.SpaceChildEventType, true)
+}
+
+// SetSpaceChild updates the child in the space, which is the room in its state
+// key.
+func (c *Client) SetSpaceChild(spaceID matrix.RoomID, child m.SpaceChildEvent) error {
+	_, err := c.RoomStateSend(spaceID, api.RoomStateSendArg{
+		Type:     m.SpaceChildEventType,
+		StateKey: string(child.ChildRoomID()),
+		Content:  child,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to update space child")
+	}
+	return nil
+}
+
+// AddSpaceChild adds the room into the space. The room is also marked as being
+// in the space if the user can change its state.
+func (c *Client) AddSpaceChild(spaceID, roomID matrix.RoomID, suggested bool) error {
+	child := m.SpaceChildEvent{
+		Via:       c.spaceVias(roomID),
+		Suggested: suggested,
+	}
+	child.StateKey = string(roomID)
+
+	if err := c.SetSpaceChild(spaceID, child); err != nil {
+		return err
+	}
+
+	if !c.CanSendEvent(roomID, m.SpaceParentEventType, true) {
+		return nil
+	}
+
+	_, err := c.RoomStateSend(roomID, api.RoomStateSendArg{
+		Type:     m.SpaceParentEventType,
+		StateKey: string(spaceID),
+		Content:  m.SpaceParentEvent{Via: c.spaceVias(spaceID)},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to set the room's space")
+	}
+
+	return nil
+}
+
+// RemoveSpaceChild removes the room from the space, along with the room's mark
+// of being in the space if the user can change it.
+func (c *Client) RemoveSpaceChild(spaceID, roomID matrix.RoomID) error {
+	_, err := c.RoomStateSend(spaceID, api.RoomStateSendArg{
+		Type:     m.SpaceChildEventType,
+		StateKey: string(roomID),
+		Content:  struct{}{},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to remove space child")
+	}
+
+	parent, _ := c.State.RoomState(roomID, m.SpaceParentEventType, string(spaceID))
+	if parent == nil || !c.CanSendEvent(roomID, m.SpaceParentEventType, true) {
+		return nil
+	}
+
+	_, err = c.RoomStateSend(roomID, api.RoomStateSendArg{
+		Type:     m.SpaceParentEventType,
+		StateKey: string(spaceID),
+		Content:  struct{}{},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to unset the room's space")
+	}
+
+	return nil
+}
+
+// ReorderSpaceChildren sets the order of the children in the space to the
+// order of the given list. Only the children whose order changed are updated.
+func (c *Client) ReorderSpaceChildren(spaceID matrix.RoomID, children []m.SpaceChildEvent) error {
+	for i, child := range children {
+		order := spaceOrder(i)
+		if child.Order == order {
+			continue
+		}
+
+		child.Order = order
+		if err := c.SetSpaceChild(spaceID, child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// spaceOrder returns the order string of the child at the given position. Gaps
+// are left between positions so that they sort correctly as strings.
+func spaceOrder(i int) string {
+	return fmt.Sprintf("%06d", (i+1)*100)
+}
+
+// CreateSubspace creates a new private space and adds it into the given space.
+func (c *Client) CreateSubspace(spaceID matrix.RoomID, name string) (matrix.RoomID, error) {
+	subspaceID, err := c.RoomCreate(api.RoomCreateArg{
+		Name:            name,
+		Visibility:      api.RoomPrivate,
+		Preset:          api.PresetPrivateChat,
+		CreationContent: map[string]interface{}{"type": "m.space"},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create space")
+	}
+
+	if err := c.AddSpaceChild(spaceID, subspaceID, false); err != nil {
+		return subspaceID, err
+	}
+
+	return subspaceID, nil
+}
+
+// spaceVias returns the servers that the room can be joined through, which
+// always has at least the user's server.
+func (c *Client) spaceVias(roomID matrix.RoomID) []string {
+	if vias := c.RoomVias(roomID); len(vias) > 0 {
+		return vias
+	}
+
+	_, server, _ := c.UserID.Parse()
+	return []string{server}
+}
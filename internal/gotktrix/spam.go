@@ -0,0 +1,188 @@
+package gotktrix
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// SpamRuleKind is the kind of messages that a spam rule matches.
+type SpamRuleKind string
+
+const (
+	// SpamBodyRegex matches messages whose body matches the rule's pattern as
+	// a regular expression.
+	SpamBodyRegex SpamRuleKind = "body_regex"
+	// SpamSenderServer matches messages whose sender's homeserver matches the
+	// rule's pattern as a glob, such as "*.example.com".
+	SpamSenderServer SpamRuleKind = "sender_server"
+	// SpamStrangerMedia matches media messages from users that the user has no
+	// direct chat with. The rule's pattern is unused.
+	SpamStrangerMedia SpamRuleKind = "stranger_media"
+)
+
+// SpamRuleAction is what's done to messages that match a spam rule.
+type SpamRuleAction string
+
+const (
+	// SpamHide hides the message the same way a locally hidden message is.
+	SpamHide SpamRuleAction = "hide"
+	// SpamCollapse keeps the message in the timeline but collapses its
+	// content until the user reveals it.
+	SpamCollapse SpamRuleAction = "collapse"
+)
+
+// SpamRule is a user-configured rule that hides or collapses matching incoming
+// messages locally.
+type SpamRule struct {
+	ID      string         `json:"id"`
+	Kind    SpamRuleKind   `json:"kind"`
+	Pattern string         `json:"pattern,omitempty"`
+	Action  SpamRuleAction `json:"action"`
+}
+
+// Validate returns an error if the rule's pattern is invalid for its kind.
+func (r SpamRule) Validate() error {
+	_, err := compileSpamRule(r)
+	return err
+}
+
+type compiledSpamRule struct {
+	SpamRule
+	regex *regexp.Regexp
+}
+
+func compileSpamRule(r SpamRule) (compiledSpamRule, error) {
+	compiled := compiledSpamRule{SpamRule: r}
+
+	if r.Kind != SpamStrangerMedia && r.Pattern == "" {
+		return compiled, errors.New("pattern is empty")
+	}
+
+	switch r.Kind {
+	case SpamBodyRegex:
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.regex = re
+	}
+
+	return compiled, nil
+}
+
+// spamRules holds the user's spam rules and the events that each rule has
+// matched so far.
+type spamRules struct {
+	mu    sync.RWMutex
+	rules []compiledSpamRule
+	// hits maps a rule ID to the set of events that it matched. A set is used
+	// so that the same event being rendered twice isn't counted twice.
+	hits map[string]map[matrix.EventID]struct{}
+}
+
+// SetSpamRules sets the spam rules that incoming messages are checked against.
+// Rules with invalid patterns are ignored. The hit counters of rules that still
+// exist are kept.
+func (c *Client) SetSpamRules(rules []SpamRule) {
+	compiled := make([]compiledSpamRule, 0, len(rules))
+	for _, rule := range rules {
+		if r, err := compileSpamRule(rule); err == nil {
+			compiled = append(compiled, r)
+		}
+	}
+
+	c.spam.mu.Lock()
+	defer c.spam.mu.Unlock()
+
+	hits := make(map[string]map[matrix.EventID]struct{}, len(compiled))
+	for _, rule := range compiled {
+		if old, ok := c.spam.hits[rule.ID]; ok {
+			hits[rule.ID] = old
+		}
+	}
+
+	c.spam.rules = compiled
+	c.spam.hits = hits
+}
+
+// SpamRuleHits returns the number of distinct events that the rule with the
+// given ID has matched during this session.
+func (c *Client) SpamRuleHits(id string) int {
+	c.spam.mu.RLock()
+	defer c.spam.mu.RUnlock()
+
+	return len(c.spam.hits[id])
+}
+
+// MatchSpam returns the first spam rule that the given event matches. The
+// user's own messages never match. A match is counted towards the rule's hits.
+func (c *Client) MatchSpam(ev event.RoomEvent) (SpamRule, bool) {
+	msg, ok := ev.(*event.RoomMessageEvent)
+	if !ok || msg.Sender == c.UserID {
+		return SpamRule{}, false
+	}
+
+	c.spam.mu.RLock()
+	rules := c.spam.rules
+	c.spam.mu.RUnlock()
+
+	for _, rule := range rules {
+		if !c.matchesSpamRule(rule, msg) {
+			continue
+		}
+
+		c.spam.mu.Lock()
+		if c.spam.hits[rule.ID] == nil {
+			c.spam.hits[rule.ID] = make(map[matrix.EventID]struct{})
+		}
+		c.spam.hits[rule.ID][msg.ID] = struct{}{}
+		c.spam.mu.Unlock()
+
+		return rule.SpamRule, true
+	}
+
+	return SpamRule{}, false
+}
+
+func (c *Client) matchesSpamRule(rule compiledSpamRule, msg *event.RoomMessageEvent) bool {
+	switch rule.Kind {
+	case SpamBodyRegex:
+		return rule.regex.MatchString(msg.Body)
+	case SpamSenderServer:
+		_, server, err := msg.Sender.Parse()
+		if err != nil {
+			return false
+		}
+		return globMatch(rule.Pattern, server)
+	case SpamStrangerMedia:
+		return isMediaMessage(msg.MessageType) && !c.hasDirectWith(msg.Sender)
+	default:
+		return false
+	}
+}
+
+func isMediaMessage(typ event.MessageType) bool {
+	switch typ {
+	case event.RoomMessageImage, event.RoomMessageVideo,
+		event.RoomMessageAudio, event.RoomMessageFile:
+		return true
+	default:
+		return false
+	}
+}
+
+// hasDirectWith returns true if the user has a direct chat with the given user
+// according to the stored m.direct account data.
+func (c *Client) hasDirectWith(userID matrix.UserID) bool {
+	e, err := c.State.UserEvent(event.TypeDirect)
+	if err != nil {
+		return false
+	}
+
+	direct, ok := e.(*event.DirectEvent)
+	return ok && len(direct.Rooms[userID]) > 0
+}
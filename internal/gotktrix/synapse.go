@@ -0,0 +1,207 @@
+package gotktrix
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// synapseAdmin is the prefix of Synapse's admin API. It is Synapse-specific;
+// other homeservers answer it with 404s.
+const synapseAdmin = "_synapse/admin"
+
+// IsSynapseAdmin returns true if the homeserver is Synapse and the user is a
+// server administrator on it. Any error is treated as the user not being one.
+func (c *Client) IsSynapseAdmin() bool {
+	var resp struct {
+		Admin bool `json:"admin"`
+	}
+
+	err := c.Request(
+		"GET", synapseAdmin+"/v1/users/"+url.PathEscape(string(c.UserID))+"/admin", &resp,
+		httputil.WithToken(),
+	)
+
+	return err == nil && resp.Admin
+}
+
+// AdminUser is a user as listed by the Synapse admin API.
+type AdminUser struct {
+	Name        matrix.UserID `json:"name"`
+	DisplayName string        `json:"displayname"`
+	Admin       bool          `json:"admin"`
+	Deactivated bool          `json:"deactivated"`
+	IsGuest     bool          `json:"is_guest"`
+}
+
+// AdminUsers is a page of users from AdminListUsers.
+type AdminUsers struct {
+	Users []AdminUser `json:"users"`
+	// NextToken is the token to get the next page with. It is empty on the
+	// last page.
+	NextToken string `json:"next_token"`
+	Total     int    `json:"total"`
+}
+
+// AdminListUsers lists the local users whose ID or display name contains the
+// given search string. The from token is empty for the first page.
+func (c *Client) AdminListUsers(search, from string, limit int) (*AdminUsers, error) {
+	query := map[string]string{
+		"limit":       strconv.Itoa(limit),
+		"guests":      "false",
+		"deactivated": "true",
+	}
+	if search != "" {
+		query["name"] = search
+	}
+	if from != "" {
+		query["from"] = from
+	}
+
+	var resp AdminUsers
+
+	err := c.Request(
+		"GET", synapseAdmin+"/v2/users", &resp,
+		httputil.WithToken(), httputil.WithQuery(query),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list users")
+	}
+
+	return &resp, nil
+}
+
+// AdminDeactivateUser deactivates the given local user. If erase is true, then
+// the user's messages are also hidden from users who join rooms later, as per
+// GDPR erasure.
+func (c *Client) AdminDeactivateUser(userID matrix.UserID, erase bool) error {
+	body := struct {
+		Erase bool `json:"erase"`
+	}{
+		Erase: erase,
+	}
+
+	err := c.Request(
+		"POST", synapseAdmin+"/v1/deactivate/"+url.PathEscape(string(userID)), nil,
+		httputil.WithToken(), httputil.WithJSONBody(body),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to deactivate %s", userID)
+	}
+
+	return nil
+}
+
+// AdminRoom is a room as listed by the Synapse admin API.
+type AdminRoom struct {
+	RoomID         matrix.RoomID `json:"room_id"`
+	Name           string        `json:"name"`
+	CanonicalAlias string        `json:"canonical_alias"`
+	JoinedMembers  int           `json:"joined_members"`
+	LocalMembers   int           `json:"joined_local_members"`
+	Public         bool          `json:"public"`
+}
+
+// AdminRooms is a page of rooms from AdminListRooms.
+type AdminRooms struct {
+	Rooms []AdminRoom `json:"rooms"`
+	// NextBatch is the offset of the next page. It is zero on the last page.
+	NextBatch  int `json:"next_batch"`
+	TotalRooms int `json:"total_rooms"`
+}
+
+// AdminListRooms lists the rooms known to the homeserver whose name or alias
+// contains the given search string, largest first.
+func (c *Client) AdminListRooms(search string, from, limit int) (*AdminRooms, error) {
+	query := map[string]string{
+		"limit":    strconv.Itoa(limit),
+		"from":     strconv.Itoa(from),
+		"order_by": "joined_members",
+	}
+	if search != "" {
+		query["search_term"] = search
+	}
+
+	var resp AdminRooms
+
+	err := c.Request(
+		"GET", synapseAdmin+"/v1/rooms", &resp,
+		httputil.WithToken(), httputil.WithQuery(query),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list rooms")
+	}
+
+	return &resp, nil
+}
+
+// AdminPurgeRoom removes all local users from the room and deletes it from the
+// homeserver's database. If block is true, then local users can't join the
+// room again. The number of kicked users is returned.
+func (c *Client) AdminPurgeRoom(roomID matrix.RoomID, block bool) (int, error) {
+	body := struct {
+		Block bool `json:"block"`
+		Purge bool `json:"purge"`
+	}{
+		Block: block,
+		Purge: true,
+	}
+
+	var resp struct {
+		KickedUsers []matrix.UserID `json:"kicked_users"`
+	}
+
+	err := c.Request(
+		"DELETE", synapseAdmin+"/v1/rooms/"+url.PathEscape(string(roomID)), &resp,
+		httputil.WithToken(), httputil.WithJSONBody(body),
+	)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to purge %s", roomID)
+	}
+
+	return len(resp.KickedUsers), nil
+}
+
+// AdminQuarantineRoomMedia quarantines all media sent in the given room, which
+// makes it unavailable for download. The number of quarantined files is
+// returned.
+func (c *Client) AdminQuarantineRoomMedia(roomID matrix.RoomID) (int, error) {
+	var resp struct {
+		Quarantined int `json:"num_quarantined"`
+	}
+
+	err := c.Request(
+		"POST", synapseAdmin+"/v1/room/"+url.PathEscape(string(roomID))+"/media/quarantine", &resp,
+		httputil.WithToken(), httputil.WithJSONBody(struct{}{}),
+	)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to quarantine media in %s", roomID)
+	}
+
+	return resp.Quarantined, nil
+}
+
+// AdminQuarantineMedia quarantines the media with the given mxc:// URL, which
+// makes it unavailable for download.
+func (c *Client) AdminQuarantineMedia(mxc matrix.URL) error {
+	u, err := url.Parse(string(mxc))
+	if err != nil || u.Scheme != "mxc" || u.Host == "" || len(u.Path) < 2 {
+		return errors.New("invalid mxc:// URL")
+	}
+
+	route := synapseAdmin + "/v1/media/quarantine/" +
+		url.PathEscape(u.Host) + "/" + url.PathEscape(u.Path[1:])
+
+	err = c.Request(
+		"POST", route, nil,
+		httputil.WithToken(), httputil.WithJSONBody(struct{}{}),
+	)
+	if err != nil {
+		return errors.Wrapf(err, "failed to quarantine %s", mxc)
+	}
+
+	return nil
+}
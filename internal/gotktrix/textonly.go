@@ -0,0 +1,24 @@
+package gotktrix
+
+import "sync/atomic"
+
+// textOnlyMode is true if the client shouldn't load any images at all.
+type textOnlyMode struct {
+	on uint32
+}
+
+// SetTextOnlyMode sets whether or not the client is in text-only mode. In
+// text-only mode, no images are loaded: avatars show their initials, custom
+// emojis show their names, and media is shown as links.
+func (c *Client) SetTextOnlyMode(on bool) {
+	var v uint32
+	if on {
+		v = 1
+	}
+	atomic.StoreUint32(&c.textOnly.on, v)
+}
+
+// TextOnlyMode returns true if the client is in text-only mode.
+func (c *Client) TextOnlyMode() bool {
+	return atomic.LoadUint32(&c.textOnly.on) == 1
+}
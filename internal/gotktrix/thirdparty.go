@@ -0,0 +1,129 @@
+package gotktrix
+
+import (
+	"net/url"
+	"sort"
+
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// ThirdPartyProtocol is a network that the homeserver bridges to through its
+// application services, such as IRC or Telegram.
+type ThirdPartyProtocol struct {
+	// Name is the name that the protocol is looked up with, such as "irc".
+	Name string `json:"-"`
+	Icon string `json:"icon"`
+	// UserFields and LocationFields are the fields that users and locations
+	// are looked up with, in the order that they should be asked for.
+	UserFields     []string                       `json:"user_fields"`
+	LocationFields []string                       `json:"location_fields"`
+	FieldTypes     map[string]ThirdPartyFieldType `json:"field_types"`
+	Instances      []ThirdPartyProtocolInstance   `json:"instances"`
+}
+
+// ThirdPartyFieldType describes a field that users or locations are looked up
+// with.
+type ThirdPartyFieldType struct {
+	Regexp      string `json:"regexp"`
+	Placeholder string `json:"placeholder"`
+}
+
+// ThirdPartyProtocolInstance is a single network of a protocol, such as one IRC
+// network. Its public rooms can be listed in the room directory.
+type ThirdPartyProtocolInstance struct {
+	Desc       string            `json:"desc"`
+	Icon       string            `json:"icon"`
+	Fields     map[string]string `json:"fields"`
+	NetworkID  string            `json:"network_id"`
+	InstanceID string            `json:"instance_id"`
+}
+
+// ThirdPartyLocation is a room that is bridged to a location on a third-party
+// network, such as an IRC channel.
+type ThirdPartyLocation struct {
+	Alias    string            `json:"alias"`
+	Protocol string            `json:"protocol"`
+	Fields   map[string]string `json:"fields"`
+}
+
+// ThirdPartyUser is a Matrix user that is bridged to a user on a third-party
+// network.
+type ThirdPartyUser struct {
+	UserID   matrix.UserID     `json:"userid"`
+	Protocol string            `json:"protocol"`
+	Fields   map[string]string `json:"fields"`
+}
+
+// ThirdPartyProtocols returns the protocols that the homeserver bridges to,
+// sorted by name. Homeservers without application services return none.
+func (c *Client) ThirdPartyProtocols() ([]ThirdPartyProtocol, error) {
+	var resp map[string]ThirdPartyProtocol
+
+	err := c.Request(
+		"GET", c.Endpoints.Base()+"/thirdparty/protocols", &resp,
+		httputil.WithToken(),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get bridged networks")
+	}
+
+	protocols := make([]ThirdPartyProtocol, 0, len(resp))
+	for name, protocol := range resp {
+		protocol.Name = name
+		protocols = append(protocols, protocol)
+	}
+
+	sort.Slice(protocols, func(i, j int) bool {
+		return protocols[i].Name < protocols[j].Name
+	})
+
+	return protocols, nil
+}
+
+// ThirdPartyLocations looks up the rooms that are bridged to the location on
+// the given protocol that matches the fields.
+func (c *Client) ThirdPartyLocations(protocol string, fields map[string]string) ([]ThirdPartyLocation, error) {
+	var locations []ThirdPartyLocation
+
+	err := c.Request(
+		"GET", c.Endpoints.Base()+"/thirdparty/location/"+url.PathEscape(protocol), &locations,
+		httputil.WithToken(), httputil.WithQuery(fields),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up bridged rooms")
+	}
+
+	return locations, nil
+}
+
+// ThirdPartyUsers looks up the Matrix users that are bridged to the user on the
+// given protocol that matches the fields.
+func (c *Client) ThirdPartyUsers(protocol string, fields map[string]string) ([]ThirdPartyUser, error) {
+	var users []ThirdPartyUser
+
+	err := c.Request(
+		"GET", c.Endpoints.Base()+"/thirdparty/user/"+url.PathEscape(protocol), &users,
+		httputil.WithToken(), httputil.WithQuery(fields),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to look up bridged users")
+	}
+
+	return users, nil
+}
+
+// RoomJoinAlias joins the room with the given alias and returns its ID.
+func (c *Client) RoomJoinAlias(alias string) (matrix.RoomID, error) {
+	resp, err := c.Client.RoomAlias(alias)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to look up room address")
+	}
+
+	if err := c.RoomJoinVia(resp.RoomID, resp.Servers); err != nil {
+		return "", err
+	}
+
+	return resp.RoomID, nil
+}
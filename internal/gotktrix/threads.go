@@ -0,0 +1,109 @@
+package gotktrix
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/sys"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// ThreadRelType is the relation type of messages that are in a thread.
+const ThreadRelType = "m.thread"
+
+// maxThreadEvents is the maximum number of events that RoomThread fetches.
+const maxThreadEvents = 500
+
+// ThreadOf returns the root of the thread that the given event is in, or an
+// empty string if it's not in a thread.
+func ThreadOf(ev event.RoomEvent) matrix.EventID {
+	msg, ok := ev.(*event.RoomMessageEvent)
+	if !ok || msg.RelatesTo == nil {
+		return ""
+	}
+
+	var relatesTo struct {
+		RelType string         `json:"rel_type"`
+		EventID matrix.EventID `json:"event_id"`
+	}
+
+	json.Unmarshal(msg.RelatesTo, &relatesTo)
+
+	if relatesTo.RelType != ThreadRelType {
+		return ""
+	}
+	return relatesTo.EventID
+}
+
+// ThreadCount returns the number of replies in the thread rooted at the given
+// event according to the homeserver's bundled aggregations, or 0 if the
+// homeserver didn't bundle any.
+func ThreadCount(ev event.RoomEvent) int {
+	raw := ev.RoomInfo().Raw
+	if raw == nil {
+		return 0
+	}
+
+	var aggregations struct {
+		Unsigned struct {
+			Relations struct {
+				Thread struct {
+					Count int `json:"count"`
+				} `json:"m.thread"`
+			} `json:"m.relations"`
+		} `json:"unsigned"`
+	}
+
+	json.Unmarshal(raw, &aggregations)
+	return aggregations.Unsigned.Relations.Thread.Count
+}
+
+// RoomThread fetches the events in the thread rooted at the given event from
+// the homeserver, oldest first. The root itself isn't included.
+func (c *Client) RoomThread(roomID matrix.RoomID, root matrix.EventID) ([]event.RoomEvent, error) {
+	route := "_matrix/client/v1/rooms/" + url.PathEscape(string(roomID)) +
+		"/relations/" + url.PathEscape(string(root)) + "/" + ThreadRelType
+
+	var events []event.RoomEvent
+	var from string
+
+	for len(events) < maxThreadEvents {
+		query := map[string]string{"limit": "100"}
+		if from != "" {
+			query["from"] = from
+		}
+
+		var resp struct {
+			Chunk     []json.RawMessage `json:"chunk"`
+			NextBatch string            `json:"next_batch"`
+		}
+
+		err := c.Request(
+			"GET", route, &resp,
+			httputil.WithToken(), httputil.WithQuery(query),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get thread")
+		}
+
+		// The chunk is newest first.
+		for _, raw := range resp.Chunk {
+			raw = json.RawMessage(c.crypto.DecryptEvent(roomID, event.RawEvent(raw)))
+			events = append(events, sys.ParseTimeline(raw, roomID))
+		}
+
+		if resp.NextBatch == "" {
+			break
+		}
+		from = resp.NextBatch
+	}
+
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+
+	return events, nil
+}
@@ -0,0 +1,186 @@
+package gotktrix
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/diamondburned/gotktrix/internal/gotktrix/events/encryption"
+	"github.com/diamondburned/gotrix/api/httputil"
+	"github.com/diamondburned/gotrix/event"
+	"github.com/diamondburned/gotrix/matrix"
+	"github.com/pkg/errors"
+)
+
+// RoomVersion returns the room's version according to its creation event.
+// Rooms without an explicit version are version 1.
+func (c *Client) RoomVersion(roomID matrix.RoomID) string {
+	e, err := c.RoomState(roomID, event.TypeRoomCreate, "")
+	if err != nil {
+		return ""
+	}
+
+	if v := e.(*event.RoomCreateEvent).RoomVersion; v != nil && *v != "" {
+		return *v
+	}
+	return "1"
+}
+
+// RoomVersions returns the room versions that the homeserver supports, stable
+// ones first, and the default version for new rooms.
+func (c *Client) RoomVersions() (versions []string, def string, err error) {
+	caps, err := c.ServerCapabilities()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "cannot get capabilities")
+	}
+
+	v, err := caps.RoomVersion()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "cannot get room versions")
+	}
+
+	for version := range v.Available {
+		versions = append(versions, version)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		si := v.Available[versions[i]] == matrix.RoomVersionStable
+		sj := v.Available[versions[j]] == matrix.RoomVersionStable
+		if si != sj {
+			return si
+		}
+		return versions[i] < versions[j]
+	})
+
+	return versions, v.Default, nil
+}
+
+// UpgradeStep is a step in upgrading a room.
+type UpgradeStep uint8
+
+const (
+	// UpgradeCreating is when the replacement room is being created and the
+	// old room is being tombstoned.
+	UpgradeCreating UpgradeStep = iota
+	// UpgradeCopyingState is when the state that the homeserver didn't carry
+	// over is being copied.
+	UpgradeCopyingState
+	// UpgradeInviting is when members are being invited to the new room.
+	UpgradeInviting
+)
+
+// upgradeState is the state that is carried over to the replacement room.
+// Homeservers copy these over themselves, but not all of them do, so any that
+// is missing is copied manually.
+var upgradeState = []event.Type{
+	event.TypeRoomPowerLevels,
+	event.TypeRoomJoinRules,
+	event.TypeRoomHistoryVisibility,
+	event.TypeRoomGuestAccess,
+	event.TypeRoomName,
+	event.TypeRoomTopic,
+	event.TypeRoomAvatar,
+	encryption.EventType,
+}
+
+// UpgradeRoom replaces the room with a new room of the given version. The
+// homeserver creates the new room and tombstones the old one, pointing to it.
+// Then, any state from upgradeState that's missing in the new room is copied
+// over, and if invite is true, then the old room's joined members are invited.
+//
+// The progress function is called with the current step, and for
+// UpgradeInviting, how many of the members have been invited. Members that
+// can't be invited don't stop the upgrade; they're listed in the returned error
+// along with the new room's ID.
+func (c *Client) UpgradeRoom(
+	ctx context.Context, roomID matrix.RoomID, version string, invite bool,
+	progress func(step UpgradeStep, done, total int)) (matrix.RoomID, error) {
+
+	client := c.WithContext(ctx)
+
+	progress(UpgradeCreating, 0, 0)
+
+	newRoomID, err := client.Client.UpgradeRoom(roomID, version)
+	if err != nil {
+		return "", err
+	}
+
+	progress(UpgradeCopyingState, 0, len(upgradeState))
+
+	for i, typ := range upgradeState {
+		if err := client.copyMissingState(roomID, newRoomID, typ); err != nil {
+			return newRoomID, errors.Wrapf(err, "cannot copy %s", typ)
+		}
+		progress(UpgradeCopyingState, i+1, len(upgradeState))
+	}
+
+	if !invite {
+		return newRoomID, nil
+	}
+
+	if err := client.RoomEnsureMembers(roomID); err != nil {
+		return newRoomID, errors.Wrap(err, "cannot fetch members to invite")
+	}
+
+	members, err := client.RoomMembers(roomID)
+	if err != nil {
+		return newRoomID, errors.Wrap(err, "cannot get members to invite")
+	}
+
+	var invitees []matrix.UserID
+	for _, member := range members {
+		if member.NewState == event.MemberJoined && member.UserID != c.UserID {
+			invitees = append(invitees, member.UserID)
+		}
+	}
+
+	progress(UpgradeInviting, 0, len(invitees))
+
+	var failed []string
+	var lastErr error
+
+	for i, userID := range invitees {
+		// Members that can't be invited, such as ones whose server is down,
+		// can still follow the tombstone on their own, so keep going.
+		if err := client.Invite(newRoomID, userID, ""); err != nil {
+			failed = append(failed, string(userID))
+			lastErr = err
+		}
+		progress(UpgradeInviting, i+1, len(invitees))
+	}
+
+	if len(failed) > 0 {
+		return newRoomID, errors.Wrapf(lastErr,
+			"cannot invite %d of %d members (%s)",
+			len(failed), len(invitees), strings.Join(failed, ", "))
+	}
+
+	return newRoomID, nil
+}
+
+// copyMissingState copies the state event of the given type from the old room
+// into the new room if the new room doesn't have it.
+func (c *Client) copyMissingState(oldRoom, newRoom matrix.RoomID, typ event.Type) error {
+	if _, err := c.Client.Client.RoomState(newRoom, typ, ""); err == nil {
+		return nil
+	}
+
+	raw, err := c.Client.Client.RoomState(oldRoom, typ, "")
+	if err != nil {
+		// The old room doesn't have it either.
+		return nil
+	}
+
+	var ev struct {
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &ev); err != nil {
+		return errors.Wrap(err, "cannot decode old state")
+	}
+
+	return c.Request(
+		"PUT", c.Endpoints.RoomStateExact(newRoom, typ, ""), nil,
+		httputil.WithToken(), httputil.WithJSONBody(ev.Content),
+	)
+}
@@ -0,0 +1,57 @@
+// Package a11y follows the system's reduce-motion and high-contrast settings.
+//
+// GTK already skips revealer and stack transitions when animations are turned
+// off, so this package only covers what GTK doesn't know about, such as animated
+// images, the typing indicator and the colors that the client picks by itself.
+package a11y
+
+import (
+	"strings"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/gtkutil"
+)
+
+// ReduceMotion returns true if the user asked for less motion, which is when
+// animations are turned off in the system settings. It must be called in the
+// main thread.
+func ReduceMotion() bool {
+	settings := gtk.SettingsGetDefault()
+	if settings == nil {
+		return false
+	}
+	enabled, _ := settings.ObjectProperty("gtk-enable-animations").(bool)
+	return !enabled
+}
+
+// HighContrast returns true if a high-contrast theme, such as HighContrast or
+// HighContrastInverse, is in use. It must be called in the main thread.
+func HighContrast() bool {
+	settings := gtk.SettingsGetDefault()
+	if settings == nil {
+		return false
+	}
+	theme, _ := settings.ObjectProperty("gtk-theme-name").(string)
+	return strings.Contains(theme, "HighContrast")
+}
+
+// Subscribe calls f once now and every time either setting changes, for as
+// long as the given widget is mapped.
+func Subscribe(w gtk.Widgetter, f func()) {
+	gtkutil.BindSubscribe(w, func() func() {
+		f()
+
+		settings := gtk.SettingsGetDefault()
+		if settings == nil {
+			return func() {}
+		}
+
+		h1 := settings.NotifyProperty("gtk-enable-animations", f)
+		h2 := settings.NotifyProperty("gtk-theme-name", f)
+
+		return func() {
+			settings.HandlerDisconnect(h1)
+			settings.HandlerDisconnect(h2)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+// Package ctxutil ties the contexts of background work to the lifetime of
+// widgets.
+package ctxutil
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/gtkutil"
+)
+
+// Async is like gtkutil.Async, except the context given to asyncFn is also
+// cancelled once the widget is unrealized. Use it for network and media work
+// whose result goes into the widget, so that the work stops once the widget is
+// gone instead of completing into a destroyed widget.
+//
+// Async must be called in the main thread.
+func Async(ctx context.Context, widget gtk.Widgetter, asyncFn func(context.Context) func()) {
+	w := gtk.BaseWidget(widget)
+
+	ctx, cancel := context.WithCancel(ctx)
+	h := w.ConnectUnrealize(cancel)
+
+	done := func() {
+		w.HandlerDisconnect(h)
+		cancel()
+	}
+
+	gtkutil.Async(ctx, func() func() {
+		f := asyncFn(ctx)
+		return func() {
+			done()
+			if f != nil {
+				f()
+			}
+		}
+	})
+}
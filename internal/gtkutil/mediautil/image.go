@@ -0,0 +1,48 @@
+package mediautil
+
+import (
+	"context"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotkit/gtkutil/imgutil"
+)
+
+// AsyncGETScaled is like imgutil.AsyncGET, except the image is decoded at the
+// size that it's displayed at instead of at its full size, which saves a lot of
+// memory for large images. w and h are the display size in logical pixels.
+//
+// The image is only fetched once the widget is drawn, since that's when its
+// scale factor is known. It is decoded again the next time the widget is drawn
+// after its scale factor changes, such as when the window is moved to a HiDPI
+// monitor.
+func AsyncGETScaled(
+	ctx context.Context, widget gtk.Widgetter, url string, w, h int, img imgutil.ImageSetter) {
+
+	if url == "" {
+		return
+	}
+
+	base := gtk.BaseWidget(widget)
+	var scale int
+
+	load := func() {
+		if ctx.Err() != nil {
+			return
+		}
+
+		s := base.ScaleFactor()
+		if s == scale {
+			return
+		}
+		scale = s
+
+		ctx := imgutil.WithOpts(ctx, imgutil.WithRescale(w*s, h*s))
+		imgutil.AsyncGET(ctx, url, img)
+	}
+
+	gtkutil.OnFirstDraw(base, load)
+	base.NotifyProperty("scale-factor", func() {
+		gtkutil.OnFirstDraw(base, load)
+	})
+}
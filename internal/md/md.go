@@ -208,6 +208,26 @@ var inlineImageCSS = cssutil.Applier("md-inlineimage", `
 	}
 `)
 
+var altPillCSS = cssutil.Applier("md-altpill", `
+	.md-altpill {
+		padding: 0 4px;
+		border-radius: 999px;
+		background-color: alpha(@theme_fg_color, 0.1);
+		font-size: 0.9em;
+	}
+`)
+
+// InsertAltPill inserts a small label with the given alternative text in place
+// of an image, such as the name of a custom emoji. It's used when images aren't
+// loaded at all.
+func InsertAltPill(view *gtk.TextView, anchor *gtk.TextChildAnchor, alt string) *gtk.Label {
+	label := gtk.NewLabel(alt)
+	altPillCSS(label)
+
+	view.AddChildAtAnchor(label, anchor)
+	return label
+}
+
 // InsertImageWidget asynchronously inserts a new image widget. It does so in a
 // way that the text position of the text buffer is not scrambled. Images
 // created using this function will have the ".md-inlineimage" class.
@@ -5,6 +5,7 @@ import (
 	"embed"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/diamondburned/adaptive"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
@@ -15,11 +16,15 @@ import (
 	"github.com/diamondburned/gotkit/components/prefui"
 	"github.com/diamondburned/gotkit/gtkutil"
 	"github.com/diamondburned/gotkit/gtkutil/cssutil"
+	"github.com/diamondburned/gotkit/gtkutil/httputil"
 	"github.com/diamondburned/gotktrix/internal/app/about"
 	"github.com/diamondburned/gotktrix/internal/app/auth"
 	"github.com/diamondburned/gotktrix/internal/app/auth/syncbox"
 	"github.com/diamondburned/gotktrix/internal/app/blinker"
+	"github.com/diamondburned/gotktrix/internal/app/daemon"
+	"github.com/diamondburned/gotktrix/internal/app/lowdata"
 	"github.com/diamondburned/gotktrix/internal/app/messageview/msgnotify"
+	"github.com/diamondburned/gotktrix/internal/cli"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
 	"github.com/diamondburned/gotrix/matrix"
 	"github.com/pkg/errors"
@@ -125,14 +130,36 @@ func main() {
 	))
 
 	app := app.New("com.github.diamondburned.gotktrix", "gotktrix")
+
+	// Subcommands, such as gotktrix send, run without any window.
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Main(ctx, app, os.Args[1:]))
+	}
+
+	args := os.Args
+	if len(args) > 1 && args[1] == "--daemon" {
+		args = append([]string{args[0]}, args[2:]...)
+		daemonize = true
+
+		// Activating the running instance would open a window.
+		if err := app.Register(ctx); err == nil && app.IsRemote() {
+			log.Println("gotktrix is already running")
+			return
+		}
+	}
+
 	app.ConnectActivate(func() { activate(app.Context()) })
-	app.RunMain(ctx)
+	os.Exit(app.Run(ctx, args))
 }
 
 // initialized is true if the global initializers are ran. We assume that
 // globally, there's only ever 1 GApplication instance.
 var initialized bool
 
+// daemonize is true if gotktrix is started with --daemon, in which case it only
+// syncs and notifies until it's activated again.
+var daemonize bool
+
 // managers keeps track of all manager instances that are unique to each user.
 var managers = map[matrix.UserID]*manager{}
 
@@ -141,8 +168,13 @@ var managers = map[matrix.UserID]*manager{}
 func openRoom(cmd msgnotify.OpenRoomCommand) {
 	manager, ok := managers[cmd.UserID]
 	if !ok {
-		log.Println("user ID", cmd.UserID, "not found")
-		return
+		// The daemon notifies for accounts that have no window.
+		acc := daemon.Find(cmd.UserID)
+		if acc == nil {
+			log.Println("user ID", cmd.UserID, "not found")
+			return
+		}
+		manager = attach(acc)
 	}
 	manager.OpenRoom(cmd.RoomID)
 }
@@ -164,9 +196,24 @@ func activate(ctx context.Context) {
 			}
 
 			return func() {
+				// The daemon needs the preferences, such as the proxy.
+				if daemonize {
+					defer daemon.Start(ctx, "app.open-room")
+				}
+
 				if err := prefs.LoadData(data); err != nil {
 					a.Error(errors.Wrap(err, "cannot load saved preferences"))
+					return
 				}
+
+				// Save the preferences again when quitting, since some of them
+				// are changed outside the preferences dialog. This is only done
+				// once they're loaded, or the saved ones would be overwritten.
+				a.ConnectShutdown(func() {
+					if err := prefs.TakeSnapshot().Save(ctx); err != nil {
+						log.Println("cannot save preferences:", err)
+					}
+				})
 			}
 		})
 
@@ -180,33 +227,83 @@ func activate(ctx context.Context) {
 		a.AddActionCallbacks(map[string]gtkutil.ActionCallback{
 			"app.open-room": gtkutil.NewJSONActionCallback(openRoom),
 		})
+
+		if daemonize {
+			// Don't open a window until gotktrix is activated again.
+			return
+		}
 	}
 
-	w := a.NewWindow()
-	w.SetDefaultSize(700, 600)
-	w.SetTitle("gotktrix")
+	// Open the accounts that the daemon is syncing before logging in again.
+	for _, acc := range daemon.Accounts() {
+		if _, ok := managers[acc.Client.UserID]; !ok {
+			attach(acc)
+			return
+		}
+	}
 
+	w := newWindow(ctx)
 	ctx = app.WithWindow(ctx, w)
 
 	authAssistant := auth.Show(ctx)
 	authAssistant.OnConnect(func(client *gotktrix.Client, acc *auth.Account) {
-		ctx := gotktrix.WithClient(ctx, client)
-		client.Interceptor.AddIntercept(interceptHTTPLog)
-
-		// Making the blinker right here. We don't want to miss the first sync
-		// once the screen becomes visible.
-		m := manager{ctx: ctx}
-		m.header.blinker = blinker.New(ctx)
+		m := newManager(gotktrix.WithClient(ctx, client), acc)
 
-		managers[client.UserID] = &m
-		w.ConnectDestroy(func() { delete(managers, client.UserID) })
+		// Decide this before opening, since the sync filter depends on it.
+		client.SetLowDataMode(lowdata.Enabled())
+		// Also decide this before any avatar is loaded.
+		client.SetTextOnlyMode(lowdata.TextOnly())
 
 		// Open the sync loop.
 		w.SetLoading()
-		syncbox.OpenThen(ctx, acc, func() { m.ready() })
+		syncbox.OpenThen(m.ctx, acc, func() { m.ready() })
 	})
 }
 
+func newWindow(ctx context.Context) *app.Window {
+	w := app.FromContext(ctx).NewWindow()
+	w.SetDefaultSize(700, 600)
+	w.SetTitle("gotktrix")
+	return w
+}
+
+// newManager creates a manager for the client in the given context, which
+// must also have the window.
+func newManager(ctx context.Context, acc *auth.Account) *manager {
+	client := gotktrix.FromContext(ctx)
+	client.Interceptor.AddIntercept(interceptHTTPLog)
+
+	// Fetch media through the same proxy as the account.
+	if mediaClient, err := acc.MediaClient(); err == nil {
+		ctx = httputil.WithClient(ctx, mediaClient)
+	} else {
+		log.Println("cannot use proxy for media:", err)
+	}
+
+	// Making the blinker right here. We don't want to miss the first sync
+	// once the screen becomes visible.
+	m := manager{ctx: ctx}
+	m.header.blinker = blinker.New(ctx)
+
+	managers[client.UserID] = &m
+	app.WindowFromContext(ctx).ConnectDestroy(func() { delete(managers, client.UserID) })
+
+	return &m
+}
+
+// attach opens a new window for the daemon's account. The account is already
+// synced, so the window is ready right away.
+func attach(acc *daemon.Account) *manager {
+	w := newWindow(acc.Context)
+
+	m := newManager(app.WithWindow(acc.Context, w), acc.Account)
+	m.daemon = true
+	m.ready()
+
+	w.Show()
+	return m
+}
+
 func interceptHTTPLog(r *http.Request, next func() error) error {
 	err := next()
 	if err != nil && !errors.Is(err, context.Canceled) {
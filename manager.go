@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"log"
 
 	"github.com/diamondburned/adaptive"
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 	"github.com/diamondburned/gotk4/pkg/pango"
 	"github.com/diamondburned/gotkit/app"
@@ -11,14 +13,26 @@ import (
 	"github.com/diamondburned/gotkit/app/prefs"
 	"github.com/diamondburned/gotkit/components/title"
 	"github.com/diamondburned/gotkit/gtkutil"
+	"github.com/diamondburned/gotktrix/internal/app/archive"
 	"github.com/diamondburned/gotktrix/internal/app/blinker"
+	"github.com/diamondburned/gotktrix/internal/app/diagnostics"
 	"github.com/diamondburned/gotktrix/internal/app/emojiview"
+	"github.com/diamondburned/gotktrix/internal/app/lowdata"
 	"github.com/diamondburned/gotktrix/internal/app/messageview"
+	"github.com/diamondburned/gotktrix/internal/app/messageview/message/mcontent"
 	"github.com/diamondburned/gotktrix/internal/app/messageview/msgnotify"
+	"github.com/diamondburned/gotktrix/internal/app/policylists"
+	"github.com/diamondburned/gotktrix/internal/app/roomdialog"
 	"github.com/diamondburned/gotktrix/internal/app/roomlist"
 	"github.com/diamondburned/gotktrix/internal/app/roomlist/room"
+	"github.com/diamondburned/gotktrix/internal/app/scripting"
+	"github.com/diamondburned/gotktrix/internal/app/serveradmin"
+	"github.com/diamondburned/gotktrix/internal/app/sessionexport"
+	"github.com/diamondburned/gotktrix/internal/app/settingsync"
+	"github.com/diamondburned/gotktrix/internal/app/spamrules"
 	"github.com/diamondburned/gotktrix/internal/app/userbutton"
 	"github.com/diamondburned/gotktrix/internal/gotktrix"
+	"github.com/diamondburned/gotrix/event"
 	"github.com/diamondburned/gotrix/matrix"
 )
 
@@ -41,6 +55,11 @@ type manager struct {
 	msgView  *messageview.View
 
 	unbindLastRoom func()
+	// serverAdmin is true if the user is a Synapse server administrator.
+	serverAdmin bool
+	// daemon is true if the client belongs to the daemon, which notifies for
+	// it regardless of the window.
+	daemon bool
 }
 
 const minMessagesWidth = 400
@@ -70,6 +89,10 @@ func (m *manager) ready() {
 	m.msgView = messageview.New(m.ctx, m)
 	m.msgView.SetPlaceholder(welcome)
 
+	// The initial sync is done by now, so warm up the rooms that the user is
+	// most likely to open.
+	messageview.Prefetch(m.ctx)
+
 	m.fold = adaptive.NewFold(gtk.PosLeft)
 	m.fold.SetWidthFunc(w.AllocatedWidth)
 	m.fold.SetSideChild(m.roomList)
@@ -103,6 +126,19 @@ func (m *manager) ready() {
 		roomSearchBar.SetSearchMode(roomSearch.Active())
 	})
 
+	recentRooms := gtk.NewToggleButton()
+	recentRooms.SetIconName("document-open-recent-symbolic")
+	recentRooms.SetTooltipText(locale.S(m.ctx, "Show Recent Rooms"))
+	recentRooms.AddCSSClass("room-recent-button")
+	recentRooms.SetVAlign(gtk.AlignCenter)
+	recentRooms.SetActive(m.roomList.RecentShown())
+
+	// Keep the button updated when the preference is changed elsewhere.
+	m.roomList.NotifyRecentShown(recentRooms, recentRooms.SetActive)
+	recentRooms.ConnectClicked(func() {
+		m.roomList.SetRecentShown(recentRooms.Active())
+	})
+
 	user := userbutton.NewToggle(m.ctx)
 	user.SetTooltipText(locale.S(m.ctx, "Menu"))
 	user.SetVAlign(gtk.AlignCenter)
@@ -116,10 +152,21 @@ func (m *manager) ready() {
 		return []gtkutil.PopoverMenuItem{
 			gtkutil.MenuSeparator(locale.S(m.ctx, "Me")),
 			gtkutil.MenuItem(locale.S(m.ctx, "Custom _Emojis"), "win.user-emojis"),
+			gtkutil.MenuItem(locale.S(m.ctx, "_Mention Names"), "win.mention-names"),
+			gtkutil.MenuItem(locale.S(m.ctx, "Spam _Rules"), "win.spam-rules"),
+			gtkutil.MenuItem(locale.S(m.ctx, "_Policy Lists"), "win.policy-lists"),
+			gtkutil.MenuItem(locale.S(m.ctx, "Export Sess_ion"), "win.export-session"),
+			gtkutil.MenuItem(locale.S(m.ctx, "Server _Administration"), "win.server-admin", m.serverAdmin),
+			gtkutil.MenuSeparator(locale.S(m.ctx, "Rooms")),
+			gtkutil.MenuItem(locale.S(m.ctx, "_Start a Chat"), "win.start-chat"),
+			gtkutil.MenuItem(locale.S(m.ctx, "E_xplore Rooms"), "win.explore-rooms"),
+			gtkutil.MenuItem(locale.S(m.ctx, "_Create Room"), "win.create-room"),
+			gtkutil.MenuItem(locale.S(m.ctx, "Imported _History"), "win.archives"),
 			gtkutil.MenuSeparator(""),
 			gtkutil.MenuItem(locale.S(m.ctx, "_Preferences"), "app.preferences"),
 			gtkutil.MenuItem(locale.S(m.ctx, "_About"), "app.about"),
 			gtkutil.MenuItem(locale.S(m.ctx, "_Logs"), "app.logs"),
+			gtkutil.MenuItem(locale.S(m.ctx, "Connection _Diagnostics"), "win.diagnostics"),
 			gtkutil.MenuItem(locale.S(m.ctx, "_Quit"), "app.quit"),
 		}
 	})
@@ -130,6 +177,7 @@ func (m *manager) ready() {
 	m.header.left.Append(gtk.NewWindowControls(gtk.PackStart))
 	m.header.left.Append(user)
 	m.header.left.Append(m.header.ltext)
+	m.header.left.Append(recentRooms)
 	m.header.left.Append(roomSearch)
 
 	unfold := adaptive.NewFoldRevealButton()
@@ -146,6 +194,8 @@ func (m *manager) ready() {
 	m.header.right.AddCSSClass("titlebar")
 	m.header.right.Append(unfold)
 	m.header.right.Append(m.header.rtext)
+	m.header.right.Append(m.newMembersButton())
+	m.header.right.Append(m.newRoomMenuButton())
 	m.header.right.Append(m.header.blinker)
 	m.header.right.Append(gtk.NewWindowControls(gtk.PackEnd))
 
@@ -172,12 +222,187 @@ func (m *manager) ready() {
 	m.header.SetChild(m.header.fold)
 
 	gtkutil.BindActionMap(w, map[string]func(){
-		"win.user-emojis": func() { emojiview.ForUser(m.ctx) },
+		"win.user-emojis":    func() { emojiview.ForUser(m.ctx) },
+		"win.mention-names":  func() { msgnotify.EditMentionNames(m.ctx) },
+		"win.spam-rules":     func() { spamrules.Show(m.ctx) },
+		"win.policy-lists":   func() { policylists.Show(m.ctx) },
+		"win.start-chat":     func() { roomdialog.StartChat(m.ctx, m.OpenRoom) },
+		"win.create-room":    func() { roomdialog.CreateRoom(m.ctx, m.OpenRoom) },
+		"win.explore-rooms":  func() { roomdialog.Explore(m.ctx, m.OpenRoom) },
+		"win.diagnostics":    func() { diagnostics.Show(m.ctx) },
+		"win.export-session": func() { sessionexport.Show(m.ctx) },
+		"win.server-admin":   func() { serveradmin.Show(m.ctx) },
+		"win.archives":       func() { archive.Show(m.ctx) },
+
+		"win.search-messages":     func() { m.searchMessages() },
+		"win.copy-room-alias":     func() { m.copyRoomAlias() },
+		"win.copy-room-id":        func() { m.copyRoomID() },
+		"win.copy-room-permalink": func() { m.copyRoomPermalink() },
+		"win.explain-permissions": func() { m.explainPermissions() },
+		"win.upgrade-room":        func() { m.upgradeRoom() },
+		"win.room-settings":       func() { m.roomSettings() },
+	})
+
+	msgnotify.LoadMentionNames(m.ctx)
+	spamrules.Load(m.ctx)
+	policylists.Load(m.ctx)
+
+	gtkutil.Async(m.ctx, func() func() {
+		client := gotktrix.FromContext(m.ctx)
+		if !client.IsSynapseAdmin() {
+			return nil
+		}
+		return func() { m.serverAdmin = true }
+	})
+
+	gtkutil.BindSubscribe(w, func() func() {
+		return mcontent.BindContentScanner(m.ctx)
 	})
 
+	gtkutil.BindSubscribe(w, func() func() {
+		return settingsync.Bind(m.ctx)
+	})
+
+	gtkutil.BindSubscribe(w, func() func() {
+		return lowdata.Bind(m.ctx)
+	})
+
+	if m.daemon {
+		return
+	}
+
 	gtkutil.BindSubscribe(w, func() func() {
 		return msgnotify.StartNotify(m.ctx, "app.open-room")
 	})
+
+	gtkutil.BindSubscribe(w, func() func() {
+		return scripting.Bind(m.ctx)
+	})
+
+	gtkutil.BindSubscribe(w, func() func() {
+		return msgnotify.StartBadge(m.ctx)
+	})
+}
+
+// newMembersButton creates the button that shows or hides the member sidebar.
+func (m *manager) newMembersButton() *gtk.ToggleButton {
+	button := gtk.NewToggleButton()
+	button.SetIconName("system-users-symbolic")
+	button.SetTooltipText(locale.S(m.ctx, "Show Members"))
+	button.SetHasFrame(false)
+	button.SetVAlign(gtk.AlignCenter)
+	button.SetActive(m.msgView.MembersShown())
+
+	// Keep the button updated when the sidebar is closed from inside.
+	m.msgView.NotifyMembersShown(button, button.SetActive)
+	button.ConnectClicked(func() {
+		m.msgView.SetMembersShown(button.Active())
+	})
+
+	return button
+}
+
+// newRoomMenuButton creates the button that shows the menu of the current
+// room.
+func (m *manager) newRoomMenuButton() *gtk.Button {
+	button := gtk.NewButtonFromIconName("view-more-symbolic")
+	button.SetTooltipText(locale.S(m.ctx, "Room Menu"))
+	button.SetHasFrame(false)
+	button.SetVAlign(gtk.AlignCenter)
+	button.ConnectClicked(func() {
+		page := m.msgView.Current()
+		if page == nil {
+			return
+		}
+
+		client := gotktrix.FromContext(m.ctx).Offline()
+		hasAlias := client.RoomCanonicalAlias(page.RoomID()) != ""
+		canUpgrade := client.CanSendEvent(page.RoomID(), event.TypeRoomTombstone, true)
+
+		gtkutil.ShowPopoverMenuCustom(button, gtk.PosBottom, []gtkutil.PopoverMenuItem{
+			gtkutil.MenuItem(locale.S(m.ctx, "_Search Messages"), "win.search-messages"),
+			gtkutil.MenuItem(locale.S(m.ctx, "Room _Settings…"), "win.room-settings"),
+			gtkutil.MenuSeparator(""),
+			gtkutil.MenuItem(locale.S(m.ctx, "Copy Room _Address"), "win.copy-room-alias", hasAlias),
+			gtkutil.MenuItem(locale.S(m.ctx, "Copy Room _ID"), "win.copy-room-id"),
+			gtkutil.MenuItem(locale.S(m.ctx, "Copy _Permalink"), "win.copy-room-permalink"),
+			gtkutil.MenuSeparator(""),
+			gtkutil.MenuItem(locale.S(m.ctx, "_Why Can't I…?"), "win.explain-permissions"),
+			gtkutil.MenuItem(locale.S(m.ctx, "_Upgrade Room…"), "win.upgrade-room", canUpgrade),
+		})
+	})
+
+	return button
+}
+
+func (m *manager) searchMessages() {
+	if page := m.msgView.Current(); page != nil {
+		page.ShowSearch()
+	}
+}
+
+func (m *manager) explainPermissions() {
+	if page := m.msgView.Current(); page != nil {
+		roomdialog.ExplainPermissions(m.ctx, page.RoomID())
+	}
+}
+
+func (m *manager) roomSettings() {
+	if page := m.msgView.Current(); page != nil {
+		roomdialog.RoomSettings(m.ctx, page.RoomID(), m.OpenRoom)
+	}
+}
+
+func (m *manager) upgradeRoom() {
+	if page := m.msgView.Current(); page != nil {
+		roomdialog.UpgradeRoom(m.ctx, page.RoomID(), m.OpenRoom)
+	}
+}
+
+func (m *manager) copyRoomAlias() {
+	page := m.msgView.Current()
+	if page == nil {
+		return
+	}
+
+	client := gotktrix.FromContext(m.ctx).Offline()
+	if alias := client.RoomCanonicalAlias(page.RoomID()); alias != "" {
+		copyText(alias)
+	}
+}
+
+func (m *manager) copyRoomID() {
+	page := m.msgView.Current()
+	if page == nil {
+		return
+	}
+
+	copyText(string(page.RoomID()))
+}
+
+func (m *manager) copyRoomPermalink() {
+	page := m.msgView.Current()
+	if page == nil {
+		return
+	}
+
+	roomID := page.RoomID()
+	client := gotktrix.FromContext(m.ctx)
+
+	gtkutil.Async(m.ctx, func() func() {
+		// The via servers are picked from the members, so all of them are
+		// needed.
+		if err := client.RoomEnsureMembers(roomID); err != nil {
+			log.Println("cannot load all members for permalink:", err)
+		}
+
+		link := client.Offline().RoomPermalink(roomID)
+		return func() { copyText(link) }
+	})
+}
+
+func copyText(text string) {
+	gdk.DisplayGetDefault().Clipboard().SetText(text)
 }
 
 func (m *manager) SearchRoom(name string) {
@@ -192,13 +417,19 @@ func (m *manager) OpenRoom(id matrix.RoomID) {
 
 	m.msgView.OpenRoom(id)
 	m.SetSelectedRoom(id)
+	m.roomList.VisitRoom(id)
 
 	rm := m.roomList.Room(id)
 
+	// Let the header be themed with the room.
+	class := messageview.RoomClass(id)
+	m.header.right.AddCSSClass(class)
+
 	// Slight side effect when doing this: if the room gets pushed outside the
 	// visible section, then the information won't be updated until it's
 	// revealed.
 	m.unbindLastRoom = gtkutil.FuncBatcher(
+		func() { m.header.right.RemoveCSSClass(class) },
 		rm.NotifyName(func(_ context.Context, state room.State) {
 			app.SetTitle(m.ctx, state.Name)
 			m.header.rtext.SetTitle(state.Name)
@@ -209,6 +440,17 @@ func (m *manager) OpenRoom(id matrix.RoomID) {
 	)
 }
 
+// OpenRoomInSplit opens the given room beside the current room.
+func (m *manager) OpenRoomInSplit(id matrix.RoomID) {
+	if m.msgView.Current() == nil {
+		// Nothing to split with.
+		m.OpenRoom(id)
+		return
+	}
+
+	m.msgView.OpenRoomInSplit(id)
+}
+
 // SetSelectedRoom sets the given room ID as the selected room row. It does not
 // activate the room. It exists solely as a callback for tabs.
 func (m *manager) SetSelectedRoom(id matrix.RoomID) {